@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAccessDenied is returned by repository operations an AccessPolicy
+// denies.
+var ErrAccessDenied = errors.New("db: access denied")
+
+// AccessRequest describes a repository operation about to run.
+type AccessRequest struct {
+	// Actor is the actor of the unit of work's context, see WithActor.
+	Actor string
+
+	// Operation is SELECT, INSERT, UPDATE or DELETE.
+	Operation string
+
+	Table string
+
+	// Predicate is the WHERE clause of the statement, with named parameters
+	// bound from Args; empty for inserts.
+	Predicate string
+	Args      map[string]interface{}
+}
+
+// AccessPolicy decides whether req may run; a non-nil error denies it.
+type AccessPolicy func(ctx context.Context, req AccessRequest) error
+
+// WithAccessPolicy checks every operation of the repository with policy
+// before running it, cache hits included, so that which roles may read or
+// write which tables is enforced in one place.
+func WithAccessPolicy(policy AccessPolicy) RepositoryOption {
+	return func(c *repositoryConfig) {
+		c.policy = policy
+	}
+}
+
+func (r *Repository[T]) authorize(uow UnitOfWork, operation, predicate string, args map[string]interface{}) error {
+	if r.policy == nil {
+		return nil
+	}
+
+	ctx := contextOf(uow)
+	req := AccessRequest{
+		Actor:     ActorFrom(ctx),
+		Operation: operation,
+		Table:     r.model.Table,
+		Predicate: predicate,
+		Args:      args,
+	}
+	if err := r.policy(ctx, req); err != nil {
+		if errors.Is(err, ErrAccessDenied) {
+			return err
+		}
+		return fmt.Errorf("%w: %s on %s: %v", ErrAccessDenied, operation, r.model.Table, err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func writersOnly(ctx context.Context, req AccessRequest) error {
+	if req.Operation != "SELECT" && req.Actor != "svc:orders" {
+		return errors.New("read-only role")
+	}
+	return nil
+}
+
+func TestShouldDenyOperationsRefusedByAccessPolicy(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectQuery("SELECT id, status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+
+	repo, _ := NewRepository[repositoryOrder](WithAccessPolicy(writersOnly))
+	uow := NewUnitOfWork(database, nil, WithContext(WithActor(context.Background(), "svc:reports")))
+
+	_, err := repo.Find(uow, 7)
+	assert.Nil(t, err)
+
+	err = repo.Delete(uow, 7)
+	assert.True(t, errors.Is(err, ErrAccessDenied))
+	assert.EqualError(t, err, "db: access denied: DELETE on orders: read-only role")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldPassRequestDetailsToAccessPolicy(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var requests []AccessRequest
+	repo, _ := NewRepository[repositoryOrder](WithAccessPolicy(func(ctx context.Context, req AccessRequest) error {
+		requests = append(requests, req)
+		return writersOnly(ctx, req)
+	}))
+	uow := NewUnitOfWork(database, nil, WithContext(WithActor(context.Background(), "svc:orders")))
+
+	assert.Nil(t, repo.Update(uow, &repositoryOrder{ID: 7, Status: "closed"}))
+
+	assert.Equal(t, []AccessRequest{{
+		Actor: "svc:orders", Operation: "UPDATE", Table: "orders",
+		Predicate: "id = :id", Args: map[string]interface{}{"id": int64(7)},
+	}}, requests)
+}
+
+func TestShouldCheckAccessPolicyBeforeCacheHits(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectQuery("SELECT id, status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+
+	allowed := true
+	repo, _ := NewRepository[repositoryOrder](WithEntityCache(time.Hour, 0), WithAccessPolicy(func(ctx context.Context, req AccessRequest) error {
+		if !allowed {
+			return ErrAccessDenied
+		}
+		return nil
+	}))
+	uow := NewUnitOfWork(database, nil)
+
+	repo.Find(uow, 7)
+	allowed = false
+	_, err := repo.Find(uow, 7)
+
+	assert.Equal(t, ErrAccessDenied, err)
+}
@@ -0,0 +1,34 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Count returns the number of rows query returns.
+func Count(uow UnitOfWork, query string, args ...interface{}) (int64, error) {
+	var count sql.NullInt64
+	err := uow.Get(&count, fmt.Sprintf("SELECT COUNT(*) FROM (%s) counted", subquery(query)), args...)
+	return count.Int64, err
+}
+
+// Exists reports whether query returns any row. The database stops at the
+// first one.
+func Exists(uow UnitOfWork, query string, args ...interface{}) (bool, error) {
+	var exists sql.NullBool
+	err := uow.Get(&exists, fmt.Sprintf("SELECT EXISTS (%s)", subquery(query)), args...)
+	return exists.Bool, err
+}
+
+// SumDecimal adds up column over the rows query returns, exactly. It returns
+// zero when there are no rows or every value is NULL.
+func SumDecimal(uow UnitOfWork, column, query string, args ...interface{}) (Decimal, error) {
+	var sum Decimal
+	err := uow.Get(&sum, fmt.Sprintf("SELECT SUM(%s) FROM (%s) summed", column, subquery(query)), args...)
+	return sum, err
+}
+
+func subquery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), "; \n\t")
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCountRowsOfQuery(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM \(SELECT id FROM orders WHERE status = \?\) counted$`).
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	count, err := Count(uw, "SELECT id FROM orders WHERE status = ?;", "open")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestShouldTellWhetherRowsExist(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT EXISTS \(SELECT 1 FROM orders WHERE id = \?\)$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(int64(1)))
+
+	exists, err := Exists(uw, "SELECT 1 FROM orders WHERE id = ?", 7)
+
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
+
+func TestShouldSumDecimalsExactly(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT SUM\(amount\) FROM \(SELECT amount FROM splits\) summed$`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow("10.30"))
+	mock.ExpectQuery(`^SELECT SUM\(amount\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(nil))
+
+	sum, err := SumDecimal(uw, "amount", "SELECT amount FROM splits")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.30", sum.String())
+
+	sum, err = SumDecimal(uw, "amount", "SELECT amount FROM splits WHERE invoice_id = ?", 8)
+	assert.Nil(t, err)
+	assert.True(t, sum.IsZero())
+}
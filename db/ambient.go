@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoUnitOfWork is returned by InContextTransaction for a context that
+// carries no unit of work.
+var ErrNoUnitOfWork = errors.New("db: no unit of work in context")
+
+type unitOfWorkKey struct{}
+
+// WithUnitOfWork returns a context carrying uow, so that code down the call
+// chain, typically repositories, finds it with FromContext instead of having
+// it passed through every signature.
+func WithUnitOfWork(ctx context.Context, uow UnitOfWork) context.Context {
+	return context.WithValue(ctx, unitOfWorkKey{}, uow)
+}
+
+// FromContext returns the unit of work stored by WithUnitOfWork, the
+// transactional one inside InContextTransaction, or nil.
+func FromContext(ctx context.Context) UnitOfWork {
+	uow, _ := ctx.Value(unitOfWorkKey{}).(UnitOfWork)
+	return uow
+}
+
+// InContextTransaction runs fn in a transaction of the unit of work of ctx,
+// begun with ctx, passing it a context whose unit of work is the
+// transactional one, so that every FromContext below fn takes part in the
+// transaction. Called with such a context, it runs fn in a savepoint, as
+// nested InTransaction calls do. The transaction commits unless fn returns
+// an error or panics.
+//
+//	err := db.InContextTransaction(ctx, func(ctx context.Context) error {
+//		if err := orders.Save(ctx, order); err != nil {
+//			return err
+//		}
+//		return ledger.Post(ctx, order.Entries())
+//	})
+func InContextTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	uow := FromContext(ctx)
+	if uow == nil {
+		return ErrNoUnitOfWork
+	}
+
+	_, err := uow.InTransactionContext(ctx, func(tx UnitOfWork) (interface{}, error) {
+		return nil, fn(WithUnitOfWork(ctx, tx))
+	})
+	return err
+}
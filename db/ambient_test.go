@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCarryUnitOfWorkInContext(t *testing.T) {
+	uw, _ := newMockUnitOfWork(t)
+
+	assert.Nil(t, FromContext(context.Background()))
+	assert.Same(t, uw, FromContext(WithUnitOfWork(context.Background(), uw)))
+}
+
+func TestShouldRunContextTransactionWithTheTransactionalUnitOfWork(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE orders SET status = \? WHERE id = \?$`).WithArgs("paid", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^SAVEPOINT sp_1$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO entries`).WillReturnError(errors.New("duplicate key"))
+	mock.ExpectExec(`^ROLLBACK TO SAVEPOINT sp_1$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^RELEASE SAVEPOINT sp_1$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	save := func(ctx context.Context) error {
+		_, err := FromContext(ctx).Exec("UPDATE orders SET status = ? WHERE id = ?", "paid", 1)
+		return err
+	}
+	post := func(ctx context.Context) error {
+		_, err := FromContext(ctx).Exec("INSERT INTO entries (order_id) VALUES (?)", 1)
+		return err
+	}
+
+	err := InContextTransaction(WithUnitOfWork(context.Background(), uw), func(ctx context.Context) error {
+		assert.Equal(t, TxActive, TransactionState(FromContext(ctx)))
+		if err := save(ctx); err != nil {
+			return err
+		}
+		assert.EqualError(t, InContextTransaction(ctx, post), "duplicate key")
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseContextTransactionsWithoutUnitOfWork(t *testing.T) {
+	err := InContextTransaction(context.Background(), func(context.Context) error { return nil })
+
+	assert.Equal(t, ErrNoUnitOfWork, err)
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// AuditEvent describes an executed statement. It never carries arguments.
+type AuditEvent struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Actor is who ran the statement, see WithActor.
+	Actor string `json:"actor,omitempty"`
+	Label string `json:"label,omitempty"`
+
+	// Query is the fingerprint of the statement, inline literals replaced by
+	// placeholders as well.
+	Query      string   `json:"query"`
+	Verb       string   `json:"verb"`
+	Tables     []string `json:"tables,omitempty"`
+	Operations []string `json:"operations,omitempty"`
+	Driver     string   `json:"driver"`
+	InTx       bool     `json:"in_tx"`
+
+	// RowsAffected counts written, or read, rows; -1 when unknown, as for rows
+	// returned by Query and still to be read.
+	RowsAffected int64  `json:"rows_affected"`
+	Err          string `json:"error,omitempty"`
+}
+
+// AuditSink ships audit events to an external system. Write is called from a
+// single goroutine with batches in execution order.
+type AuditSink interface {
+	Write(ctx context.Context, events []AuditEvent) error
+}
+
+// AuditSinkFunc adapts a function, e.g. a Kafka producer call, to AuditSink.
+type AuditSinkFunc func(ctx context.Context, events []AuditEvent) error
+
+// Write implements AuditSink.
+func (f AuditSinkFunc) Write(ctx context.Context, events []AuditEvent) error {
+	return f(ctx, events)
+}
+
+// JSONLinesSink writes one JSON document per event to w, in a single Write
+// call each, so a *syslog.Writer gets one message per event. Use it for files
+// or log shippers.
+func JSONLinesSink(w io.Writer) AuditSink {
+	return AuditSinkFunc(func(ctx context.Context, events []AuditEvent) error {
+		for _, event := range events {
+			line, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AuditConfig configures an Auditor.
+type AuditConfig struct {
+	Sink AuditSink
+
+	// Filter selects the statements to audit, e.g. writes only or those of
+	// privileged roles. Nil audits every statement.
+	Filter func(ctx context.Context, stmt *Statement) bool
+
+	// QueueSize bounds the events waiting to be shipped; further events are
+	// dropped and counted. Zero means 4096.
+	QueueSize int
+
+	// BatchSize is the maximum number of events per Write. Zero means 100.
+	BatchSize int
+
+	// FlushInterval bounds how long an incomplete batch waits. Zero means
+	// one second.
+	FlushInterval time.Duration
+}
+
+// Auditor streams statement metadata to a sink in batches. Install it on unit
+// of works with WithAudit and run it with Run; auditing never blocks nor fails
+// statements.
+type Auditor struct {
+	config  AuditConfig
+	queue   chan AuditEvent
+	dropped int64
+}
+
+// NewAuditor creates an auditor for config.
+func NewAuditor(config AuditConfig) *Auditor {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 4096
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+
+	return &Auditor{config: config, queue: make(chan AuditEvent, config.QueueSize)}
+}
+
+type actorKey struct{}
+
+// WithActor returns a context attributing its statements to actor, e.g. the
+// authenticated user or service account, in audit events.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor stored by WithActor, or "".
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// WithAudit audits the statements of the unit of work through a.
+func WithAudit(a *Auditor) Option {
+	return WithInterceptors(func(ctx context.Context, stmt *Statement, next Handler) error {
+		if a.config.Filter != nil && !a.config.Filter(ctx, stmt) {
+			return next(ctx, stmt)
+		}
+
+		start := time.Now()
+		err := next(ctx, stmt)
+
+		info := Inspect(stmt.Driver, stmt.Query)
+		event := AuditEvent{
+			Time:         start,
+			Duration:     time.Since(start),
+			Actor:        ActorFrom(ctx),
+			Label:        stmt.Label,
+			Query:        Fingerprint(stmt.Query),
+			Verb:         info.Verb,
+			Tables:       info.Tables,
+			Operations:   info.Operations,
+			Driver:       stmt.Driver,
+			InTx:         stmt.InTx,
+			RowsAffected: rowsAffected(stmt, err),
+		}
+		if err != nil {
+			event.Err = err.Error()
+		}
+
+		select {
+		case a.queue <- event:
+		default:
+			atomic.AddInt64(&a.dropped, 1)
+		}
+		return err
+	})
+}
+
+func rowsAffected(stmt *Statement, err error) int64 {
+	if err != nil {
+		return 0
+	}
+
+	switch stmt.Kind {
+	case KindExec:
+		if stmt.Result != nil {
+			if n, err := stmt.Result.RowsAffected(); err == nil {
+				return n
+			}
+		}
+	case KindGet:
+		return 1
+	case KindSelect:
+		if v := reflect.ValueOf(stmt.Dest); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+			return int64(v.Elem().Len())
+		}
+	}
+	return -1
+}
+
+// Run ships queued events until ctx is done, then makes a last attempt,
+// bounded by FlushInterval, to ship the events still queued. Failed batches
+// are logged and dropped.
+func (a *Auditor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AuditEvent, 0, a.config.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.config.Sink.Write(ctx, batch); err != nil {
+			Logger().Error("db: audit batch dropped", "events", len(batch), "err", err)
+			atomic.AddInt64(&a.dropped, int64(len(batch)))
+		}
+		batch = make([]AuditEvent, 0, a.config.BatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			last, cancel := context.WithTimeout(context.Background(), a.config.FlushInterval)
+			defer cancel()
+			for {
+				select {
+				case event := <-a.queue:
+					batch = append(batch, event)
+					if len(batch) == a.config.BatchSize {
+						flush(last)
+					}
+				default:
+					flush(last)
+					return ctx.Err()
+				}
+			}
+		case event := <-a.queue:
+			batch = append(batch, event)
+			if len(batch) == a.config.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// Dropped returns how many events were lost to a full queue or a failed
+// Write.
+func (a *Auditor) Dropped() int64 {
+	return atomic.LoadInt64(&a.dropped)
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldAuditStatementsWithoutArguments(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("UPDATE accounts").WithArgs("s3cret", 7).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("SELECT id FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	var batches [][]AuditEvent
+	auditor := NewAuditor(AuditConfig{Sink: AuditSinkFunc(func(ctx context.Context, events []AuditEvent) error {
+		batches = append(batches, events)
+		return nil
+	})})
+
+	ctx := WithLabel(WithActor(context.Background(), "ops:alice"), "admin.reset")
+	uow := NewUnitOfWork(database, nil, WithContext(ctx), WithAudit(auditor))
+	uow.MustExec("UPDATE accounts SET password = $1 WHERE id = $2", "s3cret", 7)
+	var ids []int64
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM accounts WHERE role = 'admin'"))
+
+	stopped, cancel := context.WithCancel(context.Background())
+	cancel()
+	auditor.Run(stopped)
+
+	assert.Len(t, batches, 1)
+	events := batches[0]
+	assert.Len(t, events, 2)
+
+	assert.Equal(t, "ops:alice", events[0].Actor)
+	assert.Equal(t, "admin.reset", events[0].Label)
+	assert.Equal(t, "UPDATE", events[0].Verb)
+	assert.Equal(t, []string{"accounts"}, events[0].Tables)
+	assert.Equal(t, int64(3), events[0].RowsAffected)
+	assert.Equal(t, int64(2), events[1].RowsAffected)
+	assert.NotContains(t, events[1].Query, "admin")
+
+	encoded, _ := json.Marshal(events)
+	assert.NotContains(t, string(encoded), "s3cret")
+}
+
+func TestShouldDropEventsWhenQueueIsFull(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	auditor := NewAuditor(AuditConfig{Sink: JSONLinesSink(&bytes.Buffer{}), QueueSize: 1})
+	uow := NewUnitOfWork(database, nil, WithAudit(auditor))
+	uow.MustExec("DELETE FROM sessions")
+	uow.MustExec("DELETE FROM sessions")
+
+	assert.Equal(t, int64(1), auditor.Dropped())
+}
+
+func TestShouldFlushPartialBatchesAsJSONLines(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var out bytes.Buffer
+	auditor := NewAuditor(AuditConfig{
+		Sink:          JSONLinesSink(&out),
+		Filter:        func(ctx context.Context, stmt *Statement) bool { return strings.HasPrefix(stmt.Query, "DELETE") },
+		FlushInterval: time.Millisecond,
+	})
+	uow := NewUnitOfWork(database, nil, WithAudit(auditor))
+	uow.MustExec("DELETE FROM sessions")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	auditor.Run(ctx)
+
+	var event AuditEvent
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &event))
+	assert.Equal(t, "DELETE", event.Verb)
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+}
@@ -0,0 +1,281 @@
+// Package backfill runs online, resumable data backfills: a statement applied
+// to a large table in keyset-ordered batches, each committed together with a
+// checkpoint, paced to keep the database healthy.
+package backfill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrOverloaded is returned by Run when a load limit is exceeded. The job
+// stops at its last checkpoint and resumes from it when run again.
+var ErrOverloaded = errors.New("backfill: database load over limit")
+
+// Probe measures some database load, such as replica lag in seconds.
+type Probe func(ctx context.Context) (float64, error)
+
+// Limit stops a backfill when its probe reads more than Max.
+type Limit struct {
+	Name  string
+	Probe Probe
+	Max   float64
+}
+
+// CheckLimits probes every limit, failing with ErrOverloaded on the first one
+// exceeded.
+func CheckLimits(ctx context.Context, limits []Limit) error {
+	for _, limit := range limits {
+		load, err := limit.Probe(ctx)
+		if err != nil {
+			return fmt.Errorf("backfill: probing %s: %w", limit.Name, err)
+		}
+		if load > limit.Max {
+			return fmt.Errorf("%w: %s at %v, limit %v", ErrOverloaded, limit.Name, load, limit.Max)
+		}
+	}
+	return nil
+}
+
+// Job describes a backfill. Batches cover consecutive ranges of KeyColumn of
+// Table, both bounds included, that Statement receives as the named
+// parameters :first and :last, e.g.
+//
+//	UPDATE orders SET total_cents = total * 100
+//	WHERE id BETWEEN :first AND :last AND total_cents IS NULL
+//
+// Func may be given instead of Statement for work that is not a single
+// statement. Both run in the transaction that saves the checkpoint, so a
+// batch is applied at most once.
+type Job struct {
+	// Name identifies the job's checkpoint.
+	Name string
+
+	Table     string
+	KeyColumn string
+
+	Statement string
+	Func      func(uow db.UnitOfWork, first, last interface{}) error
+
+	// BatchSize is the number of keys per batch. Zero means 1000.
+	BatchSize int
+
+	// Sleep is the pause between batches.
+	Sleep time.Duration
+
+	// Limits are checked before every batch.
+	Limits []Limit
+}
+
+// Config configures a Runner. CheckpointTable defaults to
+// backfill_checkpoints:
+//
+//	CREATE TABLE backfill_checkpoints (
+//		name        varchar(128) PRIMARY KEY,
+//		last_key    varchar(255),
+//		updated_at  timestamp NOT NULL,
+//		finished_at timestamp
+//	);
+type Config struct {
+	CheckpointTable string
+
+	// Options configure the transaction of each batch and the reads of the
+	// checkpoint table.
+	Options []db.Option
+}
+
+// Progress reports what a run did.
+type Progress struct {
+	Batches  int
+	Rows     int64
+	LastKey  string
+	Finished bool
+}
+
+// Runner runs backfill jobs against a database.
+type Runner struct {
+	db     *sqlx.DB
+	config Config
+}
+
+// New creates a runner over database.
+func New(database *sqlx.DB, config Config) *Runner {
+	if config.CheckpointTable == "" {
+		config.CheckpointTable = "backfill_checkpoints"
+	}
+
+	return &Runner{db: database, config: config}
+}
+
+// Run processes job from its checkpoint until every key is covered, ctx is
+// done or a limit is exceeded. Running a finished job does nothing.
+func (r *Runner) Run(ctx context.Context, job Job) (Progress, error) {
+	if job.Name == "" || job.Table == "" || job.KeyColumn == "" {
+		return Progress{}, errors.New("backfill: job needs a name, a table and a key column")
+	}
+	if (job.Statement == "") == (job.Func == nil) {
+		return Progress{}, fmt.Errorf("backfill: job %s needs either a statement or a func", job.Name)
+	}
+	if job.BatchSize <= 0 {
+		job.BatchSize = 1000
+	}
+
+	uow := r.unitOfWork(ctx)
+
+	progress, started, err := r.checkpoint(uow, job.Name)
+	if err != nil || progress.Finished {
+		return progress, err
+	}
+	if !started {
+		query := fmt.Sprintf("INSERT INTO %s (name, updated_at) VALUES (:name, :now)", r.config.CheckpointTable)
+		if _, err := uow.MustNamedExec(query, map[string]interface{}{"name": job.Name, "now": time.Now().UTC()}).RowsAffected(); err != nil {
+			return progress, err
+		}
+	}
+
+	for {
+		if err := CheckLimits(ctx, job.Limits); err != nil {
+			return progress, err
+		}
+
+		done, err := r.batch(ctx, job, &progress)
+		if err != nil || done {
+			return progress, err
+		}
+
+		if job.Sleep > 0 {
+			select {
+			case <-ctx.Done():
+				return progress, ctx.Err()
+			case <-time.After(job.Sleep):
+			}
+		} else if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+	}
+}
+
+// Reset removes the checkpoint of the named job, so it runs from the start
+// again.
+func (r *Runner) Reset(ctx context.Context, name string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE name = :name", r.config.CheckpointTable)
+
+	_, err := r.unitOfWork(ctx).MustNamedExec(query, map[string]interface{}{"name": name}).RowsAffected()
+	return err
+}
+
+// batch runs the batch following progress.LastKey in its own transaction,
+// reporting whether there was nothing left to do.
+func (r *Runner) batch(ctx context.Context, job Job, progress *Progress) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+
+	uow := db.NewUnitOfWork(r.db, tx, append([]db.Option{db.WithContext(ctx)}, r.config.Options...)...)
+	done, last, affected, err := r.apply(uow, job, progress.LastKey)
+	if err == nil {
+		err = uow.Commit()
+	} else {
+		uow.Rollback()
+	}
+	if err != nil {
+		return false, fmt.Errorf("backfill: %s after key %q: %w", job.Name, progress.LastKey, err)
+	}
+
+	if done {
+		progress.Finished = true
+		return true, nil
+	}
+
+	progress.Batches++
+	progress.Rows += affected
+	progress.LastKey = last
+	return false, nil
+}
+
+func (r *Runner) apply(uow db.UnitOfWork, job Job, after string) (bool, string, int64, error) {
+	keys := fmt.Sprintf("SELECT %s FROM %s", job.KeyColumn, job.Table)
+	var args []interface{}
+	if after != "" {
+		keys += fmt.Sprintf(" WHERE %s > ?", job.KeyColumn)
+		args = append(args, after)
+	}
+	keys += fmt.Sprintf(" ORDER BY %s LIMIT %d", job.KeyColumn, job.BatchSize)
+
+	var bounds struct {
+		First interface{} `db:"first_key"`
+		Last  interface{} `db:"last_key"`
+	}
+	query := fmt.Sprintf("SELECT MIN(%s) AS first_key, MAX(%s) AS last_key FROM (%s) batch", job.KeyColumn, job.KeyColumn, keys)
+	if err := uow.Get(&bounds, uow.Rebind(query), args...); err != nil {
+		return false, "", 0, err
+	}
+
+	checkpoint := map[string]interface{}{"name": job.Name, "now": time.Now().UTC()}
+
+	if bounds.Last == nil {
+		query := fmt.Sprintf("UPDATE %s SET updated_at = :now, finished_at = :now WHERE name = :name", r.config.CheckpointTable)
+		_, err := uow.MustNamedExec(query, checkpoint).RowsAffected()
+		return true, after, 0, err
+	}
+
+	var affected int64
+	first, last := keyValue(bounds.First), keyValue(bounds.Last)
+	if job.Func != nil {
+		if err := job.Func(uow, first, last); err != nil {
+			return false, "", 0, err
+		}
+	} else {
+		var err error
+		affected, err = uow.MustNamedExec(job.Statement, map[string]interface{}{"first": first, "last": last}).RowsAffected()
+		if err != nil {
+			return false, "", 0, err
+		}
+	}
+
+	checkpoint["last"] = fmt.Sprint(last)
+	query = fmt.Sprintf("UPDATE %s SET last_key = :last, updated_at = :now WHERE name = :name", r.config.CheckpointTable)
+	if _, err := uow.MustNamedExec(query, checkpoint).RowsAffected(); err != nil {
+		return false, "", 0, err
+	}
+
+	return false, fmt.Sprint(last), affected, nil
+}
+
+func (r *Runner) checkpoint(uow db.UnitOfWork, name string) (Progress, bool, error) {
+	var row struct {
+		LastKey    sql.NullString `db:"last_key"`
+		FinishedAt interface{}    `db:"finished_at"`
+	}
+
+	query := uow.Rebind(fmt.Sprintf("SELECT last_key, finished_at FROM %s WHERE name = ?", r.config.CheckpointTable))
+	err := uow.Get(&row, query, name)
+	if err == sql.ErrNoRows {
+		return Progress{}, false, nil
+	}
+	if err != nil {
+		return Progress{}, false, err
+	}
+
+	return Progress{LastKey: row.LastKey.String, Finished: row.FinishedAt != nil}, true, nil
+}
+
+func (r *Runner) unitOfWork(ctx context.Context) db.UnitOfWork {
+	return db.NewUnitOfWork(r.db, nil, append([]db.Option{db.WithContext(ctx)}, r.config.Options...)...)
+}
+
+// keyValue turns the text some drivers return keys as into strings, so they
+// can be bound and stored.
+func keyValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
@@ -0,0 +1,160 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockRunner(t *testing.T, driver string) (*Runner, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return New(sqlx.NewDb(conn, driver), Config{}), mock
+}
+
+var job = Job{
+	Name:      "orders-total-cents",
+	Table:     "orders",
+	KeyColumn: "id",
+	Statement: "UPDATE orders SET total_cents = total * 100 WHERE id BETWEEN :first AND :last",
+	BatchSize: 2,
+}
+
+func TestShouldRunBatchesWithCheckpoints(t *testing.T) {
+	r, mock := newMockRunner(t, "postgres")
+
+	mock.ExpectQuery(`SELECT last_key, finished_at FROM backfill_checkpoints WHERE name = \$1`).
+		WithArgs(job.Name).
+		WillReturnRows(sqlmock.NewRows([]string{"last_key", "finished_at"}))
+	mock.ExpectExec("INSERT INTO backfill_checkpoints").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT MIN\(id\) AS first_key, MAX\(id\) AS last_key FROM \(SELECT id FROM orders ORDER BY id LIMIT 2\) batch`).
+		WillReturnRows(sqlmock.NewRows([]string{"first_key", "last_key"}).AddRow(1, 2))
+	mock.ExpectExec(`UPDATE orders SET total_cents = total \* 100 WHERE id BETWEEN \$1 AND \$2`).
+		WithArgs(int64(1), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE backfill_checkpoints SET last_key").
+		WithArgs("2", sqlmock.AnyArg(), job.Name).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM \(SELECT id FROM orders WHERE id > \$1 ORDER BY id LIMIT 2\) batch`).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"first_key", "last_key"}).AddRow(3, 3))
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE backfill_checkpoints SET last_key").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT MIN").
+		WithArgs("3").
+		WillReturnRows(sqlmock.NewRows([]string{"first_key", "last_key"}).AddRow(nil, nil))
+	mock.ExpectExec("UPDATE backfill_checkpoints SET updated_at = \\$1, finished_at = \\$2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	progress, err := r.Run(context.Background(), job)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Progress{Batches: 2, Rows: 3, LastKey: "3", Finished: true}, progress)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldResumeFromCheckpoint(t *testing.T) {
+	r, mock := newMockRunner(t, "mysql")
+
+	mock.ExpectQuery("SELECT last_key, finished_at FROM backfill_checkpoints").
+		WillReturnRows(sqlmock.NewRows([]string{"last_key", "finished_at"}).AddRow("40", nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`WHERE id > \? ORDER BY id LIMIT 2`).
+		WithArgs("40").
+		WillReturnRows(sqlmock.NewRows([]string{"first_key", "last_key"}).AddRow(nil, nil))
+	mock.ExpectExec("UPDATE backfill_checkpoints SET updated_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	progress, err := r.Run(context.Background(), job)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "40", progress.LastKey)
+	assert.True(t, progress.Finished)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSkipFinishedJobs(t *testing.T) {
+	r, mock := newMockRunner(t, "mysql")
+
+	mock.ExpectQuery("SELECT last_key, finished_at FROM backfill_checkpoints").
+		WillReturnRows(sqlmock.NewRows([]string{"last_key", "finished_at"}).AddRow("40", "2024-01-01 00:00:00"))
+
+	progress, err := r.Run(context.Background(), job)
+
+	assert.Nil(t, err)
+	assert.True(t, progress.Finished)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldStopWhenOverloaded(t *testing.T) {
+	r, mock := newMockRunner(t, "mysql")
+
+	mock.ExpectQuery("SELECT last_key, finished_at FROM backfill_checkpoints").
+		WillReturnRows(sqlmock.NewRows([]string{"last_key", "finished_at"}).AddRow("40", nil))
+
+	overloaded := job
+	overloaded.Limits = []Limit{{Name: "replica lag", Max: 5, Probe: func(context.Context) (float64, error) {
+		return 12, nil
+	}}}
+
+	progress, err := r.Run(context.Background(), overloaded)
+
+	assert.True(t, errors.Is(err, ErrOverloaded))
+	assert.False(t, progress.Finished)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollBackFailedBatch(t *testing.T) {
+	r, mock := newMockRunner(t, "mysql")
+
+	mock.ExpectQuery("SELECT last_key, finished_at FROM backfill_checkpoints").
+		WillReturnRows(sqlmock.NewRows([]string{"last_key", "finished_at"}).AddRow("", nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT MIN").
+		WillReturnRows(sqlmock.NewRows([]string{"first_key", "last_key"}).AddRow([]byte("a"), []byte("b")))
+	mock.ExpectRollback()
+
+	withFunc := job
+	withFunc.Statement = ""
+	withFunc.Func = func(uow db.UnitOfWork, first, last interface{}) error {
+		assert.Equal(t, "a", first)
+		assert.Equal(t, "b", last)
+		return errors.New("boom")
+	}
+
+	progress, err := r.Run(context.Background(), withFunc)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, progress.Batches)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldProbeMySQLReplicaLag(t *testing.T) {
+	conn, mock, _ := sqlmock.New()
+	defer conn.Close()
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").
+		WillReturnRows(sqlmock.NewRows([]string{"Replica_IO_State", "Seconds_Behind_Source"}).AddRow("Waiting", []byte("7")))
+
+	lag, err := ReplicaLag(sqlx.NewDb(conn, "mysql"))(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 7.0, lag)
+}
@@ -0,0 +1,88 @@
+package backfill
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// ReplicaLag probes how many seconds replica is behind its primary, on
+// Postgres standbys and MySQL replicas. On Postgres an idle primary makes the
+// lag grow as well, since nothing is replayed.
+func ReplicaLag(replica *sqlx.DB) Probe {
+	return func(ctx context.Context) (float64, error) {
+		switch db.DialectFor(replica.DriverName()) {
+		case db.DialectPostgres:
+			var lag sql.NullFloat64
+			err := replica.GetContext(ctx, &lag,
+				"SELECT EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())")
+			if err == nil && !lag.Valid {
+				err = fmt.Errorf("backfill: %s is not a standby", replica.DriverName())
+			}
+			return lag.Float64, err
+		case db.DialectMySQL:
+			return mysqlReplicaLag(ctx, replica)
+		}
+		return 0, fmt.Errorf("backfill: replica lag is not supported on %s", replica.DriverName())
+	}
+}
+
+func mysqlReplicaLag(ctx context.Context, replica *sqlx.DB) (float64, error) {
+	rows, err := replica.QueryxContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("backfill: not a replica")
+	}
+
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+
+	for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		value, ok := status[column]
+		if !ok {
+			continue
+		}
+		if value == nil {
+			return 0, errors.New("backfill: replication is stopped")
+		}
+		if b, ok := value.([]byte); ok {
+			return strconv.ParseFloat(string(b), 64)
+		}
+		return strconv.ParseFloat(fmt.Sprint(value), 64)
+	}
+	return 0, errors.New("backfill: replica status has no lag")
+}
+
+// ActiveQueries probes how many sessions are running a statement, a cheap
+// proxy for database CPU load.
+func ActiveQueries(database *sqlx.DB) Probe {
+	return func(ctx context.Context) (float64, error) {
+		var query string
+		switch db.DialectFor(database.DriverName()) {
+		case db.DialectPostgres:
+			query = "SELECT count(*) FROM pg_stat_activity WHERE state = 'active' AND pid <> pg_backend_pid()"
+		case db.DialectMySQL:
+			query = "SELECT COUNT(*) FROM information_schema.processlist WHERE command NOT IN ('Sleep', 'Daemon', 'Binlog Dump') AND id <> CONNECTION_ID()"
+		default:
+			return 0, fmt.Errorf("backfill: active queries are not supported on %s", database.DriverName())
+		}
+
+		var active float64
+		err := database.GetContext(ctx, &active, query)
+		return active, err
+	}
+}
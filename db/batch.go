@@ -0,0 +1,280 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// BatchOptions tunes ExecBatch and BatchInsert.
+type BatchOptions struct {
+	// ChunkSize is the number of rows per statement. Zero means 500; chunks
+	// are made smaller when their bindvars would exceed what the database
+	// accepts in a statement, see maxParameters.
+	ChunkSize int
+
+	// ContinueOnError runs the remaining chunks after one fails. Inside a
+	// transaction every chunk then runs in a savepoint, so that a failed one
+	// does not abort the transaction.
+	ContinueOnError bool
+
+	// Copy makes BatchInsert stream the rows through COPY FROM STDIN, much
+	// faster on Postgres with lib/pq, as a single chunk. COPY bypasses the
+	// interceptors and runs in a transaction, that of the unit of work if
+	// any.
+	Copy bool
+}
+
+// ChunkError reports the failure of the chunk of rows First to Last, indexes
+// into the rows given, both included.
+type ChunkError struct {
+	First, Last int
+	Err         error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("db: batch rows %d to %d: %v", e.First, e.Last, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// BatchResult sums up a batch: the rows the successful chunks affected, and
+// the chunks that failed.
+type BatchResult struct {
+	Chunks       int
+	RowsAffected int64
+	Failed       []*ChunkError
+}
+
+// ExecBatch runs query, a named INSERT with a single VALUES group such as
+//
+//	INSERT INTO orders (id, status) VALUES (:id, :status) ON CONFLICT DO NOTHING
+//
+// for every row, as multi-row INSERT statements repeating the group once per
+// row of a chunk. Rows are structs or maps, bound like MustNamedExec binds.
+// The first failing chunk stops the batch unless ContinueOnError is set; the
+// error returned joins the ChunkErrors of the failed chunks.
+func ExecBatch[T any](uow UnitOfWork, query string, rows []T, opts BatchOptions) (*BatchResult, error) {
+	dialect := DialectFor(uow.DriverName())
+	prefix, group, suffix, err := splitValues(dialect, query)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 500
+	}
+	if params, limit := countPlaceholders(dialect, group), maxParameters(dialect); params > 0 && opts.ChunkSize*params > limit {
+		opts.ChunkSize = limit / params
+	}
+
+	result := &BatchResult{}
+	for first := 0; first < len(rows); first += opts.ChunkSize {
+		last := first + opts.ChunkSize
+		if last > len(rows) {
+			last = len(rows)
+		}
+
+		affected, err := execChunk(uow, prefix, group, suffix, rows[first:last], opts)
+		result.Chunks++
+		if err != nil {
+			result.Failed = append(result.Failed, &ChunkError{First: first, Last: last - 1, Err: err})
+			if !opts.ContinueOnError {
+				break
+			}
+			continue
+		}
+		result.RowsAffected += affected
+	}
+	return result, result.err()
+}
+
+func (r *BatchResult) err() error {
+	errs := make([]error, len(r.Failed))
+	for i, failed := range r.Failed {
+		errs[i] = failed
+	}
+	return errors.Join(errs...)
+}
+
+func execChunk[T any](uow UnitOfWork, prefix, group, suffix string, rows []T, opts BatchOptions) (int64, error) {
+	var b strings.Builder
+	var args []interface{}
+	b.WriteString(prefix)
+	for i, row := range rows {
+		bound, rowArgs, err := sqlx.Named(group, row)
+		if err != nil {
+			return 0, err
+		}
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(bound)
+		args = append(args, rowArgs...)
+	}
+	b.WriteString(suffix)
+
+	query, args, err := expandIn(DialectFor(uow.DriverName()), sqlx.BindType(uow.DriverName()), b.String(), args, false)
+	if err != nil {
+		return 0, err
+	}
+
+	exec := func(uow UnitOfWork) (int64, error) {
+		res, err := uow.Exec(query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+	if !opts.ContinueOnError || !IsTransactional(uow) {
+		return exec(uow)
+	}
+	return InTransaction(uow, exec)
+}
+
+// splitValues splits query around its VALUES group.
+func splitValues(dialect Dialect, query string) (prefix, group, suffix string, err error) {
+	tokens := lexSQLFor(dialect, query)
+	for i, t := range tokens {
+		if !t.is("values") || i+1 >= len(tokens) || tokens[i+1].text != "(" {
+			continue
+		}
+
+		depth := 0
+		for _, u := range tokens[i+1:] {
+			switch u.text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if depth == 0 {
+				open := tokens[i+1].start
+				return query[:open], query[open:u.end], query[u.end:], nil
+			}
+		}
+		break
+	}
+	return "", "", "", fmt.Errorf("db: no VALUES (...) group to repeat in %q", query)
+}
+
+func countPlaceholders(dialect Dialect, query string) int {
+	n := 0
+	for _, t := range lexSQLFor(dialect, query) {
+		if t.kind == sqlPlaceholder {
+			n++
+		}
+	}
+	return n
+}
+
+// BatchInsert inserts rows, a slice of structs, into table with ExecBatch,
+// or COPY when opts.Copy is set. Columns are those of the registered model
+// of the structs, or every field mapped with a db tag.
+func BatchInsert(uow UnitOfWork, table string, rows interface{}, opts BatchOptions) (*BatchResult, error) {
+	v := reflect.Indirect(reflect.ValueOf(rows))
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("db: cannot batch insert %T, expected a slice", rows)
+	}
+	columns, err := batchColumns(v.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	if opts.Copy {
+		return copyRows(uow, table, columns, values)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), namedList(columns))
+	return ExecBatch(uow, query, values, opts)
+}
+
+func batchColumns(t reflect.Type) ([]string, error) {
+	if m, err := modelOfType(t); err == nil {
+		return m.Columns, nil
+	}
+	t = reflectx.Deref(t)
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("db: cannot batch insert %s, expected structs", t)
+	}
+
+	var columns []string
+	for _, fi := range mapper.TypeMap(t).Index {
+		if !fi.Embedded && fi.Name != "" && !strings.Contains(fi.Path, ".") {
+			columns = append(columns, fi.Path)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("db: %s maps no column", t)
+	}
+	return columns, nil
+}
+
+// copyRows streams rows through a prepared COPY statement, the way Restore
+// does.
+func copyRows(uow UnitOfWork, table string, columns []string, rows []interface{}) (*BatchResult, error) {
+	u, ok := uow.(*unitOfWork)
+	if !ok || DialectFor(u.DriverName()) != DialectPostgres {
+		return nil, errors.New("db: COPY requires postgres and this package's UnitOfWork")
+	}
+
+	result := &BatchResult{Chunks: 1}
+	err := copyIn(u.context(), u, table, columns, rows)
+	if err != nil {
+		result.Failed = append(result.Failed, &ChunkError{First: 0, Last: len(rows) - 1, Err: err})
+		return result, result.err()
+	}
+	result.RowsAffected = int64(len(rows))
+	return result, nil
+}
+
+func copyIn(ctx context.Context, u *unitOfWork, table string, columns []string, rows []interface{}) error {
+	tx := u.currentTx()
+	if tx == nil {
+		begun, err := u.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer begun.Rollback()
+		tx = begun
+	}
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", ")))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		v := reflect.Indirect(reflect.ValueOf(row))
+		args := make([]interface{}, len(columns))
+		for i, c := range columns {
+			field, ok := fieldByColumn(mapper, v, c)
+			if !ok {
+				return fmt.Errorf("db: %s has no field mapped to %s", v.Type(), c)
+			}
+			args[i] = field.Interface()
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return err
+	}
+
+	if tx != u.currentTx() {
+		return tx.Commit()
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldInsertRowsInMultiValueChunks(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec(`^INSERT INTO orders \(id, status\) VALUES \(\$1, \$2\), \(\$3, \$4\)$`).
+		WithArgs(int64(1), "open", int64(2), "paid").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^INSERT INTO orders \(id, status\) VALUES \(\$1, \$2\)$`).
+		WithArgs(int64(3), "open").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows := []repositoryOrder{{1, "open"}, {2, "paid"}, {3, "open"}}
+	result, err := BatchInsert(NewUnitOfWork(database, nil), "orders", rows, BatchOptions{ChunkSize: 2})
+
+	assert.Nil(t, err)
+	assert.Equal(t, &BatchResult{Chunks: 2, RowsAffected: 3}, result)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldKeepChunksUnderTheBindvarsOfTheDatabase(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlite3")
+	mock.ExpectExec(`^INSERT INTO tags \(name, weight\) VALUES`).WillReturnResult(sqlmock.NewResult(0, 16383))
+	mock.ExpectExec(`^INSERT INTO tags \(name, weight\) VALUES \(\?, \?\)$`).
+		WithArgs("last", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows := make([]map[string]interface{}, 16384)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"name": "tag", "weight": 1}
+	}
+	rows[len(rows)-1]["name"] = "last"
+	result, err := ExecBatch(NewUnitOfWork(database, nil), "INSERT INTO tags (name, weight) VALUES (:name, :weight)", rows,
+		BatchOptions{ChunkSize: 20000})
+
+	assert.Nil(t, err)
+	assert.Equal(t, &BatchResult{Chunks: 2, RowsAffected: 16384}, result)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldKeepStatementSuffixAndReportFailedChunks(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectExec(`^INSERT INTO tags \(name\) VALUES \(\?\), \(\?\) ON CONFLICT DO NOTHING$`).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec(`^INSERT INTO tags \(name\) VALUES \(\?\) ON CONFLICT DO NOTHING$`).
+		WithArgs("c").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows := []map[string]interface{}{{"name": "a"}, {"name": "b"}, {"name": "c"}}
+	result, err := ExecBatch(uow, "INSERT INTO tags (name) VALUES (:name) ON CONFLICT DO NOTHING", rows,
+		BatchOptions{ChunkSize: 2, ContinueOnError: true})
+
+	assert.EqualError(t, err, "db: batch rows 0 to 1: connection reset")
+	var chunk *ChunkError
+	if assert.True(t, errors.As(err, &chunk)) {
+		assert.Equal(t, 0, chunk.First)
+		assert.Equal(t, 1, chunk.Last)
+	}
+	assert.Equal(t, 2, result.Chunks)
+	assert.Equal(t, int64(1), result.RowsAffected)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRunChunksInSavepointsInsideTransactions(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO tags").WillReturnError(errors.New("duplicate key"))
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO tags").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var result *BatchResult
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		result, _ = ExecBatch(tx, "INSERT INTO tags (name) VALUES (:name)", []map[string]interface{}{{"name": "a"}, {"name": "b"}},
+			BatchOptions{ChunkSize: 1, ContinueOnError: true})
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Failed, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldCopyRowsOnPostgres(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	copyStmt := mock.ExpectPrepare(`^COPY orders \(id, status\) FROM STDIN$`)
+	copyStmt.ExpectExec().WithArgs(int64(1), "open").WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt.ExpectExec().WithArgs(int64(2), "paid").WillReturnResult(sqlmock.NewResult(0, 0))
+	copyStmt.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	rows := []repositoryOrder{{1, "open"}, {2, "paid"}}
+	result, err := BatchInsert(NewUnitOfWork(database, nil), "orders", rows, BatchOptions{Copy: true})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.RowsAffected)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequireValuesGroupToBatch(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	_, err := ExecBatch(uow, "UPDATE orders SET status = :status", []map[string]interface{}{{"status": "paid"}}, BatchOptions{})
+
+	assert.EqualError(t, err, `db: no VALUES (...) group to repeat in "UPDATE orders SET status = :status"`)
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBudgetExceeded is returned in strict mode for statements past the
+// budget of their label.
+var ErrBudgetExceeded = errors.New("db: budget exceeded")
+
+// Budget bounds the database work of a request. Zero fields are unbounded.
+type Budget struct {
+	MaxQueries int64
+	MaxTime    time.Duration
+}
+
+func (b Budget) exceeded(s StatsSummary) bool {
+	return (b.MaxQueries > 0 && s.Queries >= b.MaxQueries) || (b.MaxTime > 0 && s.Time >= b.MaxTime)
+}
+
+// BudgetConfig assigns budgets to labels, typically one per endpoint set with
+// WithLabel.
+type BudgetConfig struct {
+	Labels map[string]Budget
+
+	// Default applies to labels without a budget, and unlabeled statements.
+	Default Budget
+
+	// Strict fails statements past the budget with ErrBudgetExceeded instead
+	// of only reporting them.
+	Strict bool
+
+	// OnExceed is called once per request exceeding its budget, with the work
+	// done so far. Nil logs it.
+	OnExceed func(label string, budget Budget, summary StatsSummary)
+}
+
+// BudgetInterceptor enforces budgets on the work counted by the Stats of a
+// context, see WithStats and StatsMiddleware; statements run without Stats
+// are left alone. A statement exceeds the budget when the work done before it
+// already reached it.
+func BudgetInterceptor(config BudgetConfig) Interceptor {
+	if config.OnExceed == nil {
+		config.OnExceed = func(label string, budget Budget, summary StatsSummary) {
+			Logger().Warn("db: over budget", "label", label, "max_queries", budget.MaxQueries, "max_db_time", budget.MaxTime,
+				"queries", summary.Queries, "db_time", summary.Time)
+		}
+	}
+
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		stats := StatsFrom(ctx)
+		if stats == nil {
+			return next(ctx, stmt)
+		}
+
+		budget, ok := config.Labels[stmt.Label]
+		if !ok || stmt.Label == "" {
+			budget = config.Default
+		}
+
+		summary := stats.Summary()
+		if !budget.exceeded(summary) {
+			return next(ctx, stmt)
+		}
+
+		if atomic.CompareAndSwapInt32(&stats.overBudget, 0, 1) {
+			config.OnExceed(stmt.Label, budget, summary)
+		}
+		if config.Strict {
+			return fmt.Errorf("%w: %s after %d queries in %s", ErrBudgetExceeded, stmt.Label, summary.Queries, summary.Time)
+		}
+		return next(ctx, stmt)
+	}
+}
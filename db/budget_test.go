@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldReportRequestsOverBudgetOnce(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	for i := 0; i < 4; i++ {
+		mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	var reports []StatsSummary
+	interceptor := BudgetInterceptor(BudgetConfig{
+		Labels:   map[string]Budget{"orders.update": {MaxQueries: 2}},
+		OnExceed: func(label string, budget Budget, summary StatsSummary) { reports = append(reports, summary) },
+	})
+	ctx, _ := WithStats(WithLabel(context.Background(), "orders.update"))
+	uow := NewUnitOfWork(database, nil, WithContext(ctx), WithInterceptors(interceptor))
+
+	for i := 0; i < 4; i++ {
+		uow.MustExec("UPDATE orders SET status = 'paid' WHERE id = ?", i)
+	}
+
+	if assert.Len(t, reports, 1) {
+		assert.Equal(t, int64(2), reports[0].Queries)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldFailStatementsOverBudgetInStrictMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectQuery("^SELECT id FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	interceptor := BudgetInterceptor(BudgetConfig{
+		Default:  Budget{MaxQueries: 1},
+		Strict:   true,
+		OnExceed: func(string, Budget, StatsSummary) {},
+	})
+	ctx, _ := WithStats(context.Background())
+	uow := NewUnitOfWork(database, nil, WithContext(ctx), WithInterceptors(interceptor))
+
+	var ids []int64
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders"))
+	err := uow.Select(&ids, "SELECT id FROM orders")
+
+	assert.True(t, errors.Is(err, ErrBudgetExceeded))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// InsertBuilder builds an INSERT of one or more rows, started with
+// UnitOfWork.Insert:
+//
+//	uow.Insert("users").Columns("id", "name").Values(1, "ada").Values(2, "alan").Exec()
+//
+// Values are bound as parameters, slices being expanded like NamedIn does.
+type InsertBuilder struct {
+	uow     UnitOfWork
+	table   string
+	columns []string
+	rows    [][]interface{}
+	err     error
+}
+
+// UpdateBuilder builds an UPDATE, started with UnitOfWork.Update:
+//
+//	uow.Update("users").Set("name", "ada").Where("id = ?", 1).Exec()
+type UpdateBuilder struct {
+	uow   UnitOfWork
+	table string
+	set   []assignment
+	where conditions
+}
+
+// DeleteBuilder builds a DELETE, started with UnitOfWork.Delete:
+//
+//	uow.Delete("sessions").WhereNamed("expires_at < :now", map[string]interface{}{"now": now}).Exec()
+type DeleteBuilder struct {
+	uow   UnitOfWork
+	table string
+	where conditions
+}
+
+type assignment struct {
+	column string
+	value  interface{}
+}
+
+// conditions are the WHERE conditions of a builder, ANDed, in the ? form
+// with their arguments.
+type conditions struct {
+	exprs []string
+	args  []interface{}
+	err   error
+}
+
+func (u *unitOfWork) Insert(table string) *InsertBuilder {
+	return &InsertBuilder{uow: u, table: table}
+}
+
+func (u *unitOfWork) Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{uow: u, table: table}
+}
+
+func (u *unitOfWork) Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{uow: u, table: table}
+}
+
+// Columns sets the columns of the inserted rows.
+func (b *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	b.columns = columns
+	return b
+}
+
+// Values adds a row, one value per column.
+func (b *InsertBuilder) Values(values ...interface{}) *InsertBuilder {
+	if len(values) != len(b.columns) && b.err == nil {
+		b.err = fmt.Errorf("db: insert into %s has %d columns, not %d values", b.table, len(b.columns), len(values))
+	}
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// SetMap adds a row from a map of columns to values; the first row sets the
+// columns, in name order, when Columns was not called.
+func (b *InsertBuilder) SetMap(row map[string]interface{}) *InsertBuilder {
+	if b.columns == nil {
+		for column := range row {
+			b.columns = append(b.columns, column)
+		}
+		sort.Strings(b.columns)
+	}
+
+	values := make([]interface{}, len(b.columns))
+	for i, column := range b.columns {
+		value, ok := row[column]
+		if !ok && b.err == nil {
+			b.err = fmt.Errorf("db: insert into %s has no value for %s", b.table, column)
+		}
+		values[i] = value
+	}
+	if len(row) != len(b.columns) && b.err == nil {
+		b.err = fmt.Errorf("db: insert into %s has %d columns, not %d values", b.table, len(b.columns), len(row))
+	}
+	b.rows = append(b.rows, values)
+	return b
+}
+
+// SQL returns the statement with the bindvars of the driver, and its
+// arguments.
+func (b *InsertBuilder) SQL() (string, []interface{}, error) {
+	if b.err != nil {
+		return "", nil, b.err
+	}
+	if len(b.columns) == 0 || len(b.rows) == 0 {
+		return "", nil, fmt.Errorf("db: insert into %s has no values", b.table)
+	}
+
+	group := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(b.columns)), ", ") + ")"
+	groups := make([]string, len(b.rows))
+	args := make([]interface{}, 0, len(b.rows)*len(b.columns))
+	for i, row := range b.rows {
+		groups[i] = group
+		args = append(args, row...)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", b.table, strings.Join(b.columns, ", "), strings.Join(groups, ", "))
+	return bindBuilt(b.uow, query, args)
+}
+
+// Exec runs the statement.
+func (b *InsertBuilder) Exec() (sql.Result, error) {
+	return b.ExecContext(contextOf(b.uow))
+}
+
+// ExecContext runs the statement with ctx.
+func (b *InsertBuilder) ExecContext(ctx context.Context) (sql.Result, error) {
+	return execBuilt(ctx, b.uow, b.SQL)
+}
+
+// Set assigns value to column.
+func (b *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	b.set = append(b.set, assignment{column: column, value: value})
+	return b
+}
+
+// SetMap assigns the values of a map to their columns, in name order.
+func (b *UpdateBuilder) SetMap(values map[string]interface{}) *UpdateBuilder {
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	for _, column := range columns {
+		b.Set(column, values[column])
+	}
+	return b
+}
+
+// Where adds a condition with ? placeholders, ANDed with the others.
+func (b *UpdateBuilder) Where(expr string, args ...interface{}) *UpdateBuilder {
+	b.where.add(expr, args)
+	return b
+}
+
+// WhereNamed adds a condition with :name parameters bound from arg, a map or
+// a struct, as NamedQuery does.
+func (b *UpdateBuilder) WhereNamed(expr string, arg interface{}) *UpdateBuilder {
+	b.where.addNamed(expr, arg)
+	return b
+}
+
+// SQL returns the statement with the bindvars of the driver, and its
+// arguments. An UPDATE without condition is refused; use Where("1 = 1")
+// to update every row.
+func (b *UpdateBuilder) SQL() (string, []interface{}, error) {
+	if len(b.set) == 0 {
+		return "", nil, fmt.Errorf("db: update of %s sets nothing", b.table)
+	}
+	where, whereArgs, err := b.where.sql("update of " + b.table)
+	if err != nil {
+		return "", nil, err
+	}
+
+	assignments := make([]string, len(b.set))
+	args := make([]interface{}, 0, len(b.set)+len(whereArgs))
+	for i, a := range b.set {
+		assignments[i] = a.column + " = ?"
+		args = append(args, a.value)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", b.table, strings.Join(assignments, ", "), where)
+	return bindBuilt(b.uow, query, append(args, whereArgs...))
+}
+
+// Exec runs the statement.
+func (b *UpdateBuilder) Exec() (sql.Result, error) {
+	return b.ExecContext(contextOf(b.uow))
+}
+
+// ExecContext runs the statement with ctx.
+func (b *UpdateBuilder) ExecContext(ctx context.Context) (sql.Result, error) {
+	return execBuilt(ctx, b.uow, b.SQL)
+}
+
+// Where adds a condition with ? placeholders, ANDed with the others.
+func (b *DeleteBuilder) Where(expr string, args ...interface{}) *DeleteBuilder {
+	b.where.add(expr, args)
+	return b
+}
+
+// WhereNamed adds a condition with :name parameters bound from arg, a map or
+// a struct, as NamedQuery does.
+func (b *DeleteBuilder) WhereNamed(expr string, arg interface{}) *DeleteBuilder {
+	b.where.addNamed(expr, arg)
+	return b
+}
+
+// SQL returns the statement with the bindvars of the driver, and its
+// arguments. A DELETE without condition is refused; use Where("1 = 1") to
+// delete every row.
+func (b *DeleteBuilder) SQL() (string, []interface{}, error) {
+	where, args, err := b.where.sql("delete from " + b.table)
+	if err != nil {
+		return "", nil, err
+	}
+	return bindBuilt(b.uow, fmt.Sprintf("DELETE FROM %s WHERE %s", b.table, where), args)
+}
+
+// Exec runs the statement.
+func (b *DeleteBuilder) Exec() (sql.Result, error) {
+	return b.ExecContext(contextOf(b.uow))
+}
+
+// ExecContext runs the statement with ctx.
+func (b *DeleteBuilder) ExecContext(ctx context.Context) (sql.Result, error) {
+	return execBuilt(ctx, b.uow, b.SQL)
+}
+
+func (c *conditions) add(expr string, args []interface{}) {
+	c.exprs = append(c.exprs, expr)
+	c.args = append(c.args, args...)
+}
+
+func (c *conditions) addNamed(expr string, arg interface{}) {
+	plan, err := namedPlanFor(expr, sqlx.QUESTION)
+	if err == nil {
+		var args []interface{}
+		if args, err = plan.bind(arg); err == nil {
+			c.add(plan.question, args)
+			return
+		}
+	}
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *conditions) sql(statement string) (string, []interface{}, error) {
+	if c.err != nil {
+		return "", nil, c.err
+	}
+	if len(c.exprs) == 0 {
+		return "", nil, fmt.Errorf("db: %s has no WHERE condition", statement)
+	}
+	if len(c.exprs) == 1 {
+		return c.exprs[0], c.args, nil
+	}
+	return "(" + strings.Join(c.exprs, ") AND (") + ")", c.args, nil
+}
+
+// bindBuilt turns the ? placeholders of a built query into the bindvars of
+// the driver, expanding slice arguments.
+func bindBuilt(uow UnitOfWork, query string, args []interface{}) (string, []interface{}, error) {
+	return expandIn(DialectFor(uow.DriverName()), sqlx.BindType(uow.DriverName()), query, args, false)
+}
+
+func execBuilt(ctx context.Context, uow UnitOfWork, build func() (string, []interface{}, error)) (sql.Result, error) {
+	query, args, err := build()
+	if err != nil {
+		return nil, err
+	}
+	return uow.ExecContext(ctx, query, args...)
+}
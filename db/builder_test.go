@@ -0,0 +1,93 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldBuildInsertsForTheDriver(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+	uow := NewUnitOfWork(database, nil)
+
+	query, args, err := uow.Insert("users").Columns("id", "name").Values(1, "ada").Values(2, "alan").SQL()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO users (id, name) VALUES ($1, $2), ($3, $4)", query)
+	assert.Equal(t, []interface{}{1, "ada", 2, "alan"}, args)
+
+	query, args, err = uow.Insert("users").SetMap(map[string]interface{}{"name": "ada", "id": 1}).SQL()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO users (id, name) VALUES ($1, $2)", query)
+	assert.Equal(t, []interface{}{1, "ada"}, args)
+}
+
+func TestShouldRejectInsertsWithMismatchedValues(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	_, _, err := uow.Insert("users").Columns("id", "name").Values(1).SQL()
+	assert.EqualError(t, err, "db: insert into users has 2 columns, not 1 values")
+
+	_, _, err = uow.Insert("users").SetMap(map[string]interface{}{"id": 1}).SetMap(map[string]interface{}{"name": "ada"}).SQL()
+	assert.EqualError(t, err, "db: insert into users has no value for id")
+
+	_, _, err = uow.Insert("users").Columns("id").SQL()
+	assert.EqualError(t, err, "db: insert into users has no values")
+}
+
+func TestShouldBuildUpdatesWithPositionalAndNamedConditions(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+	uow := NewUnitOfWork(database, nil)
+
+	query, args, err := uow.Update("orders").
+		Set("status", "paid").
+		Where("id IN (?)", []int64{3, 5}).
+		WhereNamed("tenant_id = :tenant AND deleted_at IS NULL", map[string]interface{}{"tenant": 7}).
+		SQL()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE orders SET status = $1 WHERE (id IN ($2, $3)) AND (tenant_id = $4 AND deleted_at IS NULL)", query)
+	assert.Equal(t, []interface{}{"paid", int64(3), int64(5), 7}, args)
+}
+
+func TestShouldRefuseUnconditionalUpdatesAndDeletes(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	_, _, err := uow.Update("orders").Set("status", "paid").SQL()
+	assert.EqualError(t, err, "db: update of orders has no WHERE condition")
+
+	_, _, err = uow.Update("orders").Where("id = ?", 1).SQL()
+	assert.EqualError(t, err, "db: update of orders sets nothing")
+
+	_, _, err = uow.Delete("orders").SQL()
+	assert.EqualError(t, err, "db: delete from orders has no WHERE condition")
+
+	_, _, err = uow.Delete("orders").WhereNamed("id = :id", map[string]interface{}{}).SQL()
+	assert.EqualError(t, err, "could not find name id in map[string]interface {}{}")
+}
+
+func TestShouldExecBuiltStatements(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectExec(`^UPDATE orders SET note = \?, status = \? WHERE id = \?$`).
+		WithArgs("late", "paid", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM orders WHERE status = \?$`).
+		WithArgs("void").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	result, err := uow.Update("orders").SetMap(map[string]interface{}{"status": "paid", "note": "late"}).Where("id = ?", 1).Exec()
+	assert.Nil(t, err)
+	affected, _ := result.RowsAffected()
+	assert.Equal(t, int64(1), affected)
+
+	type filter struct {
+		Status string `db:"status"`
+	}
+	result, err = uow.Delete("orders").WhereNamed("status = :status", filter{Status: "void"}).Exec()
+	assert.Nil(t, err)
+	affected, _ = result.RowsAffected()
+	assert.Equal(t, int64(3), affected)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,157 @@
+// Package changefeed streams table-change events to HTTP clients as
+// Server-Sent Events, so dashboards can live-update instead of polling.
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// Event is a change to a table row.
+type Event struct {
+	Table string          `json:"table"`
+	Op    string          `json:"op"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// Source produces change events, sending them on events until ctx is done or
+// the source fails.
+type Source interface {
+	Listen(ctx context.Context, events chan<- Event) error
+}
+
+// Filter decides whether a subscriber receives an event. A nil Filter accepts
+// every event.
+type Filter func(Event) bool
+
+// Options configures a Feed.
+type Options struct {
+	// Buffer is the number of events queued per subscriber before further
+	// events are dropped for it. Zero means 64.
+	Buffer int
+}
+
+// Feed fans the events of a Source out to subscribers. A slow subscriber
+// never blocks the feed: events that do not fit its buffer are dropped and
+// counted.
+type Feed struct {
+	source Source
+	opts   Options
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// New creates a feed over source. Nothing is delivered until Run is called.
+func New(source Source, opts Options) *Feed {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 64
+	}
+
+	return &Feed{
+		source:      source,
+		opts:        opts,
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Run listens to the source and broadcasts its events until ctx is done or
+// the source fails. Every subscription is closed when Run returns.
+func (f *Feed) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- f.source.Listen(ctx, events)
+	}()
+
+	defer f.closeAll()
+
+	for {
+		select {
+		case event := <-events:
+			f.broadcast(event)
+		case err := <-done:
+			return err
+		}
+	}
+}
+
+// Subscribe registers a subscriber receiving the events accepted by filter.
+func (f *Feed) Subscribe(filter Filter) *Subscription {
+	c := make(chan Event, f.opts.Buffer)
+	s := &Subscription{C: c, c: c, filter: filter, feed: f}
+
+	f.mu.Lock()
+	f.subscribers[s] = struct{}{}
+	f.mu.Unlock()
+
+	return s
+}
+
+// Subscribers returns the number of active subscriptions.
+func (f *Feed) Subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.subscribers)
+}
+
+func (f *Feed) broadcast(event Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for s := range f.subscribers {
+		if s.filter != nil && !s.filter(event) {
+			continue
+		}
+
+		select {
+		case s.c <- event:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+func (f *Feed) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for s := range f.subscribers {
+		delete(f.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Subscription is a subscriber of a Feed. C is closed when the subscription
+// or the feed stops.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	filter  Filter
+	feed    *Feed
+	dropped int64
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+
+	if _, ok := s.feed.subscribers[s]; ok {
+		delete(s.feed.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Dropped returns the number of events lost because the subscriber fell
+// behind.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
@@ -0,0 +1,177 @@
+package changefeed
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// chanSource replays the events sent on its channel.
+type chanSource chan Event
+
+func (s chanSource) Listen(ctx context.Context, events chan<- Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-s:
+			events <- e
+		}
+	}
+}
+
+func startFeed(t *testing.T, opts Options) (*Feed, chanSource) {
+	source := make(chanSource)
+	feed := New(source, opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		feed.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return feed, source
+}
+
+func receive(t *testing.T, sub *Subscription) Event {
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestShouldDeliverEventsMatchingSubscriberFilter(t *testing.T) {
+	feed, source := startFeed(t, Options{})
+
+	all := feed.Subscribe(nil)
+	orders := feed.Subscribe(func(e Event) bool { return e.Table == "orders" })
+
+	source <- Event{Table: "invoices", Op: "insert"}
+	source <- Event{Table: "orders", Op: "update"}
+
+	assert.Equal(t, "invoices", receive(t, all).Table)
+	assert.Equal(t, "orders", receive(t, all).Table)
+	assert.Equal(t, "orders", receive(t, orders).Table)
+}
+
+func TestShouldDropEventsForSlowSubscribers(t *testing.T) {
+	feed, source := startFeed(t, Options{Buffer: 1})
+
+	slow := feed.Subscribe(nil)
+	fast := feed.Subscribe(nil)
+
+	for i := 0; i < 3; i++ {
+		source <- Event{Table: "orders", Op: "insert"}
+		receive(t, fast)
+	}
+
+	assert.Equal(t, int64(2), slow.Dropped())
+	assert.Equal(t, int64(0), fast.Dropped())
+}
+
+func TestShouldCloseSubscriptionsWhenFeedStops(t *testing.T) {
+	source := make(chanSource)
+	feed := New(source, Options{})
+	sub := feed.Subscribe(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, feed.Run(ctx))
+	_, open := <-sub.C
+	assert.False(t, open)
+	assert.Equal(t, 0, feed.Subscribers())
+
+	sub.Close()
+}
+
+func TestShouldFilterOnQueryParameters(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/changes?table=Orders,invoices&op=insert", nil)
+
+	filter, err := QueryFilter(r)
+
+	assert.NoError(t, err)
+	assert.True(t, filter(Event{Table: "orders", Op: "INSERT"}))
+	assert.False(t, filter(Event{Table: "orders", Op: "delete"}))
+	assert.False(t, filter(Event{Table: "users", Op: "insert"}))
+
+	filter, err = QueryFilter(httptest.NewRequest(http.MethodGet, "/changes", nil))
+	assert.NoError(t, err)
+	assert.Nil(t, filter)
+}
+
+func TestShouldStreamEventsAsServerSentEvents(t *testing.T) {
+	feed, source := startFeed(t, Options{})
+
+	server := httptest.NewServer(feed.Handler(nil, 0))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "?table=orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	for feed.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	source <- Event{Table: "users", Op: "insert"}
+	source <- Event{Table: "orders", Op: "update", Data: []byte(`{"id":7}`)}
+
+	reader := bufio.NewReader(res.Body)
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"event: update",
+		`data: {"table":"orders","op":"update","data":{"id":7}}`,
+	}, lines)
+}
+
+func TestShouldRejectRequestsWithInvalidFilters(t *testing.T) {
+	feed := New(make(chanSource), Options{})
+	handler := feed.Handler(func(r *http.Request) (Filter, error) {
+		return nil, assert.AnError
+	}, 0)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/changes", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, 0, feed.Subscribers())
+}
+
+func TestShouldDecodeTriggerNotifications(t *testing.T) {
+	event, err := decodeNotification(`{"table":"orders","op":"delete","data":{"id":1}}`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Event{Table: "orders", Op: "delete", Data: []byte(`{"id":1}`)}, event)
+
+	_, err = decodeNotification("not json")
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/lib/pq"
+)
+
+// TriggerFunction installs changefeed_notify, a trigger function publishing
+// every row change as a JSON event on the channel given as its argument:
+//
+//	CREATE TRIGGER orders_changefeed AFTER INSERT OR UPDATE OR DELETE ON orders
+//	FOR EACH ROW EXECUTE PROCEDURE changefeed_notify('changes');
+//
+// NOTIFY payloads are limited to 8000 bytes, so tables with wide rows should
+// publish their keys only.
+const TriggerFunction = `CREATE OR REPLACE FUNCTION changefeed_notify() RETURNS trigger AS $$
+DECLARE
+	changed record;
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		changed := OLD;
+	ELSE
+		changed := NEW;
+	END IF;
+	PERFORM pg_notify(TG_ARGV[0], json_build_object(
+		'table', TG_TABLE_NAME,
+		'op', lower(TG_OP),
+		'data', row_to_json(changed))::text);
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`
+
+// PQListener is a Source fed by Postgres LISTEN/NOTIFY on Channel, expecting
+// payloads in the format published by TriggerFunction. It reconnects on its
+// own; notifications sent while disconnected are lost.
+type PQListener struct {
+	DSN     string
+	Channel string
+
+	// Reconnect bounds, defaulting to 1s and 1m.
+	MinReconnect time.Duration
+	MaxReconnect time.Duration
+}
+
+// Listen implements Source.
+func (l PQListener) Listen(ctx context.Context, events chan<- Event) error {
+	minReconnect, maxReconnect := l.MinReconnect, l.MaxReconnect
+	if minReconnect <= 0 {
+		minReconnect = time.Second
+	}
+	if maxReconnect <= 0 {
+		maxReconnect = time.Minute
+	}
+
+	listener := pq.NewListener(l.DSN, minReconnect, maxReconnect, nil)
+	defer listener.Close()
+
+	if err := listener.Listen(l.Channel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		case n := <-listener.Notify:
+			// nil is sent after a reconnect
+			if n == nil {
+				continue
+			}
+
+			event, err := decodeNotification(n.Extra)
+			if err != nil {
+				db.Logger().Warn("changefeed: dropping malformed notification", "err", err)
+				continue
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func decodeNotification(payload string) (Event, error) {
+	var event Event
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
@@ -0,0 +1,123 @@
+package changefeed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FilterFunc builds the filter of a subscriber from its request. Returning an
+// error rejects the request with 400 Bad Request.
+type FilterFunc func(r *http.Request) (Filter, error)
+
+// Handler serves the feed as Server-Sent Events. Every request becomes a
+// subscription filtered by filterFor, or by QueryFilter when filterFor is nil;
+// it ends when the client goes away or the feed stops. A comment line is sent
+// every heartbeat to keep proxies from closing idle streams; zero means 15s.
+func (f *Feed) Handler(filterFor FilterFunc, heartbeat time.Duration) http.Handler {
+	if filterFor == nil {
+		filterFor = QueryFilter
+	}
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		filter, err := filterFor(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sub := f.Subscribe(filter)
+		defer sub.Close()
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", sanitizeField(event.Op), data)
+	return err
+}
+
+// sanitizeField keeps a value from breaking out of its SSE field.
+func sanitizeField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// QueryFilter filters on the comma separated "table" and "op" query
+// parameters, e.g. ?table=orders,invoices&op=insert. A missing parameter
+// matches everything.
+func QueryFilter(r *http.Request) (Filter, error) {
+	tables := querySet(r, "table")
+	ops := querySet(r, "op")
+
+	if tables == nil && ops == nil {
+		return nil, nil
+	}
+
+	return func(e Event) bool {
+		return (tables == nil || tables[strings.ToLower(e.Table)]) &&
+			(ops == nil || ops[strings.ToLower(e.Op)])
+	}, nil
+}
+
+func querySet(r *http.Request, name string) map[string]bool {
+	var set map[string]bool
+
+	for _, value := range r.URL.Query()[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			if set == nil {
+				set = map[string]bool{}
+			}
+			set[strings.ToLower(item)] = true
+		}
+	}
+
+	return set
+}
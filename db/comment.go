@@ -0,0 +1,97 @@
+package db
+
+import (
+	"fmt"
+)
+
+// TableInfo describes a table as the database catalog has it.
+type TableInfo struct {
+	Name    string
+	Comment string
+	Columns []ColumnInfo
+}
+
+// ColumnInfo describes a column of a table. Type is the type as Postgres
+// formats it, e.g. "character varying(64)".
+type ColumnInfo struct {
+	Name     string `db:"name"`
+	Type     string `db:"type"`
+	Nullable bool   `db:"nullable"`
+	Comment  string `db:"comment"`
+}
+
+// Column returns the named column of the table.
+func (t TableInfo) Column(name string) (ColumnInfo, bool) {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column, true
+		}
+	}
+	return ColumnInfo{}, false
+}
+
+// DescribeTable reads the columns of table and the comments of the table and
+// its columns, e.g. to check an ownership or PII classification kept in them.
+// table is schema qualified if needed, and matched exactly, as SetTableComment
+// does. Comments are only supported by Postgres.
+func DescribeTable(uow UnitOfWork, table string) (TableInfo, error) {
+	if err := requirePostgresComments(uow); err != nil {
+		return TableInfo{}, err
+	}
+
+	info := TableInfo{Name: table}
+	relation := DialectPostgres.Quote(table)
+
+	if err := uow.Get(&info.Comment, "SELECT COALESCE(obj_description($1::regclass, 'pg_class'), '')", relation); err != nil {
+		return TableInfo{}, fmt.Errorf("db: describing %s: %w", table, err)
+	}
+
+	err := uow.Select(&info.Columns, "SELECT a.attname AS name, format_type(a.atttypid, a.atttypmod) AS type, "+
+		"NOT a.attnotnull AS nullable, COALESCE(col_description(a.attrelid, a.attnum), '') AS comment "+
+		"FROM pg_attribute a WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped "+
+		"ORDER BY a.attnum", relation)
+	if err != nil {
+		return TableInfo{}, fmt.Errorf("db: describing %s: %w", table, err)
+	}
+	return info, nil
+}
+
+// SetTableComment sets the comment of table, replacing the previous one; an
+// empty comment removes it. It runs in the transaction of uow if any, so a
+// migration can comment the tables it creates.
+func SetTableComment(uow UnitOfWork, table, comment string) error {
+	if err := requirePostgresComments(uow); err != nil {
+		return err
+	}
+
+	_, err := uow.Exec(fmt.Sprintf("COMMENT ON TABLE %s IS %s", DialectPostgres.Quote(table), commentLiteral(comment)))
+	return err
+}
+
+// SetColumnComment sets the comment of a column of table like
+// SetTableComment.
+func SetColumnComment(uow UnitOfWork, table, column, comment string) error {
+	if err := requirePostgresComments(uow); err != nil {
+		return err
+	}
+
+	target := DialectPostgres.Quote(table) + "." + DialectPostgres.Quote(column)
+	_, err := uow.Exec(fmt.Sprintf("COMMENT ON COLUMN %s IS %s", target, commentLiteral(comment)))
+	return err
+}
+
+// commentLiteral renders comment as COMMENT ON takes it: a literal, since
+// it does not take parameters, or NULL to remove it.
+func commentLiteral(comment string) string {
+	if comment == "" {
+		return "NULL"
+	}
+	return quoteString(DialectPostgres, comment)
+}
+
+func requirePostgresComments(uow UnitOfWork) error {
+	if dialect := DialectOf(uow); dialect != DialectPostgres {
+		return fmt.Errorf("db: comments require postgres, not %s", dialect)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldDescribeTablesWithTheirComments(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`^SELECT COALESCE\(obj_description\(\$1::regclass, 'pg_class'\), ''\)$`).
+		WithArgs(`"billing"."invoices"`).
+		WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow("owner=payments"))
+	mock.ExpectQuery(`FROM pg_attribute a WHERE a.attrelid = \$1::regclass AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum$`).
+		WithArgs(`"billing"."invoices"`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "type", "nullable", "comment"}).
+			AddRow("id", "bigint", false, "").
+			AddRow("email", "character varying(255)", true, "pii=email"))
+
+	info, err := DescribeTable(NewUnitOfWork(database, nil), "billing.invoices")
+
+	assert.Nil(t, err)
+	assert.Equal(t, TableInfo{Name: "billing.invoices", Comment: "owner=payments", Columns: []ColumnInfo{
+		{Name: "id", Type: "bigint"},
+		{Name: "email", Type: "character varying(255)", Nullable: true, Comment: "pii=email"},
+	}}, info)
+	email, ok := info.Column("email")
+	assert.True(t, ok)
+	assert.Equal(t, "pii=email", email.Comment)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSetAndRemoveComments(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec(`^COMMENT ON TABLE "invoices" IS 'owner=payments; it''s billed monthly'$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^COMMENT ON COLUMN "invoices"."email" IS 'pii=email'$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^COMMENT ON COLUMN "invoices"."email" IS NULL$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	uow := NewUnitOfWork(database, nil)
+
+	assert.Nil(t, SetTableComment(uow, "invoices", "owner=payments; it's billed monthly"))
+	assert.Nil(t, SetColumnComment(uow, "invoices", "email", "pii=email"))
+	assert.Nil(t, SetColumnComment(uow, "invoices", "email", ""))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequirePostgresForComments(t *testing.T) {
+	database, _ := newMockDatabase(t, "mysql")
+
+	err := SetTableComment(NewUnitOfWork(database, nil), "invoices", "owner=payments")
+
+	assert.EqualError(t, err, "db: comments require postgres, not mysql")
+}
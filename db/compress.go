@@ -0,0 +1,292 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressionMagic starts every compressed value. It is followed by the
+// format version, the codec ID, the CRC-32 of the codec ID and the encoded
+// value, then the encoded value itself. Values written before compression
+// was enabled are returned as is: a legacy value is only taken for a
+// compressed one if it starts with the magic and version and also carries
+// the checksum of its own remainder, which values not written by compress
+// do not.
+var compressionMagic = []byte{0x00, 0xc5, 0x5a}
+
+const (
+	compressionVersion = 2
+	compressionHeader  = 9 // magic, version, codec ID, CRC-32
+)
+
+// Codec compresses column values. IDs are stored in every value, so a codec
+// must keep its ID forever and stay registered as long as rows use it.
+type Codec interface {
+	ID() byte
+	Encode(src []byte) ([]byte, error)
+	Decode(src []byte) ([]byte, error)
+}
+
+var compressionCRC = crc32.MakeTable(crc32.Castagnoli)
+
+type gzipCodec struct{}
+
+// GzipCodec compresses with gzip at the default level. Its ID is 1.
+var GzipCodec Codec = gzipCodec{}
+
+func (gzipCodec) ID() byte {
+	return 1
+}
+
+func (gzipCodec) Encode(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) Decode(src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type zstdCodec struct{}
+
+// ZstdCodec compresses with zstd at the default level. Its ID is 2.
+var ZstdCodec Codec = zstdCodec{}
+
+var zstdCoder struct {
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	err     error
+}
+
+func zstdCoders() (*zstd.Encoder, *zstd.Decoder, error) {
+	c := &zstdCoder
+	c.once.Do(func() {
+		if c.encoder, c.err = zstd.NewWriter(nil); c.err != nil {
+			return
+		}
+		c.decoder, c.err = zstd.NewReader(nil)
+	})
+	return c.encoder, c.decoder, c.err
+}
+
+func (zstdCodec) ID() byte {
+	return 2
+}
+
+func (zstdCodec) Encode(src []byte) ([]byte, error) {
+	encoder, _, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeAll(src, nil), nil
+}
+
+func (zstdCodec) Decode(src []byte) ([]byte, error) {
+	_, decoder, err := zstdCoders()
+	if err != nil {
+		return nil, err
+	}
+	return decoder.DecodeAll(src, nil)
+}
+
+var compression = struct {
+	sync.RWMutex
+	codecs  map[byte]Codec
+	names   map[string]Codec
+	writer  Codec
+	minSize int
+}{
+	codecs:  map[byte]Codec{1: GzipCodec, 2: ZstdCodec},
+	names:   map[string]Codec{"gzip": GzipCodec, "zstd": ZstdCodec},
+	writer:  GzipCodec,
+	minSize: 512,
+}
+
+// RegisterCodec registers codec under name, for values it wrote to stay
+// readable and for columns to select it with the compress option of their
+// tag, e.g. `db:"payload,compress=zstd"`. gzip and zstd are registered. Names
+// must be registered before the models using them, during program
+// initialization.
+func RegisterCodec(name string, codec Codec) {
+	compression.Lock()
+	defer compression.Unlock()
+
+	compression.codecs[codec.ID()] = codec
+	compression.names[name] = codec
+}
+
+// codecNamed returns the codec registered under name.
+func codecNamed(name string) (Codec, bool) {
+	compression.RLock()
+	defer compression.RUnlock()
+
+	codec, ok := compression.names[name]
+	return codec, ok
+}
+
+// SetCompression registers codec and makes it the one used to write values of
+// at least minSize bytes; smaller values are stored uncompressed. Values
+// written by previously registered codecs stay readable. The default is gzip
+// from 512 bytes. It is meant to be called during program initialization.
+// Columns tagged with the compress option are written with their own codec.
+func SetCompression(codec Codec, minSize int) {
+	compression.Lock()
+	defer compression.Unlock()
+
+	compression.codecs[codec.ID()] = codec
+	compression.writer = codec
+	compression.minSize = minSize
+}
+
+// CompressedBytes is a []byte column compressed on write and decompressed on
+// scan. The column must be binary (bytea, BLOB). Values written before the
+// column was compressed are scanned unchanged, so existing rows need no
+// migration. A nil value is NULL.
+//
+// Fields of registered models choose their codec with the compress option,
+// e.g. `db:"payload,compress=zstd"`, naming a codec registered with
+// RegisterCodec; Repository writes them with it. Other writes use the codec
+// set with SetCompression. Every codec registered can be read.
+type CompressedBytes []byte
+
+// Value implements driver.Valuer.
+func (c CompressedBytes) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return compress(c)
+}
+
+// Scan implements sql.Scanner.
+func (c *CompressedBytes) Scan(value interface{}) error {
+	data, err := decompress(value)
+	*c = data
+	return err
+}
+
+// CompressedString is a string column compressed like CompressedBytes.
+type CompressedString string
+
+// Value implements driver.Valuer.
+func (c CompressedString) Value() (driver.Value, error) {
+	return compress([]byte(c))
+}
+
+// Scan implements sql.Scanner. NULL scans as "".
+func (c *CompressedString) Scan(value interface{}) error {
+	data, err := decompress(value)
+	*c = CompressedString(data)
+	return err
+}
+
+func compress(data []byte) ([]byte, error) {
+	return compressWith(nil, data)
+}
+
+// compressWith compresses data with codec, or with the codec set with
+// SetCompression when codec is nil.
+func compressWith(codec Codec, data []byte) ([]byte, error) {
+	compression.RLock()
+	if codec == nil {
+		codec = compression.writer
+	}
+	minSize := compression.minSize
+	compression.RUnlock()
+
+	if len(data) < minSize {
+		return data, nil
+	}
+
+	encoded, err := codec.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, compressionHeader, compressionHeader+len(encoded))
+	copy(out, compressionMagic)
+	out[3], out[4] = compressionVersion, codec.ID()
+	out = append(out, encoded...)
+	binary.BigEndian.PutUint32(out[5:compressionHeader], frameChecksum(out))
+	return out, nil
+}
+
+// frameChecksum returns the checksum of the codec ID and encoded value of
+// data, a compressed value.
+func frameChecksum(data []byte) uint32 {
+	sum := crc32.Checksum(data[4:5], compressionCRC)
+	return crc32.Update(sum, compressionCRC, data[compressionHeader:])
+}
+
+// compressed reports whether data was written by compress.
+func compressed(data []byte) bool {
+	return len(data) >= compressionHeader &&
+		bytes.HasPrefix(data, compressionMagic) && data[3] == compressionVersion &&
+		binary.BigEndian.Uint32(data[5:compressionHeader]) == frameChecksum(data)
+}
+
+// compressedValue is the argument a tagged column of a model is written
+// with, compressed with the codec of the tag.
+type compressedValue struct {
+	data  []byte
+	codec Codec
+}
+
+// Value implements driver.Valuer.
+func (v compressedValue) Value() (driver.Value, error) {
+	if v.data == nil {
+		return nil, nil
+	}
+	return compressWith(v.codec, v.data)
+}
+
+func decompress(value interface{}) ([]byte, error) {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("db: cannot scan %T into a compressed column", value)
+	}
+
+	if !compressed(data) {
+		// drivers may reuse the buffer once Scan returns
+		return append([]byte(nil), data...), nil
+	}
+
+	id := data[4]
+
+	compression.RLock()
+	codec, ok := compression.codecs[id]
+	compression.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("db: no compression codec registered with ID %d", id)
+	}
+
+	return codec.Decode(data[compressionHeader:])
+}
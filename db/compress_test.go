@@ -0,0 +1,173 @@
+package db
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCompressLargeValuesOnly(t *testing.T) {
+	large := CompressedString(strings.Repeat("audit payload ", 100))
+
+	value, err := large.Value()
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(value.([]byte), append(append([]byte{}, compressionMagic...), compressionVersion, 1)))
+	assert.True(t, len(value.([]byte)) < len(large))
+
+	value, err = CompressedString("small").Value()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("small"), value)
+
+	value, err = CompressedBytes(nil).Value()
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+}
+
+func TestShouldRoundTripCompressedValues(t *testing.T) {
+	original := CompressedBytes(bytes.Repeat([]byte{1, 2, 3, 4}, 1000))
+	value, _ := original.Value()
+
+	var scanned CompressedBytes
+	assert.Nil(t, scanned.Scan(value))
+	assert.Equal(t, original, scanned)
+}
+
+func TestShouldScanUncompressedLegacyValues(t *testing.T) {
+	var s CompressedString
+	assert.Nil(t, s.Scan("written before compression"))
+	assert.Equal(t, CompressedString("written before compression"), s)
+
+	var b CompressedBytes
+	assert.Nil(t, b.Scan(nil))
+	assert.Nil(t, b)
+}
+
+// frame returns payload framed as compress writes it for the codec id.
+func frame(id byte, payload ...byte) []byte {
+	data := append(append([]byte{}, compressionMagic...), compressionVersion, id, 0, 0, 0, 0)
+	data = append(data, payload...)
+	binary.BigEndian.PutUint32(data[5:compressionHeader], frameChecksum(data))
+	return data
+}
+
+func TestShouldRejectUnknownCodec(t *testing.T) {
+	var b CompressedBytes
+	err := b.Scan(frame(99, 1, 2))
+
+	assert.EqualError(t, err, "db: no compression codec registered with ID 99")
+}
+
+func TestShouldScanLegacyValuesThatLookCompressed(t *testing.T) {
+	legacy := append(append([]byte{}, compressionMagic...), compressionVersion, 1, 'n', 'o', 't', ' ', 'g', 'z', 'i', 'p')
+
+	var b CompressedBytes
+	assert.Nil(t, b.Scan(legacy))
+	assert.Equal(t, CompressedBytes(legacy), b)
+}
+
+func TestShouldRoundTripZstdValues(t *testing.T) {
+	SetCompression(ZstdCodec, 16)
+	defer SetCompression(GzipCodec, 512)
+
+	original := CompressedString(strings.Repeat("ledger entry ", 100))
+	value, err := original.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, byte(2), value.([]byte)[4])
+
+	var scanned CompressedString
+	assert.Nil(t, scanned.Scan(value))
+	assert.Equal(t, original, scanned)
+}
+
+type reverseCodec struct{}
+
+func (reverseCodec) ID() byte { return 42 }
+
+func (reverseCodec) Encode(src []byte) ([]byte, error) {
+	out := make([]byte, len(src))
+	for i, c := range src {
+		out[len(src)-1-i] = c
+	}
+	return out, nil
+}
+
+func (r reverseCodec) Decode(src []byte) ([]byte, error) {
+	return r.Encode(src)
+}
+
+func TestShouldKeepReadingOldCodecsAfterSwitching(t *testing.T) {
+	gzipped, _ := CompressedString(strings.Repeat("x", 1000)).Value()
+
+	SetCompression(reverseCodec{}, 4)
+	defer SetCompression(GzipCodec, 512)
+
+	reversed, _ := CompressedString("abcdef").Value()
+	assert.Equal(t, frame(42, 'f', 'e', 'd', 'c', 'b', 'a'), reversed)
+
+	var s CompressedString
+	assert.Nil(t, s.Scan(gzipped))
+	assert.Equal(t, CompressedString(strings.Repeat("x", 1000)), s)
+	assert.Nil(t, s.Scan(reversed))
+	assert.Equal(t, CompressedString("abcdef"), s)
+}
+
+type compressedArg struct{ codec byte }
+
+func (a compressedArg) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	return ok && compressed(b) && (a.codec == 0 || b[4] == a.codec)
+}
+
+func TestShouldCompressThroughNamedQueries(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	payload := strings.Repeat("event ", 200)
+
+	mock.ExpectExec("INSERT INTO audit").
+		WithArgs(compressedArg{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	uw.MustNamedExec("INSERT INTO audit (payload) VALUES (:payload)", map[string]interface{}{
+		"payload": CompressedString(payload),
+	})
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+type compressedDocument struct {
+	ID   int64            `db:"id"`
+	Body CompressedString `db:"body,compress=zstd"`
+}
+
+func TestShouldWriteTaggedColumnsWithTheirCodec(t *testing.T) {
+	MustRegister(compressedDocument{}, "compressed_documents")
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectExec("^INSERT INTO compressed_documents").
+		WithArgs(int64(1), compressedArg{codec: 2}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	repository, err := NewRepository[compressedDocument]()
+	assert.Nil(t, err)
+	assert.Nil(t, repository.Insert(uw, &compressedDocument{ID: 1, Body: CompressedString(strings.Repeat("clause ", 200))}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectCompressOptionsItCannotHonour(t *testing.T) {
+	type unknownCodec struct {
+		ID   int64            `db:"id"`
+		Body CompressedString `db:"body,compress=brotli"`
+	}
+	type plainColumn struct {
+		ID   int64  `db:"id"`
+		Body string `db:"body,compress=zstd"`
+	}
+
+	_, err := Register(unknownCodec{}, "unknown_codec")
+	assert.EqualError(t, err, `db: column body of db.unknownCodec is compressed with "brotli", no such codec is registered`)
+	_, err = Register(plainColumn{}, "plain_column")
+	assert.EqualError(t, err, "db: compressed column body of db.plainColumn must be a CompressedBytes or CompressedString")
+}
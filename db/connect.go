@@ -0,0 +1,102 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PoolConfig tunes the connection pool of a Database. Zero fields keep the
+// database/sql defaults.
+type PoolConfig struct {
+	// MaxOpenConns bounds the connections open at once. Zero means no bound.
+	MaxOpenConns int
+
+	// MaxIdleConns is the number of idle connections kept. Zero means 2,
+	// negative none.
+	MaxIdleConns int
+
+	// ConnMaxLifetime closes connections once this old. Zero means never.
+	ConnMaxLifetime time.Duration
+
+	// ConnMaxIdleTime closes connections idle for this long. Zero means
+	// never.
+	ConnMaxIdleTime time.Duration
+}
+
+// Config configures Open and Connect.
+type Config struct {
+	Driver string
+	DSN    string
+
+	Pool PoolConfig
+
+	// Options are applied to every unit of work of the database.
+	Options []Option
+}
+
+// Database owns a connection pool and hands out the units of work over it.
+type Database struct {
+	db   *sqlx.DB
+	opts []Option
+}
+
+// Open opens the database of config without connecting to it; see Connect.
+func Open(config Config) (*Database, error) {
+	db, err := sqlx.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return newDatabase(db, config), nil
+}
+
+// Connect opens the database of config and checks it is reachable with ctx.
+func Connect(ctx context.Context, config Config) (*Database, error) {
+	db, err := sqlx.ConnectContext(ctx, config.Driver, config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return newDatabase(db, config), nil
+}
+
+func newDatabase(db *sqlx.DB, config Config) *Database {
+	d := &Database{db: db, opts: config.Options}
+	d.SetPool(config.Pool)
+	return d
+}
+
+// SetPool applies config to the pool, e.g. after a configuration reload.
+func (d *Database) SetPool(config PoolConfig) {
+	d.db.SetMaxOpenConns(config.MaxOpenConns)
+	if config.MaxIdleConns != 0 {
+		d.db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	d.db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	d.db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+}
+
+// UnitOfWork returns a unit of work over the database with the options of
+// its Config followed by opts.
+func (d *Database) UnitOfWork(opts ...Option) UnitOfWork {
+	all := append(append([]Option(nil), d.opts...), opts...)
+	return NewUnitOfWork(d.db, nil, all...)
+}
+
+// DB returns the pool, for the helpers taking a *sqlx.DB.
+func (d *Database) DB() *sqlx.DB {
+	return d.db
+}
+
+// Stats returns the statistics of the pool. A WaitCount growing between two
+// calls, or InUse reaching MaxOpenConnections, tells the pool is exhausted
+// and requests queue for connections.
+func (d *Database) Stats() sql.DBStats {
+	return d.db.Stats()
+}
+
+// Close closes the pool.
+func (d *Database) Close() error {
+	return d.db.Close()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldConnectWithPoolSettings(t *testing.T) {
+	conn, mock, err := sqlmock.NewWithDSN("connect_test_pool", sqlmock.MonitorPingsOption(true))
+	assert.Nil(t, err)
+	defer conn.Close()
+	mock.ExpectPing()
+	mock.ExpectQuery(`^SELECT 1$`).WillReturnRows(sqlmock.NewRows([]string{"one"}).AddRow(1))
+
+	database, err := Connect(context.Background(), Config{
+		Driver: "sqlmock",
+		DSN:    "connect_test_pool",
+		Pool:   PoolConfig{MaxOpenConns: 5, MaxIdleConns: 1, ConnMaxLifetime: time.Hour},
+	})
+	assert.Nil(t, err)
+	defer database.Close()
+
+	var one int
+	assert.Nil(t, database.UnitOfWork().Get(&one, "SELECT 1"))
+	assert.Equal(t, 1, one)
+	assert.Equal(t, 5, database.Stats().MaxOpenConnections)
+	assert.LessOrEqual(t, database.Stats().Idle, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldFailToConnectToUnreachableDatabases(t *testing.T) {
+	conn, mock, err := sqlmock.NewWithDSN("connect_test_down", sqlmock.MonitorPingsOption(true))
+	assert.Nil(t, err)
+	defer conn.Close()
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	_, err = Connect(context.Background(), Config{Driver: "sqlmock", DSN: "connect_test_down"})
+	assert.EqualError(t, err, "connection refused")
+
+	_, err = Open(Config{Driver: "nodriver"})
+	assert.EqualError(t, err, `sql: unknown driver "nodriver" (forgotten import?)`)
+}
+
+func TestShouldApplyDatabaseOptionsToEveryUnitOfWork(t *testing.T) {
+	conn, mock, err := sqlmock.NewWithDSN("connect_test_options")
+	assert.Nil(t, err)
+	defer conn.Close()
+	mock.ExpectExec(`^DELETE FROM sessions$`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var seen []string
+	database, err := Open(Config{Driver: "sqlmock", DSN: "connect_test_options", Options: []Option{
+		WithInterceptors(func(ctx context.Context, stmt *Statement, next Handler) error {
+			seen = append(seen, stmt.Query)
+			return next(ctx, stmt)
+		}),
+	}})
+	assert.Nil(t, err)
+
+	_, err = database.UnitOfWork().Exec("DELETE FROM sessions")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"DELETE FROM sessions"}, seen)
+}
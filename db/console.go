@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ConsoleOptions configures a Console.
+type ConsoleOptions struct {
+	// DryRun executes the script and reports its results, then always rolls
+	// the transaction back.
+	DryRun bool
+
+	// Confirm, when set, sees the report of a successful run before commit
+	// and may veto it by returning false.
+	Confirm func(ctx context.Context, report *Report) bool
+
+	// MaxRows caps the rows captured per statement. Zero means 100.
+	MaxRows int
+
+	// Options configure the transaction scripts run in; WithAudit, for
+	// instance, records who changed what from the console.
+	Options []Option
+}
+
+// Console runs ad-hoc multi-statement scripts in a single transaction on
+// behalf of admin tools, reporting the outcome of every statement.
+type Console struct {
+	db   *sqlx.DB
+	opts ConsoleOptions
+}
+
+// Report is the outcome of a script run.
+type Report struct {
+	Statements []StatementReport
+	Committed  bool
+	DryRun     bool
+	Err        error
+}
+
+// StatementReport is the outcome of one statement of a script.
+type StatementReport struct {
+	SQL          string
+	Columns      []string
+	Rows         [][]interface{}
+	Truncated    bool
+	RowsAffected int64
+	Duration     time.Duration
+	Err          error
+}
+
+// NewConsole creates a console over db.
+func NewConsole(db *sqlx.DB, opts ConsoleOptions) *Console {
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = 100
+	}
+
+	return &Console{db: db, opts: opts}
+}
+
+// Exec splits script into statements and runs them in order inside one
+// transaction, stopping at the first failure. The transaction commits only
+// when every statement succeeded, the run is not a dry run and Confirm, if
+// any, approves.
+func (c *Console) Exec(ctx context.Context, script string) Report {
+	report := Report{DryRun: c.opts.DryRun}
+
+	u := &unitOfWork{db: c.db, ctx: ctx}
+	u.apply(c.opts.Options)
+
+	_, err := u.InTransaction(func(UnitOfWork) (interface{}, error) {
+		report.Statements, report.Err = nil, nil
+		for _, statement := range SplitStatements(DialectFor(c.db.DriverName()), script) {
+			result := c.run(u.context(), u, statement)
+			report.Statements = append(report.Statements, result)
+
+			if result.Err != nil {
+				report.Err = result.Err
+				return nil, result.Err
+			}
+		}
+
+		if c.opts.DryRun || (c.opts.Confirm != nil && !c.opts.Confirm(ctx, &report)) {
+			return nil, errDiscarded
+		}
+		return nil, nil
+	})
+
+	switch {
+	case err == nil:
+		report.Committed = true
+	case err != errDiscarded:
+		report.Err = err
+	}
+	return report
+}
+
+// errDiscarded rolls back the transaction of a dry run or of a run Confirm
+// vetoed.
+var errDiscarded = errors.New("db: script discarded")
+
+func (c *Console) run(ctx context.Context, u *unitOfWork, statement string) (result StatementReport) {
+	result.SQL = statement
+	started := time.Now()
+	defer func() {
+		result.Duration = time.Since(started)
+	}()
+
+	if !returnsRows(lexSQL(statement)) {
+		res, err := u.exec(ctx, statement)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.RowsAffected, result.Err = res.RowsAffected()
+		return result
+	}
+
+	rows, err := u.query(ctx, statement)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer rows.Close()
+
+	if result.Columns, err = rows.Columns(); err != nil {
+		result.Err = err
+		return result
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == c.opts.MaxRows {
+			result.Truncated = true
+			continue
+		}
+
+		values, err := rows.SliceScan()
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Rows = append(result.Rows, values)
+		result.RowsAffected++
+	}
+
+	result.Err = rows.Err()
+	return result
+}
+
+// returnsRows guesses whether a statement produces a result set.
+func returnsRows(tokens []sqlToken) bool {
+	switch statementVerb(tokens) {
+	case "SELECT", "SHOW", "EXPLAIN", "VALUES", "TABLE", "DESCRIBE", "PRAGMA":
+		return true
+	}
+
+	for _, t := range tokens {
+		if t.is("returning") {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitStatements splits a script on top-level semicolons, leaving semicolons
+// inside strings, quoted identifiers, dollar-quoted bodies and comments alone.
+// Empty statements are dropped.
+func SplitStatements(dialect Dialect, script string) []string {
+	var statements []string
+	for _, s := range scriptStatements(dialect, script) {
+		statements = append(statements, s.sql)
+	}
+	return statements
+}
+
+type scriptStatement struct {
+	sql string
+
+	// offset is where the first token of sql is in the script.
+	offset int
+}
+
+func scriptStatements(dialect Dialect, script string) []scriptStatement {
+	var statements []scriptStatement
+	start := 0
+
+	add := func(end int) {
+		raw := script[start:end]
+		if tokens := lexSQLFor(dialect, raw); len(tokens) > 0 {
+			statements = append(statements, scriptStatement{sql: strings.TrimSpace(raw), offset: start + tokens[0].start})
+		}
+	}
+
+	for _, t := range lexSQLFor(dialect, script) {
+		if t.kind == sqlPunct && t.text == ";" {
+			add(t.start)
+			start = t.end
+		}
+	}
+	add(len(script))
+
+	return statements
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockDB(t *testing.T, driver string) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sqlx.NewDb(conn, driver), mock
+}
+
+func TestShouldSplitScriptsOnTopLevelSemicolons(t *testing.T) {
+	statements := SplitStatements(DialectPostgres, `
+		CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;
+		INSERT INTO t VALUES ('a;b'); -- comment; here
+		;
+	`)
+
+	assert.Equal(t, []string{
+		"CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql",
+		"INSERT INTO t VALUES ('a;b')",
+	}, statements)
+}
+
+func TestShouldRunScriptAndCommit(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders SET status = 'paid'").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectCommit()
+
+	report := NewConsole(db, ConsoleOptions{}).Exec(context.Background(),
+		"UPDATE orders SET status = 'paid'; SELECT count(*) FROM orders")
+
+	assert.Nil(t, report.Err)
+	assert.True(t, report.Committed)
+	assert.Equal(t, int64(3), report.Statements[0].RowsAffected)
+	assert.Equal(t, []string{"count"}, report.Statements[1].Columns)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollbackDryRunsAndRejectedScripts(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM orders").WillReturnResult(sqlmock.NewResult(0, 9))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM orders").WillReturnResult(sqlmock.NewResult(0, 9))
+	mock.ExpectRollback()
+
+	report := NewConsole(db, ConsoleOptions{DryRun: true}).Exec(context.Background(), "DELETE FROM orders")
+	assert.False(t, report.Committed)
+	assert.Equal(t, int64(9), report.Statements[0].RowsAffected)
+
+	confirm := func(ctx context.Context, r *Report) bool { return r.Statements[0].RowsAffected < 5 }
+	report = NewConsole(db, ConsoleOptions{Confirm: confirm}).Exec(context.Background(), "DELETE FROM orders")
+	assert.False(t, report.Committed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldStopAtFirstFailingStatement(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE a").WillReturnError(errors.New("boom"))
+	mock.ExpectRollback()
+
+	report := NewConsole(db, ConsoleOptions{}).Exec(context.Background(), "UPDATE a SET x = 1; UPDATE b SET x = 1")
+
+	assert.EqualError(t, report.Err, "boom")
+	assert.Len(t, report.Statements, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldEndScriptsThroughTheUnitOfWork(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	report := NewConsole(db, ConsoleOptions{Options: []Option{WithHooks(vetoHook{})}}).Exec(context.Background(),
+		"UPDATE orders SET status = 'paid'")
+
+	assert.Equal(t, assert.AnError, report.Err)
+	assert.False(t, report.Committed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
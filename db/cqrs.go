@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrReadOnly is returned by a Reader for statements that would write.
+var ErrReadOnly = errors.New("db: reader cannot write")
+
+// Reader is the read side of a UnitOfWork. Query handlers accepting a Reader
+// cannot write, transact or commit; statements not known to only read, such
+// as DELETE ... RETURNING through Query or a CALL, fail with ErrReadOnly.
+type Reader interface {
+	Query(query string, args ...interface{}) (*sqlx.Rows, error)
+
+	Select(dest interface{}, query string, args ...interface{}) error
+
+	Get(dest interface{}, query string, args ...interface{}) error
+
+	NamedQuery(query string, arg interface{}) (*sqlx.Rows, error)
+
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+
+	NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error)
+
+	DriverName() string
+
+	Rebind(query string) string
+}
+
+// Writer is the write side, the whole of a UnitOfWork, for command handlers.
+type Writer interface {
+	UnitOfWork
+}
+
+// NewReader creates a Reader over db.
+func NewReader(db *sqlx.DB, opts ...Option) Reader {
+	return AsReader(NewUnitOfWork(db, nil, opts...))
+}
+
+// NewWriter creates a Writer over db, in tx when not nil.
+func NewWriter(db *sqlx.DB, tx *sqlx.Tx, opts ...Option) Writer {
+	return NewUnitOfWork(db, tx, opts...)
+}
+
+// AsReader narrows uow to a Reader, reading in its transaction if any, e.g.
+// to hand a query handler the unit of work of the command being run.
+func AsReader(uow UnitOfWork) Reader {
+	return reader{uow}
+}
+
+// reader delegates to a UnitOfWork it keeps out of reach of type
+// assertions.
+type reader struct {
+	uow UnitOfWork
+}
+
+// check refuses every statement of query not known to only read, the way
+// maintenance mode does: CALL, DO, COPY, SELECT ... INTO and verbs the lexer
+// cannot classify included.
+func (r reader) check(query string) error {
+	driver := r.uow.DriverName()
+	for _, tokens := range splitTokens(lexSQLFor(DialectFor(driver), query)) {
+		info := Inspect(driver, query[tokens[0].start:tokens[len(tokens)-1].end])
+		if len(info.Operations) > 0 {
+			return fmt.Errorf("%w: %s", ErrReadOnly, strings.Join(info.Operations, ", "))
+		}
+		if !readsOnly(tokens) {
+			return fmt.Errorf("%w: %s", ErrReadOnly, info.Verb)
+		}
+	}
+	return nil
+}
+
+func (r reader) Query(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return r.QueryContext(contextOf(r.uow), query, args...)
+}
+
+func (r reader) Select(dest interface{}, query string, args ...interface{}) error {
+	return r.SelectContext(contextOf(r.uow), dest, query, args...)
+}
+
+func (r reader) Get(dest interface{}, query string, args ...interface{}) error {
+	return r.GetContext(contextOf(r.uow), dest, query, args...)
+}
+
+func (r reader) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
+	return r.NamedQueryContext(contextOf(r.uow), query, arg)
+}
+
+func (r reader) QueryContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	if err := r.check(query); err != nil {
+		return nil, err
+	}
+	return r.uow.QueryContext(ctx, query, args...)
+}
+
+func (r reader) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if err := r.check(query); err != nil {
+		return err
+	}
+	return r.uow.SelectContext(ctx, dest, query, args...)
+}
+
+func (r reader) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	if err := r.check(query); err != nil {
+		return err
+	}
+	return r.uow.GetContext(ctx, dest, query, args...)
+}
+
+func (r reader) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	if err := r.check(query); err != nil {
+		return nil, err
+	}
+	return r.uow.NamedQueryContext(ctx, query, arg)
+}
+
+func (r reader) DriverName() string {
+	return r.uow.DriverName()
+}
+
+func (r reader) Rebind(query string) string {
+	return r.uow.Rebind(query)
+}
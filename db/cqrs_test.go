@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldReadThroughReader(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectQuery("^SELECT id FROM orders WHERE status = \\?$").
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	var ids []int64
+	err := NewReader(database).Select(&ids, "SELECT id FROM orders WHERE status = ?", "open")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseWritesThroughReader(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+
+	r := NewReader(database)
+	_, err := r.Query("DELETE FROM orders WHERE id = $1 RETURNING id", 1)
+	assert.True(t, errors.Is(err, ErrReadOnly))
+
+	var id int64
+	err = r.Get(&id, "WITH moved AS (UPDATE orders SET status = 'x' RETURNING id) SELECT count(*) FROM moved")
+	assert.EqualError(t, err, "db: reader cannot write: UPDATE")
+
+	_, isUnitOfWork := r.(UnitOfWork)
+	assert.False(t, isUnitOfWork)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseStatementsNotKnownToReadThroughReader(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	r := NewReader(database)
+
+	for _, query := range []string{
+		"CALL archive_orders()",
+		"DO $$ BEGIN DELETE FROM orders; END $$",
+		"SELECT * INTO orders_copy FROM orders",
+		"COPY orders TO '/tmp/orders.csv'",
+		"EXPLAIN ANALYZE DELETE FROM orders",
+		"SELECT 1; VACUUM orders",
+		"LISTEN orders",
+	} {
+		_, err := r.Query(query)
+		assert.True(t, errors.Is(err, ErrReadOnly), query)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReadInTheTransactionOfTheWriter(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO orders").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("^SELECT count\\(\\*\\) FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectCommit()
+
+	var writer Writer = NewWriter(database, nil)
+	_, err := writer.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("INSERT INTO orders (id) VALUES (1)")
+		var count int64
+		return nil, AsReader(tx).Get(&count, "SELECT count(*) FROM orders")
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
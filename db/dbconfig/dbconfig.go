@@ -0,0 +1,398 @@
+// Package dbconfig keeps the databases of a service in line with a JSON
+// configuration file: replica sets, pool sizes and statement timeouts are
+// applied at runtime when the file changes, so that topology changes do not
+// need a restart. Replicas can be discovered from DNS instead, see
+// Topology.Discover.
+//
+//	{
+//		"driver": "postgres",
+//		"primary": "postgres://primary/app",
+//		"replicas": ["postgres://replica-1/app", "postgres://replica-2/app"],
+//		"pool": {"max_open_conns": 40, "max_idle_conns": 10, "conn_max_lifetime": "30m"},
+//		"timeouts": {"default": "5s", "labels": {"report": "1m"}}
+//	}
+package dbconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// Config is the content of a configuration file.
+type Config struct {
+	Driver   string   `json:"driver"`
+	Primary  string   `json:"primary"`
+	Replicas []string `json:"replicas,omitempty"`
+	Pool     Pool     `json:"pool"`
+	Timeouts Timeouts `json:"timeouts"`
+}
+
+// Pool sets the sql.DB pool limits of the primary and of every replica. Zero
+// values are the database/sql defaults: no limit on open connections and
+// their lifetime, 2 idle connections; a negative MaxIdleConns keeps none.
+type Pool struct {
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+}
+
+// Timeouts are the statement timeouts of db.TimeoutConfig.
+type Timeouts struct {
+	Default      Duration            `json:"default"`
+	Labels       map[string]Duration `json:"labels,omitempty"`
+	Fingerprints map[string]Duration `json:"fingerprints,omitempty"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string, or a number of nanoseconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("duration %s is neither a string nor a number", data)
+		}
+		*d = Duration(n)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Parse decodes and checks a configuration.
+func Parse(data []byte) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("dbconfig: %w", err)
+	}
+	if config.Driver == "" || config.Primary == "" {
+		return config, errors.New("dbconfig: driver and primary are required")
+	}
+	return config, nil
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(data)
+}
+
+// Options configures a Topology.
+type Options struct {
+	// Balancer picks the replica of reads. Nil means db.RoundRobin().
+	Balancer db.ReplicaBalancer
+
+	// Drain is how long a removed endpoint stays open for the unit of works
+	// created before the change; it is closed afterwards, which waits for the
+	// statements still running. Zero means 30 seconds.
+	Drain time.Duration
+
+	// OnReload is called after every reload of a watched file, with the
+	// error that made the topology keep its previous configuration, if any.
+	OnReload func(Config, error)
+
+	// Open opens endpoints. Nil means sqlx.Open.
+	Open func(driver, dsn string) (*sqlx.DB, error)
+}
+
+// Topology holds the databases of a configuration and hands out unit of
+// works over the current ones. It is safe for concurrent use.
+type Topology struct {
+	opts    Options
+	current atomic.Pointer[snapshot]
+
+	mu        sync.Mutex
+	config    Config
+	endpoints map[string]*sqlx.DB
+	draining  map[*sqlx.DB]*time.Timer
+	closed    bool
+
+	// discovered replaces the replicas of config while discovering.
+	discovering bool
+	discovered  []string
+}
+
+// snapshot is what unit of works are created from; it is replaced as a whole
+// on every change.
+type snapshot struct {
+	primary  *sqlx.DB
+	replicas []*sqlx.DB
+	timeouts db.Interceptor
+}
+
+// New opens the endpoints of config. They are pinged, so that a
+// configuration with an unreachable endpoint is refused.
+func New(ctx context.Context, config Config, opts Options) (*Topology, error) {
+	if opts.Balancer == nil {
+		opts.Balancer = db.RoundRobin()
+	}
+	if opts.Drain <= 0 {
+		opts.Drain = 30 * time.Second
+	}
+	if opts.Open == nil {
+		opts.Open = sqlx.Open
+	}
+
+	t := &Topology{opts: opts, endpoints: map[string]*sqlx.DB{}, draining: map[*sqlx.DB]*time.Timer{}}
+	if err := t.Apply(ctx, config); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Apply switches the topology to config: endpoints it adds are opened and
+// pinged, the pool limits are set on every endpoint, and endpoints it
+// removes are drained. Unit of works created afterwards use the new
+// endpoints; statements of every unit of work use the new timeouts. When
+// an endpoint cannot be opened nothing changes. The driver cannot change.
+// While Discover runs, the replicas it finds replace those of config.
+func (t *Topology) Apply(ctx context.Context, config Config) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.apply(ctx, config)
+}
+
+func (t *Topology) apply(ctx context.Context, config Config) error {
+	if t.closed {
+		return errors.New("dbconfig: topology is closed")
+	}
+	if t.config.Driver != "" && config.Driver != t.config.Driver {
+		return fmt.Errorf("dbconfig: cannot change driver from %s to %s", t.config.Driver, config.Driver)
+	}
+
+	endpoints := map[string]*sqlx.DB{}
+	var opened []*sqlx.DB
+	open := func(dsn string) (*sqlx.DB, error) {
+		if database, ok := endpoints[dsn]; ok {
+			return database, nil
+		}
+		database, ok := t.endpoints[dsn]
+		if !ok {
+			var err error
+			if database, err = t.opts.Open(config.Driver, dsn); err != nil {
+				return nil, err
+			}
+			opened = append(opened, database)
+			if err := database.PingContext(ctx); err != nil {
+				return nil, err
+			}
+		}
+		endpoints[dsn] = database
+		return database, nil
+	}
+
+	next := &snapshot{timeouts: db.TimeoutInterceptor(config.Timeouts.config())}
+	var err error
+	if next.primary, err = open(config.Primary); err == nil {
+		replicas := config.Replicas
+		if t.discovering {
+			replicas = t.discovered
+		}
+		for _, dsn := range replicas {
+			var replica *sqlx.DB
+			if replica, err = open(dsn); err != nil {
+				break
+			}
+			next.replicas = append(next.replicas, replica)
+		}
+	}
+	if err != nil {
+		for _, database := range opened {
+			database.Close()
+		}
+		return fmt.Errorf("dbconfig: %w", err)
+	}
+
+	for _, database := range endpoints {
+		config.Pool.apply(database)
+	}
+	for dsn, database := range t.endpoints {
+		if _, kept := endpoints[dsn]; !kept {
+			t.drain(database)
+		}
+	}
+
+	t.config = config
+	t.endpoints = endpoints
+	t.current.Store(next)
+	return nil
+}
+
+// drain closes database once the drain period is over.
+func (t *Topology) drain(database *sqlx.DB) {
+	t.draining[database] = time.AfterFunc(t.opts.Drain, func() {
+		t.mu.Lock()
+		delete(t.draining, database)
+		t.mu.Unlock()
+
+		if err := database.Close(); err != nil {
+			db.Logger().Error("dbconfig: closing drained endpoint failed", "err", err)
+		}
+	})
+}
+
+// UnitOfWork returns a unit of work over the current primary, reading from
+// the current replicas and bounding statements with the configured timeouts.
+// opts are applied after those.
+func (t *Topology) UnitOfWork(opts ...db.Option) db.UnitOfWork {
+	current := t.current.Load()
+	own := []db.Option{db.WithInterceptors(t.Interceptor()), db.WithReplicas(t.opts.Balancer, current.replicas...)}
+	return db.NewUnitOfWork(current.primary, nil, append(own, opts...)...)
+}
+
+// Interceptor applies the timeouts of the current configuration; use it on
+// unit of works not created by the topology.
+func (t *Topology) Interceptor() db.Interceptor {
+	return func(ctx context.Context, stmt *db.Statement, next db.Handler) error {
+		return t.current.Load().timeouts(ctx, stmt, next)
+	}
+}
+
+// Primary returns the current primary.
+func (t *Topology) Primary() *sqlx.DB {
+	return t.current.Load().primary
+}
+
+// Replicas returns the current replicas, in configuration order or, when
+// discovered, in the order of their DSNs.
+func (t *Topology) Replicas() []*sqlx.DB {
+	return t.current.Load().replicas
+}
+
+// Config returns the configuration applied last.
+func (t *Topology) Config() Config {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.config
+}
+
+// Watch applies the configuration file at path whenever it changes, until
+// ctx is done. The directory of the file is watched rather than the file,
+// so that files replaced by a rename, as editors and Kubernetes volumes do,
+// keep being followed. Files failing to load or apply are logged and
+// reported to OnReload, and the topology keeps its configuration.
+func (t *Topology) Watch(ctx context.Context, path string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// writes come in bursts, reload once they settle
+	settle := time.NewTimer(time.Hour)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-watcher.Errors:
+			db.Logger().Error("dbconfig: watching configuration failed", "path", path, "err", err)
+		case <-watcher.Events:
+			settle.Reset(100 * time.Millisecond)
+		case <-settle.C:
+			t.reload(ctx, path)
+		}
+	}
+}
+
+func (t *Topology) reload(ctx context.Context, path string) {
+	config, err := Load(path)
+	if err == nil {
+		if reflect.DeepEqual(config, t.Config()) {
+			return
+		}
+		err = t.Apply(ctx, config)
+	}
+
+	if err != nil {
+		db.Logger().Error("dbconfig: configuration reload failed", "path", path, "err", err)
+	} else {
+		db.Logger().Info("dbconfig: configuration reloaded", "path", path, "replicas", len(config.Replicas))
+	}
+	if t.opts.OnReload != nil {
+		t.opts.OnReload(config, err)
+	}
+}
+
+// Close closes every endpoint, draining ones included, right away.
+func (t *Topology) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	var errs []error
+	for database, timer := range t.draining {
+		if timer.Stop() {
+			errs = append(errs, database.Close())
+		}
+	}
+	for _, database := range t.endpoints {
+		errs = append(errs, database.Close())
+	}
+	t.draining = map[*sqlx.DB]*time.Timer{}
+	t.endpoints = map[string]*sqlx.DB{}
+	return errors.Join(errs...)
+}
+
+func (p Pool) apply(database *sqlx.DB) {
+	database.SetMaxOpenConns(p.MaxOpenConns)
+	if p.MaxIdleConns == 0 {
+		database.SetMaxIdleConns(2)
+	} else {
+		database.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	database.SetConnMaxLifetime(time.Duration(p.ConnMaxLifetime))
+	database.SetConnMaxIdleTime(time.Duration(p.ConnMaxIdleTime))
+}
+
+func (t Timeouts) config() db.TimeoutConfig {
+	config := db.TimeoutConfig{Default: time.Duration(t.Default)}
+	if len(t.Labels) > 0 {
+		config.Labels = make(map[string]time.Duration, len(t.Labels))
+		for label, d := range t.Labels {
+			config.Labels[label] = time.Duration(d)
+		}
+	}
+	if len(t.Fingerprints) > 0 {
+		config.Fingerprints = make(map[string]time.Duration, len(t.Fingerprints))
+		for query, d := range t.Fingerprints {
+			config.Fingerprints[query] = time.Duration(d)
+		}
+	}
+	return config
+}
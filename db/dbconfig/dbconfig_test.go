@@ -0,0 +1,188 @@
+package dbconfig
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockEndpoints opens a sqlmock database per DSN, failing for "down".
+type mockEndpoints struct {
+	mu     sync.Mutex
+	opened map[string]*sqlx.DB
+}
+
+func (m *mockEndpoints) open(driver, dsn string) (*sqlx.DB, error) {
+	if dsn == "down" {
+		return nil, errors.New("connection refused")
+	}
+	conn, _, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.opened == nil {
+		m.opened = map[string]*sqlx.DB{}
+	}
+	m.opened[dsn] = sqlx.NewDb(conn, driver)
+	return m.opened[dsn], nil
+}
+
+func (m *mockEndpoints) get(dsn string) *sqlx.DB {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.opened[dsn]
+}
+
+func closed(database *sqlx.DB) bool {
+	return database.Ping() != nil
+}
+
+func TestShouldParseConfigurations(t *testing.T) {
+	config, err := Parse([]byte(`{"driver": "postgres", "primary": "p", "replicas": ["r1"],
+		"pool": {"max_open_conns": 20, "conn_max_lifetime": "30m", "conn_max_idle_time": 1000},
+		"timeouts": {"default": "5s", "labels": {"report": "1m"}}}`))
+
+	assert.Nil(t, err)
+	assert.Equal(t, Config{
+		Driver:   "postgres",
+		Primary:  "p",
+		Replicas: []string{"r1"},
+		Pool:     Pool{MaxOpenConns: 20, ConnMaxLifetime: Duration(30 * time.Minute), ConnMaxIdleTime: 1000},
+		Timeouts: Timeouts{Default: Duration(5 * time.Second), Labels: map[string]Duration{"report": Duration(time.Minute)}},
+	}, config)
+
+	_, err = Parse([]byte(`{"driver": "postgres"}`))
+	assert.EqualError(t, err, "dbconfig: driver and primary are required")
+
+	_, err = Parse([]byte(`{"driver": "postgres", "primary": "p", "timeouts": {"default": "soon"}}`))
+	assert.EqualError(t, err, `dbconfig: time: invalid duration "soon"`)
+}
+
+func TestShouldSwapReplicasAndDrainRemovedOnes(t *testing.T) {
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), Config{Driver: "postgres", Primary: "p", Replicas: []string{"r1", "r2"}},
+		Options{Open: endpoints.open, Drain: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	defer topology.Close()
+	primary, r1, r2 := endpoints.get("p"), endpoints.get("r1"), endpoints.get("r2")
+
+	err = topology.Apply(context.Background(), Config{Driver: "postgres", Primary: "p", Replicas: []string{"r2", "r3"},
+		Pool: Pool{MaxOpenConns: 7}})
+
+	assert.Nil(t, err)
+	assert.Same(t, primary, topology.Primary())
+	assert.Equal(t, []*sqlx.DB{r2, endpoints.get("r3")}, topology.Replicas())
+	assert.Equal(t, 7, r2.Stats().MaxOpenConnections)
+	assert.Equal(t, 7, primary.Stats().MaxOpenConnections)
+	assert.Eventually(t, func() bool { return closed(r1) }, time.Second, 5*time.Millisecond)
+	assert.False(t, closed(r2))
+}
+
+func TestShouldKeepTheTopologyWhenAnEndpointFails(t *testing.T) {
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), Config{Driver: "postgres", Primary: "p", Replicas: []string{"r1"}},
+		Options{Open: endpoints.open})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	err = topology.Apply(context.Background(), Config{Driver: "postgres", Primary: "p", Replicas: []string{"r2", "down"}})
+
+	assert.EqualError(t, err, "dbconfig: connection refused")
+	assert.Equal(t, []*sqlx.DB{endpoints.get("r1")}, topology.Replicas())
+	assert.Equal(t, []string{"r1"}, topology.Config().Replicas)
+	assert.True(t, closed(endpoints.get("r2")))
+
+	err = topology.Apply(context.Background(), Config{Driver: "mysql", Primary: "p"})
+	assert.EqualError(t, err, "dbconfig: cannot change driver from postgres to mysql")
+}
+
+func TestShouldApplyReloadedTimeouts(t *testing.T) {
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), Config{Driver: "postgres", Primary: "p"}, Options{Open: endpoints.open})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	interceptor := topology.Interceptor()
+	deadline := func() (time.Duration, bool) {
+		var left time.Duration
+		var ok bool
+		interceptor(context.Background(), &db.Statement{Kind: db.KindExec, Query: "DELETE FROM orders"}, func(ctx context.Context, stmt *db.Statement) error {
+			var d time.Time
+			if d, ok = ctx.Deadline(); ok {
+				left = time.Until(d)
+			}
+			return nil
+		})
+		return left, ok
+	}
+
+	_, ok := deadline()
+	assert.False(t, ok)
+
+	err = topology.Apply(context.Background(), Config{Driver: "postgres", Primary: "p", Timeouts: Timeouts{Default: Duration(time.Minute)}})
+	assert.Nil(t, err)
+
+	left, ok := deadline()
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Minute), float64(left), float64(time.Second))
+}
+
+func TestShouldReloadWatchedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{"driver": "postgres", "primary": "p"}`), 0o644))
+
+	config, err := Load(path)
+	assert.Nil(t, err)
+
+	reloads := make(chan error, 10)
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), config, Options{
+		Open:     endpoints.open,
+		OnReload: func(_ Config, err error) { reloads <- err },
+	})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watching := make(chan error, 1)
+	go func() { watching <- topology.Watch(ctx, path) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// replace the file with a rename, as Kubernetes and editors do
+	next := path + ".tmp"
+	assert.Nil(t, os.WriteFile(next, []byte(`{"driver": "postgres", "primary": "p", "replicas": ["r1"]}`), 0o644))
+	assert.Nil(t, os.Rename(next, path))
+
+	select {
+	case err := <-reloads:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload")
+	}
+	assert.Equal(t, []*sqlx.DB{endpoints.get("r1")}, topology.Replicas())
+
+	assert.Nil(t, os.WriteFile(path, []byte(`{"driver": "postgres"`), 0o644))
+	select {
+	case err := <-reloads:
+		assert.NotNil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload")
+	}
+	assert.Len(t, topology.Replicas(), 1)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-watching)
+}
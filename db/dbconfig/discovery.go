@@ -0,0 +1,159 @@
+package dbconfig
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+// Resolver looks up the records replicas are discovered from; *net.Resolver
+// implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DiscoveryConfig configures Discover.
+type DiscoveryConfig struct {
+	// Name is the DNS name of the replicas, e.g. the headless Kubernetes
+	// service in front of them, whose addresses are the replicas.
+	Name string
+
+	// Service, when set, looks up the SRV records _service._proto.Name
+	// instead, which give the port of every replica as well. Proto defaults
+	// to tcp.
+	Service string
+	Proto   string
+
+	// Port of the replicas found through addresses. Zero means 5432.
+	Port int
+
+	// DSN returns the DSN of the replica at host and port.
+	DSN func(host string, port int) string
+
+	// Interval between lookups. Zero means 30 seconds.
+	Interval time.Duration
+
+	// Resolver looks up the records. Nil means net.DefaultResolver.
+	Resolver Resolver
+}
+
+func (c *DiscoveryConfig) defaults() {
+	if c.Proto == "" {
+		c.Proto = "tcp"
+	}
+	if c.Port <= 0 {
+		c.Port = 5432
+	}
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Resolver == nil {
+		c.Resolver = net.DefaultResolver
+	}
+}
+
+// Discover makes the replicas of the topology those found in DNS, looking
+// them up every interval until ctx is done. Replicas appearing are opened and
+// those disappearing drained, as with Apply; the replicas of the
+// configuration are ignored meanwhile, and used again once Discover
+// returns. Failed lookups keep the current replicas until the next one; a
+// lookup finding nothing leaves reads on the primary.
+func (t *Topology) Discover(ctx context.Context, config DiscoveryConfig) error {
+	if config.Name == "" || config.DSN == nil {
+		return errors.New("dbconfig: discovery needs a name and a DSN function")
+	}
+	config.defaults()
+
+	defer func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.discovering = false
+		t.discovered = nil
+		if !t.closed {
+			if err := t.apply(context.Background(), t.config); err != nil {
+				db.Logger().Error("dbconfig: restoring configured replicas failed", "err", err)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.discover(ctx, config); err != nil && ctx.Err() == nil {
+			db.Logger().Error("dbconfig: replica discovery failed", "name", config.Name, "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// discover looks the replicas up once and applies them when they changed.
+func (t *Topology) discover(ctx context.Context, config DiscoveryConfig) error {
+	dsns, err := lookupReplicas(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.discovering && slices.Equal(dsns, t.discovered) {
+		return nil
+	}
+	previous, was := t.discovered, t.discovering
+	t.discovering, t.discovered = true, dsns
+	if err := t.apply(ctx, t.config); err != nil {
+		t.discovering, t.discovered = was, previous
+		return err
+	}
+	db.Logger().Info("dbconfig: replicas discovered", "name", config.Name, "replicas", len(dsns))
+	return nil
+}
+
+// lookupReplicas returns the sorted DSNs of the replicas in DNS.
+// A name that does not exist, as that of a headless service without ready
+// pods, has no replicas.
+func lookupReplicas(ctx context.Context, config DiscoveryConfig) ([]string, error) {
+	dsns, err := lookupDSNs(ctx, config)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return dsns, err
+}
+
+func lookupDSNs(ctx context.Context, config DiscoveryConfig) ([]string, error) {
+	var dsns []string
+	if config.Service != "" {
+		_, records, err := config.Resolver.LookupSRV(ctx, config.Service, config.Proto, config.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records {
+			dsns = append(dsns, config.DSN(strings.TrimSuffix(record.Target, "."), int(record.Port)))
+		}
+	} else {
+		hosts, err := config.Resolver.LookupHost(ctx, config.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			dsns = append(dsns, config.DSN(host, config.Port))
+		}
+	}
+
+	slices.Sort(dsns)
+	return slices.Compact(dsns), nil
+}
@@ -0,0 +1,120 @@
+package dbconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	hosts []string
+	srv   []*net.SRV
+	err   error
+}
+
+func (r *fakeResolver) set(err error, hosts ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts, r.err = hosts, err
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hosts, r.err
+}
+
+func (r *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return "", r.srv, r.err
+}
+
+func replicaDSN(host string, port int) string {
+	return fmt.Sprintf("postgres://%s:%d/app", host, port)
+}
+
+func TestShouldFollowDiscoveredReplicas(t *testing.T) {
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), Config{Driver: "postgres", Primary: "p", Replicas: []string{"static"}},
+		Options{Open: endpoints.open, Drain: time.Millisecond})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	resolver := &fakeResolver{}
+	resolver.set(nil, "10.0.0.2", "10.0.0.1")
+	config := DiscoveryConfig{Name: "replicas.db.svc", DSN: replicaDSN, Resolver: resolver}
+	config.defaults()
+
+	assert.Nil(t, topology.discover(context.Background(), config))
+	r1, r2 := endpoints.get("postgres://10.0.0.1:5432/app"), endpoints.get("postgres://10.0.0.2:5432/app")
+	assert.Equal(t, []*sqlx.DB{r1, r2}, topology.Replicas())
+	assert.Eventually(t, func() bool { return closed(endpoints.get("static")) }, time.Second, time.Millisecond)
+
+	resolver.set(nil, "10.0.0.2", "10.0.0.3")
+	assert.Nil(t, topology.discover(context.Background(), config))
+	assert.Equal(t, []*sqlx.DB{r2, endpoints.get("postgres://10.0.0.3:5432/app")}, topology.Replicas())
+	assert.Eventually(t, func() bool { return closed(r1) }, time.Second, time.Millisecond)
+
+	resolver.set(errors.New("timeout"))
+	assert.EqualError(t, topology.discover(context.Background(), config), "timeout")
+	assert.Len(t, topology.Replicas(), 2)
+
+	resolver.set(&net.DNSError{Err: "no such host", Name: "replicas.db.svc", IsNotFound: true})
+	assert.Nil(t, topology.discover(context.Background(), config))
+	assert.Empty(t, topology.Replicas())
+}
+
+func TestShouldDiscoverReplicasFromSRVRecords(t *testing.T) {
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), Config{Driver: "postgres", Primary: "p"}, Options{Open: endpoints.open})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	resolver := &fakeResolver{srv: []*net.SRV{
+		{Target: "db-1.replicas.db.svc.", Port: 6432},
+		{Target: "db-0.replicas.db.svc.", Port: 6432},
+	}}
+	config := DiscoveryConfig{Name: "replicas.db.svc", Service: "postgres", DSN: replicaDSN, Resolver: resolver}
+	config.defaults()
+	err = topology.discover(context.Background(), config)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*sqlx.DB{
+		endpoints.get("postgres://db-0.replicas.db.svc:6432/app"),
+		endpoints.get("postgres://db-1.replicas.db.svc:6432/app"),
+	}, topology.Replicas())
+}
+
+func TestShouldRestoreConfiguredReplicasOnceDiscoveryStops(t *testing.T) {
+	endpoints := &mockEndpoints{}
+	topology, err := New(context.Background(), Config{Driver: "postgres", Primary: "p", Replicas: []string{"static"}}, Options{Open: endpoints.open})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	resolver := &fakeResolver{}
+	resolver.set(nil, "10.0.0.1")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- topology.Discover(ctx, DiscoveryConfig{Name: "replicas.db.svc", DSN: replicaDSN, Resolver: resolver, Interval: time.Millisecond})
+	}()
+
+	assert.Eventually(t, func() bool {
+		replicas := topology.Replicas()
+		return len(replicas) == 1 && replicas[0] == endpoints.get("postgres://10.0.0.1:5432/app")
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Len(t, topology.Replicas(), 1)
+	assert.Same(t, endpoints.get("static"), topology.Replicas()[0])
+}
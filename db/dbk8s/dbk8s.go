@@ -0,0 +1,403 @@
+// Package dbk8s reconfigures a dbconfig.Topology from the pods of a Postgres
+// cluster running in Kubernetes, so that reads and writes follow failovers
+// performed by operators such as Patroni or CloudNativePG without a restart.
+//
+// Those operators publish the role of every instance as a pod label:
+// Patroni sets role=master or role=replica (primary in recent versions),
+// CloudNativePG sets cnpg.io/instanceRole=primary or replica. Follow watches
+// the pods matching a selector through the Kubernetes API and makes the ready
+// pod labelled primary the primary of the topology, and the other ready pods
+// its replicas.
+//
+//	client, err := dbk8s.InCluster()
+//	...
+//	go dbk8s.Follow(ctx, topology, dbk8s.Config{
+//		Client:    client,
+//		Selector:  "cnpg.io/cluster=app",
+//		RoleLabel: "cnpg.io/instanceRole",
+//		DSN: func(host string, port int) string {
+//			return fmt.Sprintf("postgres://app@%s:%d/app", host, port)
+//		},
+//	})
+//
+// The service account needs the get, list and watch verbs on pods.
+package dbk8s
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/helderfarias/sqlx-wrapper/db/dbconfig"
+)
+
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Client calls the Kubernetes API.
+type Client struct {
+	base      string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+// NewClient creates a client of the API server at base, e.g.
+// https://kubernetes.default.svc, authenticating with a bearer token when
+// token is not empty. Nil httpClient means http.DefaultClient.
+func NewClient(base, token, namespace string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{base: strings.TrimSuffix(base, "/"), token: token, namespace: namespace, http: httpClient}
+}
+
+// InCluster creates a client from the service account Kubernetes mounts in
+// pods, of the namespace the pod runs in.
+func InCluster() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("dbk8s: not running in a Kubernetes pod")
+	}
+
+	token, err := os.ReadFile(serviceAccount + "/token")
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := os.ReadFile(serviceAccount + "/namespace")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccount + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, errors.New("dbk8s: no certificate in the service account CA")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	return NewClient("https://"+net.JoinHostPort(host, port), strings.TrimSpace(string(token)),
+		strings.TrimSpace(string(namespace)), &http.Client{Transport: transport}), nil
+}
+
+// Config configures Follow.
+type Config struct {
+	// Client calls the API. Nil means InCluster().
+	Client *Client
+
+	// Namespace of the pods. Empty means the namespace of the client.
+	Namespace string
+
+	// Selector is the label selector of the pods of the cluster, e.g.
+	// "cnpg.io/cluster=app" or "cluster-name=app".
+	Selector string
+
+	// RoleLabel is the label holding the role of a pod. Empty means "role".
+	RoleLabel string
+
+	// PrimaryRoles are the values of RoleLabel marking the primary. Nil
+	// means "primary" and "master".
+	PrimaryRoles []string
+
+	// Port of the instances. Zero means 5432.
+	Port int
+
+	// DSN returns the DSN of the instance at host and port.
+	DSN func(host string, port int) string
+
+	// RetryInterval is the pause before listing again once the watch
+	// failed. Zero means 5 seconds.
+	RetryInterval time.Duration
+
+	// OnChange is called after the topology was switched to primary and
+	// replicas, the DSNs of the instances.
+	OnChange func(primary string, replicas []string)
+}
+
+func (c *Config) defaults() error {
+	if c.Selector == "" || c.DSN == nil {
+		return errors.New("dbk8s: a selector and a DSN function are required")
+	}
+	if c.Client == nil {
+		client, err := InCluster()
+		if err != nil {
+			return err
+		}
+		c.Client = client
+	}
+	if c.Namespace == "" {
+		c.Namespace = c.Client.namespace
+	}
+	if c.RoleLabel == "" {
+		c.RoleLabel = "role"
+	}
+	if c.PrimaryRoles == nil {
+		c.PrimaryRoles = []string{"primary", "master"}
+	}
+	if c.Port <= 0 {
+		c.Port = 5432
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = 5 * time.Second
+	}
+	return nil
+}
+
+// Follow keeps the primary and the replicas of topology those of the pods
+// until ctx is done. While no ready pod is labelled primary, as during a
+// failover, the topology keeps its primary; writes to the demoted one fail
+// until the new primary is ready. While several are, it keeps its primary
+// and replicas too, logging it, until the labels agree again. Failures of
+// the API are logged and retried.
+func Follow(ctx context.Context, topology *dbconfig.Topology, config Config) error {
+	if err := config.defaults(); err != nil {
+		return err
+	}
+
+	f := &follower{topology: topology, config: config}
+	for {
+		err := f.run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		db.Logger().Error("dbk8s: watching pods failed", "selector", config.Selector, "err", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(config.RetryInterval):
+		}
+	}
+}
+
+type follower struct {
+	topology *dbconfig.Topology
+	config   Config
+	pods     map[string]pod
+}
+
+// run lists the pods, applies them and follows their changes until the
+// watch ends.
+func (f *follower) run(ctx context.Context) error {
+	list, err := f.list(ctx)
+	if err != nil {
+		return err
+	}
+	f.pods = map[string]pod{}
+	for _, p := range list.Items {
+		f.pods[p.Metadata.Name] = p
+	}
+	if err := f.apply(ctx); err != nil {
+		return err
+	}
+
+	version := list.Metadata.ResourceVersion
+	for {
+		if version, err = f.watch(ctx, version); err != nil {
+			return err
+		}
+	}
+}
+
+// watch follows the changes after version, returning the last version seen
+// when the server ends the watch, as it does every few minutes.
+func (f *follower) watch(ctx context.Context, version string) (string, error) {
+	body, err := f.get(ctx, url.Values{"watch": {"true"}, "resourceVersion": {version}, "allowWatchBookmarks": {"true"}})
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return "", fmt.Errorf("dbk8s: %w", err)
+		}
+
+		if event.Type == "ERROR" {
+			// typically 410 Gone, the version is too old: list again
+			var status struct {
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			return "", fmt.Errorf("dbk8s: watch: %s", status.Message)
+		}
+
+		var p pod
+		if err := json.Unmarshal(event.Object, &p); err != nil {
+			return "", fmt.Errorf("dbk8s: %w", err)
+		}
+		version = p.Metadata.ResourceVersion
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			f.pods[p.Metadata.Name] = p
+		case "DELETED":
+			delete(f.pods, p.Metadata.Name)
+		default:
+			continue
+		}
+		if err := f.apply(ctx); err != nil {
+			return "", err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// apply switches the topology to the ready pods, when exactly one is labelled
+// primary and they differ from the current ones.
+func (f *follower) apply(ctx context.Context) error {
+	primaries, replicas := f.roles()
+	if len(primaries) == 0 {
+		return nil
+	}
+
+	config := f.topology.Config()
+	if len(primaries) > 1 {
+		// as briefly during a switchover: wait for the labels to settle
+		// rather than guess which one accepts writes
+		db.Logger().Warn("dbk8s: several pods labelled primary, keeping the current one",
+			"primary", config.Primary, "labelled", primaries)
+		return nil
+	}
+
+	primary := primaries[0]
+	if config.Primary == primary && slices.Equal(config.Replicas, replicas) {
+		return nil
+	}
+	config.Primary, config.Replicas = primary, replicas
+	if err := f.topology.Apply(ctx, config); err != nil {
+		return err
+	}
+
+	db.Logger().Info("dbk8s: topology changed", "primary", primary, "replicas", len(replicas))
+	if f.config.OnChange != nil {
+		f.config.OnChange(primary, replicas)
+	}
+	return nil
+}
+
+// roles returns the DSNs, sorted, of the ready pods labelled primary and of
+// the other ready pods.
+func (f *follower) roles() (primaries, replicas []string) {
+	for _, p := range f.pods {
+		if !p.ready() {
+			continue
+		}
+		if slices.Contains(f.config.PrimaryRoles, p.Metadata.Labels[f.config.RoleLabel]) {
+			primaries = append(primaries, f.dsn(p))
+		} else {
+			replicas = append(replicas, f.dsn(p))
+		}
+	}
+
+	slices.Sort(primaries)
+	slices.Sort(replicas)
+	return primaries, replicas
+}
+
+func (f *follower) dsn(p pod) string {
+	return f.config.DSN(p.Status.PodIP, f.config.Port)
+}
+
+func (f *follower) list(ctx context.Context) (*podList, error) {
+	body, err := f.get(ctx, url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var list podList
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("dbk8s: %w", err)
+	}
+	return &list, nil
+}
+
+func (f *follower) get(ctx context.Context, query url.Values) (io.ReadCloser, error) {
+	client := f.config.Client
+	query.Set("labelSelector", f.config.Selector)
+	endpoint := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?%s", client.base, url.PathEscape(f.config.Namespace), query.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client.token != "" {
+		req.Header.Set("Authorization", "Bearer "+client.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("dbk8s: %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// pod holds the fields of a Kubernetes pod Follow uses.
+type pod struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		ResourceVersion   string            `json:"resourceVersion"`
+		Labels            map[string]string `json:"labels"`
+		DeletionTimestamp *time.Time        `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		PodIP      string    `json:"podIP"`
+		StartTime  time.Time `json:"startTime"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// ready reports whether the pod has an address, is not terminating and
+// passes its readiness probe.
+func (p pod) ready() bool {
+	if p.Status.PodIP == "" || p.Metadata.DeletionTimestamp != nil {
+		return false
+	}
+	for _, c := range p.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True"
+		}
+	}
+	return false
+}
+
+type podList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []pod `json:"items"`
+}
@@ -0,0 +1,202 @@
+package dbk8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db/dbconfig"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI serves the pods of a namespace, streaming the events sent to it
+// to watches.
+type fakeAPI struct {
+	pods   []pod
+	events chan string
+	mu     sync.Mutex
+	paths  []string
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	a.paths = append(a.paths, r.URL.Path+" "+r.URL.Query().Get("labelSelector")+" "+r.Header.Get("Authorization"))
+	a.mu.Unlock()
+
+	if r.URL.Query().Get("watch") != "true" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metadata": map[string]string{"resourceVersion": "1"},
+			"items":    a.pods,
+		})
+		return
+	}
+
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-a.events:
+			fmt.Fprintln(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func newPod(name, role, ip string, ready bool) pod {
+	var p pod
+	p.Metadata.Name = name
+	p.Metadata.Labels = map[string]string{"role": role}
+	p.Status.PodIP = ip
+	p.Status.StartTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	status := "False"
+	if ready {
+		status = "True"
+	}
+	p.Status.Conditions = append(p.Status.Conditions, struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}{Type: "Ready", Status: status})
+	return p
+}
+
+func event(kind string, p pod) string {
+	data, _ := json.Marshal(map[string]interface{}{"type": kind, "object": p})
+	return string(data)
+}
+
+func openMock(driver, dsn string) (*sqlx.DB, error) {
+	conn, _, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(conn, driver), nil
+}
+
+func instanceDSN(host string, port int) string {
+	return fmt.Sprintf("postgres://%s:%d/app", host, port)
+}
+
+func TestShouldFollowFailoverOfThePrimary(t *testing.T) {
+	api := &fakeAPI{
+		pods:   []pod{newPod("db-0", "primary", "10.0.0.1", true), newPod("db-1", "replica", "10.0.0.2", true)},
+		events: make(chan string),
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	topology, err := dbconfig.New(context.Background(), dbconfig.Config{Driver: "postgres", Primary: "bootstrap"},
+		dbconfig.Options{Open: openMock, Drain: time.Millisecond})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	changes := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, topology, Config{
+			Client:   NewClient(server.URL, "secret", "db", nil),
+			Selector: "cluster=app",
+			DSN:      instanceDSN,
+			OnChange: func(primary string, replicas []string) { changes <- append([]string{primary}, replicas...) },
+		})
+	}()
+
+	assert.Equal(t, []string{"postgres://10.0.0.1:5432/app", "postgres://10.0.0.2:5432/app"}, <-changes)
+	assert.Equal(t, "postgres://10.0.0.1:5432/app", topology.Config().Primary)
+
+	// demoted first, no primary until the new one is promoted
+	api.events <- event("MODIFIED", newPod("db-0", "replica", "10.0.0.1", true))
+	api.events <- event("MODIFIED", newPod("db-1", "primary", "10.0.0.2", true))
+	assert.Equal(t, []string{"postgres://10.0.0.2:5432/app", "postgres://10.0.0.1:5432/app"}, <-changes)
+
+	api.events <- event("DELETED", newPod("db-0", "replica", "10.0.0.1", true))
+	assert.Equal(t, []string{"postgres://10.0.0.2:5432/app"}, <-changes)
+	assert.Equal(t, dbconfig.Config{Driver: "postgres", Primary: "postgres://10.0.0.2:5432/app"}, topology.Config())
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	assert.Contains(t, api.paths, "/api/v1/namespaces/db/pods cluster=app Bearer secret")
+}
+
+func TestShouldSkipPodsThatAreNotReady(t *testing.T) {
+	deleting := newPod("db-3", "replica", "10.0.0.4", true)
+	deleting.Metadata.DeletionTimestamp = &time.Time{}
+
+	f := &follower{config: Config{Selector: "cluster=app", DSN: instanceDSN, Client: NewClient("http://api", "", "db", nil)}}
+	f.config.defaults()
+	f.pods = map[string]pod{
+		"db-0": newPod("db-0", "master", "10.0.0.1", false),
+		"db-1": newPod("db-1", "replica", "10.0.0.2", true),
+		"db-2": newPod("db-2", "replica", "", true),
+		"db-3": deleting,
+	}
+
+	primaries, replicas := f.roles()
+	assert.Empty(t, primaries)
+	assert.Equal(t, []string{"postgres://10.0.0.2:5432/app"}, replicas)
+
+	f.pods["db-0"] = newPod("db-0", "master", "10.0.0.1", true)
+	primaries, replicas = f.roles()
+	assert.Equal(t, []string{"postgres://10.0.0.1:5432/app"}, primaries)
+	assert.Equal(t, []string{"postgres://10.0.0.2:5432/app"}, replicas)
+}
+
+func TestShouldKeepTheCurrentPrimaryWhileSeveralAreLabelled(t *testing.T) {
+	api := &fakeAPI{
+		pods: []pod{
+			newPod("db-0", "primary", "10.0.0.1", true),
+			newPod("db-1", "replica", "10.0.0.2", true),
+			newPod("db-2", "replica", "10.0.0.3", true),
+		},
+		events: make(chan string),
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	topology, err := dbconfig.New(context.Background(), dbconfig.Config{Driver: "postgres", Primary: "bootstrap"},
+		dbconfig.Options{Open: openMock, Drain: time.Millisecond})
+	assert.Nil(t, err)
+	defer topology.Close()
+
+	changes := make(chan []string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, topology, Config{
+			Client:   NewClient(server.URL, "", "db", nil),
+			Selector: "cluster=app",
+			DSN:      instanceDSN,
+			OnChange: func(primary string, replicas []string) { changes <- append([]string{primary}, replicas...) },
+		})
+	}()
+	assert.Equal(t, []string{"postgres://10.0.0.1:5432/app", "postgres://10.0.0.2:5432/app", "postgres://10.0.0.3:5432/app"}, <-changes)
+
+	// a newer pod labelled primary before the old one is relabelled, then
+	// the promotion is abandoned
+	promoted := newPod("db-1", "primary", "10.0.0.2", true)
+	promoted.Status.StartTime = promoted.Status.StartTime.Add(time.Minute)
+	api.events <- event("MODIFIED", promoted)
+	api.events <- event("MODIFIED", newPod("db-1", "replica", "10.0.0.2", true))
+	api.events <- event("DELETED", newPod("db-2", "replica", "10.0.0.3", true))
+
+	assert.Equal(t, []string{"postgres://10.0.0.1:5432/app", "postgres://10.0.0.2:5432/app"}, <-changes)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestShouldRequireASelectorAndADSN(t *testing.T) {
+	err := Follow(context.Background(), nil, Config{Client: NewClient("http://api", "", "db", nil)})
+
+	assert.EqualError(t, err, "dbk8s: a selector and a DSN function are required")
+}
@@ -0,0 +1,122 @@
+// Package dbotel traces unit of works with OpenTelemetry: a span per
+// transaction begun by InTransaction and a child span per statement.
+package dbotel
+
+import (
+	"context"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/helderfarias/sqlx-wrapper/db"
+
+// Config tunes WithTracer.
+type Config struct {
+	// OmitStatement leaves db.statement out of spans, for statements that
+	// inline sensitive literals. Arguments are never recorded.
+	OmitStatement bool
+}
+
+// WithTracer traces the unit of work with tracers of tp. Unit of works
+// created without it pay nothing.
+func WithTracer(tp trace.TracerProvider, config ...Config) db.Option {
+	h := &hook{tracer: tp.Tracer(instrumentation)}
+	if len(config) > 0 {
+		h.config = config[0]
+	}
+	return db.WithHooks(h)
+}
+
+type hook struct {
+	db.NopHook
+	tracer trace.Tracer
+	config Config
+}
+
+// system returns the db.system attribute of driver.
+func system(driver string) attribute.KeyValue {
+	switch db.DialectFor(driver) {
+	case db.DialectPostgres:
+		return attribute.String("db.system", "postgresql")
+	case db.DialectMySQL:
+		return attribute.String("db.system", "mysql")
+	case db.DialectSQLite:
+		return attribute.String("db.system", "sqlite")
+	}
+	return attribute.String("db.system", "other_sql")
+}
+
+// txSpan is the span of a transaction, kept under its own key so that commits
+// of transactions begun otherwise never end the span of the caller.
+type txSpan struct {
+	span  trace.Span
+	ended bool
+}
+
+type txSpanKey struct{}
+
+func (h *hook) BeforeBegin(ctx context.Context) context.Context {
+	ctx, span := h.tracer.Start(ctx, "db.transaction", trace.WithSpanKind(trace.SpanKindClient))
+	return context.WithValue(ctx, txSpanKey{}, &txSpan{span: span})
+}
+
+func endTransaction(ctx context.Context, err error, attrs ...attribute.KeyValue) {
+	tx, ok := ctx.Value(txSpanKey{}).(*txSpan)
+	if !ok || tx.ended {
+		return
+	}
+	tx.ended = true
+	tx.span.SetAttributes(attrs...)
+	end(tx.span, err)
+}
+
+func (h *hook) BeforeQuery(ctx context.Context, stmt *db.Statement) (context.Context, error) {
+	info := db.Inspect(stmt.Driver, stmt.Query)
+	name := stmt.Label
+	if name == "" {
+		name = info.Verb
+	}
+
+	attrs := []attribute.KeyValue{system(stmt.Driver), attribute.String("db.operation", info.Verb)}
+	if !h.config.OmitStatement {
+		attrs = append(attrs, attribute.String("db.statement", stmt.Query))
+	}
+	if len(info.Tables) > 0 {
+		attrs = append(attrs, attribute.StringSlice("db.sql.tables", info.Tables))
+	}
+	if stmt.Label != "" {
+		attrs = append(attrs, attribute.String("db.label", stmt.Label))
+	}
+
+	ctx, _ = h.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, nil
+}
+
+func (h *hook) AfterQuery(ctx context.Context, stmt *db.Statement, err error) {
+	span := trace.SpanFromContext(ctx)
+	if stmt.Result != nil {
+		if n, err := stmt.Result.RowsAffected(); err == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	end(span, err)
+}
+
+func (h *hook) AfterCommit(ctx context.Context, err error) {
+	endTransaction(ctx, err)
+}
+
+func (h *hook) AfterRollback(ctx context.Context, err error) {
+	endTransaction(ctx, err, attribute.Bool("db.rolled_back", true))
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
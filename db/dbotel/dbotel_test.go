@@ -0,0 +1,95 @@
+package dbotel
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newMockDatabase(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return sqlx.NewDb(conn, "postgres"), mock
+}
+
+func TestShouldTraceTransactionsAndStatements(t *testing.T) {
+	database, mock := newMockDatabase(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("^SELECT id FROM orders").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	uow := db.NewUnitOfWork(database, nil, WithTracer(tp))
+
+	uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		tx.MustExec("UPDATE orders SET status = 'paid' WHERE id = $1", 1)
+		var ids []int64
+		return nil, tx.Select(&ids, "SELECT id FROM orders")
+	})
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	update, query, transaction := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "UPDATE", update.Name())
+	assert.Contains(t, update.Attributes(), attribute.String("db.system", "postgresql"))
+	assert.Contains(t, update.Attributes(), attribute.String("db.statement", "UPDATE orders SET status = 'paid' WHERE id = $1"))
+	assert.Contains(t, update.Attributes(), attribute.Int64("db.rows_affected", 2))
+	assert.Equal(t, transaction.SpanContext().SpanID(), update.Parent().SpanID())
+
+	assert.Equal(t, codes.Error, query.Status().Code)
+	assert.Len(t, query.Events(), 1)
+
+	assert.Equal(t, "db.transaction", transaction.Name())
+	assert.Contains(t, transaction.Attributes(), attribute.Bool("db.rolled_back", true))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldOmitStatements(t *testing.T) {
+	database, mock := newMockDatabase(t)
+	mock.ExpectExec("^DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	db.NewUnitOfWork(database, nil, WithTracer(tp, Config{OmitStatement: true})).MustExec("DELETE FROM sessions WHERE token = 'secret'")
+
+	for _, attr := range recorder.Ended()[0].Attributes() {
+		assert.NotEqual(t, attribute.Key("db.statement"), attr.Key)
+	}
+}
+
+func TestShouldEndTheTransactionSpanWhenBeginFails(t *testing.T) {
+	database, mock := newMockDatabase(t)
+	mock.ExpectBegin().WillReturnError(assert.AnError)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	uow := db.NewUnitOfWork(database, nil, WithTracer(tp))
+
+	_, err := uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		t.Fatal("the transaction did not begin")
+		return nil, nil
+	})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "db.transaction", spans[0].Name())
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
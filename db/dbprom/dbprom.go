@@ -0,0 +1,255 @@
+// Package dbprom exposes metrics of the db package to Prometheus.
+package dbprom
+
+import (
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config configures a Collector. Namespace defaults to "db".
+type Config struct {
+	Namespace string
+
+	// Buckets of the statement duration histogram, in seconds. Nil means
+	// prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Collector implements db.MetricsCollector with Prometheus metrics, labelled
+// by statement label and verb. Register it with a prometheus.Registerer and
+// install it on unit of works with db.WithMetrics.
+type Collector struct {
+	statements   *prometheus.CounterVec
+	durations    *prometheus.HistogramVec
+	transactions *prometheus.CounterVec
+	retries      prometheus.Counter
+}
+
+// NewCollector creates a collector for config.
+func NewCollector(config Config) *Collector {
+	if config.Namespace == "" {
+		config.Namespace = "db"
+	}
+	if config.Buckets == nil {
+		config.Buckets = prometheus.DefBuckets
+	}
+
+	return &Collector{
+		statements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Name:      "statements_total",
+			Help:      "Statements run, by label, verb and outcome.",
+		}, []string{"label", "verb", "outcome"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace,
+			Name:      "statement_duration_seconds",
+			Help:      "Duration of statements, by label and verb.",
+			Buckets:   config.Buckets,
+		}, []string{"label", "verb"}),
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Name:      "transactions_total",
+			Help:      "Transactions ended, by outcome: commit, rollback or error.",
+		}, []string{"outcome"}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Name:      "transaction_retries_total",
+			Help:      "Transactions retried after a transient error.",
+		}),
+	}
+}
+
+// ObserveStatement implements db.MetricsCollector.
+func (c *Collector) ObserveStatement(stmt *db.Statement, duration time.Duration, err error) {
+	verb := db.Inspect(stmt.Driver, stmt.Query).Verb
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	c.statements.WithLabelValues(stmt.Label, verb, outcome).Inc()
+	c.durations.WithLabelValues(stmt.Label, verb).Observe(duration.Seconds())
+}
+
+// ObserveTransaction implements db.MetricsCollector.
+func (c *Collector) ObserveTransaction(committed bool, err error) {
+	outcome := "rollback"
+	switch {
+	case err != nil:
+		outcome = "error"
+	case committed:
+		outcome = "commit"
+	}
+	c.transactions.WithLabelValues(outcome).Inc()
+}
+
+// ObserveRetry implements db.MetricsCollector.
+func (c *Collector) ObserveRetry(err error) {
+	c.retries.Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.statements.Describe(ch)
+	c.durations.Describe(ch)
+	c.transactions.Describe(ch)
+	c.retries.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.statements.Collect(ch)
+	c.durations.Collect(ch)
+	c.transactions.Collect(ch)
+	c.retries.Collect(ch)
+}
+
+// PoolCollector exposes the connection pool statistics of a database, read
+// from sql.DBStats on every scrape, labelled with the pool name.
+type PoolCollector struct {
+	db *sqlx.DB
+
+	open, inUse, idle, maxOpen             *prometheus.Desc
+	waits, waitSeconds, idleClosed, closed *prometheus.Desc
+}
+
+// NewPoolCollector creates a collector for the pool of database, named name,
+// e.g. "primary" or "replica".
+func NewPoolCollector(namespace, name string, database *sqlx.DB) *PoolCollector {
+	if namespace == "" {
+		namespace = "db"
+	}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", metric), help, nil, prometheus.Labels{"pool": name})
+	}
+
+	return &PoolCollector{
+		db:          database,
+		open:        desc("open_connections", "Established connections, in use or idle."),
+		inUse:       desc("in_use_connections", "Connections in use."),
+		idle:        desc("idle_connections", "Idle connections."),
+		maxOpen:     desc("max_open_connections", "Maximum number of open connections, 0 for unlimited."),
+		waits:       desc("waits_total", "Waits for a connection."),
+		waitSeconds: desc("wait_seconds_total", "Time waited for connections."),
+		idleClosed:  desc("idle_closed_total", "Connections closed for exceeding the idle limits."),
+		closed:      desc("lifetime_closed_total", "Connections closed for exceeding their maximum lifetime."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.open, c.inUse, c.idle, c.maxOpen, c.waits, c.waitSeconds, c.idleClosed, c.closed} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+	gauge := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.GaugeValue, v)
+	}
+	counter := func(d *prometheus.Desc, v float64) {
+		ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v)
+	}
+
+	gauge(c.open, float64(stats.OpenConnections))
+	gauge(c.inUse, float64(stats.InUse))
+	gauge(c.idle, float64(stats.Idle))
+	gauge(c.maxOpen, float64(stats.MaxOpenConnections))
+	counter(c.waits, float64(stats.WaitCount))
+	counter(c.waitSeconds, stats.WaitDuration.Seconds())
+	counter(c.idleClosed, float64(stats.MaxIdleClosed+stats.MaxIdleTimeClosed))
+	counter(c.closed, float64(stats.MaxLifetimeClosed))
+}
+
+// TenantCollector exposes the totals of a db.Meter, labelled by tenant, for
+// dashboards of the heaviest tenants. Every tenant metered gets its own
+// series.
+type TenantCollector struct {
+	meter *db.Meter
+
+	queries, rowsRead, rowsWritten, seconds *prometheus.Desc
+}
+
+// NewTenantCollector creates a collector for the totals of meter.
+func NewTenantCollector(namespace string, meter *db.Meter) *TenantCollector {
+	if namespace == "" {
+		namespace = "db"
+	}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "tenant", metric), help, []string{"tenant"}, nil)
+	}
+
+	return &TenantCollector{
+		meter:       meter,
+		queries:     desc("statements_total", "Statements run for the tenant."),
+		rowsRead:    desc("rows_read_total", "Rows read for the tenant."),
+		rowsWritten: desc("rows_written_total", "Rows written for the tenant."),
+		seconds:     desc("db_seconds_total", "Time spent in statements for the tenant."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *TenantCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.queries, c.rowsRead, c.rowsWritten, c.seconds} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *TenantCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, usage := range c.meter.Totals() {
+		counter := func(d *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, v, usage.Tenant)
+		}
+		counter(c.queries, float64(usage.Queries))
+		counter(c.rowsRead, float64(usage.RowsRead))
+		counter(c.rowsWritten, float64(usage.RowsWritten))
+		counter(c.seconds, usage.Time.Seconds())
+	}
+}
+
+// StatementCacheCollector exposes the counters of a db.StatementCache, read
+// on every scrape.
+type StatementCacheCollector struct {
+	cache *db.StatementCache
+
+	hits, misses, evictions, size *prometheus.Desc
+}
+
+// NewStatementCacheCollector creates a collector for cache.
+func NewStatementCacheCollector(namespace string, cache *db.StatementCache) *StatementCacheCollector {
+	if namespace == "" {
+		namespace = "db"
+	}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "statement_cache", metric), help, nil, nil)
+	}
+
+	return &StatementCacheCollector{
+		cache:     cache,
+		hits:      desc("hits_total", "Statements found prepared in the cache."),
+		misses:    desc("misses_total", "Statements prepared on a cache miss."),
+		evictions: desc("evictions_total", "Prepared statements closed to make room."),
+		size:      desc("statements", "Statements in the cache."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *StatementCacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.hits, c.misses, c.evictions, c.size} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *StatementCacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, float64(stats.Size))
+}
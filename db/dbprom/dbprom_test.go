@@ -0,0 +1,130 @@
+package dbprom
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCountStatementsTransactionsAndRetries(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	database := sqlx.NewDb(conn, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE accounts").WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	collector := NewCollector(Config{})
+	uow := db.NewUnitOfWork(database, nil, db.WithMetrics(collector), db.WithRetryPolicy(db.RetryPolicy{Backoff: func(int) time.Duration { return 0 }}))
+	_, err = uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		tx.MustExec("UPDATE accounts SET balance = 0 WHERE id = $1", 1)
+		return nil, nil
+	})
+	assert.Nil(t, err)
+
+	expected := `
+# HELP db_statements_total Statements run, by label, verb and outcome.
+# TYPE db_statements_total counter
+db_statements_total{label="",outcome="error",verb="UPDATE"} 1
+db_statements_total{label="",outcome="ok",verb="UPDATE"} 1
+# HELP db_transaction_retries_total Transactions retried after a transient error.
+# TYPE db_transaction_retries_total counter
+db_transaction_retries_total 1
+# HELP db_transactions_total Transactions ended, by outcome: commit, rollback or error.
+# TYPE db_transactions_total counter
+db_transactions_total{outcome="commit"} 1
+db_transactions_total{outcome="rollback"} 1
+`
+	assert.Nil(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"db_statements_total", "db_transactions_total", "db_transaction_retries_total"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldExposePoolStatistics(t *testing.T) {
+	conn, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	database := sqlx.NewDb(conn, "postgres")
+	database.SetMaxOpenConns(8)
+
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(NewPoolCollector("", "primary", database)))
+
+	expected := `
+# HELP db_pool_max_open_connections Maximum number of open connections, 0 for unlimited.
+# TYPE db_pool_max_open_connections gauge
+db_pool_max_open_connections{pool="primary"} 8
+`
+	assert.Nil(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "db_pool_max_open_connections"))
+}
+
+func TestShouldExposeTenantTotals(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	database := sqlx.NewDb(conn, "postgres")
+	mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 4))
+
+	meter := db.NewMeter(database, db.MeterConfig{})
+	uow := db.NewUnitOfWork(database, nil, db.WithContext(db.WithTenant(context.Background(), "acme")), db.WithInterceptors(meter.Interceptor()))
+	uow.MustExec("UPDATE orders SET status = 'paid'")
+
+	expected := `
+# HELP db_tenant_rows_written_total Rows written for the tenant.
+# TYPE db_tenant_rows_written_total counter
+db_tenant_rows_written_total{tenant="acme"} 4
+# HELP db_tenant_statements_total Statements run for the tenant.
+# TYPE db_tenant_statements_total counter
+db_tenant_statements_total{tenant="acme"} 1
+`
+	assert.Nil(t, testutil.CollectAndCompare(NewTenantCollector("", meter), strings.NewReader(expected),
+		"db_tenant_rows_written_total", "db_tenant_statements_total"))
+}
+
+func TestShouldExposeStatementCacheCounters(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	database := sqlx.NewDb(conn, "postgres")
+	prepared := mock.ExpectPrepare(`^SELECT 1$`)
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+
+	cache := db.NewStatementCache(database, db.StatementCacheConfig{})
+	uow := db.NewUnitOfWork(database, nil, db.WithStatementCache(cache))
+	uow.MustExec("SELECT 1")
+	uow.MustExec("SELECT 1")
+
+	expected := `
+# HELP db_statement_cache_hits_total Statements found prepared in the cache.
+# TYPE db_statement_cache_hits_total counter
+db_statement_cache_hits_total 1
+# HELP db_statement_cache_misses_total Statements prepared on a cache miss.
+# TYPE db_statement_cache_misses_total counter
+db_statement_cache_misses_total 1
+`
+	assert.Nil(t, testutil.CollectAndCompare(NewStatementCacheCollector("", cache), strings.NewReader(expected),
+		"db_statement_cache_hits_total", "db_statement_cache_misses_total"))
+}
@@ -0,0 +1,103 @@
+// Package dbtest provides helpers for testing code built on the db package.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+// SerializationFailure is the SQLSTATE of serialization failures.
+const SerializationFailure = "40001"
+
+// ConflictTable is the scratch table ForceSerializationFailure creates and
+// uses for its conflicting rows.
+const ConflictTable = "dbtest_conflicts"
+
+var conflictKeys = time.Now().UnixNano()
+
+// IsSerializationFailure reports whether err carries SQLSTATE 40001, as
+// reported by lib/pq and pgx errors.
+func IsSerializationFailure(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == SerializationFailure
+}
+
+// ForceSerializationFailure dooms the transaction open on uow: it switches
+// the transaction to SERIALIZABLE, then orchestrates a write skew with a
+// second transaction that commits first, so uow fails with SQLSTATE 40001 no
+// later than its commit. It must run before any other statement of the
+// transaction and requires Postgres; it fails outside of a transaction.
+//
+//	uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+//		if attempt == 1 {
+//			dbtest.ForceSerializationFailure(tx)
+//		}
+//		...
+//	})
+func ForceSerializationFailure(uow db.UnitOfWork) error {
+	database, ok := db.DatabaseOf(uow)
+	if !ok {
+		return fmt.Errorf("dbtest: cannot reach the database behind %T", uow)
+	}
+	if !db.IsTransactional(uow) {
+		return errors.New("dbtest: ForceSerializationFailure needs a transaction open on the unit of work")
+	}
+
+	ctx := context.Background()
+	next := atomic.AddInt64(&conflictKeys, 2)
+	mine, theirs := next-1, next
+
+	if _, err := database.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+ConflictTable+
+		" (id bigint PRIMARY KEY, n bigint NOT NULL)"); err != nil {
+		return err
+	}
+	if _, err := database.ExecContext(ctx, "INSERT INTO "+ConflictTable+" (id, n) VALUES ($1, 0), ($2, 0)",
+		mine, theirs); err != nil {
+		return err
+	}
+
+	// uow reads the row the other transaction writes and writes the row the
+	// other transaction reads: a cycle of read-write dependencies that only
+	// the first committer survives.
+	if err := run(uow, "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE"); err != nil {
+		return err
+	}
+
+	var n int64
+	if err := uow.Get(&n, "SELECT n FROM "+ConflictTable+" WHERE id = $1", theirs); err != nil {
+		return err
+	}
+	if err := run(uow, "UPDATE "+ConflictTable+" SET n = n + 1 WHERE id = $1", mine); err != nil {
+		return err
+	}
+
+	other, err := database.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer other.Rollback()
+
+	if err := other.GetContext(ctx, &n, "SELECT n FROM "+ConflictTable+" WHERE id = $1", mine); err != nil {
+		return err
+	}
+	if _, err := other.ExecContext(ctx, "UPDATE "+ConflictTable+" SET n = n + 1 WHERE id = $1", theirs); err != nil {
+		return err
+	}
+
+	return other.Commit()
+}
+
+// run executes a statement through uow without MustExec panicking on error.
+func run(uow db.UnitOfWork, query string, args ...interface{}) error {
+	rows, err := uow.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
@@ -0,0 +1,67 @@
+package dbtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type stateError string
+
+func (e stateError) Error() string    { return "pq: " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+func TestShouldRecognizeSerializationFailures(t *testing.T) {
+	assert.True(t, IsSerializationFailure(fmt.Errorf("saving: %w", stateError("40001"))))
+	assert.False(t, IsSerializationFailure(stateError("23505")))
+	assert.False(t, IsSerializationFailure(assert.AnError))
+}
+
+func TestShouldOrchestrateWriteSkewAgainstTheTransaction(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	database := sqlx.NewDb(conn, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS dbtest_conflicts").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO dbtest_conflicts").WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("SET TRANSACTION ISOLATION LEVEL SERIALIZABLE").WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectQuery(`SELECT n FROM dbtest_conflicts WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(0))
+	mock.ExpectQuery(`UPDATE dbtest_conflicts SET n = n \+ 1 WHERE id = \$1`).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT n FROM dbtest_conflicts WHERE id = \$1`).WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(0))
+	mock.ExpectExec(`UPDATE dbtest_conflicts SET n = n \+ 1 WHERE id = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx := database.MustBegin()
+	uow := db.NewUnitOfWork(database, tx)
+
+	assert.NoError(t, ForceSerializationFailure(uow))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type foreignUnitOfWork struct{ db.UnitOfWork }
+
+func TestShouldRefuseUnitOfWorkWithoutDatabase(t *testing.T) {
+	assert.Error(t, ForceSerializationFailure(foreignUnitOfWork{}))
+}
+
+func TestShouldRefuseUnitOfWorkWithoutTransaction(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = ForceSerializationFailure(db.NewUnitOfWork(sqlx.NewDb(conn, "postgres"), nil))
+
+	assert.EqualError(t, err, "dbtest: ForceSerializationFailure needs a transaction open on the unit of work")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
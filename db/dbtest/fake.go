@@ -0,0 +1,381 @@
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// Fake is a db.UnitOfWork for unit tests of code built on the db package,
+// without a database. It runs the real unit of work over an in-memory driver,
+// so that every method behaves as in production, interceptors, savepoints and
+// builders included, while the driver records the statements and answers
+// them with the results stubbed with On. Statements nothing is stubbed for
+// return no rows, and affect none.
+//
+//	fake := dbtest.NewFake("postgres")
+//	fake.On(`^SELECT id, status FROM orders`).Return([]string{"id", "status"}, []interface{}{1, "open"})
+//	fake.On(`^UPDATE orders`).ReturnResult(0, 1)
+//
+//	err := service.Close(fake, 1)
+//
+//	fake.AssertOrder(t, "BEGIN", `^UPDATE orders SET status`, "COMMIT")
+//
+// Transactions show up in the calls as BEGIN, COMMIT and ROLLBACK; nested
+// InTransaction calls as their SAVEPOINT statements.
+type Fake struct {
+	db.UnitOfWork
+
+	database *sqlx.DB
+
+	mu    sync.Mutex
+	calls []Call
+	stubs []*Stub
+}
+
+// Call is a statement run through a Fake, with its arguments as passed.
+type Call struct {
+	Query string
+	Args  []interface{}
+}
+
+// Stub is the answer of a Fake to the statements matching its pattern. Stubs
+// are set up before the code under test runs.
+type Stub struct {
+	pattern *regexp.Regexp
+	columns []string
+	rows    [][]driver.Value
+	result  driver.Result
+	err     error
+	once    bool
+}
+
+// NewFake creates a fake unit of work of driver, e.g. "postgres", which sets
+// the bindvars and the dialect the db package uses, with the options of
+// db.NewUnitOfWork.
+func NewFake(driver string, opts ...db.Option) *Fake {
+	f := &Fake{}
+	f.database = sqlx.NewDb(sql.OpenDB(fakeConnector{f}), driver)
+	f.UnitOfWork = db.NewUnitOfWork(f.database, nil, opts...)
+	return f
+}
+
+// Database returns the database behind the fake, for code opening units of
+// work of its own.
+func (f *Fake) Database() *sqlx.DB {
+	return f.database
+}
+
+// On stubs the statements matching pattern, a regular expression. Stubs
+// are tried in the order they were added; the first matching one answers.
+func (f *Fake) On(pattern string) *Stub {
+	s := &Stub{pattern: regexp.MustCompile(pattern), result: driver.RowsAffected(0)}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stubs = append(f.stubs, s)
+	return s
+}
+
+// Return answers queries with rows of columns.
+func (s *Stub) Return(columns []string, rows ...[]interface{}) *Stub {
+	s.columns = columns
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			panic(fmt.Sprintf("dbtest: row of %d values for %d columns", len(row), len(columns)))
+		}
+
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			value, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				panic(fmt.Sprintf("dbtest: column %s: %v", columns[i], err))
+			}
+			values[i] = value
+		}
+		s.rows = append(s.rows, values)
+	}
+	return s
+}
+
+// ReturnResult answers statements run with Exec with this result.
+func (s *Stub) ReturnResult(lastInsertID, rowsAffected int64) *Stub {
+	s.result = fakeResult{lastInsertID, rowsAffected}
+	return s
+}
+
+// ReturnError fails the statements with err.
+func (s *Stub) ReturnError(err error) *Stub {
+	s.err = err
+	return s
+}
+
+// Once removes the stub once it answered, for statements answered
+// differently on their next run by a later stub.
+func (s *Stub) Once() *Stub {
+	s.once = true
+	return s
+}
+
+// TestingT is the part of *testing.T the assertions of a Fake use.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+func helper(t TestingT) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+}
+
+// Calls returns the statements run so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallsTo returns the statements run so far matching pattern.
+func (f *Fake) CallsTo(pattern string) []Call {
+	re := regexp.MustCompile(pattern)
+
+	var calls []Call
+	for _, c := range f.Calls() {
+		if re.MatchString(c.Query) {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the calls and the stubs.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls, f.stubs = nil, nil
+}
+
+// AssertOrder checks that statements matching patterns ran in this order,
+// others possibly running in between.
+func (f *Fake) AssertOrder(t TestingT, patterns ...string) bool {
+	helper(t)
+
+	calls := f.Calls()
+	next := 0
+	for _, pattern := range patterns {
+		re := regexp.MustCompile(pattern)
+		for next < len(calls) && !re.MatchString(calls[next].Query) {
+			next++
+		}
+		if next == len(calls) {
+			t.Errorf("dbtest: no statement matching %q in order %q, calls:\n%s", pattern, patterns, formatCalls(calls))
+			return false
+		}
+		next++
+	}
+	return true
+}
+
+// AssertCommitted checks that the last transaction committed.
+func (f *Fake) AssertCommitted(t TestingT) bool {
+	helper(t)
+	return f.assertEnded(t, "COMMIT")
+}
+
+// AssertRolledBack checks that the last transaction rolled back.
+func (f *Fake) AssertRolledBack(t TestingT) bool {
+	helper(t)
+	return f.assertEnded(t, "ROLLBACK")
+}
+
+func (f *Fake) assertEnded(t TestingT, end string) bool {
+	helper(t)
+
+	calls := f.Calls()
+	for i := len(calls) - 1; i >= 0; i-- {
+		switch calls[i].Query {
+		case end:
+			return true
+		case "COMMIT", "ROLLBACK":
+			t.Errorf("dbtest: last transaction ended with %s, not %s", calls[i].Query, end)
+			return false
+		}
+	}
+	t.Errorf("dbtest: no transaction ended with %s, calls:\n%s", end, formatCalls(calls))
+	return false
+}
+
+func formatCalls(calls []Call) string {
+	s := ""
+	for _, c := range calls {
+		s += fmt.Sprintf("\t%s %v\n", c.Query, c.Args)
+	}
+	return s
+}
+
+// record adds a call and returns the stub answering it, if any.
+func (f *Fake) record(query string, args []driver.NamedValue) *Stub {
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, Call{Query: query, Args: values})
+	for i, s := range f.stubs {
+		if s.pattern.MatchString(query) {
+			if s.once {
+				f.stubs = append(f.stubs[:i:i], f.stubs[i+1:]...)
+			}
+			return s
+		}
+	}
+	return nil
+}
+
+type fakeConnector struct{ fake *Fake }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{fake: c.fake}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("dbtest: the fake driver is opened through NewFake")
+}
+
+type fakeConn struct{ fake *Fake }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if s := c.fake.record("BEGIN", nil); s != nil && s.err != nil {
+		return nil, s.err
+	}
+	return fakeTx{c.fake}, nil
+}
+
+// CheckNamedValue keeps arguments as passed, for Calls.
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := c.fake.record(query, args)
+	switch {
+	case s == nil:
+		return driver.RowsAffected(0), nil
+	case s.err != nil:
+		return nil, s.err
+	}
+	return s.result, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := c.fake.record(query, args)
+	switch {
+	case s == nil:
+		return &fakeRows{}, nil
+	case s.err != nil:
+		return nil, s.err
+	}
+	return &fakeRows{columns: s.columns, rows: s.rows}, nil
+}
+
+type fakeTx struct{ fake *Fake }
+
+func (tx fakeTx) Commit() error {
+	if s := tx.fake.record("COMMIT", nil); s != nil {
+		return s.err
+	}
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	if s := tx.fake.record("ROLLBACK", nil); s != nil {
+		return s.err
+	}
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func named(args []driver.Value) []driver.NamedValue {
+	values := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return values
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next == len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+type fakeResult struct{ lastInsertID, rowsAffected int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
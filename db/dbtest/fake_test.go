@@ -0,0 +1,82 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOrder struct {
+	ID     int64  `db:"id"`
+	Status string `db:"status"`
+}
+
+func TestShouldAnswerQueriesWithStubbedRows(t *testing.T) {
+	fake := NewFake("postgres")
+	fake.On(`^SELECT id, status FROM orders WHERE status = \$1$`).
+		Return([]string{"id", "status"}, []interface{}{1, "open"}, []interface{}{2, "open"})
+
+	var orders []fakeOrder
+	err := fake.Select(&orders, fake.Rebind("SELECT id, status FROM orders WHERE status = ?"), "open")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []fakeOrder{{1, "open"}, {2, "open"}}, orders)
+	assert.Equal(t, []Call{{Query: "SELECT id, status FROM orders WHERE status = $1", Args: []interface{}{"open"}}}, fake.Calls())
+
+	var missing fakeOrder
+	assert.Equal(t, "sql: no rows in result set", fake.Get(&missing, "SELECT id, status FROM orders WHERE id = $1", 9).Error())
+}
+
+func TestShouldRecordTransactionsInOrder(t *testing.T) {
+	fake := NewFake("sqlmock")
+	fake.On(`^UPDATE orders`).ReturnResult(0, 1)
+
+	_, err := fake.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		if _, err := tx.Update("orders").Set("status", "paid").Where("id = ?", 1).Exec(); err != nil {
+			return nil, err
+		}
+		_, err := tx.Exec("INSERT INTO events (order_id) VALUES (?)", 1)
+		return nil, err
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, fake.AssertOrder(t, "^BEGIN$", "^UPDATE orders SET status = \\? WHERE id = \\?$", "^INSERT INTO events", "^COMMIT$"))
+	assert.True(t, fake.AssertCommitted(t))
+	assert.Equal(t, []interface{}{"paid", 1}, fake.CallsTo("^UPDATE")[0].Args)
+}
+
+func TestShouldFailStubbedStatements(t *testing.T) {
+	fake := NewFake("sqlmock")
+	fake.On(`^INSERT INTO events`).Once().ReturnError(errors.New("duplicate key"))
+
+	_, err := fake.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		return tx.Exec("INSERT INTO events (order_id) VALUES (?)", 1)
+	})
+	assert.EqualError(t, err, "duplicate key")
+	assert.True(t, fake.AssertRolledBack(t))
+
+	_, err = fake.Exec("INSERT INTO events (order_id) VALUES (?)", 1)
+	assert.Nil(t, err)
+	assert.Len(t, fake.CallsTo("^INSERT"), 2)
+}
+
+type recordingT struct{ errors []string }
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestShouldReportMissingStatementsInOrder(t *testing.T) {
+	fake := NewFake("sqlmock")
+	fake.Exec("DELETE FROM sessions")
+
+	recorder := &recordingT{}
+	assert.False(t, fake.AssertOrder(recorder, "^BEGIN$", "^DELETE"))
+	assert.Equal(t, []string{"dbtest: no statement matching \"^BEGIN$\" in order [\"^BEGIN$\" \"^DELETE\"], calls:\n\tDELETE FROM sessions []\n"}, recorder.errors)
+
+	fake.Reset()
+	assert.Empty(t, fake.Calls())
+}
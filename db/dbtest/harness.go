@@ -0,0 +1,183 @@
+package dbtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// HarnessOptions configures NewHarness.
+type HarnessOptions struct {
+	// Schema statements run first, e.g. CREATE TABLE, inside the transaction
+	// of the test: databases without transactional DDL, such as MySQL, keep
+	// them.
+	Schema []string
+
+	// Fixtures are inserted once the schema exists, in order.
+	Fixtures []Fixture
+
+	// Seed rows are inserted after the fixtures, see Seed.
+	Seed []interface{}
+
+	// UnitOfWork options of the unit of work returned.
+	Options []db.Option
+}
+
+// Fixture is rows of a table inserted before a test, each a map of columns to
+// values.
+type Fixture struct {
+	Table string
+	Rows  []map[string]interface{}
+}
+
+// NewHarness returns a unit of work for an integration-style test of code
+// built on the db package, over a transaction of database rolled back when
+// the test ends, so that tests share a database without seeing each other's
+// writes. The schema, fixtures and seed rows of opts are set up in the
+// transaction first. database is typically an in-memory SQLite, opened with
+// the driver of your choice and a single connection:
+//
+//	database := sqlx.MustOpen("sqlite", ":memory:")
+//	database.SetMaxOpenConns(1)
+//
+//	uow := dbtest.NewHarness(t, database, dbtest.HarnessOptions{
+//		Schema:   []string{"CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)"},
+//		Fixtures: []dbtest.Fixture{{Table: "orders", Rows: []map[string]interface{}{{"id": 1, "status": "open"}}}},
+//	})
+//
+// InTransaction calls of the code under test run in savepoints of the test
+// transaction; it must not call Commit or Rollback itself.
+func NewHarness(t testing.TB, database *sqlx.DB, opts HarnessOptions) db.UnitOfWork {
+	t.Helper()
+
+	tx, err := database.BeginTxx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("dbtest: beginning the test transaction: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("dbtest: rolling back the test transaction: %v", err)
+		}
+	})
+
+	uow := db.NewUnitOfWork(database, tx, opts.Options...)
+	for _, statement := range opts.Schema {
+		if _, err := uow.Exec(statement); err != nil {
+			t.Fatalf("dbtest: schema: %v", err)
+		}
+	}
+	if err := Load(uow, opts.Fixtures...); err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	if err := Seed(uow, opts.Seed...); err != nil {
+		t.Fatal(err)
+	}
+	return uow
+}
+
+// Load inserts the rows of fixtures through uow, one statement per row.
+func Load(uow db.UnitOfWork, fixtures ...Fixture) error {
+	for _, fixture := range fixtures {
+		for i, row := range fixture.Rows {
+			if _, err := uow.Insert(fixture.Table).SetMap(row).Exec(); err != nil {
+				return fmt.Errorf("fixture %s row %d: %w", fixture.Table, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// FixturesFrom reads the fixtures of the JSON files of fsys matching
+// patterns, in name order, e.g. from an embed.FS of testdata. Every file maps
+// tables to their rows, its tables being loaded in name order:
+//
+//	{"customers": [{"id": 1, "name": "ada"}], "orders": [{"id": 7, "customer_id": 1}]}
+//
+// Whole numbers are read as int64, other numbers as float64.
+func FixturesFrom(fsys fs.FS, patterns ...string) ([]Fixture, error) {
+	var names []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, matches...)
+	}
+	sort.Strings(names)
+
+	var fixtures []Fixture
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var tables map[string][]map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tables); err != nil {
+			return nil, fmt.Errorf("dbtest: fixtures %s: %w", name, err)
+		}
+
+		order := make([]string, 0, len(tables))
+		for table := range tables {
+			order = append(order, table)
+		}
+		sort.Strings(order)
+
+		for _, table := range order {
+			rows := tables[table]
+			for _, row := range rows {
+				for column, value := range row {
+					row[column] = fixtureValue(value)
+				}
+			}
+			fixtures = append(fixtures, Fixture{Table: table, Rows: rows})
+		}
+	}
+	return fixtures, nil
+}
+
+// fixtureValue turns the numbers of decoded JSON into int64 or float64.
+func fixtureValue(value interface{}) interface{} {
+	n, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if !strings.ContainsAny(n.String(), ".eE") {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// NewMock returns a unit of work of driver, e.g. "postgres", over a
+// go-sqlmock database, and the mock to set expectations on. Unmet
+// expectations fail the test when it ends.
+func NewMock(t testing.TB, driver string, opts ...db.Option) (db.UnitOfWork, sqlmock.Sqlmock) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("dbtest: %v", err)
+		}
+		conn.Close()
+	})
+
+	return db.NewUnitOfWork(sqlx.NewDb(conn, driver), nil, opts...), mock
+}
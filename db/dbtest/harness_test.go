@@ -0,0 +1,69 @@
+package dbtest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSetUpHarnessInATransactionRolledBackAfterTheTest(t *testing.T) {
+	fake := NewFake("sqlmock")
+
+	t.Run("repository test", func(t *testing.T) {
+		uow := NewHarness(t, fake.Database(), HarnessOptions{
+			Schema: []string{"CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)"},
+			Fixtures: []Fixture{{Table: "orders", Rows: []map[string]interface{}{
+				{"id": 1, "status": "open"},
+				{"id": 2, "status": "paid"},
+			}}},
+		})
+
+		_, err := uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+			return tx.Exec("UPDATE orders SET status = ? WHERE id = ?", "paid", 1)
+		})
+		assert.Nil(t, err)
+	})
+
+	assert.Equal(t, []Call{
+		{Query: "BEGIN", Args: []interface{}{}},
+		{Query: "CREATE TABLE orders (id INTEGER PRIMARY KEY, status TEXT)", Args: []interface{}{}},
+		{Query: "INSERT INTO orders (id, status) VALUES (?, ?)", Args: []interface{}{1, "open"}},
+		{Query: "INSERT INTO orders (id, status) VALUES (?, ?)", Args: []interface{}{2, "paid"}},
+		{Query: "SAVEPOINT sp_1", Args: []interface{}{}},
+		{Query: "UPDATE orders SET status = ? WHERE id = ?", Args: []interface{}{"paid", 1}},
+		{Query: "RELEASE SAVEPOINT sp_1", Args: []interface{}{}},
+		{Query: "ROLLBACK", Args: []interface{}{}},
+	}, fake.Calls())
+}
+
+func TestShouldReadFixturesFromJSONFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"testdata/02_orders.json":    {Data: []byte(`{"orders": [{"id": 7, "customer_id": 1, "total": 10.5}]}`)},
+		"testdata/01_customers.json": {Data: []byte(`{"customers": [{"id": 1, "name": "ada", "vip": true}], "addresses": []}`)},
+		"testdata/readme.txt":        {Data: []byte("not fixtures")},
+	}
+
+	fixtures, err := FixturesFrom(fsys, "testdata/*.json")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Fixture{
+		{Table: "addresses", Rows: []map[string]interface{}{}},
+		{Table: "customers", Rows: []map[string]interface{}{{"id": int64(1), "name": "ada", "vip": true}}},
+		{Table: "orders", Rows: []map[string]interface{}{{"id": int64(7), "customer_id": int64(1), "total": 10.5}}},
+	}, fixtures)
+
+	fsys["testdata/03_broken.json"] = &fstest.MapFile{Data: []byte(`[1, 2]`)}
+	_, err = FixturesFrom(fsys, "testdata/*.json")
+	assert.ErrorContains(t, err, "dbtest: fixtures testdata/03_broken.json:")
+}
+
+func TestShouldMockUnitsOfWork(t *testing.T) {
+	uow, mock := NewMock(t, "postgres")
+	mock.ExpectExec(`^DELETE FROM sessions WHERE id = \$1$`).WithArgs(3).WillReturnError(assert.AnError)
+
+	_, err := uow.Delete("sessions").Where("id = ?", 3).Exec()
+
+	assert.Equal(t, assert.AnError, err)
+}
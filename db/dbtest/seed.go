@@ -0,0 +1,90 @@
+package dbtest
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+// Seed inserts rows, values of or pointers to registered models, or slices of
+// them, through uow:
+//
+//	err := dbtest.Seed(uow,
+//		Order{ID: 7, CustomerID: 1, Status: "open"},
+//		[]Customer{{ID: 1, Name: "ada"}, {ID: 2, Name: "bob"}},
+//	)
+//
+// Tables are inserted so that every table follows those it references with
+// the ref tag option, here customers before orders; rows of a table keep
+// their order, so rows referencing others of their table must follow them.
+// Protected models are sealed on the way.
+func Seed(uow db.UnitOfWork, rows ...interface{}) error {
+	var tables []string
+	seeded := map[string]*seededTable{}
+
+	for _, row := range flattenRows(rows) {
+		model, err := db.ModelOf(row)
+		if err != nil {
+			return fmt.Errorf("dbtest: seeding %T: %w", row, err)
+		}
+
+		if v := reflect.ValueOf(row); v.Kind() == reflect.Ptr && v.IsNil() {
+			return fmt.Errorf("dbtest: cannot seed a nil %T", row)
+		}
+		entity := reflect.New(model.Type)
+		entity.Elem().Set(reflect.Indirect(reflect.ValueOf(row)))
+		if err := model.Seal(entity.Interface()); err != nil {
+			return fmt.Errorf("dbtest: seeding %s: %w", model.Table, err)
+		}
+
+		values := make(map[string]interface{}, len(model.Columns))
+		for _, column := range model.Columns {
+			values[column] = model.ValueOf(entity.Interface(), column)
+		}
+
+		table, ok := seeded[model.Table]
+		if !ok {
+			table = &seededTable{model: model}
+			seeded[model.Table] = table
+			tables = append(tables, model.Table)
+		}
+		table.rows = append(table.rows, values)
+	}
+
+	models := make([]*db.Model, len(tables))
+	for i, table := range tables {
+		models[i] = seeded[table].model
+	}
+	ordered, err := db.ReferenceOrder(models)
+	if err != nil {
+		return fmt.Errorf("dbtest: cannot seed: %w", err)
+	}
+
+	fixtures := make([]Fixture, len(ordered))
+	for i, model := range ordered {
+		fixtures[i] = Fixture{Table: model.Table, Rows: seeded[model.Table].rows}
+	}
+	return Load(uow, fixtures...)
+}
+
+type seededTable struct {
+	model *db.Model
+	rows  []map[string]interface{}
+}
+
+// flattenRows expands the slices among rows into their elements.
+func flattenRows(rows []interface{}) []interface{} {
+	var flat []interface{}
+	for _, row := range rows {
+		v := reflect.ValueOf(row)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			flat = append(flat, row)
+			continue
+		}
+		for i := 0; i < v.Len(); i++ {
+			flat = append(flat, v.Index(i).Interface())
+		}
+	}
+	return flat
+}
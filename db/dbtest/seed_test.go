@@ -0,0 +1,50 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/stretchr/testify/assert"
+)
+
+type seedCustomer struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type seedOrder struct {
+	ID         int64  `db:"id"`
+	CustomerID int64  `db:"customer_id,ref=seed_customers"`
+	Status     string `db:"status"`
+}
+
+func init() {
+	db.MustRegister(seedCustomer{}, "seed_customers")
+	db.MustRegister(seedOrder{}, "seed_orders")
+}
+
+func TestShouldSeedModelsInReferenceOrder(t *testing.T) {
+	fake := NewFake("sqlmock")
+	uow := db.NewUnitOfWork(fake.Database(), nil)
+
+	err := Seed(uow,
+		seedOrder{ID: 7, CustomerID: 1, Status: "open"},
+		[]seedCustomer{{ID: 1, Name: "ada"}, {ID: 2, Name: "bob"}},
+		&seedOrder{ID: 8, CustomerID: 2, Status: "paid"},
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Call{
+		{Query: "INSERT INTO seed_customers (id, name) VALUES (?, ?)", Args: []interface{}{int64(1), "ada"}},
+		{Query: "INSERT INTO seed_customers (id, name) VALUES (?, ?)", Args: []interface{}{int64(2), "bob"}},
+		{Query: "INSERT INTO seed_orders (customer_id, id, status) VALUES (?, ?, ?)", Args: []interface{}{int64(1), int64(7), "open"}},
+		{Query: "INSERT INTO seed_orders (customer_id, id, status) VALUES (?, ?, ?)", Args: []interface{}{int64(2), int64(8), "paid"}},
+	}, fake.Calls())
+}
+
+func TestShouldRefuseToSeedUnregisteredRows(t *testing.T) {
+	uow := db.NewUnitOfWork(NewFake("sqlmock").Database(), nil)
+
+	assert.EqualError(t, Seed(uow, struct{ ID int64 }{ID: 1}), "dbtest: seeding struct { ID int64 }: db: struct { ID int64 } is not registered")
+	assert.EqualError(t, Seed(uow, (*seedOrder)(nil)), "dbtest: cannot seed a nil *dbtest.seedOrder")
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithDeadlinePropagation passes the time left before the deadline of the
+// context of every statement on to the server, so that it stops working on
+// statements the client gave up on rather than only the driver:
+//
+//   - on Postgres, statements in a transaction are preceded by SET LOCAL
+//     statement_timeout, reset to its default for later statements of the
+//     transaction without a deadline. Outside transactions statements run
+//     on any connection of the pool and are left alone.
+//   - on MySQL, SELECT statements get a MAX_EXECUTION_TIME optimizer hint,
+//     the only statements it applies to.
+//
+// Deadlines set by interceptors, such as a TimeoutInterceptor, are only seen
+// by interceptors installed after them, so give this option last.
+func WithDeadlinePropagation() Option {
+	return func(u *unitOfWork) {
+		// the transaction whose statement_timeout was set, to reset it
+		var timed *sqlx.Tx
+
+		u.interceptors = append(u.interceptors, func(ctx context.Context, stmt *Statement, next Handler) error {
+			deadline, ok := ctx.Deadline()
+			remaining := time.Until(deadline)
+			if ok && remaining <= 0 {
+				return next(ctx, stmt)
+			}
+
+			switch DialectFor(stmt.Driver) {
+			case DialectPostgres:
+				tx := u.currentTx()
+				if !stmt.InTx || tx == nil {
+					break
+				}
+				setting := "DEFAULT"
+				if ok {
+					setting = fmt.Sprint(serverMilliseconds(remaining))
+				} else if timed != tx {
+					break
+				}
+
+				if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = "+setting); err != nil {
+					return err
+				}
+				timed = nil
+				if ok {
+					timed = tx
+				}
+
+			case DialectMySQL:
+				if !ok || !startsWithSelect(stmt.Query) {
+					break
+				}
+				hint := Hint{Comment: fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */", serverMilliseconds(remaining)), Placement: HintAfterVerb}
+				query, err := applyHints(DialectMySQL, stmt.Query, []Hint{hint})
+				if err != nil {
+					return err
+				}
+				stmt.Query = query
+			}
+			return next(ctx, stmt)
+		})
+	}
+}
+
+// serverMilliseconds rounds d up to whole milliseconds, at least one since
+// servers read zero as no timeout.
+func serverMilliseconds(d time.Duration) int64 {
+	ms := int64((d + time.Millisecond - 1) / time.Millisecond)
+	if ms < 1 {
+		return 1
+	}
+	return ms
+}
+
+// startsWithSelect reports whether the first keyword of query is SELECT, where
+// MySQL expects optimizer hints, as opposed to a WITH clause.
+func startsWithSelect(query string) bool {
+	tokens := lexSQL(query)
+	return len(tokens) > 0 && tokens[0].is("select")
+}
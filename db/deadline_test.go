@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSetStatementTimeoutOfTransactionsFromDeadline(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec(`^UPDATE orders SET status = 'seen'$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^SET LOCAL statement_timeout = \d+$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^UPDATE orders SET status = 'paid'$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^SET LOCAL statement_timeout = DEFAULT$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO payments`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO receipts`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	uow := NewUnitOfWork(database, nil, WithDeadlinePropagation())
+
+	_, err := uow.ExecContext(ctx, "UPDATE orders SET status = 'seen'")
+	assert.Nil(t, err)
+	_, err = uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		if _, err := tx.ExecContext(ctx, "UPDATE orders SET status = 'paid'"); err != nil {
+			return nil, err
+		}
+		tx.MustExec("INSERT INTO payments (order_id) VALUES (1)")
+		tx.MustExec("INSERT INTO receipts (order_id) VALUES (1)")
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldHintMaxExecutionTimeOfSelectsOnMySQL(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	mock.ExpectQuery(`^SELECT /\*\+ MAX_EXECUTION_TIME\(\d+\) \*/ \* FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+	mock.ExpectExec(`^UPDATE orders SET status = 'paid'$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT \* FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "paid"))
+
+	uow := NewUnitOfWork(database, nil,
+		WithInterceptors(TimeoutInterceptor(TimeoutConfig{Labels: map[string]time.Duration{"orders.list": time.Second}})),
+		WithDeadlinePropagation())
+	labelled := WithLabel(context.Background(), "orders.list")
+
+	var orders []repositoryOrder
+	assert.Nil(t, uow.SelectContext(labelled, &orders, "SELECT * FROM orders"))
+	_, err := uow.ExecContext(labelled, "UPDATE orders SET status = 'paid'")
+	assert.Nil(t, err)
+	assert.Nil(t, uow.Select(&orders, "SELECT * FROM orders"))
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRoundServerTimeoutsUpToAMillisecond(t *testing.T) {
+	assert.Equal(t, int64(1), serverMilliseconds(time.Microsecond))
+	assert.Equal(t, int64(1500), serverMilliseconds(1499*time.Millisecond+time.Microsecond))
+	assert.Equal(t, int64(2000), serverMilliseconds(2*time.Second))
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DegradedError is returned for a labelled statement that failed in a way its
+// DegradationPolicy covers when the policy has nothing to serve instead.
+type DegradedError struct {
+	Label string
+	Err   error
+}
+
+func (e *DegradedError) Error() string {
+	return fmt.Sprintf("db: %s degraded: %v", e.Label, e.Err)
+}
+
+func (e *DegradedError) Unwrap() error {
+	return e.Err
+}
+
+// DegradationPolicy tells what a Get or Select with a label serves when the
+// database fails it. Other statements only get a DegradedError.
+type DegradationPolicy struct {
+	// StaleFor keeps the result of every successful statement for this long
+	// and serves the last one read with the same query, arguments and tenant,
+	// as rewritten by the interceptors that follow. Results are kept JSON
+	// encoded, so destinations must round-trip through JSON.
+	StaleFor time.Duration
+
+	// StaleEntries bounds the results kept for the label. Zero means 1000.
+	StaleEntries int
+
+	// Default, when not nil, is assigned to the destination when no stale
+	// result is available. It must be of the type Dest points to.
+	Default interface{}
+}
+
+// DegradationConfig assigns degradation policies to labels, see WithLabel.
+type DegradationConfig struct {
+	Labels map[string]DegradationPolicy
+
+	// Trigger reports whether err is a failure to degrade on. Zero means
+	// timeouts: deadlines exceeded, Postgres query_canceled and network
+	// timeouts. Set it to also match the errors of a circuit breaker.
+	Trigger func(err error) bool
+
+	// OnDegrade, when set, is called for every degraded statement, e.g. to
+	// count them; stale reports whether a stale result was served.
+	OnDegrade func(label string, err error, stale bool)
+}
+
+// DegradationInterceptor applies config to the statements of the labels it
+// lists, so each feature defines what the database being slow means for it.
+// It must come before interceptors whose failures it should handle, such as
+// a TimeoutInterceptor.
+func DegradationInterceptor(config DegradationConfig) Interceptor {
+	if config.Trigger == nil {
+		config.Trigger = isTimeout
+	}
+
+	caches := map[string]*staleCache{}
+	for label, policy := range config.Labels {
+		if policy.StaleFor > 0 {
+			if policy.StaleEntries <= 0 {
+				policy.StaleEntries = 1000
+			}
+			caches[label] = &staleCache{entries: map[string]staleEntry{}, max: policy.StaleEntries}
+		}
+	}
+
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		policy, ok := config.Labels[stmt.Label]
+		if !ok || stmt.Label == "" {
+			return next(ctx, stmt)
+		}
+
+		cache := caches[stmt.Label]
+		readsInto := stmt.Kind == KindGet || stmt.Kind == KindSelect
+
+		err := next(ctx, stmt)
+		key := staleKey(ctx, stmt)
+		if err == nil {
+			if cache != nil && readsInto {
+				cache.store(key, stmt.Dest, policy.StaleFor)
+			}
+			return nil
+		}
+		if !config.Trigger(err) {
+			return err
+		}
+
+		stale := false
+		served := false
+		if readsInto {
+			if cache != nil {
+				stale = cache.load(key, stmt.Dest)
+				served = stale
+			}
+			if !served && policy.Default != nil {
+				served = assignDefault(stmt.Dest, policy.Default)
+			}
+		}
+
+		if config.OnDegrade != nil {
+			config.OnDegrade(stmt.Label, err, stale)
+		}
+		if served {
+			return nil
+		}
+		return &DegradedError{Label: stmt.Label, Err: err}
+	}
+}
+
+// staleKey identifies the results of stmt in a stale cache. It is built once
+// the statement went through the interceptors after this one, which may have
+// rewritten it, e.g. to scope it to a tenant, and includes the tenant of ctx
+// besides, so that no tenant is served the results of another.
+func staleKey(ctx context.Context, stmt *Statement) string {
+	tenant, _ := TenantFrom(ctx)
+	return fmt.Sprintf("%v\x00%s %v", tenant, stmt.Query, stmt.Args)
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && state.SQLState() == "57014" {
+		return true
+	}
+
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+func assignDefault(dest, value interface{}) bool {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return false
+	}
+
+	v := reflect.ValueOf(value)
+	if !v.Type().AssignableTo(target.Elem().Type()) {
+		return false
+	}
+	target.Elem().Set(v)
+	return true
+}
+
+type staleEntry struct {
+	data    []byte
+	expires time.Time
+}
+
+type staleCache struct {
+	mu      sync.Mutex
+	entries map[string]staleEntry
+	max     int
+}
+
+func (c *staleCache) store(key string, dest interface{}, ttl time.Duration) {
+	data, err := json.Marshal(dest)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.max {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		// still full: make room at random, map order being unspecified
+		for k := range c.entries {
+			if len(c.entries) < c.max {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = staleEntry{data: data, expires: now.Add(ttl)}
+}
+
+func (c *staleCache) load(key string, dest interface{}) bool {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		return false
+	}
+	return json.Unmarshal(entry.data, dest) == nil
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func degradingUnitOfWork(t *testing.T, label string, config DegradationConfig) (UnitOfWork, sqlmock.Sqlmock) {
+	database, mock := newMockDatabase(t, "postgres")
+	ctx := WithLabel(context.Background(), label)
+	return NewUnitOfWork(database, nil, WithContext(ctx), WithInterceptors(DegradationInterceptor(config))), mock
+}
+
+func TestShouldServeStaleResultOnTimeout(t *testing.T) {
+	var degraded []string
+	uow, mock := degradingUnitOfWork(t, "catalog.featured", DegradationConfig{
+		Labels: map[string]DegradationPolicy{"catalog.featured": {StaleFor: time.Minute}},
+		OnDegrade: func(label string, err error, stale bool) {
+			degraded = append(degraded, label)
+			assert.True(t, stale)
+		},
+	})
+	mock.ExpectQuery("SELECT name FROM products").WithArgs(true).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("lamp").AddRow("desk"))
+	mock.ExpectQuery("SELECT name FROM products").WithArgs(true).WillReturnError(context.DeadlineExceeded)
+
+	var fresh, stale []string
+	assert.Nil(t, uow.Select(&fresh, "SELECT name FROM products WHERE featured = $1", true))
+	assert.Nil(t, uow.Select(&stale, "SELECT name FROM products WHERE featured = $1", true))
+
+	assert.Equal(t, []string{"lamp", "desk"}, stale)
+	assert.Equal(t, []string{"catalog.featured"}, degraded)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldServeDefaultWithoutStaleResult(t *testing.T) {
+	uow, mock := degradingUnitOfWork(t, "cart.count", DegradationConfig{
+		Labels: map[string]DegradationPolicy{"cart.count": {StaleFor: time.Minute, Default: int64(0)}},
+	})
+	mock.ExpectQuery("SELECT count").WillReturnError(&pq.Error{Code: "57014"})
+
+	count := int64(7)
+	assert.Nil(t, uow.Get(&count, "SELECT count(*) FROM cart_items"))
+	assert.Equal(t, int64(0), count)
+}
+
+func TestShouldReturnDegradedErrorWhenNothingToServe(t *testing.T) {
+	uow, mock := degradingUnitOfWork(t, "checkout.submit", DegradationConfig{
+		Labels: map[string]DegradationPolicy{"checkout.submit": {}},
+	})
+	mock.ExpectExec("INSERT INTO orders").WillReturnError(context.DeadlineExceeded)
+
+	_, err := uow.MustNamedExec("INSERT INTO orders (id) VALUES (:id)", map[string]interface{}{"id": 1}).RowsAffected()
+
+	var degraded *DegradedError
+	assert.True(t, errors.As(err, &degraded))
+	assert.Equal(t, "checkout.submit", degraded.Label)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestShouldNotDegradeOtherFailuresOrLabels(t *testing.T) {
+	errOpen := errors.New("breaker open")
+	uow, mock := degradingUnitOfWork(t, "search", DegradationConfig{
+		Labels:  map[string]DegradationPolicy{"search": {Default: []string{}}},
+		Trigger: func(err error) bool { return errors.Is(err, errOpen) },
+	})
+	mock.ExpectQuery("SELECT name").WillReturnError(context.DeadlineExceeded)
+	mock.ExpectQuery("SELECT name").WillReturnError(errOpen)
+
+	var names []string
+	assert.Equal(t, context.DeadlineExceeded, uow.Select(&names, "SELECT name FROM products"))
+	assert.Nil(t, uow.Select(&names, "SELECT name FROM products"))
+	assert.Equal(t, []string{}, names)
+}
+
+func TestShouldNotServeStaleResultsAcrossTenants(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	uow := NewUnitOfWork(database, nil, WithInterceptors(
+		DegradationInterceptor(DegradationConfig{Labels: map[string]DegradationPolicy{"orders.list": {StaleFor: time.Minute}}}),
+		TenancyInterceptor(TenancyConfig{Column: "tenant_id", Tables: []string{"orders"}})))
+	mock.ExpectQuery(`^SELECT id FROM orders WHERE tenant_id = \$1$`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectQuery(`^SELECT id FROM orders WHERE tenant_id = \$1$`).WithArgs(2).WillReturnError(context.DeadlineExceeded)
+	mock.ExpectQuery(`^SELECT id FROM orders WHERE tenant_id = \$1$`).WithArgs(1).WillReturnError(context.DeadlineExceeded)
+
+	acme := WithLabel(WithTenant(context.Background(), 1), "orders.list")
+	globex := WithLabel(WithTenant(context.Background(), 2), "orders.list")
+
+	var ids []int64
+	assert.Nil(t, uow.SelectContext(acme, &ids, "SELECT id FROM orders"))
+
+	var leaked []int64
+	var degraded *DegradedError
+	assert.True(t, errors.As(uow.SelectContext(globex, &leaked, "SELECT id FROM orders"), &degraded))
+	assert.Empty(t, leaked)
+
+	var stale []int64
+	assert.Nil(t, uow.SelectContext(acme, &stale, "SELECT id FROM orders"))
+	assert.Equal(t, []int64{10}, stale)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"strings"
+)
+
+// Dialect identifies the SQL flavour spoken by a driver.
+type Dialect string
+
+// Dialects recognised by DialectFor. DialectANSI is used for unknown drivers.
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+	DialectSQLite   Dialect = "sqlite"
+	DialectANSI     Dialect = "ansi"
+)
+
+// DialectFor maps a database/sql driver name onto its dialect.
+func DialectFor(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx", "pq-timeouts", "cloudsqlpostgres", "nrpostgres":
+		return DialectPostgres
+	case "mysql", "nrmysql":
+		return DialectMySQL
+	case "sqlite3", "sqlite", "nrsqlite3":
+		return DialectSQLite
+	default:
+		return DialectANSI
+	}
+}
+
+// DialectOf returns the dialect of the driver behind uow.
+func DialectOf(uow UnitOfWork) Dialect {
+	return DialectFor(uow.DriverName())
+}
+
+// Quote quotes a possibly schema-qualified identifier ("public.orders") so it
+// can be embedded in a statement verbatim, escaping embedded quote characters.
+func (d Dialect) Quote(identifier string) string {
+	quote := `"`
+	if d == DialectMySQL {
+		quote = "`"
+	}
+
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+
+	return strings.Join(parts, ".")
+}
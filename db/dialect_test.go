@@ -0,0 +1,20 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldResolveDialectFromDriverName(t *testing.T) {
+	assert.Equal(t, DialectPostgres, DialectFor("pgx"))
+	assert.Equal(t, DialectMySQL, DialectFor("mysql"))
+	assert.Equal(t, DialectSQLite, DialectFor("sqlite3"))
+	assert.Equal(t, DialectANSI, DialectFor("sqlmock"))
+}
+
+func TestShouldQuoteIdentifiers(t *testing.T) {
+	assert.Equal(t, `"public"."orders"`, DialectPostgres.Quote("public.orders"))
+	assert.Equal(t, "`order`", DialectMySQL.Quote("order"))
+	assert.Equal(t, `"we""ird"`, DialectSQLite.Quote(`we"ird`))
+}
@@ -0,0 +1,356 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrMirrorQueueFull is the error of a MirrorFailure for writes that could not
+// be queued because the secondary fell too far behind.
+var ErrMirrorQueueFull = errors.New("db: dual-write queue full")
+
+// DualWriteConfig configures a DualWriter.
+type DualWriteConfig struct {
+	// Secondary receives the mirrored writes. Statements are translated to
+	// its placeholder style but otherwise sent as written, so both databases
+	// must understand the same SQL.
+	Secondary *sqlx.DB
+
+	// Tables whose writes are mirrored, and whose reads are shadowed.
+	Tables []string
+
+	// QueueSize bounds the writes waiting to be mirrored. Zero means 1024.
+	QueueSize int
+
+	// FailureQueueSize bounds the failures waiting to be consumed from
+	// Failures; further failures are logged and dropped. Zero means 1024.
+	FailureQueueSize int
+
+	// ShadowReads also runs Get and Select statements on the registered
+	// tables made outside transactions against the secondary, in the
+	// background, logging results that differ from the primary's.
+	ShadowReads bool
+
+	// ShadowTimeout bounds each shadow read. Zero means 5 seconds.
+	ShadowTimeout time.Duration
+
+	// ShadowConcurrency bounds the shadow reads running at once; reads made
+	// while that many are running are not shadowed. Zero means 8.
+	ShadowConcurrency int
+}
+
+// MirroredStatement is a write to be replayed on the secondary, already
+// translated to its placeholders.
+type MirroredStatement struct {
+	Query string
+	Args  []interface{}
+}
+
+// MirrorFailure holds writes that did not reach the secondary: a single
+// statement, or every write of a primary transaction, mirrored together.
+type MirrorFailure struct {
+	Statements []MirroredStatement
+	Err        error
+}
+
+// DualWriter mirrors writes to a secondary database during blue/green
+// migrations. Install it on unit of works with WithDualWrite and run it with
+// Run; writes are mirrored asynchronously and never fail or slow down the
+// primary.
+type DualWriter struct {
+	config DualWriteConfig
+	tables map[string]bool
+
+	queue    chan []MirroredStatement
+	failures chan MirrorFailure
+	shadows  chan struct{}
+
+	mismatches     int64
+	droppedShadows int64
+}
+
+// NewDualWriter creates a dual writer for config.
+func NewDualWriter(config DualWriteConfig) *DualWriter {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1024
+	}
+	if config.FailureQueueSize <= 0 {
+		config.FailureQueueSize = 1024
+	}
+	if config.ShadowTimeout <= 0 {
+		config.ShadowTimeout = 5 * time.Second
+	}
+	if config.ShadowConcurrency <= 0 {
+		config.ShadowConcurrency = 8
+	}
+
+	tables := map[string]bool{}
+	for _, t := range config.Tables {
+		tables[strings.ToLower(t)] = true
+	}
+
+	return &DualWriter{
+		config:   config,
+		tables:   tables,
+		queue:    make(chan []MirroredStatement, config.QueueSize),
+		failures: make(chan MirrorFailure, config.FailureQueueSize),
+		shadows:  make(chan struct{}, config.ShadowConcurrency),
+	}
+}
+
+// WithDualWrite mirrors the unit of work's writes to the registered tables
+// through d. Writes made in a transaction are queued when it commits and
+// applied in one transaction on the secondary; rolled back writes, those
+// rolled back to a savepoint included, are never mirrored.
+func WithDualWrite(d *DualWriter) Option {
+	return func(u *unitOfWork) {
+		var pendingTx *sqlx.Tx
+		var pending []MirroredStatement
+
+		u.interceptors = append(u.interceptors, func(ctx context.Context, stmt *Statement, next Handler) error {
+			info := Inspect(stmt.Driver, stmt.Query)
+			if !d.registered(info) {
+				return next(ctx, stmt)
+			}
+
+			if len(info.Operations) == 0 {
+				err := next(ctx, stmt)
+				if err != nil || !d.config.ShadowReads || stmt.InTx || (stmt.Kind != KindGet && stmt.Kind != KindSelect) {
+					return err
+				}
+
+				select {
+				case d.shadows <- struct{}{}:
+				default:
+					atomic.AddInt64(&d.droppedShadows, 1)
+					return nil
+				}
+
+				// encode the primary's result now, before the caller can
+				// change it
+				sample, err := json.Marshal(stmt.Dest)
+				if err != nil {
+					<-d.shadows
+					return nil
+				}
+				go d.shadow(stmt, sample)
+				return nil
+			}
+
+			if err := next(ctx, stmt); err != nil {
+				return err
+			}
+
+			mirrored, err := d.translate(stmt)
+			if err != nil {
+				d.fail(MirrorFailure{Statements: []MirroredStatement{{Query: stmt.Query, Args: stmt.Args}}, Err: err})
+				return nil
+			}
+
+			if !stmt.InTx {
+				d.enqueue([]MirroredStatement{mirrored})
+				return nil
+			}
+
+			// writes rolled back to a savepoint are dropped along with the
+			// AfterCommit callback queueing them, if it was registered since
+			tx, mirroredBefore, started := u.tx, len(pending), pendingTx != u.tx
+			u.onRollback(func() {
+				if pendingTx != tx {
+					return
+				}
+				if started {
+					pendingTx, pending = nil, nil
+				} else {
+					pending = pending[:mirroredBefore]
+				}
+			})
+
+			if started {
+				pendingTx, pending = tx, nil
+				u.AfterCommit(func() {
+					batch := pending
+					pendingTx, pending = nil, nil
+					d.enqueue(batch)
+				})
+			}
+			pending = append(pending, mirrored)
+			return nil
+		})
+	}
+}
+
+// Run applies queued writes to the secondary until ctx is done.
+func (d *DualWriter) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case batch := <-d.queue:
+			if err := d.apply(ctx, batch); err != nil {
+				d.fail(MirrorFailure{Statements: batch, Err: err})
+			}
+		}
+	}
+}
+
+// Failures returns the queue of writes that could not be mirrored, to be
+// fixed and replayed with Replay once the cause is addressed.
+func (d *DualWriter) Failures() <-chan MirrorFailure {
+	return d.failures
+}
+
+// Replay applies the statements of a failure to the secondary again.
+func (d *DualWriter) Replay(ctx context.Context, failure MirrorFailure) error {
+	return d.apply(ctx, failure.Statements)
+}
+
+// Mismatches returns how many shadow reads differed from the primary.
+func (d *DualWriter) Mismatches() int64 {
+	return atomic.LoadInt64(&d.mismatches)
+}
+
+// DroppedShadowReads returns how many reads were not shadowed because
+// ShadowConcurrency shadow reads were already running.
+func (d *DualWriter) DroppedShadowReads() int64 {
+	return atomic.LoadInt64(&d.droppedShadows)
+}
+
+func (d *DualWriter) registered(info StatementInfo) bool {
+	for _, table := range info.Tables {
+		if d.tables[table] || d.tables[table[strings.LastIndexByte(table, '.')+1:]] {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DualWriter) enqueue(batch []MirroredStatement) {
+	select {
+	case d.queue <- batch:
+	default:
+		d.fail(MirrorFailure{Statements: batch, Err: ErrMirrorQueueFull})
+	}
+}
+
+func (d *DualWriter) fail(failure MirrorFailure) {
+	select {
+	case d.failures <- failure:
+	default:
+		Logger().Error("db: dual-write failure dropped", "err", failure.Err)
+	}
+}
+
+func (d *DualWriter) apply(ctx context.Context, batch []MirroredStatement) error {
+	if len(batch) == 1 {
+		_, err := d.config.Secondary.ExecContext(ctx, batch[0].Query, batch[0].Args...)
+		return err
+	}
+
+	tx, err := d.config.Secondary.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, s := range batch {
+		if _, err := tx.ExecContext(ctx, s.Query, s.Args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// translate rewrites the placeholders of stmt, bound for the primary, into
+// the secondary's, reordering arguments as needed.
+func (d *DualWriter) translate(stmt *Statement) (MirroredStatement, error) {
+	tokens := lexSQLFor(DialectFor(stmt.Driver), stmt.Query)
+	ordinals := placeholderOrdinals(tokens)
+	bind := sqlx.BindType(d.config.Secondary.DriverName())
+
+	var query strings.Builder
+	var args []interface{}
+	last := 0
+
+	for _, t := range tokens {
+		if t.kind != sqlPlaceholder {
+			continue
+		}
+
+		i := ordinals[t.start]
+		if i < 0 || i >= len(stmt.Args) {
+			return MirroredStatement{}, fmt.Errorf("db: placeholder %s has no argument", t.text)
+		}
+		args = append(args, stmt.Args[i])
+
+		query.WriteString(stmt.Query[last:t.start])
+		switch n := strconv.Itoa(len(args)); bind {
+		case sqlx.DOLLAR:
+			query.WriteString("$" + n)
+		case sqlx.AT:
+			query.WriteString("@p" + n)
+		case sqlx.NAMED:
+			query.WriteString(":arg" + n)
+		default:
+			query.WriteString("?")
+		}
+		last = t.end
+	}
+	query.WriteString(stmt.Query[last:])
+
+	return MirroredStatement{Query: query.String(), Args: args}, nil
+}
+
+// shadow runs the read stmt on the secondary and compares its result with
+// sample, the primary's encoded as JSON, then frees its slot in d.shadows.
+func (d *DualWriter) shadow(stmt *Statement, sample []byte) {
+	defer func() { <-d.shadows }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.ShadowTimeout)
+	defer cancel()
+
+	mirrored, err := d.translate(stmt)
+	if err != nil {
+		Logger().Warn("db: shadow read skipped", "err", err)
+		return
+	}
+
+	dest := reflect.New(reflect.TypeOf(stmt.Dest).Elem()).Interface()
+	if stmt.Kind == KindGet {
+		err = sqlx.GetContext(ctx, d.config.Secondary, dest, mirrored.Query, mirrored.Args...)
+	} else {
+		err = sqlx.SelectContext(ctx, d.config.Secondary, dest, mirrored.Query, mirrored.Args...)
+	}
+
+	shadowed, _ := json.Marshal(dest)
+	if err != nil || string(shadowed) != string(sample) {
+		attrs := append([]interface{}{"query", stmt.Query}, shadowDifference(sample, shadowed)...)
+		Logger().Warn("db: shadow read mismatch", append(attrs, "err", err)...)
+		atomic.AddInt64(&d.mismatches, 1)
+	}
+}
+
+// shadowDifference summarizes how two results encoded as JSON differ, by
+// their row counts and the first row that differs, leaving the values out
+// since rows may hold personal data. Results of Get are a single row.
+func shadowDifference(primary, secondary []byte) []interface{} {
+	var p, s []json.RawMessage
+	if json.Unmarshal(primary, &p) != nil || json.Unmarshal(secondary, &s) != nil {
+		return nil
+	}
+
+	first := 0
+	for first < len(p) && first < len(s) && string(p[first]) == string(s[first]) {
+		first++
+	}
+	return []interface{}{"primary_rows", len(p), "secondary_rows", len(s), "first_different_row", first}
+}
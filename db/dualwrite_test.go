@@ -0,0 +1,199 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockDatabase(t *testing.T, driver string) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sqlx.NewDb(conn, driver), mock
+}
+
+// drain applies every queued write the way Run would.
+func drain(t *testing.T, d *DualWriter) {
+	for {
+		select {
+		case batch := <-d.queue:
+			assert.Nil(t, d.apply(context.Background(), batch))
+		default:
+			return
+		}
+	}
+}
+
+func TestShouldMirrorWritesWithSecondaryPlaceholders(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "postgres")
+	secondary, secondaryMock := newMockDatabase(t, "mysql")
+	d := NewDualWriter(DualWriteConfig{Secondary: secondary, Tables: []string{"accounts"}})
+	uow := NewUnitOfWork(primary, nil, WithDualWrite(d))
+
+	primaryMock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	primaryMock.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(0, 1))
+	secondaryMock.ExpectExec(`UPDATE accounts SET name = \?, note = '\$1' WHERE id = \? OR parent = \?`).
+		WithArgs("ana", 7, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	uow.MustExec("UPDATE accounts SET name = $2, note = '$1' WHERE id = $1 OR parent = $1", 7, "ana")
+	uow.MustExec("INSERT INTO audit (event) VALUES ($1)", "renamed")
+	drain(t, d)
+
+	assert.Nil(t, secondaryMock.ExpectationsWereMet())
+}
+
+func TestShouldMirrorCommittedTransactionsOnly(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "mysql")
+	secondary, secondaryMock := newMockDatabase(t, "mysql")
+	d := NewDualWriter(DualWriteConfig{Secondary: secondary, Tables: []string{"accounts"}})
+	uow := NewUnitOfWork(primary, nil, WithDualWrite(d))
+
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectExec("INSERT INTO accounts").WillReturnResult(sqlmock.NewResult(1, 1))
+	primaryMock.ExpectRollback()
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectExec("INSERT INTO accounts").WillReturnResult(sqlmock.NewResult(2, 1))
+	primaryMock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	primaryMock.ExpectCommit()
+
+	secondaryMock.ExpectBegin()
+	secondaryMock.ExpectExec("INSERT INTO accounts").WithArgs(2).WillReturnResult(sqlmock.NewResult(2, 1))
+	secondaryMock.ExpectExec("UPDATE accounts").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	secondaryMock.ExpectCommit()
+
+	uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("INSERT INTO accounts (id) VALUES (?)", 1)
+		return nil, errors.New("abort")
+	})
+	uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("INSERT INTO accounts (id) VALUES (?)", 2)
+		tx.MustExec("UPDATE accounts SET active = 1 WHERE id = ?", 2)
+		return nil, nil
+	})
+	drain(t, d)
+
+	assert.Nil(t, secondaryMock.ExpectationsWereMet())
+}
+
+func TestShouldQueueFailedMirrorWrites(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "mysql")
+	secondary, secondaryMock := newMockDatabase(t, "mysql")
+	d := NewDualWriter(DualWriteConfig{Secondary: secondary, Tables: []string{"accounts"}})
+	uow := NewUnitOfWork(primary, nil, WithDualWrite(d))
+
+	primaryMock.ExpectExec("DELETE FROM accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	secondaryMock.ExpectExec("DELETE FROM accounts").WillReturnError(errors.New("connection refused"))
+	secondaryMock.ExpectExec("DELETE FROM accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	uow.MustExec("DELETE FROM accounts WHERE id = ?", 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go d.Run(ctx)
+	defer cancel()
+
+	select {
+	case failure := <-d.Failures():
+		assert.Equal(t, "connection refused", failure.Err.Error())
+		assert.Equal(t, []interface{}{3}, failure.Statements[0].Args)
+		assert.Nil(t, d.Replay(context.Background(), failure))
+	case <-time.After(time.Second):
+		t.Fatal("no failure reported")
+	}
+	assert.Nil(t, secondaryMock.ExpectationsWereMet())
+}
+
+func TestShouldCountShadowReadMismatches(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "mysql")
+	secondary, secondaryMock := newMockDatabase(t, "mysql")
+	d := NewDualWriter(DualWriteConfig{Secondary: secondary, Tables: []string{"accounts"}, ShadowReads: true})
+	uow := NewUnitOfWork(primary, nil, WithDualWrite(d))
+
+	logger, buf := newBufferLogger()
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	primaryMock.ExpectQuery("SELECT name FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ana").AddRow("caio"))
+	secondaryMock.ExpectQuery("SELECT name FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ana").AddRow("bia"))
+
+	var names []string
+	assert.Nil(t, uow.Select(&names, "SELECT name FROM accounts WHERE active = ?", true))
+	assert.Equal(t, []string{"ana", "caio"}, names)
+
+	deadline := time.Now().Add(time.Second)
+	for d.Mismatches() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int64(1), d.Mismatches())
+	assert.Contains(t, buf.String(), "primary_rows=2 secondary_rows=2 first_different_row=1")
+	assert.NotContains(t, buf.String(), "caio")
+	assert.NotContains(t, buf.String(), "bia")
+}
+
+func TestShouldDropShadowReadsBeyondTheirConcurrency(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "mysql")
+	secondary, secondaryMock := newMockDatabase(t, "mysql")
+	d := NewDualWriter(DualWriteConfig{Secondary: secondary, Tables: []string{"accounts"}, ShadowReads: true, ShadowConcurrency: 1})
+	uow := NewUnitOfWork(primary, nil, WithDualWrite(d))
+
+	primaryMock.ExpectQuery("SELECT name FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ana"))
+	primaryMock.ExpectQuery("SELECT name FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ana"))
+	secondaryMock.ExpectQuery("SELECT name FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("ana")).
+		WillDelayFor(50 * time.Millisecond)
+
+	var name string
+	assert.Nil(t, uow.Get(&name, "SELECT name FROM accounts WHERE id = ?", 1))
+	assert.Nil(t, uow.Get(&name, "SELECT name FROM accounts WHERE id = ?", 1))
+
+	assert.Equal(t, int64(1), d.DroppedShadowReads())
+	assert.Nil(t, primaryMock.ExpectationsWereMet())
+	assert.Eventually(t, func() bool { return secondaryMock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+}
+
+func TestShouldNotMirrorWritesRolledBackToASavepoint(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "mysql")
+	secondary, secondaryMock := newMockDatabase(t, "mysql")
+	d := NewDualWriter(DualWriteConfig{Secondary: secondary, Tables: []string{"accounts"}})
+	uow := NewUnitOfWork(primary, nil, WithDualWrite(d))
+
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	primaryMock.ExpectExec("INSERT INTO accounts").WillReturnResult(sqlmock.NewResult(1, 1))
+	primaryMock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	primaryMock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	primaryMock.ExpectExec("INSERT INTO accounts").WillReturnResult(sqlmock.NewResult(2, 1))
+	primaryMock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	primaryMock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	primaryMock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	primaryMock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	primaryMock.ExpectCommit()
+
+	secondaryMock.ExpectExec("INSERT INTO accounts").WithArgs(2).WillReturnResult(sqlmock.NewResult(2, 1))
+
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.InTransaction(func(nested UnitOfWork) (interface{}, error) {
+			nested.MustExec("INSERT INTO accounts (id) VALUES (?)", 1)
+			return nil, errors.New("abort")
+		})
+		tx.MustExec("INSERT INTO accounts (id) VALUES (?)", 2)
+		tx.InTransaction(func(nested UnitOfWork) (interface{}, error) {
+			nested.MustExec("UPDATE accounts SET active = 1 WHERE id = ?", 2)
+			return nil, errors.New("abort")
+		})
+		return nil, nil
+	})
+	drain(t, d)
+
+	assert.Nil(t, err)
+	assert.Nil(t, primaryMock.ExpectationsWereMet())
+	assert.Nil(t, secondaryMock.ExpectationsWereMet())
+}
@@ -0,0 +1,455 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DumpFormat selects how Dump writes table rows.
+type DumpFormat int
+
+const (
+	// DumpInsert writes multi-row INSERT statements, restorable on any
+	// database with the same tables.
+	DumpInsert DumpFormat = iota
+	// DumpCopy writes Postgres COPY ... FROM stdin blocks, which are smaller
+	// and restore much faster. Restoring them requires lib/pq.
+	DumpCopy
+)
+
+// DumpOptions configures Dump.
+type DumpOptions struct {
+	// Tables to dump, parents before children so the script restores in
+	// foreign key order.
+	Tables []string
+
+	// DataOnly leaves existing rows alone on restore. Otherwise the script
+	// starts by deleting the dumped rows of every table, children first: all
+	// of them, or those matching its Where condition. Dump never
+	// writes DDL: the tables must exist where the script is restored.
+	DataOnly bool
+
+	// Where restricts the rows dumped per table, e.g. {"orders": "created_at > now() - interval '1 day'"}.
+	// Conditions are inserted verbatim and must come from trusted code.
+	Where map[string]string
+
+	Format DumpFormat
+
+	// BatchRows is the number of rows per INSERT statement. Zero means 100.
+	BatchRows int
+
+	// Options configure the read-only transaction the tables are dumped from,
+	// e.g. WithMasking to keep personal data out of the script.
+	Options []Option
+}
+
+// Dump writes the rows of opts.Tables to w as a SQL script for Restore,
+// reading every table from the same read-only transaction so the dump is
+// consistent where the database supports snapshot isolation.
+func Dump(ctx context.Context, db *sqlx.DB, w io.Writer, opts DumpOptions) error {
+	if len(opts.Tables) == 0 {
+		return errors.New("db: no tables to dump")
+	}
+
+	dialect := DialectFor(db.DriverName())
+	if opts.Format == DumpCopy && dialect != DialectPostgres {
+		return fmt.Errorf("db: COPY dumps require postgres, not %s", dialect)
+	}
+	if opts.BatchRows <= 0 {
+		opts.BatchRows = 100
+	}
+
+	u := &unitOfWork{db: db, ctx: ctx}
+	u.apply(opts.Options)
+
+	out := bufio.NewWriter(w)
+
+	err := WithSnapshot(ctx, u, func(*Snapshot) error {
+		if !opts.DataOnly {
+			for i := len(opts.Tables) - 1; i >= 0; i-- {
+				// a partial dump only replaces the rows it holds
+				table := opts.Tables[i]
+				if where := opts.Where[table]; where != "" {
+					fmt.Fprintf(out, "DELETE FROM %s WHERE %s;\n", dialect.Quote(table), where)
+				} else {
+					fmt.Fprintf(out, "DELETE FROM %s;\n", dialect.Quote(table))
+				}
+			}
+		}
+
+		for _, table := range opts.Tables {
+			if err := dumpTable(ctx, u, out, dialect, table, opts); err != nil {
+				return fmt.Errorf("db: dumping %s: %w", table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return out.Flush()
+}
+
+func snapshotOptions(dialect Dialect) *sql.TxOptions {
+	switch dialect {
+	case DialectPostgres, DialectMySQL:
+		return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	return &sql.TxOptions{ReadOnly: true}
+}
+
+func dumpTable(ctx context.Context, u *unitOfWork, out *bufio.Writer, dialect Dialect, table string, opts DumpOptions) error {
+	query := "SELECT * FROM " + dialect.Quote(table)
+	if where := opts.Where[table]; where != "" {
+		query += " WHERE " + where
+	}
+
+	rows, err := u.query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	text, err := textColumns(rows)
+	if err != nil {
+		return err
+	}
+	target := insertTarget(dialect, table, columns)
+
+	if opts.Format == DumpCopy {
+		fmt.Fprintf(out, "COPY %s FROM stdin;\n", target)
+	}
+
+	inserts := &insertWriter{out: out, dialect: dialect, target: target, batch: opts.BatchRows, text: text}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+
+		if opts.Format == DumpCopy {
+			writeCopyRow(out, values, text)
+		} else {
+			inserts.row(values)
+		}
+	}
+
+	inserts.flush()
+	if opts.Format == DumpCopy {
+		out.WriteString("\\.\n")
+	}
+
+	return rows.Err()
+}
+
+// binaryTypes are the column types whose []byte values are binary data. The
+// drivers return other types as []byte too, e.g. lib/pq numeric, uuid, json
+// and arrays, whose bytes are their text representation.
+var binaryTypes = map[string]bool{
+	"BYTEA": true, "BLOB": true, "TINYBLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+	"BINARY": true, "VARBINARY": true, "BIT": true, "GEOMETRY": true,
+}
+
+// textColumns tells, per column, whether []byte values are text, from the
+// column type the driver reports. Columns of unreported types are left out
+// of it and written the way their bytes look.
+func textColumns(rows *sqlx.Rows) ([]bool, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	text := make([]bool, len(types))
+	for i, t := range types {
+		name := strings.ToUpper(t.DatabaseTypeName())
+		text[i] = name != "" && !binaryTypes[name]
+	}
+	return text, nil
+}
+
+// isText reports whether column i of text holds text.
+func isText(text []bool, i int) bool {
+	return i < len(text) && text[i]
+}
+
+// insertTarget renders the table and column list of an INSERT statement.
+func insertTarget(dialect Dialect, table string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = dialect.Quote(c)
+	}
+	return dialect.Quote(table) + " (" + strings.Join(quoted, ", ") + ")"
+}
+
+// insertWriter writes rows as multi-row INSERT statements of up to batch rows.
+type insertWriter struct {
+	out     *bufio.Writer
+	dialect Dialect
+	target  string
+	batch   int
+	pending int
+
+	// text marks the columns whose []byte values are text, see textColumns.
+	text []bool
+}
+
+func (w *insertWriter) row(values []interface{}) {
+	if w.pending == 0 {
+		fmt.Fprintf(w.out, "INSERT INTO %s VALUES\n\t", w.target)
+	} else {
+		w.out.WriteString(",\n\t")
+	}
+
+	w.out.WriteString("(")
+	for i, v := range values {
+		if i > 0 {
+			w.out.WriteString(", ")
+		}
+		if b, ok := v.([]byte); ok && isText(w.text, i) {
+			v = string(b)
+		}
+		w.out.WriteString(sqlLiteral(w.dialect, v))
+	}
+	w.out.WriteString(")")
+
+	if w.pending++; w.pending == w.batch {
+		w.flush()
+	}
+}
+
+// flush terminates the statement in progress, if any.
+func (w *insertWriter) flush() {
+	if w.pending > 0 {
+		w.out.WriteString(";\n")
+		w.pending = 0
+	}
+}
+
+// Restore runs a script written by Dump in a single transaction, rolling
+// everything back on the first failing statement. Statements go through the
+// interceptors in opts; COPY data is streamed through a prepared COPY
+// statement, which only lib/pq supports.
+func Restore(ctx context.Context, db *sqlx.DB, r io.Reader, opts ...Option) error {
+	u := &unitOfWork{db: db, ctx: ctx}
+	u.apply(opts)
+
+	// not retried, r cannot be read again
+	_, err := u.transaction(u.txOptions, func(UnitOfWork) (interface{}, error) {
+		return nil, restore(ctx, u, DialectFor(db.DriverName()), bufio.NewReader(r))
+	})
+	return err
+}
+
+func restore(ctx context.Context, u *unitOfWork, dialect Dialect, reader *bufio.Reader) error {
+	var buffer strings.Builder
+
+	for {
+		line, readErr := reader.ReadString('\n')
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+		buffer.WriteString(line)
+
+		// Statements may span lines, so only run once the buffer ends on a
+		// top-level semicolon or the input is exhausted.
+		tokens := lexSQLFor(dialect, buffer.String())
+		complete := len(tokens) > 0 && tokens[len(tokens)-1].text == ";"
+		if !complete && readErr == nil {
+			continue
+		}
+
+		for _, statement := range SplitStatements(dialect, buffer.String()) {
+			if isCopyFromStdin(lexSQLFor(dialect, statement)) {
+				if err := restoreCopy(ctx, u, statement, reader); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if _, err := u.exec(ctx, statement); err != nil {
+				return err
+			}
+		}
+		buffer.Reset()
+
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+func isCopyFromStdin(tokens []sqlToken) bool {
+	n := len(tokens)
+	return n > 2 && tokens[0].is("copy") && tokens[n-2].is("from") && tokens[n-1].is("stdin")
+}
+
+func restoreCopy(ctx context.Context, u *unitOfWork, statement string, reader *bufio.Reader) error {
+	stmt, err := u.tx.PrepareContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("db: COPY data not terminated by \\.")
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == `\.` {
+			break
+		}
+
+		fields := strings.Split(line, "\t")
+		args := make([]interface{}, len(fields))
+		for i, f := range fields {
+			args[i] = decodeCopyField(f)
+		}
+
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// sqlLiteral renders a scanned value as a SQL literal of dialect.
+func sqlLiteral(dialect Dialect, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return quoteString(dialect, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return quoteString(dialect, v)
+	case []byte:
+		switch {
+		case dialect == DialectPostgres:
+			return `'\x` + hex.EncodeToString(v) + "'"
+		case dialect == DialectMySQL && utf8.Valid(v):
+			// the MySQL driver returns every column as bytes
+			return quoteString(dialect, string(v))
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		return quoteString(dialect, formatTimestamp(dialect, v))
+	}
+
+	return quoteString(dialect, fmt.Sprint(value))
+}
+
+func quoteString(dialect Dialect, s string) string {
+	if dialect == DialectMySQL {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func formatTimestamp(dialect Dialect, t time.Time) string {
+	if dialect == DialectMySQL {
+		return t.Format("2006-01-02 15:04:05.999999")
+	}
+	return t.Format("2006-01-02 15:04:05.999999999-07:00")
+}
+
+var copyEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// writeCopyRow writes values in the Postgres COPY text format, the []byte
+// values of text columns as text.
+func writeCopyRow(out *bufio.Writer, values []interface{}, text []bool) {
+	for i, value := range values {
+		if i > 0 {
+			out.WriteByte('\t')
+		}
+		if b, ok := value.([]byte); ok && isText(text, i) {
+			value = string(b)
+		}
+
+		switch v := value.(type) {
+		case nil:
+			out.WriteString(`\N`)
+		case bool:
+			if v {
+				out.WriteString("t")
+			} else {
+				out.WriteString("f")
+			}
+		case []byte:
+			out.WriteString(`\\x` + hex.EncodeToString(v))
+		case time.Time:
+			out.WriteString(formatTimestamp(DialectPostgres, v))
+		default:
+			out.WriteString(copyEscaper.Replace(fmt.Sprint(v)))
+		}
+	}
+	out.WriteByte('\n')
+}
+
+func decodeCopyField(field string) interface{} {
+	if field == `\N` {
+		return nil
+	}
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch field[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		default:
+			b.WriteByte(field[i])
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldDumpTablesAsInsertScript(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "customers"$`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "name"}).AddRow(int64(1), "O'Brien").AddRow(int64(2), nil))
+	mock.ExpectQuery(`SELECT \* FROM "orders" WHERE total > 10$`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "paid", "payload"}).AddRow(int64(7), true, []byte{0xde, 0xad}))
+	mock.ExpectCommit()
+
+	var out bytes.Buffer
+	err := Dump(context.Background(), db, &out, DumpOptions{
+		Tables: []string{"customers", "orders"},
+		Where:  map[string]string{"orders": "total > 10"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `DELETE FROM "orders" WHERE total > 10;
+DELETE FROM "customers";
+INSERT INTO "customers" ("id", "name") VALUES
+	(1, 'O''Brien'),
+	(2, NULL);
+INSERT INTO "orders" ("id", "paid", "payload") VALUES
+	(7, TRUE, '\xdead');
+`, out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSplitInsertBatches(t *testing.T) {
+	db, mock := newMockDB(t, "mysql")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `tags`").WillReturnRows(
+		sqlmock.NewRows([]string{"name"}).AddRow([]byte(`a\b`)).AddRow("c").AddRow("d"))
+	mock.ExpectCommit()
+
+	var out bytes.Buffer
+	err := Dump(context.Background(), db, &out, DumpOptions{Tables: []string{"tags"}, DataOnly: true, BatchRows: 2})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `tags` (`name`) VALUES\n\t('a\\\\b'),\n\t('c');\n"+
+		"INSERT INTO `tags` (`name`) VALUES\n\t('d');\n", out.String())
+}
+
+func TestShouldDumpCopyFormat(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "notes"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "body", "created_at"}).
+			AddRow(int64(1), "tab\there\nnewline", created).
+			AddRow(int64(2), nil, created))
+	mock.ExpectCommit()
+
+	var out bytes.Buffer
+	err := Dump(context.Background(), db, &out, DumpOptions{Tables: []string{"notes"}, DataOnly: true, Format: DumpCopy})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `COPY "notes" ("id", "body", "created_at") FROM stdin;
+1	tab\there\nnewline	2024-03-01 12:30:00+00:00
+2	\N	2024-03-01 12:30:00+00:00
+\.
+`, out.String())
+}
+
+func TestShouldRoundTripTextValuesScannedAsBytes(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+	columns := func() *sqlmock.Rows {
+		return sqlmock.NewRowsWithColumnDefinition(
+			sqlmock.NewColumn("id").OfType("UUID", []byte{}),
+			sqlmock.NewColumn("total").OfType("NUMERIC", []byte{}),
+			sqlmock.NewColumn("attrs").OfType("JSONB", []byte{}),
+			sqlmock.NewColumn("tags").OfType("_TEXT", []byte{}),
+			sqlmock.NewColumn("receipt").OfType("BYTEA", []byte{})).
+			AddRow([]byte("6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c"), []byte("12.50"), []byte(`{"gift": true}`), []byte(`{a,"b c"}`), []byte{0xca, 0xfe})
+	}
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT \* FROM "orders"`).WillReturnRows(columns())
+		mock.ExpectCommit()
+	}
+
+	var script, copied bytes.Buffer
+	assert.NoError(t, Dump(context.Background(), db, &script, DumpOptions{Tables: []string{"orders"}, DataOnly: true}))
+	assert.NoError(t, Dump(context.Background(), db, &copied, DumpOptions{Tables: []string{"orders"}, DataOnly: true, Format: DumpCopy}))
+
+	assert.Equal(t, `INSERT INTO "orders" ("id", "total", "attrs", "tags", "receipt") VALUES
+	('6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c', '12.50', '{"gift": true}', '{a,"b c"}', '\xcafe');
+`, script.String())
+	assert.Equal(t, "COPY \"orders\" (\"id\", \"total\", \"attrs\", \"tags\", \"receipt\") FROM stdin;\n"+
+		"6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c\t12.50\t{\"gift\": true}\t{a,\"b c\"}\t\\\\xcafe\n\\.\n", copied.String())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO "orders" \("id", "total", "attrs", "tags", "receipt"\) VALUES\s+` +
+		`\('6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c', '12\.50', '\{"gift": true\}', '\{a,"b c"\}', '\\xcafe'\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, Restore(context.Background(), db, &script))
+
+	mock.ExpectBegin()
+	prepared := mock.ExpectPrepare(`COPY "orders"`)
+	prepared.ExpectExec().WithArgs("6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c", "12.50", `{"gift": true}`, `{a,"b c"}`, `\xcafe`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.NoError(t, Restore(context.Background(), db, &copied))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseCopyDumpOutsidePostgres(t *testing.T) {
+	db, _ := newMockDB(t, "mysql")
+
+	err := Dump(context.Background(), db, &bytes.Buffer{}, DumpOptions{Tables: []string{"t"}, Format: DumpCopy})
+
+	assert.Error(t, err)
+}
+
+func TestShouldRestoreInsertScriptInOneTransaction(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`DELETE FROM "notes"`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`INSERT INTO "notes" \("id", "body"\) VALUES\s+\(1, 'semi; colon'\),\s+\(2, 'multi\s+line'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	script := "DELETE FROM \"notes\";\nINSERT INTO \"notes\" (\"id\", \"body\") VALUES\n\t(1, 'semi; colon'),\n\t(2, 'multi\nline');\n"
+	err := Restore(context.Background(), db, strings.NewReader(script))
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRestoreCopyBlocks(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	prepared := mock.ExpectPrepare(`COPY "notes" \("id", "body"\) FROM stdin`)
+	prepared.ExpectExec().WithArgs("1", "tab\there").WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.ExpectExec().WithArgs("2", nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE "notes"`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	script := "COPY \"notes\" (\"id\", \"body\") FROM stdin;\n1\ttab\\there\n2\t\\N\n\\.\nUPDATE \"notes\" SET body = body;\n"
+	err := Restore(context.Background(), db, strings.NewReader(script))
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollBackFailedRestore(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM t").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	err := Restore(context.Background(), db, strings.NewReader("DELETE FROM t;\nDELETE FROM u;\n"))
+
+	assert.Equal(t, assert.AnError, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+type effectiveDating struct {
+	from string
+	to   string
+}
+
+// WithEffectiveDating makes the repository treat its model as effective
+// dated: every version of an entity is a row sharing the model key, valid
+// from fromColumn (inclusive) until toColumn (exclusive), NULL while the
+// version is current. The table's primary key must therefore include
+// fromColumn. Columns default to valid_from and valid_to. Find, Update and
+// Delete then work on the version in effect now: Find loads it, Update
+// rewrites it alone and Delete closes it now instead of erasing the history
+// of the entity.
+func WithEffectiveDating(fromColumn, toColumn string) RepositoryOption {
+	if fromColumn == "" {
+		fromColumn = "valid_from"
+	}
+	if toColumn == "" {
+		toColumn = "valid_to"
+	}
+
+	return func(c *repositoryConfig) {
+		c.effective = &effectiveDating{from: fromColumn, to: toColumn}
+	}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+func (e *effectiveDating) validate(m *Model) error {
+	zero := reflect.New(m.Type).Interface()
+
+	for _, column := range []string{e.from, e.to} {
+		field := m.Field(zero, column)
+		if !field.IsValid() {
+			return fmt.Errorf("db: %s has no column %s", m.Table, column)
+		}
+
+		t := field.Type()
+		if t != timeType && t != reflect.PtrTo(timeType) && !reflect.PtrTo(t).Implements(scannerType) {
+			return fmt.Errorf("db: effective dating column %s.%s must hold a time", m.Table, column)
+		}
+	}
+
+	if !zeroIsNull(m.Field(zero, e.to)) {
+		return fmt.Errorf("db: effective dating column %s.%s must be nullable", m.Table, e.to)
+	}
+	return nil
+}
+
+// scope confines the statements of s to the version of an entity in effect
+// at :now, and makes delete close that version at :now.
+func (e *effectiveDating) scope(m *Model, s repositorySQL) repositorySQL {
+	open := fmt.Sprintf("%s <= :now AND (%s IS NULL OR %s > :now)", e.from, e.to, e.to)
+
+	s.find = fmt.Sprintf("%s = :id AND %s", m.Key, open)
+	s.update += " AND " + open
+	s.delete = fmt.Sprintf("UPDATE %s SET %s = :now WHERE %s", m.Table, e.to, s.find)
+	return s
+}
+
+// namedArg returns the argument binding the columns of entity and extra,
+// entity itself when there is no extra and no column compressed with the
+// codec of its tag.
+func (m *Model) namedArg(entity interface{}, extra map[string]interface{}) interface{} {
+	if extra == nil && len(m.codecs) == 0 {
+		return entity
+	}
+
+	arg := make(map[string]interface{}, len(m.Columns)+len(extra))
+	for _, column := range m.Columns {
+		arg[column] = m.ValueOf(entity, column)
+		if codec, ok := m.codecs[column]; ok {
+			// written with the codec of the tag instead of the default one
+			switch v := arg[column].(type) {
+			case CompressedBytes:
+				arg[column] = compressedValue{data: v, codec: codec}
+			case CompressedString:
+				arg[column] = compressedValue{data: []byte(v), codec: codec}
+			}
+		}
+	}
+	for name, value := range extra {
+		arg[name] = value
+	}
+	return arg
+}
+
+// zeroIsNull reports whether the zero value of field is stored as NULL.
+func zeroIsNull(field reflect.Value) bool {
+	if field.Kind() == reflect.Ptr {
+		return true
+	}
+
+	valuer, ok := field.Interface().(driver.Valuer)
+	if !ok {
+		return false
+	}
+	v, err := valuer.Value()
+	return err == nil && v == nil
+}
+
+// setTime stores t in field, a time.Time, a *time.Time or a Scanner.
+func setTime(field reflect.Value, t time.Time) error {
+	switch field.Type() {
+	case timeType:
+		field.Set(reflect.ValueOf(t))
+		return nil
+	case reflect.PtrTo(timeType):
+		field.Set(reflect.ValueOf(&t))
+		return nil
+	}
+	return field.Addr().Interface().(sql.Scanner).Scan(t)
+}
+
+// FindAsOf loads the version of the entity with the given key that was in
+// effect at t. It returns sql.ErrNoRows when none was, and fails for
+// repositories created without WithEffectiveDating. Results are never cached.
+func (r *Repository[T]) FindAsOf(uow UnitOfWork, id interface{}, t time.Time) (T, error) {
+	if r.effective == nil {
+		var zero T
+		return zero, fmt.Errorf("db: %s is not effective dated", r.model.Table)
+	}
+
+	where := fmt.Sprintf("%s = :id AND %s <= :at AND (%s IS NULL OR %s > :at)",
+		r.model.Key, r.effective.from, r.effective.to, r.effective.to)
+
+	args := map[string]interface{}{"id": id, "at": t}
+	if err := r.authorize(uow, "SELECT", where, args); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return r.loadWhere(uow, where, args)
+}
+
+// Supersede makes entity the version of its key in effect from the given
+// time on: it closes the current version at from and inserts entity, valid
+// from then with no end, both in one transaction. It returns sql.ErrNoRows
+// when there is no current version started before from; the first version of
+// an entity is written with Insert.
+func (r *Repository[T]) Supersede(uow UnitOfWork, entity *T, from time.Time) error {
+	if r.effective == nil {
+		return fmt.Errorf("db: %s is not effective dated", r.model.Table)
+	}
+
+	if IsTransactional(uow) {
+		return r.supersede(uow, entity, from)
+	}
+
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, r.supersede(tx, entity, from)
+	})
+	return err
+}
+
+func (r *Repository[T]) supersede(uow UnitOfWork, entity *T, from time.Time) error {
+	where := fmt.Sprintf("%s = :id AND %s IS NULL AND %s < :from", r.model.Key, r.effective.to, r.effective.from)
+	args := map[string]interface{}{"id": r.model.KeyOf(entity), "from": from}
+	if err := r.authorize(uow, "UPDATE", where, args); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s = :from WHERE %s", r.model.Table, r.effective.to, where)
+
+	affected, err := uow.MustNamedExec(query, args).RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := setTime(r.model.Field(entity, r.effective.from), from); err != nil {
+		return err
+	}
+	to := r.model.Field(entity, r.effective.to)
+	to.Set(reflect.Zero(to.Type()))
+
+	return r.Insert(uow, entity)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type priceVersion struct {
+	ID        int64      `db:"id"`
+	Amount    int64      `db:"amount"`
+	ValidFrom time.Time  `db:"valid_from"`
+	ValidTo   *time.Time `db:"valid_to"`
+}
+
+type closedPriceVersion struct {
+	ID        int64     `db:"id"`
+	ValidFrom time.Time `db:"valid_from"`
+	ValidTo   time.Time `db:"valid_to"`
+}
+
+func init() {
+	MustRegister(priceVersion{}, "prices")
+	MustRegister(closedPriceVersion{}, "closed_prices")
+}
+
+func TestShouldFindVersionInEffectAt(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, err := NewRepository[priceVersion](WithEffectiveDating("", ""))
+	assert.Nil(t, err)
+
+	at := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT id, amount, valid_from, valid_to FROM prices WHERE id = \? AND valid_from <= \? AND \(valid_to IS NULL OR valid_to > \?\)`).
+		WithArgs(7, at, at).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "amount", "valid_from", "valid_to"}).
+			AddRow(7, 990, at.AddDate(0, -1, 0), nil))
+
+	price, err := repo.FindAsOf(uw, 7, at)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(990), price.Amount)
+	assert.Nil(t, price.ValidTo)
+}
+
+func TestShouldSupersedeCurrentVersionAtomically(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[priceVersion](WithEffectiveDating("", ""))
+
+	from := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE prices SET valid_to = \? WHERE id = \? AND valid_to IS NULL AND valid_from < \?`).
+		WithArgs(from, int64(7), from).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO prices").
+		WithArgs(int64(7), int64(1090), from, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ended := from.AddDate(1, 0, 0)
+	price := &priceVersion{ID: 7, Amount: 1090, ValidTo: &ended}
+
+	assert.Nil(t, repo.Supersede(uw, price, from))
+	assert.Equal(t, from, price.ValidFrom)
+	assert.Nil(t, price.ValidTo)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldNotSupersedeWithoutCurrentVersion(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[priceVersion](WithEffectiveDating("", ""))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE prices").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := repo.Supersede(uw, &priceVersion{ID: 7}, time.Now())
+
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequireNullableEndColumn(t *testing.T) {
+	_, err := NewRepository[closedPriceVersion](WithEffectiveDating("", ""))
+	assert.NotNil(t, err)
+
+	_, err = NewRepository[priceVersion](WithEffectiveDating("starts", ""))
+	assert.NotNil(t, err)
+
+	uw, _ := newMockUnitOfWork(t)
+	plain, _ := NewRepository[priceVersion]()
+	_, err = plain.FindAsOf(uw, 7, time.Now())
+	assert.NotNil(t, err)
+}
+
+func TestShouldFindAndUpdateTheVersionInEffectNow(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[priceVersion](WithEffectiveDating("", ""))
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`^SELECT id, amount, valid_from, valid_to FROM prices WHERE id = \? AND valid_from <= \? AND \(valid_to IS NULL OR valid_to > \?\)$`).
+		WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "amount", "valid_from", "valid_to"}).AddRow(7, 990, from, nil))
+	mock.ExpectExec(`^UPDATE prices SET amount = \?, valid_from = \?, valid_to = \? WHERE id = \? AND valid_from <= \? AND \(valid_to IS NULL OR valid_to > \?\)$`).
+		WithArgs(int64(995), from, nil, int64(7), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	price, err := repo.Find(uw, 7)
+	assert.Nil(t, err)
+
+	price.Amount = 995
+	assert.Nil(t, repo.Update(uw, &price))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldCloseTheVersionInEffectOnDelete(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[priceVersion](WithEffectiveDating("", ""))
+
+	mock.ExpectExec(`^UPDATE prices SET valid_to = \? WHERE id = \? AND valid_from <= \? AND \(valid_to IS NULL OR valid_to > \?\)$`).
+		WithArgs(sqlmock.AnyArg(), 7, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE prices SET valid_to`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, repo.Delete(uw, 7))
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(uw, 7))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+)
+
+var (
+	// ErrNotFound is sql.ErrNoRows: Get keeps returning it unwrapped, so
+	// comparisons with == still hold, but errors.Is(err, db.ErrNotFound)
+	// reads better next to the other kinds.
+	ErrNotFound = sql.ErrNoRows
+
+	// ErrUniqueViolation matches errors of statements violating a unique or
+	// primary key constraint.
+	ErrUniqueViolation = errors.New("db: unique violation")
+
+	// ErrForeignKey matches errors of statements violating a foreign key
+	// constraint.
+	ErrForeignKey = errors.New("db: foreign key violation")
+
+	// ErrDeadlock matches errors of statements chosen as deadlock victims.
+	ErrDeadlock = errors.New("db: deadlock")
+)
+
+// DriverError is a driver error classified as one of ErrUniqueViolation,
+// ErrForeignKey or ErrDeadlock, which errors.Is matches against Kind. The
+// driver error stays reachable with errors.As, and the message is its own.
+type DriverError struct {
+	Kind error
+	Err  error
+}
+
+func (e *DriverError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DriverError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DriverError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// sqlStateKinds, mysqlKinds and sqliteKinds map SQLSTATEs, MySQL error numbers and SQLite extended result
+// codes to the kind of error they report.
+var (
+	sqlStateKinds = map[string]error{
+		"23505": ErrUniqueViolation,
+		"23503": ErrForeignKey,
+		"40P01": ErrDeadlock,
+	}
+	mysqlKinds = map[uint64]error{
+		1062: ErrUniqueViolation,
+		1586: ErrUniqueViolation,
+		1216: ErrForeignKey,
+		1217: ErrForeignKey,
+		1451: ErrForeignKey,
+		1452: ErrForeignKey,
+		1213: ErrDeadlock,
+	}
+	sqliteKinds = map[int64]error{
+		1555: ErrUniqueViolation, // SQLITE_CONSTRAINT_PRIMARYKEY
+		2067: ErrUniqueViolation, // SQLITE_CONSTRAINT_UNIQUE
+		787:  ErrForeignKey,      // SQLITE_CONSTRAINT_FOREIGNKEY
+	}
+)
+
+// classifyError wraps err in a DriverError when the driver reports a kind
+// of error callers commonly handle. Other errors, sql.ErrNoRows included,
+// are returned as they are.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if kind := errorKind(err); kind != nil {
+		return &DriverError{Kind: kind, Err: err}
+	}
+	return err
+}
+
+func errorKind(err error) error {
+	var classified *DriverError
+	if errors.As(err, &classified) {
+		return nil
+	}
+
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return sqlStateKinds[state.SQLState()]
+	}
+	if kind := mysqlKinds[mysqlErrorNumber(err)]; kind != nil {
+		return kind
+	}
+	return sqliteKinds[sqliteErrorCode(err)]
+}
+
+// sqliteErrorCode returns the extended result code of a SQLite driver error
+// in the chain of err, or zero, without depending on the driver: the
+// ExtendedCode field of mattn/go-sqlite3 errors, or the Code method of
+// modernc.org/sqlite ones.
+func sqliteErrorCode(err error) int64 {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if coded, ok := err.(interface{ Code() int }); ok {
+			return int64(coded.Code())
+		}
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		if code := v.FieldByName("ExtendedCode"); code.IsValid() && code.CanInt() {
+			return code.Int()
+		}
+	}
+	return 0
+}
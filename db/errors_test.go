@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMySQLError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *fakeMySQLError) Error() string {
+	return e.Message
+}
+
+type fakeSQLiteError struct {
+	Code         int
+	ExtendedCode int
+}
+
+func (e fakeSQLiteError) Error() string {
+	return "constraint failed"
+}
+
+func TestShouldClassifyDriverErrors(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		kind error
+	}{
+		{&pq.Error{Code: "23505"}, ErrUniqueViolation},
+		{&pq.Error{Code: "23503"}, ErrForeignKey},
+		{&pq.Error{Code: "40P01"}, ErrDeadlock},
+		{&fakeMySQLError{Number: 1062}, ErrUniqueViolation},
+		{&fakeMySQLError{Number: 1452}, ErrForeignKey},
+		{&fakeMySQLError{Number: 1213}, ErrDeadlock},
+		{fakeSQLiteError{Code: 19, ExtendedCode: 2067}, ErrUniqueViolation},
+		{fakeSQLiteError{Code: 19, ExtendedCode: 787}, ErrForeignKey},
+	} {
+		err := classifyError(test.err)
+
+		assert.True(t, errors.Is(err, test.kind), "%T %v", test.err, test.err)
+		assert.Equal(t, test.err.Error(), err.Error())
+		assert.True(t, errors.Is(err, test.err))
+	}
+
+	assert.Equal(t, sql.ErrNoRows, classifyError(sql.ErrNoRows))
+	assert.Nil(t, classifyError(nil))
+}
+
+func TestShouldReturnClassifiedErrorsFromExec(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectExec("^INSERT INTO accounts").WillReturnError(&pq.Error{Code: "23505", Constraint: "accounts_email_key"})
+	mock.ExpectExec("^DELETE FROM accounts").WillReturnError(&pq.Error{Code: "23503"})
+	mock.ExpectQuery("^SELECT id FROM accounts").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	res, err := uow.Exec("INSERT INTO accounts (email) VALUES (?)", "ana@example.com")
+	assert.Nil(t, res)
+	assert.True(t, errors.Is(err, ErrUniqueViolation))
+	var pqErr *pq.Error
+	if assert.True(t, errors.As(err, &pqErr)) {
+		assert.Equal(t, "accounts_email_key", pqErr.Constraint)
+	}
+
+	_, err = uow.NamedExec("DELETE FROM accounts WHERE id = :id", map[string]interface{}{"id": 1})
+	assert.True(t, errors.Is(err, ErrForeignKey))
+
+	var id int64
+	err = uow.Get(&id, "SELECT id FROM accounts")
+	assert.True(t, err == sql.ErrNoRows)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldNotReportRowsAffectedAsLastInsertIdOnFailure(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectExec("^UPDATE accounts").WillReturnError(errors.New("connection reset"))
+
+	id, err := uow.MustNamedExec("UPDATE accounts SET active = :active", map[string]interface{}{"active": true}).LastInsertId()
+
+	assert.Equal(t, int64(0), id)
+	assert.EqualError(t, err, "connection reset")
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// EntityChange tells that a row was written. Op is insert, update or delete.
+type EntityChange struct {
+	Table string
+	Op    string
+	Key   interface{}
+}
+
+// EventBus delivers entity changes to subscribers of the same process once
+// the transaction making them commits, e.g. to invalidate in-memory caches.
+// A slow subscriber never blocks the publisher: changes that do not fit its
+// buffer are dropped and counted.
+type EventBus struct {
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[*EventSubscription]struct{}
+	dropped     int64
+}
+
+// NewEventBus creates a bus queueing up to buffer changes per subscriber. Zero
+// means 64.
+func NewEventBus(buffer int) *EventBus {
+	if buffer <= 0 {
+		buffer = 64
+	}
+
+	return &EventBus{buffer: buffer, subscribers: map[*EventSubscription]struct{}{}}
+}
+
+// WithEventBus publishes the repository's inserts, updates and deletes on bus.
+func WithEventBus(bus *EventBus) RepositoryOption {
+	return func(c *repositoryConfig) {
+		c.bus = bus
+	}
+}
+
+// Publish delivers change after the current transaction of uow commits, or
+// right away outside a transaction. Rolled back changes are never delivered.
+func (b *EventBus) Publish(uow UnitOfWork, change EntityChange) {
+	uow.AfterCommit(func() {
+		b.broadcast(change)
+	})
+}
+
+// Subscribe registers a subscriber receiving the changes to tables, or to
+// every table when none is given.
+func (b *EventBus) Subscribe(tables ...string) *EventSubscription {
+	c := make(chan EntityChange, b.buffer)
+	s := &EventSubscription{C: c, c: c, bus: b}
+	if len(tables) > 0 {
+		s.tables = map[string]bool{}
+		for _, t := range tables {
+			s.tables[strings.ToLower(t)] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+}
+
+// Dropped returns the number of changes lost by all subscribers, including
+// those that have since unsubscribed.
+func (b *EventBus) Dropped() int64 {
+	return atomic.LoadInt64(&b.dropped)
+}
+
+func (b *EventBus) broadcast(change EntityChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		if s.tables != nil && !s.tables[strings.ToLower(change.Table)] {
+			continue
+		}
+
+		select {
+		case s.c <- change:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			atomic.AddInt64(&b.dropped, 1)
+		}
+	}
+}
+
+// EventSubscription is a subscriber of an EventBus. C is closed by Close.
+type EventSubscription struct {
+	C <-chan EntityChange
+
+	c       chan EntityChange
+	tables  map[string]bool
+	bus     *EventBus
+	dropped int64
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *EventSubscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subscribers[s]; ok {
+		delete(s.bus.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Dropped returns the number of changes lost because the subscriber fell
+// behind.
+func (s *EventSubscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldDeliverRepositoryChangesAfterCommit(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	bus := NewEventBus(0)
+	orders := bus.Subscribe("orders")
+	defer orders.Close()
+	others := bus.Subscribe("customers")
+	defer others.Close()
+
+	repo, _ := NewRepository[repositoryOrder](WithEventBus(bus))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err := uw.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		err := repo.Update(tx, &repositoryOrder{ID: 7, Status: "closed"})
+		assert.Len(t, orders.C, 0)
+		return nil, err
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, EntityChange{Table: "orders", Op: "update", Key: int64(7)}, <-orders.C)
+	assert.Len(t, others.C, 0)
+}
+
+func TestShouldNotDeliverRolledBackChanges(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	bus := NewEventBus(0)
+	s := bus.Subscribe()
+	defer s.Close()
+
+	repo, _ := NewRepository[repositoryOrder](WithEventBus(bus))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	uw.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		assert.Nil(t, repo.Delete(tx, 7))
+		return nil, assert.AnError
+	})
+
+	assert.Len(t, s.C, 0)
+}
+
+func TestShouldDropChangesForSlowSubscribers(t *testing.T) {
+	uw, _ := newMockUnitOfWork(t)
+	bus := NewEventBus(1)
+	s := bus.Subscribe()
+
+	bus.Publish(uw, EntityChange{Table: "orders", Op: "insert", Key: 1})
+	bus.Publish(uw, EntityChange{Table: "orders", Op: "insert", Key: 2})
+
+	assert.Equal(t, int64(1), s.Dropped())
+	assert.Equal(t, int64(1), bus.Dropped())
+
+	s.Close()
+	s.Close()
+	assert.Equal(t, 1, (<-s.C).Key)
+	_, open := <-s.C
+	assert.False(t, open)
+}
@@ -0,0 +1,292 @@
+// Package factory builds and inserts rows of registered models for
+// integration tests, creating the parent rows their foreign keys require and
+// filling NOT NULL columns with generated values.
+//
+// Foreign keys and NOT NULL columns are taken from the model metadata (see
+// db.Model), so given
+//
+//	type Order struct {
+//		ID         int64  `db:"id"`
+//		CustomerID int64  `db:"customer_id,ref=customers"`
+//		Number     string `db:"number,notnull"`
+//	}
+//
+// factory.New[Order]().Insert(uow) first inserts a customer, then an order
+// pointing at it with a unique number. Zero primary keys are generated as
+// well, since rows are inserted with every mapped column. Nullable foreign
+// keys not tagged notnull are left NULL, so references may form cycles as
+// long as one of them is nullable.
+package factory
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+// sequence feeds every generated value, keeping them unique within a test run.
+var sequence int64
+
+// Trait customizes the entities of a Builder. Before runs before an entity
+// is completed and inserted, so values it sets are kept; After runs once it
+// has been inserted, typically to create related rows.
+type Trait[T any] struct {
+	Before func(entity *T)
+	After  func(uow db.UnitOfWork, entity *T) error
+}
+
+// Set returns a trait assigning fields of the entity before insert.
+func Set[T any](fn func(entity *T)) Trait[T] {
+	return Trait[T]{Before: fn}
+}
+
+// HasMany returns a trait inserting n children of type C once the parent has
+// been inserted, with their column pointing at the parent's primary key. The
+// trait fails when C has no such column or it cannot hold the key.
+//
+//	func Items(n int) factory.Trait[Order] {
+//		return factory.HasMany[Order, Item](n, "order_id")
+//	}
+func HasMany[T, C any](n int, column string, traits ...Trait[C]) Trait[T] {
+	return Trait[T]{After: func(uow db.UnitOfWork, parent *T) error {
+		parentModel, err := db.ModelOf(parent)
+		if err != nil {
+			return err
+		}
+		childModel, err := db.ModelOf(new(C))
+		if err != nil {
+			return err
+		}
+
+		key := parentModel.KeyOf(parent)
+		if !childModel.Field(new(C), column).IsValid() {
+			return fmt.Errorf("factory: %s has no column %s", childModel.Table, column)
+		}
+		if !assign(childModel.Field(new(C), column), key) {
+			return fmt.Errorf("factory: cannot assign %s key to %s.%s", parentModel.Table, childModel.Table, column)
+		}
+		link := Set(func(child *C) {
+			assign(childModel.Field(child, column), key)
+		})
+
+		_, err = New[C]().With(traits...).With(link).InsertN(uow, n)
+		return err
+	}}
+}
+
+// Builder inserts entities of a registered model T.
+type Builder[T any] struct {
+	traits []Trait[T]
+}
+
+// New returns a builder for T.
+func New[T any]() *Builder[T] {
+	return &Builder[T]{}
+}
+
+// With returns a copy of the builder applying traits, in order, after the
+// builder's own.
+func (b *Builder[T]) With(traits ...Trait[T]) *Builder[T] {
+	combined := make([]Trait[T], 0, len(b.traits)+len(traits))
+	combined = append(combined, b.traits...)
+	return &Builder[T]{traits: append(combined, traits...)}
+}
+
+// Insert builds one entity and inserts it, along with any parent it needs.
+func (b *Builder[T]) Insert(uow db.UnitOfWork) (*T, error) {
+	entity := new(T)
+
+	model, err := db.ModelOf(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trait := range b.traits {
+		if trait.Before != nil {
+			trait.Before(entity)
+		}
+	}
+
+	if err := create(uow, model, entity, nil); err != nil {
+		return nil, err
+	}
+
+	for _, trait := range b.traits {
+		if trait.After != nil {
+			if err := trait.After(uow, entity); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entity, nil
+}
+
+// InsertN inserts n entities.
+func (b *Builder[T]) InsertN(uow db.UnitOfWork, n int) ([]*T, error) {
+	entities := make([]*T, 0, n)
+	for i := 0; i < n; i++ {
+		entity, err := b.Insert(uow)
+		if err != nil {
+			return entities, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, nil
+}
+
+// create completes entity, a pointer to a model struct, and inserts it.
+// visiting lists the tables whose rows are being created for the foreign keys
+// of entity: a required foreign key back to one of them cannot be satisfied.
+func create(uow db.UnitOfWork, model *db.Model, entity interface{}, visiting []string) error {
+	visiting = append(visiting, model.Table)
+
+	required := map[string]bool{}
+	for _, column := range model.Required {
+		required[column] = true
+	}
+
+	for _, column := range model.Columns {
+		table, ok := model.References[column]
+		if !ok {
+			continue
+		}
+
+		field := model.Field(entity, column)
+		if !field.IsZero() || (nullable(field) && !required[column]) {
+			continue
+		}
+
+		for _, visited := range visiting {
+			if visited == table {
+				return fmt.Errorf("factory: cannot create %s, its required foreign keys cycle: %s -> %s",
+					model.Table, strings.Join(visiting, " -> "), table)
+			}
+		}
+
+		parentModel, err := db.ModelForTable(table)
+		if err != nil {
+			return err
+		}
+
+		parent := reflect.New(parentModel.Type).Interface()
+		if err := create(uow, parentModel, parent, visiting); err != nil {
+			return err
+		}
+
+		if !assign(field, parentModel.KeyOf(parent)) {
+			return fmt.Errorf("factory: cannot assign %s key to %s.%s", table, model.Table, column)
+		}
+	}
+
+	for _, column := range append([]string{model.Key}, model.Required...) {
+		if field := model.Field(entity, column); field.IsZero() {
+			generate(field, column)
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (:%s)",
+		model.Table, strings.Join(model.Columns, ", "), strings.Join(model.Columns, ", :"))
+
+	_, err := uow.MustNamedExec(query, entity).RowsAffected()
+	if err != nil {
+		return fmt.Errorf("factory: inserting into %s: %w", model.Table, err)
+	}
+	return nil
+}
+
+// nullable reports pointers and sql.Null-like structs, which can hold NULL.
+func nullable(field reflect.Value) bool {
+	return field.Kind() == reflect.Ptr || validField(field).IsValid()
+}
+
+// validField finds the Valid flag of sql.Null types, including when they are
+// embedded as in the null package.
+func validField(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	if valid := v.FieldByName("Valid"); valid.IsValid() && valid.Kind() == reflect.Bool {
+		return valid
+	}
+	return reflect.Value{}
+}
+
+// valueOf returns the field holding the value of a sql.Null-like struct.
+func valueOf(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Struct && v.NumField() == 1 {
+		v = v.Field(0)
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Name != "Valid" {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// assign stores value in field, converting it and wrapping it in a pointer
+// or sql.Null-like struct as needed.
+func assign(field reflect.Value, value interface{}) bool {
+	v := reflect.ValueOf(value)
+
+	switch {
+	case !v.IsValid():
+		return false
+	case field.Kind() == reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		if !assign(elem.Elem(), value) {
+			return false
+		}
+		field.Set(elem)
+		return true
+	case validField(field).IsValid() && !v.Type().ConvertibleTo(field.Type()):
+		if !assign(valueOf(field), value) {
+			return false
+		}
+		validField(field).SetBool(true)
+		return true
+	case field.Kind() == reflect.String && v.Kind() != reflect.String:
+		// integers convert to strings as runes
+		field.SetString(fmt.Sprint(value))
+		return true
+	case v.Type().ConvertibleTo(field.Type()):
+		field.Set(v.Convert(field.Type()))
+		return true
+	}
+
+	return false
+}
+
+// generate fills field with a unique value derived from column.
+func generate(field reflect.Value, column string) {
+	n := atomic.AddInt64(&sequence, 1)
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(field.Type().Elem())
+		generate(elem.Elem(), column)
+		field.Set(elem)
+	case reflect.String:
+		field.SetString(fmt.Sprintf("%s-%d", column, n))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		field.SetFloat(float64(n))
+	case reflect.Struct:
+		if field.Type() == reflect.TypeOf(time.Time{}) {
+			field.Set(reflect.ValueOf(time.Now().UTC().Truncate(time.Microsecond)))
+			return
+		}
+		if valid := validField(field); valid.IsValid() {
+			generate(valueOf(field), column)
+			valid.SetBool(true)
+		}
+	}
+}
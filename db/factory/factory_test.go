@@ -0,0 +1,185 @@
+package factory
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/helderfarias/sqlx-wrapper/null"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type customer struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name,notnull"`
+}
+
+type order struct {
+	ID         int64       `db:"id"`
+	CustomerID int64       `db:"customer_id,ref=customers"`
+	Number     null.String `db:"number,notnull"`
+	Note       *string     `db:"note"`
+}
+
+type item struct {
+	Code    string         `db:"code,pk"`
+	OrderID sql.NullInt64  `db:"order_id,ref=orders"`
+	Gift    sql.NullString `db:"gift"`
+}
+
+func init() {
+	db.MustRegister(customer{}, "customers")
+	db.MustRegister(order{}, "orders")
+	db.MustRegister(item{}, "items")
+}
+
+func newMockUnitOfWork(t *testing.T) (db.UnitOfWork, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return db.NewUnitOfWork(sqlx.NewDb(conn, "sqlmock"), nil), mock
+}
+
+func TestShouldCreateRequiredParentsAndFillNotNullColumns(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO customers \(id, name\) VALUES \(\?, \?\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO orders \(id, customer_id, number, note\) VALUES \(\?, \?, \?, \?\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	o, err := New[order]().Insert(uow)
+
+	assert.NoError(t, err)
+	assert.NotZero(t, o.ID)
+	assert.NotZero(t, o.CustomerID)
+	assert.True(t, o.Number.Valid)
+	assert.Contains(t, o.Number.String, "number-")
+	assert.Nil(t, o.Note)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldKeepValuesSetByTraits(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO orders`).
+		WithArgs(int64(42), int64(7), "A-1", nil).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	o, err := New[order]().With(Set(func(o *order) {
+		o.ID = 42
+		o.CustomerID = 7
+		o.Number = null.StringFrom("A-1")
+	})).Insert(uow)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), o.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func items(n int) Trait[order] {
+	return HasMany[order, item](n, "order_id")
+}
+
+func TestShouldCreateChildrenPointingAtParent(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO orders`).WillReturnResult(sqlmock.NewResult(1, 1))
+	for i := 0; i < 3; i++ {
+		mock.ExpectExec(`INSERT INTO items \(code, order_id, gift\)`).
+			WithArgs(sqlmock.AnyArg(), int64(5), nil).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	_, err := New[order]().With(Set(func(o *order) {
+		o.ID = 5
+		o.CustomerID = 1
+	}), items(3)).Insert(uow)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLeaveOptionalReferencesNull(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO items`).
+		WithArgs(sqlmock.AnyArg(), nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	i, err := New[item]().Insert(uow)
+
+	assert.NoError(t, err)
+	assert.False(t, i.OrderID.Valid)
+	assert.Contains(t, i.Code, "code-")
+}
+
+func TestShouldReportInsertFailures(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO customers`).WillReturnError(assert.AnError)
+
+	_, err := New[customer]().Insert(uow)
+
+	assert.True(t, errors.Is(err, assert.AnError))
+}
+
+type employee struct {
+	ID        int64         `db:"id"`
+	ManagerID sql.NullInt64 `db:"manager_id,ref=employees"`
+}
+
+type account struct {
+	ID      int64 `db:"id"`
+	OwnerID int64 `db:"owner_id,ref=owners"`
+}
+
+type owner struct {
+	ID        int64 `db:"id"`
+	AccountID int64 `db:"account_id,ref=accounts"`
+}
+
+func init() {
+	db.MustRegister(employee{}, "employees")
+	db.MustRegister(account{}, "accounts")
+	db.MustRegister(owner{}, "owners")
+}
+
+func TestShouldStopReferenceCyclesAtNullableColumns(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO employees`).
+		WithArgs(sqlmock.AnyArg(), nil).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	e, err := New[employee]().Insert(uow)
+
+	assert.NoError(t, err)
+	assert.False(t, e.ManagerID.Valid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectRequiredReferenceCycles(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	_, err := New[account]().Insert(uow)
+
+	assert.EqualError(t, err, "factory: cannot create owners, its required foreign keys cycle: accounts -> owners -> accounts")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReportUnknownChildColumns(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+
+	mock.ExpectExec(`INSERT INTO orders`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	_, err := New[order]().With(Set(func(o *order) {
+		o.ID = 5
+		o.CustomerID = 1
+	}), HasMany[order, item](2, "order")).Insert(uow)
+
+	assert.EqualError(t, err, "factory: items has no column order")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ForeignServer declares a postgres_fdw server, the user mapping to reach it
+// and the foreign tables read through it.
+type ForeignServer struct {
+	Name   string
+	Host   string
+	Port   int
+	DBName string
+
+	// Options are further server options, e.g. fetch_size or
+	// use_remote_estimate.
+	Options map[string]string
+
+	// User and Password are the remote credentials mapped to the current
+	// user. An empty Password leaves authentication to the remote server's
+	// configuration.
+	User     string
+	Password string
+
+	Tables []ForeignTable
+
+	// Imports lists remote schemas whose tables are all imported as foreign
+	// tables, keeping their names.
+	Imports []ForeignSchemaImport
+}
+
+// ForeignTable declares a local foreign table over a remote one.
+type ForeignTable struct {
+	// Name is the local table, schema qualified if needed.
+	Name string
+
+	// RemoteSchema defaults to public, RemoteTable to the unqualified Name.
+	RemoteSchema string
+	RemoteTable  string
+
+	Columns []ForeignColumn
+}
+
+// ForeignColumn is a column of a foreign table. Type is a Postgres type, e.g.
+// "bigint NOT NULL".
+type ForeignColumn struct {
+	Name string
+	Type string
+}
+
+// ForeignSchemaImport imports the tables of RemoteSchema, or only those of
+// LimitTo, into the local schema Into.
+type ForeignSchemaImport struct {
+	RemoteSchema string
+	Into         string
+	LimitTo      []string
+}
+
+// SetupForeignServer makes db match server, in one transaction: it installs
+// postgres_fdw, creates the server or brings its options in line, maps the
+// current user, and recreates the declared foreign tables so that column
+// changes apply. Running it again with the same declaration changes nothing
+// visible, so it can run on every deploy. Views over recreated tables make it
+// fail rather than being dropped.
+func SetupForeignServer(ctx context.Context, db *sqlx.DB, server ForeignServer) error {
+	if err := requirePostgres(db, "foreign servers"); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := DialectPostgres.Quote
+	name := q(server.Name)
+
+	exec := func(query string) error {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("db: setting up foreign server %s: %w", server.Name, err)
+		}
+		return nil
+	}
+
+	if err := exec("CREATE EXTENSION IF NOT EXISTS postgres_fdw"); err != nil {
+		return err
+	}
+
+	wanted := map[string]string{}
+	for k, v := range server.Options {
+		wanted[k] = v
+	}
+	wanted["host"] = server.Host
+	wanted["dbname"] = server.DBName
+	if server.Port != 0 {
+		wanted["port"] = strconv.Itoa(server.Port)
+	}
+
+	var exists bool
+	if err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM pg_foreign_server WHERE srvname = $1)", server.Name); err != nil {
+		return err
+	}
+
+	if !exists {
+		if err := exec(fmt.Sprintf("CREATE SERVER %s FOREIGN DATA WRAPPER postgres_fdw OPTIONS (%s)", name, fdwOptions("", wanted))); err != nil {
+			return err
+		}
+	} else {
+		have, err := fdwCurrentOptions(ctx, tx, "SELECT srvoptions FROM pg_foreign_server WHERE srvname = $1", server.Name)
+		if err != nil {
+			return err
+		}
+		if changes := fdwOptionChanges(have, wanted); len(changes) > 0 {
+			if err := exec(fmt.Sprintf("ALTER SERVER %s OPTIONS (%s)", name, strings.Join(changes, ", "))); err != nil {
+				return err
+			}
+		}
+	}
+
+	credentials := map[string]string{"user": server.User}
+	if server.Password != "" {
+		credentials["password"] = server.Password
+	}
+	if err := exec(fmt.Sprintf("CREATE USER MAPPING IF NOT EXISTS FOR CURRENT_USER SERVER %s OPTIONS (%s)",
+		name, fdwOptions("", credentials))); err != nil {
+		return err
+	}
+	have, err := fdwCurrentOptions(ctx, tx, "SELECT umoptions FROM pg_user_mappings WHERE srvname = $1 AND usename = CURRENT_USER", server.Name)
+	if err != nil {
+		return err
+	}
+	if changes := fdwOptionChanges(have, credentials); len(changes) > 0 {
+		if err := exec(fmt.Sprintf("ALTER USER MAPPING FOR CURRENT_USER SERVER %s OPTIONS (%s)",
+			name, strings.Join(changes, ", "))); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range server.Tables {
+		if err := exec(fmt.Sprintf("DROP FOREIGN TABLE IF EXISTS %s", q(table.Name))); err != nil {
+			return err
+		}
+		if err := exec(createForeignTable(server.Name, table)); err != nil {
+			return err
+		}
+	}
+
+	for _, imp := range server.Imports {
+		var imported []string
+		err := sqlx.SelectContext(ctx, tx, &imported, "SELECT c.relname FROM pg_class c "+
+			"JOIN pg_namespace n ON n.oid = c.relnamespace WHERE n.nspname = $1 AND c.relkind = 'f'", imp.Into)
+		if err != nil {
+			return err
+		}
+		if query := importForeignSchema(server.Name, imp, imported); query != "" {
+			if err := exec(query); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// fdwCurrentOptions returns the options in the array selected by query, e.g.
+// the srvoptions of a server.
+func fdwCurrentOptions(ctx context.Context, tx *sqlx.Tx, query string, arg interface{}) (map[string]string, error) {
+	var current []struct {
+		Name  string `db:"option_name"`
+		Value string `db:"option_value"`
+	}
+	err := sqlx.SelectContext(ctx, tx, &current, "SELECT option_name, option_value FROM pg_options_to_table(("+query+"))", arg)
+	if err != nil {
+		return nil, err
+	}
+
+	have := make(map[string]string, len(current))
+	for _, o := range current {
+		have[o.Name] = o.Value
+	}
+	return have, nil
+}
+
+// fdwOptionChanges returns the clauses of an ALTER ... OPTIONS turning the
+// options have into wanted: SET only applies to options already there, ADD
+// to the others.
+func fdwOptionChanges(have, wanted map[string]string) []string {
+	var changes []string
+	for _, k := range sortedKeys(have) {
+		if _, ok := wanted[k]; !ok {
+			changes = append(changes, "DROP "+k)
+		}
+	}
+	for _, k := range sortedKeys(wanted) {
+		if v, ok := have[k]; !ok {
+			changes = append(changes, "ADD "+k+" "+quoteString(DialectPostgres, wanted[k]))
+		} else if v != wanted[k] {
+			changes = append(changes, "SET "+k+" "+quoteString(DialectPostgres, wanted[k]))
+		}
+	}
+	return changes
+}
+
+// DropForeignServer drops the server with its user mappings and every
+// foreign table over it.
+func DropForeignServer(ctx context.Context, db *sqlx.DB, name string) error {
+	_, err := db.ExecContext(ctx, "DROP SERVER IF EXISTS "+DialectPostgres.Quote(name)+" CASCADE")
+	return err
+}
+
+func createForeignTable(server string, table ForeignTable) string {
+	q := DialectPostgres.Quote
+
+	columns := make([]string, len(table.Columns))
+	for i, c := range table.Columns {
+		columns[i] = q(c.Name) + " " + c.Type
+	}
+
+	remoteSchema, remoteTable := table.RemoteSchema, table.RemoteTable
+	if remoteSchema == "" {
+		remoteSchema = "public"
+	}
+	if remoteTable == "" {
+		remoteTable = table.Name[strings.LastIndexByte(table.Name, '.')+1:]
+	}
+
+	return fmt.Sprintf("CREATE FOREIGN TABLE %s (%s) SERVER %s OPTIONS (%s)",
+		q(table.Name), strings.Join(columns, ", "), q(server),
+		fdwOptions("", map[string]string{"schema_name": remoteSchema, "table_name": remoteTable}))
+}
+
+// importForeignSchema leaves out the tables already imported, so that it can
+// run again; tables changed remotely must be dropped to be imported anew. It
+// returns "" when there is nothing left to import.
+func importForeignSchema(server string, imp ForeignSchemaImport, imported []string) string {
+	q := DialectPostgres.Quote
+	quoteAll := func(tables []string) string {
+		quoted := make([]string, len(tables))
+		for i, t := range tables {
+			quoted[i] = q(t)
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	query := "IMPORT FOREIGN SCHEMA " + q(imp.RemoteSchema)
+	switch {
+	case len(imp.LimitTo) > 0:
+		var missing []string
+		for _, t := range imp.LimitTo {
+			if indexOf(imported, t) < 0 {
+				missing = append(missing, t)
+			}
+		}
+		if len(missing) == 0 {
+			return ""
+		}
+		query += " LIMIT TO (" + quoteAll(missing) + ")"
+	case len(imported) > 0:
+		query += " EXCEPT (" + quoteAll(imported) + ")"
+	}
+	return query + fmt.Sprintf(" FROM SERVER %s INTO %s OPTIONS (import_default 'false')", q(server), q(imp.Into))
+}
+
+// fdwOptions renders options in key order, each prefixed with action.
+func fdwOptions(action string, options map[string]string) string {
+	rendered := make([]string, 0, len(options))
+	for _, k := range sortedKeys(options) {
+		rendered = append(rendered, action+k+" "+quoteString(DialectPostgres, options[k]))
+	}
+	return strings.Join(rendered, ", ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
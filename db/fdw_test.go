@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func billingServer() ForeignServer {
+	return ForeignServer{
+		Name: "billing", Host: "billing.internal", Port: 5432, DBName: "billing",
+		Options: map[string]string{"fetch_size": "1000"},
+		User:    "reporting", Password: "it's secret",
+		Tables: []ForeignTable{{
+			Name:    "reporting.invoices",
+			Columns: []ForeignColumn{{Name: "id", Type: "bigint NOT NULL"}, {Name: "total", Type: "numeric"}},
+		}},
+		Imports: []ForeignSchemaImport{{RemoteSchema: "public", Into: "billing", LimitTo: []string{"plans", "taxes"}}},
+	}
+}
+
+func TestShouldCreateForeignServerAndTables(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE EXTENSION IF NOT EXISTS postgres_fdw").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WithArgs("billing").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`CREATE SERVER "billing" FOREIGN DATA WRAPPER postgres_fdw ` +
+		`OPTIONS \(dbname 'billing', fetch_size '1000', host 'billing.internal', port '5432'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE USER MAPPING IF NOT EXISTS FOR CURRENT_USER SERVER "billing" ` +
+		`OPTIONS \(password 'it''s secret', user 'reporting'\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT option_name, option_value FROM pg_options_to_table\(\(SELECT umoptions FROM pg_user_mappings`).
+		WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"option_name", "option_value"}).AddRow("user", "reporting").AddRow("password", "it's secret"))
+	mock.ExpectExec(`DROP FOREIGN TABLE IF EXISTS "reporting"."invoices"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE FOREIGN TABLE "reporting"."invoices" \("id" bigint NOT NULL, "total" numeric\) ` +
+		`SERVER "billing" OPTIONS \(schema_name 'public', table_name 'invoices'\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT c.relname FROM pg_class").WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"relname"}).AddRow("plans"))
+	mock.ExpectExec(`IMPORT FOREIGN SCHEMA "public" LIMIT TO \("taxes"\) FROM SERVER "billing" INTO "billing"`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Nil(t, SetupForeignServer(context.Background(), database, billingServer()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldAlignOptionsOfExistingForeignServer(t *testing.T) {
+	server := billingServer()
+	server.Tables, server.Imports = nil, nil
+
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE EXTENSION").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT EXISTS").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT option_name, option_value FROM pg_options_to_table").WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"option_name", "option_value"}).
+			AddRow("host", "old.internal").AddRow("dbname", "billing").AddRow("port", "5432").AddRow("use_remote_estimate", "true"))
+	mock.ExpectExec(`ALTER SERVER "billing" OPTIONS \(DROP use_remote_estimate, ADD fetch_size '1000', SET host 'billing.internal'\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE USER MAPPING").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT umoptions FROM pg_user_mappings").WithArgs("billing").
+		WillReturnRows(sqlmock.NewRows([]string{"option_name", "option_value"}).AddRow("user", "etl"))
+	mock.ExpectExec(`ALTER USER MAPPING FOR CURRENT_USER SERVER "billing" ` +
+		`OPTIONS \(ADD password 'it''s secret', SET user 'reporting'\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Nil(t, SetupForeignServer(context.Background(), database, server))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldImportWholeSchemaExceptImportedTables(t *testing.T) {
+	imp := ForeignSchemaImport{RemoteSchema: "public", Into: "billing"}
+
+	assert.Equal(t, `IMPORT FOREIGN SCHEMA "public" EXCEPT ("plans") FROM SERVER "billing" INTO "billing" OPTIONS (import_default 'false')`,
+		importForeignSchema("billing", imp, []string{"plans"}))
+
+	imp.LimitTo = []string{"plans"}
+	assert.Equal(t, "", importForeignSchema("billing", imp, []string{"plans"}))
+}
+
+func TestShouldRefuseForeignServersOutsidePostgres(t *testing.T) {
+	database, _ := newMockDatabase(t, "mysql")
+
+	assert.EqualError(t, SetupForeignServer(context.Background(), database, billingServer()),
+		"db: foreign servers require postgres, not mysql")
+}
@@ -0,0 +1,426 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FilterOp is a comparison operator of the filter language.
+type FilterOp string
+
+// Operators understood by FilterCompiler.
+const (
+	OpEq   FilterOp = "eq"
+	OpNe   FilterOp = "ne"
+	OpGt   FilterOp = "gt"
+	OpGe   FilterOp = "ge"
+	OpLt   FilterOp = "lt"
+	OpLe   FilterOp = "le"
+	OpIn   FilterOp = "in"
+	OpLike FilterOp = "like"
+)
+
+var filterOperators = map[FilterOp]string{
+	OpEq:   "=",
+	OpNe:   "<>",
+	OpGt:   ">",
+	OpGe:   ">=",
+	OpLt:   "<",
+	OpLe:   "<=",
+	OpIn:   "IN",
+	OpLike: "LIKE",
+}
+
+// ErrInvalidFilter is returned, wrapped, for every malformed or disallowed filter.
+var ErrInvalidFilter = errors.New("db: invalid filter")
+
+// FilterField whitelists a field for filtering.
+type FilterField struct {
+	// Column is the SQL expression the field maps to. It is trusted and
+	// written verbatim.
+	Column string
+
+	// Operators allowed on the field. Empty means eq and ne only.
+	Operators []FilterOp
+
+	// Convert optionally turns a literal (string, int64, float64 or bool)
+	// into the value bound for the column, e.g. parsing a timestamp.
+	Convert func(value interface{}) (interface{}, error)
+}
+
+func (f FilterField) allows(op FilterOp) bool {
+	if len(f.Operators) == 0 {
+		return op == OpEq || op == OpNe
+	}
+
+	for _, allowed := range f.Operators {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterCompiler translates API filter expressions such as
+//
+//	status eq 'open' and (total gt 100 or vip eq true)
+//
+// into parameterized WHERE clauses. Only whitelisted fields and operators are
+// accepted and every literal becomes a bind argument.
+type FilterCompiler struct {
+	fields   map[string]FilterField
+	maxTerms int
+}
+
+// NewFilterCompiler creates a compiler for the given API field names.
+func NewFilterCompiler(fields map[string]FilterField) *FilterCompiler {
+	return &FilterCompiler{fields: fields, maxTerms: 32}
+}
+
+// Filter is a compiled filter expression. Clause uses ? placeholders.
+type Filter struct {
+	Clause string
+	Args   []interface{}
+}
+
+// AppendTo appends the filter to query as a WHERE clause. An empty filter
+// leaves query untouched.
+func (f *Filter) AppendTo(query string) string {
+	if f == nil || f.Clause == "" {
+		return query
+	}
+	return query + " WHERE " + f.Clause
+}
+
+// SelectFilter appends filter to query, rebinds it for the driver and runs it
+// through uow.Select. args bind the placeholders of query itself.
+func SelectFilter(uow UnitOfWork, dest interface{}, query string, filter *Filter, args ...interface{}) error {
+	all := args
+	if filter != nil {
+		all = append(append([]interface{}{}, args...), filter.Args...)
+	}
+
+	return uow.Select(dest, uow.Rebind(filter.AppendTo(query)), all...)
+}
+
+// Compile parses expression. A blank expression compiles to an empty filter.
+func (c *FilterCompiler) Compile(expression string) (*Filter, error) {
+	tokens, err := tokenizeFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return &Filter{}, nil
+	}
+
+	p := &filterParser{compiler: c, tokens: tokens}
+	clause, disjunction, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	// keep a top-level OR grouped so callers can safely AND the clause.
+	if disjunction {
+		clause = "(" + clause + ")"
+	}
+
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+
+	return &Filter{Clause: clause, Args: p.args}, nil
+}
+
+type filterTokenKind int
+
+const (
+	tokenWord filterTokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+func tokenizeFilter(src string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(src); {
+		r := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{tokenOpen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{tokenClose, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{tokenComma, ",", i})
+			i++
+		case r == '\'':
+			var sb strings.Builder
+			start := i
+			i++
+			for {
+				if i >= len(src) {
+					return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidFilter, start)
+				}
+				if src[i] == '\'' {
+					if i+1 < len(src) && src[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenString, sb.String(), start})
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenNumber, src[start:i], start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(src) && (src[i] == '_' || src[i] == '.' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, filterToken{tokenWord, src[start:i], start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at %d", ErrInvalidFilter, r, i)
+		}
+	}
+
+	return tokens, nil
+}
+
+type filterParser struct {
+	compiler *FilterCompiler
+	tokens   []filterToken
+	pos      int
+	terms    int
+	args     []interface{}
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{kind: -1, pos: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidFilter, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) parseOr() (string, bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", false, err
+	}
+
+	parts := []string{left}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", false, err
+		}
+		parts = append(parts, right)
+	}
+
+	return strings.Join(parts, " OR "), len(parts) > 1, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, _, err := p.parseFactor()
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{left}
+	for p.keyword("and") {
+		right, _, err := p.parseFactor()
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, right)
+	}
+
+	return strings.Join(parts, " AND "), nil
+}
+
+// parseFactor returns the SQL for a single factor and whether it is already
+// enclosed in parentheses.
+func (p *filterParser) parseFactor() (string, bool, error) {
+	if p.keyword("not") {
+		inner, grouped, err := p.parseFactor()
+		if err != nil {
+			return "", false, err
+		}
+		if grouped {
+			return "NOT " + inner, false, nil
+		}
+		return "NOT (" + inner + ")", false, nil
+	}
+
+	if p.peek().kind == tokenOpen {
+		p.next()
+		inner, _, err := p.parseOr()
+		if err != nil {
+			return "", false, err
+		}
+		if p.next().kind != tokenClose {
+			return "", false, p.errorf("missing closing parenthesis")
+		}
+		return "(" + inner + ")", true, nil
+	}
+
+	clause, err := p.parseComparison()
+	return clause, false, err
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	p.terms++
+	if p.terms > p.compiler.maxTerms {
+		return "", p.errorf("more than %d comparisons", p.compiler.maxTerms)
+	}
+
+	name := p.next()
+	if name.kind != tokenWord {
+		return "", p.errorf("expected a field at %d", name.pos)
+	}
+
+	field, ok := p.compiler.fields[name.text]
+	if !ok {
+		return "", p.errorf("unknown field %q", name.text)
+	}
+
+	opToken := p.next()
+	op := FilterOp(strings.ToLower(opToken.text))
+	sqlOp, ok := filterOperators[op]
+	if opToken.kind != tokenWord || !ok {
+		return "", p.errorf("expected an operator after %q", name.text)
+	}
+
+	if !field.allows(op) {
+		return "", p.errorf("operator %s is not allowed on %q", op, name.text)
+	}
+
+	if op == OpIn {
+		return p.parseList(field)
+	}
+
+	if p.keyword("null") {
+		switch op {
+		case OpEq:
+			return field.Column + " IS NULL", nil
+		case OpNe:
+			return field.Column + " IS NOT NULL", nil
+		default:
+			return "", p.errorf("null can only be compared with eq or ne")
+		}
+	}
+
+	if err := p.bindValue(field); err != nil {
+		return "", err
+	}
+
+	return field.Column + " " + sqlOp + " ?", nil
+}
+
+func (p *filterParser) parseList(field FilterField) (string, error) {
+	if p.next().kind != tokenOpen {
+		return "", p.errorf("in expects a parenthesized list")
+	}
+
+	count := 0
+	for {
+		if err := p.bindValue(field); err != nil {
+			return "", err
+		}
+		count++
+
+		t := p.next()
+		if t.kind == tokenClose {
+			break
+		}
+		if t.kind != tokenComma {
+			return "", p.errorf("malformed list for %q", field.Column)
+		}
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", count), ", ")
+	return field.Column + " IN (" + placeholders + ")", nil
+}
+
+func (p *filterParser) bindValue(field FilterField) error {
+	t := p.next()
+
+	var value interface{}
+	switch {
+	case t.kind == tokenString:
+		value = t.text
+	case t.kind == tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			value = i
+		} else if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			value = f
+		} else {
+			return p.errorf("invalid number %q", t.text)
+		}
+	case t.kind == tokenWord && strings.EqualFold(t.text, "true"):
+		value = true
+	case t.kind == tokenWord && strings.EqualFold(t.text, "false"):
+		value = false
+	default:
+		return p.errorf("expected a value at %d", t.pos)
+	}
+
+	if field.Convert != nil {
+		converted, err := field.Convert(value)
+		if err != nil {
+			return p.errorf("invalid value for %q: %v", field.Column, err)
+		}
+		value = converted
+	}
+
+	p.args = append(p.args, value)
+	return nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newOrderFilters() *FilterCompiler {
+	return NewFilterCompiler(map[string]FilterField{
+		"status": {Column: "o.status", Operators: []FilterOp{OpEq, OpNe, OpIn}},
+		"total":  {Column: "o.total", Operators: []FilterOp{OpGt, OpLt}},
+		"created_at": {
+			Column:    "o.created_at",
+			Operators: []FilterOp{OpGt, OpLt},
+			Convert: func(v interface{}) (interface{}, error) {
+				s, ok := v.(string)
+				if !ok {
+					return nil, errors.New("expected a date")
+				}
+				return time.Parse("2006-01-02", s)
+			},
+		},
+		"deleted_at": {Column: "o.deleted_at"},
+	})
+}
+
+func TestShouldCompileFilterIntoParameterizedClause(t *testing.T) {
+	filter, err := newOrderFilters().Compile(`status eq 'open' and created_at gt '2024-01-01'`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "o.status = ? AND o.created_at > ?", filter.Clause)
+	assert.Equal(t, "open", filter.Args[0])
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), filter.Args[1])
+}
+
+func TestShouldCompileGroupingListsAndNulls(t *testing.T) {
+	filter, err := newOrderFilters().Compile(`not (status in ('a', 'it''s') or total lt 10.5) and deleted_at eq null`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "NOT (o.status IN (?, ?) OR o.total < ?) AND o.deleted_at IS NULL", filter.Clause)
+	assert.Equal(t, []interface{}{"a", "it's", 10.5}, filter.Args)
+}
+
+func TestShouldRejectDisallowedFilters(t *testing.T) {
+	compiler := newOrderFilters()
+
+	for _, expression := range []string{
+		`password eq 'x'`,
+		`total eq 1`,
+		`status eq 'open'; drop table orders`,
+		`status eq 'open`,
+		`created_at gt 5`,
+		`(status eq 'a'`,
+		`total gt null`,
+	} {
+		_, err := compiler.Compile(expression)
+		assert.True(t, errors.Is(err, ErrInvalidFilter), expression)
+	}
+}
+
+func TestShouldSelectWithFilter(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	filter, _ := newOrderFilters().Compile(`status eq 'open'`)
+
+	mock.ExpectQuery(`SELECT id, status FROM orders o WHERE o.status = \?`).
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+
+	var orders []repositoryOrder
+	err := SelectFilter(uw, &orders, "SELECT id, status FROM orders o", filter)
+
+	assert.Nil(t, err)
+	assert.Len(t, orders, 1)
+}
+
+func TestShouldGroupTopLevelDisjunction(t *testing.T) {
+	filter, err := newOrderFilters().Compile(`status eq 'a' or status eq 'b'`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "(o.status = ? OR o.status = ?)", filter.Clause)
+}
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ShardQuery is a query run on every shard by the Gather functions.
+type ShardQuery struct {
+	Query string
+	Args  []interface{}
+}
+
+// GatherConfig bounds the memory GatherJoin uses.
+type GatherConfig struct {
+	// MaxMemoryRows is the number of rows of the build side kept in memory.
+	// Past it both sides spill to partition files, and are joined one
+	// partition at a time. Zero means 100000.
+	MaxMemoryRows int
+
+	// Partitions is the number of partition files per side once spilled.
+	// Zero means 32.
+	Partitions int
+
+	// TempDir holds the partition files. Empty means os.TempDir().
+	TempDir string
+}
+
+func (c *GatherConfig) defaults() {
+	if c.MaxMemoryRows <= 0 {
+		c.MaxMemoryRows = 100000
+	}
+	if c.Partitions <= 0 {
+		c.Partitions = 32
+	}
+}
+
+// Gather runs query on every shard concurrently and calls fn with the rows as
+// they arrive, scanned into a T like SelectStream does, and the index of their
+// shard. fn is called from one goroutine at a time. The first error of a
+// shard or of fn cancels the other shards and is returned, as is the error of
+// ctx when it is done before every row was gathered.
+func Gather[T any](ctx context.Context, shards []UnitOfWork, query ShardQuery, fn func(shard int, row T) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type gathered struct {
+		shard int
+		row   T
+	}
+	rows := make(chan gathered, 256)
+	failed := make(chan error, len(shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row, err := range SelectStream[T](ctx, shard, query.Query, query.Args...) {
+				if err != nil {
+					failed <- fmt.Errorf("db: shard %d: %w", i, err)
+					cancel()
+					return
+				}
+				select {
+				case rows <- gathered{i, row}:
+				case <-ctx.Done():
+					failed <- ctx.Err()
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(rows)
+	}()
+
+	for r := range rows {
+		if err := fn(r.shard, r.row); err != nil {
+			cancel()
+			for range rows {
+			}
+			return err
+		}
+	}
+
+	select {
+	case err := <-failed:
+		return err
+	default:
+		return nil
+	}
+}
+
+// GatherJoin joins the rows of left and right, each gathered from every
+// shard, on equal keys, calling fn with every matching pair: a hash join run
+// by the application, for data spread over shards the database cannot join.
+// The rows of right are hashed in memory, then the rows of left probe them as
+// they arrive.
+//
+// When right has more than MaxMemoryRows rows, both sides are spilled to
+// partition files by key and joined one partition at a time, which bounds
+// memory by the largest partition rather than the whole table. Spilled rows
+// are encoded with encoding/gob, so L and R must be gob-encodable, e.g.
+// structs with exported fields; pairs then reach fn in partition order.
+// Keep the smaller side as right.
+func GatherJoin[L, R any, K comparable](ctx context.Context, shards []UnitOfWork, left ShardQuery, leftKey func(L) K,
+	right ShardQuery, rightKey func(R) K, config GatherConfig, fn func(L, R) error) error {
+	config.defaults()
+
+	table := map[K][]R{}
+	size := 0
+	var built *spill[R]
+	defer func() { built.close() }()
+
+	err := Gather(ctx, shards, right, func(_ int, row R) error {
+		if built != nil {
+			return built.write(joinPartition(rightKey(row), config.Partitions), row)
+		}
+
+		key := rightKey(row)
+		table[key] = append(table[key], row)
+		if size++; size <= config.MaxMemoryRows {
+			return nil
+		}
+
+		var err error
+		if built, err = newSpill[R](config.TempDir, config.Partitions); err != nil {
+			return err
+		}
+		for key, rows := range table {
+			for _, r := range rows {
+				if err := built.write(joinPartition(key, config.Partitions), r); err != nil {
+					return err
+				}
+			}
+		}
+		table = nil
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if built == nil {
+		return Gather(ctx, shards, left, func(_ int, row L) error {
+			return probe(table, row, leftKey(row), fn)
+		})
+	}
+
+	probed, err := newSpill[L](config.TempDir, config.Partitions)
+	if err != nil {
+		return err
+	}
+	defer probed.close()
+
+	if err := Gather(ctx, shards, left, func(_ int, row L) error {
+		return probed.write(joinPartition(leftKey(row), config.Partitions), row)
+	}); err != nil {
+		return err
+	}
+
+	for p := 0; p < config.Partitions; p++ {
+		table := map[K][]R{}
+		if err := built.read(p, func(row R) error {
+			key := rightKey(row)
+			table[key] = append(table[key], row)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := probed.read(p, func(row L) error {
+			return probe(table, row, leftKey(row), fn)
+		}); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func probe[L, R any, K comparable](table map[K][]R, row L, key K, fn func(L, R) error) error {
+	for _, r := range table[key] {
+		if err := fn(row, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GatherAggregate folds the rows of query, gathered from every shard, into
+// one accumulator per key, e.g. the revenue per customer, starting each from
+// the zero A. The groups are kept in memory.
+func GatherAggregate[T any, K comparable, A any](ctx context.Context, shards []UnitOfWork, query ShardQuery,
+	key func(T) K, fold func(acc A, row T) A) (map[K]A, error) {
+	groups := map[K]A{}
+	err := Gather(ctx, shards, query, func(_ int, row T) error {
+		k := key(row)
+		groups[k] = fold(groups[k], row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// joinPartition spreads keys over n partitions, the same on both sides.
+func joinPartition[K comparable](key K, n int) int {
+	return partitionOf([]byte(fmt.Sprintf("%#v", key)), n)
+}
+
+// spill is a set of partition files of gob-encoded rows.
+type spill[T any] struct {
+	files    []*os.File
+	writers  []*bufio.Writer
+	encoders []*gob.Encoder
+}
+
+func newSpill[T any](dir string, n int) (*spill[T], error) {
+	s := &spill[T]{}
+	for i := 0; i < n; i++ {
+		f, err := os.CreateTemp(dir, "sqlx-wrapper-join-*")
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("db: spilling join: %w", err)
+		}
+		w := bufio.NewWriter(f)
+		s.files = append(s.files, f)
+		s.writers = append(s.writers, w)
+		s.encoders = append(s.encoders, gob.NewEncoder(w))
+	}
+	return s, nil
+}
+
+func (s *spill[T]) write(p int, row T) error {
+	if err := s.encoders[p].Encode(row); err != nil {
+		return fmt.Errorf("db: spilling join: %w", err)
+	}
+	return nil
+}
+
+// read calls fn with the rows of partition p, once its writes are done.
+func (s *spill[T]) read(p int, fn func(T) error) error {
+	if err := s.writers[p].Flush(); err != nil {
+		return err
+	}
+	if _, err := s.files[p].Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	decoder := gob.NewDecoder(bufio.NewReader(s.files[p]))
+	for {
+		// a fresh row each time: gob leaves the fields of zero values alone
+		var row T
+		if err := decoder.Decode(&row); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("db: reading spilled join: %w", err)
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// close removes the partition files. It is nil-safe.
+func (s *spill[T]) close() {
+	if s == nil {
+		return
+	}
+	for _, f := range s.files {
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type gatheredCustomer struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type gatheredInvoice struct {
+	CustomerID int64 `db:"customer_id"`
+	Total      int64 `db:"total"`
+}
+
+// newMockShards returns units of work over sqlmock databases, one per shard.
+func newMockShards(t *testing.T, n int) ([]UnitOfWork, []sqlmock.Sqlmock) {
+	shards := make([]UnitOfWork, n)
+	mocks := make([]sqlmock.Sqlmock, n)
+	for i := range shards {
+		uw, mock := newMockUnitOfWork(t)
+		shards[i], mocks[i] = uw, mock
+	}
+	return shards, mocks
+}
+
+func expectShardJoin(mocks []sqlmock.Sqlmock) {
+	mocks[0].ExpectQuery(`^SELECT id, name FROM customers$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "ada").AddRow(2, "alan"))
+	mocks[0].ExpectQuery(`^SELECT customer_id, total FROM invoices$`).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id", "total"}).AddRow(2, 30).AddRow(3, 5))
+	mocks[1].ExpectQuery(`^SELECT id, name FROM customers$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "grace"))
+	mocks[1].ExpectQuery(`^SELECT customer_id, total FROM invoices$`).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id", "total"}).AddRow(1, 10).AddRow(1, 20).AddRow(4, 99))
+}
+
+func joinCustomerInvoices(t *testing.T, shards []UnitOfWork, config GatherConfig) []string {
+	var joined []string
+	err := GatherJoin(context.Background(), shards,
+		ShardQuery{Query: "SELECT customer_id, total FROM invoices"}, func(i gatheredInvoice) int64 { return i.CustomerID },
+		ShardQuery{Query: "SELECT id, name FROM customers"}, func(c gatheredCustomer) int64 { return c.ID },
+		config, func(i gatheredInvoice, c gatheredCustomer) error {
+			joined = append(joined, fmt.Sprintf("%s:%d", c.Name, i.Total))
+			return nil
+		})
+	assert.Nil(t, err)
+	sort.Strings(joined)
+	return joined
+}
+
+func TestShouldHashJoinRowsGatheredFromShards(t *testing.T) {
+	shards, mocks := newMockShards(t, 2)
+	expectShardJoin(mocks)
+
+	joined := joinCustomerInvoices(t, shards, GatherConfig{})
+
+	assert.Equal(t, []string{"ada:10", "ada:20", "alan:30", "grace:5"}, joined)
+	for _, mock := range mocks {
+		assert.Nil(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShouldSpillJoinsPastTheMemoryLimit(t *testing.T) {
+	shards, mocks := newMockShards(t, 2)
+	expectShardJoin(mocks)
+	dir := t.TempDir()
+
+	joined := joinCustomerInvoices(t, shards, GatherConfig{MaxMemoryRows: 1, Partitions: 2, TempDir: dir})
+
+	assert.Equal(t, []string{"ada:10", "ada:20", "alan:30", "grace:5"}, joined)
+	files, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, files, "partition files are removed")
+}
+
+func TestShouldAggregateRowsGatheredFromShards(t *testing.T) {
+	shards, mocks := newMockShards(t, 2)
+	mocks[0].ExpectQuery(`^SELECT customer_id, total FROM invoices$`).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id", "total"}).AddRow(2, 30).AddRow(3, 5))
+	mocks[1].ExpectQuery(`^SELECT customer_id, total FROM invoices$`).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id", "total"}).AddRow(1, 10).AddRow(1, 20).AddRow(4, 99))
+
+	totals, err := GatherAggregate(context.Background(), shards, ShardQuery{Query: "SELECT customer_id, total FROM invoices"},
+		func(i gatheredInvoice) int64 { return i.CustomerID },
+		func(sum int64, i gatheredInvoice) int64 { return sum + i.Total })
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[int64]int64{1: 30, 2: 30, 3: 5, 4: 99}, totals)
+}
+
+func TestShouldFailGatherOnTheFirstShardError(t *testing.T) {
+	shards, mocks := newMockShards(t, 2)
+	mocks[0].ExpectQuery(`^SELECT id FROM orders WHERE status = \?$`).WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mocks[1].ExpectQuery(`^SELECT id FROM orders WHERE status = \?$`).WithArgs("open").
+		WillReturnError(errors.New("connection refused"))
+
+	err := Gather(context.Background(), shards, ShardQuery{Query: "SELECT id FROM orders WHERE status = ?", Args: []interface{}{"open"}},
+		func(shard int, id int64) error { return nil })
+	assert.EqualError(t, err, "db: shard 1: connection refused")
+
+	shards, mocks = newMockShards(t, 1)
+	mocks[0].ExpectQuery(`^SELECT id FROM orders$`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	err = Gather(context.Background(), shards, ShardQuery{Query: "SELECT id FROM orders"},
+		func(shard int, id int64) error { return errors.New("stop") })
+	assert.EqualError(t, err, "stop")
+}
+
+func TestShouldFailGatherCancelledBeforeEveryRowArrived(t *testing.T) {
+	shards, mocks := newMockShards(t, 2)
+	for _, mock := range mocks {
+		rows := sqlmock.NewRows([]string{"id"})
+		for id := 1; id <= 2000; id++ {
+			rows.AddRow(id)
+		}
+		mock.ExpectQuery(`^SELECT id FROM orders$`).WillReturnRows(rows)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gathered := 0
+	err := Gather(ctx, shards, ShardQuery{Query: "SELECT id FROM orders"}, func(shard int, id int64) error {
+		if gathered++; gathered == 10 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.Less(t, gathered, 4000)
+}
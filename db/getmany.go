@@ -0,0 +1,150 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// getManyChunk bounds the placeholders of an IN list, under the 999 that
+// older SQLite builds accept.
+const getManyChunk = 500
+
+// MissingKeysError is returned by GetMany when some requested keys have no
+// row. It matches sql.ErrNoRows with errors.Is.
+type MissingKeysError struct {
+	Table string
+	Keys  []interface{}
+}
+
+func (e *MissingKeysError) Error() string {
+	keys := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		keys[i] = fmt.Sprint(key)
+	}
+	return fmt.Sprintf("db: no %s row for %s", e.Table, strings.Join(keys, ", "))
+}
+
+func (e *MissingKeysError) Unwrap() error {
+	return sql.ErrNoRows
+}
+
+// GetMany loads the entities of the registered model T with the given primary
+// keys, in the order of ids, an entity being repeated when its key is. Found
+// entities are returned along with a MissingKeysError when some keys have no
+// row. Postgres gets a single = ANY($1) statement whatever the number of keys;
+// other databases get IN lists of up to 500 keys.
+func GetMany[T any, K comparable](uow UnitOfWork, ids []K) ([]T, error) {
+	var zero T
+	model, err := ModelOf(&zero)
+	if err != nil {
+		return nil, err
+	}
+	if model.Key == "" {
+		return nil, fmt.Errorf("db: %s has no key column", model.Table)
+	}
+
+	var unique []interface{}
+	seen := make(map[K]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	var loaded []T
+	selectFrom := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(model.Columns, ", "), model.Table, model.Key)
+	if DialectFor(uow.DriverName()) == DialectPostgres {
+		if len(unique) > 0 {
+			if err := uow.Select(&loaded, selectFrom+" = ANY($1)", pgArray(unique)); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for start := 0; start < len(unique); start += getManyChunk {
+			chunk := unique[start:]
+			if len(chunk) > getManyChunk {
+				chunk = chunk[:getManyChunk]
+			}
+
+			var rows []T
+			query := fmt.Sprintf("%s IN (%s)", selectFrom, strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", "))
+			if err := uow.Select(&rows, uow.Rebind(query), chunk...); err != nil {
+				return nil, err
+			}
+			loaded = append(loaded, rows...)
+		}
+	}
+
+	// keys are matched by their printed form, the key field and K may be
+	// different integer types
+	byKey := make(map[string]int, len(loaded))
+	for i := range loaded {
+		if err := model.Verify(&loaded[i]); err != nil {
+			return nil, err
+		}
+		byKey[fmt.Sprint(model.KeyOf(&loaded[i]))] = i
+	}
+
+	entities := make([]T, 0, len(ids))
+	var missing []interface{}
+	for _, id := range ids {
+		i, ok := byKey[fmt.Sprint(id)]
+		if !ok {
+			if seen[id] {
+				missing = append(missing, id)
+				seen[id] = false
+			}
+			continue
+		}
+		entities = append(entities, loaded[i])
+	}
+
+	if len(missing) > 0 {
+		return entities, &MissingKeysError{Table: model.Table, Keys: missing}
+	}
+	return entities, nil
+}
+
+// pgArray passes values as a Postgres array literal, which = ANY casts to the
+// array type of the column compared. Elements are converted like arguments
+// are, calling driver.Valuer, and written in the text format Postgres reads
+// for their type.
+type pgArray []interface{}
+
+var pgArrayQuote = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (a pgArray) Value() (driver.Value, error) {
+	elements := make([]string, len(a))
+	for i, element := range a {
+		value, err := driver.DefaultParameterConverter.ConvertValue(element)
+		if err != nil {
+			return nil, fmt.Errorf("db: array element %d: %w", i, err)
+		}
+
+		switch v := value.(type) {
+		case nil:
+			elements[i] = "NULL"
+		case bool:
+			elements[i] = strconv.FormatBool(v)
+		case int64:
+			elements[i] = strconv.FormatInt(v, 10)
+		case float64:
+			elements[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case []byte:
+			elements[i] = `"\\x` + hex.EncodeToString(v) + `"`
+		case time.Time:
+			elements[i] = `"` + v.Format("2006-01-02 15:04:05.999999999Z07:00") + `"`
+		case string:
+			elements[i] = `"` + pgArrayQuote.Replace(v) + `"`
+		default:
+			return nil, fmt.Errorf("db: array element %d: unsupported type %T", i, value)
+		}
+	}
+	return "{" + strings.Join(elements, ",") + "}", nil
+}
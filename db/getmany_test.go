@@ -0,0 +1,50 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldGetManyInRequestedOrder(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE id IN \(\?, \?, \?\)$`).
+		WithArgs(3, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open").AddRow(3, "paid"))
+
+	orders, err := GetMany[repositoryOrder](uw, []int{3, 1, 2, 3})
+
+	var missing *MissingKeysError
+	if assert.True(t, errors.As(err, &missing)) {
+		assert.Equal(t, []interface{}{2}, missing.Keys)
+	}
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.Equal(t, []repositoryOrder{{3, "paid"}, {1, "open"}, {3, "paid"}}, orders)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldGetManyWithAnyOnPostgres(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE id = ANY\(\$1\)$`).
+		WithArgs(`{2,1}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open").AddRow(2, "paid"))
+
+	orders, err := GetMany[repositoryOrder](NewUnitOfWork(database, nil), []int64{2, 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []repositoryOrder{{2, "paid"}, {1, "open"}}, orders)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldNotQueryForNoKeys(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	orders, err := GetMany[repositoryOrder](uw, []int64(nil))
+
+	assert.Nil(t, err)
+	assert.Empty(t, orders)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
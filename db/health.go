@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// HealthConfig configures a HealthChecker.
+type HealthConfig struct {
+	// Timeout bounds every check. Zero means one second.
+	Timeout time.Duration
+
+	// Replicas are checked along with the primary, e.g. those given to
+	// WithReplicas.
+	Replicas []*sqlx.DB
+
+	// Interval between the replica checks of Run. Zero means ten seconds.
+	Interval time.Duration
+
+	// Options of the unit of work the deep check runs in, e.g. the
+	// interceptors of the application, so that it goes through them.
+	Options []Option
+}
+
+// HealthCheck is the outcome of one check of a HealthReport.
+type HealthCheck struct {
+	Name     string        `json:"name"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// HealthReport gathers the checks of the primary and of the replicas. Ready
+// only depends on the primary: reads leave unhealthy replicas to the others,
+// see Balancer.
+type HealthReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthChecker checks the database, and tracks which replicas are healthy.
+type HealthChecker struct {
+	db     *sqlx.DB
+	config HealthConfig
+
+	mu        sync.RWMutex
+	unhealthy map[*sqlx.DB]bool
+}
+
+// NewHealthChecker creates a checker of db and the replicas of config.
+// Replicas are deemed healthy until a check fails.
+func NewHealthChecker(db *sqlx.DB, config HealthConfig) *HealthChecker {
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second
+	}
+	if config.Interval <= 0 {
+		config.Interval = 10 * time.Second
+	}
+
+	return &HealthChecker{db: db, config: config, unhealthy: map[*sqlx.DB]bool{}}
+}
+
+// Ping checks a connection to the primary can be had, a liveness check.
+func (c *HealthChecker) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	return c.db.PingContext(ctx)
+}
+
+// Check runs SELECT 1 on the primary through a unit of work, a readiness
+// check that the database answers queries.
+func (c *HealthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	var one int
+	uow := NewUnitOfWork(c.db, nil, append([]Option{WithContext(ctx)}, c.config.Options...)...)
+	return uow.Get(&one, "SELECT 1")
+}
+
+// CheckReplicas pings the replicas concurrently, recording which are
+// healthy, and returns a check per replica in order.
+func (c *HealthChecker) CheckReplicas(ctx context.Context) []HealthCheck {
+	checks := make([]HealthCheck, len(c.config.Replicas))
+
+	var wg sync.WaitGroup
+	for i, replica := range c.config.Replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checks[i] = c.run(fmt.Sprintf("replica %d", i), func() error {
+				ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+				defer cancel()
+
+				err := replica.PingContext(ctx)
+				c.mu.Lock()
+				c.unhealthy[replica] = err != nil
+				c.mu.Unlock()
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+	return checks
+}
+
+// Report runs every check: ping and SELECT 1 on the primary, then the
+// replicas.
+func (c *HealthChecker) Report(ctx context.Context) HealthReport {
+	ping := c.run("ping", func() error { return c.Ping(ctx) })
+	query := c.run("select", func() error { return c.Check(ctx) })
+
+	return HealthReport{
+		Ready:  ping.Error == "" && query.Error == "",
+		Checks: append([]HealthCheck{ping, query}, c.CheckReplicas(ctx)...),
+	}
+}
+
+func (c *HealthChecker) run(name string, check func() error) HealthCheck {
+	start := time.Now()
+	result := HealthCheck{Name: name}
+	if err := check(); err != nil {
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// Healthy reports whether the last check of replica succeeded.
+func (c *HealthChecker) Healthy(replica *sqlx.DB) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return !c.unhealthy[replica]
+}
+
+// Run checks the replicas every interval until ctx is done, so Balancer
+// keeps up with them.
+func (c *HealthChecker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		for _, check := range c.CheckReplicas(ctx) {
+			if check.Error != "" {
+				Logger().WarnContext(ctx, "db: replica unhealthy", "replica", check.Name, "err", check.Error)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Balancer returns a balancer picking with next among the replicas deemed
+// healthy, or the primary when none is:
+//
+//	db.WithReplicas(checker.Balancer(db.RoundRobin()), replicas...)
+func (c *HealthChecker) Balancer(next ReplicaBalancer) ReplicaBalancer {
+	return &healthyBalancer{checker: c, next: next}
+}
+
+type healthyBalancer struct {
+	checker *HealthChecker
+	next    ReplicaBalancer
+}
+
+func (b *healthyBalancer) Pick(replicas []*sqlx.DB) *sqlx.DB {
+	healthy := make([]*sqlx.DB, 0, len(replicas))
+	for _, replica := range replicas {
+		if b.checker.Healthy(replica) {
+			healthy = append(healthy, replica)
+		}
+	}
+	if len(healthy) == 0 {
+		return b.checker.db
+	}
+	return b.next.Pick(healthy)
+}
+
+// Handler serves the report of the checks as JSON, with status 200 when
+// ready and 503 otherwise, for readiness probes:
+//
+//	readinessProbe:
+//	  httpGet: {path: /readyz, port: 8080}
+//	  timeoutSeconds: 4
+//
+// A report takes up to three times the Timeout of the checks: keep the probe
+// timeout above it.
+func (c *HealthChecker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Report(r.Context())
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
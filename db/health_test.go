@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockPingedDatabase(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sqlx.NewDb(conn, "postgres"), mock
+}
+
+func TestShouldReportReadinessOfThePrimary(t *testing.T) {
+	primary, mock := newMockPingedDatabase(t)
+	replica, replicaMock := newMockPingedDatabase(t)
+	checker := NewHealthChecker(primary, HealthConfig{Replicas: []*sqlx.DB{replica}})
+
+	mock.ExpectPing()
+	mock.ExpectQuery(`^SELECT 1$`).WillReturnRows(sqlmock.NewRows([]string{"one"}).AddRow(1))
+	replicaMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	report := checker.Report(context.Background())
+
+	assert.True(t, report.Ready)
+	assert.Equal(t, []string{"ping", "select", "replica 0"}, checkNames(report))
+	assert.Equal(t, "connection refused", report.Checks[2].Error)
+	assert.False(t, checker.Healthy(replica))
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestShouldServeUnreadinessWhenQueriesTimeOut(t *testing.T) {
+	primary, mock := newMockPingedDatabase(t)
+	checker := NewHealthChecker(primary, HealthConfig{Timeout: 10 * time.Millisecond})
+
+	mock.ExpectPing()
+	mock.ExpectQuery(`^SELECT 1$`).WillDelayFor(200 * time.Millisecond).WillReturnRows(sqlmock.NewRows([]string{"one"}).AddRow(1))
+
+	w := httptest.NewRecorder()
+	checker.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report HealthReport
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.Ready)
+	assert.Equal(t, "", report.Checks[0].Error)
+	assert.Equal(t, "canceling query due to user request", report.Checks[1].Error)
+}
+
+func TestShouldBalanceReadsOverHealthyReplicas(t *testing.T) {
+	primary, _ := newMockPingedDatabase(t)
+	up, upMock := newMockPingedDatabase(t)
+	down, downMock := newMockPingedDatabase(t)
+	checker := NewHealthChecker(primary, HealthConfig{Replicas: []*sqlx.DB{up, down}})
+	balancer := checker.Balancer(RoundRobin())
+
+	assert.Equal(t, up, balancer.Pick([]*sqlx.DB{up, down}))
+	assert.Equal(t, down, balancer.Pick([]*sqlx.DB{up, down}))
+
+	upMock.ExpectPing()
+	downMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	checker.CheckReplicas(context.Background())
+
+	assert.Equal(t, up, balancer.Pick([]*sqlx.DB{up, down}))
+	assert.Equal(t, up, balancer.Pick([]*sqlx.DB{up, down}))
+	assert.Equal(t, primary, balancer.Pick([]*sqlx.DB{down}))
+}
+
+func checkNames(report HealthReport) []string {
+	var names []string
+	for _, check := range report.Checks {
+		names = append(names, check.Name)
+	}
+	return names
+}
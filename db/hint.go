@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidHint is returned for hints that would end their comment early.
+var ErrInvalidHint = errors.New("db: invalid hint")
+
+// HintPlacement tells where a hint goes in a statement.
+type HintPlacement int
+
+const (
+	// HintBefore places the hint before the statement, where proxies such as
+	// ProxySQL match query rules on it.
+	HintBefore HintPlacement = iota
+	// HintAfterVerb places the hint right after the leading keyword, as
+	// Vitess directives and MySQL optimizer hints require.
+	HintAfterVerb
+)
+
+// Hint is a routing or optimizer hint comment.
+type Hint struct {
+	Comment   string
+	Placement HintPlacement
+}
+
+// VitessHint returns a Vitess comment directive, e.g.
+// VitessHint("QUERY_TIMEOUT_MS=500", "SCATTER_ERRORS_AS_WARNINGS").
+func VitessHint(directives ...string) Hint {
+	return Hint{Comment: "/*vt+ " + strings.Join(directives, " ") + " */", Placement: HintAfterVerb}
+}
+
+// CommentHint returns a plain comment placed before the statement, e.g.
+// CommentHint("hostgroup=reporting") for a ProxySQL rule matching it.
+func CommentHint(text string) Hint {
+	return Hint{Comment: "/* " + text + " */", Placement: HintBefore}
+}
+
+func (h Hint) validate() error {
+	inner := strings.TrimSuffix(strings.TrimPrefix(h.Comment, "/*"), "*/")
+	if !strings.HasPrefix(h.Comment, "/*") || !strings.HasSuffix(h.Comment, "*/") || strings.Contains(inner, "*/") {
+		return fmt.Errorf("%w: %q", ErrInvalidHint, h.Comment)
+	}
+	return nil
+}
+
+type hintsKey struct{}
+
+// WithHints returns a context adding hints to the statements run with it,
+// after those of their label.
+func WithHints(ctx context.Context, hints ...Hint) context.Context {
+	previous, _ := ctx.Value(hintsKey{}).([]Hint)
+	return context.WithValue(ctx, hintsKey{}, append(append([]Hint(nil), previous...), hints...))
+}
+
+// HintConfig assigns hints to labels, see WithLabel.
+type HintConfig struct {
+	Labels map[string][]Hint
+}
+
+// HintInterceptor adds to every statement the hints of its label and those
+// of its context, so that call sites never splice comments into SQL. Install
+// it last, so that other interceptors see statements without hints.
+func HintInterceptor(config HintConfig) Interceptor {
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		var hints []Hint
+		if stmt.Label != "" {
+			hints = append(hints, config.Labels[stmt.Label]...)
+		}
+		if h, ok := ctx.Value(hintsKey{}).([]Hint); ok {
+			hints = append(hints, h...)
+		}
+		if len(hints) == 0 {
+			return next(ctx, stmt)
+		}
+
+		query, err := applyHints(DialectFor(stmt.Driver), stmt.Query, hints)
+		if err != nil {
+			return err
+		}
+		stmt.Query = query
+		return next(ctx, stmt)
+	}
+}
+
+func applyHints(dialect Dialect, query string, hints []Hint) (string, error) {
+	var before, after []string
+	for _, h := range hints {
+		if err := h.validate(); err != nil {
+			return "", err
+		}
+		if h.Placement == HintAfterVerb {
+			after = append(after, h.Comment)
+		} else {
+			before = append(before, h.Comment)
+		}
+	}
+
+	if len(after) > 0 {
+		tokens := lexSQLFor(dialect, query)
+		if len(tokens) > 0 {
+			verb := tokens[0].end
+			query = query[:verb] + " " + strings.Join(after, " ") + query[verb:]
+		}
+	}
+	if len(before) > 0 {
+		query = strings.Join(before, " ") + " " + query
+	}
+	return query, nil
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldInjectHintsOfLabelAndContext(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	mock.ExpectQuery(`^/\* hostgroup=reporting \*/ SELECT /\*vt\+ QUERY_TIMEOUT_MS=500 \*/ /\*vt\+ SCATTER_ERRORS_AS_WARNINGS \*/ id FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	interceptor := HintInterceptor(HintConfig{Labels: map[string][]Hint{
+		"report.orders": {CommentHint("hostgroup=reporting"), VitessHint("QUERY_TIMEOUT_MS=500")},
+	}})
+	ctx := WithHints(WithLabel(context.Background(), "report.orders"), VitessHint("SCATTER_ERRORS_AS_WARNINGS"))
+	uow := NewUnitOfWork(database, nil, WithContext(ctx), WithInterceptors(interceptor))
+
+	var ids []int64
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLeaveStatementsWithoutHintsAlone(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	mock.ExpectExec("^DELETE FROM sessions$").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	uow := NewUnitOfWork(database, nil, WithInterceptors(HintInterceptor(HintConfig{})))
+	uow.MustExec("DELETE FROM sessions")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectHintsClosingTheirComment(t *testing.T) {
+	database, _ := newMockDatabase(t, "mysql")
+
+	ctx := WithHints(context.Background(), CommentHint("x */ DROP TABLE orders; /*"))
+	uow := NewUnitOfWork(database, nil, WithContext(ctx), WithInterceptors(HintInterceptor(HintConfig{})))
+
+	_, err := uow.Query("SELECT 1")
+	assert.True(t, errors.Is(err, ErrInvalidHint))
+}
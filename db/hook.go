@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+)
+
+// Hook observes the statements and transactions of a unit of work, for
+// logging, metrics or query rewriting. Embed NopHook to implement only some
+// of the methods. Register hooks with WithHooks.
+type Hook interface {
+	// BeforeQuery is called before every statement, and may rewrite its
+	// Query and Args. The returned context is the one the statement and
+	// AfterQuery run with; an error fails the statement without running it.
+	BeforeQuery(ctx context.Context, stmt *Statement) (context.Context, error)
+
+	// AfterQuery is called once the statement ran, with its outcome.
+	AfterQuery(ctx context.Context, stmt *Statement, err error)
+
+	// BeforeCommit is called before a transaction commits, with statements of
+	// the unit of work still running in it. An error rolls it back instead.
+	BeforeCommit(ctx context.Context) error
+
+	// AfterCommit is called once a transaction committed, or failed to.
+	AfterCommit(ctx context.Context, err error)
+
+	// AfterRollback is called once a transaction was rolled back, and with
+	// the error when InTransaction failed to begin one.
+	AfterRollback(ctx context.Context, err error)
+}
+
+// BeginHook is implemented by hooks that need to know when InTransaction
+// begins a transaction. The context returned by BeforeBegin begins it and
+// becomes the context of the unit of work until the transaction ends, e.g.
+// to carry a span that statement and commit hooks see.
+type BeginHook interface {
+	BeforeBegin(ctx context.Context) context.Context
+}
+
+// NopHook implements Hook doing nothing.
+type NopHook struct{}
+
+func (NopHook) BeforeQuery(ctx context.Context, stmt *Statement) (context.Context, error) {
+	return ctx, nil
+}
+
+func (NopHook) AfterQuery(ctx context.Context, stmt *Statement, err error) {}
+
+func (NopHook) BeforeCommit(ctx context.Context) error {
+	return nil
+}
+
+func (NopHook) AfterCommit(ctx context.Context, err error) {}
+
+func (NopHook) AfterRollback(ctx context.Context, err error) {}
+
+// WithHooks registers hooks on the unit of work, called in the order given
+// before a statement or commit and in reverse order after. Statement hooks
+// run as an interceptor placed after those already installed.
+func WithHooks(hooks ...Hook) Option {
+	return func(u *unitOfWork) {
+		u.hooks = append(u.hooks, hooks...)
+		for _, hook := range hooks {
+			u.interceptors = append(u.interceptors, hookInterceptor(hook))
+		}
+	}
+}
+
+func hookInterceptor(hook Hook) Interceptor {
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		ctx, err := hook.BeforeQuery(ctx, stmt)
+		if err == nil {
+			err = next(ctx, stmt)
+		}
+		hook.AfterQuery(ctx, stmt, err)
+		return err
+	}
+}
+
+func (u *unitOfWork) hooksBeforeBegin() {
+	for _, hook := range u.hooks {
+		if begin, ok := hook.(BeginHook); ok {
+			u.ctx = begin.BeforeBegin(u.context())
+		}
+	}
+}
+
+func (u *unitOfWork) hooksBeforeCommit() error {
+	for _, hook := range u.hooks {
+		if err := hook.BeforeCommit(u.context()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *unitOfWork) hooksAfterCommit(err error) {
+	for i := len(u.hooks) - 1; i >= 0; i-- {
+		u.hooks[i].AfterCommit(u.context(), err)
+	}
+}
+
+func (u *unitOfWork) hooksAfterRollback(err error) {
+	for i := len(u.hooks) - 1; i >= 0; i-- {
+		u.hooks[i].AfterRollback(u.context(), err)
+	}
+}
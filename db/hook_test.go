@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHook struct {
+	NopHook
+	name   string
+	events *[]string
+}
+
+func (h recordingHook) BeforeQuery(ctx context.Context, stmt *Statement) (context.Context, error) {
+	*h.events = append(*h.events, h.name+" before "+stmt.Query)
+	if h.name == "rewriter" {
+		stmt.Query = strings.Replace(stmt.Query, "orders", "orders_v2", 1)
+	}
+	return ctx, nil
+}
+
+func (h recordingHook) AfterQuery(ctx context.Context, stmt *Statement, err error) {
+	*h.events = append(*h.events, h.name+" after "+stmt.Query)
+}
+
+func (h recordingHook) BeforeCommit(ctx context.Context) error {
+	*h.events = append(*h.events, h.name+" before commit")
+	return nil
+}
+
+func (h recordingHook) AfterCommit(ctx context.Context, err error) {
+	*h.events = append(*h.events, h.name+" after commit")
+}
+
+func (h recordingHook) AfterRollback(ctx context.Context, err error) {
+	*h.events = append(*h.events, h.name+" after rollback")
+}
+
+func TestShouldRunHooksAroundStatementsAndCommits(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^DELETE FROM orders_v2$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	var events []string
+	database, _ := DatabaseOf(uow)
+	uow = NewUnitOfWork(database, nil, WithHooks(
+		recordingHook{name: "logger", events: &events},
+		recordingHook{name: "rewriter", events: &events},
+	))
+
+	uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("DELETE FROM orders")
+		return nil, nil
+	})
+	uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, assert.AnError
+	})
+
+	assert.Equal(t, []string{
+		"logger before DELETE FROM orders",
+		"rewriter before DELETE FROM orders",
+		"rewriter after DELETE FROM orders_v2",
+		"logger after DELETE FROM orders_v2",
+		"logger before commit",
+		"rewriter before commit",
+		"rewriter after commit",
+		"logger after commit",
+		"rewriter after rollback",
+		"logger after rollback",
+	}, events)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+type vetoHook struct {
+	NopHook
+}
+
+func (vetoHook) BeforeCommit(ctx context.Context) error {
+	return assert.AnError
+}
+
+func TestShouldRollBackWhenHookRefusesCommit(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	uow := NewUnitOfWork(database, nil, WithHooks(vetoHook{}))
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) { return nil, nil })
+
+	assert.Equal(t, assert.AnError, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// IdleTransaction is a Postgres session sitting idle in a transaction, as
+// reported by pg_stat_activity: usually a transaction leaked by code that
+// neither committed nor rolled back, holding its locks and snapshot.
+type IdleTransaction struct {
+	PID             int64     `db:"pid"`
+	User            string    `db:"usename"`
+	ApplicationName string    `db:"application_name"`
+	ClientAddr      string    `db:"client_addr"`
+	Started         time.Time `db:"xact_start"`
+	IdleSince       time.Time `db:"state_change"`
+
+	// Query is the last statement the transaction ran, the best hint of the
+	// code that left it open.
+	Query string `db:"query"`
+
+	// IdleFor is measured on the server clock.
+	IdleFor time.Duration `db:"-"`
+
+	// Terminated reports whether the reaper ended the session.
+	Terminated bool `db:"-"`
+}
+
+// IdleTransactionReaperConfig configures an IdleTransactionReaper.
+type IdleTransactionReaperConfig struct {
+	// ApplicationName selects the sessions watched. Empty means the
+	// application_name of the reaper's own connections, that is of the pool
+	// the application shares; Check fails when that is empty too, rather
+	// than watch every unnamed session on the server.
+	ApplicationName string
+
+	// Interval between checks. Zero means 30 seconds.
+	Interval time.Duration
+
+	// MaxIdle is the time a session may stay idle in a transaction. Zero
+	// means 5 minutes.
+	MaxIdle time.Duration
+
+	// Terminate ends the sessions found with pg_terminate_backend, rolling
+	// their transaction back. Otherwise they are only reported.
+	Terminate bool
+
+	// OnIdle receives every session found, after it was logged and possibly
+	// terminated.
+	OnIdle func(IdleTransaction)
+}
+
+// IdleTransactionReaper periodically looks for the sessions of this
+// application idle in a transaction for too long, logs them and optionally
+// terminates them, before they block vacuum or queue writers behind their
+// locks.
+type IdleTransactionReaper struct {
+	db     *sqlx.DB
+	config IdleTransactionReaperConfig
+}
+
+// NewIdleTransactionReaper creates a reaper of the sessions of db.
+func NewIdleTransactionReaper(db *sqlx.DB, config IdleTransactionReaperConfig) *IdleTransactionReaper {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	if config.MaxIdle <= 0 {
+		config.MaxIdle = 5 * time.Minute
+	}
+
+	return &IdleTransactionReaper{db: db, config: config}
+}
+
+// Run checks the sessions every interval until ctx is done. Failed checks
+// are retried on the next tick.
+func (r *IdleTransactionReaper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Check(ctx); err != nil {
+			Logger().Error("db: idle transaction check failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check looks for idle transactions once and returns those found.
+func (r *IdleTransactionReaper) Check(ctx context.Context) ([]IdleTransaction, error) {
+	if err := requirePostgres(r.db, "idle transaction checks"); err != nil {
+		return nil, err
+	}
+
+	name, err := r.applicationName(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		IdleTransaction
+		IdleSeconds float64 `db:"idle_seconds"`
+	}
+	err = r.db.SelectContext(ctx, &rows, "SELECT pid, COALESCE(usename, '') AS usename, application_name, "+
+		"COALESCE(client_addr::text, '') AS client_addr, xact_start, state_change, query, "+
+		"EXTRACT(EPOCH FROM now() - state_change)::float8 AS idle_seconds "+
+		"FROM pg_stat_activity WHERE state IN ('idle in transaction', 'idle in transaction (aborted)') "+
+		"AND application_name = $1 "+
+		"AND state_change < now() - $2 * interval '1 millisecond' AND pid <> pg_backend_pid() "+
+		"ORDER BY state_change",
+		name, r.config.MaxIdle.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+
+	idle := make([]IdleTransaction, len(rows))
+	for i, row := range rows {
+		tx := row.IdleTransaction
+		tx.IdleFor = time.Duration(row.IdleSeconds * float64(time.Second))
+
+		if r.config.Terminate {
+			tx.Terminated, err = r.terminate(ctx, tx)
+			if err != nil {
+				return idle[:i], err
+			}
+		}
+
+		Logger().Warn("db: session idle in transaction",
+			"pid", tx.PID, "user", tx.User, "application", tx.ApplicationName, "client", tx.ClientAddr,
+			"started", tx.Started, "idle_for", tx.IdleFor, "query", tx.Query, "terminated", tx.Terminated)
+		if r.config.OnIdle != nil {
+			r.config.OnIdle(tx)
+		}
+		idle[i] = tx
+	}
+	return idle, nil
+}
+
+// applicationName returns the application_name of the sessions watched.
+func (r *IdleTransactionReaper) applicationName(ctx context.Context) (string, error) {
+	if r.config.ApplicationName != "" {
+		return r.config.ApplicationName, nil
+	}
+
+	var name string
+	if err := r.db.GetContext(ctx, &name, "SELECT current_setting('application_name')"); err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("db: idle transaction checks need an application name, set ApplicationName or the application_name of the connections")
+	}
+	return name, nil
+}
+
+// terminate ends the session of tx unless it moved on since it was seen, so
+// that a pid reused or a transaction resumed in between is left alone.
+func (r *IdleTransactionReaper) terminate(ctx context.Context, tx IdleTransaction) (bool, error) {
+	var terminated []bool
+	err := r.db.SelectContext(ctx, &terminated, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity "+
+		"WHERE pid = $1 AND state_change = $2 AND state IN ('idle in transaction', 'idle in transaction (aborted)')",
+		tx.PID, tx.IdleSince)
+	return len(terminated) == 1 && terminated[0], err
+}
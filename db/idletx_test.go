@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldReportAndTerminateIdleTransactions(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	idleSince := started.Add(time.Second)
+	mock.ExpectQuery("FROM pg_stat_activity WHERE state IN").WithArgs("billing", int64(60000)).
+		WillReturnRows(sqlmock.NewRows([]string{"pid", "usename", "application_name", "client_addr", "xact_start", "state_change", "query", "idle_seconds"}).
+			AddRow(4242, "app", "billing", "10.0.0.7/32", started, idleSince, "UPDATE invoices SET paid = true WHERE id = 1", 90.5))
+	mock.ExpectQuery("SELECT pg_terminate_backend\\(pid\\) FROM pg_stat_activity WHERE pid = \\$1 AND state_change = \\$2").
+		WithArgs(int64(4242), idleSince).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_terminate_backend"}).AddRow(true))
+
+	var seen []IdleTransaction
+	reaper := NewIdleTransactionReaper(database, IdleTransactionReaperConfig{
+		ApplicationName: "billing",
+		MaxIdle:         time.Minute,
+		Terminate:       true,
+		OnIdle:          func(tx IdleTransaction) { seen = append(seen, tx) },
+	})
+	idle, err := reaper.Check(context.Background())
+
+	assert.Nil(t, err)
+	if assert.Len(t, idle, 1) {
+		assert.Equal(t, int64(4242), idle[0].PID)
+		assert.Equal(t, "UPDATE invoices SET paid = true WHERE id = 1", idle[0].Query)
+		assert.Equal(t, 90500*time.Millisecond, idle[0].IdleFor)
+		assert.True(t, idle[0].Terminated)
+	}
+	assert.Equal(t, idle, seen)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldOnlyReportIdleTransactionsByDefault(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("^SELECT current_setting\\('application_name'\\)$").
+		WillReturnRows(sqlmock.NewRows([]string{"current_setting"}).AddRow("api"))
+	mock.ExpectQuery("FROM pg_stat_activity WHERE state IN").WithArgs("api", int64(300000)).
+		WillReturnRows(sqlmock.NewRows([]string{"pid", "usename", "application_name", "client_addr", "xact_start", "state_change", "query", "idle_seconds"}).
+			AddRow(7, "app", "api", "", time.Now(), time.Now(), "SELECT 1", 400.0))
+
+	idle, err := NewIdleTransactionReaper(database, IdleTransactionReaperConfig{}).Check(context.Background())
+
+	assert.Nil(t, err)
+	if assert.Len(t, idle, 1) {
+		assert.False(t, idle[0].Terminated)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseToWatchUnnamedSessions(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("^SELECT current_setting\\('application_name'\\)$").
+		WillReturnRows(sqlmock.NewRows([]string{"current_setting"}).AddRow(""))
+
+	idle, err := NewIdleTransactionReaper(database, IdleTransactionReaperConfig{Terminate: true}).Check(context.Background())
+
+	assert.EqualError(t, err, "db: idle transaction checks need an application name, set ApplicationName or the application_name of the connections")
+	assert.Empty(t, idle)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequirePostgresToReapIdleTransactions(t *testing.T) {
+	database, _ := newMockDatabase(t, "sqlmock")
+
+	_, err := NewIdleTransactionReaper(database, IdleTransactionReaperConfig{}).Check(context.Background())
+
+	assert.EqualError(t, err, "db: idle transaction checks require postgres, not sqlmock")
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SelectIndexed runs query and returns the rows keyed by the value of keyColumn.
+// keyColumn must be mapped to a field of V; later rows overwrite earlier ones
+// sharing the same key.
+func SelectIndexed[K comparable, V any](uow UnitOfWork, keyColumn string, query string, args ...interface{}) (map[K]V, error) {
+	result := map[K]V{}
+
+	err := eachKeyed(uow, keyColumn, query, args, func(key K, value V) {
+		result[key] = value
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SelectGrouped runs query and returns the rows grouped by the value of keyColumn,
+// preserving the order in which rows were returned inside each group.
+func SelectGrouped[K comparable, V any](uow UnitOfWork, keyColumn string, query string, args ...interface{}) (map[K][]V, error) {
+	result := map[K][]V{}
+
+	err := eachKeyed(uow, keyColumn, query, args, func(key K, value V) {
+		result[key] = append(result[key], value)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func eachKeyed[K comparable, V any](uow UnitOfWork, keyColumn string, query string, args []interface{}, fn func(K, V)) error {
+	rows, err := uow.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value V
+		if err := rows.StructScan(&value); err != nil {
+			return err
+		}
+
+		key, err := keyOf[K](rows, reflect.ValueOf(&value).Elem(), keyColumn)
+		if err != nil {
+			return err
+		}
+
+		fn(key, value)
+	}
+
+	return rows.Err()
+}
+
+func keyOf[K comparable](rows *sqlx.Rows, value reflect.Value, keyColumn string) (K, error) {
+	var key K
+
+	field, ok := fieldByColumn(rows.Mapper, value, keyColumn)
+	if !ok {
+		return key, fmt.Errorf("db: key column %q is not mapped on %s", keyColumn, value.Type())
+	}
+
+	if k, ok := field.Interface().(K); ok {
+		return k, nil
+	}
+
+	target := reflect.TypeOf(key)
+	if !field.Type().ConvertibleTo(target) {
+		return key, fmt.Errorf("db: key column %q of type %s cannot be used as %s", keyColumn, field.Type(), target)
+	}
+
+	return field.Convert(target).Interface().(K), nil
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type indexedRow struct {
+	ID       int64  `db:"id"`
+	Customer string `db:"customer"`
+}
+
+func newMockUnitOfWork(t *testing.T) (UnitOfWork, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewUnitOfWork(sqlx.NewDb(conn, "sqlmock"), nil), mock
+}
+
+func TestShouldSelectIndexedByColumn(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, customer FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "customer"}).
+			AddRow(1, "ana").
+			AddRow(2, "bia"))
+
+	result, err := SelectIndexed[int64, indexedRow](uw, "id", "SELECT id, customer FROM orders")
+
+	assert.Nil(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "bia", result[2].Customer)
+}
+
+func TestShouldSelectGroupedByColumn(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, customer FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "customer"}).
+			AddRow(1, "ana").
+			AddRow(2, "bia").
+			AddRow(3, "ana"))
+
+	result, err := SelectGrouped[string, indexedRow](uw, "customer", "SELECT id, customer FROM orders")
+
+	assert.Nil(t, err)
+	assert.Len(t, result["ana"], 2)
+	assert.Equal(t, int64(3), result["ana"][1].ID)
+}
+
+func TestShouldFailWhenKeyColumnIsNotMapped(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, customer FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "customer"}).AddRow(1, "ana"))
+
+	_, err := SelectIndexed[int64, indexedRow](uw, "total", "SELECT id, customer FROM orders")
+
+	assert.EqualError(t, err, `db: key column "total" is not mapped on db.indexedRow`)
+}
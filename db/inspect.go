@@ -0,0 +1,207 @@
+package db
+
+import (
+	"strings"
+)
+
+// StatementInfo summarizes what a statement does, as far as its text says.
+type StatementInfo struct {
+	// Verb is the upper-cased leading keyword, looking past a WITH clause.
+	Verb string
+
+	// Object is the upper-cased kind of object a CREATE, ALTER or DROP
+	// statement is about, such as TABLE, INDEX or MATERIALIZED VIEW, past
+	// modifiers like OR REPLACE, UNIQUE or TEMPORARY.
+	Object string
+
+	// Tables lists the tables the statement reads or writes, schema
+	// qualified as written, lower-cased unless quoted.
+	Tables []string
+
+	// Operations lists every data or schema changing operation found in the
+	// statement, including data-modifying CTEs: INSERT, UPDATE, DELETE,
+	// MERGE, REPLACE, TRUNCATE, CREATE, ALTER, DROP and UPSERT for INSERT ...
+	// ON CONFLICT DO UPDATE and ON DUPLICATE KEY UPDATE.
+	Operations []string
+}
+
+// Modifies reports whether the statement performs operation.
+func (i StatementInfo) Modifies(operation string) bool {
+	for _, op := range i.Operations {
+		if op == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// Inspect analyzes query, written for driver, without a database round trip.
+// It is a lexical analysis meant for guards and routing, not a parser: it
+// never mistakes string contents for code but does not validate syntax.
+func Inspect(driver, query string) StatementInfo {
+	tokens := lexSQLFor(DialectFor(driver), query)
+	info := StatementInfo{Verb: statementVerb(tokens), Object: ddlObject(tokens)}
+
+	for _, ref := range referencedTables(tokens) {
+		info.Tables = append(info.Tables, ref.name)
+	}
+	info.Tables = append(info.Tables, ddlTables(tokens)...)
+
+	seen := map[string]bool{}
+	add := func(op string) {
+		if !seen[op] {
+			seen[op] = true
+			info.Operations = append(info.Operations, op)
+		}
+	}
+
+	for i, t := range tokens {
+		if t.kind != sqlWord {
+			continue
+		}
+
+		previous, next := "", ""
+		if i > 0 {
+			previous = upperWord(tokens[i-1])
+		}
+		if i+1 < len(tokens) {
+			next = upperWord(tokens[i+1])
+		}
+
+		switch upperWord(t) {
+		case "INSERT", "MERGE":
+			if next == "INTO" {
+				add(upperWord(t))
+			}
+		case "REPLACE":
+			if next == "INTO" {
+				add("REPLACE")
+			}
+		case "DELETE":
+			if previous != "ON" {
+				add("DELETE")
+			}
+		case "UPDATE":
+			switch previous {
+			case "FOR", "KEY", "ON":
+				// row locks and referential actions
+				if previous == "KEY" && i > 1 && tokens[i-2].is("duplicate") {
+					add("UPSERT")
+				}
+			case "DO":
+				add("UPSERT")
+			default:
+				add("UPDATE")
+			}
+		case "TRUNCATE", "CREATE", "ALTER", "DROP":
+			if i == 0 {
+				add(upperWord(t))
+			}
+		}
+	}
+
+	return info
+}
+
+func upperWord(t sqlToken) string {
+	if t.kind != sqlWord {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// objectModifiers are the words between CREATE, ALTER or DROP and the kind of
+// object, as in CREATE OR REPLACE TEMPORARY VIEW or CREATE UNIQUE INDEX.
+var objectModifiers = map[string]bool{
+	"OR": true, "REPLACE": true, "TEMP": true, "TEMPORARY": true, "UNLOGGED": true,
+	"GLOBAL": true, "LOCAL": true, "UNIQUE": true, "RECURSIVE": true, "ONLINE": true,
+	"OFFLINE": true, "DEFINER": true, "ALGORITHM": true, "SQL": true, "SECURITY": true,
+}
+
+// ddlObject returns the kind of object of a CREATE, ALTER or DROP statement,
+// two words for compound kinds such as MATERIALIZED VIEW or FOREIGN TABLE.
+func ddlObject(tokens []sqlToken) string {
+	if len(tokens) == 0 || !(tokens[0].is("create") || tokens[0].is("alter") || tokens[0].is("drop")) {
+		return ""
+	}
+
+	for i := 1; i < len(tokens); i++ {
+		word := upperWord(tokens[i])
+		switch {
+		case word == "":
+			// the value of a modifier, as in ALGORITHM = MERGE or DEFINER = x@y
+			continue
+		case objectModifiers[word]:
+			continue
+		case i > 1 && tokens[i-1].text == "=", i > 1 && tokens[i-1].text == "@":
+			continue
+		case word == "MATERIALIZED" || word == "FOREIGN" || word == "EVENT":
+			if i+1 < len(tokens) && upperWord(tokens[i+1]) != "" {
+				return word + " " + upperWord(tokens[i+1])
+			}
+		}
+		return word
+	}
+	return ""
+}
+
+// ddlTables finds the tables named by TRUNCATE, ALTER TABLE and DROP TABLE,
+// which referencedTables does not look at.
+func ddlTables(tokens []sqlToken) []string {
+	if len(tokens) < 2 {
+		return nil
+	}
+
+	i := 1
+	switch {
+	case tokens[0].is("truncate"):
+		if tokens[i].is("table") {
+			i++
+		}
+	case (tokens[0].is("alter") || tokens[0].is("drop")) && tokens[1].is("table"):
+		i++
+	default:
+		return nil
+	}
+
+	for i < len(tokens) && (tokens[i].is("if") || tokens[i].is("exists") || tokens[i].is("only")) {
+		i++
+	}
+
+	var tables []string
+	for i < len(tokens) {
+		ref, next, ok := readTableName(tokens, i)
+		if !ok {
+			break
+		}
+		tables = append(tables, ref.name)
+
+		if next >= len(tokens) || tokens[next].text != "," {
+			break
+		}
+		i = next + 1
+	}
+
+	return tables
+}
+
+// Mentions reports whether query names table anywhere outside strings and
+// comments, in whatever clause and schema qualified or not. Guards use it to
+// fail closed on statements whose tables Inspect does not find, such as FROM
+// ONLY, COPY or CREATE TRIGGER. Qualifiers, i.e. names followed by a dot,
+// are not mentions.
+func Mentions(driver, query, table string) bool {
+	table = strings.ToLower(table[strings.LastIndexByte(table, '.')+1:])
+
+	tokens := lexSQLFor(DialectFor(driver), query)
+	for i, t := range tokens {
+		if !isIdentifier(t) || normalizeName(t) != table {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].text == "." {
+			continue
+		}
+		return true
+	}
+	return false
+}
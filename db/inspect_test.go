@@ -0,0 +1,59 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldInspectStatementOperationsAndTables(t *testing.T) {
+	for query, expected := range map[string]StatementInfo{
+		"SELECT * FROM entries e JOIN accounts a ON a.id = e.account_id FOR UPDATE": {
+			Verb: "SELECT", Tables: []string{"entries", "accounts"},
+		},
+		"INSERT INTO entries (id, note) VALUES (1, 'delete from entries')": {
+			Verb: "INSERT", Tables: []string{"entries"}, Operations: []string{"INSERT"},
+		},
+		"INSERT INTO entries (id) VALUES (1) ON CONFLICT (id) DO UPDATE SET id = 2": {
+			Verb: "INSERT", Tables: []string{"entries"}, Operations: []string{"INSERT", "UPSERT"},
+		},
+		"INSERT INTO entries (id) VALUES (1) ON DUPLICATE KEY UPDATE id = 2": {
+			Verb: "INSERT", Tables: []string{"entries"}, Operations: []string{"INSERT", "UPSERT"},
+		},
+		"WITH gone AS (DELETE FROM entries RETURNING id) SELECT count(*) FROM gone": {
+			Verb: "SELECT", Tables: []string{"entries", "gone"}, Operations: []string{"DELETE"},
+		},
+		"TRUNCATE TABLE ONLY public.entries, audit": {
+			Verb: "TRUNCATE", Tables: []string{"public.entries", "audit"}, Operations: []string{"TRUNCATE"},
+		},
+		"DROP TABLE IF EXISTS entries": {
+			Verb: "DROP", Object: "TABLE", Tables: []string{"entries"}, Operations: []string{"DROP"},
+		},
+		"CREATE TABLE t (a int REFERENCES u ON DELETE CASCADE ON UPDATE CASCADE)": {
+			Verb: "CREATE", Object: "TABLE", Operations: []string{"CREATE"},
+		},
+		"/* v2 */ DROP MATERIALIZED VIEW IF EXISTS totals": {
+			Verb: "DROP", Object: "MATERIALIZED VIEW", Operations: []string{"DROP"},
+		},
+		"CREATE OR REPLACE ALGORITHM = MERGE VIEW v AS SELECT 1": {
+			Verb: "CREATE", Object: "VIEW", Operations: []string{"CREATE"},
+		},
+	} {
+		assert.Equal(t, expected, Inspect("postgres", query), query)
+	}
+}
+
+func TestShouldReportModifications(t *testing.T) {
+	info := Inspect("mysql", "UPDATE `entries` SET note = 'x'")
+
+	assert.True(t, info.Modifies("UPDATE"))
+	assert.False(t, info.Modifies("DELETE"))
+	assert.Equal(t, []string{"entries"}, info.Tables)
+}
+
+func TestShouldFindMentionsOutsideTheClausesInspectReads(t *testing.T) {
+	assert.True(t, Mentions("postgres", "DELETE FROM ONLY public.journal", "journal"))
+	assert.True(t, Mentions("postgres", `COPY "journal" FROM STDIN`, "public.journal"))
+	assert.True(t, Mentions("postgres", "CREATE TRIGGER t BEFORE INSERT ON journal EXECUTE FUNCTION f()", "journal"))
+	assert.False(t, Mentions("postgres", "SELECT 'journal', journal.seq FROM entries journal_entries", "journal"))
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrIntegrity is returned when a row read back does not match its checksum.
+var ErrIntegrity = errors.New("db: row integrity check failed")
+
+// Protect makes column hold an HMAC-SHA256 checksum of every other column of
+// the model, computed with key. Repository stores it on Insert and Update and
+// verifies it on Find, failing with ErrIntegrity on mismatch; without the key
+// a row cannot be altered consistently in the database. Protect is meant to
+// be called once, right after registration.
+func (m *Model) Protect(column string, key []byte) error {
+	fi, ok := m.fields[column]
+	if !ok {
+		return fmt.Errorf("db: %s has no column %s", m.Table, column)
+	}
+	if fi.Field.Type.Kind() != reflect.String {
+		return fmt.Errorf("db: checksum column %s.%s must be a string", m.Table, column)
+	}
+	if len(key) == 0 {
+		return fmt.Errorf("db: empty checksum key for %s", m.Table)
+	}
+
+	m.checksumColumn = column
+	m.checksumKey = append([]byte(nil), key...)
+	return nil
+}
+
+// Protected reports whether the model carries a checksum column.
+func (m *Model) Protected() bool {
+	return m.checksumColumn != ""
+}
+
+// Checksum computes the checksum of entity.
+func (m *Model) Checksum(entity interface{}) (string, error) {
+	mac := hmac.New(sha256.New, m.checksumKey)
+
+	for _, column := range m.Columns {
+		if column == m.checksumColumn {
+			continue
+		}
+		if err := writeChecksumValue(mac, column, m.ValueOf(entity, column)); err != nil {
+			return "", fmt.Errorf("db: checksum of %s.%s: %w", m.Table, column, err)
+		}
+	}
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Seal stores the checksum of entity, a pointer, in its checksum column. It
+// does nothing for unprotected models.
+func (m *Model) Seal(entity interface{}) error {
+	if !m.Protected() {
+		return nil
+	}
+
+	sum, err := m.Checksum(entity)
+	if err != nil {
+		return err
+	}
+
+	m.Field(entity, m.checksumColumn).SetString(sum)
+	return nil
+}
+
+// Verify checks entity against its checksum column. It does nothing for
+// unprotected models.
+func (m *Model) Verify(entity interface{}) error {
+	if !m.Protected() {
+		return nil
+	}
+
+	sum, err := m.Checksum(entity)
+	if err != nil {
+		return err
+	}
+
+	stored, _ := m.ValueOf(entity, m.checksumColumn).(string)
+	if !hmac.Equal([]byte(sum), []byte(stored)) {
+		return fmt.Errorf("%w: %s %v", ErrIntegrity, m.Table, m.KeyOf(entity))
+	}
+	return nil
+}
+
+// writeChecksumValue feeds column and a canonical encoding of value to h, so
+// that a value survives the round trip to the database with the same
+// encoding.
+func writeChecksumValue(h hash.Hash, column string, value interface{}) error {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		value = v
+	}
+
+	var kind byte
+	var data []byte
+
+	switch v := value.(type) {
+	case nil:
+		kind = 'n'
+	case []byte:
+		kind, data = 'b', v
+	case string:
+		kind, data = 's', []byte(v)
+	case bool:
+		kind, data = 't', []byte(strconv.FormatBool(v))
+	case time.Time:
+		// databases keep microseconds and may return another time zone
+		kind, data = 'd', []byte(v.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano))
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			kind, data = 'i', []byte(strconv.FormatInt(rv.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			kind, data = 'i', []byte(strconv.FormatUint(rv.Uint(), 10))
+		case reflect.Float32, reflect.Float64:
+			kind, data = 'f', []byte(strconv.FormatFloat(rv.Float(), 'g', -1, 64))
+		case reflect.String:
+			kind, data = 's', []byte(rv.String())
+		case reflect.Bool:
+			kind, data = 't', []byte(strconv.FormatBool(rv.Bool()))
+		default:
+			return fmt.Errorf("unsupported type %T", value)
+		}
+	}
+
+	var length [8]byte
+	h.Write([]byte(column))
+	h.Write([]byte{0, kind})
+	binary.BigEndian.PutUint64(length[:], uint64(len(data)))
+	h.Write(length[:])
+	h.Write(data)
+	return nil
+}
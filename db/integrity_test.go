@@ -0,0 +1,80 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type integrityEntry struct {
+	ID       int64     `db:"id"`
+	Amount   float64   `db:"amount"`
+	PostedAt time.Time `db:"posted_at"`
+	Checksum string    `db:"checksum"`
+}
+
+func init() {
+	MustRegister(integrityEntry{}, "ledger_entries").Protect("checksum", []byte("secret"))
+}
+
+type integrityUnprotected struct {
+	ID       int64   `db:"id"`
+	Amount   float64 `db:"amount"`
+	Checksum string  `db:"checksum"`
+}
+
+func TestShouldRejectInvalidChecksumColumns(t *testing.T) {
+	model := MustRegister(integrityUnprotected{}, "integrity_unprotected")
+
+	assert.NotNil(t, model.Protect("missing", []byte("k")))
+	assert.NotNil(t, model.Protect("amount", []byte("k")))
+	assert.NotNil(t, model.Protect("checksum", nil))
+	assert.False(t, model.Protected())
+}
+
+func TestShouldSealAndVerifyAcrossTimeZones(t *testing.T) {
+	model, _ := ModelOf(integrityEntry{})
+	posted := time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.UTC)
+
+	entry := &integrityEntry{ID: 1, Amount: 10.5, PostedAt: posted}
+	assert.Nil(t, model.Seal(entry))
+	assert.Len(t, entry.Checksum, 64)
+
+	readBack := *entry
+	readBack.PostedAt = posted.Truncate(time.Microsecond).In(time.FixedZone("BRT", -3*3600))
+	assert.Nil(t, model.Verify(&readBack))
+
+	readBack.Amount = 1000
+	assert.True(t, errors.Is(model.Verify(&readBack), ErrIntegrity))
+}
+
+func TestShouldStoreChecksumOnInsertAndVerifyOnFind(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, err := NewRepository[integrityEntry]()
+	assert.Nil(t, err)
+	posted := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	entry := &integrityEntry{ID: 1, Amount: 10, PostedAt: posted}
+	model, _ := ModelOf(entry)
+	sum, _ := model.Checksum(entry)
+
+	mock.ExpectExec("INSERT INTO ledger_entries").
+		WithArgs(int64(1), float64(10), posted, sum).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.Nil(t, repo.Insert(uw, entry))
+	assert.Equal(t, sum, entry.Checksum)
+
+	columns := []string{"id", "amount", "posted_at", "checksum"}
+	mock.ExpectQuery("SELECT (.+) FROM ledger_entries").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 10.0, posted, sum))
+	_, err = repo.Find(uw, 1)
+	assert.Nil(t, err)
+
+	mock.ExpectQuery("SELECT (.+) FROM ledger_entries").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, 99.0, posted, sum))
+	_, err = repo.Find(uw, 1)
+	assert.True(t, errors.Is(err, ErrIntegrity))
+}
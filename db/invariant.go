@@ -0,0 +1,60 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// InvariantError is returned when a query registered with AssertInvariant
+// found its invariant broken. The transaction is rolled back.
+type InvariantError struct {
+	Query string
+	Args  []interface{}
+}
+
+func (e *InvariantError) Error() string {
+	return fmt.Sprintf("db: invariant violated: %s", e.Query)
+}
+
+type invariant struct {
+	query string
+	args  []interface{}
+}
+
+// AssertInvariant registers query, selecting a single boolean, to be checked
+// in the transaction right before it commits; a false or NULL result aborts
+// it with an InvariantError. Outside a transaction the check runs at once.
+func (u *unitOfWork) AssertInvariant(query string, args ...interface{}) error {
+	check := invariant{query: query, args: args}
+	if u.tx == nil {
+		return u.check(check)
+	}
+
+	u.invariants = append(u.invariants, check)
+	return nil
+}
+
+// checkInvariants runs and clears the registered invariants, in registration
+// order, stopping at the first broken one.
+func (u *unitOfWork) checkInvariants() error {
+	invariants := u.invariants
+	u.invariants = nil
+
+	for _, check := range invariants {
+		if err := u.check(check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *unitOfWork) check(check invariant) error {
+	var holds sql.NullBool
+	if err := u.Get(&holds, check.query, check.args...); err != nil {
+		return fmt.Errorf("db: checking invariant %s: %w", check.query, err)
+	}
+	if !holds.Bool {
+		return &InvariantError{Query: check.query, Args: check.args}
+	}
+	return nil
+}
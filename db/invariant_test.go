@@ -0,0 +1,61 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const splitsMatchTotal = "SELECT (SELECT SUM(amount) FROM splits WHERE invoice_id = ?) = (SELECT total FROM invoices WHERE id = ?)"
+
+func TestShouldCheckInvariantsBeforeCommit(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO splits").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`^SELECT \(SELECT SUM\(amount\)`).WithArgs(7, 7).WillReturnRows(sqlmock.NewRows([]string{"holds"}).AddRow(true))
+	mock.ExpectCommit()
+
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		assert.Nil(t, tx.AssertInvariant(splitsMatchTotal, 7, 7))
+		tx.MustExec("INSERT INTO splits (invoice_id, amount) VALUES (?, ?)", 7, 100)
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollBackOnBrokenInvariant(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO splits").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`^SELECT \(SELECT SUM\(amount\)`).WillReturnRows(sqlmock.NewRows([]string{"holds"}).AddRow(nil))
+	mock.ExpectRollback()
+
+	committed := false
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.AfterCommit(func() { committed = true })
+		tx.AssertInvariant(splitsMatchTotal, 7, 7)
+		tx.MustExec("INSERT INTO splits (invoice_id, amount) VALUES (?, ?)", 7, 100)
+		return nil, nil
+	})
+
+	var violation *InvariantError
+	if assert.True(t, errors.As(err, &violation)) {
+		assert.Equal(t, splitsMatchTotal, violation.Query)
+	}
+	assert.False(t, committed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldCheckInvariantsAtOnceOutsideTransactions(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT \(SELECT SUM\(amount\)`).WillReturnRows(sqlmock.NewRows([]string{"holds"}).AddRow(false))
+
+	err := uow.AssertInvariant(splitsMatchTotal, 7, 7)
+
+	assert.IsType(t, &InvariantError{}, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
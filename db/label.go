@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"strings"
+)
+
+type labelKey struct{}
+
+// WithLabel returns a context naming the statements run with it, e.g.
+// "report.monthly_revenue". Labels reach interceptors through Statement.Label
+// and are the stable handle for per-query settings such as timeouts.
+func WithLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, labelKey{}, label)
+}
+
+// LabelFrom returns the label stored by WithLabel, or "".
+func LabelFrom(ctx context.Context) string {
+	label, _ := ctx.Value(labelKey{}).(string)
+	return label
+}
+
+// Fingerprint normalizes query so that statements differing only in literal
+// values, placeholders, whitespace, comments, keyword case or the length of
+// IN lists share the same fingerprint.
+func Fingerprint(query string) string {
+	var parts []string
+
+	for _, t := range lexSQL(query) {
+		text := t.text
+		switch t.kind {
+		case sqlString, sqlNumber, sqlPlaceholder:
+			text = "?"
+		case sqlWord:
+			text = strings.ToLower(text)
+		}
+
+		// collapse "?, ?, ?" into "?"
+		if text == "?" && len(parts) >= 2 && parts[len(parts)-1] == "," && parts[len(parts)-2] == "?" {
+			parts = parts[:len(parts)-1]
+			continue
+		}
+
+		parts = append(parts, text)
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,22 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldFingerprintQueriesIgnoringValues(t *testing.T) {
+	a := Fingerprint("SELECT id FROM orders WHERE status = 'paid' AND id IN (1, 2, 3) -- hot path")
+	b := Fingerprint("select id\n  from orders where status = $1 and id in ($2)")
+
+	assert.Equal(t, "select id from orders where status = ? and id in ( ? )", a)
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, Fingerprint("SELECT id FROM invoices WHERE status = ?"))
+}
+
+func TestShouldCarryLabelInContext(t *testing.T) {
+	assert.Equal(t, "", LabelFrom(context.Background()))
+	assert.Equal(t, "reports.revenue", LabelFrom(WithLabel(context.Background(), "reports.revenue")))
+}
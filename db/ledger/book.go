@@ -0,0 +1,295 @@
+package ledger
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+var (
+	// ErrUnbalanced is returned by Post when debits and credits differ in any
+	// currency.
+	ErrUnbalanced = errors.New("ledger: debits do not equal credits")
+
+	// ErrInvalidEntry is returned by Post for entries without an account or
+	// currency, or with a non-positive amount.
+	ErrInvalidEntry = errors.New("ledger: invalid entry")
+
+	// ErrOverflow is returned by Post when the amounts of a posting, or a
+	// balance it produces, do not fit in an int64.
+	ErrOverflow = errors.New("ledger: amount overflows int64")
+
+	// ErrNotInTransaction is returned by Post outside a transaction, where
+	// journal and balances could not be written atomically.
+	ErrNotInTransaction = errors.New("ledger: posting requires a transaction")
+)
+
+// Entry is one leg of a posting. Amounts are in minor currency units
+// (cents), never fractional.
+type Entry struct {
+	Account  string
+	Currency string
+	Amount   int64
+	Credit   bool
+}
+
+// Debit returns an entry debiting amount to account.
+func Debit(account, currency string, amount int64) Entry {
+	return Entry{Account: account, Currency: currency, Amount: amount}
+}
+
+// Credit returns an entry crediting amount to account.
+func Credit(account, currency string, amount int64) Entry {
+	return Entry{Account: account, Currency: currency, Amount: amount, Credit: true}
+}
+
+// signed returns the amount as added to the balance: balances are
+// debit-normal, debits add and credits subtract.
+func (e Entry) signed() int64 {
+	if e.Credit {
+		return -e.Amount
+	}
+	return e.Amount
+}
+
+// BookConfig configures a Book. Tables default to ledger_journal and
+// ledger_balances:
+//
+//	CREATE TABLE ledger_journal (
+//		transaction_id varchar(32) NOT NULL,
+//		account        varchar(64) NOT NULL,
+//		currency       char(3)     NOT NULL,
+//		amount         bigint      NOT NULL,
+//		posted_at      timestamp   NOT NULL
+//	);
+//	CREATE TABLE ledger_balances (
+//		account  varchar(64) NOT NULL,
+//		currency char(3)     NOT NULL,
+//		balance  bigint      NOT NULL,
+//		PRIMARY KEY (account, currency)
+//	);
+type BookConfig struct {
+	JournalTable string
+	BalanceTable string
+
+	// CheckBalance, when set, sees every balance a posting is about to
+	// produce, while its row is locked, and may veto the posting, e.g. to
+	// forbid overdrafts.
+	CheckBalance func(account, currency string, balance int64) error
+}
+
+// Book is a double-entry book: every posting writes balanced journal rows and
+// updates the balances of the accounts involved in the same transaction.
+type Book struct {
+	config BookConfig
+}
+
+// NewBook creates a book over the configured tables.
+func NewBook(config BookConfig) *Book {
+	if config.JournalTable == "" {
+		config.JournalTable = "ledger_journal"
+	}
+	if config.BalanceTable == "" {
+		config.BalanceTable = "ledger_balances"
+	}
+
+	return &Book{config: config}
+}
+
+// DefaultBook is the book used by Post and the package-level balance queries.
+var DefaultBook = NewBook(BookConfig{})
+
+// Post records entries in DefaultBook.
+func Post(uow db.UnitOfWork, entries ...Entry) (string, error) {
+	return DefaultBook.Post(uow, entries...)
+}
+
+// Balance returns the balance of account in currency from DefaultBook.
+func Balance(uow db.UnitOfWork, account, currency string) (int64, error) {
+	return DefaultBook.Balance(uow, account, currency)
+}
+
+type balanceKey struct {
+	account  string
+	currency string
+}
+
+// Post validates that entries balance per currency, then, inside the
+// transaction of uow, locks the balance rows involved in a fixed order so
+// concurrent postings cannot deadlock, writes the journal rows and updates
+// the balances. It returns the ID shared by the journal rows.
+func (b *Book) Post(uow db.UnitOfWork, entries ...Entry) (string, error) {
+	if !db.IsTransactional(uow) {
+		return "", ErrNotInTransaction
+	}
+
+	totals := map[balanceKey]int64{}
+	sums := map[string]int64{}
+	for _, e := range entries {
+		if e.Account == "" || e.Currency == "" || e.Amount <= 0 {
+			return "", fmt.Errorf("%w: %+v", ErrInvalidEntry, e)
+		}
+		k := balanceKey{e.Account, e.Currency}
+		total, ok := add(totals[k], e.signed())
+		if !ok {
+			return "", fmt.Errorf("%w: %s %s", ErrOverflow, e.Account, e.Currency)
+		}
+		sum, ok := add(sums[e.Currency], e.signed())
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrOverflow, e.Currency)
+		}
+		totals[k], sums[e.Currency] = total, sum
+	}
+
+	if len(entries) < 2 {
+		return "", fmt.Errorf("%w: a posting needs at least two entries", ErrUnbalanced)
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return "", fmt.Errorf("%w: %s off by %d", ErrUnbalanced, currency, sum)
+		}
+	}
+
+	keys := make([]balanceKey, 0, len(totals))
+	for k := range totals {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		return keys[i].currency < keys[j].currency
+	})
+
+	for _, k := range keys {
+		balance, err := b.lockBalance(uow, k)
+		if err != nil {
+			return "", err
+		}
+
+		balance, ok := add(balance, totals[k])
+		if !ok {
+			return "", fmt.Errorf("%w: balance of %s %s", ErrOverflow, k.account, k.currency)
+		}
+		if b.config.CheckBalance != nil {
+			if err := b.config.CheckBalance(k.account, k.currency, balance); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	id, err := transactionID()
+	if err != nil {
+		return "", err
+	}
+
+	postedAt := time.Now().UTC()
+	insert := fmt.Sprintf("INSERT INTO %s (transaction_id, account, currency, amount, posted_at) "+
+		"VALUES (:transaction_id, :account, :currency, :amount, :posted_at)", b.config.JournalTable)
+	for _, e := range entries {
+		args := map[string]interface{}{
+			"transaction_id": id, "account": e.Account, "currency": e.Currency, "amount": e.signed(), "posted_at": postedAt,
+		}
+		if _, err := uow.MustNamedExec(insert, args).RowsAffected(); err != nil {
+			return "", err
+		}
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET balance = balance + :amount WHERE account = :account AND currency = :currency",
+		b.config.BalanceTable)
+	for _, k := range keys {
+		args := map[string]interface{}{"amount": totals[k], "account": k.account, "currency": k.currency}
+		if _, err := uow.MustNamedExec(update, args).RowsAffected(); err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// add returns a + b, and false when it overflows.
+func add(a, b int64) (int64, bool) {
+	sum := a + b
+	if (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, false
+	}
+	return sum, true
+}
+
+// lockBalance makes sure the balance row exists and locks it.
+func (b *Book) lockBalance(uow db.UnitOfWork, k balanceKey) (int64, error) {
+	var create, lock string
+	switch db.DialectOf(uow) {
+	case db.DialectPostgres:
+		create = "INSERT INTO %s (account, currency, balance) VALUES (:account, :currency, 0) ON CONFLICT DO NOTHING"
+		lock = " FOR UPDATE"
+	case db.DialectMySQL:
+		create = "INSERT IGNORE INTO %s (account, currency, balance) VALUES (:account, :currency, 0)"
+		lock = " FOR UPDATE"
+	default:
+		create = "INSERT OR IGNORE INTO %s (account, currency, balance) VALUES (:account, :currency, 0)"
+	}
+
+	args := map[string]interface{}{"account": k.account, "currency": k.currency}
+	if _, err := uow.MustNamedExec(fmt.Sprintf(create, b.config.BalanceTable), args).RowsAffected(); err != nil {
+		return 0, err
+	}
+
+	var balance int64
+	query := fmt.Sprintf("SELECT balance FROM %s WHERE account = ? AND currency = ?", b.config.BalanceTable) + lock
+	err := uow.Get(&balance, uow.Rebind(query), k.account, k.currency)
+	return balance, err
+}
+
+// Balance returns the balance of account in currency, zero for accounts
+// never posted to.
+func (b *Book) Balance(uow db.UnitOfWork, account, currency string) (int64, error) {
+	balances, err := b.query(uow, "SELECT currency, balance FROM %s WHERE account = ? AND currency = ?",
+		b.config.BalanceTable, account, currency)
+	return balances[currency], err
+}
+
+// Balances returns every balance of account by currency.
+func (b *Book) Balances(uow db.UnitOfWork, account string) (map[string]int64, error) {
+	return b.query(uow, "SELECT currency, balance FROM %s WHERE account = ?", b.config.BalanceTable, account)
+}
+
+// BalancesAsOf recomputes the balances of account by currency from the
+// journal rows posted up to at.
+func (b *Book) BalancesAsOf(uow db.UnitOfWork, account string, at time.Time) (map[string]int64, error) {
+	return b.query(uow, "SELECT currency, SUM(amount) FROM %s WHERE account = ? AND posted_at <= ? GROUP BY currency",
+		b.config.JournalTable, account, at.UTC())
+}
+
+func (b *Book) query(uow db.UnitOfWork, query, table string, args ...interface{}) (map[string]int64, error) {
+	rows, err := uow.Query(uow.Rebind(fmt.Sprintf(query, table)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := map[string]int64{}
+	for rows.Next() {
+		var currency string
+		var balance int64
+		if err := rows.Scan(&currency, &balance); err != nil {
+			return nil, err
+		}
+		balances[currency] = balance
+	}
+
+	return balances, rows.Err()
+}
+
+func transactionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,137 @@
+package ledger
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockTransaction(t *testing.T, driver string) (db.UnitOfWork, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	mock.ExpectBegin()
+	database := sqlx.NewDb(conn, driver)
+	tx, err := database.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db.NewUnitOfWork(database, tx), mock
+}
+
+func TestShouldPostBalancedEntries(t *testing.T) {
+	uow, mock := newMockTransaction(t, "postgres")
+
+	for _, account := range []string{"cash", "revenue"} {
+		mock.ExpectExec(`INSERT INTO ledger_balances \(account, currency, balance\) VALUES \(\$1, \$2, 0\) ON CONFLICT DO NOTHING`).
+			WithArgs(account, "USD").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT balance FROM ledger_balances WHERE account = \$1 AND currency = \$2 FOR UPDATE`).
+			WithArgs(account, "USD").
+			WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(0))
+	}
+	mock.ExpectExec("INSERT INTO ledger_journal").
+		WithArgs(sqlmock.AnyArg(), "revenue", "USD", int64(-100), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ledger_journal").
+		WithArgs(sqlmock.AnyArg(), "cash", "USD", int64(150), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO ledger_journal").
+		WithArgs(sqlmock.AnyArg(), "revenue", "USD", int64(-50), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE ledger_balances SET balance = balance \+ \$1`).
+		WithArgs(int64(150), "cash", "USD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE ledger_balances SET balance = balance \+ \$1`).
+		WithArgs(int64(-150), "revenue", "USD").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	id, err := Post(uow, Credit("revenue", "USD", 100), Debit("cash", "USD", 150), Credit("revenue", "USD", 50))
+	assert.Nil(t, err)
+	assert.Len(t, id, 32)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectUnbalancedPostings(t *testing.T) {
+	uow, _ := newMockTransaction(t, "postgres")
+
+	_, err := Post(uow, Debit("cash", "USD", 100), Credit("revenue", "USD", 90))
+	assert.True(t, errors.Is(err, ErrUnbalanced))
+
+	_, err = Post(uow, Debit("cash", "USD", 100), Credit("revenue", "EUR", 100))
+	assert.True(t, errors.Is(err, ErrUnbalanced))
+
+	_, err = Post(uow, Debit("cash", "USD", -100), Credit("revenue", "USD", -100))
+	assert.True(t, errors.Is(err, ErrInvalidEntry))
+}
+
+func TestShouldRejectPostingsOverflowingInt64(t *testing.T) {
+	uow, mock := newMockTransaction(t, "postgres")
+
+	_, err := Post(uow, Debit("a", "USD", 1<<62), Debit("b", "USD", 1<<62), Debit("c", "USD", 1<<62), Debit("d", "USD", 1<<62))
+	assert.True(t, errors.Is(err, ErrOverflow), "%v", err)
+
+	_, err = Post(uow, Debit("cash", "USD", 1<<62), Debit("cash", "USD", 1<<62), Credit("revenue", "USD", 1<<62), Credit("revenue", "USD", 1<<62))
+	assert.EqualError(t, err, "ledger: amount overflows int64: cash USD")
+
+	mock.ExpectExec("INSERT INTO ledger_balances").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT balance FROM ledger_balances").
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(int64(1<<63 - 1)))
+	_, err = Post(uow, Debit("cash", "USD", 1), Credit("revenue", "USD", 1))
+	assert.EqualError(t, err, "ledger: amount overflows int64: balance of cash USD")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequireTransactionToPost(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t, "postgres")
+
+	_, err := Post(uow, Debit("cash", "USD", 100), Credit("revenue", "USD", 100))
+	assert.True(t, errors.Is(err, ErrNotInTransaction))
+}
+
+func TestShouldVetoPostingOnBalanceCheck(t *testing.T) {
+	overdraft := errors.New("overdraft")
+	book := NewBook(BookConfig{CheckBalance: func(account, currency string, balance int64) error {
+		if balance < 0 && account == "cash" {
+			return overdraft
+		}
+		return nil
+	}})
+	uow, mock := newMockTransaction(t, "sqlite3")
+
+	mock.ExpectExec("INSERT OR IGNORE INTO ledger_balances").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT balance FROM ledger_balances WHERE account = \\? AND currency = \\?$").
+		WithArgs("cash", "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(30))
+
+	_, err := book.Post(uow, Credit("cash", "USD", 50), Debit("expenses", "USD", 50))
+	assert.Equal(t, overdraft, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldQueryBalances(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t, "postgres")
+
+	mock.ExpectQuery(`SELECT currency, balance FROM ledger_balances WHERE account = \$1$`).
+		WithArgs("cash").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "balance"}).AddRow("USD", 150).AddRow("EUR", -20))
+	mock.ExpectQuery(`SELECT currency, balance FROM ledger_balances WHERE account = \$1 AND currency = \$2`).
+		WithArgs("cash", "BRL").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "balance"}))
+
+	balances, err := DefaultBook.Balances(uow, "cash")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"USD": 150, "EUR": -20}, balances)
+
+	balance, err := Balance(uow, "cash", "BRL")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), balance)
+}
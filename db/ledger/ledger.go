@@ -0,0 +1,284 @@
+// Package ledger keeps append-only, hash-chained tables on top of the db
+// package, for financial records that must be tamper-evident.
+//
+// Every row of a ledger table carries a sequence number, the hash of the row
+// before it and its own hash: an HMAC over all its columns, the previous hash
+// included. Altering, removing or reordering rows in the database breaks the
+// chain, which Verify detects; a head table records where the chain ends, so
+// that removing its last rows is detected as well.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+var (
+	// ErrAppendOnly is returned by the guard for statements that would change
+	// or remove rows of a ledger table.
+	ErrAppendOnly = errors.New("ledger: table is append-only")
+
+	// ErrBrokenChain is returned by Verify when the hash chain does not hold.
+	ErrBrokenChain = errors.New("ledger: hash chain broken")
+)
+
+// Config configures a Ledger. Column names default to seq, prev_hash and hash,
+// the head table to ledger_heads:
+//
+//	CREATE TABLE ledger_heads (
+//		ledger_table varchar(64) PRIMARY KEY,
+//		seq          bigint      NOT NULL,
+//		hash         varchar(64) NOT NULL
+//	);
+type Config struct {
+	// Key signs the chain. It must be kept out of the database.
+	Key []byte
+
+	// SequenceColumn holds the position of the row in the chain. It must be
+	// unique, so that concurrent appends conflict instead of forking the
+	// chain.
+	SequenceColumn string
+	PrevHashColumn string
+	HashColumn     string
+
+	// HeadTable stores the sequence number and hash of the last row of
+	// every ledger, moved along by Append, against which Verify checks the
+	// end of the chain: rows removed from the tail leave no gap in the chain
+	// itself.
+	HeadTable string
+}
+
+// Ledger appends entries of a registered model T to its hash-chained table.
+type Ledger[T any] struct {
+	model      *db.Model
+	repository *db.Repository[T]
+	config     Config
+}
+
+// New creates the ledger for T, which must be registered with integer
+// sequence and string hash columns. It protects the model's hash column, so
+// Repository reads of T are verified row by row as well.
+func New[T any](config Config) (*Ledger[T], error) {
+	if config.SequenceColumn == "" {
+		config.SequenceColumn = "seq"
+	}
+	if config.PrevHashColumn == "" {
+		config.PrevHashColumn = "prev_hash"
+	}
+	if config.HashColumn == "" {
+		config.HashColumn = "hash"
+	}
+	if config.HeadTable == "" {
+		config.HeadTable = "ledger_heads"
+	}
+
+	repository, err := db.NewRepository[T]()
+	if err != nil {
+		return nil, err
+	}
+	model := repository.Model()
+
+	var zero T
+	if kind := model.Field(&zero, config.SequenceColumn).Kind(); kind < reflect.Int || kind > reflect.Int64 {
+		return nil, fmt.Errorf("ledger: %s.%s must be an integer column", model.Table, config.SequenceColumn)
+	}
+	if model.Field(&zero, config.PrevHashColumn).Kind() != reflect.String {
+		return nil, fmt.Errorf("ledger: %s.%s must be a string column", model.Table, config.PrevHashColumn)
+	}
+	if err := model.Protect(config.HashColumn, config.Key); err != nil {
+		return nil, err
+	}
+
+	return &Ledger[T]{model: model, repository: repository, config: config}, nil
+}
+
+// Append links entry to the end of the chain, inserts it and moves the stored
+// head to it, which must be in the same transaction. The chain head is read
+// with FOR UPDATE where the database supports it; a concurrent append still
+// fails on the unique sequence and can be retried. Append fails with
+// ErrBrokenChain when the stored head is not the last row of the table.
+func (l *Ledger[T]) Append(uow db.UnitOfWork, entry *T) error {
+	query := fmt.Sprintf("SELECT %s, %s FROM %s ORDER BY %s DESC LIMIT 1",
+		l.config.SequenceColumn, l.config.HashColumn, l.model.Table, l.config.SequenceColumn)
+	if dialect := db.DialectOf(uow); dialect == db.DialectPostgres || dialect == db.DialectMySQL {
+		query += " FOR UPDATE"
+	}
+
+	rows, err := uow.Query(query)
+	if err != nil {
+		return err
+	}
+
+	var seq int64
+	var prev string
+	if rows.Next() {
+		err = rows.Scan(&seq, &prev)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	l.model.Field(entry, l.config.SequenceColumn).SetInt(seq + 1)
+	l.model.Field(entry, l.config.PrevHashColumn).SetString(prev)
+
+	if err := l.repository.Insert(uow, entry); err != nil {
+		return err
+	}
+	hash, _ := l.model.ValueOf(entry, l.config.HashColumn).(string)
+	return l.moveHead(uow, seq, seq+1, hash)
+}
+
+// moveHead moves the stored head of the ledger from row from to row to.
+func (l *Ledger[T]) moveHead(uow db.UnitOfWork, from, to int64, hash string) error {
+	if from == 0 {
+		query := fmt.Sprintf("INSERT INTO %s (ledger_table, seq, hash) VALUES (?, ?, ?)", l.config.HeadTable)
+		_, err := uow.Exec(uow.Rebind(query), l.model.Table, to, hash)
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET seq = ?, hash = ? WHERE ledger_table = ? AND seq = ?", l.config.HeadTable)
+	result, err := uow.Exec(uow.Rebind(query), to, hash, l.model.Table, from)
+	if err != nil {
+		return err
+	}
+	if moved, err := result.RowsAffected(); err != nil || moved == 0 {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s ends at row %d, which is not its stored head", ErrBrokenChain, l.model.Table, from)
+	}
+	return nil
+}
+
+// head returns the stored head of the ledger, zero when it has none.
+func (l *Ledger[T]) head(uow db.UnitOfWork) (int64, string, error) {
+	query := fmt.Sprintf("SELECT seq, hash FROM %s WHERE ledger_table = ?", l.config.HeadTable)
+	rows, err := uow.Query(uow.Rebind(query), l.model.Table)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	var seq int64
+	var hash string
+	if rows.Next() {
+		if err := rows.Scan(&seq, &hash); err != nil {
+			return 0, "", err
+		}
+	}
+	return seq, hash, rows.Err()
+}
+
+// Verify walks the whole chain in sequence order, failing with
+// ErrBrokenChain at the first row that was altered, removed or moved, or when
+// the chain does not end at the stored head.
+func (l *Ledger[T]) Verify(uow db.UnitOfWork) error {
+	query := fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+		strings.Join(l.model.Columns, ", "), l.model.Table, l.config.SequenceColumn)
+
+	rows, err := uow.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var expected int64 = 1
+	prev := ""
+
+	for rows.Next() {
+		var entry T
+		if err := rows.StructScan(&entry); err != nil {
+			return err
+		}
+
+		seq := l.model.Field(&entry, l.config.SequenceColumn).Int()
+		switch {
+		case seq != expected:
+			return fmt.Errorf("%w: %s expected sequence %d, found %d", ErrBrokenChain, l.model.Table, expected, seq)
+		case l.model.ValueOf(&entry, l.config.PrevHashColumn) != prev:
+			return fmt.Errorf("%w: %s row %d does not follow row %d", ErrBrokenChain, l.model.Table, seq, seq-1)
+		}
+
+		if err := l.model.Verify(&entry); err != nil {
+			return fmt.Errorf("%w: %s row %d was altered", ErrBrokenChain, l.model.Table, seq)
+		}
+
+		prev, _ = l.model.ValueOf(&entry, l.config.HashColumn).(string)
+		expected++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	seq, hash, err := l.head(uow)
+	if err != nil {
+		return err
+	}
+	if seq != expected-1 || hash != prev {
+		return fmt.Errorf("%w: %s ends at row %d, its stored head is row %d", ErrBrokenChain, l.model.Table, expected-1, seq)
+	}
+	return nil
+}
+
+// Guard returns an interceptor keeping the ledger's table append-only.
+func (l *Ledger[T]) Guard() db.Interceptor {
+	return Guard(l.model.Table)
+}
+
+// Guard returns an interceptor rejecting with ErrAppendOnly any statement
+// touching tables that does anything but insert new rows or read: updates,
+// deletes, upserts, merges, truncation and DDL, triggers included. Statements
+// combining a ledger table with writes to other tables are rejected as well.
+// Every statement of a multi-statement string is checked, and statements
+// whose verb the guard does not know, such as COPY, CALL, DO or EXECUTE, are
+// rejected whatever they touch since their effect cannot be told from their
+// text.
+func Guard(tables ...string) db.Interceptor {
+	return func(ctx context.Context, stmt *db.Statement, next db.Handler) error {
+		for _, statement := range db.SplitStatements(db.DialectFor(stmt.Driver), stmt.Query) {
+			if err := guardStatement(stmt.Driver, statement, tables); err != nil {
+				return err
+			}
+		}
+
+		return next(ctx, stmt)
+	}
+}
+
+func guardStatement(driver, statement string, tables []string) error {
+	info := db.Inspect(driver, statement)
+
+	switch info.Verb {
+	case "SET", "RESET", "SHOW", "BEGIN", "START", "COMMIT", "END", "ROLLBACK", "SAVEPOINT", "RELEASE":
+		return nil
+	case "SELECT", "VALUES", "TABLE", "WITH", "EXPLAIN", "INSERT":
+		// reads and appends, unless they change rows on the way
+	case "UPDATE", "DELETE", "MERGE", "REPLACE", "TRUNCATE", "CREATE", "ALTER", "DROP",
+		"COMMENT", "GRANT", "REVOKE", "LOCK", "VACUUM", "CLUSTER", "REINDEX":
+		info.Operations = append(info.Operations, info.Verb)
+	default:
+		return fmt.Errorf("%w: cannot classify %s statement", ErrAppendOnly, info.Verb)
+	}
+
+	for _, table := range tables {
+		if !db.Mentions(driver, statement, table) {
+			continue
+		}
+		for _, op := range info.Operations {
+			if op != "INSERT" {
+				return fmt.Errorf("%w: %s on %s", ErrAppendOnly, op, table)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type entry struct {
+	Seq      int64  `db:"seq,pk"`
+	Account  string `db:"account"`
+	Amount   int64  `db:"amount"`
+	PrevHash string `db:"prev_hash"`
+	Hash     string `db:"hash"`
+}
+
+func init() {
+	db.MustRegister(entry{}, "journal")
+}
+
+func newLedger(t *testing.T) *Ledger[entry] {
+	l, err := New[entry](Config{Key: []byte("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func newMockUnitOfWork(t *testing.T, driver string, opts ...db.Option) (db.UnitOfWork, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return db.NewUnitOfWork(sqlx.NewDb(conn, driver), nil, opts...), mock
+}
+
+// chain builds n linked entries the way Append would.
+func chain(t *testing.T, l *Ledger[entry], n int) []entry {
+	var entries []entry
+	prev := ""
+	for i := 1; i <= n; i++ {
+		e := entry{Seq: int64(i), Account: "cash", Amount: int64(i * 10), PrevHash: prev}
+		assert.Nil(t, l.model.Seal(&e))
+		entries = append(entries, e)
+		prev = e.Hash
+	}
+	return entries
+}
+
+func rowsOf(entries []entry) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"seq", "account", "amount", "prev_hash", "hash"})
+	for _, e := range entries {
+		rows.AddRow(e.Seq, e.Account, e.Amount, e.PrevHash, e.Hash)
+	}
+	return rows
+}
+
+func TestShouldAppendLinkedToChainHead(t *testing.T) {
+	l := newLedger(t)
+	uow, mock := newMockUnitOfWork(t, "mysql")
+
+	mock.ExpectQuery("SELECT seq, hash FROM journal ORDER BY seq DESC LIMIT 1 FOR UPDATE").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}).AddRow(3, "abc"))
+	mock.ExpectExec("INSERT INTO journal").
+		WithArgs(int64(4), "cash", int64(5), "abc", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`^UPDATE ledger_heads SET seq = \?, hash = \? WHERE ledger_table = \? AND seq = \?$`).
+		WithArgs(int64(4), sqlmock.AnyArg(), "journal", int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	e := &entry{Account: "cash", Amount: 5}
+	assert.Nil(t, l.Append(uow, e))
+	assert.Equal(t, int64(4), e.Seq)
+	assert.Nil(t, l.model.Verify(e))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldStartChainOnEmptyTable(t *testing.T) {
+	l := newLedger(t)
+	uow, mock := newMockUnitOfWork(t, "sqlite3")
+
+	mock.ExpectQuery("SELECT seq, hash FROM journal ORDER BY seq DESC LIMIT 1$").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}))
+	mock.ExpectExec("INSERT INTO journal").
+		WithArgs(int64(1), "cash", int64(5), "", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`^INSERT INTO ledger_heads \(ledger_table, seq, hash\) VALUES \(\?, \?, \?\)$`).
+		WithArgs("journal", int64(1), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.Nil(t, l.Append(uow, &entry{Account: "cash", Amount: 5}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseToAppendPastAStaleHead(t *testing.T) {
+	l := newLedger(t)
+	uow, mock := newMockUnitOfWork(t, "postgres")
+
+	mock.ExpectQuery("SELECT seq, hash FROM journal").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}).AddRow(3, "abc"))
+	mock.ExpectExec("INSERT INTO journal").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`^UPDATE ledger_heads SET seq = \$1, hash = \$2 WHERE ledger_table = \$3 AND seq = \$4$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := l.Append(uow, &entry{Account: "cash", Amount: 5})
+	assert.EqualError(t, err, "ledger: hash chain broken: journal ends at row 3, which is not its stored head")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldVerifyIntactChain(t *testing.T) {
+	l := newLedger(t)
+	uow, mock := newMockUnitOfWork(t, "postgres")
+
+	entries := chain(t, l, 3)
+	mock.ExpectQuery("SELECT seq, account, amount, prev_hash, hash FROM journal ORDER BY seq").
+		WillReturnRows(rowsOf(entries))
+	mock.ExpectQuery(`^SELECT seq, hash FROM ledger_heads WHERE ledger_table = \$1$`).WithArgs("journal").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}).AddRow(3, entries[2].Hash))
+
+	assert.Nil(t, l.Verify(uow))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldDetectTruncatedChainTail(t *testing.T) {
+	l := newLedger(t)
+	entries := chain(t, l, 3)
+
+	uow, mock := newMockUnitOfWork(t, "postgres")
+	mock.ExpectQuery("SELECT (.+) FROM journal").WillReturnRows(rowsOf(entries[:2]))
+	mock.ExpectQuery("SELECT seq, hash FROM ledger_heads").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}).AddRow(3, entries[2].Hash))
+	assert.EqualError(t, l.Verify(uow), "ledger: hash chain broken: journal ends at row 2, its stored head is row 3")
+
+	uow, mock = newMockUnitOfWork(t, "postgres")
+	mock.ExpectQuery("SELECT (.+) FROM journal").WillReturnRows(rowsOf(nil))
+	mock.ExpectQuery("SELECT seq, hash FROM ledger_heads").
+		WillReturnRows(sqlmock.NewRows([]string{"seq", "hash"}).AddRow(3, entries[2].Hash))
+	assert.True(t, errors.Is(l.Verify(uow), ErrBrokenChain))
+}
+
+func TestShouldDetectTampering(t *testing.T) {
+	l := newLedger(t)
+
+	altered := chain(t, l, 3)
+	altered[1].Amount = 1000
+
+	removed := chain(t, l, 3)
+	removed = append(removed[:1], removed[2:]...)
+
+	relinked := chain(t, l, 3)
+	relinked[2].PrevHash = relinked[0].Hash
+
+	for name, entries := range map[string][]entry{"altered": altered, "removed": removed, "relinked": relinked} {
+		uow, mock := newMockUnitOfWork(t, "postgres")
+		mock.ExpectQuery("SELECT (.+) FROM journal").WillReturnRows(rowsOf(entries))
+
+		assert.True(t, errors.Is(l.Verify(uow), ErrBrokenChain), name)
+	}
+}
+
+func TestShouldGuardAgainstChangingLedgerRows(t *testing.T) {
+	guard := Guard("journal")
+	run := func(query string) error {
+		return guard(context.Background(), &db.Statement{Query: query, Driver: "postgres"}, func(context.Context, *db.Statement) error {
+			return nil
+		})
+	}
+
+	assert.Nil(t, run("INSERT INTO journal (seq, amount) VALUES ($1, $2)"))
+	assert.Nil(t, run("SELECT * FROM journal ORDER BY seq DESC LIMIT 1 FOR UPDATE"))
+	assert.Nil(t, run("UPDATE accounts SET balance = 0"))
+	assert.Nil(t, run("INSERT INTO journal (seq) VALUES (4); UPDATE accounts SET balance = 0;"))
+	assert.Nil(t, run("SAVEPOINT s1"))
+
+	for _, query := range []string{
+		"UPDATE journal SET amount = 0",
+		"DELETE FROM public.journal WHERE seq = 3",
+		"INSERT INTO journal (seq) VALUES (1) ON CONFLICT (seq) DO UPDATE SET amount = 0",
+		"WITH gone AS (DELETE FROM journal RETURNING *) SELECT 1",
+		"TRUNCATE journal",
+		"UPDATE accounts SET balance = j.amount FROM journal j",
+		"DELETE FROM ONLY journal WHERE seq = 3",
+		"UPDATE ONLY journal SET amount = 0",
+		"SELECT 1; TRUNCATE journal",
+		"INSERT INTO journal (seq) VALUES (4); DROP TABLE journal",
+		"CREATE TRIGGER rewrite BEFORE INSERT ON journal FOR EACH ROW EXECUTE FUNCTION rewrite()",
+		"COPY journal FROM STDIN",
+		"COPY accounts FROM STDIN",
+		"DO $$ BEGIN DELETE FROM journal; END $$",
+		"CALL purge()",
+	} {
+		assert.True(t, errors.Is(run(query), ErrAppendOnly), query)
+	}
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var logging = struct {
+	sync.RWMutex
+	logger *slog.Logger
+}{}
+
+// SetLogger makes l the logger of the package, for messages not tied to a
+// unit of work with a logger of its own, such as pool and background worker
+// messages. Nil restores slog.Default, which writes through the standard
+// logger; use a logger with a discarding handler to silence the package.
+func SetLogger(l *slog.Logger) {
+	logging.Lock()
+	logging.logger = l
+	logging.Unlock()
+}
+
+// Logger returns the logger of the package, see SetLogger. Subpackages log
+// through it.
+func Logger() *slog.Logger {
+	logging.RLock()
+	defer logging.RUnlock()
+	if logging.logger == nil {
+		return slog.Default()
+	}
+	return logging.logger
+}
+
+// WithLogger sets the logger of the unit of work, for transaction outcomes
+// and statements logged with WithStatementLog, instead of the package's.
+func WithLogger(l *slog.Logger) Option {
+	return func(u *unitOfWork) {
+		u.logger = l
+	}
+}
+
+func (u *unitOfWork) log() *slog.Logger {
+	if u.logger != nil {
+		return u.logger
+	}
+	return Logger()
+}
+
+// StatementLogConfig configures WithStatementLog.
+type StatementLogConfig struct {
+	// Level of successful statements. Zero is slog.LevelInfo; failed
+	// statements are logged at slog.LevelError.
+	Level slog.Level
+
+	// SlowerThan logs successful statements running longer at
+	// slog.LevelWarn. Zero disables it.
+	SlowerThan time.Duration
+
+	// RedactArgs logs the number of arguments instead of their values, for
+	// statements carrying personal data or secrets.
+	RedactArgs bool
+
+	// PII redacts the arguments of the statements on tables with classified
+	// columns like RedactArgs, see ClassifyPII, and of statements whose
+	// tables cannot be told. Tables are matched without their schema.
+	PII PIIClassification
+}
+
+// WithStatementLog logs every statement of the unit of work with its query,
+// arguments, label, duration and error, through the logger of the unit of
+// work.
+func WithStatementLog(config StatementLogConfig) Option {
+	return func(u *unitOfWork) {
+		u.interceptors = append(u.interceptors, func(ctx context.Context, stmt *Statement, next Handler) error {
+			start := time.Now()
+			err := next(ctx, stmt)
+			duration := time.Since(start)
+
+			level := config.Level
+			switch {
+			case err != nil:
+				level = slog.LevelError
+			case config.SlowerThan > 0 && duration >= config.SlowerThan:
+				level = slog.LevelWarn
+			}
+
+			logger := u.log()
+			if !logger.Enabled(ctx, level) {
+				return err
+			}
+
+			attrs := []slog.Attr{slog.String("query", stmt.Query), slog.Duration("duration", duration), slog.Bool("in_tx", stmt.InTx)}
+			if redactsArgs(stmt, config.RedactArgs, config.PII) {
+				attrs = append(attrs, slog.Int("args", len(stmt.Args)))
+			} else {
+				attrs = append(attrs, slog.Any("args", stmt.Args))
+			}
+			if stmt.Label != "" {
+				attrs = append(attrs, slog.String("label", stmt.Label))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.Any("err", err))
+			}
+			logger.LogAttrs(ctx, level, "db: statement", attrs...)
+			return err
+		})
+	}
+}
+
+// redactsArgs reports whether the arguments of stmt must not be logged.
+func redactsArgs(stmt *Statement, redact bool, pii PIIClassification) bool {
+	if redact || len(pii) == 0 {
+		return redact
+	}
+	tables := Inspect(stmt.Driver, stmt.Query).Tables
+	return len(tables) == 0 || pii.covers(tables)
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBufferLogger() (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	return slog.New(handler), &buf
+}
+
+func TestShouldLogStatementsWithRedactedArgs(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^DELETE FROM users").WillReturnError(assert.AnError)
+
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger), WithStatementLog(StatementLogConfig{Level: slog.LevelDebug, RedactArgs: true}))
+
+	uow.MustExec("UPDATE users SET password = ? WHERE id = ?", "hunter2", 7)
+	assert.Panics(t, func() { uow.MustExec("DELETE FROM users WHERE id = ?", 7) })
+
+	assert.Equal(t, `level=DEBUG msg="db: statement" query="UPDATE users SET password = ? WHERE id = ?" in_tx=false args=2
+level=ERROR msg="db: statement" query="DELETE FROM users WHERE id = ?" in_tx=false args=1 err="`+assert.AnError.Error()+`"
+`, buf.String())
+}
+
+func TestShouldLogSlowStatementsAsWarnings(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^DELETE FROM sessions").WillDelayFor(5 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger), WithStatementLog(StatementLogConfig{SlowerThan: time.Millisecond}))
+	uow.MustExec("DELETE FROM sessions WHERE expires_at < ?", "2026-10-14")
+
+	assert.Contains(t, buf.String(), `level=WARN msg="db: statement" query="DELETE FROM sessions WHERE expires_at < ?" in_tx=false args=[2026-10-14]`)
+}
+
+func TestShouldReturnFailedCommitsInsteadOfLoggingThem(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(assert.AnError)
+
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger))
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) { return nil, nil })
+
+	assert.Equal(t, assert.AnError, err)
+	assert.Empty(t, buf.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLogThroughThePackageLogger(t *testing.T) {
+	logger, buf := newBufferLogger()
+	SetLogger(logger)
+	defer SetLogger(nil)
+
+	Logger().Info("db: hello")
+
+	assert.Equal(t, "level=INFO msg=\"db: hello\"\n", buf.String())
+	SetLogger(nil)
+	assert.Equal(t, slog.Default(), Logger())
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrMaintenanceMode is returned for write statements while maintenance mode
+// is on.
+var ErrMaintenanceMode = errors.New("db: read-only maintenance mode")
+
+// MaintenanceConfig lists the writes still allowed in maintenance mode.
+type MaintenanceConfig struct {
+	// AllowLabels lists the labels, set with WithLabel, whose statements may
+	// still write.
+	AllowLabels []string
+
+	// AllowTables lists tables that may still be written, e.g. sessions.
+	// A statement is allowed when every table it references is listed.
+	AllowTables []string
+}
+
+var maintenance = struct {
+	sync.RWMutex
+	enabled bool
+	labels  map[string]bool
+	tables  map[string]bool
+}{}
+
+// EnterMaintenanceMode makes every UnitOfWork reject write statements with
+// ErrMaintenanceMode, except those config allows, until ExitMaintenanceMode.
+// Reads are unaffected. It is safe to call at any time, e.g. from an admin
+// endpoint during a failover; statements already running are not affected.
+func EnterMaintenanceMode(config MaintenanceConfig) {
+	labels := make(map[string]bool, len(config.AllowLabels))
+	for _, label := range config.AllowLabels {
+		labels[label] = true
+	}
+	tables := make(map[string]bool, len(config.AllowTables))
+	for _, table := range config.AllowTables {
+		tables[strings.ToLower(table)] = true
+	}
+
+	maintenance.Lock()
+	defer maintenance.Unlock()
+
+	maintenance.enabled = true
+	maintenance.labels = labels
+	maintenance.tables = tables
+}
+
+// ExitMaintenanceMode lets writes through again.
+func ExitMaintenanceMode() {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+
+	maintenance.enabled = false
+	maintenance.labels = nil
+	maintenance.tables = nil
+}
+
+// InMaintenanceMode reports whether maintenance mode is on.
+func InMaintenanceMode() bool {
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+
+	return maintenance.enabled
+}
+
+// checkMaintenance returns ErrMaintenanceMode when stmt is not a read and
+// maintenance mode does not allow it. Only statements known to read are
+// reads: SELECT, VALUES, SHOW and EXPLAIN without ANALYZE, with no
+// data-modifying CTE nor INTO; anything else, including statements the
+// lexer cannot classify such as CALL, is taken for a write.
+func checkMaintenance(stmt *Statement) error {
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+
+	if !maintenance.enabled || (stmt.Label != "" && maintenance.labels[stmt.Label]) {
+		return nil
+	}
+
+	for _, tokens := range splitTokens(lexSQLFor(DialectFor(stmt.Driver), stmt.Query)) {
+		info := Inspect(stmt.Driver, stmt.Query[tokens[0].start:tokens[len(tokens)-1].end])
+		if len(info.Operations) == 0 && readsOnly(tokens) {
+			continue
+		}
+
+		allowed := len(info.Tables) > 0
+		for _, table := range info.Tables {
+			if !maintenance.tables[table] {
+				allowed = false
+				break
+			}
+		}
+		if allowed {
+			continue
+		}
+
+		refused := info.Operations
+		if len(refused) == 0 {
+			refused = []string{info.Verb}
+		}
+		return fmt.Errorf("%w: %s refused", ErrMaintenanceMode, strings.Join(refused, ", "))
+	}
+	return nil
+}
+
+// readVerbs are the verbs of statements that only read.
+var readVerbs = map[string]bool{"SELECT": true, "VALUES": true, "SHOW": true, "EXPLAIN": true}
+
+// readsOnly reports whether the statement of tokens has a read verb and
+// neither runs what it explains nor selects into a table.
+func readsOnly(tokens []sqlToken) bool {
+	verb := statementVerb(tokens)
+	if !readVerbs[verb] {
+		return false
+	}
+
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+		case verb == "EXPLAIN" && t.is("analyze"):
+			return false
+		case depth == 0 && i > 0 && t.is("into"):
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRejectWritesInMaintenanceMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("SELECT id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	EnterMaintenanceMode(MaintenanceConfig{})
+	defer ExitMaintenanceMode()
+
+	uow := NewUnitOfWork(database, nil)
+
+	var ids []int64
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders"))
+
+	_, err := uow.MustNamedExec("UPDATE orders SET total = 0", map[string]interface{}{}).RowsAffected()
+	assert.True(t, errors.Is(err, ErrMaintenanceMode))
+	assert.EqualError(t, err, "db: read-only maintenance mode: UPDATE refused")
+
+	_, err = uow.Query("WITH gone AS (DELETE FROM orders RETURNING id) SELECT id FROM gone")
+	assert.True(t, errors.Is(err, ErrMaintenanceMode))
+
+	assert.True(t, InMaintenanceMode())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldAllowWhitelistedWritesInMaintenanceMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	EnterMaintenanceMode(MaintenanceConfig{AllowTables: []string{"Sessions"}, AllowLabels: []string{"failover.drain"}})
+	defer ExitMaintenanceMode()
+
+	uow := NewUnitOfWork(database, nil)
+	uow.MustExec("DELETE FROM sessions WHERE expires_at < now()")
+
+	_, err := uow.MustNamedExec("INSERT INTO sessions SELECT * FROM orders", map[string]interface{}{}).RowsAffected()
+	assert.True(t, errors.Is(err, ErrMaintenanceMode))
+
+	drain := NewUnitOfWork(database, nil, WithContext(WithLabel(context.Background(), "failover.drain")))
+	drain.MustExec("UPDATE orders SET state = 'queued'")
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLetWritesThroughAfterMaintenanceMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	EnterMaintenanceMode(MaintenanceConfig{})
+	ExitMaintenanceMode()
+
+	NewUnitOfWork(database, nil).MustExec("UPDATE orders SET total = 0")
+
+	assert.False(t, InMaintenanceMode())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectAnythingButReadsInMaintenanceMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("^SHOW search_path$").WillReturnRows(sqlmock.NewRows([]string{"search_path"}).AddRow("public"))
+	mock.ExpectQuery("^EXPLAIN SELECT").WillReturnRows(sqlmock.NewRows([]string{"plan"}).AddRow("Seq Scan"))
+	mock.ExpectQuery("^VALUES").WillReturnRows(sqlmock.NewRows([]string{"column1"}).AddRow(1))
+
+	EnterMaintenanceMode(MaintenanceConfig{})
+	defer ExitMaintenanceMode()
+
+	uow := NewUnitOfWork(database, nil)
+
+	var values []string
+	assert.Nil(t, uow.Select(&values, "SHOW search_path"))
+	assert.Nil(t, uow.Select(&values, "EXPLAIN SELECT id FROM orders"))
+	assert.Nil(t, uow.Select(&values, "VALUES (1)"))
+
+	for _, query := range []string{
+		"CALL close_orders()",
+		"EXPLAIN ANALYZE DELETE FROM orders",
+		"EXPLAIN (ANALYZE) SELECT archive_orders()",
+		"SELECT * INTO orders_copy FROM orders",
+		"SELECT id FROM orders; DELETE FROM orders",
+		"/* cleanup */ DELETE FROM orders",
+		"TABLE orders; TRUNCATE orders",
+	} {
+		_, err := uow.Exec(query)
+		assert.True(t, errors.Is(err, ErrMaintenanceMode), query)
+	}
+
+	_, err := uow.Exec("CALL close_orders()")
+	assert.EqualError(t, err, "db: read-only maintenance mode: CALL refused")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectRawWritesInMaintenanceMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("^SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	EnterMaintenanceMode(MaintenanceConfig{})
+	defer ExitMaintenanceMode()
+
+	uow := NewUnitOfWork(database, nil)
+	err := uow.Raw(func(ext sqlx.ExtContext) error {
+		var count int
+		if err := ext.QueryRowxContext(context.Background(), "SELECT count(*) FROM orders").Scan(&count); err != nil {
+			return err
+		}
+		assert.Equal(t, 3, count)
+
+		err := ext.QueryRowxContext(context.Background(), "DELETE FROM orders RETURNING id").Scan(&count)
+		assert.True(t, errors.Is(err, ErrMaintenanceMode))
+
+		_, err = ext.ExecContext(context.Background(), "COPY orders FROM STDIN")
+		return err
+	})
+
+	assert.True(t, errors.Is(err, ErrMaintenanceMode))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Model describes how a struct maps onto a table. Columns come from the same
+// `db` tags sqlx scans with; the primary key is the column tagged with the pk
+// option (`db:"id,pk"`), or "id" when no column is tagged.
+//
+// Foreign keys are declared with the ref option naming the referenced table
+// (`db:"customer_id,ref=customers"`) and columns that must not be NULL with
+// the notnull option; both are used by test tooling to build valid rows. The
+// version option marks the integer column used for optimistic locking
+// (`db:"version,version"`), and the compress option the codec compressed
+// columns are written with (`db:"payload,compress=zstd"`), see
+// CompressedBytes.
+type Model struct {
+	Type    reflect.Type
+	Table   string
+	Key     string
+	Columns []string
+
+	// References maps foreign key columns to the table they reference.
+	References map[string]string
+	// Required lists the columns tagged notnull.
+	Required []string
+	// Version is the column tagged version, holding the integer version of
+	// rows for optimistic locking, see UpdateVersioned.
+	Version string
+
+	// ReadOnly is set for models registered over views with RegisterView.
+	ReadOnly bool
+
+	fields         map[string]*reflectx.FieldInfo
+	codecs         map[string]Codec
+	checksumColumn string
+	checksumKey    []byte
+}
+
+var registry = struct {
+	sync.RWMutex
+	models map[reflect.Type]*Model
+	tables map[string]*Model
+}{models: map[reflect.Type]*Model{}, tables: map[string]*Model{}}
+
+var mapper = reflectx.NewMapperFunc("db", sqlx.NameMapper)
+
+// Register records the table backing model, which may be a struct value or a
+// pointer to one. Registering the same type again replaces its metadata.
+func Register(model interface{}, table string) (*Model, error) {
+	return register(model, table, false)
+}
+
+// RegisterView records the view backing the read-only model. Views need no
+// primary key; when one is tagged, or an id column exists, View.Find can be
+// used. Repositories refuse read-only models.
+func RegisterView(model interface{}, view string) (*Model, error) {
+	return register(model, view, true)
+}
+
+// MustRegisterView is like RegisterView but panics on error.
+func MustRegisterView(model interface{}, view string) *Model {
+	m, err := RegisterView(model, view)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func register(model interface{}, table string, readOnly bool) (*Model, error) {
+	if model == nil {
+		return nil, fmt.Errorf("db: cannot register a nil model")
+	}
+
+	t := reflectx.Deref(reflect.TypeOf(model))
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("db: cannot register %T, expected a struct", model)
+	}
+
+	m := &Model{
+		Type:       t,
+		Table:      table,
+		ReadOnly:   readOnly,
+		References: map[string]string{},
+		fields:     map[string]*reflectx.FieldInfo{},
+	}
+
+	for _, fi := range mapper.TypeMap(t).Index {
+		if fi.Embedded || fi.Name == "" || strings.Contains(fi.Path, ".") {
+			continue
+		}
+
+		m.Columns = append(m.Columns, fi.Path)
+		m.fields[fi.Path] = fi
+
+		if _, ok := fi.Options["pk"]; ok {
+			m.Key = fi.Path
+		}
+		if ref := fi.Options["ref"]; ref != "" {
+			m.References[fi.Path] = ref
+		}
+		if _, ok := fi.Options["notnull"]; ok {
+			m.Required = append(m.Required, fi.Path)
+		}
+		if _, ok := fi.Options["version"]; ok {
+			if !isInteger(fi.Field.Type.Kind()) {
+				return nil, fmt.Errorf("db: version column %s of %s must be an integer", fi.Path, t)
+			}
+			m.Version = fi.Path
+		}
+		if name, ok := fi.Options["compress"]; ok {
+			if err := m.compressWith(fi, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if m.Key == "" {
+		if _, ok := m.fields["id"]; ok {
+			m.Key = "id"
+		} else if !readOnly {
+			return nil, fmt.Errorf("db: %s has no primary key column", t)
+		}
+	}
+
+	registry.Lock()
+	registry.models[t] = m
+	registry.tables[table] = m
+	registry.Unlock()
+
+	return m, nil
+}
+
+var compressedTypes = map[reflect.Type]bool{
+	reflect.TypeOf(CompressedBytes(nil)): true,
+	reflect.TypeOf(CompressedString("")): true,
+}
+
+// compressWith records that the column of fi is written with the codec
+// registered under name.
+func (m *Model) compressWith(fi *reflectx.FieldInfo, name string) error {
+	if !compressedTypes[fi.Field.Type] {
+		return fmt.Errorf("db: compressed column %s of %s must be a CompressedBytes or CompressedString", fi.Path, m.Type)
+	}
+	codec, ok := codecNamed(name)
+	if !ok {
+		return fmt.Errorf("db: column %s of %s is compressed with %q, no such codec is registered", fi.Path, m.Type, name)
+	}
+
+	if m.codecs == nil {
+		m.codecs = map[string]Codec{}
+	}
+	m.codecs[fi.Path] = codec
+	return nil
+}
+
+// fieldByColumn returns the field of v, a struct, that m maps to column, and
+// false when there is none: unlike m.FieldByName, which returns v itself then.
+func fieldByColumn(m *reflectx.Mapper, v reflect.Value, column string) (reflect.Value, bool) {
+	fi, ok := m.TypeMap(v.Type()).Names[column]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	return reflectx.FieldByIndexesReadOnly(v, fi.Index), true
+}
+
+// ReferenceOrder sorts models so that every model follows those among them
+// its foreign keys reference, keeping their order otherwise, e.g. to create
+// or fill their tables. References of a table to itself are ignored; other
+// cycles are an error.
+func ReferenceOrder(models []*Model) ([]*Model, error) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	byTable := make(map[string]*Model, len(models))
+	for _, m := range models {
+		byTable[m.Table] = m
+	}
+	state := map[string]int{}
+	ordered := make([]*Model, 0, len(models))
+
+	var visit func(m *Model) error
+	visit = func(m *Model) error {
+		switch state[m.Table] {
+		case visiting:
+			return fmt.Errorf("db: the references of %s form a cycle", m.Table)
+		case done:
+			return nil
+		}
+		state[m.Table] = visiting
+
+		columns := make([]string, 0, len(m.References))
+		for c := range m.References {
+			columns = append(columns, c)
+		}
+		sort.Strings(columns)
+		for _, c := range columns {
+			if ref := byTable[m.References[c]]; ref != nil && ref != m {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+
+		state[m.Table] = done
+		ordered = append(ordered, m)
+		return nil
+	}
+
+	for _, m := range models {
+		if err := visit(m); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// MustRegister is like Register but panics on error, for package-level setup.
+func MustRegister(model interface{}, table string) *Model {
+	m, err := Register(model, table)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// ModelOf returns the metadata registered for model's type.
+func ModelOf(model interface{}) (*Model, error) {
+	return modelOfType(reflect.TypeOf(model))
+}
+
+func modelOfType(t reflect.Type) (*Model, error) {
+	if t == nil {
+		return nil, fmt.Errorf("db: cannot resolve the model of nil")
+	}
+	t = reflectx.Deref(t)
+
+	registry.RLock()
+	m, ok := registry.models[t]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("db: %s is not registered", t)
+	}
+
+	return m, nil
+}
+
+// ModelForTable returns the metadata of the model last registered for table.
+func ModelForTable(table string) (*Model, error) {
+	registry.RLock()
+	m, ok := registry.tables[table]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("db: no model registered for table %s", table)
+	}
+
+	return m, nil
+}
+
+// KeyOf returns the primary key value of entity.
+func (m *Model) KeyOf(entity interface{}) interface{} {
+	return m.ValueOf(entity, m.Key)
+}
+
+// ValueOf returns the value mapped to column on entity, or nil when the column
+// is not part of the model.
+func (m *Model) ValueOf(entity interface{}, column string) interface{} {
+	fi, ok := m.fields[column]
+	if !ok {
+		return nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(entity))
+	return reflectx.FieldByIndexesReadOnly(v, fi.Index).Interface()
+}
+
+// Field returns the settable field mapped to column on entity, which must be
+// a pointer. The returned value is invalid when the column is not part of the
+// model.
+func (m *Model) Field(entity interface{}, column string) reflect.Value {
+	fi, ok := m.fields[column]
+	if !ok {
+		return reflect.Value{}
+	}
+
+	return reflectx.FieldByIndexes(reflect.ValueOf(entity).Elem(), fi.Index)
+}
+
+// NonKeyColumns returns every mapped column except the primary key.
+func (m *Model) NonKeyColumns() []string {
+	columns := make([]string, 0, len(m.Columns))
+	for _, c := range m.Columns {
+		if c != m.Key {
+			columns = append(columns, c)
+		}
+	}
+	return columns
+}
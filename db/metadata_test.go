@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metadataCustomer struct {
+	Code  string `db:"code,pk"`
+	Name  string `db:"name"`
+	Email string `db:"email"`
+	Skip  string `db:"-"`
+}
+
+type metadataNoKey struct {
+	Name string `db:"name"`
+}
+
+func TestShouldRegisterModelWithTaggedKey(t *testing.T) {
+	model, err := Register(metadataCustomer{}, "customers")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "customers", model.Table)
+	assert.Equal(t, "code", model.Key)
+	assert.Equal(t, []string{"code", "name", "email"}, model.Columns)
+	assert.Equal(t, []string{"name", "email"}, model.NonKeyColumns())
+}
+
+func TestShouldResolveRegisteredModelFromPointer(t *testing.T) {
+	MustRegister(&metadataCustomer{}, "customers")
+
+	model, err := ModelOf(&metadataCustomer{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "ana", model.ValueOf(metadataCustomer{Name: "ana"}, "name"))
+	assert.Equal(t, "c1", model.KeyOf(&metadataCustomer{Code: "c1"}))
+	assert.Nil(t, model.ValueOf(metadataCustomer{}, "missing"))
+}
+
+func TestShouldRejectModelWithoutKey(t *testing.T) {
+	_, err := Register(metadataNoKey{}, "things")
+	assert.NotNil(t, err)
+
+	_, err = Register(42, "things")
+	assert.NotNil(t, err)
+
+	_, err = ModelOf(metadataNoKey{})
+	assert.NotNil(t, err)
+}
+
+type metadataOrder struct {
+	ID         int64  `db:"id"`
+	CustomerID string `db:"customer_code,ref=customers"`
+	Status     string `db:"status,notnull"`
+}
+
+func TestShouldRecordReferencesAndRequiredColumns(t *testing.T) {
+	MustRegister(metadataOrder{}, "metadata_orders")
+
+	model, err := ModelForTable("metadata_orders")
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"customer_code": "customers"}, model.References)
+	assert.Equal(t, []string{"status"}, model.Required)
+
+	order := &metadataOrder{}
+	model.Field(order, "status").SetString("open")
+	assert.Equal(t, "open", order.Status)
+	assert.False(t, model.Field(order, "missing").IsValid())
+
+	_, err = ModelForTable("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestShouldOrderModelsByReference(t *testing.T) {
+	customers := &Model{Table: "customers", References: map[string]string{"referrer_id": "customers"}}
+	orders := &Model{Table: "orders", References: map[string]string{"customer_id": "customers", "currency_id": "currencies"}}
+	items := &Model{Table: "items", References: map[string]string{"order_id": "orders"}}
+	notes := &Model{Table: "notes"}
+
+	ordered, err := ReferenceOrder([]*Model{items, notes, orders, customers})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []*Model{customers, orders, items, notes}, ordered)
+
+	accounts := &Model{Table: "accounts", References: map[string]string{"owner_id": "owners"}}
+	owners := &Model{Table: "owners", References: map[string]string{"account_id": "accounts"}}
+	_, err = ReferenceOrder([]*Model{accounts, owners})
+	assert.EqualError(t, err, "db: the references of accounts form a cycle")
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TenantUsage is the database load of a tenant: its statements, the rows
+// they read and wrote, and the time they took.
+type TenantUsage struct {
+	Tenant      string
+	Queries     int64
+	RowsRead    int64
+	RowsWritten int64
+	Time        time.Duration
+
+	// Period is the start of the metering period the usage was recorded in,
+	// zero for totals.
+	Period time.Time
+}
+
+func (u *TenantUsage) add(other TenantUsage) {
+	u.Queries += other.Queries
+	u.RowsRead += other.RowsRead
+	u.RowsWritten += other.RowsWritten
+	u.Time += other.Time
+}
+
+// MeterConfig configures a Meter. Table defaults to tenant_usage:
+//
+//	CREATE TABLE tenant_usage (
+//		tenant       varchar(128) NOT NULL,
+//		period_start timestamp NOT NULL,
+//		queries      bigint NOT NULL,
+//		rows_read    bigint NOT NULL,
+//		rows_written bigint NOT NULL,
+//		db_time_us   bigint NOT NULL,
+//		PRIMARY KEY (tenant, period_start)
+//	);
+type MeterConfig struct {
+	Table string
+
+	// Period is the granularity of the usage table. Zero means one hour.
+	Period time.Duration
+
+	// Interval between flushes of Run. Zero means one minute.
+	Interval time.Duration
+}
+
+type usageKey struct {
+	tenant string
+	period time.Time
+}
+
+// Meter measures the database load of every tenant, as set by WithTenant:
+// statements, rows read and written and time, counted by its Interceptor
+// the way Stats counts them, except that queries are metered once their rows
+// are closed, with the rows read and the time spent until then. Totals since
+// the meter was created serve metrics; usage per period is flushed to a
+// table for billing. Statements without a tenant are not metered.
+type Meter struct {
+	db     *sqlx.DB
+	config MeterConfig
+	now    func() time.Time
+
+	mu      sync.Mutex
+	totals  map[string]*TenantUsage
+	pending map[usageKey]*TenantUsage
+}
+
+// NewMeter creates a meter flushing usage to db.
+func NewMeter(db *sqlx.DB, config MeterConfig) *Meter {
+	if config.Table == "" {
+		config.Table = "tenant_usage"
+	}
+	if config.Period <= 0 {
+		config.Period = time.Hour
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+
+	return &Meter{
+		db:      db,
+		config:  config,
+		now:     time.Now,
+		totals:  map[string]*TenantUsage{},
+		pending: map[usageKey]*TenantUsage{},
+	}
+}
+
+// Interceptor meters the statements of the unit of works it is installed on.
+func (m *Meter) Interceptor() Interceptor {
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		tenant, ok := TenantFrom(ctx)
+		if !ok {
+			return next(ctx, stmt)
+		}
+
+		start := time.Now()
+		err := next(ctx, stmt)
+		usage := TenantUsage{Tenant: fmt.Sprint(tenant), Queries: 1, Time: time.Since(start)}
+		if err == nil && stmt.Kind == KindQuery {
+			// rows are read after the query returns: count them as they
+			// are and record the usage once they are closed
+			stmt.Rows, err = wrapRows(ctx, stmt.Rows, rowHooks{close: func(read int64) {
+				usage.RowsRead, usage.Time = read, time.Since(start)
+				m.record(usage)
+			}})
+			return err
+		}
+		if err == nil {
+			usage.RowsRead, usage.RowsWritten = rowsOf(stmt)
+		}
+		m.record(usage)
+		return err
+	}
+}
+
+func (m *Meter) record(usage TenantUsage) {
+	key := usageKey{tenant: usage.Tenant, period: m.now().UTC().Truncate(m.config.Period)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total, ok := m.totals[usage.Tenant]
+	if !ok {
+		total = &TenantUsage{Tenant: usage.Tenant}
+		m.totals[usage.Tenant] = total
+	}
+	total.add(usage)
+
+	pending, ok := m.pending[key]
+	if !ok {
+		pending = &TenantUsage{Tenant: usage.Tenant, Period: key.period}
+		m.pending[key] = pending
+	}
+	pending.add(usage)
+}
+
+// Totals returns the usage of every tenant since the meter was created,
+// sorted by tenant.
+func (m *Meter) Totals() []TenantUsage {
+	m.mu.Lock()
+	totals := make([]TenantUsage, 0, len(m.totals))
+	for _, total := range m.totals {
+		totals = append(totals, *total)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Tenant < totals[j].Tenant })
+	return totals
+}
+
+// Run flushes usage every interval until ctx is done, then a last time.
+// Failed flushes are retried on the next tick.
+func (m *Meter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := m.Flush(context.Background()); err != nil {
+				Logger().Error("db: tenant usage flush failed", "err", err)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		if err := m.Flush(ctx); err != nil {
+			Logger().Error("db: tenant usage flush failed", "err", err)
+		}
+	}
+}
+
+// Flush adds the usage recorded since the last flush to the usage table, in
+// one transaction. Usage that could not be written is kept for the next
+// flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = map[usageKey]*TenantUsage{}
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := m.write(ctx, pending)
+	if err != nil {
+		m.mu.Lock()
+		for key, usage := range pending {
+			if current, ok := m.pending[key]; ok {
+				usage.add(*current)
+			}
+			m.pending[key] = usage
+		}
+		m.mu.Unlock()
+	}
+	return err
+}
+
+func (m *Meter) write(ctx context.Context, pending map[usageKey]*TenantUsage) error {
+	query := m.db.Rebind(m.upsert())
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, usage := range pending {
+		if _, err := tx.ExecContext(ctx, query, usage.Tenant, usage.Period, usage.Queries,
+			usage.RowsRead, usage.RowsWritten, usage.Time.Microseconds()); err != nil {
+			return fmt.Errorf("db: flushing usage of tenant %s: %w", usage.Tenant, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *Meter) upsert() string {
+	insert := fmt.Sprintf("INSERT INTO %s (tenant, period_start, queries, rows_read, rows_written, db_time_us) VALUES (?, ?, ?, ?, ?, ?)", m.config.Table)
+	columns := []string{"queries", "rows_read", "rows_written", "db_time_us"}
+
+	var update string
+	for i, c := range columns {
+		if i > 0 {
+			update += ", "
+		}
+		if DialectFor(m.db.DriverName()) == DialectMySQL {
+			update += fmt.Sprintf("%s = %s + VALUES(%s)", c, c, c)
+		} else {
+			update += fmt.Sprintf("%s = %s.%s + excluded.%s", c, m.config.Table, c, c)
+		}
+	}
+
+	if DialectFor(m.db.DriverName()) == DialectMySQL {
+		return insert + " ON DUPLICATE KEY UPDATE " + update
+	}
+	return insert + " ON CONFLICT (tenant, period_start) DO UPDATE SET " + update
+}
+
+// Usage sums up, per tenant, the usage flushed for the periods starting in
+// [from, to), sorted by tenant.
+func (m *Meter) Usage(ctx context.Context, from, to time.Time) ([]TenantUsage, error) {
+	var rows []struct {
+		Tenant      string `db:"tenant"`
+		Queries     int64  `db:"queries"`
+		RowsRead    int64  `db:"rows_read"`
+		RowsWritten int64  `db:"rows_written"`
+		Micros      int64  `db:"db_time_us"`
+	}
+	query := fmt.Sprintf("SELECT tenant, SUM(queries) AS queries, SUM(rows_read) AS rows_read, "+
+		"SUM(rows_written) AS rows_written, SUM(db_time_us) AS db_time_us FROM %s "+
+		"WHERE period_start >= ? AND period_start < ? GROUP BY tenant ORDER BY tenant", m.config.Table)
+	if err := m.db.SelectContext(ctx, &rows, m.db.Rebind(query), from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+
+	usage := make([]TenantUsage, len(rows))
+	for i, row := range rows {
+		usage[i] = TenantUsage{Tenant: row.Tenant, Queries: row.Queries, RowsRead: row.RowsRead,
+			RowsWritten: row.RowsWritten, Time: time.Duration(row.Micros) * time.Microsecond}
+	}
+	return usage, nil
+}
@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldMeterStatementsPerTenantAndFlushThem(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	period := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("^SELECT id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("^SELECT id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO tenant_usage \(tenant, period_start, queries, rows_read, rows_written, db_time_us\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) `+
+		`ON CONFLICT \(tenant, period_start\) DO UPDATE SET queries = tenant_usage.queries \+ excluded.queries, .*db_time_us = tenant_usage.db_time_us \+ excluded.db_time_us$`).
+		WithArgs("acme", period, int64(2), int64(2), int64(3), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	meter := NewMeter(database, MeterConfig{})
+	meter.now = func() time.Time { return period.Add(25 * time.Minute) }
+
+	acme := NewUnitOfWork(database, nil, WithContext(WithTenant(context.Background(), "acme")), WithInterceptors(meter.Interceptor()))
+	acme.MustExec("UPDATE orders SET status = 'paid'")
+	var ids []int64
+	assert.Nil(t, acme.Select(&ids, "SELECT id FROM orders"))
+	untenanted := NewUnitOfWork(database, nil, WithInterceptors(meter.Interceptor()))
+	assert.Nil(t, untenanted.Select(&ids, "SELECT id FROM orders"))
+
+	totals := meter.Totals()
+	if assert.Len(t, totals, 1) {
+		assert.Equal(t, "acme", totals[0].Tenant)
+		assert.Equal(t, int64(2), totals[0].Queries)
+		assert.Equal(t, int64(2), totals[0].RowsRead)
+		assert.Equal(t, int64(3), totals[0].RowsWritten)
+	}
+
+	assert.Nil(t, meter.Flush(context.Background()))
+	assert.Nil(t, meter.Flush(context.Background()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldKeepUsageWhenFlushFails(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	mock.ExpectBegin()
+	mock.ExpectExec("ON DUPLICATE KEY UPDATE queries = queries \\+ VALUES\\(queries\\)").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("ON DUPLICATE KEY UPDATE").WithArgs("acme", sqlmock.AnyArg(), int64(2), int64(0), int64(0), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	meter := NewMeter(database, MeterConfig{})
+	meter.record(TenantUsage{Tenant: "acme", Queries: 1})
+
+	assert.EqualError(t, meter.Flush(context.Background()), "db: flushing usage of tenant acme: connection reset")
+	meter.record(TenantUsage{Tenant: "acme", Queries: 1})
+	assert.Nil(t, meter.Flush(context.Background()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSumFlushedUsagePerTenant(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`^SELECT tenant, SUM\(queries\) .* FROM tenant_usage WHERE period_start >= \$1 AND period_start < \$2 GROUP BY tenant ORDER BY tenant$`).
+		WithArgs(from, from.AddDate(0, 1, 0)).
+		WillReturnRows(sqlmock.NewRows([]string{"tenant", "queries", "rows_read", "rows_written", "db_time_us"}).
+			AddRow("acme", 120, 3000, 40, 2500000))
+
+	usage, err := NewMeter(database, MeterConfig{}).Usage(context.Background(), from, from.AddDate(0, 1, 0))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []TenantUsage{{Tenant: "acme", Queries: 120, RowsRead: 3000, RowsWritten: 40, Time: 2500 * time.Millisecond}}, usage)
+}
+
+func TestShouldMeterRowsReadThroughQueriesOnceClosed(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("^SELECT id FROM orders").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+
+	meter := NewMeter(database, MeterConfig{})
+	uow := NewUnitOfWork(database, nil, WithContext(WithTenant(context.Background(), "acme")), WithInterceptors(meter.Interceptor()))
+
+	rows, err := uow.Query("SELECT id FROM orders")
+	assert.Nil(t, err)
+	assert.Empty(t, meter.Totals())
+
+	for rows.Next() {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Nil(t, rows.Close())
+	assert.Nil(t, rows.Close())
+
+	totals := meter.Totals()
+	if assert.Len(t, totals, 1) {
+		assert.Equal(t, int64(1), totals[0].Queries)
+		assert.Equal(t, int64(3), totals[0].RowsRead)
+		assert.GreaterOrEqual(t, totals[0].Time, 15*time.Millisecond)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
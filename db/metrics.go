@@ -0,0 +1,37 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsCollector receives measurements of unit of works, see WithMetrics.
+// Implementations must be safe for concurrent use; package dbprom provides a
+// Prometheus one.
+type MetricsCollector interface {
+	// ObserveStatement is called once a statement ran.
+	ObserveStatement(stmt *Statement, duration time.Duration, err error)
+
+	// ObserveTransaction is called once a transaction ended, committed or
+	// not; err is the error of the commit or rollback.
+	ObserveTransaction(committed bool, err error)
+
+	// ObserveRetry is called before a transaction is retried after err, see
+	// WithRetryPolicy.
+	ObserveRetry(err error)
+}
+
+// WithMetrics reports the statements, transactions and retries of the unit
+// of work to c. Statements are measured by an interceptor placed after those
+// already installed.
+func WithMetrics(c MetricsCollector) Option {
+	return func(u *unitOfWork) {
+		u.metrics = c
+		u.interceptors = append(u.interceptors, func(ctx context.Context, stmt *Statement, next Handler) error {
+			start := time.Now()
+			err := next(ctx, stmt)
+			c.ObserveStatement(stmt, time.Since(start), err)
+			return err
+		})
+	}
+}
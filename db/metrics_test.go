@@ -0,0 +1,54 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingCollector struct {
+	events []string
+}
+
+func (c *recordingCollector) ObserveStatement(stmt *Statement, duration time.Duration, err error) {
+	c.events = append(c.events, "statement "+stmt.Query)
+}
+
+func (c *recordingCollector) ObserveTransaction(committed bool, err error) {
+	if committed {
+		c.events = append(c.events, "commit")
+	} else {
+		c.events = append(c.events, "rollback")
+	}
+}
+
+func (c *recordingCollector) ObserveRetry(err error) {
+	c.events = append(c.events, "retry")
+}
+
+func TestShouldReportStatementsAndTransactionsToMetricsCollector(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^DELETE FROM orders$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	collector := &recordingCollector{}
+	database, _ := DatabaseOf(uow)
+	uow = NewUnitOfWork(database, nil, WithMetrics(collector))
+
+	uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("DELETE FROM orders")
+		return nil, nil
+	})
+	uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, errors.New("cancelled")
+	})
+
+	assert.Equal(t, []string{"statement DELETE FROM orders", "commit", "rollback"}, collector.events)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
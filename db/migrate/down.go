@@ -0,0 +1,276 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+)
+
+// ErrDestructive is returned by Down for migrations whose down steps destroy
+// data, unless DownOptions.AllowDestructive is set.
+var ErrDestructive = errors.New("migrate: destructive down migration")
+
+// DownOptions guards Down.
+type DownOptions struct {
+	// AllowDestructive lets down steps drop or truncate tables, drop columns
+	// and delete or update rows. Without it Down refuses to start when any of the
+	// migrations to revert would.
+	AllowDestructive bool
+
+	// Snapshot, when set, receives a Dump of the tables a destructive
+	// migration affects, taken just before that migration is reverted. The
+	// script restores with db.Restore once the tables are back.
+	Snapshot io.Writer
+
+	// Dump tunes the snapshots; its Tables are ignored.
+	Dump db.DumpOptions
+}
+
+// destroyer is implemented by steps that can tell which tables they destroy
+// data of. Other steps are assumed to destroy data of tables they do not
+// name.
+type destroyer interface {
+	// destroys returns the tables the step destroys data of, and the
+	// statements destroying data, or possibly doing so, of tables that
+	// cannot be told from their text.
+	destroys(driver string) (tables, unnamed []string)
+}
+
+// Down reverts applied migrations newer than version, newest first, each with
+// its down steps the way Up applies up steps. Every migration to revert must
+// be known and have down steps; destructive ones are refused unless allowed.
+func (m *Migrator) Down(ctx context.Context, version int64, opts DownOptions) error {
+	revert, _, err := m.reverting(ctx, version, opts)
+	if err != nil {
+		return err
+	}
+
+	driver := m.db.DriverName()
+	for _, migration := range revert {
+		tables, unnamed := destroyed(driver, migration.Down)
+		if len(unnamed) > 0 && opts.Snapshot != nil {
+			return fmt.Errorf("migrate: cannot snapshot before reverting %d %s, %s destroys data of tables it does not name",
+				migration.Version, migration.Name, unnamed[0])
+		}
+		if len(tables) > 0 && opts.Snapshot != nil {
+			dump := opts.Dump
+			dump.Tables = tables
+			fmt.Fprintf(opts.Snapshot, "-- before reverting %d %s\n", migration.Version, migration.Name)
+			if err := db.Dump(ctx, m.db, opts.Snapshot, dump); err != nil {
+				return fmt.Errorf("migrate: snapshot before reverting %d %s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		for _, s := range m.segments(migration.Down, m.unrecord(migration)) {
+			if err := s.run(ctx, m.db); err != nil {
+				return fmt.Errorf("migrate: reverting %d %s: %w", migration.Version, migration.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// reverting returns the migrations Down reverts to version, newest first,
+// and the current version.
+func (m *Migrator) reverting(ctx context.Context, version int64, opts DownOptions) ([]Migration, int64, error) {
+	applied, _, err := m.applied(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := m.verify(applied); err != nil {
+		return nil, 0, err
+	}
+
+	known := map[int64]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	var revert []Migration
+	for v := range applied {
+		if v <= version {
+			continue
+		}
+		migration, ok := known[v]
+		if !ok {
+			return nil, 0, fmt.Errorf("migrate: applied migration %d %s is unknown", v, applied[v].Name)
+		}
+		if len(migration.Down) == 0 {
+			return nil, 0, fmt.Errorf("migrate: migration %d %s cannot be reverted", v, migration.Name)
+		}
+		revert = append(revert, migration)
+	}
+	sort.Slice(revert, func(i, j int) bool { return revert[i].Version > revert[j].Version })
+
+	driver := m.db.DriverName()
+	if !opts.AllowDestructive {
+		var destructive []string
+		for _, migration := range revert {
+			if tables, unnamed := destroyed(driver, migration.Down); len(tables)+len(unnamed) > 0 {
+				destructive = append(destructive, fmt.Sprintf("%d %s (%s)", migration.Version, migration.Name, strings.Join(append(tables, unnamed...), ", ")))
+			}
+		}
+		if len(destructive) > 0 {
+			return nil, 0, fmt.Errorf("%w: %s", ErrDestructive, strings.Join(destructive, ", "))
+		}
+	}
+	return revert, highest(applied), nil
+}
+
+// PlanDown writes the SQL Down would run to revert to version, transaction
+// boundaries included, without changing anything. It refuses what Down
+// refuses, and names the tables a destructive migration destroys data of.
+func (m *Migrator) PlanDown(ctx context.Context, version int64, opts DownOptions, w io.Writer) error {
+	revert, current, err := m.reverting(ctx, version, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "-- %s at version %d, %d migration(s) to revert to version %d\n", m.config.Table, current, len(revert), version)
+
+	driver := m.db.DriverName()
+	for _, migration := range revert {
+		fmt.Fprintf(w, "\n-- %d %s\n", migration.Version, migration.Name)
+		if tables, unnamed := destroyed(driver, migration.Down); len(tables)+len(unnamed) > 0 {
+			fmt.Fprintf(w, "-- destroys data of %s\n", strings.Join(append(tables, unnamed...), ", "))
+		}
+		for _, s := range m.segments(migration.Down, m.unrecord(migration)) {
+			s.describe(w)
+		}
+	}
+	return nil
+}
+
+// unrecord returns the statement forgetting migration was applied.
+func (m *Migrator) unrecord(migration Migration) statement {
+	return statement{
+		query: m.db.Rebind(fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.config.Table)),
+		args:  []interface{}{migration.Version},
+	}
+}
+
+// destroyed lists the tables steps destroy data of, each once, and the
+// statements destroying data of tables they do not name.
+func destroyed(driver string, steps []Step) (tables, unnamed []string) {
+	for _, step := range steps {
+		d, ok := step.(destroyer)
+		if !ok {
+			unnamed = append(unnamed, summarize(step.Describe()))
+			continue
+		}
+		named, others := d.destroys(driver)
+		for _, table := range named {
+			if indexOf(tables, table) < 0 {
+				tables = append(tables, table)
+			}
+		}
+		unnamed = append(unnamed, others...)
+	}
+	return tables, unnamed
+}
+
+// destroys checks every statement of the step, split with the lexer of the
+// dialect so that comments and statements sharing a string are seen, and
+// fails closed: statements it cannot classify count as destructive.
+func (s sqlStep) destroys(driver string) (tables, unnamed []string) {
+	for _, text := range s {
+		for _, statement := range db.SplitStatements(db.DialectFor(driver), text) {
+			info := db.Inspect(driver, statement)
+			if !destructive(info, statement) {
+				continue
+			}
+			if len(info.Tables) == 0 || !(harmlessVerbs[info.Verb] || destroyingVerbs[info.Verb]) {
+				unnamed = append(unnamed, summarize(statement))
+				continue
+			}
+			tables = append(tables, info.Tables...)
+		}
+	}
+	return tables, unnamed
+}
+
+// destroys is empty: an index holds no data of its own.
+func (c *concurrentIndex) destroys(driver string) (tables, unnamed []string) {
+	return nil, nil
+}
+
+func (o *onlineAlter) destroys(driver string) (tables, unnamed []string) {
+	if dropsColumn("ALTER TABLE " + o.table + " " + o.alter) {
+		return []string{o.table}, nil
+	}
+	return nil, nil
+}
+
+// datalessObjects are the objects holding no data of their own, which DROP
+// may remove without destroying any.
+var datalessObjects = map[string]bool{
+	"INDEX": true, "VIEW": true, "MATERIALIZED VIEW": true, "TRIGGER": true, "FUNCTION": true,
+	"PROCEDURE": true, "ROUTINE": true, "AGGREGATE": true, "RULE": true, "POLICY": true,
+	"TYPE": true, "DOMAIN": true, "CAST": true, "OPERATOR": true, "COLLATION": true,
+	"STATISTICS": true, "EVENT TRIGGER": true,
+}
+
+// harmlessVerbs are the verbs of statements destroying no data, unless they
+// are an ALTER dropping a column or delete or update rows in a CTE.
+var harmlessVerbs = map[string]bool{
+	"CREATE": true, "ALTER": true, "INSERT": true, "SELECT": true, "WITH": true,
+	"VALUES": true, "SET": true, "RESET": true, "COMMENT": true, "GRANT": true, "REVOKE": true,
+	"RENAME": true, "ANALYZE": true, "REFRESH": true, "LOCK": true,
+}
+
+// destroyingVerbs are the verbs of statements destroying data of the tables
+// Inspect finds in them. UPDATE counts, since the values it overwrites are
+// lost.
+var destroyingVerbs = map[string]bool{"DROP": true, "TRUNCATE": true, "DELETE": true, "UPDATE": true, "REPLACE": true}
+
+// destructive reports whether statement destroys data: DROP of anything but
+// the dataless objects, TRUNCATE, DELETE, UPDATE or upserts anywhere in
+// the statement, REPLACE, ALTER dropping a column, and every verb not known to
+// be harmless.
+func destructive(info db.StatementInfo, statement string) bool {
+	switch {
+	case info.Verb == "DROP":
+		return !datalessObjects[info.Object]
+	case info.Modifies("DELETE"), info.Modifies("UPDATE"), info.Modifies("UPSERT"), info.Modifies("TRUNCATE"), info.Modifies("REPLACE"):
+		return true
+	case info.Verb == "ALTER":
+		return dropsColumn(statement)
+	}
+	return !harmlessVerbs[info.Verb]
+}
+
+// summarize returns the first line of statement, shortened, to name it in
+// errors.
+func summarize(statement string) string {
+	if i := strings.IndexByte(statement, '\n'); i >= 0 {
+		statement = statement[:i] + " ..."
+	}
+	if len(statement) > 60 {
+		statement = statement[:57] + "..."
+	}
+	return strings.TrimSpace(statement)
+}
+
+// dropsColumn reports whether an ALTER TABLE statement drops a column, as
+// opposed to a constraint, index or default.
+func dropsColumn(statement string) bool {
+	words := strings.FieldsFunc(strings.ToUpper(statement), func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == ','
+	})
+	for i := 0; i+1 < len(words); i++ {
+		if words[i] != "DROP" {
+			continue
+		}
+		switch words[i+1] {
+		case "CONSTRAINT", "INDEX", "KEY", "PRIMARY", "FOREIGN", "CHECK", "DEFAULT", "NOT", "IDENTITY", "EXPRESSION", "PARTITION", "TRIGGER":
+			continue
+		}
+		return true
+	}
+	return false
+}
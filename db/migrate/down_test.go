@@ -0,0 +1,201 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func downMigrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_orders",
+			Up:   []Step{SQL("CREATE TABLE orders (id bigint PRIMARY KEY)")},
+			Down: []Step{SQL("DROP TABLE orders")}},
+		{Version: 2, Name: "add_note",
+			Up:   []Step{SQL("ALTER TABLE orders ADD COLUMN note text", "CREATE INDEX orders_note_idx ON orders (note)")},
+			Down: []Step{SQL("DROP INDEX orders_note_idx", "ALTER TABLE orders DROP COLUMN note")}},
+		{Version: 3, Name: "add_status_default",
+			Up:   []Step{SQL("ALTER TABLE orders ALTER COLUMN status SET DEFAULT 'new'")},
+			Down: []Step{SQL("ALTER TABLE orders ALTER COLUMN status DROP DEFAULT")}},
+	}
+}
+
+func expectAppliedVersions(mock sqlmock.Sqlmock, migrations ...Migration) {
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum"})
+	for _, m := range migrations {
+		rows.AddRow(m.Version, m.Name, m.Checksum())
+	}
+	expectApplied(mock, rows)
+}
+
+func TestShouldDetectDestructiveSteps(t *testing.T) {
+	for _, tc := range []struct {
+		step   Step
+		tables []string
+	}{
+		{SQL("DROP TABLE IF EXISTS orders"), []string{"orders"}},
+		{SQL("TRUNCATE orders"), []string{"orders"}},
+		{SQL("DELETE FROM orders WHERE status = 'draft'"), []string{"orders"}},
+		{SQL("UPDATE orders SET amount = NULL"), []string{"orders"}},
+		{SQL("INSERT INTO totals (day) VALUES (now()) ON CONFLICT (day) DO UPDATE SET total = 0"), []string{"totals"}},
+		{SQL("ALTER TABLE orders DROP COLUMN note"), []string{"orders"}},
+		{SQL("ALTER TABLE orders ADD COLUMN a int, DROP b"), []string{"orders"}},
+		{SQL("ALTER TABLE orders DROP CONSTRAINT orders_fk, DROP DEFAULT"), nil},
+		{SQL("DROP INDEX orders_note_idx"), nil},
+		{SQL("CREATE TABLE orders (id int)"), nil},
+		{OnlineAlter("orders", "DROP COLUMN legacy", OnlineAlterOptions{}), []string{"orders"}},
+		{CreateIndexConcurrently(Index{Name: "i", Table: "orders", Columns: []string{"a"}}, IndexOptions{}), nil},
+	} {
+		tables, unnamed := destroyed("postgres", []Step{tc.step})
+		assert.Equal(t, tc.tables, tables, tc.step.Describe())
+		assert.Empty(t, unnamed, tc.step.Describe())
+	}
+}
+
+// rebuildStep is a step of a type down checks know nothing about.
+type rebuildStep struct{}
+
+func (rebuildStep) Describe() string { return "rebuild the search index" }
+
+func (rebuildStep) Transactional() bool { return false }
+
+func (rebuildStep) Run(ctx context.Context, ext sqlx.ExtContext) error { return nil }
+
+func TestShouldCheckEveryStatementOfDownStepsAndFailClosed(t *testing.T) {
+	for _, tc := range []struct {
+		step    Step
+		tables  []string
+		unnamed []string
+	}{
+		{SQL("-- drop the orders table\nDROP TABLE orders"), []string{"orders"}, nil},
+		{SQL("/* rollback */ DROP TABLE orders"), []string{"orders"}, nil},
+		{SQL("DROP INDEX orders_note_idx; DROP TABLE orders"), []string{"orders"}, nil},
+		{SQL("DROP VIEW order_totals; DROP MATERIALIZED VIEW daily_totals"), nil, nil},
+		{SQL("DROP SCHEMA audit CASCADE"), nil, []string{"DROP SCHEMA audit CASCADE"}},
+		{SQL("DROP SEQUENCE orders_id_seq"), nil, []string{"DROP SEQUENCE orders_id_seq"}},
+		{SQL("CALL purge_orders()"), nil, []string{"CALL purge_orders()"}},
+		{SQL("DO $$ BEGIN EXECUTE 'DROP TABLE orders'; END $$"), nil, []string{"DO $$ BEGIN EXECUTE 'DROP TABLE orders'; END $$"}},
+		{Script("-- 0002 down\nDROP INDEX orders_note_idx;\nDROP TABLE orders;\n"), []string{"orders"}, nil},
+		{rebuildStep{}, nil, []string{"rebuild the search index"}},
+	} {
+		tables, unnamed := destroyed("postgres", []Step{tc.step})
+		assert.Equal(t, tc.tables, tables, tc.step.Describe())
+		assert.Equal(t, tc.unnamed, unnamed, tc.step.Describe())
+	}
+}
+
+func TestShouldRefuseToSnapshotTablesItCannotName(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	migration := Migration{Version: 1, Name: "create_audit",
+		Up:   []Step{SQL("CREATE SCHEMA audit")},
+		Down: []Step{SQL("DROP SCHEMA audit CASCADE")}}
+	expectAppliedVersions(mock, migration)
+
+	migrator, _ := New(database, Config{}, migration)
+
+	err := migrator.Down(context.Background(), 0, DownOptions{})
+	assert.True(t, errors.Is(err, ErrDestructive))
+	assert.Contains(t, err.Error(), "1 create_audit (DROP SCHEMA audit CASCADE)")
+
+	expectAppliedVersions(mock, migration)
+	var snapshot bytes.Buffer
+	err = migrator.Down(context.Background(), 0, DownOptions{AllowDestructive: true, Snapshot: &snapshot})
+	assert.EqualError(t, err, "migrate: cannot snapshot before reverting 1 create_audit, DROP SCHEMA audit CASCADE destroys data of tables it does not name")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseDestructiveDownWithoutPermission(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectAppliedVersions(mock, downMigrations()...)
+
+	migrator, _ := New(database, Config{}, downMigrations()...)
+
+	err := migrator.Down(context.Background(), 0, DownOptions{})
+
+	assert.True(t, errors.Is(err, ErrDestructive))
+	assert.Contains(t, err.Error(), "2 add_note (orders), 1 create_orders (orders)")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRevertNonDestructiveMigrationsNewestFirst(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectAppliedVersions(mock, downMigrations()...)
+	mock.ExpectBegin()
+	mock.ExpectExec("ALTER TABLE orders ALTER COLUMN status DROP DEFAULT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations WHERE version = \\$1").WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migrator, _ := New(database, Config{}, downMigrations()...)
+
+	assert.Nil(t, migrator.Down(context.Background(), 2, DownOptions{}))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSnapshotTablesBeforeAllowedDestructiveDown(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectAppliedVersions(mock, downMigrations()[:2]...)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "orders"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "note"}).AddRow(1, "rush"))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DROP INDEX orders_note_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE orders DROP COLUMN note").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations").WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migrator, _ := New(database, Config{}, downMigrations()...)
+
+	var snapshot bytes.Buffer
+	err := migrator.Down(context.Background(), 1, DownOptions{AllowDestructive: true, Snapshot: &snapshot})
+
+	assert.Nil(t, err)
+	assert.Contains(t, snapshot.String(), "-- before reverting 2 add_note\n")
+	assert.Contains(t, snapshot.String(), `INSERT INTO "orders" ("id", "note") VALUES`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseToRevertIrreversibleMigration(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	irreversible := Migration{Version: 1, Name: "seed", Up: []Step{SQL("INSERT INTO plans VALUES (1)")}}
+	expectAppliedVersions(mock, irreversible)
+
+	migrator, _ := New(database, Config{}, irreversible)
+
+	err := migrator.Down(context.Background(), 0, DownOptions{})
+
+	assert.EqualError(t, err, "migrate: migration 1 seed cannot be reverted")
+}
+
+func TestShouldPlanDownWithoutExecuting(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectAppliedVersions(mock, downMigrations()...)
+
+	migrator, _ := New(database, Config{}, downMigrations()...)
+
+	var plan bytes.Buffer
+	assert.Nil(t, migrator.PlanDown(context.Background(), 1, DownOptions{AllowDestructive: true}, &plan))
+
+	assert.Equal(t, `-- schema_migrations at version 3, 2 migration(s) to revert to version 1
+
+-- 3 add_status_default
+BEGIN;
+ALTER TABLE orders ALTER COLUMN status DROP DEFAULT;
+DELETE FROM schema_migrations WHERE version = $1; -- args: 3
+COMMIT;
+
+-- 2 add_note
+-- destroys data of orders
+BEGIN;
+DROP INDEX orders_note_idx;
+ALTER TABLE orders DROP COLUMN note;
+DELETE FROM schema_migrations WHERE version = $1; -- args: 2
+COMMIT;
+`, plan.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// Script returns a step running the statements of script, a migration file,
+// split on their semicolons the way the dialect of the database reads them.
+func Script(script string) Step {
+	return scriptStep(script)
+}
+
+type scriptStep string
+
+func (s scriptStep) Describe() string {
+	return strings.TrimSpace(string(s))
+}
+
+func (s scriptStep) Transactional() bool {
+	return true
+}
+
+func (s scriptStep) Run(ctx context.Context, ext sqlx.ExtContext) error {
+	return s.statements(ext.DriverName()).Run(ctx, ext)
+}
+
+func (s scriptStep) destroys(driver string) (tables, unnamed []string) {
+	return s.statements(driver).destroys(driver)
+}
+
+func (s scriptStep) statements(driver string) sqlStep {
+	return sqlStep(db.SplitStatements(db.DialectFor(driver), string(s)))
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load reads the migrations kept in the .sql files at the root of fsys, e.g.
+// an embed.FS narrowed with fs.Sub. Files are named after the version and
+// name of their migration and the way it goes:
+//
+//	0001_create_orders.up.sql
+//	0001_create_orders.down.sql
+//
+// Every migration needs an up file; one without a down file cannot be
+// reverted. Each file becomes a Script step, so its statements run in the
+// transaction of the migration.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+
+		match := migrationFile.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("migrate: %s is not named VERSION_NAME.up.sql or VERSION_NAME.down.sql", name)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", name, err)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(db.SplitStatements(db.DialectANSI, string(data))) == 0 {
+			return nil, fmt.Errorf("migrate: %s holds no statement", name)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d used by %q and %q", version, migration.Name, match[2])
+		}
+
+		steps := &migration.Up
+		if match[3] == "down" {
+			steps = &migration.Down
+		}
+		if len(*steps) > 0 {
+			return nil, fmt.Errorf("migrate: %s defined twice", name)
+		}
+		*steps = []Step{Script(string(data))}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if len(migration.Up) == 0 {
+			return nil, fmt.Errorf("migrate: migration %d %s has no up file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MustLoad is like Load but panics on error, for package-level setup.
+func MustLoad(fsys fs.FS) []Migration {
+	migrations, err := Load(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
@@ -0,0 +1,94 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var migrationFiles = fstest.MapFS{
+	"0001_create_orders.up.sql": {Data: []byte(`CREATE TABLE orders (id bigint PRIMARY KEY, note text DEFAULT 'a;b');
+CREATE INDEX orders_note_idx ON orders (note);
+`)},
+	"0001_create_orders.down.sql": {Data: []byte("DROP TABLE orders;\n")},
+	"0002_seed_plans.up.sql":      {Data: []byte("INSERT INTO plans (name) VALUES ('free')")},
+	"README.md":                   {Data: []byte("migrations of the orders service")},
+}
+
+func TestShouldLoadMigrationsFromFiles(t *testing.T) {
+	migrations, err := Load(migrationFiles)
+
+	assert.Nil(t, err)
+	assert.Len(t, migrations, 2)
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "create_orders", migrations[0].Name)
+	assert.Equal(t, "DROP TABLE orders;", migrations[0].Down[0].Describe())
+	tables, _ := destroyed("sqlite3", migrations[0].Down)
+	assert.Equal(t, []string{"orders"}, tables)
+	assert.Equal(t, "seed_plans", migrations[1].Name)
+	assert.Nil(t, migrations[1].Down)
+}
+
+func TestShouldRejectInvalidMigrationFiles(t *testing.T) {
+	_, err := Load(fstest.MapFS{"create_orders.sql": {Data: []byte("SELECT 1")}})
+	assert.EqualError(t, err, "migrate: create_orders.sql is not named VERSION_NAME.up.sql or VERSION_NAME.down.sql")
+
+	_, err = Load(fstest.MapFS{"0001_create_orders.down.sql": {Data: []byte("DROP TABLE orders")}})
+	assert.EqualError(t, err, "migrate: migration 1 create_orders has no up file")
+
+	_, err = Load(fstest.MapFS{
+		"0001_create_orders.up.sql": {Data: []byte("CREATE TABLE orders (id int)")},
+		"0001_create_users.up.sql":  {Data: []byte("CREATE TABLE users (id int)")},
+	})
+	assert.EqualError(t, err, `migrate: version 1 used by "create_orders" and "create_users"`)
+
+	_, err = Load(fstest.MapFS{"0001_nothing.up.sql": {Data: []byte("-- to do\n")}})
+	assert.EqualError(t, err, "migrate: 0001_nothing.up.sql holds no statement")
+}
+
+func TestShouldApplyEachMigrationFileInATransaction(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlite3")
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FROM pragma_table_info").WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, true))
+	mock.ExpectQuery("SELECT version, name, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum"}))
+	mock.ExpectBegin()
+	mock.ExpectExec(`^CREATE TABLE orders \(id bigint PRIMARY KEY, note text DEFAULT 'a;b'\)$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^CREATE INDEX orders_note_idx ON orders \(note\)$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO schema_migrations`).WithArgs(int64(1), "create_orders", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(`^INSERT INTO plans`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO schema_migrations`).WithArgs(int64(2), "seed_plans", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migrator, err := New(database, Config{}, MustLoad(migrationFiles)...)
+	assert.Nil(t, err)
+
+	assert.Nil(t, migrator.Up(context.Background()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseDestructiveDownFilesBehindComments(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0001_create_orders.up.sql":   {Data: []byte("CREATE TABLE orders (id bigint PRIMARY KEY);")},
+		"0001_create_orders.down.sql": {Data: []byte("-- reverts 0001\nDROP INDEX IF EXISTS orders_idx;\nDROP TABLE orders;\n")},
+	})
+	assert.Nil(t, err)
+
+	database, mock := newMockDatabase(t, "postgres")
+	expectAppliedVersions(mock, migrations...)
+	migrator, _ := New(database, Config{}, migrations...)
+
+	err = migrator.Down(context.Background(), 0, DownOptions{})
+	assert.True(t, errors.Is(err, ErrDestructive))
+	assert.Contains(t, err.Error(), "1 create_orders (orders)")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
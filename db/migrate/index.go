@@ -0,0 +1,206 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// Index declares a Postgres index. Columns are column names or expressions.
+type Index struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+
+	// Method is the access method, btree when empty.
+	Method string
+
+	// Where makes the index partial.
+	Where string
+}
+
+// IndexOptions tunes CreateIndexConcurrently.
+type IndexOptions struct {
+	// LockTimeout bounds the wait for the locks the build needs, so that a
+	// long transaction on the table fails the attempt instead of queueing
+	// every other query behind it. Zero means 5 seconds.
+	LockTimeout time.Duration
+
+	// Retries is the number of further attempts after a failed build. Zero
+	// means 3; use a negative value to never retry.
+	Retries int
+
+	// RetryDelay is the pause between attempts. Zero means 10 seconds.
+	RetryDelay time.Duration
+}
+
+// errInvalidIndex is returned by a build that ended leaving an invalid index.
+var errInvalidIndex = errors.New("index is invalid after build")
+
+// retryableIndexErrors are the SQLSTATEs of failures that may not happen
+// again: lock_not_available, deadlock_detected and query_canceled.
+var retryableIndexErrors = map[string]bool{"55P03": true, "40P01": true, "57014": true}
+
+// CreateIndexConcurrently returns a step building index with CREATE INDEX
+// CONCURRENTLY, which Postgres refuses to run in a transaction. The step
+// holds a connection of its own with lock_timeout set. A failed concurrent
+// build leaves an invalid index behind that is still maintained on writes;
+// the step drops it before retrying or giving up. An existing valid index of
+// the same name makes the step a no-op.
+func CreateIndexConcurrently(index Index, opts IndexOptions) Step {
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = 5 * time.Second
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 10 * time.Second
+	}
+	return &concurrentIndex{index: index, opts: opts}
+}
+
+type concurrentIndex struct {
+	index Index
+	opts  IndexOptions
+}
+
+func (c *concurrentIndex) statement() string {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if c.index.Unique {
+		b.WriteString("UNIQUE ")
+	}
+	fmt.Fprintf(&b, "INDEX CONCURRENTLY IF NOT EXISTS %s ON %s", c.index.Name, c.index.Table)
+	if c.index.Method != "" {
+		b.WriteString(" USING " + c.index.Method)
+	}
+	fmt.Fprintf(&b, " (%s)", strings.Join(c.index.Columns, ", "))
+	if c.index.Where != "" {
+		b.WriteString(" WHERE " + c.index.Where)
+	}
+	return b.String()
+}
+
+func (c *concurrentIndex) Describe() string {
+	return fmt.Sprintf("SET lock_timeout = '%dms';\n%s; -- outside a transaction, retried %d times",
+		c.opts.LockTimeout.Milliseconds(), c.statement(), retries(c.opts.Retries))
+}
+
+func (c *concurrentIndex) Transactional() bool {
+	return false
+}
+
+func (c *concurrentIndex) Run(ctx context.Context, ext sqlx.ExtContext) error {
+	database, ok := ext.(*sqlx.DB)
+	if !ok {
+		return fmt.Errorf("migrate: index %s must be built outside a transaction", c.index.Name)
+	}
+	if db.DialectFor(database.DriverName()) != db.DialectPostgres {
+		return fmt.Errorf("migrate: concurrent index builds require postgres, not %s", database.DriverName())
+	}
+	if len(c.index.Columns) == 0 {
+		return fmt.Errorf("migrate: index %s has no columns", c.index.Name)
+	}
+
+	conn, err := database.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET lock_timeout = '%dms'", c.opts.LockTimeout.Milliseconds())); err != nil {
+		return err
+	}
+	// lock_timeout is a session setting; leave the pooled connection as found
+	defer conn.ExecContext(context.Background(), "RESET lock_timeout")
+
+	for attempt := 0; ; attempt++ {
+		err := c.build(ctx, conn)
+		if err == nil {
+			return nil
+		}
+
+		if !retryable(err) || attempt >= retries(c.opts.Retries) {
+			return fmt.Errorf("migrate: building index %s: %w", c.index.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.opts.RetryDelay):
+		}
+	}
+}
+
+// build makes one attempt, starting by dropping what a previous failed
+// attempt may have left.
+func (c *concurrentIndex) build(ctx context.Context, conn *sql.Conn) error {
+	valid, exists, err := c.validity(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if valid {
+		return nil
+	}
+	if exists {
+		if err := c.drop(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	if _, err := conn.ExecContext(ctx, c.statement()); err != nil {
+		c.drop(ctx, conn)
+		return err
+	}
+
+	// a build can end without error yet leave the index invalid, e.g. when
+	// a concurrent session cancels it
+	valid, _, err = c.validity(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		c.drop(ctx, conn)
+		return errInvalidIndex
+	}
+	return nil
+}
+
+func (c *concurrentIndex) validity(ctx context.Context, conn *sql.Conn) (valid, exists bool, err error) {
+	err = conn.QueryRowContext(ctx, "SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass($1)", c.index.Name).Scan(&valid)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	return valid, err == nil, err
+}
+
+func (c *concurrentIndex) drop(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "DROP INDEX CONCURRENTLY IF EXISTS "+c.index.Name)
+	return err
+}
+
+func retries(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// retryable reports whether a failed build is worth trying again: lock
+// timeouts, deadlocks, cancellations and builds left invalid, but not unique
+// violations or syntax errors.
+func retryable(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		return retryableIndexErrors[state.SQLState()]
+	}
+	return errors.Is(err, errInvalidIndex)
+}
@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type stateError string
+
+func (e stateError) Error() string    { return "pq: SQLSTATE " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+var emailIndex = Index{Name: "users_email_idx", Table: "users", Columns: []string{"lower(email)"}, Unique: true, Where: "deleted_at IS NULL"}
+
+func expectValidity(mock sqlmock.Sqlmock, valid ...bool) {
+	rows := sqlmock.NewRows([]string{"indisvalid"})
+	for _, v := range valid {
+		rows.AddRow(v)
+	}
+	mock.ExpectQuery(`SELECT indisvalid FROM pg_index WHERE indexrelid = to_regclass\(\$1\)`).
+		WithArgs("users_email_idx").
+		WillReturnRows(rows)
+}
+
+func TestShouldCreateIndexConcurrentlyWithLockTimeout(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	step := CreateIndexConcurrently(emailIndex, IndexOptions{LockTimeout: 2 * time.Second})
+
+	mock.ExpectExec("SET lock_timeout = '2000ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock)
+	mock.ExpectExec(`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_email_idx ON users \(lower\(email\)\) WHERE deleted_at IS NULL`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock, true)
+	mock.ExpectExec("RESET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.False(t, step.Transactional())
+	assert.Nil(t, step.Run(context.Background(), database))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldDropInvalidIndexAndRetry(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	step := CreateIndexConcurrently(emailIndex, IndexOptions{RetryDelay: time.Millisecond})
+
+	mock.ExpectExec("SET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock, false)
+	mock.ExpectExec("DROP INDEX CONCURRENTLY IF EXISTS users_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE UNIQUE INDEX CONCURRENTLY").WillReturnError(stateError("55P03"))
+	mock.ExpectExec("DROP INDEX CONCURRENTLY IF EXISTS users_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock)
+	mock.ExpectExec("CREATE UNIQUE INDEX CONCURRENTLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock, false)
+	mock.ExpectExec("DROP INDEX CONCURRENTLY IF EXISTS users_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock)
+	mock.ExpectExec("CREATE UNIQUE INDEX CONCURRENTLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock, true)
+	mock.ExpectExec("RESET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, step.Run(context.Background(), database))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldNotRetryUniqueViolations(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	step := CreateIndexConcurrently(emailIndex, IndexOptions{RetryDelay: time.Millisecond})
+
+	mock.ExpectExec("SET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock)
+	mock.ExpectExec("CREATE UNIQUE INDEX CONCURRENTLY").WillReturnError(stateError("23505"))
+	mock.ExpectExec("DROP INDEX CONCURRENTLY IF EXISTS users_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("RESET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := step.Run(context.Background(), database)
+
+	assert.True(t, errors.Is(err, stateError("23505")))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSkipExistingValidIndex(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+
+	mock.ExpectExec("SET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectValidity(mock, true)
+	mock.ExpectExec("RESET lock_timeout").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, CreateIndexConcurrently(emailIndex, IndexOptions{}).Run(context.Background(), database))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldDescribeConcurrentIndex(t *testing.T) {
+	step := CreateIndexConcurrently(Index{Name: "orders_customer_idx", Table: "orders", Columns: []string{"customer_id", "created_at"}, Method: "btree"}, IndexOptions{Retries: -1})
+
+	assert.Equal(t, "SET lock_timeout = '5000ms';\n"+
+		"CREATE INDEX CONCURRENTLY IF NOT EXISTS orders_customer_idx ON orders USING btree (customer_id, created_at); "+
+		"-- outside a transaction, retried 0 times", step.Describe())
+}
@@ -0,0 +1,50 @@
+// Package migrate provides schema migration steps, from plain statements to
+// online schema changes of large tables, and a Migrator applying them, kept
+// in Go or loaded from .sql files with Load.
+package migrate
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Step is a unit of a migration.
+type Step interface {
+	// Describe tells what the step does, its SQL for plain steps.
+	Describe() string
+
+	// Transactional reports whether the step may run inside the migration's
+	// transaction. Other steps are given the database itself and manage
+	// their connections and transactions on their own.
+	Transactional() bool
+
+	// Run applies the step through ext, a transaction or, for
+	// non-transactional steps, the *sqlx.DB.
+	Run(ctx context.Context, ext sqlx.ExtContext) error
+}
+
+// SQL returns a step running statements in order.
+func SQL(statements ...string) Step {
+	return sqlStep(statements)
+}
+
+type sqlStep []string
+
+func (s sqlStep) Describe() string {
+	return strings.Join(s, ";\n") + ";"
+}
+
+func (s sqlStep) Transactional() bool {
+	return true
+}
+
+func (s sqlStep) Run(ctx context.Context, ext sqlx.ExtContext) error {
+	for _, statement := range s {
+		if _, err := ext.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
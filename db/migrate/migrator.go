@@ -0,0 +1,441 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      []Step
+	Down    []Step
+}
+
+// Checksum identifies the content of the migration: the hex SHA-256 of its
+// up steps as Plan renders them.
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	for _, step := range m.Up {
+		h.Write([]byte(step.Describe()))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var (
+	// ErrChecksumMismatch is returned when an applied migration was edited
+	// since it was applied.
+	ErrChecksumMismatch = errors.New("migrate: applied migration was edited")
+
+	// ErrOutOfOrder is returned by the OutOfOrderFail policy for a pending
+	// migration older than an applied one.
+	ErrOutOfOrder = errors.New("migrate: migration is older than applied ones")
+)
+
+// OutOfOrderPolicy decides what happens to pending migrations older than the
+// current version, typically merged from a parallel branch.
+type OutOfOrderPolicy int
+
+const (
+	// OutOfOrderFail refuses to run any migration.
+	OutOfOrderFail OutOfOrderPolicy = iota
+
+	// OutOfOrderApply applies them along with newer ones, in version order.
+	OutOfOrderApply
+
+	// OutOfOrderIgnore leaves them unapplied.
+	OutOfOrderIgnore
+)
+
+// Config configures a Migrator. Table defaults to schema_migrations.
+type Config struct {
+	Table string
+
+	// OutOfOrder is the policy for pending migrations older than the current
+	// version, OutOfOrderFail by default.
+	OutOfOrder OutOfOrderPolicy
+}
+
+// Migrator applies migrations to a database, recording applied versions in
+// its table.
+type Migrator struct {
+	db         *sqlx.DB
+	config     Config
+	migrations []Migration
+}
+
+// New creates a migrator for migrations, which must have distinct positive
+// versions.
+func New(database *sqlx.DB, config Config, migrations ...Migration) (*Migrator, error) {
+	if config.Table == "" {
+		config.Table = "schema_migrations"
+	}
+
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migrate: migration %q has no version", m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: version %d used by %q and %q", m.Version, sorted[i-1].Name, m.Name)
+		}
+	}
+
+	return &Migrator{db: database, config: config, migrations: sorted}, nil
+}
+
+// Version returns the highest applied version, zero when none is.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, _, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return highest(applied), nil
+}
+
+// Pending returns the migrations not applied yet, in version order, out of
+// order ones included whatever the policy.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, _, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.pending(applied), nil
+}
+
+func (m *Migrator) pending(applied map[int64]appliedMigration) []Migration {
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// Verify checks that no applied migration was edited since it was applied.
+func (m *Migrator) Verify(ctx context.Context) error {
+	applied, _, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	return m.verify(applied)
+}
+
+func (m *Migrator) verify(applied map[int64]appliedMigration) error {
+	var edited []string
+	for _, migration := range m.migrations {
+		a, ok := applied[migration.Version]
+		// rows recorded before checksums were have none to compare
+		if !ok || a.Checksum == "" {
+			continue
+		}
+		if sum := migration.Checksum(); sum != a.Checksum {
+			edited = append(edited, fmt.Sprintf("%d %s (applied %s, now %s)", migration.Version, migration.Name, short(a.Checksum), short(sum)))
+		}
+	}
+	if len(edited) > 0 {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(edited, ", "))
+	}
+	return nil
+}
+
+// runnable verifies applied migrations and returns the pending ones to run
+// under the out of order policy.
+func (m *Migrator) runnable(applied map[int64]appliedMigration) ([]Migration, error) {
+	if err := m.verify(applied); err != nil {
+		return nil, err
+	}
+
+	version := highest(applied)
+	var runnable, late []Migration
+	for _, migration := range m.pending(applied) {
+		if migration.Version < version {
+			late = append(late, migration)
+			if m.config.OutOfOrder == OutOfOrderIgnore {
+				continue
+			}
+		}
+		runnable = append(runnable, migration)
+	}
+
+	if len(late) > 0 && m.config.OutOfOrder == OutOfOrderFail {
+		names := make([]string, len(late))
+		for i, migration := range late {
+			names[i] = fmt.Sprintf("%d %s", migration.Version, migration.Name)
+		}
+		return nil, fmt.Errorf("%w: %s pending at version %d", ErrOutOfOrder, strings.Join(names, ", "), version)
+	}
+	return runnable, nil
+}
+
+func short(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+func highest(applied map[int64]appliedMigration) int64 {
+	var version int64
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version
+}
+
+// Up applies every pending migration in version order, after verifying the
+// checksums of applied ones and applying the out of order policy. Consecutive
+// transactional steps of a migration share a transaction, which also records
+// the migration when it ends it; other steps run between transactions. A
+// table of applied migrations created before checksums were recorded gets
+// the column first.
+func (m *Migrator) Up(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, m.createTable()); err != nil {
+		return err
+	}
+
+	applied, table, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	if !table.checksummed {
+		if _, err := m.db.ExecContext(ctx, m.addChecksum()); err != nil {
+			return err
+		}
+	}
+	pending, err := m.runnable(applied)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		for _, s := range m.segments(migration.Up, m.record(migration)) {
+			if err := s.run(ctx, m.db); err != nil {
+				return fmt.Errorf("migrate: %d %s: %w", migration.Version, migration.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Plan writes the SQL Up would run against the current schema version,
+// transaction boundaries included, without changing anything.
+func (m *Migrator) Plan(ctx context.Context, w io.Writer) error {
+	applied, table, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	pending, err := m.runnable(applied)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "-- %s at version %d, %d pending migration(s)\n", m.config.Table, highest(applied), len(pending))
+	if !table.exists {
+		fmt.Fprintf(w, "%s;\n", m.createTable())
+	} else if !table.checksummed {
+		fmt.Fprintf(w, "%s;\n", m.addChecksum())
+	}
+
+	for _, migration := range pending {
+		fmt.Fprintf(w, "\n-- %d %s\n", migration.Version, migration.Name)
+		for _, s := range m.segments(migration.Up, m.record(migration)) {
+			s.describe(w)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) createTable() string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version bigint PRIMARY KEY, name varchar(255) NOT NULL, checksum varchar(64) NOT NULL, applied_at timestamp NOT NULL)",
+		m.config.Table)
+}
+
+// addChecksum upgrades a table created before checksums were recorded. The
+// migrations it lists get an empty checksum, which Verify skips.
+func (m *Migrator) addChecksum() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN checksum varchar(64) NOT NULL DEFAULT ''", m.config.Table)
+}
+
+// record returns the statement recording migration as applied.
+func (m *Migrator) record(migration Migration) statement {
+	return statement{
+		query: m.db.Rebind(fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)", m.config.Table)),
+		args:  []interface{}{migration.Version, migration.Name, migration.Checksum(), time.Now().UTC()},
+	}
+}
+
+type appliedMigration struct {
+	Name     string
+	Checksum string
+}
+
+// historyTable is the state of the table recording applied migrations.
+type historyTable struct {
+	exists bool
+	// checksummed is false for tables created before checksums were
+	// recorded, which lack the column.
+	checksummed bool
+}
+
+// applied returns the applied migrations by version, and the state of the
+// table recording them.
+func (m *Migrator) applied(ctx context.Context) (map[int64]appliedMigration, historyTable, error) {
+	applied := map[int64]appliedMigration{}
+
+	table, err := m.historyTable(ctx)
+	if err != nil || !table.exists {
+		return applied, table, err
+	}
+
+	checksum := "checksum"
+	if !table.checksummed {
+		checksum = "'' AS checksum"
+	}
+	rows, err := m.db.QueryxContext(ctx, fmt.Sprintf("SELECT version, name, %s FROM %s", checksum, m.config.Table))
+	if err != nil {
+		return nil, table, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Name, &a.Checksum); err != nil {
+			return nil, table, err
+		}
+		applied[version] = a
+	}
+	return applied, table, rows.Err()
+}
+
+func (m *Migrator) historyTable(ctx context.Context) (historyTable, error) {
+	var query string
+	switch db.DialectFor(m.db.DriverName()) {
+	case db.DialectPostgres:
+		query = "SELECT to_regclass($1) IS NOT NULL, EXISTS (SELECT 1 FROM pg_attribute " +
+			"WHERE attrelid = to_regclass($1) AND attname = 'checksum' AND NOT attisdropped)"
+	case db.DialectMySQL:
+		query = "SELECT COUNT(*) > 0, COALESCE(SUM(column_name = 'checksum'), 0) > 0 FROM information_schema.columns " +
+			"WHERE table_schema = DATABASE() AND table_name = ?"
+	default:
+		query = "SELECT COUNT(*) > 0, COALESCE(SUM(name = 'checksum'), 0) > 0 FROM pragma_table_info(?)"
+	}
+
+	var table historyTable
+	err := m.db.QueryRowxContext(ctx, m.db.Rebind(query), m.config.Table).Scan(&table.exists, &table.checksummed)
+	return table, err
+}
+
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// segment is a run of transactional steps applied in one transaction, or a
+// single non-transactional step.
+type segment struct {
+	steps         []Step
+	transactional bool
+
+	// record is run last, in the segment's transaction if any.
+	record *statement
+}
+
+// segments splits steps as Up runs them; record goes to the last segment.
+func (m *Migrator) segments(steps []Step, record statement) []segment {
+	var segments []segment
+	for _, step := range steps {
+		if n := len(segments); n > 0 && step.Transactional() && segments[n-1].transactional {
+			segments[n-1].steps = append(segments[n-1].steps, step)
+			continue
+		}
+		segments = append(segments, segment{steps: []Step{step}, transactional: step.Transactional()})
+	}
+
+	if n := len(segments); n > 0 && segments[n-1].transactional {
+		segments[n-1].record = &record
+	} else {
+		segments = append(segments, segment{record: &record})
+	}
+	return segments
+}
+
+func (s segment) run(ctx context.Context, database *sqlx.DB) error {
+	if !s.transactional {
+		for _, step := range s.steps {
+			if err := step.Run(ctx, database); err != nil {
+				return err
+			}
+		}
+		if s.record != nil {
+			_, err := database.ExecContext(ctx, s.record.query, s.record.args...)
+			return err
+		}
+		return nil
+	}
+
+	tx, err := database.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, step := range s.steps {
+		if err := step.Run(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if s.record != nil {
+		if _, err := tx.ExecContext(ctx, s.record.query, s.record.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s segment) describe(w io.Writer) {
+	if s.transactional {
+		fmt.Fprintln(w, "BEGIN;")
+	}
+	for _, step := range s.steps {
+		fmt.Fprintln(w, step.Describe())
+	}
+	if s.record != nil {
+		fmt.Fprintf(w, "%s; -- %s\n", s.record.query, formatArgs(s.record.args))
+	}
+	if s.transactional {
+		fmt.Fprintln(w, "COMMIT;")
+	}
+}
+
+func formatArgs(args []interface{}) string {
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			formatted[i] = "now"
+		case string:
+			formatted[i] = fmt.Sprintf("%q", v)
+		default:
+			formatted[i] = fmt.Sprint(v)
+		}
+	}
+	return "args: " + strings.Join(formatted, ", ")
+}
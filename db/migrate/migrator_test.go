@@ -0,0 +1,224 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMigrations() []Migration {
+	return []Migration{
+		{Version: 2, Name: "index_orders", Up: []Step{
+			SQL("ALTER TABLE orders ADD COLUMN customer_id bigint"),
+			CreateIndexConcurrently(Index{Name: "orders_customer_idx", Table: "orders", Columns: []string{"customer_id"}}, IndexOptions{}),
+		}},
+		{Version: 1, Name: "create_orders", Up: []Step{
+			SQL("CREATE TABLE orders (id bigint PRIMARY KEY)"),
+		}},
+	}
+}
+
+func TestShouldRejectDuplicateMigrationVersions(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+
+	_, err := New(database, Config{}, Migration{Version: 1, Name: "a"}, Migration{Version: 1, Name: "b"})
+
+	assert.EqualError(t, err, `migrate: version 1 used by "a" and "b"`)
+}
+
+func TestShouldPlanPendingMigrationsWithoutExecuting(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("SELECT to_regclass").WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, true))
+	mock.ExpectQuery("SELECT version, name, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum"}).AddRow(1, "create_orders", testMigrations()[1].Checksum()))
+
+	migrator, err := New(database, Config{}, testMigrations()...)
+	assert.Nil(t, err)
+
+	var plan bytes.Buffer
+	assert.Nil(t, migrator.Plan(context.Background(), &plan))
+
+	assert.Equal(t, `-- schema_migrations at version 1, 1 pending migration(s)
+
+-- 2 index_orders
+BEGIN;
+ALTER TABLE orders ADD COLUMN customer_id bigint;
+COMMIT;
+SET lock_timeout = '5000ms';
+CREATE INDEX CONCURRENTLY IF NOT EXISTS orders_customer_idx ON orders (customer_id); -- outside a transaction, retried 3 times
+INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4); -- args: 2, "index_orders", "`+
+		testMigrations()[0].Checksum()+`", now
+`, plan.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldPlanTableCreationOnFreshDatabase(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("SELECT to_regclass").WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(false, false))
+
+	migrator, _ := New(database, Config{}, testMigrations()[1])
+
+	var plan bytes.Buffer
+	assert.Nil(t, migrator.Plan(context.Background(), &plan))
+
+	assert.Equal(t, `-- schema_migrations at version 0, 1 pending migration(s)
+CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY, name varchar(255) NOT NULL, checksum varchar(64) NOT NULL, applied_at timestamp NOT NULL);
+
+-- 1 create_orders
+BEGIN;
+CREATE TABLE orders (id bigint PRIMARY KEY);
+INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4); -- args: 1, "create_orders", "`+
+		testMigrations()[1].Checksum()+`", now
+COMMIT;
+`, plan.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldApplyPendingMigrationsRecordingVersionInTransaction(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlite3")
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FROM pragma_table_info").WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, true))
+	mock.ExpectQuery("SELECT version, name, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(int64(1), "create_orders", testMigrations()[1].Checksum(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migrator, _ := New(database, Config{}, testMigrations()[1])
+
+	assert.Nil(t, migrator.Up(context.Background()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldStopAtFailedMigrationRollingBack(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlite3")
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, true))
+	mock.ExpectQuery("SELECT version, name, checksum FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum"}))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE orders").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	migrator, _ := New(database, Config{}, testMigrations()...)
+
+	err := migrator.Up(context.Background())
+
+	assert.EqualError(t, err, "migrate: 1 create_orders: "+assert.AnError.Error())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldAddTheChecksumColumnToTablesCreatedWithoutIt(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlite3")
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("FROM pragma_table_info").WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, false))
+	mock.ExpectQuery("^SELECT version, name, '' AS checksum FROM schema_migrations$").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum"}).AddRow(1, "create_orders", ""))
+	mock.ExpectExec("^ALTER TABLE schema_migrations ADD COLUMN checksum varchar\\(64\\) NOT NULL DEFAULT ''$").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	addTotal := Migration{Version: 2, Name: "add_total", Up: []Step{SQL("ALTER TABLE orders ADD COLUMN total bigint")}}
+	mock.ExpectBegin()
+	mock.ExpectExec("ALTER TABLE orders ADD COLUMN total").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(int64(2), "add_total", addTotal.Checksum(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	migrator, _ := New(database, Config{}, testMigrations()[1], addTotal)
+
+	assert.Nil(t, migrator.Up(context.Background()))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldPlanTheChecksumColumnOfTablesCreatedWithoutIt(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("SELECT to_regclass").WithArgs("schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, false))
+	mock.ExpectQuery("^SELECT version, name, '' AS checksum FROM schema_migrations$").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "name", "checksum"}).AddRow(1, "create_orders", ""))
+
+	migrator, _ := New(database, Config{}, testMigrations()[1])
+
+	var plan bytes.Buffer
+	assert.Nil(t, migrator.Plan(context.Background(), &plan))
+
+	assert.Equal(t, `-- schema_migrations at version 1, 0 pending migration(s)
+ALTER TABLE schema_migrations ADD COLUMN checksum varchar(64) NOT NULL DEFAULT '';
+`, plan.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func expectApplied(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectQuery("SELECT to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists", "checksummed"}).AddRow(true, true))
+	mock.ExpectQuery("SELECT version, name, checksum FROM schema_migrations").WillReturnRows(rows)
+}
+
+func TestShouldChangeChecksumWhenMigrationIsEdited(t *testing.T) {
+	migration := testMigrations()[1]
+	edited := migration
+	edited.Up = []Step{SQL("CREATE TABLE orders (id bigint PRIMARY KEY, total bigint)")}
+
+	assert.Equal(t, migration.Checksum(), testMigrations()[1].Checksum())
+	assert.NotEqual(t, migration.Checksum(), edited.Checksum())
+}
+
+func TestShouldFailWhenAppliedMigrationWasEdited(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectApplied(mock, sqlmock.NewRows([]string{"version", "name", "checksum"}).
+		AddRow(1, "create_orders", "0123456789abcdef"))
+
+	migrator, _ := New(database, Config{}, testMigrations()...)
+
+	err := migrator.Plan(context.Background(), &bytes.Buffer{})
+
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	assert.Contains(t, err.Error(), "1 create_orders (applied 0123456789ab, now "+testMigrations()[1].Checksum()[:12]+")")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSkipVerifyingRowsWithoutChecksum(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectApplied(mock, sqlmock.NewRows([]string{"version", "name", "checksum"}).AddRow(1, "create_orders", ""))
+
+	migrator, _ := New(database, Config{}, testMigrations()...)
+
+	assert.Nil(t, migrator.Verify(context.Background()))
+}
+
+func TestShouldFailOnOutOfOrderMigrationByDefault(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	expectApplied(mock, sqlmock.NewRows([]string{"version", "name", "checksum"}).
+		AddRow(2, "index_orders", testMigrations()[0].Checksum()))
+
+	migrator, _ := New(database, Config{}, testMigrations()...)
+
+	err := migrator.Plan(context.Background(), &bytes.Buffer{})
+
+	assert.True(t, errors.Is(err, ErrOutOfOrder))
+	assert.Contains(t, err.Error(), "1 create_orders pending at version 2")
+}
+
+func TestShouldApplyOrIgnoreOutOfOrderMigrationsByPolicy(t *testing.T) {
+	for policy, pending := range map[OutOfOrderPolicy]string{OutOfOrderApply: "1 pending", OutOfOrderIgnore: "0 pending"} {
+		database, mock := newMockDatabase(t, "postgres")
+		expectApplied(mock, sqlmock.NewRows([]string{"version", "name", "checksum"}).
+			AddRow(2, "index_orders", testMigrations()[0].Checksum()))
+
+		migrator, _ := New(database, Config{OutOfOrder: policy}, testMigrations()...)
+
+		var plan bytes.Buffer
+		assert.Nil(t, migrator.Plan(context.Background(), &plan))
+		assert.Contains(t, plan.String(), "at version 2, "+pending)
+	}
+}
@@ -0,0 +1,243 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/helderfarias/sqlx-wrapper/db/backfill"
+	"github.com/jmoiron/sqlx"
+)
+
+// OnlineAlterOptions tunes OnlineAlter.
+type OnlineAlterOptions struct {
+	// ChunkSize is the number of rows copied per statement. Zero means 1000.
+	ChunkSize int
+
+	// Sleep is the pause between chunks.
+	Sleep time.Duration
+
+	// Limits are checked before every chunk; the copy is abandoned, and the
+	// table left untouched, when one is exceeded.
+	Limits []backfill.Limit
+
+	// KeepOld keeps the original table as _<table>_old after the swap
+	// instead of dropping it.
+	KeepOld bool
+}
+
+// OnlineAlter returns a step applying alter, the part of an ALTER TABLE
+// statement after the table name, to a MySQL table without locking writes,
+// the way pt-online-schema-change does: the change is made on an empty copy
+// of the table, kept in sync by triggers while existing rows are copied in
+// primary key order, and the copy then atomically renamed over the original.
+// The table needs a single-column primary key.
+func OnlineAlter(table, alter string, opts OnlineAlterOptions) Step {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 1000
+	}
+	return &onlineAlter{table: table, alter: alter, opts: opts}
+}
+
+type onlineAlter struct {
+	table string
+	alter string
+	opts  OnlineAlterOptions
+}
+
+func (o *onlineAlter) Describe() string {
+	return fmt.Sprintf("ALTER TABLE %s %s; -- online, through a copy in _%s_new", o.table, o.alter, o.table)
+}
+
+// Transactional is false: MySQL commits DDL implicitly, and the copy commits
+// chunk by chunk.
+func (o *onlineAlter) Transactional() bool {
+	return false
+}
+
+func (o *onlineAlter) Run(ctx context.Context, database sqlx.ExtContext) error {
+	if db.DialectFor(database.DriverName()) != db.DialectMySQL {
+		return fmt.Errorf("migrate: online alter requires mysql, not %s", database.DriverName())
+	}
+
+	q := db.DialectMySQL.Quote
+	shadow, old := "_"+o.table+"_new", "_"+o.table+"_old"
+	triggers := []string{"osc_" + o.table + "_ins", "osc_" + o.table + "_upd", "osc_" + o.table + "_del"}
+
+	key, err := primaryKey(ctx, database, o.table)
+	if err != nil {
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) error {
+		_, err := database.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("migrate: online alter of %s: %w", o.table, err)
+		}
+		return nil
+	}
+
+	if err := exec(fmt.Sprintf("CREATE TABLE %s LIKE %s", q(shadow), q(o.table))); err != nil {
+		return err
+	}
+
+	swapped := false
+	defer func() {
+		if swapped {
+			return
+		}
+		// leave the original table as it was; cleanup errors would hide the
+		// one that brought us here
+		for _, trigger := range triggers {
+			database.ExecContext(context.Background(), "DROP TRIGGER IF EXISTS "+q(trigger))
+		}
+		database.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+q(shadow))
+	}()
+
+	if err := exec(fmt.Sprintf("ALTER TABLE %s %s", q(shadow), o.alter)); err != nil {
+		return err
+	}
+
+	columns, err := commonColumns(ctx, database, o.table, shadow)
+	if err != nil {
+		return err
+	}
+	if indexOf(columns, key) < 0 {
+		return fmt.Errorf("migrate: online alter of %s cannot drop its primary key %s", o.table, key)
+	}
+
+	quoted := make([]string, len(columns))
+	values := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = q(c)
+		values[i] = "NEW." + q(c)
+	}
+	list := strings.Join(quoted, ", ")
+	replace := fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", q(shadow), list, strings.Join(values, ", "))
+
+	for _, trigger := range []string{
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s FOR EACH ROW %s", q(triggers[0]), q(o.table), replace),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s FOR EACH ROW BEGIN "+
+			"DELETE IGNORE FROM %s WHERE !(OLD.%s <=> NEW.%s) AND %s <=> OLD.%s; %s; END",
+			q(triggers[1]), q(o.table), q(shadow), q(key), q(key), q(key), q(key), replace),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s FOR EACH ROW DELETE IGNORE FROM %s WHERE %s <=> OLD.%s",
+			q(triggers[2]), q(o.table), q(shadow), q(key), q(key)),
+	} {
+		if err := exec(trigger); err != nil {
+			return err
+		}
+	}
+
+	if err := o.copyRows(ctx, database, shadow, key, list, exec); err != nil {
+		return err
+	}
+
+	if err := exec(fmt.Sprintf("RENAME TABLE %s TO %s, %s TO %s", q(o.table), q(old), q(shadow), q(o.table))); err != nil {
+		return err
+	}
+	swapped = true
+
+	for _, trigger := range triggers {
+		if err := exec("DROP TRIGGER IF EXISTS " + q(trigger)); err != nil {
+			return err
+		}
+	}
+	if !o.opts.KeepOld {
+		return exec("DROP TABLE " + q(old))
+	}
+	return nil
+}
+
+// copyRows copies the rows of the table into shadow in primary key chunks.
+// Rows the triggers already copied are left alone.
+func (o *onlineAlter) copyRows(ctx context.Context, database sqlx.ExtContext, shadow, key, list string, exec func(string, ...interface{}) error) error {
+	q := db.DialectMySQL.Quote
+	var after interface{}
+
+	for {
+		if err := backfill.CheckLimits(ctx, o.opts.Limits); err != nil {
+			return err
+		}
+
+		where, args := "", []interface{}{}
+		if after != nil {
+			where, args = fmt.Sprintf(" WHERE %s > ?", q(key)), append(args, after)
+		}
+
+		var last interface{}
+		chunk := fmt.Sprintf("SELECT MAX(%s) FROM (SELECT %s FROM %s%s ORDER BY %s LIMIT %d) chunk",
+			q(key), q(key), q(o.table), where, q(key), o.opts.ChunkSize)
+		if err := sqlx.GetContext(ctx, database, &last, chunk, args...); err != nil {
+			return fmt.Errorf("migrate: online alter of %s: %w", o.table, err)
+		}
+		if last == nil {
+			return nil
+		}
+
+		bound := fmt.Sprintf("%s <= ?", q(key))
+		if after != nil {
+			bound = fmt.Sprintf("%s > ? AND %s <= ?", q(key), q(key))
+		}
+		insert := fmt.Sprintf("INSERT LOW_PRIORITY IGNORE INTO %s (%s) SELECT %s FROM %s FORCE INDEX (PRIMARY) WHERE %s LOCK IN SHARE MODE",
+			q(shadow), list, list, q(o.table), bound)
+		if err := exec(insert, append(args, last)...); err != nil {
+			return err
+		}
+		after = last
+
+		if o.opts.Sleep > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(o.opts.Sleep):
+			}
+		}
+	}
+}
+
+func primaryKey(ctx context.Context, database sqlx.ExtContext, table string) (string, error) {
+	var key []string
+	err := sqlx.SelectContext(ctx, database, &key, "SELECT column_name FROM information_schema.key_column_usage "+
+		"WHERE table_schema = DATABASE() AND table_name = ? AND constraint_name = 'PRIMARY' ORDER BY ordinal_position", table)
+	if err != nil {
+		return "", err
+	}
+	if len(key) != 1 {
+		return "", fmt.Errorf("migrate: online alter of %s needs a single-column primary key", table)
+	}
+	return key[0], nil
+}
+
+// commonColumns lists the stored columns of table that shadow still has, in
+// table order.
+func commonColumns(ctx context.Context, database sqlx.ExtContext, table, shadow string) ([]string, error) {
+	query := "SELECT column_name FROM information_schema.columns " +
+		"WHERE table_schema = DATABASE() AND table_name = ? AND extra NOT LIKE '%GENERATED%' ORDER BY ordinal_position"
+
+	var before, after []string
+	if err := sqlx.SelectContext(ctx, database, &before, query, table); err != nil {
+		return nil, err
+	}
+	if err := sqlx.SelectContext(ctx, database, &after, query, shadow); err != nil {
+		return nil, err
+	}
+
+	var common []string
+	for _, c := range before {
+		if indexOf(after, c) >= 0 {
+			common = append(common, c)
+		}
+	}
+	return common, nil
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if strings.EqualFold(v, value) {
+			return i
+		}
+	}
+	return -1
+}
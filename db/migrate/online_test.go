@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockDatabase(t *testing.T, driver string) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sqlx.NewDb(conn, driver), mock
+}
+
+func expectOnlineAlterSetup(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("SELECT column_name FROM information_schema.key_column_usage").
+		WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id"))
+	mock.ExpectExec("CREATE TABLE `_orders_new` LIKE `orders`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER TABLE `_orders_new` ADD COLUMN note text, DROP COLUMN legacy").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").
+		WithArgs("orders").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id").AddRow("total").AddRow("legacy"))
+	mock.ExpectQuery("SELECT column_name FROM information_schema.columns").
+		WithArgs("_orders_new").
+		WillReturnRows(sqlmock.NewRows([]string{"column_name"}).AddRow("id").AddRow("total").AddRow("note"))
+	mock.ExpectExec("CREATE TRIGGER `osc_orders_ins` AFTER INSERT ON `orders` FOR EACH ROW " +
+		"REPLACE INTO `_orders_new` \\(`id`, `total`\\) VALUES \\(NEW.`id`, NEW.`total`\\)").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TRIGGER `osc_orders_upd` AFTER UPDATE ON `orders` FOR EACH ROW BEGIN DELETE IGNORE").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TRIGGER `osc_orders_del` AFTER DELETE ON `orders` FOR EACH ROW DELETE IGNORE FROM `_orders_new` WHERE `id` <=> OLD.`id`").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestShouldAlterMySQLTableOnline(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	step := OnlineAlter("orders", "ADD COLUMN note text, DROP COLUMN legacy", OnlineAlterOptions{ChunkSize: 2})
+
+	expectOnlineAlterSetup(mock)
+	mock.ExpectQuery("SELECT MAX\\(`id`\\) FROM \\(SELECT `id` FROM `orders` ORDER BY `id` LIMIT 2\\) chunk").
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(2))
+	mock.ExpectExec("INSERT LOW_PRIORITY IGNORE INTO `_orders_new` \\(`id`, `total`\\) SELECT `id`, `total` FROM `orders` " +
+		"FORCE INDEX \\(PRIMARY\\) WHERE `id` <= \\? LOCK IN SHARE MODE").
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("WHERE `id` > \\? ORDER BY `id` LIMIT 2").
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(3))
+	mock.ExpectExec("WHERE `id` > \\? AND `id` <= \\? LOCK IN SHARE MODE").
+		WithArgs(int64(2), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("WHERE `id` > \\? ORDER BY `id` LIMIT 2").
+		WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(nil))
+	mock.ExpectExec("RENAME TABLE `orders` TO `_orders_old`, `_orders_new` TO `orders`").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, trigger := range []string{"ins", "upd", "del"} {
+		mock.ExpectExec("DROP TRIGGER IF EXISTS `osc_orders_" + trigger + "`").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("DROP TABLE `_orders_old`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Nil(t, step.Run(context.Background(), database))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldCleanUpAbandonedOnlineAlter(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	step := OnlineAlter("orders", "ADD COLUMN note text, DROP COLUMN legacy", OnlineAlterOptions{})
+
+	expectOnlineAlterSetup(mock)
+	mock.ExpectQuery("SELECT MAX").WillReturnError(errors.New("lock wait timeout"))
+	for _, trigger := range []string{"ins", "upd", "del"} {
+		mock.ExpectExec("DROP TRIGGER IF EXISTS `osc_orders_" + trigger + "`").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec("DROP TABLE IF EXISTS `_orders_new`").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := step.Run(context.Background(), database)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "lock wait timeout")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequireMySQLForOnlineAlter(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+
+	err := OnlineAlter("orders", "ADD COLUMN note text", OnlineAlterOptions{}).Run(context.Background(), database)
+	assert.NotNil(t, err)
+}
+
+func TestShouldRunPlainSQLSteps(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	step := SQL("CREATE TABLE a (id int)", "CREATE TABLE b (id int)")
+
+	mock.ExpectExec("CREATE TABLE a").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, "CREATE TABLE a (id int);\nCREATE TABLE b (id int);", step.Describe())
+	assert.Nil(t, step.Run(context.Background(), database))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
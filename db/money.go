@@ -0,0 +1,226 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// ErrMixedCurrencies is returned when amounts in different currencies would
+// be added together.
+var ErrMixedCurrencies = errors.New("db: cannot sum amounts in different currencies")
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+// Decimal is an exact decimal number, as stored in NUMERIC and DECIMAL
+// columns. The zero value is 0.
+type Decimal struct {
+	unscaled *big.Int
+	scale    int32
+}
+
+// NewDecimal returns unscaled * 10^-scale, e.g. NewDecimal(1250, 2) is 12.50.
+func NewDecimal(unscaled int64, scale int32) Decimal {
+	return Decimal{unscaled: big.NewInt(unscaled), scale: scale}
+}
+
+// ParseDecimal parses a plain decimal such as "-12.50".
+func ParseDecimal(s string) (Decimal, error) {
+	digits := s
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	}
+
+	var scale int32
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = int32(len(digits) - i - 1)
+		digits = digits[:i] + digits[i+1:]
+	}
+
+	unscaled, ok := new(big.Int).SetString(digits, 10)
+	if !ok || digits == "" || strings.ContainsAny(digits, "+-") {
+		return Decimal{}, fmt.Errorf("db: invalid decimal %q", s)
+	}
+	if strings.HasPrefix(s, "-") {
+		unscaled.Neg(unscaled)
+	}
+
+	return Decimal{unscaled: unscaled, scale: scale}, nil
+}
+
+func (d Decimal) coefficient() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+// rescale returns the coefficient of d at a scale not smaller than its own.
+func (d Decimal) rescale(scale int32) *big.Int {
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-d.scale)), nil)
+	return factor.Mul(factor, d.coefficient())
+}
+
+// Add returns d + other, at the larger of both scales.
+func (d Decimal) Add(other Decimal) Decimal {
+	scale := d.scale
+	if other.scale > scale {
+		scale = other.scale
+	}
+	return Decimal{unscaled: new(big.Int).Add(d.rescale(scale), other.rescale(scale)), scale: scale}
+}
+
+// Cmp compares d and other, returning -1, 0 or +1.
+func (d Decimal) Cmp(other Decimal) int {
+	scale := d.scale
+	if other.scale > scale {
+		scale = other.scale
+	}
+	return d.rescale(scale).Cmp(other.rescale(scale))
+}
+
+// IsZero reports whether d is 0.
+func (d Decimal) IsZero() bool {
+	return d.coefficient().Sign() == 0
+}
+
+// String formats d with its scale, e.g. "12.50".
+func (d Decimal) String() string {
+	coefficient := d.coefficient()
+	digits := new(big.Int).Abs(coefficient).String()
+
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		digits = digits[:len(digits)-int(d.scale)] + "." + digits[len(digits)-int(d.scale):]
+	} else if d.scale < 0 && coefficient.Sign() != 0 {
+		digits += strings.Repeat("0", int(-d.scale))
+	}
+
+	if coefficient.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Value implements the driver Valuer interface.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan implements the Scanner interface.
+func (d *Decimal) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		*d = Decimal{}
+	case int64:
+		*d = NewDecimal(v, 0)
+	case float64:
+		*d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case string:
+		*d, err = ParseDecimal(v)
+	default:
+		err = fmt.Errorf("db: cannot scan %T into Decimal", value)
+	}
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, encoding d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	dec, err := ParseDecimal(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+	*d = dec
+	return nil
+}
+
+// SumByCurrency runs query and adds up amountColumn of its rows separately
+// for each value of currencyColumn, both mapped to fields of V. Amounts must
+// be Decimal, integers or decimal strings; floats are rejected as they cannot
+// hold money exactly.
+func SumByCurrency[V any](uow UnitOfWork, currencyColumn, amountColumn string, query string, args ...interface{}) (map[Currency]Decimal, error) {
+	groups, err := SelectGrouped[Currency, V](uow, currencyColumn, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := reflectx.NewMapperFunc("db", sqlx.NameMapper)
+	sums := map[Currency]Decimal{}
+
+	for currency, rows := range groups {
+		var sum Decimal
+		for i := range rows {
+			field, ok := fieldByColumn(mapper, reflect.ValueOf(&rows[i]).Elem(), amountColumn)
+			if !ok {
+				return nil, fmt.Errorf("db: amount column %q is not mapped on %T", amountColumn, rows[i])
+			}
+
+			amount, err := decimalOf(field)
+			if err != nil {
+				return nil, fmt.Errorf("db: amount column %q: %w", amountColumn, err)
+			}
+			sum = sum.Add(amount)
+		}
+		sums[currency] = sum
+	}
+
+	return sums, nil
+}
+
+// SumSingleCurrency is SumByCurrency for queries expected to return amounts in
+// one currency only, failing with ErrMixedCurrencies otherwise. It returns an
+// empty currency and zero when there are no rows.
+func SumSingleCurrency[V any](uow UnitOfWork, currencyColumn, amountColumn string, query string, args ...interface{}) (Currency, Decimal, error) {
+	sums, err := SumByCurrency[V](uow, currencyColumn, amountColumn, query, args...)
+	if err != nil {
+		return "", Decimal{}, err
+	}
+
+	if len(sums) > 1 {
+		var currencies []string
+		for c := range sums {
+			currencies = append(currencies, string(c))
+		}
+		sort.Strings(currencies)
+		return "", Decimal{}, fmt.Errorf("%w: %s", ErrMixedCurrencies, strings.Join(currencies, ", "))
+	}
+
+	for c, sum := range sums {
+		return c, sum, nil
+	}
+	return "", Decimal{}, nil
+}
+
+func decimalOf(field reflect.Value) (Decimal, error) {
+	if d, ok := field.Interface().(Decimal); ok {
+		return d, nil
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewDecimal(field.Int(), 0), nil
+	case reflect.String:
+		return ParseDecimal(field.String())
+	}
+
+	return Decimal{}, fmt.Errorf("unsupported type %s", field.Type())
+}
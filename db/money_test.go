@@ -0,0 +1,132 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type paymentRow struct {
+	ID       int64   `db:"id"`
+	Currency string  `db:"currency"`
+	Amount   Decimal `db:"amount"`
+}
+
+func TestShouldParseAndFormatDecimals(t *testing.T) {
+	for in, out := range map[string]string{
+		"12.50": "12.50", "-0.05": "-0.05", "+7": "7", "0.000": "0.000", "100": "100",
+	} {
+		d, err := ParseDecimal(in)
+		assert.Nil(t, err, in)
+		assert.Equal(t, out, d.String())
+	}
+
+	for _, in := range []string{"", "-", "1.2.3", "1e3", "--1", "abc"} {
+		_, err := ParseDecimal(in)
+		assert.NotNil(t, err, in)
+	}
+
+	assert.Equal(t, "0", Decimal{}.String())
+	assert.Equal(t, "-1.25", NewDecimal(-125, 2).String())
+}
+
+func TestShouldAddAndCompareDecimalsExactly(t *testing.T) {
+	a, _ := ParseDecimal("0.1")
+	b, _ := ParseDecimal("0.20")
+
+	sum := a.Add(b)
+	assert.Equal(t, "0.30", sum.String())
+	assert.Equal(t, 0, sum.Cmp(NewDecimal(3, 1)))
+	assert.Equal(t, -1, a.Cmp(b))
+	assert.True(t, NewDecimal(0, 4).IsZero())
+}
+
+func TestShouldScanAndMarshalDecimals(t *testing.T) {
+	var d Decimal
+	assert.Nil(t, d.Scan([]byte("19.99")))
+	assert.Equal(t, "19.99", d.String())
+	assert.Nil(t, d.Scan(int64(4)))
+	assert.Equal(t, "4", d.String())
+	assert.Nil(t, d.Scan(2.5))
+	assert.Equal(t, "2.5", d.String())
+
+	data, err := json.Marshal(map[string]Decimal{"total": NewDecimal(1050, 2)})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"total":10.50}`, string(data))
+
+	assert.Nil(t, json.Unmarshal([]byte(`"3.14"`), &d))
+	assert.Equal(t, "3.14", d.String())
+}
+
+func TestShouldSumByCurrency(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, currency, amount FROM payments").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "currency", "amount"}).
+			AddRow(1, "USD", "10.10").
+			AddRow(2, "BRL", "5.00").
+			AddRow(3, "USD", "0.20"))
+
+	sums, err := SumByCurrency[paymentRow](uw, "currency", "amount", "SELECT id, currency, amount FROM payments")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "10.30", sums["USD"].String())
+	assert.Equal(t, "5.00", sums["BRL"].String())
+}
+
+func TestShouldFailWhenAmountColumnIsNotMapped(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, currency, amount FROM payments").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "currency", "amount"}).AddRow(1, "USD", "10.10"))
+
+	_, err := SumByCurrency[paymentRow](uw, "currency", "total", "SELECT id, currency, amount FROM payments")
+
+	assert.EqualError(t, err, `db: amount column "total" is not mapped on db.paymentRow`)
+}
+
+func TestShouldRefuseToSumMixedCurrencies(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, currency, amount FROM payments").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "currency", "amount"}).
+			AddRow(1, "USD", "10.10").
+			AddRow(2, "BRL", "5.00"))
+
+	_, _, err := SumSingleCurrency[paymentRow](uw, "currency", "amount", "SELECT id, currency, amount FROM payments")
+
+	assert.True(t, errors.Is(err, ErrMixedCurrencies))
+	assert.Contains(t, err.Error(), "BRL, USD")
+}
+
+func TestShouldSumSingleCurrency(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT id, currency, amount FROM payments").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "currency", "amount"}).
+			AddRow(1, "EUR", "1.5").
+			AddRow(2, "EUR", "2.25"))
+
+	currency, sum, err := SumSingleCurrency[paymentRow](uw, "currency", "amount", "SELECT id, currency, amount FROM payments")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Currency("EUR"), currency)
+	assert.Equal(t, "3.75", sum.String())
+}
+
+func TestShouldRejectFloatAmounts(t *testing.T) {
+	type floatRow struct {
+		Currency string  `db:"currency"`
+		Amount   float64 `db:"amount"`
+	}
+	uw, mock := newMockUnitOfWork(t)
+
+	mock.ExpectQuery("SELECT currency, amount FROM payments").
+		WillReturnRows(sqlmock.NewRows([]string{"currency", "amount"}).AddRow("USD", 0.1))
+
+	_, err := SumByCurrency[floatRow](uw, "currency", "amount", "SELECT currency, amount FROM payments")
+	assert.NotNil(t, err)
+}
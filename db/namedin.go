@@ -0,0 +1,327 @@
+package db
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrTooManyParameters is returned when expanding the lists of a named query
+// would give it more bindvars than the database accepts.
+var ErrTooManyParameters = errors.New("db: too many parameters")
+
+// NamedIn binds a named query for the driver of uow like NamedQuery does,
+// expanding slice arguments into lists, so that WHERE id IN (:ids) gets one
+// bindvar per element. []byte and driver.Valuer arguments are kept whole.
+// Named queries of the unit of work go through it already; use it to build
+// statements run otherwise. Compiled queries are cached, so binding the same
+// query again costs a lookup rather than a parse.
+//
+// Lists too long for the driver are passed to Postgres as arrays, IN (:ids)
+// becoming = ANY($1) and NOT IN (:ids) <> ALL($1). Other databases fail with
+// ErrTooManyParameters; SelectIn splits such queries instead.
+func NamedIn(uow UnitOfWork, query string, arg interface{}) (string, []interface{}, error) {
+	bindType := sqlx.BindType(uow.DriverName())
+	dialect := DialectFor(uow.DriverName())
+
+	plan, err := namedPlanFor(query, bindType)
+	if err != nil {
+		return "", nil, err
+	}
+	args, err := plan.bind(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lists := false
+	for _, a := range args {
+		if _, ok := listOf(a); ok {
+			lists = true
+			break
+		}
+	}
+	if !lists {
+		return plan.query, args, nil
+	}
+
+	if n, max := expandedLen(args), maxParameters(dialect); n > max {
+		if dialect != DialectPostgres {
+			return "", nil, fmt.Errorf("%w: %d list elements, %s accepts %d", ErrTooManyParameters, n, dialect, max)
+		}
+		return expandIn(dialect, bindType, plan.question, args, true)
+	}
+	return expandIn(dialect, bindType, plan.question, args, false)
+}
+
+// SelectIn runs a named query into dest, a pointer to a slice, expanding
+// slice arguments like NamedIn. When the expanded lists are too long for the
+// driver and cannot be passed as arrays, the longest list is split and the
+// query run once per part, the rows of every run being appended to dest.
+//
+// A split query must only filter rows: it is refused when it has OR, NOT IN
+// on the split list, grouping, aggregates, DISTINCT, set operations, ORDER BY
+// or limits, whose results differ when computed per part. Repeated elements
+// of the split list are dropped. The runs are separate statements; run them
+// in a transaction to read a single snapshot.
+func SelectIn(uow UnitOfWork, dest interface{}, query string, arg interface{}) error {
+	bound, args, err := NamedIn(uow, query, arg)
+	if err == nil {
+		return uow.Select(dest, bound, args...)
+	}
+	if !errors.Is(err, ErrTooManyParameters) {
+		return err
+	}
+
+	if v := reflect.ValueOf(dest); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("db: SelectIn needs a pointer to a slice, not %T", dest)
+	}
+
+	bindType := sqlx.BindType(uow.DriverName())
+	dialect := DialectFor(uow.DriverName())
+	plan, err := namedPlanFor(query, bindType)
+	if err != nil {
+		return err
+	}
+	if args, err = plan.bind(arg); err != nil {
+		return err
+	}
+
+	longest, size := -1, 0
+	for i, a := range args {
+		if list, ok := listOf(a); ok && list.Len() > size {
+			longest, size = i, list.Len()
+		}
+	}
+	if err := splittable(dialect, plan.question, longest); err != nil {
+		return err
+	}
+
+	chunk := maxParameters(dialect) - (expandedLen(args) - size)
+	if chunk < 1 {
+		return fmt.Errorf("%w: the other parameters leave no room for %s", ErrTooManyParameters, plan.names[longest])
+	}
+
+	var elements []interface{}
+	seen := map[string]bool{}
+	list, _ := listOf(args[longest])
+	for i := 0; i < list.Len(); i++ {
+		element := list.Index(i).Interface()
+		if key := valueKey(element); !seen[key] {
+			seen[key] = true
+			elements = append(elements, element)
+		}
+	}
+
+	part := append([]interface{}(nil), args...)
+	for start := 0; start < len(elements); start += chunk {
+		end := start + chunk
+		if end > len(elements) {
+			end = len(elements)
+		}
+		part[longest] = elements[start:end]
+
+		bound, flat, err := expandIn(dialect, bindType, plan.question, part, false)
+		if err != nil {
+			return err
+		}
+		// sqlx appends to the slice dest points to
+		if err := uow.Select(dest, bound, flat...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBlockers are the keywords making the rows of a query depend on more
+// than each row matching the split list, OVER and WINDOW among them for window
+// functions, and splitAggregates the functions doing so when called.
+var (
+	splitBlockers   = []string{"or", "group", "having", "distinct", "union", "intersect", "except", "order", "limit", "offset", "fetch", "top", "over", "window"}
+	splitAggregates = []string{
+		"count", "sum", "avg", "min", "max",
+		"array_agg", "string_agg", "json_agg", "jsonb_agg", "json_object_agg", "jsonb_object_agg", "xmlagg", "group_concat",
+		"bool_and", "bool_or", "every", "bit_and", "bit_or", "bit_xor",
+		"stddev", "stddev_pop", "stddev_samp", "variance", "var_pop", "var_samp",
+	}
+)
+
+// splittable checks that the query, with ? placeholders, can be split on its
+// n-th placeholder.
+func splittable(dialect Dialect, query string, n int) error {
+	placeholder := -1
+	tokens := lexSQLFor(dialect, query)
+	for i, token := range tokens {
+		for _, keyword := range splitBlockers {
+			if token.is(keyword) {
+				return fmt.Errorf("%w: cannot split a query with %s", ErrTooManyParameters, strings.ToUpper(keyword))
+			}
+		}
+		for _, aggregate := range splitAggregates {
+			if token.is(aggregate) && i+1 < len(tokens) && isPunct(tokens[i+1], "(") {
+				return fmt.Errorf("%w: cannot split a query with %s()", ErrTooManyParameters, strings.ToUpper(aggregate))
+			}
+		}
+		if token.kind == sqlPlaceholder && token.text == "?" {
+			if placeholder++; placeholder == n {
+				if _, negated, ok := inListAt(tokens, i); !ok || negated {
+					return fmt.Errorf("%w: cannot split a list outside of IN (...)", ErrTooManyParameters)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// inListAt reports whether the placeholder tokens[i] is the whole list of an
+// IN (...), returning the first token of the predicate after the column and
+// whether it is NOT IN.
+func inListAt(tokens []sqlToken, i int) (first int, negated bool, ok bool) {
+	if i < 2 || i+1 >= len(tokens) || !tokens[i-2].is("in") ||
+		!isPunct(tokens[i-1], "(") || !isPunct(tokens[i+1], ")") {
+		return 0, false, false
+	}
+	if i >= 3 && tokens[i-3].is("not") {
+		return i - 3, true, true
+	}
+	return i - 2, false, true
+}
+
+func isPunct(t sqlToken, text string) bool {
+	return t.kind == sqlPunct && t.text == text
+}
+
+// maxParameters is the number of bindvars a statement may have: 65535 for
+// Postgres and MySQL, 32766 for SQLite since 3.32 and 2100, the SQL Server
+// limit, for other databases.
+func maxParameters(dialect Dialect) int {
+	switch dialect {
+	case DialectPostgres, DialectMySQL:
+		return 65535
+	case DialectSQLite:
+		return 32766
+	default:
+		return 2100
+	}
+}
+
+// expandedLen is the number of bindvars args expand to.
+func expandedLen(args []interface{}) int {
+	n := 0
+	for _, a := range args {
+		if list, ok := listOf(a); ok {
+			n += list.Len()
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// expandIn replaces the ? placeholders of query by bindvars of bindType, as
+// many as elements for those bound to slices. Unlike sqlx.In and
+// sqlx.Rebind, question marks in strings and comments are left alone. With
+// arrays, slices making up an IN list are bound whole as Postgres arrays.
+func expandIn(dialect Dialect, bindType int, query string, args []interface{}, arrays bool) (string, []interface{}, error) {
+	var b strings.Builder
+	var flat []interface{}
+	bindvar := func() {
+		switch bindType {
+		case sqlx.DOLLAR:
+			fmt.Fprintf(&b, "$%d", len(flat))
+		case sqlx.NAMED:
+			fmt.Fprintf(&b, ":arg%d", len(flat))
+		case sqlx.AT:
+			fmt.Fprintf(&b, "@p%d", len(flat))
+		default:
+			b.WriteString("?")
+		}
+	}
+
+	tokens := lexSQLFor(dialect, query)
+	last, n := 0, 0
+	for i, token := range tokens {
+		if token.kind != sqlPlaceholder || token.text != "?" {
+			continue
+		}
+		if n >= len(args) {
+			return "", nil, fmt.Errorf("db: more placeholders than the %d arguments", len(args))
+		}
+
+		list, ok := listOf(args[n])
+		n++
+		if !ok {
+			b.WriteString(query[last:token.start])
+			last = token.end
+			flat = append(flat, args[n-1])
+			bindvar()
+			continue
+		}
+		if list.Len() == 0 {
+			return "", nil, fmt.Errorf("db: empty list for placeholder %d", n)
+		}
+
+		if first, negated, in := inListAt(tokens, i); arrays && in {
+			b.WriteString(query[last:tokens[first].start])
+			last = tokens[i+1].end
+
+			array := make(pgArray, list.Len())
+			for j := range array {
+				array[j] = list.Index(j).Interface()
+			}
+			flat = append(flat, array)
+			if negated {
+				b.WriteString("<> ALL(")
+			} else {
+				b.WriteString("= ANY(")
+			}
+			bindvar()
+			b.WriteString(")")
+			continue
+		}
+
+		b.WriteString(query[last:token.start])
+		last = token.end
+		for j := 0; j < list.Len(); j++ {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			flat = append(flat, list.Index(j).Interface())
+			bindvar()
+		}
+	}
+	b.WriteString(query[last:])
+
+	return b.String(), flat, nil
+}
+
+// rebind is Rebind for driver leaving question marks in strings and
+// comments alone, like expandIn.
+func rebind(driver, query string) string {
+	dialect := DialectFor(driver)
+	n := 0
+	for _, token := range lexSQLFor(dialect, query) {
+		if token.kind == sqlPlaceholder && token.text == "?" {
+			n++
+		}
+	}
+	// nil arguments are never expanded, and are as many as the
+	// placeholders: expandIn cannot fail
+	bound, _, _ := expandIn(dialect, sqlx.BindType(driver), query, make([]interface{}, n), false)
+	return bound
+}
+
+// listOf returns arg as a slice to expand, ok being false for scalars.
+func listOf(arg interface{}) (reflect.Value, bool) {
+	if _, ok := arg.(driver.Valuer); ok || arg == nil {
+		return reflect.Value{}, false
+	}
+	v := reflect.Indirect(reflect.ValueOf(arg))
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"time"
+
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldExpandNamedSliceArguments(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	uow := NewUnitOfWork(database, nil)
+
+	query, args, err := NamedIn(uow, "SELECT id FROM orders WHERE note <> '?' AND status = :status AND id IN (:ids)",
+		map[string]interface{}{"status": "open", "ids": []int64{3, 5, 8}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM orders WHERE note <> '?' AND status = $1 AND id IN ($2, $3, $4)", query)
+	assert.Equal(t, []interface{}{"open", int64(3), int64(5), int64(8)}, args)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldKeepBytesAndScalarsWhole(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	query, args, err := NamedIn(uow, "SELECT id FROM files WHERE digest = :digest", map[string]interface{}{"digest": []byte{1, 2}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM files WHERE digest = ?", query)
+	assert.Equal(t, []interface{}{[]byte{1, 2}}, args)
+}
+
+func TestShouldRejectEmptyLists(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	_, _, err := NamedIn(uow, "SELECT id FROM orders WHERE id IN (:ids)", map[string]interface{}{"ids": []int64{}})
+
+	assert.EqualError(t, err, "db: empty list for placeholder 1")
+}
+
+func TestShouldExpandSlicesInNamedQueries(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE id IN \(\?, \?\)$`).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+
+	type filter struct {
+		IDs []int `db:"ids"`
+	}
+	rows, err := uow.NamedQuery("SELECT id, status FROM orders WHERE id IN (:ids)", filter{IDs: []int{1, 2}})
+
+	assert.Nil(t, err)
+	rows.Close()
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldPassOversizedListsToPostgresAsArrays(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+	uow := NewUnitOfWork(database, nil)
+	ids := make([]int64, 70000)
+	for i := range ids {
+		ids[i] = int64(i)
+	}
+
+	query, args, err := NamedIn(uow, "SELECT id FROM orders WHERE status = :status AND id IN (:ids) AND customer_id NOT IN (:blocked)",
+		map[string]interface{}{"status": "open", "ids": ids, "blocked": []int64{7, 9}})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM orders WHERE status = $1 AND id = ANY($2) AND customer_id <> ALL($3)", query)
+	assert.Len(t, args, 3)
+	assert.Len(t, args[1], 70000)
+	assert.Equal(t, pgArray{int64(7), int64(9)}, args[2])
+}
+
+func TestShouldWriteArrayElementsInTheirTextFormat(t *testing.T) {
+	at := time.Date(2024, 3, 1, 10, 30, 0, 500, time.UTC)
+	value, err := pgArray{int64(7), 2.5, true, nil, `say "hi" \ bye`, []byte{0xde, 0xad}, at, sql.NullString{String: "ok", Valid: true}, sql.NullString{}}.Value()
+
+	assert.Nil(t, err)
+	assert.Equal(t, `{7,2.5,true,NULL,"say \"hi\" \\ bye","\\xdead","2024-03-01 10:30:00.0000005Z","ok",NULL}`, value)
+}
+
+func TestShouldRefuseOversizedListsElsewhere(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	_, _, err := NamedIn(uow, "SELECT id FROM orders WHERE id IN (:ids)", map[string]interface{}{"ids": make([]int, 2101)})
+
+	assert.ErrorIs(t, err, ErrTooManyParameters)
+	assert.EqualError(t, err, "db: too many parameters: 2101 list elements, ansi accepts 2100")
+}
+
+func TestShouldSplitOversizedListsOfSelectIn(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	ids := make([]int, 0, 2600)
+	for i := 1; i <= 2500; i++ {
+		ids = append(ids, i)
+	}
+	ids = append(ids, ids[:100]...)
+
+	first := make([]driver.Value, 0, 2100)
+	first = append(first, "open")
+	for _, id := range ids[:2099] {
+		first = append(first, id)
+	}
+	second := []driver.Value{"open"}
+	for _, id := range ids[2099:2500] {
+		second = append(second, id)
+	}
+	mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT id, status FROM orders WHERE status = ? AND id IN (?"+strings.Repeat(", ?", 2098)+")") + "$").
+		WithArgs(first...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+	mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT id, status FROM orders WHERE status = ? AND id IN (?"+strings.Repeat(", ?", 400)+")") + "$").
+		WithArgs(second...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(2400, "open"))
+
+	var orders []repositoryOrder
+	err := SelectIn(uow, &orders, "SELECT id, status FROM orders WHERE status = :status AND id IN (:ids)",
+		map[string]interface{}{"status": "open", "ids": ids})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []repositoryOrder{{ID: 1, Status: "open"}, {ID: 2400, Status: "open"}}, orders)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSelectInWithoutSplittingShortLists(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE id IN \(\?, \?\) ORDER BY id$`).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+
+	var orders []repositoryOrder
+	err := SelectIn(uow, &orders, "SELECT id, status FROM orders WHERE id IN (:ids) ORDER BY id", map[string]interface{}{"ids": []int{1, 2}})
+
+	assert.Nil(t, err)
+	assert.Len(t, orders, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseToSplitQueriesDependingOnOtherRows(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+	arg := map[string]interface{}{"ids": make([]int, 3000)}
+
+	var orders []repositoryOrder
+	for query, message := range map[string]string{
+		"SELECT id, status FROM orders WHERE id IN (:ids) ORDER BY id":                                 "db: too many parameters: cannot split a query with ORDER",
+		"SELECT id, status FROM orders WHERE id IN (:ids) OR status = 'open'":                          "db: too many parameters: cannot split a query with OR",
+		"SELECT COUNT(*) AS id, '' AS status FROM orders WHERE id IN (:ids)":                           "db: too many parameters: cannot split a query with COUNT()",
+		"SELECT id, status FROM orders WHERE id NOT IN (:ids)":                                         "db: too many parameters: cannot split a list outside of IN (...)",
+		"SELECT 0 AS id, string_agg(status, ',') AS status FROM orders WHERE id IN (:ids)":             "db: too many parameters: cannot split a query with STRING_AGG()",
+		"SELECT 0 AS id, array_agg(status)::text AS status FROM orders WHERE id IN (:ids)":             "db: too many parameters: cannot split a query with ARRAY_AGG()",
+		"SELECT id, json_agg(status)::text AS status FROM orders WHERE id IN (:ids)":                   "db: too many parameters: cannot split a query with JSON_AGG()",
+		"SELECT 0 AS id, bool_or(status = 'paid')::text AS status FROM orders WHERE id IN (:ids)":      "db: too many parameters: cannot split a query with BOOL_OR()",
+		"SELECT id, lag(status) OVER (PARTITION BY customer) AS status FROM orders WHERE id IN (:ids)": "db: too many parameters: cannot split a query with OVER",
+	} {
+		err := SelectIn(uow, &orders, query, arg)
+
+		assert.EqualError(t, err, message, query)
+	}
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// maxNamedPlans bounds the plan cache. Queries are expected to come from a
+// bounded set of shapes; when they do not, the cache is dropped and refilled
+// rather than growing without limit.
+const maxNamedPlans = 1024
+
+type namedPlanKey struct {
+	query    string
+	bindType int
+}
+
+// namedPlans caches compiled named queries by text and bind type.
+var namedPlans = struct {
+	sync.RWMutex
+	plans map[namedPlanKey]*namedPlan
+}{plans: map[namedPlanKey]*namedPlan{}}
+
+// namedPlan is a named query compiled once: the query with bindvars of its
+// bind type, the same query with ? bindvars for expandIn, and the names to
+// bind in order. Field traversals are remembered per struct type, so binding
+// the same kind of argument again does no reflection on the type.
+type namedPlan struct {
+	query    string
+	question string
+	names    []string
+
+	mu         sync.RWMutex
+	traversals map[reflect.Type][][]int
+}
+
+// namedPlanFor returns the cached plan of query for bindType, compiling it on
+// first use.
+func namedPlanFor(query string, bindType int) (*namedPlan, error) {
+	key := namedPlanKey{query: query, bindType: bindType}
+
+	namedPlans.RLock()
+	plan, ok := namedPlans.plans[key]
+	namedPlans.RUnlock()
+	if ok {
+		return plan, nil
+	}
+
+	bound, names, err := compileNamed(query, bindType)
+	if err != nil {
+		return nil, err
+	}
+	question := bound
+	if bindType != sqlx.QUESTION && bindType != sqlx.UNKNOWN {
+		if question, _, err = compileNamed(query, sqlx.QUESTION); err != nil {
+			return nil, err
+		}
+	}
+	plan = &namedPlan{query: bound, question: question, names: names, traversals: map[reflect.Type][][]int{}}
+
+	namedPlans.Lock()
+	if len(namedPlans.plans) >= maxNamedPlans {
+		namedPlans.plans = map[namedPlanKey]*namedPlan{}
+	}
+	namedPlans.plans[key] = plan
+	namedPlans.Unlock()
+
+	return plan, nil
+}
+
+// bind returns the arguments of the plan names taken from arg, a
+// map[string]interface{} or a struct. Other arguments are left to sqlx, which
+// reports them.
+func (p *namedPlan) bind(arg interface{}) ([]interface{}, error) {
+	if m, ok := arg.(map[string]interface{}); ok {
+		args := make([]interface{}, len(p.names))
+		for i, name := range p.names {
+			v, ok := m[name]
+			if !ok {
+				return nil, fmt.Errorf("could not find name %s in %#v", name, arg)
+			}
+			args[i] = v
+		}
+		return args, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		_, args, err := sqlx.Named(p.question, arg)
+		return args, err
+	}
+
+	traversals, err := p.traversalsOf(v.Type(), arg)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, len(traversals))
+	for i, t := range traversals {
+		args[i] = reflectx.FieldByIndexesReadOnly(v, t).Interface()
+	}
+	return args, nil
+}
+
+func (p *namedPlan) traversalsOf(t reflect.Type, arg interface{}) ([][]int, error) {
+	p.mu.RLock()
+	traversals, ok := p.traversals[t]
+	p.mu.RUnlock()
+	if ok {
+		return traversals, nil
+	}
+
+	traversals = mapper.TraversalsByName(t, p.names)
+	for i, traversal := range traversals {
+		if len(traversal) == 0 {
+			return nil, fmt.Errorf("could not find name %s in %#v", p.names[i], arg)
+		}
+	}
+
+	p.mu.Lock()
+	p.traversals[t] = traversals
+	p.mu.Unlock()
+	return traversals, nil
+}
+
+// compileNamed turns the :name parameters of query into bindvars of bindType
+// and returns their names. It follows the sqlx compiler, which is not
+// exported, byte for byte: :: escapes a colon and := is kept as is.
+func compileNamed(query string, bindType int) (string, []string, error) {
+	var names []string
+	rebound := make([]byte, 0, len(query))
+
+	inName := false
+	last := len(query) - 1
+	currentVar := 1
+	var name []byte
+
+	for i := 0; i < len(query); i++ {
+		b := query[i]
+		switch {
+		case b == ':':
+			if inName && i > 0 && query[i-1] == ':' {
+				rebound = append(rebound, ':')
+				inName = false
+				continue
+			} else if inName {
+				return "", nil, errors.New("unexpected `:` while reading named param at " + strconv.Itoa(i))
+			}
+			inName = true
+			name = name[:0]
+		case inName && i > 0 && b == '=':
+			rebound = append(rebound, ':', '=')
+			inName = false
+		case inName && (isBindRune(b) || b == '_' || b == '.') && i != last:
+			name = append(name, b)
+		case inName:
+			inName = false
+			if i == last && isBindRune(b) {
+				name = append(name, b)
+			}
+			names = append(names, string(name))
+
+			switch bindType {
+			case sqlx.NAMED:
+				rebound = append(rebound, ':')
+				rebound = append(rebound, name...)
+			case sqlx.QUESTION, sqlx.UNKNOWN:
+				rebound = append(rebound, '?')
+			case sqlx.DOLLAR:
+				rebound = append(rebound, '$')
+				rebound = strconv.AppendInt(rebound, int64(currentVar), 10)
+				currentVar++
+			case sqlx.AT:
+				rebound = append(rebound, '@', 'p')
+				rebound = strconv.AppendInt(rebound, int64(currentVar), 10)
+				currentVar++
+			}
+
+			if i != last || !isBindRune(b) {
+				rebound = append(rebound, b)
+			}
+		default:
+			rebound = append(rebound, b)
+		}
+	}
+
+	return string(rebound), names, nil
+}
+
+func isBindRune(b byte) bool {
+	return unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
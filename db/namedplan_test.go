@@ -0,0 +1,99 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCompileNamedQueriesLikeSqlx(t *testing.T) {
+	queries := []string{
+		"SELECT * FROM orders WHERE id = :id",
+		"SELECT * FROM orders WHERE id = :id AND status = :status",
+		"SELECT :a::text, :b",
+		"SELECT 'x:y' || :name_1",
+		"UPDATE t SET x := :x WHERE y = :y",
+		"INSERT INTO t (a) VALUES (:a)",
+		"SELECT :a",
+		"SELECT :_",
+	}
+	arg := map[string]interface{}{"id": 1, "status": "open", "a": 1, "b": 2, "name_1": "n", "x": 3, "y": 4, "": 0}
+
+	for _, bindType := range []int{sqlx.QUESTION, sqlx.DOLLAR, sqlx.NAMED, sqlx.AT} {
+		for _, query := range queries {
+			want, wantArgs, wantErr := sqlx.BindNamed(bindType, query, arg)
+
+			plan, err := namedPlanFor(query, bindType)
+			assert.Equal(t, wantErr, err, query)
+			if err != nil {
+				continue
+			}
+			args, err := plan.bind(arg)
+
+			assert.Nil(t, err, query)
+			assert.Equal(t, want, plan.query, query)
+			assert.Equal(t, wantArgs, args, query)
+		}
+	}
+}
+
+func TestShouldReuseCompiledPlans(t *testing.T) {
+	first, err := namedPlanFor("SELECT id FROM orders WHERE status = :status", sqlx.DOLLAR)
+	assert.Nil(t, err)
+	second, err := namedPlanFor("SELECT id FROM orders WHERE status = :status", sqlx.DOLLAR)
+	assert.Nil(t, err)
+	question, err := namedPlanFor("SELECT id FROM orders WHERE status = :status", sqlx.QUESTION)
+	assert.Nil(t, err)
+
+	assert.Same(t, first, second)
+	assert.NotSame(t, first, question)
+	assert.Equal(t, "SELECT id FROM orders WHERE status = $1", first.query)
+	assert.Equal(t, "SELECT id FROM orders WHERE status = ?", first.question)
+}
+
+func TestShouldRememberStructTraversals(t *testing.T) {
+	type filter struct {
+		Status string `db:"status"`
+		Min    int    `db:"min"`
+	}
+	plan, err := namedPlanFor("SELECT id FROM orders WHERE status = :status AND total >= :min", sqlx.QUESTION)
+	assert.Nil(t, err)
+
+	args, err := plan.bind(&filter{Status: "open", Min: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"open", 10}, args)
+
+	args, err = plan.bind(filter{Status: "paid", Min: 20})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"paid", 20}, args)
+	assert.Len(t, plan.traversals, 1)
+	assert.Contains(t, plan.traversals, reflect.TypeOf(filter{}))
+}
+
+func TestShouldReportMissingNames(t *testing.T) {
+	type filter struct {
+		Status string `db:"status"`
+	}
+	plan, err := namedPlanFor("SELECT id FROM orders WHERE id = :id", sqlx.QUESTION)
+	assert.Nil(t, err)
+
+	_, err = plan.bind(map[string]interface{}{"status": "open"})
+	assert.EqualError(t, err, `could not find name id in map[string]interface {}{"status":"open"}`)
+
+	_, err = plan.bind(filter{})
+	assert.EqualError(t, err, `could not find name id in db.filter{Status:""}`)
+	assert.Empty(t, plan.traversals)
+}
+
+func TestShouldBoundThePlanCache(t *testing.T) {
+	for i := 0; i <= maxNamedPlans; i++ {
+		_, err := namedPlanFor("SELECT :a", i)
+		assert.Nil(t, err)
+	}
+
+	namedPlans.RLock()
+	defer namedPlans.RUnlock()
+	assert.LessOrEqual(t, len(namedPlans.plans), maxNamedPlans)
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrStaleObject is returned when an entity is updated from a version of its
+// row that is no longer current: another transaction updated or deleted it
+// since it was read.
+var ErrStaleObject = errors.New("db: stale object")
+
+// UpdateVersioned writes every non-key column of entity, a pointer to a
+// registered model with a version column, tagged e.g. `db:"version,version"`.
+// The update only applies to the row at the version of entity, and bumps it:
+//
+//	UPDATE orders SET status = :status, version = version + 1
+//	WHERE id = :id AND version = :version
+//
+// When no row matches it returns ErrStaleObject and leaves entity as it was;
+// otherwise the version of entity is bumped as well, and put back if the
+// transaction of uow, or its savepoint, rolls back. Repository.Update does
+// the same for models with a version column. Conflicts are best handled by
+// retrying the whole transaction, see RetryPolicy.RetryStale.
+func UpdateVersioned(uow UnitOfWork, entity interface{}) error {
+	m, err := ModelOf(entity)
+	if err != nil {
+		return err
+	}
+	if m.Version == "" {
+		return fmt.Errorf("db: %s has no version column", m.Type)
+	}
+	return m.updateVersioned(uow, versionedUpdate(m), entity, nil)
+}
+
+// versionedUpdate renders the UPDATE statement of UpdateVersioned for m.
+func versionedUpdate(m *Model) string {
+	var assignments []string
+	for _, c := range m.NonKeyColumns() {
+		if c != m.Version {
+			assignments = append(assignments, c+" = :"+c)
+		}
+	}
+	assignments = append(assignments, m.Version+" = "+m.Version+" + 1")
+
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s = :%s AND %s = :%s",
+		m.Table, strings.Join(assignments, ", "), m.Key, m.Key, m.Version, m.Version)
+}
+
+// updateVersioned runs query, a versionedUpdate of m, for entity and the
+// extra arguments of the query, if any.
+func (m *Model) updateVersioned(uow UnitOfWork, query string, entity interface{}, extra map[string]interface{}) error {
+	version := m.Field(entity, m.Version)
+
+	// the checksum covers the row as stored, at its next version
+	addToInteger(version, 1)
+	err := m.Seal(entity)
+	addToInteger(version, -1)
+	if err != nil {
+		return err
+	}
+
+	result, err := uow.NamedExec(query, m.namedArg(entity, extra))
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s %v at version %v", ErrStaleObject, m.Table, m.KeyOf(entity), version.Interface())
+	}
+
+	addToInteger(version, 1)
+	if u, ok := uow.(*unitOfWork); ok {
+		u.onRollback(func() { addToInteger(version, -1) })
+	}
+	return nil
+}
+
+func isInteger(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func addToInteger(v reflect.Value, delta int64) {
+	if v.CanInt() {
+		v.SetInt(v.Int() + delta)
+	} else {
+		v.SetUint(uint64(int64(v.Uint()) + delta))
+	}
+}
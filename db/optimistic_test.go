@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedInvoice struct {
+	ID      int64  `db:"id"`
+	Status  string `db:"status"`
+	Version int64  `db:"version,version"`
+}
+
+func init() {
+	MustRegister(versionedInvoice{}, "versioned_invoices")
+}
+
+const versionedInvoiceUpdate = "UPDATE versioned_invoices SET status = ?, version = version + 1 WHERE id = ? AND version = ?"
+
+func TestShouldUpdateOnlyTheVersionRead(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec(regexp.QuoteMeta(versionedInvoiceUpdate)).WithArgs("paid", 1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(versionedInvoiceUpdate)).WithArgs("void", 1, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+	uow := NewUnitOfWork(database, nil)
+
+	invoice := versionedInvoice{ID: 1, Status: "paid", Version: 3}
+	assert.Nil(t, UpdateVersioned(uow, &invoice))
+	assert.Equal(t, int64(4), invoice.Version)
+
+	invoice.Status = "void"
+	err := UpdateVersioned(uow, &invoice)
+	assert.ErrorIs(t, err, ErrStaleObject)
+	assert.EqualError(t, err, "db: stale object: versioned_invoices 1 at version 4")
+	assert.Equal(t, int64(4), invoice.Version)
+
+	assert.EqualError(t, UpdateVersioned(uow, &repositoryOrder{ID: 1}), "db: db.repositoryOrder has no version column")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRetryTransactionsWritingStaleEntities(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	for version := 3; version <= 4; version++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery("^SELECT id, status, version FROM versioned_invoices WHERE id = \\?$").WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "version"}).AddRow(1, "open", version))
+		mock.ExpectExec(regexp.QuoteMeta(versionedInvoiceUpdate)).WithArgs("paid", 1, version).
+			WillReturnResult(sqlmock.NewResult(0, int64(version-3)))
+		if version == 3 {
+			mock.ExpectRollback()
+		} else {
+			mock.ExpectCommit()
+		}
+	}
+
+	repository, err := NewRepository[versionedInvoice]()
+	assert.Nil(t, err)
+	uow := NewUnitOfWork(database, nil, WithRetryPolicy(RetryPolicy{RetryStale: true, Backoff: func(int) time.Duration { return 0 }}))
+
+	result, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		invoice, err := repository.Find(tx, 1)
+		if err != nil {
+			return nil, err
+		}
+		invoice.Status = "paid"
+		return invoice, repository.Update(tx, &invoice)
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, versionedInvoice{ID: 1, Status: "paid", Version: 5}, result)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldPutBackTheVersionOfUpdatesRolledBack(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(versionedInvoiceUpdate)).WithArgs("paid", 1, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(versionedInvoiceUpdate)).WithArgs("void", 1, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	invoice := versionedInvoice{ID: 1, Status: "paid", Version: 3}
+	failed := errors.New("declined")
+	_, err := NewUnitOfWork(database, nil).InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		assert.Nil(t, UpdateVersioned(tx, &invoice))
+		_, err := tx.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+			invoice.Status = "void"
+			assert.Nil(t, UpdateVersioned(tx, &invoice))
+			assert.Equal(t, int64(5), invoice.Version)
+			return nil, failed
+		})
+		assert.ErrorIs(t, err, failed)
+		assert.Equal(t, int64(4), invoice.Version)
+		return nil, failed
+	})
+
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, int64(3), invoice.Version)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRequireIntegerVersionColumns(t *testing.T) {
+	type textVersion struct {
+		ID      int64  `db:"id"`
+		Version string `db:"version,version"`
+	}
+
+	_, err := Register(textVersion{}, "text_versions")
+
+	assert.EqualError(t, err, "db: version column version of db.textVersion must be an integer")
+}
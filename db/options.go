@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Option configures a UnitOfWork at construction time.
+type Option func(*unitOfWork)
+
+// WithContext sets the context used by methods that do not take one, so
+// request-scoped values and deadlines reach every statement and interceptor.
+func WithContext(ctx context.Context) Option {
+	return func(u *unitOfWork) {
+		u.ctx = ctx
+	}
+}
+
+// WithInterceptors appends interceptors to the statement chain. The first
+// interceptor given is the outermost.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(u *unitOfWork) {
+		u.interceptors = append(u.interceptors, interceptors...)
+	}
+}
+
+// WithTxOptions sets the isolation level and read-only flag of the
+// transactions InTransaction begins. Drivers fail on levels they do not
+// support.
+func WithTxOptions(opts *sql.TxOptions) Option {
+	return func(u *unitOfWork) {
+		u.txOptions = opts
+	}
+}
+
+func (u *unitOfWork) apply(opts []Option) {
+	for _, opt := range opts {
+		opt(u)
+	}
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrUnorderedPagination is returned in strict mode for queries paginating
+// with LIMIT, OFFSET, FETCH or TOP without an ORDER BY, whose pages the
+// database is free to return in any order.
+var ErrUnorderedPagination = errors.New("db: pagination without ORDER BY")
+
+// OrderingInterceptor flags Query and Select statements that paginate without
+// an ORDER BY at the same nesting level. It logs them, or fails them with
+// ErrUnorderedPagination when strict is set; it is meant for development and
+// CI, where nondeterministic pagination shows up before it bites.
+func OrderingInterceptor(strict bool) Interceptor {
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		if stmt.Kind == KindQuery || stmt.Kind == KindSelect {
+			if unorderedPagination(lexSQLFor(DialectFor(stmt.Driver), stmt.Query)) {
+				if strict {
+					return fmt.Errorf("%w: %s", ErrUnorderedPagination, stmt.Query)
+				}
+				Logger().WarnContext(ctx, "db: pagination without ORDER BY", "query", stmt.Query)
+			}
+		}
+
+		return next(ctx, stmt)
+	}
+}
+
+// unorderedPagination reports whether any query level of tokens limits its
+// rows without ordering them.
+func unorderedPagination(tokens []sqlToken) bool {
+	type scope struct{ ordered, paginated bool }
+	scopes := []scope{{}}
+
+	for i, t := range tokens {
+		current := &scopes[len(scopes)-1]
+
+		switch {
+		case t.text == "(":
+			scopes = append(scopes, scope{})
+		case t.text == ")":
+			if len(scopes) > 1 {
+				if current.paginated && !current.ordered {
+					return true
+				}
+				scopes = scopes[:len(scopes)-1]
+			}
+		case t.is("order") && i+1 < len(tokens) && tokens[i+1].is("by"):
+			current.ordered = true
+		case t.is("limit") || t.is("offset") || t.is("fetch") || t.is("top"):
+			current.paginated = true
+		}
+	}
+
+	return scopes[0].paginated && !scopes[0].ordered
+}
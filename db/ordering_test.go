@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldDetectPaginationWithoutOrderBy(t *testing.T) {
+	for query, unordered := range map[string]bool{
+		"SELECT id FROM orders LIMIT 10":                                             true,
+		"SELECT id FROM orders OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY":               true,
+		"SELECT TOP 5 id FROM orders":                                                true,
+		"SELECT id FROM orders ORDER BY id LIMIT 10":                                 false,
+		"SELECT id FROM orders WHERE note = 'limit 1'":                               false,
+		"SELECT id FROM orders":                                                      false,
+		"SELECT * FROM (SELECT id FROM orders LIMIT 5) o ORDER BY id":                true,
+		"SELECT * FROM (SELECT id FROM orders ORDER BY id LIMIT 5) o":                false,
+		"SELECT id, row_number() OVER (ORDER BY id) FROM orders LIMIT 3":             true,
+		"SELECT id FROM a UNION SELECT id FROM b ORDER BY id LIMIT 10":               false,
+		"SELECT id FROM orders WHERE id IN (SELECT order_id FROM items) ORDER BY id": false,
+	} {
+		assert.Equal(t, unordered, unorderedPagination(lexSQL(query)), query)
+	}
+}
+
+func TestShouldFailUnorderedPaginationInStrictMode(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	uow := NewUnitOfWork(sqlx.NewDb(conn, "sqlmock"), nil, WithInterceptors(OrderingInterceptor(true)))
+
+	var ids []int
+	err = uow.Select(&ids, "SELECT id FROM orders LIMIT 10")
+	assert.True(t, errors.Is(err, ErrUnorderedPagination))
+
+	mock.ExpectQuery("SELECT id FROM orders ORDER BY id LIMIT 10").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders ORDER BY id LIMIT 10"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldOnlyLogUnorderedPaginationOutsideStrictMode(t *testing.T) {
+	stmt := &Statement{Kind: KindQuery, Query: "SELECT id FROM orders LIMIT 10"}
+	called := false
+
+	err := OrderingInterceptor(false)(context.Background(), stmt, func(context.Context, *Statement) error {
+		called = true
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, called)
+}
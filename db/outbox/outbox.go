@@ -0,0 +1,318 @@
+// Package outbox implements the transactional outbox: messages are written to
+// an outbox table in the transaction of the change they announce, so that
+// they exist if and only if it commits, then dispatched to a broker by a
+// relay polling the table, at least once.
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNotInTransaction is returned by Add outside a transaction, where messages
+// would be written whether or not the change they announce is.
+var ErrNotInTransaction = errors.New("outbox: adding messages requires a transaction")
+
+// Message is a message of the outbox.
+type Message struct {
+	// ID identifies the message; Add assigns a random one when empty.
+	// Messages can be dispatched more than once, so consumers should
+	// deduplicate on it.
+	ID      string
+	Topic   string
+	Key     string
+	Payload []byte
+	Headers map[string]string
+
+	// CreatedAt is set by Add.
+	CreatedAt time.Time
+
+	// Attempts is the number of earlier failed dispatches of the message.
+	Attempts int
+}
+
+// Dispatcher sends a message to the broker, returning once it is accepted.
+// A message it fails is retried after Config.RetryDelay.
+type Dispatcher func(ctx context.Context, message Message) error
+
+// Config configures an Outbox. Table defaults to outbox:
+//
+//	CREATE TABLE outbox (
+//		id            varchar(32)  PRIMARY KEY,
+//		topic         varchar(255) NOT NULL,
+//		message_key   varchar(255) NOT NULL,
+//		payload       bytea        NOT NULL, -- blob on MySQL and SQLite
+//		headers       text         NOT NULL,
+//		created_at    timestamp    NOT NULL,
+//		attempts      integer      NOT NULL,
+//		available_at  timestamp    NOT NULL,
+//		dispatched_at timestamp,
+//		last_error    text
+//	);
+//	CREATE INDEX outbox_pending_idx ON outbox (dispatched_at, available_at);
+type Config struct {
+	Table string
+
+	// BatchSize is the number of messages claimed at once. Zero means 100.
+	BatchSize int
+
+	// PollInterval is the pause between polls finding nothing to dispatch.
+	// Zero means one second. Messages added through the same Outbox wake
+	// its relay once their transaction commits.
+	PollInterval time.Duration
+
+	// ClaimTimeout is how long claimed messages are not claimed again, by
+	// this or another relay. It must exceed the time a batch takes to
+	// dispatch; messages of a relay that crashed are dispatched again once
+	// it passes. Zero means one minute.
+	ClaimTimeout time.Duration
+
+	// RetryDelay is the pause before a failed message is dispatched again.
+	// Zero means ten seconds.
+	RetryDelay time.Duration
+
+	// Options configure the units of work Dispatch and Purge run in; Add
+	// writes in the caller's unit of work instead.
+	Options []db.Option
+}
+
+// Outbox writes messages to the outbox table and relays them.
+type Outbox struct {
+	db     *sqlx.DB
+	config Config
+	wake   chan struct{}
+}
+
+// New creates an outbox over database.
+func New(database *sqlx.DB, config Config) *Outbox {
+	if config.Table == "" {
+		config.Table = "outbox"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.ClaimTimeout <= 0 {
+		config.ClaimTimeout = time.Minute
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 10 * time.Second
+	}
+
+	return &Outbox{db: database, config: config, wake: make(chan struct{}, 1)}
+}
+
+// Add writes messages to the outbox inside the transaction of uow, so they
+// are dispatched if and only if it commits.
+func (o *Outbox) Add(uow db.UnitOfWork, messages ...Message) error {
+	if !db.IsTransactional(uow) {
+		return ErrNotInTransaction
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (id, topic, message_key, payload, headers, created_at, attempts, available_at) "+
+		"VALUES (:id, :topic, :key, :payload, :headers, :now, 0, :now)", o.config.Table)
+	now := time.Now().UTC()
+	for _, m := range messages {
+		if m.ID == "" {
+			id, err := newID()
+			if err != nil {
+				return err
+			}
+			m.ID = id
+		}
+		if m.Payload == nil {
+			m.Payload = []byte{}
+		}
+		headers, err := encodeHeaders(m.Headers)
+		if err != nil {
+			return err
+		}
+
+		row := map[string]interface{}{"id": m.ID, "topic": m.Topic, "key": m.Key, "payload": m.Payload, "headers": headers, "now": now}
+		if _, err := uow.NamedExec(query, row); err != nil {
+			return fmt.Errorf("outbox: adding message %s: %w", m.ID, err)
+		}
+	}
+
+	uow.AfterCommit(func() {
+		select {
+		case o.wake <- struct{}{}:
+		default:
+		}
+	})
+	return nil
+}
+
+// Dispatch claims a batch of pending messages, oldest first, and hands them
+// to dispatch one at a time, marking each dispatched or failed. It returns
+// the number of messages claimed. Relays running concurrently claim
+// different messages; messages are not ordered across relays, nor after a
+// failed one is retried.
+func (o *Outbox) Dispatch(ctx context.Context, dispatch Dispatcher) (int, error) {
+	uow := o.unitOfWork(ctx)
+
+	claimed, err := o.claim(uow)
+	if err != nil {
+		return 0, fmt.Errorf("outbox: claiming messages: %w", err)
+	}
+
+	for _, m := range claimed {
+		// the rest are dispatched again once their claim expires
+		if err := ctx.Err(); err != nil {
+			return len(claimed), err
+		}
+
+		now := time.Now().UTC()
+		if err := dispatch(ctx, m); err != nil {
+			db.Logger().WarnContext(ctx, "outbox: dispatch failed", "id", m.ID, "topic", m.Topic, "attempts", m.Attempts+1, "err", err)
+			query := fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = ?, available_at = ? WHERE id = ?", o.config.Table)
+			if _, err := uow.Exec(uow.Rebind(query), err.Error(), now.Add(o.config.RetryDelay), m.ID); err != nil {
+				return len(claimed), err
+			}
+			continue
+		}
+
+		query := fmt.Sprintf("UPDATE %s SET dispatched_at = ? WHERE id = ?", o.config.Table)
+		if _, err := uow.Exec(uow.Rebind(query), now, m.ID); err != nil {
+			return len(claimed), err
+		}
+	}
+	return len(claimed), nil
+}
+
+// Run dispatches messages until ctx is done, polling the outbox again right
+// away after a full batch, and otherwise after PollInterval or a commit
+// adding messages through o. Failures are logged and retried.
+func (o *Outbox) Run(ctx context.Context, dispatch Dispatcher) error {
+	for {
+		claimed, err := o.Dispatch(ctx, dispatch)
+		if err != nil && ctx.Err() == nil {
+			db.Logger().ErrorContext(ctx, "outbox: relay failed", "table", o.config.Table, "err", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil && claimed == o.config.BatchSize {
+			continue
+		}
+
+		timer := time.NewTimer(o.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Purge deletes the messages dispatched before the given time, returning how
+// many were.
+func (o *Outbox) Purge(ctx context.Context, before time.Time) (int64, error) {
+	uow := o.unitOfWork(ctx)
+	query := fmt.Sprintf("DELETE FROM %s WHERE dispatched_at < ?", o.config.Table)
+
+	result, err := uow.Exec(uow.Rebind(query), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+type claimedRow struct {
+	ID        string    `db:"id"`
+	Topic     string    `db:"topic"`
+	Key       string    `db:"message_key"`
+	Payload   []byte    `db:"payload"`
+	Headers   string    `db:"headers"`
+	CreatedAt time.Time `db:"created_at"`
+	Attempts  int       `db:"attempts"`
+}
+
+// claim takes the oldest available messages for ClaimTimeout, in a
+// transaction of its own.
+func (o *Outbox) claim(uow db.UnitOfWork) ([]Message, error) {
+	result, err := uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		now := time.Now().UTC()
+		query := fmt.Sprintf("SELECT id, topic, message_key, payload, headers, created_at, attempts FROM %s "+
+			"WHERE dispatched_at IS NULL AND available_at <= ? ORDER BY created_at, id LIMIT %d", o.config.Table, o.config.BatchSize)
+		if dialect := db.DialectOf(tx); dialect == db.DialectPostgres || dialect == db.DialectMySQL {
+			query += " FOR UPDATE SKIP LOCKED"
+		}
+
+		var rows []claimedRow
+		if err := tx.Select(&rows, tx.Rebind(query), now); err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return []Message(nil), nil
+		}
+
+		ids := make([]string, len(rows))
+		for i, row := range rows {
+			ids[i] = row.ID
+		}
+		update, args, err := sqlx.In(fmt.Sprintf("UPDATE %s SET available_at = ? WHERE id IN (?)", o.config.Table), now.Add(o.config.ClaimTimeout), ids)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(tx.Rebind(update), args...); err != nil {
+			return nil, err
+		}
+
+		messages := make([]Message, len(rows))
+		for i, row := range rows {
+			headers, err := decodeHeaders(row.Headers)
+			if err != nil {
+				return nil, fmt.Errorf("message %s: %w", row.ID, err)
+			}
+			messages[i] = Message{ID: row.ID, Topic: row.Topic, Key: row.Key, Payload: row.Payload, Headers: headers,
+				CreatedAt: row.CreatedAt, Attempts: row.Attempts}
+		}
+		return messages, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]Message), nil
+}
+
+func (o *Outbox) unitOfWork(ctx context.Context) db.UnitOfWork {
+	return db.NewUnitOfWork(o.db, nil, append([]db.Option{db.WithContext(ctx)}, o.config.Options...)...)
+}
+
+func encodeHeaders(headers map[string]string) (string, error) {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	encoded, err := json.Marshal(headers)
+	return string(encoded), err
+}
+
+func decodeHeaders(encoded string) (map[string]string, error) {
+	headers := map[string]string{}
+	if encoded == "" {
+		return headers, nil
+	}
+	return headers, json.Unmarshal([]byte(encoded), &headers)
+}
+
+func newID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockDatabase(t *testing.T, driver string) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sqlx.NewDb(conn, driver), mock
+}
+
+func TestShouldAddMessagesInTheTransactionOfTheChange(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE orders SET status = 'paid'`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO order_events \(id, topic, message_key, payload, headers, created_at, attempts, available_at\) `+
+		`VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, 0, \$7\)$`).
+		WithArgs(sqlmock.AnyArg(), "orders.paid", "7", []byte(`{"id":7}`), `{"trace":"abc"}`, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	outbox := New(database, Config{Table: "order_events"})
+	uow := db.NewUnitOfWork(database, nil)
+
+	assert.Equal(t, ErrNotInTransaction, outbox.Add(uow, Message{Topic: "orders.paid"}))
+
+	_, err := uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		tx.MustExec("UPDATE orders SET status = 'paid' WHERE id = 7")
+		return nil, outbox.Add(tx, Message{Topic: "orders.paid", Key: "7", Payload: []byte(`{"id":7}`), Headers: map[string]string{"trace": "abc"}})
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, outbox.wake, 1)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldClaimAndDispatchPendingMessages(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT id, topic, message_key, payload, headers, created_at, attempts FROM outbox ` +
+		`WHERE dispatched_at IS NULL AND available_at <= \$1 ORDER BY created_at, id LIMIT 100 FOR UPDATE SKIP LOCKED$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "topic", "message_key", "payload", "headers", "created_at", "attempts"}).
+			AddRow("a1", "orders.paid", "7", []byte(`{"id":7}`), `{"trace":"abc"}`, created, 0).
+			AddRow("b2", "orders.paid", "8", []byte(`{"id":8}`), `{}`, created, 2))
+	mock.ExpectExec(`^UPDATE outbox SET available_at = \$1 WHERE id IN \(\$2, \$3\)$`).
+		WithArgs(sqlmock.AnyArg(), "a1", "b2").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	mock.ExpectExec(`^UPDATE outbox SET dispatched_at = \$1 WHERE id = \$2$`).
+		WithArgs(sqlmock.AnyArg(), "a1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE outbox SET attempts = attempts \+ 1, last_error = \$1, available_at = \$2 WHERE id = \$3$`).
+		WithArgs("broker unavailable", sqlmock.AnyArg(), "b2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var dispatched []Message
+	claimed, err := New(database, Config{}).Dispatch(context.Background(), func(ctx context.Context, m Message) error {
+		dispatched = append(dispatched, m)
+		if m.ID == "b2" {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, claimed)
+	assert.Equal(t, Message{ID: "a1", Topic: "orders.paid", Key: "7", Payload: []byte(`{"id":7}`),
+		Headers: map[string]string{"trace": "abc"}, CreatedAt: created}, dispatched[0])
+	assert.Equal(t, 2, dispatched[1].Attempts)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldClaimWithoutRowLocksOnSQLite(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlite3")
+	mock.ExpectBegin()
+	mock.ExpectQuery(`WHERE dispatched_at IS NULL AND available_at <= \? ORDER BY created_at, id LIMIT 10$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	claimed, err := New(database, Config{BatchSize: 10}).Dispatch(context.Background(), func(ctx context.Context, m Message) error {
+		t.Fatal("nothing to dispatch")
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, claimed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned by SelectPage for a cursor it did not issue
+// for the same keyset.
+var ErrInvalidCursor = errors.New("db: invalid page cursor")
+
+// PageRequest selects a page of SelectPage, by number or, when Keyset is
+// set, after a cursor.
+type PageRequest struct {
+	// Page is the number of the page, from 1, with offset pagination. Zero
+	// means the first page.
+	Page int
+
+	// Size is the number of rows of a page. Zero means 20.
+	Size int
+
+	// Keyset switches to keyset pagination: rows are ordered by these
+	// columns of the query result, which must identify a row together, e.g.
+	// created_at then id, and a page starts after the last row of the
+	// previous one instead of skipping OFFSET rows, so that its cost does not
+	// grow with its position. The columns are written into the statement
+	// as is; never take them from user input.
+	Keyset []KeyColumn
+
+	// Cursor is the NextCursor of the previous page in keyset mode. Empty
+	// means the first page.
+	Cursor string
+
+	// Count asks for the Total of the query, counted alongside the page.
+	Count bool
+}
+
+// KeyColumn is a column of a keyset, ascending unless Desc is set.
+type KeyColumn struct {
+	Column string
+	Desc   bool
+}
+
+// Page is a page of rows of SelectPage.
+type Page[T any] struct {
+	Items []T
+
+	// Total is the number of rows of the whole query, or -1 when the
+	// request did not ask for it.
+	Total int64
+
+	// HasNext reports whether rows follow the page.
+	HasNext bool
+
+	// NextCursor is the cursor of the next page in keyset mode, empty on the
+	// last page.
+	NextCursor string
+}
+
+// SelectPage runs a page of query, which uses ? placeholders bound to args
+// and is rebound for the driver as SelectFilter does, scanning its rows into
+// T like All.
+//
+// With offset pagination, query must order its rows itself and gets LIMIT and
+// OFFSET appended. With keyset pagination, query is wrapped in a subquery
+// ordered by the keyset and filtered on the cursor, so it must select the
+// keyset columns and T must map them. One row more than the page size is
+// fetched to tell whether another page follows.
+//
+// When Count is set, the COUNT of the query runs in parallel with the page,
+// or after it inside a transaction, whose connection runs one statement at a
+// time. See Count.
+func SelectPage[T any](ctx context.Context, uow UnitOfWork, query string, req PageRequest, args ...interface{}) (Page[T], error) {
+	if req.Size <= 0 {
+		req.Size = 20
+	}
+	page := Page[T]{Total: -1}
+
+	paged, pageArgs, err := pageQuery(query, req, args)
+	if err != nil {
+		return page, err
+	}
+
+	count := func() (int64, error) {
+		var n sql.NullInt64
+		err := uow.GetContext(ctx, &n, uow.Rebind(fmt.Sprintf("SELECT COUNT(*) FROM (%s) counted", subquery(query))), args...)
+		return n.Int64, err
+	}
+	type counted struct {
+		total int64
+		err   error
+	}
+	var parallel chan counted
+	if u, ok := uow.(*unitOfWork); ok && req.Count && u.currentTx() == nil {
+		parallel = make(chan counted, 1)
+		go func() {
+			total, err := count()
+			parallel <- counted{total, err}
+		}()
+	}
+
+	var total int64
+	err = uow.SelectContext(ctx, &page.Items, uow.Rebind(paged), pageArgs...)
+	switch {
+	case parallel != nil:
+		// waited for even when the page failed, not to leave it running
+		c := <-parallel
+		if total = c.total; err == nil {
+			err = c.err
+		}
+	case req.Count && err == nil:
+		total, err = count()
+	}
+	if err != nil {
+		return Page[T]{Total: -1}, err
+	}
+	if req.Count {
+		page.Total = total
+	}
+
+	if len(page.Items) > req.Size {
+		page.Items, page.HasNext = page.Items[:req.Size], true
+		if len(req.Keyset) > 0 {
+			if page.NextCursor, err = encodeCursor(page.Items[req.Size-1], req.Keyset); err != nil {
+				return Page[T]{Total: -1}, err
+			}
+		}
+	}
+	return page, nil
+}
+
+// pageQuery returns the query of the page requested and its arguments.
+func pageQuery(query string, req PageRequest, args []interface{}) (string, []interface{}, error) {
+	query = subquery(query)
+	if len(req.Keyset) == 0 {
+		offset := 0
+		if req.Page > 1 {
+			offset = (req.Page - 1) * req.Size
+		}
+		return fmt.Sprintf("%s LIMIT %d OFFSET %d", query, req.Size+1, offset), args, nil
+	}
+
+	order := make([]string, len(req.Keyset))
+	for i, k := range req.Keyset {
+		order[i] = k.Column
+		if k.Desc {
+			order[i] += " DESC"
+		}
+	}
+
+	where := ""
+	all := append([]interface{}{}, args...)
+	if req.Cursor != "" {
+		values, err := decodeCursor(req.Cursor, len(req.Keyset))
+		if err != nil {
+			return "", nil, err
+		}
+
+		// (a > ?) OR (a = ? AND b > ?) ..., rather than a row comparison,
+		// which cannot mix directions
+		terms := make([]string, len(req.Keyset))
+		for i, k := range req.Keyset {
+			parts := make([]string, 0, i+1)
+			for j := 0; j < i; j++ {
+				parts = append(parts, req.Keyset[j].Column+" = ?")
+				all = append(all, values[j])
+			}
+			op := " > ?"
+			if k.Desc {
+				op = " < ?"
+			}
+			parts = append(parts, k.Column+op)
+			all = append(all, values[i])
+			terms[i] = "(" + strings.Join(parts, " AND ") + ")"
+		}
+		where = " WHERE " + strings.Join(terms, " OR ")
+	}
+
+	return fmt.Sprintf("SELECT * FROM (%s) paged%s ORDER BY %s LIMIT %d", query, where, strings.Join(order, ", "), req.Size+1), all, nil
+}
+
+// cursorValue is a key of a cursor, tagged with its type so that it is bound
+// again as the same type: i int64, f float64, b bool, s string, t time.
+type cursorValue [2]string
+
+// encodeCursor returns the cursor of the page after row.
+func encodeCursor(row interface{}, keyset []KeyColumn) (string, error) {
+	values := make([]cursorValue, len(keyset))
+	for i, k := range keyset {
+		key, err := scanKey(row, k.Column)
+		if err != nil {
+			return "", err
+		}
+		if key, err = driver.DefaultParameterConverter.ConvertValue(key); err != nil {
+			return "", fmt.Errorf("db: keyset column %s: %w", k.Column, err)
+		}
+
+		switch v := key.(type) {
+		case int64:
+			values[i] = cursorValue{"i", strconv.FormatInt(v, 10)}
+		case float64:
+			values[i] = cursorValue{"f", strconv.FormatFloat(v, 'g', -1, 64)}
+		case bool:
+			values[i] = cursorValue{"b", strconv.FormatBool(v)}
+		case string:
+			values[i] = cursorValue{"s", v}
+		case []byte:
+			values[i] = cursorValue{"s", string(v)}
+		case time.Time:
+			values[i] = cursorValue{"t", v.Format(time.RFC3339Nano)}
+		default:
+			// NULL keys cannot be sought past
+			return "", fmt.Errorf("db: keyset column %s is %v", k.Column, key)
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the keys of cursor, which must have n of them.
+func decodeCursor(cursor string, n int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var values []cursorValue
+	if err := json.Unmarshal(data, &values); err != nil || len(values) != n {
+		return nil, ErrInvalidCursor
+	}
+
+	keys := make([]interface{}, n)
+	for i, v := range values {
+		switch v[0] {
+		case "i":
+			keys[i], err = strconv.ParseInt(v[1], 10, 64)
+		case "f":
+			keys[i], err = strconv.ParseFloat(v[1], 64)
+		case "b":
+			keys[i], err = strconv.ParseBool(v[1])
+		case "s":
+			keys[i] = v[1]
+		case "t":
+			keys[i], err = time.Parse(time.RFC3339Nano, v[1])
+		default:
+			err = ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSelectPageByNumberWithTotal(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE status = \? ORDER BY id LIMIT 3 OFFSET 2$`).
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(3, "open").AddRow(4, "open").AddRow(5, "open"))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM \(SELECT id, status FROM orders WHERE status = \? ORDER BY id\) counted$`).
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(9))
+
+	page, err := SelectPage[repositoryOrder](context.Background(), uw, "SELECT id, status FROM orders WHERE status = ? ORDER BY id;",
+		PageRequest{Page: 2, Size: 2, Count: true}, "open")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Page[repositoryOrder]{Items: []repositoryOrder{{3, "open"}, {4, "open"}}, Total: 9, HasNext: true}, page)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldSelectLastPageWithoutTotal(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id FROM orders ORDER BY id LIMIT 21 OFFSET 0$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	page, err := SelectPage[int64](context.Background(), uw, "SELECT id FROM orders ORDER BY id", PageRequest{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, Page[int64]{Items: []int64{1}, Total: -1}, page)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+type pagedEvent struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func TestShouldSelectPagesAfterKeysetCursor(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	keyset := []KeyColumn{{Column: "created_at", Desc: true}, {Column: "id"}}
+
+	mock.ExpectQuery(`^` + regexp.QuoteMeta(`SELECT * FROM (SELECT id, created_at FROM events WHERE kind = ?) paged ORDER BY created_at DESC, id LIMIT 3`) + `$`).
+		WithArgs("login").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, at).AddRow(2, at).AddRow(9, at.Add(-time.Hour)))
+
+	first, err := SelectPage[pagedEvent](context.Background(), uw, "SELECT id, created_at FROM events WHERE kind = ?",
+		PageRequest{Size: 2, Keyset: keyset}, "login")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []pagedEvent{{7, at}, {2, at}}, first.Items)
+	assert.True(t, first.HasNext)
+	assert.NotEmpty(t, first.NextCursor)
+
+	mock.ExpectQuery(`^`+regexp.QuoteMeta(`SELECT * FROM (SELECT id, created_at FROM events WHERE kind = ?) paged `+
+		`WHERE (created_at < ?) OR (created_at = ? AND id > ?) ORDER BY created_at DESC, id LIMIT 3`)+`$`).
+		WithArgs("login", at, at, int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(9, at.Add(-time.Hour)))
+
+	next, err := SelectPage[pagedEvent](context.Background(), uw, "SELECT id, created_at FROM events WHERE kind = ?",
+		PageRequest{Size: 2, Keyset: keyset, Cursor: first.NextCursor}, "login")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Page[pagedEvent]{Items: []pagedEvent{{9, at.Add(-time.Hour)}}, Total: -1}, next)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseForeignCursors(t *testing.T) {
+	uw, _ := newMockUnitOfWork(t)
+	keyset := []KeyColumn{{Column: "id"}}
+
+	cursor, err := encodeCursor(pagedEvent{ID: 2}, []KeyColumn{{Column: "created_at"}, {Column: "id"}})
+	assert.Nil(t, err)
+
+	for _, c := range []string{"not a cursor", "W10", cursor} {
+		_, err := SelectPage[pagedEvent](context.Background(), uw, "SELECT id FROM events", PageRequest{Keyset: keyset, Cursor: c})
+		assert.ErrorIs(t, err, ErrInvalidCursor, c)
+	}
+}
+
+func TestShouldRoundTripCursorKeysWithTheirTypes(t *testing.T) {
+	type row struct {
+		ID    int32          `db:"id"`
+		Score float64        `db:"score"`
+		Name  sql.NullString `db:"name"`
+		Done  bool           `db:"done"`
+	}
+	keyset := []KeyColumn{{Column: "id"}, {Column: "score"}, {Column: "name"}, {Column: "done"}}
+
+	cursor, err := encodeCursor(row{ID: 4, Score: 0.5, Name: sql.NullString{String: "ada", Valid: true}, Done: true}, keyset)
+	assert.Nil(t, err)
+	keys, err := decodeCursor(cursor, len(keyset))
+
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(4), 0.5, "ada", true}, keys)
+
+	_, err = encodeCursor(row{}, keyset)
+	assert.EqualError(t, err, "db: keyset column name is <nil>")
+}
+
+func TestShouldCountAfterThePageInsideTransactions(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT id FROM orders ORDER BY id LIMIT 11 OFFSET 0$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM \(SELECT id FROM orders ORDER BY id\) counted$`).
+		WillReturnError(errors.New("canceling statement"))
+	mock.ExpectRollback()
+
+	_, err := uw.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return SelectPage[int64](context.Background(), tx, "SELECT id FROM orders ORDER BY id", PageRequest{Size: 10, Count: true})
+	})
+
+	assert.EqualError(t, err, "canceling statement")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ParallelScanConfig configures ParallelScan.
+type ParallelScanConfig struct {
+	Table string
+
+	// KeyColumn is an integer column identifying the rows, whose range is
+	// split between the workers.
+	KeyColumn string
+
+	// Workers is the number of connections reading at once. Zero means 4.
+	Workers int
+
+	// BatchSize is the number of rows per query. Zero means 1000.
+	BatchSize int
+
+	// Options configure the snapshot and every worker reading from it, e.g.
+	// WithMetrics to count the batch queries.
+	Options []Option
+}
+
+// ParallelScan reads every row of a table over several connections at once,
+// for exports and backfills of tables too large for a single reader, while
+// keeping the result consistent: the workers join the snapshot of one
+// transaction, so they all see the table as of the same instant. The key
+// range is cut into one contiguous range per worker, of equal width, and
+// each worker walks its own in key order, batch by batch like ScanTable.
+//
+// fn is called with the rows of every batch, concurrently from the workers,
+// and the index of the worker. The first error of a query or of fn stops
+// every worker and is returned. Sharing a snapshot requires Postgres; on
+// other databases a single worker reads the whole table in one snapshot.
+func ParallelScan[T any](ctx context.Context, database *sqlx.DB, config ParallelScanConfig, fn func(worker int, rows []T) error) error {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	if DialectFor(database.DriverName()) != DialectPostgres {
+		config.Workers = 1
+	}
+
+	return WithSnapshot(ctx, NewUnitOfWork(database, nil, config.Options...), func(snapshot *Snapshot) error {
+		var bounds struct {
+			Min sql.NullInt64 `db:"min"`
+			Max sql.NullInt64 `db:"max"`
+		}
+		if err := snapshot.GetContext(ctx, &bounds, fmt.Sprintf("SELECT MIN(%[1]s) AS min, MAX(%[1]s) AS max FROM %[2]s",
+			config.KeyColumn, config.Table)); err != nil {
+			return err
+		}
+		if !bounds.Min.Valid {
+			return nil
+		}
+		ranges := keyRanges(bounds.Min.Int64, bounds.Max.Int64, config.Workers)
+
+		if len(ranges) == 1 {
+			return scanRange(ctx, snapshot, config, ranges[0], 0, fn)
+		}
+
+		id, err := snapshot.Export()
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		var once sync.Once
+		var first error
+		for i, r := range ranges {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := JoinSnapshot(ctx, NewUnitOfWork(database, nil, config.Options...), id, func(worker *Snapshot) error {
+					return scanRange(ctx, worker, config, r, i, fn)
+				})
+				if err != nil {
+					once.Do(func() {
+						first = err
+						cancel()
+					})
+				}
+			}()
+		}
+		// the exporting transaction stays open until every worker is done
+		wg.Wait()
+		return first
+	})
+}
+
+// keyRange is an inclusive range of keys.
+type keyRange struct{ from, to int64 }
+
+// keyRanges cuts [min, max] into at most n ranges of equal width.
+func keyRanges(min, max int64, n int) []keyRange {
+	width := (max-min)/int64(n) + 1
+	ranges := make([]keyRange, 0, n)
+	for from := min; from <= max; from += width {
+		to := from + width - 1
+		if to > max || to < from {
+			// past max, or overflowed
+			to = max
+		}
+		ranges = append(ranges, keyRange{from, to})
+		if to == max {
+			break
+		}
+	}
+	return ranges
+}
+
+// scanRange walks the rows of r in key order, batch by batch.
+func scanRange[T any](ctx context.Context, uow UnitOfWork, config ParallelScanConfig, r keyRange, worker int, fn func(int, []T) error) error {
+	columns := "*"
+	var zero T
+	if model, err := ModelOf(&zero); err == nil {
+		columns = strings.Join(model.Columns, ", ")
+	}
+	if reflect.TypeOf(zero) != nil && reflect.TypeOf(zero).Kind() != reflect.Struct {
+		columns = config.KeyColumn
+	}
+
+	key := config.KeyColumn
+	base := fmt.Sprintf("SELECT %s FROM %s WHERE %s >= ? AND %s <= ?", columns, config.Table, key, key)
+	first := uow.Rebind(fmt.Sprintf("%s ORDER BY %s LIMIT %d", base, key, config.BatchSize))
+	next := uow.Rebind(fmt.Sprintf("%s AND %s > ? ORDER BY %s LIMIT %d", base, key, key, config.BatchSize))
+
+	var last interface{}
+	for {
+		var rows []T
+		var err error
+		if last == nil {
+			err = uow.SelectContext(ctx, &rows, first, r.from, r.to)
+		} else {
+			err = uow.SelectContext(ctx, &rows, next, r.from, r.to, last)
+		}
+		if err != nil {
+			return fmt.Errorf("db: scanning %s from %d to %d: %w", config.Table, r.from, r.to, err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := fn(worker, rows); err != nil {
+			return err
+		}
+		if len(rows) < config.BatchSize {
+			return nil
+		}
+		if last, err = scanKey(rows[len(rows)-1], key); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCutKeyRangesBetweenWorkers(t *testing.T) {
+	assert.Equal(t, []keyRange{{1, 5}, {6, 10}}, keyRanges(1, 10, 2))
+	assert.Equal(t, []keyRange{{1, 4}, {5, 8}, {9, 10}}, keyRanges(1, 10, 3))
+	assert.Equal(t, []keyRange{{7, 7}}, keyRanges(7, 7, 4))
+	assert.Equal(t, []keyRange{{1, 1}, {2, 2}}, keyRanges(1, 2, 8))
+}
+
+func TestShouldScanKeyRangesInParallelFromOneSnapshot(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.MatchExpectationsInOrder(false)
+	batch := `^` + regexp.QuoteMeta(`SELECT id, status FROM orders WHERE id >= $1 AND id <= $2 ORDER BY id LIMIT 3`) + `$`
+	after := `^` + regexp.QuoteMeta(`SELECT id, status FROM orders WHERE id >= $1 AND id <= $2 AND id > $3 ORDER BY id LIMIT 3`) + `$`
+	rows := func(ids ...int64) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"id", "status"})
+		for _, id := range ids {
+			r.AddRow(id, "open")
+		}
+		return r
+	}
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+	}
+	mock.ExpectQuery(`^SELECT MIN\(id\) AS min, MAX\(id\) AS max FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(1, 10))
+	mock.ExpectQuery(`^SELECT pg_export_snapshot\(\)$`).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_export_snapshot"}).AddRow("00000003-0000001B-1"))
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(`^SET TRANSACTION SNAPSHOT '00000003-0000001B-1'$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery(batch).WithArgs(1, 5).WillReturnRows(rows(1, 2, 3))
+	mock.ExpectQuery(after).WithArgs(1, 5, 3).WillReturnRows(rows(5))
+	mock.ExpectQuery(batch).WithArgs(6, 10).WillReturnRows(rows(6, 7, 9))
+	mock.ExpectQuery(after).WithArgs(6, 10, 9).WillReturnRows(rows())
+
+	var mu sync.Mutex
+	seen := map[int][]int64{}
+	err := ParallelScan[repositoryOrder](context.Background(), database, ParallelScanConfig{
+		Table: "orders", KeyColumn: "id", Workers: 2, BatchSize: 3,
+	}, func(worker int, orders []repositoryOrder) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, o := range orders {
+			seen[worker] = append(seen[worker], o.ID)
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[int][]int64{0: {1, 2, 3, 5}, 1: {6, 7, 9}}, seen)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldScanWithOneWorkerWithoutSharedSnapshots(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT MIN\(id\) AS min, MAX\(id\) AS max FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(1, 10))
+	mock.ExpectQuery(`^SELECT id FROM orders WHERE id >= \? AND id <= \? ORDER BY id LIMIT 1000$`).
+		WithArgs(1, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(10))
+	mock.ExpectCommit()
+
+	var ids []int64
+	err := ParallelScan[int64](context.Background(), database, ParallelScanConfig{Table: "orders", KeyColumn: "id", Workers: 8},
+		func(worker int, rows []int64) error {
+			ids = append(ids, rows...)
+			return nil
+		})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 10}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldStopEveryWorkerOnTheFirstError(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT MIN`).WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+	mock.ExpectCommit()
+
+	err := ParallelScan[int64](context.Background(), database, ParallelScanConfig{Table: "orders", KeyColumn: "id"},
+		func(int, []int64) error { return errors.New("unexpected rows") })
+	assert.Nil(t, err, "an empty table has nothing to scan")
+
+	database, mock = newMockDatabase(t, "postgres")
+	mock.MatchExpectationsInOrder(false)
+	for i := 0; i < 3; i++ {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+	}
+	mock.ExpectQuery(`^SELECT MIN`).WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(1, 2))
+	mock.ExpectQuery(`^SELECT pg_export_snapshot`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3-1B-1"))
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec(`^SET TRANSACTION SNAPSHOT`).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectQuery(`^SELECT id FROM orders`).WithArgs(1, 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT id FROM orders`).WithArgs(2, 2).WillReturnError(errors.New("connection reset"))
+
+	var mu sync.Mutex
+	var workers []int
+	err = ParallelScan[int64](context.Background(), database, ParallelScanConfig{Table: "orders", KeyColumn: "id", Workers: 2},
+		func(worker int, rows []int64) error {
+			mu.Lock()
+			defer mu.Unlock()
+			workers = append(workers, worker)
+			return nil
+		})
+
+	assert.EqualError(t, err, "db: scanning orders from 2 to 2: connection reset")
+	sort.Ints(workers)
+	assert.Subset(t, []int{0}, workers)
+}
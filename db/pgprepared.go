@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var statementName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// StatementTemplates keeps named server-side prepared statements (PREPARE /
+// EXECUTE) on a single pinned Postgres connection. Because the statements
+// belong to the session rather than to a transaction, they survive across the
+// transactions started with Begin. Statements are prepared lazily on first use
+// and transparently re-prepared when the server reports that the cached plan
+// no longer matches the schema.
+//
+// A StatementTemplates value serializes access to its connection and is safe
+// for concurrent use.
+type StatementTemplates struct {
+	conn *sql.Conn
+
+	mu        sync.Mutex
+	templates map[string]string
+	prepared  map[string]bool
+	inTx      bool
+}
+
+// PinStatementTemplates reserves a connection from db for prepared statements.
+// Close must be called to hand the connection back to the pool. Databases in
+// proxy compatibility mode are refused.
+func PinStatementTemplates(ctx context.Context, db *sqlx.DB) (*StatementTemplates, error) {
+	if ProxyCompatible(db) {
+		return nil, fmt.Errorf("%w: prepared statements need a session", ErrSessionState)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatementTemplates{
+		conn:      conn,
+		templates: map[string]string{},
+		prepared:  map[string]bool{},
+	}, nil
+}
+
+// Define registers query under name. Redefining a prepared name with a
+// different query deallocates the old statement right away.
+func (s *StatementTemplates) Define(name, query string) error {
+	if !statementName.MatchString(name) {
+		return fmt.Errorf("db: invalid prepared statement name %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.templates[name]; ok && old != query && s.prepared[name] {
+		s.prepared[name] = false
+		s.templates[name] = query
+		_, err := s.conn.ExecContext(context.Background(), "DEALLOCATE "+name)
+		return err
+	}
+
+	s.templates[name] = query
+	return nil
+}
+
+// Exec runs the statement registered under name.
+func (s *StatementTemplates) Exec(ctx context.Context, name string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+
+	err := s.run(ctx, name, args, func(query string) error {
+		var err error
+		result, err = s.conn.ExecContext(ctx, query, args...)
+		return err
+	})
+
+	return result, err
+}
+
+// Select runs the statement registered under name and scans every row into dest.
+func (s *StatementTemplates) Select(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	return s.run(ctx, name, args, func(query string) error {
+		rows, err := s.conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		// StructScan leaves the rows open on a scan error, holding the
+		// pinned connection
+		defer rows.Close()
+
+		return sqlx.StructScan(&sqlx.Rows{Rows: rows, Mapper: mapper}, dest)
+	})
+}
+
+// Get runs the statement registered under name and scans the first row into
+// dest. It returns sql.ErrNoRows when the statement yields nothing.
+func (s *StatementTemplates) Get(ctx context.Context, dest interface{}, name string, args ...interface{}) error {
+	return s.run(ctx, name, args, func(query string) error {
+		rows, err := s.conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+
+		return scanOne(&sqlx.Rows{Rows: rows, Mapper: mapper}, dest)
+	})
+}
+
+// Begin starts a transaction on the pinned connection.
+func (s *StatementTemplates) Begin(ctx context.Context) error {
+	return s.control(ctx, "BEGIN", true)
+}
+
+// Commit commits the transaction started with Begin.
+func (s *StatementTemplates) Commit(ctx context.Context) error {
+	return s.control(ctx, "COMMIT", false)
+}
+
+// Rollback aborts the transaction started with Begin.
+func (s *StatementTemplates) Rollback(ctx context.Context) error {
+	return s.control(ctx, "ROLLBACK", false)
+}
+
+// Close deallocates every statement and releases the pinned connection.
+func (s *StatementTemplates) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.prepared) > 0 {
+		s.conn.ExecContext(context.Background(), "DEALLOCATE ALL")
+	}
+
+	return s.conn.Close()
+}
+
+func (s *StatementTemplates) control(ctx context.Context, statement string, inTx bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.conn.ExecContext(ctx, statement); err != nil {
+		return err
+	}
+
+	s.inTx = inTx
+	return nil
+}
+
+func (s *StatementTemplates) run(ctx context.Context, name string, args []interface{}, fn func(query string) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	template, ok := s.templates[name]
+	if !ok {
+		return fmt.Errorf("db: prepared statement %q is not defined", name)
+	}
+
+	if err := s.prepare(ctx, name, template, false); err != nil {
+		return err
+	}
+
+	execute := executeStatement(name, len(args))
+
+	err := fn(execute)
+	if err == nil || !isStalePlan(err) || s.inTx {
+		return err
+	}
+
+	if err := s.prepare(ctx, name, template, true); err != nil {
+		return err
+	}
+
+	return fn(execute)
+}
+
+func (s *StatementTemplates) prepare(ctx context.Context, name, template string, again bool) error {
+	if s.prepared[name] && !again {
+		return nil
+	}
+
+	if again {
+		if _, err := s.conn.ExecContext(ctx, "DEALLOCATE "+name); err != nil {
+			return err
+		}
+		s.prepared[name] = false
+	}
+
+	if _, err := s.conn.ExecContext(ctx, "PREPARE "+name+" AS "+template); err != nil {
+		return err
+	}
+
+	s.prepared[name] = true
+	return nil
+}
+
+func executeStatement(name string, argc int) string {
+	if argc == 0 {
+		return "EXECUTE " + name
+	}
+
+	params := make([]string, argc)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	return "EXECUTE " + name + "(" + strings.Join(params, ", ") + ")"
+}
+
+// isStalePlan reports the Postgres error raised when a prepared statement's
+// result type changed underneath it, typically after ALTER TABLE.
+func isStalePlan(err error) bool {
+	return strings.Contains(err.Error(), "cached plan must not change result type")
+}
+
+// scanOne scans the first row of rows into dest, using struct scanning for
+// structs with mapped fields and column scanning for everything else, the same
+// rule sqlx applies in Get.
+func scanOne(rows *sqlx.Rows, dest interface{}) error {
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	if err := scanRow(rows, dest); err != nil {
+		return err
+	}
+
+	return rows.Close()
+}
+
+// scanRow scans the current row into dest, a struct mapped with db tags or a
+// scalar.
+func scanRow(rows *sqlx.Rows, dest interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(dest))
+	_, scanner := dest.(sql.Scanner)
+	if v.Kind() == reflect.Struct && !scanner && len(mapper.TypeMap(v.Type()).Index) > 0 {
+		return rows.StructScan(dest)
+	}
+	return rows.Scan(dest)
+}
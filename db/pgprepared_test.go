@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStatementTemplates(t *testing.T) (*StatementTemplates, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	templates, err := PinStatementTemplates(context.Background(), sqlx.NewDb(conn, "postgres"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return templates, mock
+}
+
+func TestShouldPrepareOnceAndExecuteByName(t *testing.T) {
+	templates, mock := newStatementTemplates(t)
+	assert.Nil(t, templates.Define("find_order", "SELECT id, status FROM orders WHERE id = $1"))
+
+	mock.ExpectExec(`PREPARE find_order AS SELECT id, status FROM orders WHERE id = \$1`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`EXECUTE find_order\(\$1\)`).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+	mock.ExpectQuery(`EXECUTE find_order\(\$1\)`).WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(2, "paid"))
+
+	var first, second repositoryOrder
+	assert.Nil(t, templates.Get(context.Background(), &first, "find_order", 1))
+	assert.Nil(t, templates.Get(context.Background(), &second, "find_order", 2))
+
+	assert.Equal(t, "paid", second.Status)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReprepareWhenCachedPlanIsStale(t *testing.T) {
+	templates, mock := newStatementTemplates(t)
+	templates.Define("count_orders", "SELECT count(*) FROM orders")
+
+	mock.ExpectExec("PREPARE count_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("EXECUTE count_orders").
+		WillReturnError(errors.New("pq: cached plan must not change result type"))
+	mock.ExpectExec("DEALLOCATE count_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("PREPARE count_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("EXECUTE count_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	var count int
+	assert.Nil(t, templates.Get(context.Background(), &count, "count_orders"))
+	assert.Equal(t, 3, count)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectInvalidOrUnknownStatementNames(t *testing.T) {
+	templates, _ := newStatementTemplates(t)
+
+	assert.NotNil(t, templates.Define("drop table; --", "SELECT 1"))
+
+	_, err := templates.Exec(context.Background(), "missing")
+	assert.NotNil(t, err)
+}
+
+func TestShouldCloseRowsWhenSelectFailsToScan(t *testing.T) {
+	templates, mock := newStatementTemplates(t)
+	templates.Define("list_orders", "SELECT id, status FROM orders")
+
+	mock.ExpectExec("PREPARE list_orders").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("EXECUTE list_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow("not a number", "open")).
+		RowsWillBeClosed()
+
+	var orders []repositoryOrder
+	assert.NotNil(t, templates.Select(context.Background(), &orders, "list_orders"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
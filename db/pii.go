@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+)
+
+// ParseCommentTags reads the key=value tags of a comment, separated by
+// spaces, commas or semicolons, e.g. "owner=payments; pii=email". A bare key
+// is a tag with an empty value; other text is ignored.
+func ParseCommentTags(comment string) map[string]string {
+	tags := map[string]string{}
+	fields := strings.FieldsFunc(comment, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		if key != "" {
+			tags[strings.ToLower(key)] = value
+		}
+	}
+	return tags
+}
+
+// PIIClassification maps the PII columns, as "table.column", to their class,
+// e.g. "email". The class is empty for columns merely tagged pii.
+type PIIClassification map[string]string
+
+// ClassifyPII reads the classification of the columns of tables from their
+// comments, the columns tagged pii being classified, e.g. with
+//
+//	COMMENT ON COLUMN customers.email IS 'pii=email'
+//
+// so that the classification kept in the schema drives masking and log
+// redaction, see MaskPolicy and StatementLogConfig. Comments are only
+// supported by Postgres.
+func ClassifyPII(uow UnitOfWork, tables ...string) (PIIClassification, error) {
+	classification := PIIClassification{}
+	for _, table := range tables {
+		info, err := DescribeTable(uow, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range info.Columns {
+			if class, ok := ParseCommentTags(column.Comment)["pii"]; ok {
+				classification[table+"."+column.Name] = class
+			}
+		}
+	}
+	return classification, nil
+}
+
+// MaskPolicy returns a policy masking every classified column with the masker
+// of its class in maskers, or with otherwise for other classes; a nil
+// otherwise means MaskNull.
+//
+//	policy := classification.MaskPolicy(map[string]db.Masker{"email": db.MaskEmail(salt)}, db.MaskHash(salt))
+func (c PIIClassification) MaskPolicy(maskers map[string]Masker, otherwise Masker) MaskPolicy {
+	if otherwise == nil {
+		otherwise = MaskNull
+	}
+
+	policy := MaskPolicy{}
+	for column, class := range c {
+		if m, ok := maskers[class]; ok {
+			policy[column] = m
+		} else {
+			policy[column] = otherwise
+		}
+	}
+	return policy
+}
+
+// covers reports whether one of tables has classified columns. Tables are
+// compared without their schema, so public.customers is customers.
+func (c PIIClassification) covers(tables []string) bool {
+	for column := range c {
+		i := strings.LastIndexByte(column, '.')
+		if i < 0 {
+			continue
+		}
+		for _, table := range tables {
+			if strings.EqualFold(unqualified(column[:i]), unqualified(table)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unqualified returns name without its schema.
+func unqualified(name string) string {
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// masker returns the masker of table.column, the qualified key winning.
+// Tables are compared without their schema.
+func (p MaskPolicy) masker(table, column string) Masker {
+	if m, ok := p[table+"."+column]; ok {
+		return m
+	}
+	for key, m := range p {
+		i := strings.LastIndexByte(key, '.')
+		if i >= 0 && key[i+1:] == column && strings.EqualFold(unqualified(key[:i]), unqualified(table)) {
+			return m
+		}
+	}
+	return p[column]
+}
+
+// anyMasker returns the masker of column in whatever table, for rows whose
+// tables are unknown.
+func (p MaskPolicy) anyMasker(column string) Masker {
+	if m, ok := p[column]; ok {
+		return m
+	}
+	for key, m := range p {
+		if strings.HasSuffix(key, "."+column) {
+			return m
+		}
+	}
+	return nil
+}
+
+// WithMasking masks the values policy names in the rows read by the unit of
+// work, e.g. for reads of production data from staging. Get and Select mask
+// the registered models they read into, or slices of them, by the columns of
+// the model's table. Rows read through Query, NamedQuery and what builds on
+// them, such as Repository and SelectStream, are masked as they are read, by
+// the columns of the tables the statement names; when it names none that
+// can be told, every column a policy key names is masked.
+func WithMasking(policy MaskPolicy) Option {
+	return WithInterceptors(func(ctx context.Context, stmt *Statement, next Handler) error {
+		err := next(ctx, stmt)
+		if err != nil {
+			return err
+		}
+		if stmt.Kind == KindQuery {
+			stmt.Rows, err = wrapRows(ctx, stmt.Rows, rowHooks{row: rowMasker(policy, Inspect(stmt.Driver, stmt.Query).Tables)})
+			return err
+		}
+		if stmt.Kind != KindGet && stmt.Kind != KindSelect {
+			return nil
+		}
+
+		dest := reflect.ValueOf(stmt.Dest)
+		if dest.Kind() != reflect.Ptr || dest.IsNil() {
+			return nil
+		}
+		if dest.Elem().Kind() != reflect.Slice {
+			maskEntity(policy, dest)
+			return nil
+		}
+
+		rows := dest.Elem()
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Index(i)
+			if row.Kind() != reflect.Ptr {
+				row = row.Addr()
+			}
+			maskEntity(policy, row)
+		}
+		return nil
+	})
+}
+
+// rowMasker returns a row hook masking the columns of tables policy names.
+func rowMasker(policy MaskPolicy, tables []string) func(columns []string, values []interface{}) {
+	var maskers []Masker
+	return func(columns []string, values []interface{}) {
+		if maskers == nil {
+			maskers = make([]Masker, len(columns))
+			for i, column := range columns {
+				if len(tables) == 0 {
+					maskers[i] = policy.anyMasker(column)
+				}
+				for _, table := range tables {
+					if maskers[i] == nil {
+						maskers[i] = policy.masker(table, column)
+					}
+				}
+			}
+		}
+
+		for i, masker := range maskers {
+			if masker == nil {
+				continue
+			}
+			values[i] = masker(values[i])
+		}
+	}
+}
+
+// maskEntity masks the fields of entity, a pointer to a registered model.
+func maskEntity(policy MaskPolicy, entity reflect.Value) {
+	if entity.IsNil() {
+		return
+	}
+	model, err := modelOfType(entity.Type())
+	if err != nil {
+		return
+	}
+
+	for _, column := range model.Columns {
+		masker := policy.masker(model.Table, column)
+		if masker == nil {
+			continue
+		}
+		// read first: Field allocates nil pointers
+		value := model.ValueOf(entity.Interface(), column)
+		maskField(model.Field(entity.Interface(), column), value, masker)
+	}
+}
+
+// maskField replaces value, read from field, by its masked value, scanning it
+// into fields such as sql.NullString.
+func maskField(field reflect.Value, value interface{}, masker Masker) {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			value = nil
+		} else {
+			value = v.Elem().Interface()
+		}
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		value, _ = valuer.Value()
+	}
+	masked := masker(value)
+
+	if scanner, ok := field.Addr().Interface().(sql.Scanner); ok {
+		scanner.Scan(masked)
+		return
+	}
+	if masked == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+
+	target := field.Type()
+	if target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	m := reflect.ValueOf(masked)
+	if m.Kind() != target.Kind() || !m.Type().ConvertibleTo(target) {
+		field.Set(reflect.Zero(field.Type()))
+		return
+	}
+	m = m.Convert(target)
+	if field.Kind() == reflect.Ptr {
+		p := reflect.New(target)
+		p.Elem().Set(m)
+		m = p
+	}
+	field.Set(m)
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type piiCustomer struct {
+	ID    int64          `db:"id"`
+	Email string         `db:"email"`
+	Phone sql.NullString `db:"phone"`
+	Note  *string        `db:"note"`
+}
+
+func init() {
+	MustRegister(piiCustomer{}, "pii_customers")
+}
+
+func TestShouldParseCommentTags(t *testing.T) {
+	assert.Equal(t, map[string]string{"owner": "payments", "pii": "email", "deprecated": ""},
+		ParseCommentTags("Owner=payments; pii=email,deprecated"))
+	assert.Equal(t, map[string]string{}, ParseCommentTags(""))
+}
+
+func TestShouldClassifyPIIFromColumnComments(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`obj_description`).WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(""))
+	mock.ExpectQuery(`FROM pg_attribute`).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "type", "nullable", "comment"}).
+			AddRow("id", "bigint", false, "").
+			AddRow("email", "text", false, "pii=email owner=crm").
+			AddRow("phone", "text", true, "pii").
+			AddRow("note", "text", true, "free text"))
+
+	classification, err := ClassifyPII(NewUnitOfWork(database, nil), "pii_customers")
+
+	assert.Nil(t, err)
+	assert.Equal(t, PIIClassification{"pii_customers.email": "email", "pii_customers.phone": ""}, classification)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldMaskClassifiedColumnsOfReads(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	columns := []string{"id", "email", "phone", "note"}
+	mock.ExpectQuery(`^SELECT \* FROM pii_customers$`).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "ada@example.com", "555-0100", "vip").
+		AddRow(2, "bob@example.com", nil, nil))
+	mock.ExpectQuery(`^SELECT \* FROM pii_customers WHERE id = \?$`).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "ada@example.com", "555-0100", "vip"))
+
+	classification := PIIClassification{"pii_customers.email": "email", "pii_customers.phone": "", "pii_customers.note": "notes"}
+	policy := classification.MaskPolicy(map[string]Masker{"email": MaskEmail("salt"), "notes": MaskWith("redacted")}, nil)
+	uow := NewUnitOfWork(database, nil, WithMasking(policy))
+
+	var customers []piiCustomer
+	assert.Nil(t, uow.Select(&customers, "SELECT * FROM pii_customers"))
+	var customer piiCustomer
+	assert.Nil(t, uow.Get(&customer, "SELECT * FROM pii_customers WHERE id = ?", 1))
+
+	redacted := "redacted"
+	ada := piiCustomer{ID: 1, Email: MaskEmail("salt")("ada@example.com").(string), Note: &redacted}
+	assert.Equal(t, []piiCustomer{ada, {ID: 2, Email: MaskEmail("salt")("bob@example.com").(string)}}, customers)
+	assert.Equal(t, ada, customer)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRedactArgsOfStatementsOnClassifiedTables(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^UPDATE pii_customers").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger),
+		WithStatementLog(StatementLogConfig{PII: PIIClassification{"pii_customers.email": "email"}}))
+
+	uow.MustExec("UPDATE pii_customers SET email = ? WHERE id = ?", "ada@example.com", 1)
+	uow.MustExec("UPDATE orders SET status = ? WHERE id = ?", "paid", 1)
+
+	assert.Equal(t, `level=INFO msg="db: statement" query="UPDATE pii_customers SET email = ? WHERE id = ?" in_tx=false args=2
+level=INFO msg="db: statement" query="UPDATE orders SET status = ? WHERE id = ?" in_tx=false args="[paid 1]"
+`, buf.String())
+}
+
+func TestShouldMaskClassifiedColumnsOfRowsReadThroughQueries(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	columns := []string{"id", "email", "phone", "note"}
+	mock.ExpectQuery(`^SELECT .* FROM pii_customers WHERE id = \?$`).WithArgs(1).WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(1, "ada@example.com", "555-0100", "vip"))
+	mock.ExpectQuery(`^SELECT email FROM public.pii_customers$`).WillReturnRows(sqlmock.NewRows([]string{"email"}).
+		AddRow("ada@example.com"))
+	mock.ExpectQuery(`^SELECT \? AS email$`).WillReturnRows(sqlmock.NewRows([]string{"email"}).
+		AddRow("bob@example.com"))
+
+	policy := MaskPolicy{"pii_customers.email": MaskEmail("salt"), "pii_customers.note": MaskNull}
+	uow := NewUnitOfWork(database, nil, WithMasking(policy))
+
+	repository, err := NewRepository[piiCustomer]()
+	assert.Nil(t, err)
+	customer, err := repository.Find(uow, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, piiCustomer{ID: 1, Email: MaskEmail("salt")("ada@example.com").(string), Phone: sql.NullString{String: "555-0100", Valid: true}}, customer)
+
+	var emails []string
+	for email, err := range SelectStream[string](context.Background(), uow, "SELECT email FROM public.pii_customers") {
+		assert.Nil(t, err)
+		emails = append(emails, email)
+	}
+	rows, err := uow.Query("SELECT ? AS email", "bob@example.com")
+	assert.Nil(t, err)
+	for rows.Next() {
+		var email string
+		assert.Nil(t, rows.Scan(&email))
+		emails = append(emails, email)
+	}
+	assert.Nil(t, rows.Close())
+
+	assert.Equal(t, []string{MaskEmail("salt")("ada@example.com").(string), MaskEmail("salt")("bob@example.com").(string)}, emails)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRedactArgsOfSchemaQualifiedAndUntoldTables(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^UPDATE public.pii_customers").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("^CALL rename_customer").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger),
+		WithStatementLog(StatementLogConfig{PII: PIIClassification{"pii_customers.email": "email"}}))
+
+	uow.MustExec("UPDATE public.pii_customers SET email = ? WHERE id = ?", "ada@example.com", 1)
+	uow.MustExec("CALL rename_customer(?, ?)", 1, "ada@example.com")
+
+	assert.Equal(t, `level=INFO msg="db: statement" query="UPDATE public.pii_customers SET email = ? WHERE id = ?" in_tx=false args=2
+level=INFO msg="db: statement" query="CALL rename_customer(?, ?)" in_tx=false args=2
+`, buf.String())
+}
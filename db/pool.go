@@ -0,0 +1,121 @@
+package db
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// UoWPool hands out request-scoped UnitOfWork instances bound to the same
+// database, reusing them between requests to reduce allocations.
+// It is safe for concurrent use.
+type UoWPool struct {
+	db   *sqlx.DB
+	opts []Option
+	pool sync.Pool
+
+	mu          sync.Mutex
+	outstanding map[*unitOfWork]*Lease
+	trackStacks bool
+}
+
+// Lease describes an instance taken from the pool and not yet returned.
+type Lease struct {
+	AcquiredAt time.Time
+	Stack      string
+}
+
+// NewUoWPool creates a pool of UnitOfWork instances over db. When trackStacks is
+// true the acquiring stack is recorded on every Get, which makes leak reports
+// actionable at the cost of a runtime.Stack call per request. opts are applied
+// to every instance handed out.
+func NewUoWPool(db *sqlx.DB, trackStacks bool, opts ...Option) *UoWPool {
+	p := &UoWPool{
+		db:          db,
+		opts:        opts,
+		outstanding: map[*unitOfWork]*Lease{},
+		trackStacks: trackStacks,
+	}
+
+	p.pool.New = func() interface{} {
+		return &unitOfWork{}
+	}
+
+	return p
+}
+
+// Get returns a clean UnitOfWork configured with the pool options followed by
+// opts. It must be handed back with Put when the request finishes.
+func (p *UoWPool) Get(opts ...Option) UnitOfWork {
+	u := p.pool.Get().(*unitOfWork)
+	u.db = p.db
+	u.apply(p.opts)
+	u.apply(opts)
+
+	lease := &Lease{AcquiredAt: time.Now()}
+	if p.trackStacks {
+		buf := make([]byte, 4096)
+		lease.Stack = string(buf[:runtime.Stack(buf, false)])
+	}
+
+	p.mu.Lock()
+	p.outstanding[u] = lease
+	p.mu.Unlock()
+
+	return u
+}
+
+// Put returns uow to the pool. A transaction left open by the caller is
+// rolled back before the instance is reused.
+func (p *UoWPool) Put(uow UnitOfWork) {
+	u, ok := uow.(*unitOfWork)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	_, leased := p.outstanding[u]
+	delete(p.outstanding, u)
+	p.mu.Unlock()
+
+	if !leased {
+		Logger().Warn("db: UnitOfWork returned to a pool it was not taken from")
+		return
+	}
+
+	if u.tx != nil {
+		Logger().Warn("db: UnitOfWork returned to pool with an open transaction, rolling back")
+		u.logRollback(u.Rollback())
+	}
+
+	u.reset()
+	p.pool.Put(u)
+}
+
+// Leaks reports the instances that have been out of the pool for longer than
+// maxAge, which usually means a missing Put.
+func (p *UoWPool) Leaks(maxAge time.Duration) []Lease {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var leaks []Lease
+	for _, lease := range p.outstanding {
+		if now.Sub(lease.AcquiredAt) > maxAge {
+			leaks = append(leaks, *lease)
+		}
+	}
+
+	return leaks
+}
+
+// Outstanding returns the number of instances currently taken from the pool.
+func (p *UoWPool) Outstanding() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.outstanding)
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldTrackOutstandingInstances(t *testing.T) {
+	pool := NewUoWPool(nil, true)
+
+	uw := pool.Get()
+	assert.Equal(t, 1, pool.Outstanding())
+	assert.Len(t, pool.Leaks(0), 1)
+	assert.NotEmpty(t, pool.Leaks(0)[0].Stack)
+	assert.Empty(t, pool.Leaks(time.Hour))
+
+	pool.Put(uw)
+	assert.Equal(t, 0, pool.Outstanding())
+}
+
+func TestShouldRollbackOpenTransactionOnPut(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	pool := NewUoWPool(sqlx.NewDb(conn, "sqlmock"), false)
+	uw := pool.Get().(*unitOfWork)
+	uw.begin()
+
+	pool.Put(uw)
+
+	assert.Nil(t, uw.tx)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldIgnoreInstancesFromOtherPools(t *testing.T) {
+	pool := NewUoWPool(nil, false)
+
+	pool.Put(NewUnitOfWork(nil, nil))
+
+	assert.Equal(t, 0, pool.Outstanding())
+}
+
+func TestShouldNotHandOptionsStateToTheNextUser(t *testing.T) {
+	pool := NewUoWPool(nil, false)
+	stateful := func(u *unitOfWork) {
+		u.beginChecks = append(u.beginChecks, func(context.Context) error { return nil })
+	}
+
+	uw := pool.Get(stateful).(*unitOfWork)
+	pool.Put(uw)
+
+	assert.Empty(t, uw.beginChecks)
+
+	uw.apply([]Option{stateful})
+	assert.Len(t, uw.beginChecks, 1)
+}
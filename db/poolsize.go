@@ -0,0 +1,204 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PoolSizingConfig bounds and tunes an AdaptivePoolSizer.
+type PoolSizingConfig struct {
+	// MinOpenConns and MaxOpenConns bound the value applied to SetMaxOpenConns.
+	MinOpenConns int
+	MaxOpenConns int
+
+	// Step is how many connections are added or removed per adjustment.
+	Step int
+
+	// Interval is how often sql.DBStats is sampled.
+	Interval time.Duration
+
+	// GrowWaits is the number of new waits per interval that counts as pressure.
+	GrowWaits int64
+
+	// GrowAvgWait is the average wait per waiting request that counts as pressure.
+	GrowAvgWait time.Duration
+
+	// ShrinkUtilization is the in-use/max ratio below which the pool is considered oversized.
+	ShrinkUtilization float64
+
+	// Hysteresis is how many consecutive samples must agree before resizing.
+	Hysteresis int
+}
+
+func (c *PoolSizingConfig) defaults() {
+	if c.Step <= 0 {
+		c.Step = 1
+	}
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.GrowWaits <= 0 {
+		c.GrowWaits = 1
+	}
+	if c.ShrinkUtilization <= 0 {
+		c.ShrinkUtilization = 0.5
+	}
+	if c.Hysteresis <= 0 {
+		c.Hysteresis = 3
+	}
+	if c.MinOpenConns <= 0 {
+		c.MinOpenConns = 1
+	}
+	if c.MaxOpenConns < c.MinOpenConns {
+		c.MaxOpenConns = c.MinOpenConns
+	}
+}
+
+// AdaptivePoolSizer periodically adjusts MaxOpenConns of a database between the
+// configured bounds, growing when requests wait for connections and shrinking
+// when most of the pool sits idle.
+type AdaptivePoolSizer struct {
+	db     *sqlx.DB
+	config PoolSizingConfig
+
+	mu        sync.Mutex // guards current, read by Current while sampling
+	current   int
+	last      sql.DBStats
+	pressure  int
+	calm      int
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// NewAdaptivePoolSizer creates a sizer for db. The pool starts at MinOpenConns.
+func NewAdaptivePoolSizer(db *sqlx.DB, config PoolSizingConfig) *AdaptivePoolSizer {
+	config.defaults()
+
+	return &AdaptivePoolSizer{
+		db:      db,
+		config:  config,
+		current: config.MinOpenConns,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start applies the initial size and begins sampling in the background.
+func (s *AdaptivePoolSizer) Start() {
+	s.startOnce.Do(func() {
+		s.db.SetMaxOpenConns(s.Current())
+		s.last = s.db.Stats()
+
+		go s.loop()
+	})
+}
+
+// Stop ends sampling and waits for the background goroutine to exit. It is
+// safe to call in any state; a sizer stopped before Start never starts.
+func (s *AdaptivePoolSizer) Stop() {
+	s.startOnce.Do(func() {
+		close(s.done)
+	})
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+// Current returns the MaxOpenConns value most recently applied.
+func (s *AdaptivePoolSizer) Current() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.current
+}
+
+func (s *AdaptivePoolSizer) loop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if size, changed := s.observe(s.db.Stats()); changed {
+				s.db.SetMaxOpenConns(size)
+			}
+		}
+	}
+}
+
+// observe folds a new sample into the controller state and returns the size
+// the pool should have.
+func (s *AdaptivePoolSizer) observe(stats sql.DBStats) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	waits := stats.WaitCount - s.last.WaitCount
+	waited := stats.WaitDuration - s.last.WaitDuration
+	s.last = stats
+
+	var avgWait time.Duration
+	if waits > 0 {
+		avgWait = waited / time.Duration(waits)
+	}
+
+	underPressure := waits >= s.config.GrowWaits ||
+		(s.config.GrowAvgWait > 0 && avgWait >= s.config.GrowAvgWait)
+	oversized := waits == 0 &&
+		float64(stats.InUse) < float64(s.current)*s.config.ShrinkUtilization
+
+	switch {
+	case underPressure:
+		s.pressure++
+		s.calm = 0
+	case oversized:
+		s.calm++
+		s.pressure = 0
+	default:
+		s.pressure = 0
+		s.calm = 0
+	}
+
+	previous := s.current
+
+	if s.pressure >= s.config.Hysteresis {
+		s.current = minInt(s.current+s.config.Step, s.config.MaxOpenConns)
+		s.pressure = 0
+	}
+
+	if s.calm >= s.config.Hysteresis {
+		s.current = maxInt(s.current-s.config.Step, s.config.MinOpenConns)
+		s.calm = 0
+	}
+
+	if s.current == previous {
+		return s.current, false
+	}
+
+	Logger().Info("db: resizing pool", "from", previous, "to", s.current, "waits", waits, "avg_wait", avgWait, "in_use", stats.InUse)
+
+	return s.current, true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
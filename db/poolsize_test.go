@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldGrowPoolAfterSustainedWaits(t *testing.T) {
+	sizer := NewAdaptivePoolSizer(nil, PoolSizingConfig{MinOpenConns: 2, MaxOpenConns: 3, Hysteresis: 2})
+
+	size, changed := sizer.observe(sql.DBStats{WaitCount: 5, WaitDuration: time.Second, InUse: 2})
+	assert.False(t, changed)
+
+	size, changed = sizer.observe(sql.DBStats{WaitCount: 9, WaitDuration: 2 * time.Second, InUse: 2})
+	assert.True(t, changed)
+	assert.Equal(t, 3, size)
+
+	sizer.observe(sql.DBStats{WaitCount: 12, InUse: 3})
+	size, changed = sizer.observe(sql.DBStats{WaitCount: 15, InUse: 3})
+	assert.False(t, changed)
+	assert.Equal(t, 3, size)
+}
+
+func TestShouldShrinkIdlePoolWithinBounds(t *testing.T) {
+	sizer := NewAdaptivePoolSizer(nil, PoolSizingConfig{MinOpenConns: 1, MaxOpenConns: 10, Hysteresis: 1})
+	sizer.current = 2
+
+	size, changed := sizer.observe(sql.DBStats{InUse: 0})
+	assert.True(t, changed)
+	assert.Equal(t, 1, size)
+
+	size, changed = sizer.observe(sql.DBStats{InUse: 0})
+	assert.False(t, changed)
+	assert.Equal(t, 1, size)
+}
+
+func TestShouldResetStreakWhenSignalsDisagree(t *testing.T) {
+	sizer := NewAdaptivePoolSizer(nil, PoolSizingConfig{MinOpenConns: 1, MaxOpenConns: 10, Hysteresis: 2})
+
+	sizer.observe(sql.DBStats{WaitCount: 1})
+	sizer.observe(sql.DBStats{WaitCount: 1, InUse: 1})
+	_, changed := sizer.observe(sql.DBStats{WaitCount: 2})
+
+	assert.False(t, changed)
+	assert.Equal(t, 1, sizer.Current())
+}
+
+func TestShouldStopSizersInAnyState(t *testing.T) {
+	database, _ := newMockDatabase(t, "sqlmock")
+
+	idle := NewAdaptivePoolSizer(database, PoolSizingConfig{})
+	idle.Stop()
+	idle.Start()
+	idle.Stop()
+
+	running := NewAdaptivePoolSizer(database, PoolSizingConfig{Interval: time.Millisecond, MinOpenConns: 2})
+	running.Start()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 2, running.Current())
+		time.Sleep(time.Millisecond)
+	}
+	running.Stop()
+	running.Stop()
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidIdentifier is returned for tenant IDs, schemas, tables and
+// columns that are not plain lower case identifiers.
+var ErrInvalidIdentifier = errors.New("db: invalid identifier")
+
+// identifierPattern matches the identifiers provisioning accepts: unquoted
+// Postgres identifiers of at most 63 bytes, which need no quoting to be
+// referred to.
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// tenantIDPattern matches the tenant IDs accepted by the default schema name.
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ProvisionConfig configures a TenantProvisioner.
+type ProvisionConfig struct {
+	// Schema names the schema of a tenant. Zero means "tenant_" followed by
+	// the tenant ID, which must then be lower case letters, digits and
+	// underscores.
+	Schema func(tenantID string) string
+
+	// Tables lists the registered tables created in every tenant schema.
+	// Their columns get the type of the ddl tag of their field, e.g.
+	// `db:"total" ddl:"numeric(12,2)"`, or one inferred from its Go type.
+	// Columns are NOT NULL unless their field can hold NULL: a pointer, a
+	// sql.Null type or a byte slice. Foreign keys between the tables point
+	// into the tenant schema, others at the table referenced.
+	Tables []string
+}
+
+// TenantProvisioner creates the schema of a tenant and the tables of its
+// registered models, for schema-per-tenant deployments. Every statement is
+// built from model metadata and validated identifiers, never from input.
+type TenantProvisioner struct {
+	db     *sqlx.DB
+	config ProvisionConfig
+	tables []*Model
+}
+
+// NewTenantProvisioner returns a provisioner for the tables of config on db,
+// which must be Postgres. Tables are ordered so that referenced ones are
+// created first.
+func NewTenantProvisioner(db *sqlx.DB, config ProvisionConfig) (*TenantProvisioner, error) {
+	if err := requirePostgres(db, "tenant schemas"); err != nil {
+		return nil, err
+	}
+
+	p := &TenantProvisioner{db: db, config: config}
+	models := map[string]*Model{}
+	for _, table := range config.Tables {
+		m, err := ModelForTable(table)
+		if err != nil {
+			return nil, err
+		}
+		if m.ReadOnly {
+			return nil, fmt.Errorf("db: cannot provision %s, it is a view", table)
+		}
+		if err := validIdentifier("table", table); err != nil {
+			return nil, err
+		}
+		for _, c := range m.Columns {
+			if err := validIdentifier("column", c); err != nil {
+				return nil, err
+			}
+			if _, _, err := columnType(m, c); err != nil {
+				return nil, err
+			}
+		}
+		models[table] = m
+	}
+
+	ordered := make([]*Model, len(config.Tables))
+	for i, table := range config.Tables {
+		ordered[i] = models[table]
+	}
+	tables, err := ReferenceOrder(ordered)
+	if err != nil {
+		return nil, fmt.Errorf("db: cannot provision: %w", err)
+	}
+	p.tables = tables
+	return p, nil
+}
+
+// Statements returns the DDL provisioning tenantID. It only creates what is
+// missing, so running it again is harmless; tables that exist are left as
+// they are, whatever their columns.
+func (p *TenantProvisioner) Statements(tenantID string) ([]string, error) {
+	schema, err := p.schema(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	q := DialectPostgres.Quote
+	statements := []string{"CREATE SCHEMA IF NOT EXISTS " + q(schema)}
+	provisioned := map[string]bool{}
+	for _, m := range p.tables {
+		provisioned[m.Table] = true
+	}
+
+	for _, m := range p.tables {
+		required := map[string]bool{}
+		for _, c := range m.Required {
+			required[c] = true
+		}
+
+		columns := make([]string, 0, len(m.Columns))
+		for _, c := range m.Columns {
+			sqlType, nullable, _ := columnType(m, c)
+			definition := q(c) + " " + sqlType
+			switch {
+			case c == m.Key:
+				definition += " PRIMARY KEY"
+			case required[c] || !nullable:
+				definition += " NOT NULL"
+			}
+			if ref, ok := m.References[c]; ok {
+				if provisioned[ref] {
+					ref = schema + "." + ref
+				}
+				definition += " REFERENCES " + q(ref)
+			}
+			columns = append(columns, definition)
+		}
+
+		statements = append(statements, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+			q(schema+"."+m.Table), strings.Join(columns, ", ")))
+	}
+	return statements, nil
+}
+
+// Plan writes the statements ProvisionTenant would run for tenantID to w,
+// one per line, without running them.
+func (p *TenantProvisioner) Plan(tenantID string, w io.Writer) error {
+	statements, err := p.Statements(tenantID)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	for _, s := range statements {
+		out.WriteString(s)
+		out.WriteString(";\n")
+	}
+	return out.Flush()
+}
+
+// ProvisionTenant creates the schema and tables of tenantID in a single
+// transaction, holding an advisory lock on the schema name so that
+// concurrent onboarding of the same tenant waits rather than races.
+func (p *TenantProvisioner) ProvisionTenant(ctx context.Context, tenantID string) error {
+	statements, err := p.Statements(tenantID)
+	if err != nil {
+		return err
+	}
+	schema, _ := p.schema(tenantID)
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", schema); err != nil {
+		return err
+	}
+	for _, s := range statements {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			return fmt.Errorf("db: provisioning tenant %s: %w", tenantID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// schema returns the validated schema name of tenantID.
+func (p *TenantProvisioner) schema(tenantID string) (string, error) {
+	if p.config.Schema != nil {
+		schema := p.config.Schema(tenantID)
+		return schema, validIdentifier("schema", schema)
+	}
+
+	if !tenantIDPattern.MatchString(tenantID) {
+		return "", fmt.Errorf("%w: tenant ID %q", ErrInvalidIdentifier, tenantID)
+	}
+	schema := "tenant_" + tenantID
+	return schema, validIdentifier("schema", schema)
+}
+
+func validIdentifier(kind, name string) error {
+	if !identifierPattern.MatchString(name) {
+		return fmt.Errorf("%w: %s %q", ErrInvalidIdentifier, kind, name)
+	}
+	return nil
+}
+
+var (
+	decimalType    = reflect.TypeOf(Decimal{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	bytesType      = reflect.TypeOf([]byte{})
+)
+
+// nullTypes maps the sql.Null types to the Postgres type they hold.
+var nullTypes = map[reflect.Type]string{
+	reflect.TypeOf(sql.NullString{}):  "text",
+	reflect.TypeOf(sql.NullInt64{}):   "bigint",
+	reflect.TypeOf(sql.NullInt32{}):   "integer",
+	reflect.TypeOf(sql.NullInt16{}):   "smallint",
+	reflect.TypeOf(sql.NullByte{}):    "smallint",
+	reflect.TypeOf(sql.NullFloat64{}): "double precision",
+	reflect.TypeOf(sql.NullBool{}):    "boolean",
+	reflect.TypeOf(sql.NullTime{}):    "timestamptz",
+}
+
+// columnType returns the Postgres type of column of m and whether its field
+// can hold NULL, i.e. is a pointer, a sql.Null type or a byte slice.
+func columnType(m *Model, column string) (string, bool, error) {
+	field := m.fields[column].Field
+	t := field.Type
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	if ddl := field.Tag.Get("ddl"); ddl != "" {
+		return ddl, nullable || nullTypes[t] != "" || t.Kind() == reflect.Slice, nil
+	}
+	if sqlType, ok := nullTypes[t]; ok {
+		return sqlType, true, nil
+	}
+
+	switch t {
+	case timeType:
+		return "timestamptz", nullable, nil
+	case decimalType:
+		return "numeric", nullable, nil
+	case rawMessageType:
+		return "jsonb", true, nil
+	case bytesType:
+		return "bytea", true, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean", nullable, nil
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "bigint", nullable, nil
+	case reflect.Uint, reflect.Uint64:
+		return "numeric(20)", nullable, nil
+	case reflect.Int32, reflect.Uint16:
+		return "integer", nullable, nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint", nullable, nil
+	case reflect.Float32:
+		return "real", nullable, nil
+	case reflect.Float64:
+		return "double precision", nullable, nil
+	case reflect.String:
+		return "text", nullable, nil
+	}
+	return "", false, fmt.Errorf("db: no column type for %s.%s of type %s, give it a ddl tag", m.Table, column, field.Type)
+}
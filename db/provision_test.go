@@ -0,0 +1,89 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type provisionCustomer struct {
+	ID    int64   `db:"id"`
+	Name  string  `db:"name"`
+	Email *string `db:"email,notnull"`
+}
+
+type provisionInvoice struct {
+	ID         int64          `db:"id"`
+	CustomerID int64          `db:"customer_id,ref=provision_customers"`
+	Currency   int64          `db:"currency_id,ref=currencies"`
+	Total      Decimal        `db:"total" ddl:"numeric(12,2)"`
+	IssuedAt   time.Time      `db:"issued_at"`
+	Note       sql.NullString `db:"note"`
+}
+
+func init() {
+	MustRegister(provisionCustomer{}, "provision_customers")
+	MustRegister(provisionInvoice{}, "provision_invoices")
+}
+
+func TestShouldPlanTenantProvisioningFromModels(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+	provisioner, err := NewTenantProvisioner(database, ProvisionConfig{Tables: []string{"provision_invoices", "provision_customers"}})
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, provisioner.Plan("acme", &buf))
+
+	assert.Equal(t, `CREATE SCHEMA IF NOT EXISTS "tenant_acme";
+CREATE TABLE IF NOT EXISTS "tenant_acme"."provision_customers" ("id" bigint PRIMARY KEY, "name" text NOT NULL, "email" text NOT NULL);
+CREATE TABLE IF NOT EXISTS "tenant_acme"."provision_invoices" ("id" bigint PRIMARY KEY, "customer_id" bigint NOT NULL REFERENCES "tenant_acme"."provision_customers", "currency_id" bigint NOT NULL REFERENCES "currencies", "total" numeric(12,2) NOT NULL, "issued_at" timestamptz NOT NULL, "note" text);
+`, buf.String())
+}
+
+func TestShouldProvisionTenantInOneTransaction(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	provisioner, err := NewTenantProvisioner(database, ProvisionConfig{
+		Schema: func(tenantID string) string { return "customer_" + tenantID },
+		Tables: []string{"provision_customers"},
+	})
+	assert.Nil(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock(hashtext($1))")).
+		WithArgs("customer_42").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE SCHEMA IF NOT EXISTS "customer_42"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "customer_42"."provision_customers"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	assert.Nil(t, provisioner.ProvisionTenant(context.Background(), "42"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseInvalidProvisioningIdentifiers(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	provisioner, err := NewTenantProvisioner(database, ProvisionConfig{Tables: []string{"provision_customers"}})
+	assert.Nil(t, err)
+
+	err = provisioner.ProvisionTenant(context.Background(), `acme"; DROP SCHEMA public; --`)
+	assert.ErrorIs(t, err, ErrInvalidIdentifier)
+
+	provisioner, err = NewTenantProvisioner(database, ProvisionConfig{Schema: func(tenantID string) string { return "Tenant-" + tenantID }})
+	assert.Nil(t, err)
+	_, err = provisioner.Statements("acme")
+	assert.EqualError(t, err, `db: invalid identifier: schema "Tenant-acme"`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	_, err = NewTenantProvisioner(database, ProvisionConfig{Tables: []string{"provision_unknown"}})
+	assert.EqualError(t, err, "db: no model registered for table provision_unknown")
+
+	mysql, _ := newMockDatabase(t, "mysql")
+	_, err = NewTenantProvisioner(mysql, ProvisionConfig{})
+	assert.EqualError(t, err, "db: tenant schemas require postgres, not mysql")
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrSessionState is returned, for databases in proxy compatibility mode, for
+// statements relying on session state, which a transaction-pooling proxy such
+// as pgbouncer does not keep between transactions.
+var ErrSessionState = errors.New("db: statement relies on session state")
+
+var proxied sync.Map // *sqlx.DB -> struct{}
+
+// EnableProxyCompatibility puts db in proxy compatibility mode, for databases
+// reached through a transaction-pooling proxy: consecutive transactions of a
+// client connection may run on different server connections, so anything
+// outliving a transaction leaks to other clients or vanishes. In this mode
+// every UnitOfWork over db rejects such statements with ErrSessionState
+// (SET and RESET outside of SET LOCAL, PREPARE, DEALLOCATE, LISTEN, UNLISTEN,
+// cursors WITH HOLD, temporary tables outliving their transaction and session
+// advisory locks), and PinStatementTemplates refuses db. Open db with a DSN
+// from ProxyCompatibleDSN so that lib/pq never splits a statement across
+// server connections either.
+func EnableProxyCompatibility(db *sqlx.DB) {
+	proxied.Store(db, struct{}{})
+}
+
+// DisableProxyCompatibility takes db out of proxy compatibility mode.
+func DisableProxyCompatibility(db *sqlx.DB) {
+	proxied.Delete(db)
+}
+
+// ProxyCompatible reports whether db is in proxy compatibility mode.
+func ProxyCompatible(db *sqlx.DB) bool {
+	_, ok := proxied.Load(db)
+	return ok
+}
+
+// ProxyCompatibleDSN returns a lib/pq DSN, in URL or key=value form, with
+// binary_parameters enabled: parameterized statements then go out as one
+// unnamed Parse, Bind and Execute exchange instead of a separate prepare
+// round trip that a proxy may route to another server connection.
+func ProxyCompatibleDSN(dsn string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("db: invalid DSN: %w", err)
+		}
+		query := u.Query()
+		query.Set("binary_parameters", "yes")
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	var fields []string
+	for _, field := range strings.Fields(dsn) {
+		if !strings.HasPrefix(field, "binary_parameters=") {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(append(fields, "binary_parameters=yes"), " "), nil
+}
+
+// DetectTransactionPooling probes whether db reaches Postgres through a
+// transaction-pooling proxy. One client connection holds a transaction open,
+// pinning a server connection, while another checks whether its backend
+// changed in the meantime, which only happens when client connections are
+// multiplexed. A proxy with a single server connection makes the check wait;
+// after timeout, zero meaning 2 seconds, that also counts as pooling.
+func DetectTransactionPooling(ctx context.Context, db *sqlx.DB, timeout time.Duration) (bool, error) {
+	if err := requirePostgres(db, "pooling probes"); err != nil {
+		return false, err
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	probe, err := db.DB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer probe.Close()
+
+	var before, after int64
+	if err := probe.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&before); err != nil {
+		return false, err
+	}
+
+	holder, err := db.DB.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer holder.Close()
+
+	tx, err := holder.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var held int64
+	if err := tx.QueryRowContext(ctx, "SELECT pg_backend_pid()").Scan(&held); err != nil {
+		return false, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err = probe.QueryRowContext(waitCtx, "SELECT pg_backend_pid()").Scan(&after)
+	if err != nil {
+		if waitCtx.Err() != nil && ctx.Err() == nil {
+			return true, nil
+		}
+		return false, err
+	}
+	return after != before, nil
+}
+
+// checkSessionState returns ErrSessionState when db is in proxy compatibility
+// mode and stmt would leave state on its server connection.
+func checkSessionState(db *sqlx.DB, stmt *Statement) error {
+	if db == nil || !ProxyCompatible(db) {
+		return nil
+	}
+
+	if reason := sessionState(lexSQLFor(DialectFor(stmt.Driver), stmt.Query), stmt.InTx); reason != "" {
+		return fmt.Errorf("%w: %s", ErrSessionState, reason)
+	}
+	return nil
+}
+
+var sessionAdvisoryLocks = map[string]bool{
+	"pg_advisory_lock": true, "pg_advisory_lock_shared": true,
+	"pg_try_advisory_lock": true, "pg_try_advisory_lock_shared": true,
+}
+
+func sessionState(tokens []sqlToken, inTx bool) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	has := func(keyword string) bool {
+		for _, t := range tokens {
+			if t.is(keyword) {
+				return true
+			}
+		}
+		return false
+	}
+
+	first := tokens[0]
+	switch {
+	case first.is("set"):
+		if len(tokens) > 1 && (tokens[1].is("local") || tokens[1].is("transaction") || tokens[1].is("constraints")) {
+			return ""
+		}
+		return "SET outlives the transaction, use SET LOCAL"
+	case first.is("reset"), first.is("prepare"), first.is("deallocate"), first.is("listen"), first.is("unlisten"):
+		return strings.ToUpper(first.text) + " acts on the session"
+	case first.is("declare") && has("hold"):
+		return "cursors WITH HOLD outlive the transaction"
+	case first.is("create") && (has("temp") || has("temporary")):
+		if !inTx || !dropsOnCommit(tokens) {
+			return "temporary tables outlive the transaction, create them ON COMMIT DROP in a transaction"
+		}
+	}
+
+	for i, t := range tokens {
+		if t.kind == sqlWord && sessionAdvisoryLocks[strings.ToLower(t.text)] && i+1 < len(tokens) && tokens[i+1].text == "(" {
+			return t.text + " takes a session lock, use pg_advisory_xact_lock"
+		}
+	}
+	return ""
+}
+
+// dropsOnCommit reports whether a CREATE TEMP TABLE says ON COMMIT DROP, the
+// only ON COMMIT action not leaving the table to the session.
+func dropsOnCommit(tokens []sqlToken) bool {
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].is("on") && tokens[i+1].is("commit") && tokens[i+2].is("drop") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRejectSessionStateInProxyCompatibilityMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	EnableProxyCompatibility(database)
+	defer DisableProxyCompatibility(database)
+
+	uow := NewUnitOfWork(database, nil)
+	for _, query := range []string{
+		"SET search_path TO billing",
+		"SET SESSION statement_timeout = 0",
+		"RESET ALL",
+		"PREPARE q AS SELECT 1",
+		"LISTEN changes",
+		"DECLARE c CURSOR WITH HOLD FOR SELECT 1",
+		"CREATE TEMP TABLE scratch (id int)",
+		"SELECT pg_advisory_lock(42)",
+	} {
+		_, err := uow.Query(query)
+		assert.True(t, errors.Is(err, ErrSessionState), query)
+	}
+
+	_, err := PinStatementTemplates(context.Background(), database)
+	assert.True(t, errors.Is(err, ErrSessionState))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldAllowTransactionScopedStateInProxyCompatibilityMode(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	EnableProxyCompatibility(database)
+	defer DisableProxyCompatibility(database)
+
+	mock.ExpectBegin()
+	for _, query := range []string{
+		"SET LOCAL statement_timeout = '5s'",
+		"SELECT pg_advisory_xact_lock\\(42\\)",
+		"CREATE TEMP TABLE scratch \\(id int\\) ON COMMIT DROP",
+		"SELECT 'SET search_path'",
+	} {
+		mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	tx, _ := database.Beginx()
+	uow := NewUnitOfWork(database, tx)
+	uow.MustExec("SET LOCAL statement_timeout = '5s'")
+	uow.MustExec("SELECT pg_advisory_xact_lock(42)")
+	uow.MustExec("CREATE TEMP TABLE scratch (id int) ON COMMIT DROP")
+	uow.MustExec("SELECT 'SET search_path'")
+
+	for _, query := range []string{
+		"CREATE TEMP TABLE kept (id int) ON COMMIT DELETE ROWS",
+		"CREATE TEMPORARY TABLE kept (id int) ON COMMIT PRESERVE ROWS",
+	} {
+		_, err := uow.Exec(query)
+		assert.True(t, errors.Is(err, ErrSessionState), query)
+	}
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLeaveDatabasesOutsideProxyModeAlone(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("SET search_path").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	NewUnitOfWork(database, nil).MustExec("SET search_path TO billing")
+
+	assert.False(t, ProxyCompatible(database))
+}
+
+func TestShouldEnableBinaryParametersInDSN(t *testing.T) {
+	for dsn, expected := range map[string]string{
+		"postgres://app:pw@bouncer:6432/app?sslmode=disable": "postgres://app:pw@bouncer:6432/app?binary_parameters=yes&sslmode=disable",
+		"host=bouncer port=6432 binary_parameters=no":        "host=bouncer port=6432 binary_parameters=yes",
+	} {
+		actual, err := ProxyCompatibleDSN(dsn)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestShouldDetectTransactionPoolingFromBackendChange(t *testing.T) {
+	for pid, pooled := range map[int]bool{100: false, 200: true} {
+		database, mock := newMockDatabase(t, "postgres")
+		mock.ExpectQuery("SELECT pg_backend_pid").WillReturnRows(sqlmock.NewRows([]string{"pid"}).AddRow(100))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT pg_backend_pid").WillReturnRows(sqlmock.NewRows([]string{"pid"}).AddRow(100))
+		mock.ExpectQuery("SELECT pg_backend_pid").WillReturnRows(sqlmock.NewRows([]string{"pid"}).AddRow(pid))
+		mock.ExpectRollback()
+
+		detected, err := DetectTransactionPooling(context.Background(), database, time.Second)
+
+		assert.Nil(t, err)
+		assert.Equal(t, pooled, detected)
+	}
+}
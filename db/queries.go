@@ -0,0 +1,215 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrUnknownQuery is returned for names a QueryRegistry has no query for.
+var ErrUnknownQuery = errors.New("db: unknown query")
+
+// QueryRegistry holds named queries kept in .sql files, so that their text
+// stays out of Go code. Like a Repository it is long lived and takes the
+// UnitOfWork to run in on every call.
+type QueryRegistry struct {
+	queries map[string]string
+}
+
+// LoadQueries reads the queries of the .sql files of fsys, e.g. an embed.FS.
+// A file holds one query named after its path without the extension, or
+// several, each following a name comment and named after the file and it.
+// The file users.sql
+//
+//	-- name: find-by-email
+//	SELECT * FROM users WHERE email = ?
+//
+//	-- name: deactivate
+//	UPDATE users SET active = FALSE WHERE id = ?
+//
+// gives users/find-by-email and users/deactivate. Queries take ? placeholders,
+// rebound for the driver they run on, and must be a single statement.
+func LoadQueries(fsys fs.FS) (*QueryRegistry, error) {
+	r := &QueryRegistry{queries: map[string]string{}}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != ".sql" {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return r.parse(strings.TrimSuffix(name, ".sql"), string(data))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MustLoadQueries is like LoadQueries but panics on error, for package-level
+// setup.
+func MustLoadQueries(fsys fs.FS) *QueryRegistry {
+	r, err := LoadQueries(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// parse adds the queries of file, whose path without extension is prefix.
+func (r *QueryRegistry) parse(prefix, file string) error {
+	type section struct {
+		name string
+		text strings.Builder
+	}
+	sections := []*section{{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(file))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := queryName(line); ok {
+			sections = append(sections, &section{name: name})
+			continue
+		}
+		current := sections[len(sections)-1]
+		current.text.WriteString(line)
+		current.text.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(sections) == 1 {
+		return r.add(prefix, sections[0].text.String())
+	}
+	if len(lexSQL(sections[0].text.String())) > 0 {
+		return fmt.Errorf("db: query file %s.sql has SQL before its first name", prefix)
+	}
+	for _, s := range sections[1:] {
+		if err := r.add(prefix+"/"+s.name, s.text.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryName returns the name of a "-- name: ..." line.
+func queryName(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "--")
+	if !ok {
+		return "", false
+	}
+	if rest, ok = strings.CutPrefix(strings.TrimSpace(rest), "name:"); !ok {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
+func (r *QueryRegistry) add(name, text string) error {
+	if _, ok := r.queries[name]; ok {
+		return fmt.Errorf("db: query %s defined twice", name)
+	}
+
+	statements := scriptStatements(DialectANSI, text)
+	switch {
+	case len(statements) == 0:
+		return fmt.Errorf("db: query %s is empty", name)
+	case len(statements) > 1:
+		return fmt.Errorf("db: query %s holds %d statements, not one", name, len(statements))
+	}
+
+	r.queries[name] = statements[0].sql
+	return nil
+}
+
+// Names returns the names of the queries, sorted.
+func (r *QueryRegistry) Names() []string {
+	names := make([]string, 0, len(r.queries))
+	for name := range r.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SQL returns the text of the named query.
+func (r *QueryRegistry) SQL(name string) (string, error) {
+	query, ok := r.queries[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownQuery, name)
+	}
+	return query, nil
+}
+
+// Validate prepares every query on database, so that syntax errors and
+// references to missing tables or columns fail at startup rather than on
+// first use. Every failure is reported.
+func (r *QueryRegistry) Validate(ctx context.Context, database *sqlx.DB) error {
+	var errs []error
+	for _, name := range r.Names() {
+		stmt, err := database.PreparexContext(ctx, rebind(database.DriverName(), r.queries[name]))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("db: query %s: %w", name, err))
+			continue
+		}
+		stmt.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// prepare returns the named query rebound for uow, and a context labelling
+// its statement with the name.
+func (r *QueryRegistry) prepare(uow UnitOfWork, name string) (context.Context, string, error) {
+	query, err := r.SQL(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return WithLabel(contextOf(uow), name), rebind(uow.DriverName(), query), nil
+}
+
+// Get runs the named query like UnitOfWork.Get, labelled with its name.
+func (r *QueryRegistry) Get(uow UnitOfWork, dest interface{}, name string, args ...interface{}) error {
+	ctx, query, err := r.prepare(uow, name)
+	if err != nil {
+		return err
+	}
+	return uow.GetContext(ctx, dest, query, args...)
+}
+
+// Select runs the named query like UnitOfWork.Select, labelled with its name.
+func (r *QueryRegistry) Select(uow UnitOfWork, dest interface{}, name string, args ...interface{}) error {
+	ctx, query, err := r.prepare(uow, name)
+	if err != nil {
+		return err
+	}
+	return uow.SelectContext(ctx, dest, query, args...)
+}
+
+// Query runs the named query like UnitOfWork.Query, labelled with its name.
+func (r *QueryRegistry) Query(uow UnitOfWork, name string, args ...interface{}) (*sqlx.Rows, error) {
+	ctx, query, err := r.prepare(uow, name)
+	if err != nil {
+		return nil, err
+	}
+	return uow.QueryContext(ctx, query, args...)
+}
+
+// Exec runs the named query like UnitOfWork.Exec, labelled with its name.
+func (r *QueryRegistry) Exec(uow UnitOfWork, name string, args ...interface{}) (sql.Result, error) {
+	ctx, query, err := r.prepare(uow, name)
+	if err != nil {
+		return nil, err
+	}
+	return uow.ExecContext(ctx, query, args...)
+}
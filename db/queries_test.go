@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var queryFiles = fstest.MapFS{
+	"users.sql": {Data: []byte(`-- queries of the users screen
+
+-- name: find-by-email
+SELECT * FROM users WHERE email = ?;
+
+-- name: deactivate
+-- keeps the row for the audit trail
+UPDATE users SET active = FALSE WHERE id = ?
+`)},
+	"reports/monthly_revenue.sql": {Data: []byte("SELECT month, SUM(total) FROM invoices GROUP BY month\n")},
+	"README.md":                   {Data: []byte("not a query")},
+}
+
+func TestShouldLoadNamedQueriesFromFiles(t *testing.T) {
+	registry, err := LoadQueries(queryFiles)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"reports/monthly_revenue", "users/deactivate", "users/find-by-email"}, registry.Names())
+	query, err := registry.SQL("users/deactivate")
+	assert.Nil(t, err)
+	assert.Equal(t, "-- keeps the row for the audit trail\nUPDATE users SET active = FALSE WHERE id = ?", query)
+	_, err = registry.SQL("users/delete")
+	assert.ErrorIs(t, err, ErrUnknownQuery)
+}
+
+func TestShouldRejectInvalidQueryFiles(t *testing.T) {
+	_, err := LoadQueries(fstest.MapFS{"users.sql": {Data: []byte("SELECT 1;\n-- name: find\nSELECT 2")}})
+	assert.EqualError(t, err, "db: query file users.sql has SQL before its first name")
+
+	_, err = LoadQueries(fstest.MapFS{"users.sql": {Data: []byte("-- name: find\nSELECT 1;\n-- name: find\nSELECT 2")}})
+	assert.EqualError(t, err, "db: query users/find defined twice")
+
+	_, err = LoadQueries(fstest.MapFS{"users.sql": {Data: []byte("-- name: purge\nDELETE FROM a; DELETE FROM b;\n-- name: none\n-- nothing")}})
+	assert.EqualError(t, err, "db: query users/purge holds 2 statements, not one")
+
+	_, err = LoadQueries(fstest.MapFS{"users.sql": {Data: []byte("-- name: none\n-- nothing")}})
+	assert.EqualError(t, err, "db: query users/none is empty")
+}
+
+func TestShouldRunNamedQueriesLabelledWithTheirName(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`^SELECT \* FROM users WHERE email = \$1$`).
+		WithArgs("ada@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "active"))
+	mock.ExpectExec(`^-- keeps the row for the audit trail UPDATE users SET active = FALSE WHERE id = \$1$`).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var labels []string
+	uow := NewUnitOfWork(database, nil, WithInterceptors(func(ctx context.Context, stmt *Statement, next Handler) error {
+		labels = append(labels, stmt.Label)
+		return next(ctx, stmt)
+	}))
+	registry := MustLoadQueries(queryFiles)
+
+	var user repositoryOrder
+	assert.Nil(t, registry.Get(uow, &user, "users/find-by-email", "ada@example.com"))
+	_, err := registry.Exec(uow, "users/deactivate", user.ID)
+
+	assert.Nil(t, err)
+	assert.Equal(t, repositoryOrder{ID: 7, Status: "active"}, user)
+	assert.Equal(t, []string{"users/find-by-email", "users/deactivate"}, labels)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldValidateEveryQueryAgainstTheDatabase(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectPrepare(`^SELECT month`).WillReturnError(errors.New(`relation "invoices" does not exist`))
+	mock.ExpectPrepare(`^-- keeps the row`).WillBeClosed()
+	mock.ExpectPrepare(`^SELECT \* FROM users WHERE email = \$1$`).WillBeClosed()
+
+	err := MustLoadQueries(queryFiles).Validate(context.Background(), database)
+
+	assert.EqualError(t, err, `db: query reports/monthly_revenue: relation "invoices" does not exist`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRebindOnlyThePlaceholdersOfNamedQueries(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectPrepare(`^-- who\? SELECT \* FROM users WHERE name LIKE '%\?' AND id = \$1$`).WillBeClosed()
+	mock.ExpectQuery(`^-- who\? SELECT \* FROM users WHERE name LIKE '%\?' AND id = \$1$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "active"))
+
+	registry := MustLoadQueries(fstest.MapFS{
+		"search.sql": {Data: []byte("-- who?\nSELECT * FROM users WHERE name LIKE '%?' AND id = ?\n")},
+	})
+
+	var user repositoryOrder
+	assert.Nil(t, registry.Validate(context.Background(), database))
+	assert.Nil(t, registry.Get(NewUnitOfWork(database, nil), &user, "search", 7))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
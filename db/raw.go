@@ -0,0 +1,52 @@
+package db
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// Raw holds the bytes of a column untouched, e.g. a JSONB document served
+// as is in an HTTP response without decoding and encoding it again. Unlike
+// sql.RawBytes it owns its bytes and can outlive the rows it was scanned
+// from. It marshals to JSON as is, like json.RawMessage, encoding/json only
+// compacting it; write it to the response directly to skip that too. NULL is
+// nil, marshalled as null.
+type Raw []byte
+
+// Scan implements the Scanner interface.
+func (r *Raw) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+	case []byte:
+		*r = append((*r)[:0:0], v...)
+	case string:
+		*r = Raw(v)
+	default:
+		return fmt.Errorf("db: cannot scan %T into Raw", value)
+	}
+	return nil
+}
+
+// Value implements the driver Valuer interface. Raw is passed as text, so
+// drivers do not send it as binary data to JSON columns.
+func (r Raw) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return string(r), nil
+}
+
+// MarshalJSON implements json.Marshaler, writing r verbatim.
+func (r Raw) MarshalJSON() ([]byte, error) {
+	if r == nil {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, keeping a copy of data.
+func (r *Raw) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[:0:0], data...)
+	return nil
+}
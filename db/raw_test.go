@@ -0,0 +1,39 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldPassRawColumnsThrough(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery("^SELECT id, document FROM orders$").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "document"}).
+			AddRow(1, []byte(`{"items": [1, 2]}`)).
+			AddRow(2, nil))
+
+	type order struct {
+		ID       int64 `db:"id" json:"id"`
+		Document Raw   `db:"document" json:"document"`
+	}
+	var orders []order
+	assert.Nil(t, uw.Select(&orders, "SELECT id, document FROM orders"))
+
+	body, err := json.Marshal(orders)
+	assert.Nil(t, err)
+	assert.Equal(t, `[{"id":1,"document":{"items":[1,2]}},{"id":2,"document":null}]`, string(body))
+}
+
+func TestShouldOwnScannedBytes(t *testing.T) {
+	buffer := []byte(`{"a":1}`)
+	var r Raw
+	assert.Nil(t, r.Scan(buffer))
+	buffer[2] = 'b'
+
+	assert.Equal(t, Raw(`{"a":1}`), r)
+	value, _ := r.Value()
+	assert.Equal(t, `{"a":1}`, value)
+}
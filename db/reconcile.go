@@ -0,0 +1,360 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReconcileQuery is one side of a reconciliation: a query and the database it
+// runs on.
+type ReconcileQuery struct {
+	DB    *sqlx.DB
+	Query string
+	Args  []interface{}
+}
+
+// ReconcileOptions tunes Reconcile.
+type ReconcileOptions struct {
+	// Partitions is the number of buckets rows are spilled to. Memory use is
+	// bounded by the largest bucket of the source, so very large result sets
+	// want more partitions. Zero means 64.
+	Partitions int
+
+	// MaxSamples caps the keys kept for each kind of difference. Zero means
+	// 100; counts are always exact.
+	MaxSamples int
+
+	// TempDir holds the spilled buckets. Empty means os.TempDir().
+	TempDir string
+
+	// Options configure the unit of work reading each side, over the DB of
+	// that side, e.g. WithStatementLog. The queries run outside a
+	// transaction.
+	Options []Option
+}
+
+// DiffReport describes how the rows of a target differ from a source.
+// Keys are the key column values of the rows, as text.
+type DiffReport struct {
+	SourceRows int64
+	TargetRows int64
+
+	// Missing counts source rows absent from the target, Extra target rows
+	// absent from the source and Mismatched rows present in both with
+	// different values.
+	Missing    int64
+	Extra      int64
+	Mismatched int64
+
+	MissingKeys    [][]string
+	ExtraKeys      [][]string
+	MismatchedKeys [][]string
+}
+
+// Equal reports whether source and target hold the same rows.
+func (r *DiffReport) Equal() bool {
+	return r.Missing == 0 && r.Extra == 0 && r.Mismatched == 0
+}
+
+// Reconcile compares the rows returned by the source and target queries,
+// matched by keyColumns, which must be unique on both sides. Both queries
+// must return the same column names, in any order; values are compared by
+// content, so a CHAR read as bytes on one database matches a string on
+// another, and an integer, float or boolean matches its decimal text, e.g.
+// 12.5 matches "12.50" and true "1".
+//
+// Rows are streamed, hashed and spilled to temporary files partitioned by
+// key, then compared one partition at a time, so result sets larger than
+// memory can be reconciled.
+func Reconcile(ctx context.Context, source, target ReconcileQuery, keyColumns []string, opts ReconcileOptions) (*DiffReport, error) {
+	if len(keyColumns) == 0 {
+		return nil, errors.New("db: no key columns to reconcile on")
+	}
+	if opts.Partitions <= 0 {
+		opts.Partitions = 64
+	}
+	if opts.MaxSamples <= 0 {
+		opts.MaxSamples = 100
+	}
+
+	dir, err := os.MkdirTemp(opts.TempDir, "reconcile-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	report := &DiffReport{}
+
+	report.SourceRows, err = spillRows(ctx, source, keyColumns, filepath.Join(dir, "source"), opts)
+	if err != nil {
+		return nil, fmt.Errorf("db: reconciling source: %w", err)
+	}
+	report.TargetRows, err = spillRows(ctx, target, keyColumns, filepath.Join(dir, "target"), opts)
+	if err != nil {
+		return nil, fmt.Errorf("db: reconciling target: %w", err)
+	}
+
+	for p := 0; p < opts.Partitions; p++ {
+		if err := comparePartition(dir, p, report, opts.MaxSamples); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// reconcileValue returns value as text the same whichever driver read it:
+// bytes as a string, numbers and booleans as decimals without trailing
+// fractional zeros, times in UTC to the microsecond. NULL stays nil.
+func reconcileValue(value interface{}) interface{} {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		rv := reflect.ValueOf(value)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return strconv.FormatUint(rv.Uint(), 10)
+		}
+		return fmt.Sprint(value)
+	}
+
+	// decimals read as text, e.g. NUMERIC, lose their trailing zeros
+	if decimalText.MatchString(text) && strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
+
+var decimalText = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// spillRows runs q and writes a record per row, its encoded key and the hash
+// of its other columns, to the partition files prefix.N.
+func spillRows(ctx context.Context, q ReconcileQuery, keyColumns []string, prefix string, opts ReconcileOptions) (int64, error) {
+	u := &unitOfWork{db: q.DB, ctx: ctx}
+	u.apply(opts.Options)
+
+	files := make([]*os.File, opts.Partitions)
+	writers := make([]*bufio.Writer, opts.Partitions)
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+	}()
+
+	for p := range files {
+		f, err := os.Create(fmt.Sprintf("%s.%d", prefix, p))
+		if err != nil {
+			return 0, err
+		}
+		files[p], writers[p] = f, bufio.NewWriter(f)
+	}
+
+	rows, err := u.query(ctx, q.Query, q.Args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]int, len(keyColumns))
+	for i, k := range keyColumns {
+		if keys[i] = indexOf(columns, k); keys[i] < 0 {
+			return 0, fmt.Errorf("key column %s is not returned by the query", k)
+		}
+	}
+
+	// hash the other columns by name, so their order does not matter
+	var others []int
+	for i := range columns {
+		if indexOf(keyColumns, columns[i]) < 0 {
+			others = append(others, i)
+		}
+	}
+	sort.Slice(others, func(a, b int) bool { return columns[others[a]] < columns[others[b]] })
+
+	var count int64
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return count, err
+		}
+		for i, v := range values {
+			values[i] = reconcileValue(v)
+		}
+
+		var key []byte
+		for _, i := range keys {
+			key = appendField(key, valueKey(values[i]))
+		}
+
+		h := sha256.New()
+		for _, i := range others {
+			if err := writeChecksumValue(h, columns[i], values[i]); err != nil {
+				return count, fmt.Errorf("column %s: %w", columns[i], err)
+			}
+		}
+
+		w := writers[partitionOf(key, opts.Partitions)]
+		w.Write(appendField(nil, string(key)))
+		if _, err := w.Write(h.Sum(nil)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	for _, w := range writers {
+		if err := w.Flush(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+func comparePartition(dir string, p int, report *DiffReport, maxSamples int) error {
+	source := map[string][sha256.Size]byte{}
+	err := readPartition(filepath.Join(dir, fmt.Sprintf("source.%d", p)), func(key string, sum [sha256.Size]byte) {
+		source[key] = sum
+	})
+	if err != nil {
+		return err
+	}
+
+	sample := func(keys *[][]string, key string) {
+		if len(*keys) < maxSamples {
+			*keys = append(*keys, decodeFields(key))
+		}
+	}
+
+	err = readPartition(filepath.Join(dir, fmt.Sprintf("target.%d", p)), func(key string, sum [sha256.Size]byte) {
+		expected, ok := source[key]
+		switch {
+		case !ok:
+			report.Extra++
+			sample(&report.ExtraKeys, key)
+		case expected != sum:
+			report.Mismatched++
+			sample(&report.MismatchedKeys, key)
+		}
+		delete(source, key)
+	})
+	if err != nil {
+		return err
+	}
+
+	missing := make([]string, 0, len(source))
+	for key := range source {
+		missing = append(missing, key)
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		report.Missing++
+		sample(&report.MissingKeys, key)
+	}
+	return nil
+}
+
+func readPartition(path string, fn func(key string, sum [sha256.Size]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		key, err := readField(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var sum [sha256.Size]byte
+		if _, err := io.ReadFull(r, sum[:]); err != nil {
+			return err
+		}
+		fn(key, sum)
+	}
+}
+
+func partitionOf(key []byte, partitions int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// appendField appends s to b prefixed by its length.
+func appendField(b []byte, s string) []byte {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(s)))
+	return append(append(b, length[:n]...), s...)
+}
+
+func readField(r *bufio.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func decodeFields(s string) []string {
+	var fields []string
+	for len(s) > 0 {
+		n, size := binary.Uvarint([]byte(s))
+		s = s[size:]
+		fields = append(fields, s[:n])
+		s = s[n:]
+	}
+	return fields
+}
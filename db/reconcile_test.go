@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockReconcileQuery(t *testing.T, query string, rows *sqlmock.Rows) ReconcileQuery {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	mock.ExpectQuery(query).WillReturnRows(rows)
+	return ReconcileQuery{DB: sqlx.NewDb(conn, "sqlmock"), Query: query}
+}
+
+func TestShouldReportMissingExtraAndMismatchedRows(t *testing.T) {
+	source := newMockReconcileQuery(t, "SELECT id, name, balance FROM accounts",
+		sqlmock.NewRows([]string{"id", "name", "balance"}).
+			AddRow(1, "ana", "10.00").
+			AddRow(2, "bia", "20.00").
+			AddRow(3, "caio", "30.00"))
+	target := newMockReconcileQuery(t, "SELECT balance, name, id FROM accounts_copy",
+		sqlmock.NewRows([]string{"balance", "name", "id"}).
+			AddRow([]byte("10.00"), []byte("ana"), int64(1)).
+			AddRow("25.00", "bia", 2).
+			AddRow("40.00", "dani", 4))
+
+	report, err := Reconcile(context.Background(), source, target, []string{"id"}, ReconcileOptions{Partitions: 4})
+
+	assert.Nil(t, err)
+	assert.False(t, report.Equal())
+	assert.Equal(t, int64(3), report.SourceRows)
+	assert.Equal(t, int64(3), report.TargetRows)
+	assert.Equal(t, [][]string{{"3"}}, report.MissingKeys)
+	assert.Equal(t, [][]string{{"4"}}, report.ExtraKeys)
+	assert.Equal(t, [][]string{{"2"}}, report.MismatchedKeys)
+}
+
+func TestShouldReconcileEqualResultSetsOnCompositeKeys(t *testing.T) {
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"account", "day", "amount"}).
+			AddRow("a", "2024-01-01", 5).
+			AddRow("a", "2024-01-02", 7).
+			AddRow("b", "2024-01-01", nil)
+	}
+	source := newMockReconcileQuery(t, "SELECT account, day, amount FROM totals", rows())
+	target := newMockReconcileQuery(t, "SELECT account, day, amount FROM totals", rows())
+
+	report, err := Reconcile(context.Background(), source, target, []string{"account", "day"}, ReconcileOptions{Partitions: 1})
+
+	assert.Nil(t, err)
+	assert.True(t, report.Equal())
+}
+
+func TestShouldMatchValuesReadAsTextByAnotherDriver(t *testing.T) {
+	paid := time.Date(2024, 1, 1, 10, 0, 0, 0, time.FixedZone("BRT", -3*3600))
+	source := newMockReconcileQuery(t, "SELECT id, total, paid, paid_at FROM orders",
+		sqlmock.NewRows([]string{"id", "total", "paid", "paid_at"}).
+			AddRow(int64(1), float64(12.5), true, paid).
+			AddRow(int64(2), int64(7), false, nil))
+	target := newMockReconcileQuery(t, "SELECT id, total, paid, paid_at FROM orders",
+		sqlmock.NewRows([]string{"id", "total", "paid", "paid_at"}).
+			AddRow([]byte("1"), []byte("12.50"), []byte("1"), paid.UTC()).
+			AddRow("2", "7", int64(0), nil))
+
+	report, err := Reconcile(context.Background(), source, target, []string{"id"}, ReconcileOptions{Partitions: 2})
+
+	assert.Nil(t, err)
+	assert.True(t, report.Equal(), "%+v", report)
+}
+
+func TestShouldCapSampledKeys(t *testing.T) {
+	rows := sqlmock.NewRows([]string{"id"})
+	for i := 0; i < 10; i++ {
+		rows.AddRow(i)
+	}
+	source := newMockReconcileQuery(t, "SELECT id FROM accounts", rows)
+	target := newMockReconcileQuery(t, "SELECT id FROM accounts", sqlmock.NewRows([]string{"id"}))
+
+	report, err := Reconcile(context.Background(), source, target, []string{"id"}, ReconcileOptions{MaxSamples: 3})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), report.Missing)
+	assert.Len(t, report.MissingKeys, 3)
+}
+
+func TestShouldRequireKeyColumnsInBothQueries(t *testing.T) {
+	source := newMockReconcileQuery(t, "SELECT id FROM accounts", sqlmock.NewRows([]string{"id"}))
+	target := newMockReconcileQuery(t, "SELECT id FROM accounts", sqlmock.NewRows([]string{"id"}))
+
+	_, err := Reconcile(context.Background(), source, target, []string{"code"}, ReconcileOptions{})
+	assert.NotNil(t, err)
+}
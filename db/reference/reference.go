@@ -0,0 +1,191 @@
+// Package reference keeps small lookup tables, such as countries or
+// currencies, in memory so that services stop re-selecting them.
+package reference
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/helderfarias/sqlx-wrapper/db/changefeed"
+	"github.com/jmoiron/sqlx"
+)
+
+// Config configures a Table.
+type Config struct {
+	// Table is the table cached, and the one whose changes refresh it.
+	Table string
+
+	// Query loads the rows. Zero means SELECT * FROM Table.
+	Query string
+
+	// TTL reloads the table periodically. Zero reloads only on changes.
+	TTL time.Duration
+
+	// Changes, when set, reloads the table on every event for Table, e.g. a
+	// changefeed.PQListener over the trigger of changefeed.TriggerFunction.
+	Changes changefeed.Source
+
+	// Options configure the unit of work each load, by Load or Run, reads
+	// the table with outside a transaction, e.g. WithReplicas to spare the
+	// primary the reloads on every change.
+	Options []db.Option
+}
+
+// Table is an in-memory copy of a lookup table, rows of type V indexed by a
+// key of type K. It is safe for concurrent use.
+type Table[K comparable, V any] struct {
+	db     *sqlx.DB
+	key    func(V) K
+	config Config
+
+	mu       sync.RWMutex
+	rows     map[K]V
+	all      []V
+	loadedAt time.Time
+
+	invalidated chan struct{}
+}
+
+// New creates a table cache keyed by key. Nothing is loaded until Load or Run
+// is called.
+func New[K comparable, V any](database *sqlx.DB, key func(V) K, config Config) *Table[K, V] {
+	if config.Query == "" {
+		config.Query = "SELECT * FROM " + config.Table
+	}
+
+	return &Table[K, V]{
+		db:          database,
+		key:         key,
+		config:      config,
+		rows:        map[K]V{},
+		invalidated: make(chan struct{}, 1),
+	}
+}
+
+// Load reads the whole table and replaces the cached copy.
+func (t *Table[K, V]) Load(ctx context.Context) error {
+	uow := db.NewUnitOfWork(t.db, nil, append([]db.Option{db.WithContext(ctx)}, t.config.Options...)...)
+
+	all, rows, err := t.read(uow)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.all, t.rows, t.loadedAt = all, rows, time.Now()
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *Table[K, V]) read(uow db.UnitOfWork) ([]V, map[K]V, error) {
+	var all []V
+	if err := uow.Select(&all, t.config.Query); err != nil {
+		return nil, nil, fmt.Errorf("reference: loading %s: %w", t.config.Table, err)
+	}
+
+	rows := make(map[K]V, len(all))
+	for _, row := range all {
+		rows[t.key(row)] = row
+	}
+	return all, rows, nil
+}
+
+// Get returns the cached row with key.
+func (t *Table[K, V]) Get(key K) (V, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	row, ok := t.rows[key]
+	return row, ok
+}
+
+// All returns the cached rows in the order the query returned them.
+func (t *Table[K, V]) All() []V {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return append([]V(nil), t.all...)
+}
+
+// LoadedAt returns when the cached copy was read, zero before the first load.
+func (t *Table[K, V]) LoadedAt() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.loadedAt
+}
+
+// Lookup returns the row with key as uow sees it. When consistent is set and
+// uow is in a transaction, the table is read through the transaction, so that
+// its own uncommitted changes and its snapshot are honoured; otherwise the
+// cached copy is used.
+func (t *Table[K, V]) Lookup(uow db.UnitOfWork, key K, consistent bool) (V, bool, error) {
+	if !consistent || !db.IsTransactional(uow) {
+		row, ok := t.Get(key)
+		return row, ok, nil
+	}
+
+	_, rows, err := t.read(uow)
+	if err != nil {
+		var zero V
+		return zero, false, err
+	}
+	row, ok := rows[key]
+	return row, ok, nil
+}
+
+// Invalidate makes Run reload the table, e.g. after the process changed it.
+func (t *Table[K, V]) Invalidate() {
+	select {
+	case t.invalidated <- struct{}{}:
+	default:
+	}
+}
+
+// Run loads the table, then reloads it on changes, invalidations and TTL
+// expiry until ctx is done or the change source fails. Failed reloads keep
+// the previous copy and are retried on the next trigger.
+func (t *Table[K, V]) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if err := t.Load(ctx); err != nil {
+		return err
+	}
+
+	var expired <-chan time.Time
+	if t.config.TTL > 0 {
+		ticker := time.NewTicker(t.config.TTL)
+		defer ticker.Stop()
+		expired = ticker.C
+	}
+
+	events := make(chan changefeed.Event)
+	done := make(chan error, 1)
+	if t.config.Changes != nil {
+		go func() {
+			done <- t.config.Changes.Listen(ctx, events)
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-done:
+			return err
+		case event := <-events:
+			if strings.EqualFold(event.Table, t.config.Table) {
+				t.Load(ctx)
+			}
+		case <-t.invalidated:
+			t.Load(ctx)
+		case <-expired:
+			t.Load(ctx)
+		}
+	}
+}
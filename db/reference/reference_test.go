@@ -0,0 +1,112 @@
+package reference
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/helderfarias/sqlx-wrapper/db/changefeed"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+type currency struct {
+	Code   string `db:"code"`
+	Digits int    `db:"digits"`
+}
+
+func newMockDatabase(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return sqlx.NewDb(conn, "postgres"), mock
+}
+
+func currencyRows(rows ...currency) *sqlmock.Rows {
+	r := sqlmock.NewRows([]string{"code", "digits"})
+	for _, c := range rows {
+		r.AddRow(c.Code, c.Digits)
+	}
+	return r
+}
+
+func newCurrencies(database *sqlx.DB, config Config) *Table[string, currency] {
+	config.Table = "currencies"
+	return New(database, func(c currency) string { return c.Code }, config)
+}
+
+func TestShouldServeLookupsFromLoadedTable(t *testing.T) {
+	database, mock := newMockDatabase(t)
+	mock.ExpectQuery("SELECT \\* FROM currencies").WillReturnRows(currencyRows(currency{"EUR", 2}, currency{"JPY", 0}))
+
+	currencies := newCurrencies(database, Config{})
+	_, ok := currencies.Get("EUR")
+	assert.False(t, ok)
+
+	assert.Nil(t, currencies.Load(context.Background()))
+
+	eur, ok := currencies.Get("EUR")
+	assert.True(t, ok)
+	assert.Equal(t, 2, eur.Digits)
+	assert.Equal(t, []currency{{"EUR", 2}, {"JPY", 0}}, currencies.All())
+	assert.False(t, currencies.LoadedAt().IsZero())
+}
+
+func TestShouldReadThroughTransactionForConsistentLookups(t *testing.T) {
+	database, mock := newMockDatabase(t)
+	mock.ExpectQuery("SELECT \\* FROM currencies").WillReturnRows(currencyRows(currency{"EUR", 2}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM currencies").WillReturnRows(currencyRows(currency{"EUR", 2}, currency{"BRL", 2}))
+
+	currencies := newCurrencies(database, Config{})
+	currencies.Load(context.Background())
+
+	tx, _ := database.Beginx()
+	uow := db.NewUnitOfWork(database, tx)
+
+	_, ok, err := currencies.Lookup(uow, "BRL", false)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	brl, ok, err := currencies.Lookup(uow, "BRL", true)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "BRL", brl.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+type fakeSource []changefeed.Event
+
+func (s fakeSource) Listen(ctx context.Context, events chan<- changefeed.Event) error {
+	for _, e := range s {
+		events <- e
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestShouldReloadOnChangesToTable(t *testing.T) {
+	database, mock := newMockDatabase(t)
+	mock.ExpectQuery("SELECT code, digits FROM currencies").WillReturnRows(currencyRows(currency{"EUR", 2}))
+	mock.ExpectQuery("SELECT code, digits FROM currencies").WillReturnRows(currencyRows(currency{"EUR", 3}))
+
+	currencies := newCurrencies(database, Config{
+		Query:   "SELECT code, digits FROM currencies",
+		Changes: fakeSource{{Table: "countries", Op: "update"}, {Table: "currencies", Op: "update"}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go currencies.Run(ctx)
+	defer cancel()
+
+	assert.Eventually(t, func() bool {
+		eur, _ := currencies.Get("EUR")
+		return eur.Digits == 3
+	}, time.Second, time.Millisecond)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReferenceRule declares a relationship CheckReferences verifies, typically
+// one whose foreign key constraint was dropped for write performance.
+type ReferenceRule struct {
+	ForeignKey
+
+	// KeyColumn identifies the orphaned rows in samples, usually the primary
+	// key of Table. Empty means the dangling Column values themselves.
+	KeyColumn string
+
+	// Where restricts the rows checked, e.g. "deleted_at IS NULL".
+	Where string
+}
+
+func (r ReferenceRule) String() string {
+	return fmt.Sprintf("%s.%s -> %s.%s", r.Table, r.Column, r.References, r.ReferencedColumn)
+}
+
+// ReferenceOptions tunes CheckReferences.
+type ReferenceOptions struct {
+	// MaxSamples caps the keys sampled per rule. Zero means 10; counts are
+	// always exact.
+	MaxSamples int
+
+	// Options configure the unit of work counting and sampling the dangling
+	// references of every rule.
+	Options []Option
+}
+
+// ReferenceResult is what CheckReferences found for a rule: the number of
+// rows whose reference has no match, and the KeyColumn values of some of
+// them, as text, in KeyColumn order.
+type ReferenceResult struct {
+	Rule    ReferenceRule
+	Orphans int64
+	Samples []string
+}
+
+// ReferenceReport lists a result per rule, in rule order.
+type ReferenceReport struct {
+	Results []ReferenceResult
+}
+
+// OK reports whether no rule has orphans.
+func (r *ReferenceReport) OK() bool {
+	return len(r.Violations()) == 0
+}
+
+// Violations returns the results of the rules with orphans.
+func (r *ReferenceReport) Violations() []ReferenceResult {
+	var violations []ReferenceResult
+	for _, result := range r.Results {
+		if result.Orphans > 0 {
+			violations = append(violations, result)
+		}
+	}
+	return violations
+}
+
+// CheckReferences scans database for rows whose reference, as declared by
+// rules, matches no row of the referenced table. NULL references are not
+// dangling, as with a foreign key. Each rule costs an anti-join over its
+// table plus a sampling query when it has orphans, so the referenced columns
+// want an index.
+func CheckReferences(ctx context.Context, database *sqlx.DB, rules []ReferenceRule, opts ReferenceOptions) (*ReferenceReport, error) {
+	if opts.MaxSamples <= 0 {
+		opts.MaxSamples = 10
+	}
+
+	u := &unitOfWork{db: database, ctx: ctx}
+	u.apply(opts.Options)
+
+	report := &ReferenceReport{}
+	for _, rule := range rules {
+		result, err := checkReference(ctx, u, rule, opts.MaxSamples)
+		if err != nil {
+			return nil, fmt.Errorf("db: checking %s: %w", rule, err)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func checkReference(ctx context.Context, u *unitOfWork, rule ReferenceRule, maxSamples int) (ReferenceResult, error) {
+	result := ReferenceResult{Rule: rule}
+	if rule.Table == "" || rule.Column == "" || rule.References == "" || rule.ReferencedColumn == "" {
+		return result, errors.New("rule needs a table, a column and the referenced ones")
+	}
+	key := rule.KeyColumn
+	if key == "" {
+		key = rule.Column
+	}
+
+	orphans := fmt.Sprintf("FROM %s c WHERE c.%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.%s = c.%s)",
+		rule.Table, rule.Column, rule.References, rule.ReferencedColumn, rule.Column)
+	if rule.Where != "" {
+		orphans += " AND (" + rule.Where + ")"
+	}
+
+	if err := u.GetContext(ctx, &result.Orphans, "SELECT COUNT(*) "+orphans); err != nil {
+		return result, err
+	}
+	if result.Orphans == 0 {
+		return result, nil
+	}
+
+	rows, err := u.query(ctx, fmt.Sprintf("SELECT c.%s %s ORDER BY c.%s LIMIT %d", key, orphans, key, maxSamples))
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value interface{}
+		if err := rows.Scan(&value); err != nil {
+			return result, err
+		}
+		result.Samples = append(result.Samples, valueKey(value))
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldReportOrphanedRowsWithSampleKeys(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM order_lines c WHERE c.order_id IS NOT NULL AND NOT EXISTS \(SELECT 1 FROM orders p WHERE p.id = c.order_id\)$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`^SELECT c.id FROM order_lines c WHERE .* ORDER BY c.id LIMIT 2$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11).AddRow([]byte("12")))
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM orders c WHERE c.customer_id IS NOT NULL AND NOT EXISTS \(SELECT 1 FROM customers p WHERE p.id = c.customer_id\) AND \(deleted_at IS NULL\)$`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	report, err := CheckReferences(context.Background(), database, []ReferenceRule{
+		{ForeignKey: ForeignKey{Table: "order_lines", Column: "order_id", References: "orders", ReferencedColumn: "id"}, KeyColumn: "id"},
+		{ForeignKey: ForeignKey{Table: "orders", Column: "customer_id", References: "customers", ReferencedColumn: "id"}, Where: "deleted_at IS NULL"},
+	}, ReferenceOptions{MaxSamples: 2})
+
+	assert.Nil(t, err)
+	assert.False(t, report.OK())
+	if assert.Len(t, report.Violations(), 1) {
+		violation := report.Violations()[0]
+		assert.Equal(t, "order_lines.order_id -> orders.id", violation.Rule.String())
+		assert.Equal(t, int64(3), violation.Orphans)
+		assert.Equal(t, []string{"11", "12"}, violation.Samples)
+	}
+	assert.Equal(t, int64(0), report.Results[1].Orphans)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectIncompleteReferenceRules(t *testing.T) {
+	database, _ := newMockDatabase(t, "postgres")
+
+	_, err := CheckReferences(context.Background(), database, []ReferenceRule{
+		{ForeignKey: ForeignKey{Table: "order_lines", Column: "order_id"}},
+	}, ReferenceOptions{})
+
+	assert.EqualError(t, err, "db: checking order_lines.order_id -> .: rule needs a table, a column and the referenced ones")
+}
+
+func TestShouldFailChecksWhoseCountFailsWhileReading(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`^SELECT COUNT\(\*\) FROM order_lines c`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).RowError(0, assert.AnError).AddRow(0))
+
+	_, err := CheckReferences(context.Background(), database, []ReferenceRule{
+		{ForeignKey: ForeignKey{Table: "order_lines", Column: "order_id", References: "orders", ReferencedColumn: "id"}},
+	}, ReferenceOptions{})
+
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
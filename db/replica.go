@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReplicaBalancer picks the replica a read goes to.
+type ReplicaBalancer interface {
+	Pick(replicas []*sqlx.DB) *sqlx.DB
+}
+
+// RoundRobin returns a balancer cycling through the replicas. Share it between
+// unit of works for reads to spread evenly.
+func RoundRobin() ReplicaBalancer {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (r *roundRobin) Pick(replicas []*sqlx.DB) *sqlx.DB {
+	return replicas[(atomic.AddUint64(&r.next, 1)-1)%uint64(len(replicas))]
+}
+
+// LeastConnections returns a balancer picking the replica with the fewest
+// connections in use in this process, the first one on ties.
+func LeastConnections() ReplicaBalancer {
+	return leastConnections{}
+}
+
+type leastConnections struct{}
+
+func (leastConnections) Pick(replicas []*sqlx.DB) *sqlx.DB {
+	best, inUse := replicas[0], replicas[0].Stats().InUse
+	for _, replica := range replicas[1:] {
+		if n := replica.Stats().InUse; n < inUse {
+			best, inUse = replica, n
+		}
+	}
+	return best
+}
+
+// defaultBalancer is shared by the unit of works of NewUnitOfWorkWithReplicas.
+var defaultBalancer = RoundRobin()
+
+// WithReplicas routes reads to replicas picked by balancer: Get, Select and
+// Query statements that Inspect finds no write in, run outside a transaction
+// and without WithPrimary. Everything else, transactions included, goes to
+// the database the unit of work was created over. Replicas lag behind the
+// primary, so a read following a write may not see it; read it with
+// WithPrimary.
+func WithReplicas(balancer ReplicaBalancer, replicas ...*sqlx.DB) Option {
+	return func(u *unitOfWork) {
+		if len(replicas) == 0 {
+			return
+		}
+		u.replicas = replicas
+		u.balancer = balancer
+	}
+}
+
+// NewUnitOfWorkWithReplicas creates a unit of work over primary with its
+// reads spread round-robin over replicas, see WithReplicas.
+func NewUnitOfWorkWithReplicas(primary *sqlx.DB, replicas ...*sqlx.DB) UnitOfWork {
+	return NewUnitOfWork(primary, nil, WithReplicas(defaultBalancer, replicas...))
+}
+
+type primaryOnlyKey struct{}
+
+// WithPrimary returns a context whose statements all run on the primary,
+// e.g. to read a row just written or a SELECT calling a function with side
+// effects.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryOnlyKey{}, true)
+}
+
+// routesToReplica reports whether stmt can be read from a replica.
+func (u *unitOfWork) routesToReplica(ctx context.Context, stmt *Statement) bool {
+	if len(u.replicas) == 0 || stmt.InTx || stmt.Kind == KindExec {
+		return false
+	}
+	if primary, _ := ctx.Value(primaryOnlyKey{}).(bool); primary {
+		return false
+	}
+	return len(Inspect(stmt.Driver, stmt.Query).Operations) == 0
+}
+
+// replica picks the replica of a statement routed to one.
+func (u *unitOfWork) replica() sqlx.ExtContext {
+	if u.balancer == nil {
+		return defaultBalancer.Pick(u.replicas)
+	}
+	return u.balancer.Pick(u.replicas)
+}
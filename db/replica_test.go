@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRouteReadsToReplicasRoundRobin(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "postgres")
+	first, firstMock := newMockDatabase(t, "postgres")
+	second, secondMock := newMockDatabase(t, "postgres")
+
+	firstMock.ExpectQuery("^SELECT id FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	secondMock.ExpectQuery("^SELECT id FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	primaryMock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	primaryMock.ExpectQuery("^INSERT INTO orders .* RETURNING id$").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	primaryMock.ExpectQuery("^SELECT id FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	uow := NewUnitOfWork(primary, nil, WithReplicas(RoundRobin(), first, second))
+
+	var ids []int64
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders"))
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders"))
+	uow.MustExec("UPDATE orders SET status = 'paid'")
+	var id int64
+	assert.Nil(t, uow.Get(&id, "INSERT INTO orders (status) VALUES ('open') RETURNING id"))
+	assert.Nil(t, uow.SelectContext(WithPrimary(context.Background()), &ids, "SELECT id FROM orders"))
+
+	assert.Nil(t, primaryMock.ExpectationsWereMet())
+	assert.Nil(t, firstMock.ExpectationsWereMet())
+	assert.Nil(t, secondMock.ExpectationsWereMet())
+}
+
+func TestShouldReadFromPrimaryInTransactions(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "postgres")
+	replica, _ := newMockDatabase(t, "postgres")
+	primaryMock.ExpectBegin()
+	primaryMock.ExpectQuery("^SELECT id FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	primaryMock.ExpectCommit()
+
+	uow := NewUnitOfWorkWithReplicas(primary, replica)
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		var ids []int64
+		return nil, tx.Select(&ids, "SELECT id FROM orders")
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, primaryMock.ExpectationsWereMet())
+}
+
+func TestShouldLetInterceptorsSendReadsToPrimary(t *testing.T) {
+	primary, primaryMock := newMockDatabase(t, "postgres")
+	replica, _ := newMockDatabase(t, "postgres")
+	primaryMock.ExpectQuery("^SELECT nextval").WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(7))
+
+	uow := NewUnitOfWork(primary, nil, WithReplicas(LeastConnections(), replica), WithInterceptors(
+		func(ctx context.Context, stmt *Statement, next Handler) error {
+			assert.True(t, stmt.Replica)
+			stmt.Replica = false
+			return next(ctx, stmt)
+		}))
+
+	var id int64
+	assert.Nil(t, uow.Get(&id, "SELECT nextval('orders_id_seq')"))
+	assert.Equal(t, int64(7), id)
+	assert.Nil(t, primaryMock.ExpectationsWereMet())
+}
@@ -0,0 +1,354 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Repository provides primary-key based CRUD for a registered model T.
+// A Repository is meant to be long lived and shared; every call takes the
+// UnitOfWork it should run in.
+type Repository[T any] struct {
+	model     *Model
+	cache     *entityCache[T]
+	effective *effectiveDating
+	policy    AccessPolicy
+	bus       *EventBus
+	sql       repositorySQL
+}
+
+// repositorySQL holds the statements of a repository, rendered once from its
+// model since they only depend on it.
+type repositorySQL struct {
+	insert string
+	update string
+	delete string
+	find   string
+	load   string
+}
+
+func renderRepositorySQL(model *Model) repositorySQL {
+	columns := model.NonKeyColumns()
+	assignments := make([]string, len(columns))
+	for i, c := range columns {
+		assignments[i] = c + " = :" + c
+	}
+
+	update := fmt.Sprintf("UPDATE %s SET %s WHERE %s = :%s",
+		model.Table, strings.Join(assignments, ", "), model.Key, model.Key)
+	if model.Version != "" {
+		update = versionedUpdate(model)
+	}
+
+	return repositorySQL{
+		insert: fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			model.Table, strings.Join(model.Columns, ", "), namedList(model.Columns)),
+		update: update,
+		delete: fmt.Sprintf("DELETE FROM %s WHERE %s = :id", model.Table, model.Key),
+		find:   model.Key + " = :id",
+		load:   fmt.Sprintf("SELECT %s FROM %s WHERE ", strings.Join(model.Columns, ", "), model.Table),
+	}
+}
+
+// RepositoryOption configures a Repository.
+type RepositoryOption func(*repositoryConfig)
+
+type repositoryConfig struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	effective   *effectiveDating
+	policy      AccessPolicy
+	bus         *EventBus
+}
+
+// WithEntityCache caches entities read by Find for ttl. When negativeTTL is
+// positive, IDs that were not found are remembered for that long as well.
+// Cached entries are invalidated once a transaction that wrote them commits.
+func WithEntityCache(ttl, negativeTTL time.Duration) RepositoryOption {
+	return func(c *repositoryConfig) {
+		c.ttl = ttl
+		c.negativeTTL = negativeTTL
+	}
+}
+
+// NewRepository creates a repository for T, which must have been registered
+// with Register; read-only models fail with ErrReadOnlyModel.
+func NewRepository[T any](opts ...RepositoryOption) (*Repository[T], error) {
+	var zero T
+	model, err := ModelOf(&zero)
+	if err != nil {
+		return nil, err
+	}
+	if model.ReadOnly {
+		return nil, fmt.Errorf("%w: %s is a view, use a View", ErrReadOnlyModel, model.Table)
+	}
+
+	config := repositoryConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	r := &Repository[T]{model: model, effective: config.effective, policy: config.policy, bus: config.bus,
+		sql: renderRepositorySQL(model)}
+	if r.effective != nil {
+		if err := r.effective.validate(model); err != nil {
+			return nil, err
+		}
+		r.sql = r.effective.scope(model, r.sql)
+	}
+	if config.ttl > 0 {
+		r.cache = newEntityCache[T](config.ttl, config.negativeTTL)
+	}
+
+	return r, nil
+}
+
+// Model returns the metadata the repository was built from.
+func (r *Repository[T]) Model() *Model {
+	return r.model
+}
+
+// Find loads the entity with the given primary key. It returns sql.ErrNoRows
+// when no such row exists, and ErrIntegrity when the model is protected and
+// the row does not match its checksum. Reads inside a transaction bypass the
+// cache. Effective dated entities are loaded at the version in effect now.
+func (r *Repository[T]) Find(uow UnitOfWork, id interface{}) (T, error) {
+	if err := r.authorize(uow, "SELECT", r.sql.find, r.keyArgs(id)); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	cached := r.cache != nil && !IsTransactional(uow)
+
+	if cached {
+		if entity, found, ok := r.cache.get(id); ok {
+			StatsFrom(contextOf(uow)).cacheHit()
+			if !found {
+				var zero T
+				return zero, sql.ErrNoRows
+			}
+			return entity, nil
+		}
+	}
+
+	entity, err := r.load(uow, id)
+	if cached {
+		switch err {
+		case nil:
+			r.cache.put(id, entity)
+		case sql.ErrNoRows:
+			r.cache.putMissing(id)
+		}
+	}
+
+	return entity, err
+}
+
+// Insert writes entity as a new row.
+func (r *Repository[T]) Insert(uow UnitOfWork, entity *T) error {
+	if err := r.authorize(uow, "INSERT", "", nil); err != nil {
+		return err
+	}
+	if err := r.model.Seal(entity); err != nil {
+		return err
+	}
+
+	if _, err := uow.MustNamedExec(r.sql.insert, r.model.namedArg(entity, nil)).RowsAffected(); err != nil {
+		return err
+	}
+
+	r.invalidate(uow, r.model.KeyOf(entity))
+	r.publish(uow, "insert", r.model.KeyOf(entity))
+	return nil
+}
+
+// Update writes every non-key column of entity. It returns sql.ErrNoRows when
+// no row has the entity's primary key. Models with a version column are
+// updated like UpdateVersioned does, returning ErrStaleObject instead.
+// Effective dated entities only have the version in effect now updated.
+func (r *Repository[T]) Update(uow UnitOfWork, entity *T) error {
+	if err := r.authorize(uow, "UPDATE", r.sql.find, r.keyArgs(r.model.KeyOf(entity))); err != nil {
+		return err
+	}
+	if r.model.Version != "" {
+		err := r.model.updateVersioned(uow, r.sql.update, entity, r.extraArgs())
+		r.invalidate(uow, r.model.KeyOf(entity))
+		if err != nil {
+			return err
+		}
+		r.publish(uow, "update", r.model.KeyOf(entity))
+		return nil
+	}
+	if err := r.model.Seal(entity); err != nil {
+		return err
+	}
+
+	affected, err := uow.MustNamedExec(r.sql.update, r.model.namedArg(entity, r.extraArgs())).RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	r.invalidate(uow, r.model.KeyOf(entity))
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	r.publish(uow, "update", r.model.KeyOf(entity))
+	return nil
+}
+
+// Delete removes the row with the given primary key. It returns sql.ErrNoRows
+// when there is nothing to delete. Effective dated entities are not removed,
+// the version in effect is closed now instead.
+func (r *Repository[T]) Delete(uow UnitOfWork, id interface{}) error {
+	args := r.keyArgs(id)
+	if err := r.authorize(uow, "DELETE", r.sql.find, args); err != nil {
+		return err
+	}
+
+	affected, err := uow.MustNamedExec(r.sql.delete, args).RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	r.invalidate(uow, id)
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	r.publish(uow, "delete", id)
+	return nil
+}
+
+func (r *Repository[T]) load(uow UnitOfWork, id interface{}) (T, error) {
+	return r.loadWhere(uow, r.sql.find, r.keyArgs(id))
+}
+
+// keyArgs returns the arguments of r.sql.find for id.
+func (r *Repository[T]) keyArgs(id interface{}) map[string]interface{} {
+	args := map[string]interface{}{"id": id}
+	for name, value := range r.extraArgs() {
+		args[name] = value
+	}
+	return args
+}
+
+// extraArgs returns the arguments the statements of r take besides the
+// entity or key, nil when they take none.
+func (r *Repository[T]) extraArgs() map[string]interface{} {
+	if r.effective == nil {
+		return nil
+	}
+	return map[string]interface{}{"now": time.Now()}
+}
+
+func (r *Repository[T]) loadWhere(uow UnitOfWork, where string, args map[string]interface{}) (T, error) {
+	var entity T
+
+	rows, err := uow.NamedQuery(r.sql.load+where, args)
+	if err != nil {
+		return entity, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return entity, err
+		}
+		return entity, sql.ErrNoRows
+	}
+
+	if err := rows.StructScan(&entity); err != nil {
+		return entity, err
+	}
+
+	return entity, r.model.Verify(&entity)
+}
+
+func (r *Repository[T]) invalidate(uow UnitOfWork, id interface{}) {
+	if r.cache == nil {
+		return
+	}
+
+	uow.AfterCommit(func() {
+		r.cache.invalidate(id)
+	})
+}
+
+func (r *Repository[T]) publish(uow UnitOfWork, op string, id interface{}) {
+	if r.bus != nil {
+		r.bus.Publish(uow, EntityChange{Table: r.model.Table, Op: op, Key: id})
+	}
+}
+
+func namedList(columns []string) string {
+	named := make([]string, len(columns))
+	for i, c := range columns {
+		named[i] = ":" + c
+	}
+	return strings.Join(named, ", ")
+}
+
+type entityCache[T any] struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]cacheEntry[T]
+}
+
+type cacheEntry[T any] struct {
+	entity  T
+	found   bool
+	expires time.Time
+}
+
+func newEntityCache[T any](ttl, negativeTTL time.Duration) *entityCache[T] {
+	return &entityCache[T]{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     map[string]cacheEntry[T]{},
+	}
+}
+
+func (c *entityCache[T]) get(id interface{}) (T, bool, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[cacheKey(id)]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		var zero T
+		return zero, false, false
+	}
+
+	return entry.entity, entry.found, true
+}
+
+func (c *entityCache[T]) put(id interface{}, entity T) {
+	c.mu.Lock()
+	c.entries[cacheKey(id)] = cacheEntry[T]{entity: entity, found: true, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+}
+
+func (c *entityCache[T]) putMissing(id interface{}) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[cacheKey(id)] = cacheEntry[T]{expires: time.Now().Add(c.negativeTTL)}
+	c.mu.Unlock()
+}
+
+func (c *entityCache[T]) invalidate(id interface{}) {
+	c.mu.Lock()
+	delete(c.entries, cacheKey(id))
+	c.mu.Unlock()
+}
+
+// cacheKey normalizes ids so that, for instance, int and int64 keys with the
+// same value hit the same entry.
+func cacheKey(id interface{}) string {
+	return fmt.Sprint(id)
+}
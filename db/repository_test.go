@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type repositoryOrder struct {
+	ID     int64  `db:"id"`
+	Status string `db:"status"`
+}
+
+func init() {
+	MustRegister(repositoryOrder{}, "orders")
+}
+
+func TestShouldFindEntityByKey(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, err := NewRepository[repositoryOrder]()
+	assert.Nil(t, err)
+
+	mock.ExpectQuery(`SELECT id, status FROM orders WHERE id = \?`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+
+	order, err := repo.Find(uw, 7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "open", order.Status)
+}
+
+func TestShouldServeCachedEntitiesAndMissingIDs(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[repositoryOrder](WithEntityCache(time.Minute, time.Minute))
+
+	mock.ExpectQuery("SELECT id, status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+	mock.ExpectQuery("SELECT id, status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+
+	repo.Find(uw, 7)
+	order, err := repo.Find(uw, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "open", order.Status)
+
+	_, err = repo.Find(uw, 8)
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = repo.Find(uw, 8)
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldInvalidateCacheAfterCommit(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[repositoryOrder](WithEntityCache(time.Minute, 0))
+
+	mock.ExpectQuery("SELECT id, status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE orders SET status = \? WHERE id = \?`).
+		WithArgs("closed", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT id, status FROM orders").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "closed"))
+
+	repo.Find(uw, 7)
+
+	_, err := uw.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, repo.Update(tx, &repositoryOrder{ID: 7, Status: "closed"})
+	})
+	assert.Nil(t, err)
+
+	order, _ := repo.Find(uw, int64(7))
+	assert.Equal(t, "closed", order.Status)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReportMissingRowOnDelete(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	repo, _ := NewRepository[repositoryOrder]()
+
+	mock.ExpectExec(`DELETE FROM orders WHERE id = \?`).
+		WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, sql.ErrNoRows, repo.Delete(uw, 9))
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+// RetryPolicy retries transactions failing with transient errors, such as
+// serialization failures and deadlocks, from the start. Set it with
+// WithRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts bounds the runs of a transaction. Zero means 3.
+	MaxAttempts int
+
+	// Backoff returns the pause before the given retry, 1 for the first.
+	// Nil means ExponentialBackoff(50ms, 2s).
+	Backoff func(retry int) time.Duration
+
+	// Classifiers maps driver names to the function telling retryable errors
+	// of the driver; drivers without one use IsRetryable.
+	Classifiers map[string]func(err error) bool
+
+	// RetryStale also retries transactions failing with ErrStaleObject, so
+	// that entities updated concurrently are read again and the change is
+	// made on their current version.
+	RetryStale bool
+}
+
+// WithRetryPolicy retries the transactions of InTransaction under policy.
+// The whole of contextOver runs again, so it must not have effects outside
+// the transaction other than AfterCommit callbacks, which only run for the
+// attempt that committed. Errors of the commit are returned under a policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.Backoff == nil {
+		policy.Backoff = ExponentialBackoff(50*time.Millisecond, 2*time.Second)
+	}
+	return func(u *unitOfWork) {
+		u.retry = &policy
+	}
+}
+
+// ExponentialBackoff doubles the pause from base on every retry, up to max,
+// and picks a random pause below it so that conflicting transactions do not
+// retry in lockstep.
+func ExponentialBackoff(base, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return time.Duration(rand.Int63n(int64(d)) + 1)
+	}
+}
+
+// retryableStates are the SQLSTATEs of serialization_failure and
+// deadlock_detected.
+var retryableStates = map[string]bool{"40001": true, "40P01": true}
+
+// IsRetryable reports whether err is a serialization failure or a deadlock:
+// SQLSTATE 40001 or 40P01, as reported by Postgres drivers, or MySQL error
+// 1213.
+func IsRetryable(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) && retryableStates[state.SQLState()] {
+		return true
+	}
+	return mysqlErrorNumber(err) == 1213
+}
+
+// mysqlErrorNumber returns the Number of a MySQL driver error in the chain of
+// err, or zero, without depending on the driver.
+func mysqlErrorNumber(err error) uint64 {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.Indirect(reflect.ValueOf(err))
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		if number := v.FieldByName("Number"); number.IsValid() && number.CanUint() {
+			return number.Uint()
+		}
+	}
+	return 0
+}
+
+func (p *RetryPolicy) retryable(driver string, err error) bool {
+	if p.RetryStale && errors.Is(err, ErrStaleObject) {
+		return true
+	}
+	if classify, ok := p.Classifiers[driver]; ok {
+		return classify(err)
+	}
+	return IsRetryable(err)
+}
+
+// retrying runs contextOver in transactions until one commits, fails with an
+// error that is not retryable or the policy gives up. Statements panicking
+// with retryable errors, as MustExec does, are retried as well.
+func (u *unitOfWork) retrying(opts *sql.TxOptions, contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error) {
+	policy := u.retry
+	for attempt := 1; ; attempt++ {
+		result, err := u.attempt(opts, contextOver)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(u.DriverName(), err) {
+			if err != nil && attempt > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return result, err
+		}
+
+		if u.metrics != nil {
+			u.metrics.ObserveRetry(err)
+		}
+		select {
+		case <-u.context().Done():
+			return nil, u.context().Err()
+		case <-time.After(policy.Backoff(attempt)):
+		}
+	}
+}
+
+func (u *unitOfWork) attempt(opts *sql.TxOptions, contextOver func(db UnitOfWork) (interface{}, error)) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked, ok := r.(error)
+			if !ok || !u.retry.retryable(u.DriverName(), panicked) {
+				panic(r)
+			}
+			result, err = nil, panicked
+		}
+	}()
+
+	return u.transaction(opts, contextOver)
+}
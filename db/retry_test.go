@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string {
+	return e.Message
+}
+
+func TestShouldClassifyTransientErrors(t *testing.T) {
+	assert.True(t, IsRetryable(&pq.Error{Code: "40001"}))
+	assert.True(t, IsRetryable(&pq.Error{Code: "40P01"}))
+	assert.True(t, IsRetryable(&mysqlError{Number: 1213, Message: "Deadlock found"}))
+	assert.False(t, IsRetryable(&pq.Error{Code: "23505"}))
+	assert.False(t, IsRetryable(&mysqlError{Number: 1062, Message: "Duplicate entry"}))
+	assert.False(t, IsRetryable(errors.New("boom")))
+}
+
+func TestShouldRetryTransactionsOnSerializationFailures(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE accounts").WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit().WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var backoffs []int
+	uow := NewUnitOfWork(database, nil, WithRetryPolicy(RetryPolicy{
+		MaxAttempts: 3,
+		Backoff:     func(retry int) time.Duration { backoffs = append(backoffs, retry); return 0 },
+	}))
+
+	attempts := 0
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		attempts++
+		tx.MustExec("UPDATE accounts SET balance = balance - 10 WHERE id = $1", 1)
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int{1, 2}, backoffs)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldGiveUpOnPermanentErrorsAndExhaustedAttempts(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	deadlock := &pq.Error{Code: "40P01"}
+	uow := NewUnitOfWork(database, nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }}))
+
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, deadlock
+	})
+	assert.True(t, errors.Is(err, deadlock))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	_, err = uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, assert.AnError
+	})
+	assert.Equal(t, assert.AnError, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldUseDriverClassifiers(t *testing.T) {
+	policy := RetryPolicy{Classifiers: map[string]func(error) bool{
+		"mysql": func(err error) bool { return mysqlErrorNumber(err) == 1205 },
+	}}
+
+	assert.True(t, policy.retryable("mysql", &mysqlError{Number: 1205}))
+	assert.False(t, policy.retryable("mysql", &mysqlError{Number: 1213}))
+	assert.True(t, policy.retryable("postgres", &pq.Error{Code: "40001"}))
+}
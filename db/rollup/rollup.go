@@ -0,0 +1,444 @@
+// Package rollup keeps rollup tables, caching the result of aggregate queries
+// such as revenue per day, up to date: refreshed in full or incrementally from
+// a watermark, on a schedule or once writes to their sources commit, each
+// refresh committed together with its watermark.
+package rollup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrUnknownRollup is returned when refreshing a rollup the manager does not
+// have.
+var ErrUnknownRollup = errors.New("rollup: unknown rollup")
+
+// Rollup declares a table holding the rows of an aggregate query. A full
+// refresh replaces every row of Table by those of Query:
+//
+//	Rollup{
+//		Name:  "revenue-per-day",
+//		Table: "revenue_per_day",
+//		Query: "SELECT day, SUM(total) AS revenue FROM orders GROUP BY day",
+//	}
+//
+// An incremental refresh recomputes only the groups changed since the last
+// refresh. Watermark reads how far the sources go, e.g. SELECT
+// MAX(updated_at) FROM orders, and Incremental returns the rows of the groups
+// changed since the named parameter :since, replacing the rows of Table with
+// the same Key. It runs once, into a temporary table rollup_changed, so the
+// database user needs the privilege to create one:
+//
+//	Key:         []string{"day"},
+//	Watermark:   "SELECT MAX(updated_at) FROM orders",
+//	Incremental: `SELECT day, SUM(total) AS revenue FROM orders
+//		WHERE day IN (SELECT day FROM orders WHERE updated_at > :since) GROUP BY day`,
+//
+// Groups whose source rows are all deleted are only removed by a full
+// refresh, and rows committed late with a watermark already passed are
+// missed until one: run a full refresh now and then, see RefreshFull.
+type Rollup struct {
+	// Name identifies the rollup's watermark.
+	Name string
+
+	Table string
+
+	// Columns lists the columns of Table that Query and Incremental fill, in
+	// order.
+	// Empty means every column, in table order.
+	Columns []string
+
+	Query string
+
+	Key         []string
+	Watermark   string
+	Incremental string
+
+	// Sources lists the tables whose writes call for a refresh, see
+	// Manager.Hook. Empty means the tables Query reads.
+	Sources []string
+
+	// Interval between the refreshes of Run. Zero means refreshing only
+	// after writes, or when asked to.
+	Interval time.Duration
+}
+
+func (r Rollup) incremental() bool {
+	return r.Incremental != ""
+}
+
+// Config configures a Manager. StateTable defaults to rollup_watermarks:
+//
+//	CREATE TABLE rollup_watermarks (
+//		name         varchar(128) PRIMARY KEY,
+//		watermark    varchar(255),
+//		refreshed_at timestamp NOT NULL
+//	);
+type Config struct {
+	StateTable string
+
+	// Options configure the unit of work a refresh recomputes its rollup and
+	// advances the watermark with.
+	Options []db.Option
+}
+
+// Manager refreshes a set of rollups of a database.
+type Manager struct {
+	db      *sqlx.DB
+	config  Config
+	rollups map[string]Rollup
+	order   []string
+
+	mu      sync.Mutex
+	pending map[string]bool
+	notify  chan struct{}
+}
+
+// New creates a manager of rollups over database.
+func New(database *sqlx.DB, config Config, rollups ...Rollup) (*Manager, error) {
+	if config.StateTable == "" {
+		config.StateTable = "rollup_watermarks"
+	}
+
+	m := &Manager{
+		db:      database,
+		config:  config,
+		rollups: map[string]Rollup{},
+		pending: map[string]bool{},
+		notify:  make(chan struct{}, 1),
+	}
+	for _, r := range rollups {
+		if r.Name == "" || r.Table == "" || r.Query == "" {
+			return nil, errors.New("rollup: rollup needs a name, a table and a query")
+		}
+		if _, ok := m.rollups[r.Name]; ok {
+			return nil, fmt.Errorf("rollup: %s declared twice", r.Name)
+		}
+		if r.incremental() && (len(r.Key) == 0 || r.Watermark == "") {
+			return nil, fmt.Errorf("rollup: incremental %s needs a key and a watermark", r.Name)
+		}
+		sources := r.Sources
+		if len(sources) == 0 {
+			sources = db.Inspect(database.DriverName(), r.Query).Tables
+		}
+		r.Sources = make([]string, len(sources))
+		for i, source := range sources {
+			r.Sources[i] = strings.ToLower(source)
+		}
+
+		m.rollups[r.Name] = r
+		m.order = append(m.order, r.Name)
+	}
+	return m, nil
+}
+
+// Refresh refreshes the named rollup in its own transaction: incrementally
+// when it has an Incremental query and a watermark from a previous refresh,
+// in full otherwise.
+func (m *Manager) Refresh(ctx context.Context, name string) error {
+	return m.RefreshIn(m.unitOfWork(ctx), name)
+}
+
+// RefreshFull refreshes the named rollup in full in its own transaction.
+func (m *Manager) RefreshFull(ctx context.Context, name string) error {
+	r, ok := m.rollups[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRollup, name)
+	}
+	return m.refresh(m.unitOfWork(ctx), r, true)
+}
+
+// RefreshIn refreshes the named rollup like Refresh, in a savepoint of the
+// transaction of uow if any, e.g. to refresh it with the writes changing its
+// sources.
+func (m *Manager) RefreshIn(uow db.UnitOfWork, name string) error {
+	r, ok := m.rollups[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownRollup, name)
+	}
+	return m.refresh(uow, r, false)
+}
+
+func (m *Manager) refresh(uow db.UnitOfWork, r Rollup, full bool) error {
+	_, err := uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		since, found, err := m.watermark(tx, r.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		var mark sql.NullString
+		if r.Watermark != "" {
+			var value interface{}
+			if err := tx.Get(&value, r.Watermark); err != nil {
+				return nil, err
+			}
+			mark = watermarkText(value)
+		}
+
+		if r.incremental() && !full && since.Valid {
+			if mark == since {
+				return nil, nil
+			}
+			if err := m.replaceChanged(tx, r, since.String); err != nil {
+				return nil, err
+			}
+		} else if err := m.replaceAll(tx, r); err != nil {
+			return nil, err
+		}
+
+		return nil, m.saveWatermark(tx, r.Name, mark, found)
+	})
+	if err != nil {
+		return fmt.Errorf("rollup: refreshing %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+func (m *Manager) replaceAll(tx db.UnitOfWork, r Rollup) error {
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s", r.Table)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf("%s %s", insertInto(r), r.Query))
+	return err
+}
+
+// replaceChanged replaces the rows of the groups Incremental finds changed
+// since the watermark. The changed groups are materialized once in a
+// temporary table, so that the rows deleted are those inserted again even
+// when writes commit in between, whatever the isolation level.
+func (m *Manager) replaceChanged(tx db.UnitOfWork, r Rollup, since string) error {
+	columns := "*"
+	if len(r.Columns) > 0 {
+		columns = strings.Join(r.Columns, ", ")
+	}
+	same := make([]string, len(r.Key))
+	for i, column := range r.Key {
+		same[i] = fmt.Sprintf("%s.%s = %s.%s", changedTable, column, r.Table, column)
+	}
+
+	// temporary tables outlive failed transactions on MySQL
+	drop := "DROP TABLE " + changedTable
+	if db.DialectOf(tx) == db.DialectMySQL {
+		drop = "DROP TEMPORARY TABLE " + changedTable
+		if _, err := tx.Exec(drop + " IF EXISTS"); err != nil {
+			return err
+		}
+	}
+
+	create := fmt.Sprintf("CREATE TEMPORARY TABLE %s AS SELECT %s FROM %s WHERE 1 = 0", changedTable, columns, r.Table)
+	if _, err := tx.Exec(create); err != nil {
+		return err
+	}
+	changed := fmt.Sprintf("%s %s", insertInto(Rollup{Table: changedTable, Columns: r.Columns}), r.Incremental)
+	if _, err := tx.NamedExec(changed, map[string]interface{}{"since": since}); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE EXISTS (SELECT 1 FROM %s WHERE %s)", r.Table, changedTable, strings.Join(same, " AND "))
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("%s SELECT %s FROM %s", insertInto(r), columns, changedTable)); err != nil {
+		return err
+	}
+	_, err := tx.Exec(drop)
+	return err
+}
+
+// changedTable is the temporary table of replaceChanged.
+const changedTable = "rollup_changed"
+
+func insertInto(r Rollup) string {
+	if len(r.Columns) == 0 {
+		return fmt.Sprintf("INSERT INTO %s", r.Table)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s)", r.Table, strings.Join(r.Columns, ", "))
+}
+
+func (m *Manager) watermark(uow db.UnitOfWork, name string) (sql.NullString, bool, error) {
+	var mark sql.NullString
+
+	query := uow.Rebind(fmt.Sprintf("SELECT watermark FROM %s WHERE name = ?", m.config.StateTable))
+	err := uow.Get(&mark, query, name)
+	if err == sql.ErrNoRows {
+		return mark, false, nil
+	}
+	return mark, err == nil, err
+}
+
+func (m *Manager) saveWatermark(uow db.UnitOfWork, name string, mark sql.NullString, found bool) error {
+	query := "UPDATE %s SET watermark = :watermark, refreshed_at = :now WHERE name = :name"
+	if !found {
+		query = "INSERT INTO %s (name, watermark, refreshed_at) VALUES (:name, :watermark, :now)"
+	}
+
+	_, err := uow.NamedExec(fmt.Sprintf(query, m.config.StateTable), map[string]interface{}{
+		"name": name, "watermark": mark, "now": time.Now().UTC(),
+	})
+	return err
+}
+
+// watermarkText stores watermarks as text that binds back in comparisons,
+// times as RFC 3339.
+func watermarkText(value interface{}) sql.NullString {
+	switch v := value.(type) {
+	case nil:
+		return sql.NullString{}
+	case time.Time:
+		return sql.NullString{String: v.UTC().Format(time.RFC3339Nano), Valid: true}
+	case []byte:
+		return sql.NullString{String: string(v), Valid: true}
+	default:
+		return sql.NullString{String: fmt.Sprint(v), Valid: true}
+	}
+}
+
+// Run refreshes the rollups until ctx is done: each one with an Interval
+// once per interval, starting right away, and those whose sources were
+// written through a Hook once the writes commit. Failed refreshes are logged
+// and tried again at the next occasion.
+func (m *Manager) Run(ctx context.Context) error {
+	next := map[string]time.Time{}
+	for {
+		now := time.Now()
+		due := m.takePending()
+		for _, name := range m.order {
+			interval := m.rollups[name].Interval
+			if interval > 0 && !now.Before(next[name]) {
+				due[name] = true
+			}
+			if due[name] {
+				if err := m.Refresh(ctx, name); err != nil && ctx.Err() == nil {
+					db.Logger().ErrorContext(ctx, "rollup: refresh failed", "rollup", name, "err", err)
+				}
+				if interval > 0 {
+					next[name] = time.Now().Add(interval)
+				}
+			}
+		}
+
+		var wake <-chan time.Time
+		var timer *time.Timer
+		if earliest := m.earliest(next); !earliest.IsZero() {
+			timer = time.NewTimer(time.Until(earliest))
+			wake = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-m.notify:
+		case <-wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (m *Manager) earliest(next map[string]time.Time) time.Time {
+	var earliest time.Time
+	for _, at := range next {
+		if earliest.IsZero() || at.Before(earliest) {
+			earliest = at
+		}
+	}
+	return earliest
+}
+
+func (m *Manager) takePending() map[string]bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := m.pending
+	m.pending = map[string]bool{}
+	return pending
+}
+
+// request marks the rollups reading tables for the next round of Run.
+func (m *Manager) request(tables map[string]bool) {
+	m.mu.Lock()
+	requested := false
+	for _, name := range m.order {
+		for _, source := range m.rollups[name].Sources {
+			if tables[source] {
+				m.pending[name] = true
+				requested = true
+				break
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	if requested {
+		select {
+		case m.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Hook returns a hook for one unit of work, asking Run to refresh the rollups
+// whose sources it writes once the writes commit, or right away outside a
+// transaction:
+//
+//	uow := db.NewUnitOfWork(database, nil, db.WithHooks(manager.Hook()))
+//
+// The hook keeps the tables written in the transaction, so every unit of
+// work needs its own.
+func (m *Manager) Hook() db.Hook {
+	return &writeHook{manager: m, written: map[string]bool{}}
+}
+
+type writeHook struct {
+	db.NopHook
+	manager *Manager
+	written map[string]bool
+}
+
+func (h *writeHook) AfterQuery(ctx context.Context, stmt *db.Statement, err error) {
+	if err != nil {
+		return
+	}
+	info := db.Inspect(stmt.Driver, stmt.Query)
+	if len(info.Operations) == 0 {
+		return
+	}
+
+	for _, table := range info.Tables {
+		h.written[strings.ToLower(table)] = true
+	}
+	if !stmt.InTx {
+		h.flush()
+	}
+}
+
+func (h *writeHook) AfterCommit(ctx context.Context, err error) {
+	if err == nil {
+		h.flush()
+	}
+	h.written = map[string]bool{}
+}
+
+func (h *writeHook) AfterRollback(ctx context.Context, err error) {
+	h.written = map[string]bool{}
+}
+
+func (h *writeHook) flush() {
+	if len(h.written) > 0 {
+		h.manager.request(h.written)
+		h.written = map[string]bool{}
+	}
+}
+
+func (m *Manager) unitOfWork(ctx context.Context) db.UnitOfWork {
+	return db.NewUnitOfWork(m.db, nil, append([]db.Option{db.WithContext(ctx)}, m.config.Options...)...)
+}
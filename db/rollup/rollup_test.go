@@ -0,0 +1,168 @@
+package rollup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/helderfarias/sqlx-wrapper/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+var revenue = Rollup{
+	Name:      "revenue-per-day",
+	Table:     "revenue_per_day",
+	Columns:   []string{"day", "revenue"},
+	Query:     "SELECT day, SUM(total) FROM orders GROUP BY day",
+	Key:       []string{"day"},
+	Watermark: "SELECT MAX(updated_at) FROM orders",
+	Incremental: "SELECT day, SUM(total) FROM orders " +
+		"WHERE day IN (SELECT day FROM orders WHERE updated_at > :since) GROUP BY day",
+}
+
+func newMockManager(t *testing.T, rollups ...Rollup) (*Manager, *sqlx.DB, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	database := sqlx.NewDb(conn, "postgres")
+	m, err := New(database, Config{}, rollups...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, database, mock
+}
+
+func TestShouldRefreshInFullWithoutWatermark(t *testing.T) {
+	m, _, mock := newMockManager(t, revenue)
+	updated := time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT watermark FROM rollup_watermarks WHERE name = \$1$`).
+		WithArgs(revenue.Name).
+		WillReturnRows(sqlmock.NewRows([]string{"watermark"}))
+	mock.ExpectQuery(`^SELECT MAX\(updated_at\) FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(updated))
+	mock.ExpectExec(`^DELETE FROM revenue_per_day$`).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`^INSERT INTO revenue_per_day \(day, revenue\) SELECT day, SUM\(total\) FROM orders GROUP BY day$`).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	mock.ExpectExec(`^INSERT INTO rollup_watermarks \(name, watermark, refreshed_at\) VALUES \(\$1, \$2, \$3\)$`).
+		WithArgs(revenue.Name, "2026-10-14T09:30:00Z", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := m.Refresh(context.Background(), revenue.Name)
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefreshTheGroupsChangedSinceTheWatermark(t *testing.T) {
+	m, _, mock := newMockManager(t, revenue)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT watermark FROM rollup_watermarks`).
+		WillReturnRows(sqlmock.NewRows([]string{"watermark"}).AddRow("2026-10-14T09:30:00Z"))
+	mock.ExpectQuery(`^SELECT MAX\(updated_at\) FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow([]byte("2026-10-14T10:00:00Z")))
+	mock.ExpectExec(`^CREATE TEMPORARY TABLE rollup_changed AS SELECT day, revenue FROM revenue_per_day WHERE 1 = 0$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^INSERT INTO rollup_changed \(day, revenue\) SELECT day, SUM\(total\) FROM orders ` +
+		`WHERE day IN \(SELECT day FROM orders WHERE updated_at > \$1\) GROUP BY day$`).
+		WithArgs("2026-10-14T09:30:00Z").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DELETE FROM revenue_per_day WHERE EXISTS \(SELECT 1 FROM rollup_changed ` +
+		`WHERE rollup_changed.day = revenue_per_day.day\)$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^INSERT INTO revenue_per_day \(day, revenue\) SELECT day, revenue FROM rollup_changed$`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^DROP TABLE rollup_changed$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^UPDATE rollup_watermarks SET watermark = \$1, refreshed_at = \$2 WHERE name = \$3$`).
+		WithArgs("2026-10-14T10:00:00Z", sqlmock.AnyArg(), revenue.Name).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// nothing written since
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT watermark FROM rollup_watermarks`).
+		WillReturnRows(sqlmock.NewRows([]string{"watermark"}).AddRow("2026-10-14T10:00:00Z"))
+	mock.ExpectQuery(`^SELECT MAX\(updated_at\) FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow("2026-10-14T10:00:00Z"))
+	mock.ExpectCommit()
+
+	assert.Nil(t, m.Refresh(context.Background(), revenue.Name))
+	assert.Nil(t, m.Refresh(context.Background(), revenue.Name))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollBackFailedRefreshes(t *testing.T) {
+	m, _, mock := newMockManager(t, revenue)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT watermark FROM rollup_watermarks`).
+		WillReturnRows(sqlmock.NewRows([]string{"watermark"}).AddRow("2026-10-14T09:30:00Z"))
+	mock.ExpectQuery(`^SELECT MAX\(updated_at\) FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow("2026-10-14T10:00:00Z"))
+	mock.ExpectExec(`^DELETE FROM revenue_per_day$`).WillReturnError(errors.New("lock timeout"))
+	mock.ExpectRollback()
+
+	err := m.RefreshFull(context.Background(), revenue.Name)
+
+	assert.EqualError(t, err, "rollup: refreshing revenue-per-day: lock timeout")
+	assert.ErrorIs(t, m.Refresh(context.Background(), "unknown"), ErrUnknownRollup)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldValidateRollups(t *testing.T) {
+	_, err := New(nil, Config{}, Rollup{Name: "revenue"})
+	assert.EqualError(t, err, "rollup: rollup needs a name, a table and a query")
+
+	_, err = New(nil, Config{}, Rollup{Name: "revenue", Table: "revenue", Query: "SELECT 1", Incremental: "SELECT 1"})
+	assert.EqualError(t, err, "rollup: incremental revenue needs a key and a watermark")
+}
+
+func TestShouldRefreshRollupsOnceWritesToTheirSourcesCommit(t *testing.T) {
+	counts := Rollup{Name: "orders-per-status", Table: "orders_per_status",
+		Query: "SELECT status, COUNT(*) FROM orders GROUP BY status"}
+	m, database, mock := newMockManager(t, counts)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE orders SET status = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^UPDATE customers SET name = \$1`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT watermark FROM rollup_watermarks`).
+		WillReturnRows(sqlmock.NewRows([]string{"watermark"}).AddRow(nil))
+	mock.ExpectExec(`^DELETE FROM orders_per_status$`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^INSERT INTO orders_per_status SELECT status, COUNT\(\*\) FROM orders GROUP BY status$`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`^UPDATE rollup_watermarks`).
+		WithArgs(nil, sqlmock.AnyArg(), counts.Name).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+
+	uow := db.NewUnitOfWork(database, nil, db.WithHooks(m.Hook()))
+	_, err := uow.InTransaction(func(tx db.UnitOfWork) (interface{}, error) {
+		if _, err := tx.Exec("UPDATE orders SET status = $1 WHERE id = $2", "paid", 1); err != nil {
+			return nil, err
+		}
+		return tx.Exec("UPDATE customers SET name = $1 WHERE id = $2", "ada", 1)
+	})
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
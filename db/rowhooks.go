@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// rowHooks observe the rows of a KindQuery statement as its caller reads
+// them, whatever way it scans them.
+type rowHooks struct {
+	// row, when set, sees the values of every row read, as the driver
+	// returned them, and may replace them.
+	row func(columns []string, values []interface{})
+
+	// close, when set, is called once the rows are closed, with the number
+	// of rows read.
+	close func(read int64)
+}
+
+// hookedRows serves the rows wrapped by wrapRows: database/sql only builds
+// sql.Rows over a driver, so the wrapped rows are handed to it as the
+// argument of a query on a driver of its own. It serves failedRow the same
+// way.
+var hookedRows = sql.OpenDB(hookConnector{})
+
+// wrapRows returns rows reading from rows through hooks, so that interceptors
+// see rows read with Next and Scan, StructScan or MapScan alike. Closing the
+// returned rows closes rows.
+func wrapRows(ctx context.Context, rows *sqlx.Rows, hooks rowHooks) (*sqlx.Rows, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	source := &hookedSource{rows: rows.Rows, columns: columns, types: types, hooks: hooks}
+	wrapped, err := hookedRows.QueryContext(ctx, "", source)
+	if err != nil {
+		source.Close()
+		return nil, err
+	}
+	return &sqlx.Rows{Rows: wrapped, Mapper: rows.Mapper}, nil
+}
+
+// failedRow returns a row whose Scan returns err, for refusing statements
+// run through QueryRowxContext, whose Row cannot be built otherwise.
+func failedRow(ctx context.Context, err error) *sqlx.Row {
+	return sqlx.NewDb(hookedRows, "").QueryRowxContext(ctx, "", rowFailure{err})
+}
+
+// rowOf returns the first row of rows as a Row, for statements run through
+// QueryRowxContext as a KindQuery statement. Scanning the row closes rows.
+func rowOf(ctx context.Context, rows *sqlx.Rows) *sqlx.Row {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return failedRow(ctx, err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		rows.Close()
+		return failedRow(ctx, err)
+	}
+
+	source := &hookedSource{rows: rows.Rows, columns: columns, types: types}
+	row := sqlx.NewDb(hookedRows, "").QueryRowxContext(ctx, "", source)
+	row.Mapper = rows.Mapper
+	return row
+}
+
+// rowFailure is the argument of a query failing with err.
+type rowFailure struct {
+	err error
+}
+
+type hookConnector struct{}
+
+func (hookConnector) Connect(context.Context) (driver.Conn, error) { return hookConn{}, nil }
+func (hookConnector) Driver() driver.Driver                        { return hookDriver{} }
+
+type hookDriver struct{}
+
+func (hookDriver) Open(string) (driver.Conn, error) { return hookConn{}, nil }
+
+type hookConn struct{}
+
+var errHookedRows = errors.New("db: hooked rows only serve wrapped rows")
+
+func (hookConn) Prepare(string) (driver.Stmt, error) { return nil, errHookedRows }
+func (hookConn) Close() error                        { return nil }
+func (hookConn) Begin() (driver.Tx, error)           { return nil, errHookedRows }
+
+// CheckNamedValue accepts the wrapped rows and failures as arguments.
+func (hookConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (hookConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) == 1 {
+		switch arg := args[0].Value.(type) {
+		case *hookedSource:
+			return arg, nil
+		case rowFailure:
+			return nil, arg.err
+		}
+	}
+	return nil, errHookedRows
+}
+
+// hookedSource is the driver side of wrapped rows.
+type hookedSource struct {
+	rows    *sql.Rows
+	columns []string
+	types   []*sql.ColumnType
+	hooks   rowHooks
+
+	read      int64
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (s *hookedSource) Columns() []string {
+	return s.columns
+}
+
+func (s *hookedSource) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = s.rows.Close()
+		if s.hooks.close != nil {
+			s.hooks.close(s.read)
+		}
+	})
+	return s.closeErr
+}
+
+func (s *hookedSource) Next(dest []driver.Value) error {
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	values := make([]interface{}, len(s.columns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := s.rows.Scan(pointers...); err != nil {
+		return err
+	}
+
+	s.read++
+	if s.hooks.row != nil {
+		s.hooks.row(s.columns, values)
+	}
+	for i, v := range values {
+		dest[i] = v
+	}
+	return nil
+}
+
+func (s *hookedSource) ColumnTypeDatabaseTypeName(i int) string {
+	return s.types[i].DatabaseTypeName()
+}
+
+func (s *hookedSource) ColumnTypeNullable(i int) (bool, bool) {
+	return s.types[i].Nullable()
+}
+
+func (s *hookedSource) ColumnTypeLength(i int) (int64, bool) {
+	return s.types[i].Length()
+}
+
+func (s *hookedSource) ColumnTypePrecisionScale(i int) (int64, int64, bool) {
+	return s.types[i].DecimalSize()
+}
@@ -0,0 +1,340 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ForeignKey declares that Table.Column references References.ReferencedColumn.
+type ForeignKey struct {
+	Table            string
+	Column           string
+	References       string
+	ReferencedColumn string
+}
+
+// Masker replaces a column value with an anonymized one.
+type Masker func(value interface{}) interface{}
+
+// MaskPolicy maps columns to their masker. Keys are either "table.column"
+// or a bare "column" applying to every table; the qualified form wins.
+// Columns used by foreign keys should only get deterministic maskers such as
+// MaskHash, or sampled rows will no longer join.
+type MaskPolicy map[string]Masker
+
+// MaskNull replaces every value with NULL.
+func MaskNull(interface{}) interface{} {
+	return nil
+}
+
+// MaskWith replaces every non-NULL value with replacement.
+func MaskWith(replacement interface{}) Masker {
+	return func(value interface{}) interface{} {
+		if value == nil {
+			return nil
+		}
+		return replacement
+	}
+}
+
+// MaskHash replaces every non-NULL value with a salted hash of it, keeping
+// equal values equal so masked columns can still be joined and grouped.
+func MaskHash(salt string) Masker {
+	return func(value interface{}) interface{} {
+		if value == nil {
+			return nil
+		}
+		return saltedHash(salt, value)
+	}
+}
+
+// MaskEmail replaces every non-NULL value with a unique address on the
+// reserved example.invalid domain.
+func MaskEmail(salt string) Masker {
+	return func(value interface{}) interface{} {
+		if value == nil {
+			return nil
+		}
+		return "user-" + saltedHash(salt, value) + "@example.invalid"
+	}
+}
+
+func saltedHash(salt string, value interface{}) string {
+	sum := sha256.Sum256([]byte(salt + "\x00" + valueKey(value)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// valueKey renders a scanned value as a comparable string.
+func valueKey(value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// SamplerConfig configures a Sampler.
+type SamplerConfig struct {
+	// ForeignKeys followed from sampled rows to the parent rows they need.
+	ForeignKeys []ForeignKey
+
+	// BatchRows is the number of rows per INSERT statement. Zero means 100.
+	BatchRows int
+
+	// Options configure the snapshot the rows are sampled from, such as
+	// WithStatementLog to see which parents were followed.
+	Options []Option
+}
+
+// Sampler extracts anonymized subsets of production tables for load tests and
+// local development.
+type Sampler struct {
+	db     *sqlx.DB
+	config SamplerConfig
+}
+
+// NewSampler creates a sampler over db.
+func NewSampler(db *sqlx.DB, config SamplerConfig) *Sampler {
+	if config.BatchRows <= 0 {
+		config.BatchRows = 100
+	}
+
+	return &Sampler{db: db, config: config}
+}
+
+type sampledTable struct {
+	columns []string
+	// text marks the columns whose []byte values are text, see textColumns
+	text []bool
+	rows [][]interface{}
+	// keys already fetched, by column
+	seen map[string]map[string]bool
+}
+
+// Sample picks roughly fraction of the rows of table with a Bernoulli sample,
+// pulls in the parent rows they reference through the configured foreign
+// keys, recursively, and writes everything to w as an INSERT script, parents
+// first, with policy applied. All tables are read from one read-only
+// transaction.
+func (s *Sampler) Sample(ctx context.Context, table string, fraction float64, policy MaskPolicy, w io.Writer) error {
+	if fraction <= 0 || fraction > 1 {
+		return fmt.Errorf("db: sample fraction %v outside (0, 1]", fraction)
+	}
+
+	dialect := DialectFor(s.db.DriverName())
+
+	u := &unitOfWork{db: s.db, ctx: ctx}
+	u.apply(s.config.Options)
+
+	query, clientSide := sampleQuery(dialect, table, fraction)
+	sampled := map[string]*sampledTable{}
+
+	err := WithSnapshot(ctx, u, func(*Snapshot) error {
+		root, err := s.fetch(ctx, u, query, nil)
+		if err != nil {
+			return fmt.Errorf("db: sampling %s: %w", table, err)
+		}
+		if clientSide {
+			root.rows = bernoulli(root.rows, fraction)
+		}
+		sampled[table] = root
+
+		return s.fetchParents(ctx, u, dialect, sampled, table, root.rows)
+	})
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	written := map[string]bool{}
+	for _, t := range append(s.parentTables(table, map[string]bool{}), table) {
+		if written[t] {
+			continue
+		}
+		written[t] = true
+		s.write(out, dialect, t, sampled[t], policy)
+	}
+
+	return out.Flush()
+}
+
+func sampleQuery(dialect Dialect, table string, fraction float64) (string, bool) {
+	query := "SELECT * FROM " + dialect.Quote(table)
+	if fraction == 1 {
+		return query, false
+	}
+
+	switch dialect {
+	case DialectPostgres:
+		return query + " TABLESAMPLE BERNOULLI (" + strconv.FormatFloat(fraction*100, 'f', -1, 64) + ")", false
+	case DialectMySQL:
+		return query + " WHERE RAND() < " + strconv.FormatFloat(fraction, 'f', -1, 64), false
+	case DialectSQLite:
+		return query + " WHERE abs(random() % 1000000) < " + strconv.Itoa(int(fraction*1000000)), false
+	}
+
+	return query, true
+}
+
+func bernoulli(rows [][]interface{}, fraction float64) [][]interface{} {
+	var kept [][]interface{}
+	for _, row := range rows {
+		if rand.Float64() < fraction {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+func (s *Sampler) fetch(ctx context.Context, u *unitOfWork, query string, args []interface{}) (*sampledTable, error) {
+	rows, err := u.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &sampledTable{seen: map[string]map[string]bool{}}
+	if result.columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	if result.text, err = textColumns(rows); err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+		result.rows = append(result.rows, values)
+	}
+
+	return result, rows.Err()
+}
+
+// fetchParents loads the rows referenced by rows of table that have not been
+// loaded yet, then the parents of those.
+func (s *Sampler) fetchParents(ctx context.Context, u *unitOfWork, dialect Dialect, sampled map[string]*sampledTable, table string, rows [][]interface{}) error {
+	child := sampled[table]
+
+	for _, fk := range s.config.ForeignKeys {
+		if fk.Table != table {
+			continue
+		}
+		referenced := fk.ReferencedColumn
+		if referenced == "" {
+			referenced = "id"
+		}
+
+		column := indexOf(child.columns, fk.Column)
+		if column < 0 {
+			return fmt.Errorf("db: %s has no column %s", table, fk.Column)
+		}
+
+		parent := sampled[fk.References]
+		if parent == nil {
+			parent = &sampledTable{seen: map[string]map[string]bool{}}
+			sampled[fk.References] = parent
+		}
+		if parent.seen[referenced] == nil {
+			parent.seen[referenced] = map[string]bool{}
+			if key := indexOf(parent.columns, referenced); key >= 0 {
+				for _, row := range parent.rows {
+					parent.seen[referenced][valueKey(row[key])] = true
+				}
+			}
+		}
+
+		var missing []interface{}
+		for _, row := range rows {
+			value := row[column]
+			if value == nil || parent.seen[referenced][valueKey(value)] {
+				continue
+			}
+			parent.seen[referenced][valueKey(value)] = true
+			missing = append(missing, value)
+		}
+
+		for len(missing) > 0 {
+			batch := missing
+			if len(batch) > 500 {
+				batch = batch[:500]
+			}
+			missing = missing[len(batch):]
+
+			query := "SELECT * FROM " + dialect.Quote(fk.References) + " WHERE " + dialect.Quote(referenced) +
+				" IN (?" + strings.Repeat(", ?", len(batch)-1) + ")"
+			fetched, err := s.fetch(ctx, u, u.Rebind(query), batch)
+			if err != nil {
+				return fmt.Errorf("db: sampling %s: %w", fk.References, err)
+			}
+
+			parent.columns, parent.text = fetched.columns, fetched.text
+			parent.rows = append(parent.rows, fetched.rows...)
+
+			if err := s.fetchParents(ctx, u, dialect, sampled, fk.References, fetched.rows); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// parentTables lists the tables table depends on, most distant ancestors
+// first, ignoring cycles.
+func (s *Sampler) parentTables(table string, visiting map[string]bool) []string {
+	visiting[table] = true
+	defer delete(visiting, table)
+
+	var tables []string
+	for _, fk := range s.config.ForeignKeys {
+		if fk.Table != table || visiting[fk.References] {
+			continue
+		}
+		tables = append(tables, s.parentTables(fk.References, visiting)...)
+		tables = append(tables, fk.References)
+	}
+	return tables
+}
+
+func (s *Sampler) write(out *bufio.Writer, dialect Dialect, table string, sampled *sampledTable, policy MaskPolicy) {
+	if sampled == nil || len(sampled.rows) == 0 {
+		return
+	}
+
+	maskers := make([]Masker, len(sampled.columns))
+	for i, c := range sampled.columns {
+		maskers[i] = policy.masker(table, c)
+	}
+
+	inserts := &insertWriter{out: out, dialect: dialect, target: insertTarget(dialect, table, sampled.columns), batch: s.config.BatchRows, text: sampled.text}
+	for _, row := range sampled.rows {
+		masked := make([]interface{}, len(row))
+		for i, v := range row {
+			if maskers[i] != nil {
+				v = maskers[i](v)
+			}
+			masked[i] = v
+		}
+		inserts.row(masked)
+	}
+	inserts.flush()
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
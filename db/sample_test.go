@@ -0,0 +1,106 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSampleRowsWithTheirParentsMasked(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "orders" TABLESAMPLE BERNOULLI \(10\)`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "customer_id", "note"}).
+			AddRow(int64(1), int64(10), "call me").
+			AddRow(int64(2), int64(10), nil).
+			AddRow(int64(3), int64(11), "x"))
+	mock.ExpectQuery(`SELECT \* FROM "customers" WHERE "id" IN \(\$1, \$2\)`).WithArgs(int64(10), int64(11)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "email", "country_id"}).
+			AddRow(int64(10), "ann@corp.com", "br").
+			AddRow(int64(11), "bob@corp.com", "br"))
+	mock.ExpectQuery(`SELECT \* FROM "countries" WHERE "code" IN \(\$1\)`).WithArgs("br").WillReturnRows(
+		sqlmock.NewRows([]string{"code"}).AddRow("br"))
+	mock.ExpectCommit()
+
+	sampler := NewSampler(db, SamplerConfig{ForeignKeys: []ForeignKey{
+		{Table: "orders", Column: "customer_id", References: "customers"},
+		{Table: "customers", Column: "country_id", References: "countries", ReferencedColumn: "code"},
+	}})
+
+	var out bytes.Buffer
+	err := sampler.Sample(context.Background(), "orders", 0.1, MaskPolicy{
+		"email":       MaskEmail("s"),
+		"orders.note": MaskWith("redacted"),
+	}, &out)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	script := out.String()
+	countries := strings.Index(script, `INSERT INTO "countries"`)
+	customers := strings.Index(script, `INSERT INTO "customers"`)
+	orders := strings.Index(script, `INSERT INTO "orders"`)
+	assert.True(t, countries >= 0 && countries < customers && customers < orders, script)
+
+	assert.NotContains(t, script, "corp.com")
+	assert.Contains(t, script, "@example.invalid")
+	assert.Contains(t, script, "(1, 10, 'redacted')")
+	assert.Contains(t, script, "(2, 10, NULL)")
+}
+
+func TestShouldWriteSampledTextScannedAsBytesAsText(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "orders" TABLESAMPLE BERNOULLI \(10\)`).WillReturnRows(
+		sqlmock.NewRowsWithColumnDefinition(
+			sqlmock.NewColumn("id").OfType("UUID", []byte{}),
+			sqlmock.NewColumn("note").OfType("TEXT", []byte{}),
+			sqlmock.NewColumn("receipt").OfType("BYTEA", []byte{})).
+			AddRow([]byte("6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c"), []byte("call me"), []byte{0xca, 0xfe}))
+	mock.ExpectCommit()
+
+	var out bytes.Buffer
+	err := NewSampler(db, SamplerConfig{}).Sample(context.Background(), "orders", 0.1, MaskPolicy{
+		"orders.note": func(v interface{}) interface{} { return []byte(strings.ToUpper(string(v.([]byte)))) },
+	}, &out)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `INSERT INTO "orders" ("id", "note", "receipt") VALUES
+	('6f1c0b3e-8d2a-4c1e-9a7b-2f4d5e6a7b8c', 'CALL ME', '\xcafe');
+`, out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectInvalidSampleFractions(t *testing.T) {
+	db, _ := newMockDB(t, "postgres")
+
+	err := NewSampler(db, SamplerConfig{}).Sample(context.Background(), "orders", 1.5, nil, &bytes.Buffer{})
+
+	assert.Error(t, err)
+}
+
+func TestShouldSampleWithDialectSpecificQueries(t *testing.T) {
+	query, clientSide := sampleQuery(DialectMySQL, "orders", 0.25)
+	assert.Equal(t, "SELECT * FROM `orders` WHERE RAND() < 0.25", query)
+	assert.False(t, clientSide)
+
+	query, clientSide = sampleQuery(DialectANSI, "orders", 0.25)
+	assert.Equal(t, `SELECT * FROM "orders"`, query)
+	assert.True(t, clientSide)
+}
+
+func TestShouldMaskDeterministically(t *testing.T) {
+	hash := MaskHash("salt")
+
+	assert.Equal(t, hash("alice"), hash([]byte("alice")))
+	assert.NotEqual(t, hash("alice"), hash("bob"))
+	assert.NotEqual(t, hash("alice"), MaskHash("pepper")("alice"))
+	assert.Nil(t, hash(nil))
+	assert.Nil(t, MaskNull("secret"))
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"fmt"
+)
+
+// savepointStatements returns the statements creating, rolling back to and
+// releasing a savepoint. Postgres, MySQL and SQLite share the standard
+// syntax; after ROLLBACK TO the savepoint still exists on all three and is
+// released as well.
+func savepointStatements(name string) (create, rollback, release string) {
+	return "SAVEPOINT " + name, "ROLLBACK TO SAVEPOINT " + name, "RELEASE SAVEPOINT " + name
+}
+
+// inSavepoint runs contextOver, called by InTransaction inside a transaction,
+// in a savepoint: an error or panic rolls back what contextOver did, along
+// with the AfterCommit callbacks and invariants it registered, undoes its
+// onRollback changes, and leaves the enclosing transaction usable.
+func (u *unitOfWork) inSavepoint(contextOver func(db UnitOfWork) (interface{}, error)) (result interface{}, err error) {
+	u.savepoints++
+	defer func() { u.savepoints-- }()
+
+	create, rollback, release := savepointStatements(fmt.Sprintf("sp_%d", u.savepoints))
+	tx, ctx := u.tx, u.context()
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return nil, err
+	}
+
+	callbacks, invariants, undos := len(u.afterCommit), len(u.invariants), len(u.afterRollback)
+	undo := func() error {
+		u.afterCommit = u.afterCommit[:callbacks]
+		u.invariants = u.invariants[:invariants]
+		u.rolledBack(undos)
+		if _, err := tx.ExecContext(ctx, rollback); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, release)
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if err := undo(); err != nil {
+				u.log().Error("db: rollback to savepoint failed", "err", err)
+			}
+			panic(r)
+		}
+	}()
+
+	result, err = contextOver(u)
+	if err != nil {
+		if undoErr := undo(); undoErr != nil {
+			return result, fmt.Errorf("%w (rolling back to savepoint: %v)", err, undoErr)
+		}
+		return result, err
+	}
+
+	_, err = tx.ExecContext(ctx, release)
+	return result, err
+}
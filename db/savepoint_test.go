@@ -0,0 +1,69 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldNestTransactionsInSavepoints(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO orders").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^INSERT INTO coupons").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^SAVEPOINT sp_2$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_2$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var callbacks []string
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("INSERT INTO orders (id) VALUES (1)")
+
+		_, err := tx.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+			tx.AfterCommit(func() { callbacks = append(callbacks, "coupon") })
+			tx.MustExec("INSERT INTO coupons (order_id) VALUES (1)")
+			return nil, assert.AnError
+		})
+		assert.Equal(t, assert.AnError, err)
+
+		return tx.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+			return tx.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+				tx.AfterCommit(func() { callbacks = append(callbacks, "order") })
+				return nil, nil
+			})
+		})
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"order"}, callbacks)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollBackToSavepointOnPanic(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^ROLLBACK TO SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	boom := errors.New("boom")
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		assert.PanicsWithValue(t, boom, func() {
+			tx.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+				panic(boom)
+			})
+		})
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
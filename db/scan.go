@@ -0,0 +1,141 @@
+package db
+
+import (
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+)
+
+// ScanProgress reports how far ScanTable got. LastKey is the key of the last
+// row yielded, the checkpoint to resume from with ScanAfter.
+type ScanProgress struct {
+	Batches int
+	Rows    int64
+	LastKey interface{}
+
+	// Err is the error of the batch query that ended the scan, if any.
+	Err error
+}
+
+// ScanOption configures ScanTable.
+type ScanOption func(*scanConfig)
+
+type scanConfig struct {
+	after    interface{}
+	progress func(ScanProgress) error
+}
+
+// ScanAfter resumes a scan after key, typically the LastKey of a previous
+// one.
+func ScanAfter(key interface{}) ScanOption {
+	return func(c *scanConfig) {
+		c.after = key
+	}
+}
+
+// OnScanProgress calls fn once every row of a batch was yielded, and once
+// with Err set when a batch query fails. Returning an error, e.g. when saving
+// the checkpoint failed, ends the scan.
+func OnScanProgress(fn func(ScanProgress) error) ScanOption {
+	return func(c *scanConfig) {
+		c.progress = fn
+	}
+}
+
+// ScanTable walks every row of table in keyColumn order, batchSize rows per
+// query, seeking past the last key read instead of using OFFSET, so that the
+// cost of a batch does not grow with the position in the table. T is a
+// struct, whose mapped fields must include keyColumn, or a scalar holding the
+// key itself; registered models select their columns, other structs select
+// *. Batches are separate statements: rows written during the scan may or
+// may not be seen. A failing query ends the sequence, reporting the error
+// to OnScanProgress, or panicking like the Must methods when there is no
+// progress callback.
+func ScanTable[T any](uow UnitOfWork, table, keyColumn string, batchSize int, opts ...ScanOption) iter.Seq[T] {
+	config := scanConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	columns := "*"
+	var zero T
+	if model, err := ModelOf(&zero); err == nil {
+		columns = strings.Join(model.Columns, ", ")
+	}
+	if reflect.TypeOf(zero) != nil && reflect.TypeOf(zero).Kind() != reflect.Struct {
+		columns = keyColumn
+	}
+
+	first := uow.Rebind(fmt.Sprintf("SELECT %s FROM %s ORDER BY %s LIMIT %d", columns, table, keyColumn, batchSize))
+	next := uow.Rebind(fmt.Sprintf("SELECT %s FROM %s WHERE %s > ? ORDER BY %s LIMIT %d", columns, table, keyColumn, keyColumn, batchSize))
+
+	return func(yield func(T) bool) {
+		progress := ScanProgress{LastKey: config.after}
+
+		for {
+			var rows []T
+			var err error
+			if progress.LastKey == nil {
+				err = uow.Select(&rows, first)
+			} else {
+				err = uow.Select(&rows, next, progress.LastKey)
+			}
+			if err == nil && len(rows) > 0 {
+				progress.LastKey, err = scanKey(rows[len(rows)-1], keyColumn)
+			}
+			if err != nil {
+				progress.Err = fmt.Errorf("db: scanning %s after %v: %w", table, progress.LastKey, err)
+				if config.progress == nil {
+					panic(progress.Err)
+				}
+				config.progress(progress)
+				return
+			}
+			if len(rows) == 0 {
+				return
+			}
+
+			for _, row := range rows {
+				if !yield(row) {
+					return
+				}
+			}
+
+			progress.Batches++
+			progress.Rows += int64(len(rows))
+			if config.progress != nil && config.progress(progress) != nil {
+				return
+			}
+			if len(rows) < batchSize {
+				return
+			}
+		}
+	}
+}
+
+// scanKey returns the value of keyColumn on row.
+func scanKey(row interface{}, keyColumn string) (interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	if v.Kind() != reflect.Struct {
+		return keyValue(v.Interface()), nil
+	}
+
+	field, ok := fieldByColumn(mapper, v, keyColumn)
+	if !ok {
+		return nil, fmt.Errorf("db: %s has no field mapped to %s", v.Type(), keyColumn)
+	}
+	return keyValue(field.Interface()), nil
+}
+
+// keyValue turns the text some drivers return keys as into strings, so they
+// can be bound again.
+func keyValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldScanTableInKeysetBatches(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id, status FROM orders ORDER BY id LIMIT 2$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open").AddRow(4, "paid"))
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE id > \? ORDER BY id LIMIT 2$`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+
+	var checkpoints []interface{}
+	var orders []repositoryOrder
+	for order := range ScanTable[repositoryOrder](uw, "orders", "id", 2, OnScanProgress(func(p ScanProgress) error {
+		checkpoints = append(checkpoints, p.LastKey)
+		return nil
+	})) {
+		orders = append(orders, order)
+	}
+
+	assert.Equal(t, []repositoryOrder{{1, "open"}, {4, "paid"}, {7, "open"}}, orders)
+	assert.Equal(t, []interface{}{int64(4), int64(7)}, checkpoints)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldResumeScanAfterCheckpoint(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id FROM orders WHERE id > \? ORDER BY id LIMIT 10$`).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7).AddRow(9))
+
+	var ids []int64
+	for id := range ScanTable[int64](uw, "orders", "id", 10, ScanAfter(4)) {
+		ids = append(ids, id)
+	}
+
+	assert.Equal(t, []int64{7, 9}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReportScanErrorsToProgress(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id, status FROM orders ORDER BY id LIMIT 1000$`).WillReturnError(errors.New("connection reset"))
+
+	var last ScanProgress
+	for range ScanTable[repositoryOrder](uw, "orders", "id", 0, OnScanProgress(func(p ScanProgress) error {
+		last = p
+		return nil
+	})) {
+		t.Fatal("no row expected")
+	}
+
+	assert.EqualError(t, last.Err, "db: scanning orders after <nil>: connection reset")
+	assert.Panics(t, func() {
+		uw, mock := newMockUnitOfWork(t)
+		mock.ExpectQuery(`^SELECT`).WillReturnError(errors.New("connection reset"))
+		for range ScanTable[repositoryOrder](uw, "orders", "id", 0) {
+		}
+	})
+}
+
+func TestShouldFailWhenTheScanKeyIsNotMapped(t *testing.T) {
+	_, err := scanKey(repositoryOrder{ID: 4}, "number")
+	assert.EqualError(t, err, "db: db.repositoryOrder has no field mapped to number")
+
+	key, err := scanKey(&repositoryOrder{ID: 4}, "id")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), key)
+}
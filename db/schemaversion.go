@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrSchemaTooOld is returned by RequireSchemaVersion when the database is
+// behind the code.
+var ErrSchemaTooOld = errors.New("db: database schema is older than required")
+
+// SchemaGateOptions configures RequireSchemaVersion.
+type SchemaGateOptions struct {
+	// Table records applied migrations, as db/migrate does. Zero means
+	// schema_migrations.
+	Table string
+
+	// Wait is how long to keep checking for the migrations to catch up, e.g.
+	// while a deploy runs them concurrently. Zero checks once.
+	Wait time.Duration
+
+	// Interval is the pause between checks. Zero means 2 seconds.
+	Interval time.Duration
+}
+
+// RequireSchemaVersion blocks until db has applied migration minVersion,
+// returning its highest applied version. When opts.Wait elapses first it
+// returns ErrSchemaTooOld, or the last error checking, so that the service
+// can refuse to start or enter a degraded mode instead of running queries
+// the schema cannot serve. A missing table counts as failing the check.
+func RequireSchemaVersion(ctx context.Context, db *sqlx.DB, minVersion int64, opts SchemaGateOptions) (int64, error) {
+	if opts.Table == "" {
+		opts.Table = "schema_migrations"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 2 * time.Second
+	}
+
+	deadline := time.Now().Add(opts.Wait)
+	query := fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", opts.Table)
+
+	for {
+		var version int64
+		err := db.GetContext(ctx, &version, query)
+		if err == nil {
+			if version >= minVersion {
+				return version, nil
+			}
+			err = fmt.Errorf("%w: at version %d, %d required", ErrSchemaTooOld, version, minVersion)
+		}
+
+		if !time.Now().Add(opts.Interval).Before(deadline) {
+			return version, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return version, ctx.Err()
+		case <-time.After(opts.Interval):
+		}
+	}
+}
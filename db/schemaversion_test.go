@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldPassSchemaGateAtRequiredVersion(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\), 0\\) FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(42))
+
+	version, err := RequireSchemaVersion(context.Background(), database, 40, SchemaGateOptions{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), version)
+}
+
+func TestShouldFailSchemaGateWhenSchemaIsOlder(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(39))
+
+	version, err := RequireSchemaVersion(context.Background(), database, 40, SchemaGateOptions{})
+
+	assert.True(t, errors.Is(err, ErrSchemaTooOld))
+	assert.EqualError(t, err, "db: database schema is older than required: at version 39, 40 required")
+	assert.Equal(t, int64(39), version)
+}
+
+func TestShouldWaitForMigrationsToCatchUp(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("FROM versions").WillReturnError(errors.New(`relation "versions" does not exist`))
+	mock.ExpectQuery("FROM versions").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(39))
+	mock.ExpectQuery("FROM versions").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(40))
+
+	version, err := RequireSchemaVersion(context.Background(), database, 40,
+		SchemaGateOptions{Table: "versions", Wait: time.Second, Interval: time.Millisecond})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(40), version)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ScriptOptions configures RunScript.
+type ScriptOptions struct {
+	// Transactional runs the script in one transaction, committed only when
+	// every statement succeeded. Otherwise each statement commits on its own,
+	// as statements such as CREATE INDEX CONCURRENTLY or VACUUM require, and
+	// may run on a different pooled connection: session settings made by one
+	// statement do not reliably reach the next.
+	Transactional bool
+
+	// ContinueOnError runs the remaining statements after a failure. It is
+	// ignored by transactional runs, which stop at the first failure.
+	ContinueOnError bool
+
+	// Options configure the unit of work running the statements, whether in
+	// one transaction or one by one.
+	Options []Option
+}
+
+// ScriptStatementResult is the outcome of one statement of a script.
+type ScriptStatementResult struct {
+	SQL string
+
+	// Line is the line of the script the statement starts on, from 1.
+	Line int
+
+	RowsAffected int64
+	Duration     time.Duration
+	Err          error
+
+	// Skipped is set for statements not run because an earlier one failed.
+	Skipped bool
+}
+
+// ScriptResult is the outcome of RunScript, with a result for every statement
+// of the script, in order.
+type ScriptResult struct {
+	Statements []ScriptStatementResult
+
+	// Committed reports, for transactional runs, whether the transaction
+	// committed.
+	Committed bool
+}
+
+// Failed returns the results of the statements that failed.
+func (r *ScriptResult) Failed() []ScriptStatementResult {
+	var failed []ScriptStatementResult
+	for _, s := range r.Statements {
+		if s.Err != nil {
+			failed = append(failed, s)
+		}
+	}
+	return failed
+}
+
+// RunScript splits script into statements, respecting strings, quoted
+// identifiers, dollar-quoted bodies and comments, and executes them in order.
+// The returned error reports the first failing statement and its line; the
+// result details every statement either way.
+func RunScript(ctx context.Context, db *sqlx.DB, script string, opts ScriptOptions) (*ScriptResult, error) {
+	result := &ScriptResult{}
+	for _, s := range scriptStatements(DialectFor(db.DriverName()), script) {
+		result.Statements = append(result.Statements, ScriptStatementResult{
+			SQL:     s.sql,
+			Line:    strings.Count(script[:s.offset], "\n") + 1,
+			Skipped: true,
+		})
+	}
+
+	u := &unitOfWork{db: db, ctx: ctx}
+	u.apply(opts.Options)
+
+	run := func() error {
+		// a retried transaction runs the whole script again
+		var first error
+		for i := range result.Statements {
+			result.Statements[i].Skipped, result.Statements[i].Err = true, nil
+		}
+
+		for i := range result.Statements {
+			s := &result.Statements[i]
+			s.Skipped = false
+
+			started := time.Now()
+			res, err := u.exec(u.context(), s.SQL)
+			if err == nil {
+				s.RowsAffected, err = res.RowsAffected()
+			}
+			s.Duration = time.Since(started)
+
+			if err != nil {
+				s.Err = err
+				if first == nil {
+					first = fmt.Errorf("db: statement %d at line %d: %w", i+1, s.Line, err)
+				}
+				if opts.Transactional || !opts.ContinueOnError {
+					break
+				}
+			}
+		}
+		return first
+	}
+
+	if !opts.Transactional {
+		return result, run()
+	}
+
+	if _, err := u.InTransaction(func(UnitOfWork) (interface{}, error) { return nil, run() }); err != nil {
+		return result, err
+	}
+	result.Committed = true
+	return result, nil
+}
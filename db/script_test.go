@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const vendorScript = `-- vendor schema
+CREATE TABLE audit (id bigint);
+
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+	NEW.updated_at := now(); RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+INSERT INTO audit VALUES (1);
+`
+
+func TestShouldRunScriptInTransactionReportingStatements(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE audit").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE FUNCTION touch").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := RunScript(context.Background(), database, vendorScript, ScriptOptions{Transactional: true})
+
+	assert.Nil(t, err)
+	assert.True(t, result.Committed)
+	assert.Len(t, result.Statements, 3)
+	assert.Equal(t, []int{2, 4, 9}, []int{result.Statements[0].Line, result.Statements[1].Line, result.Statements[2].Line})
+	assert.Contains(t, result.Statements[1].SQL, "RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql")
+	assert.Equal(t, int64(1), result.Statements[2].RowsAffected)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldStopTransactionalScriptAtFirstFailure(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE TABLE audit").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE FUNCTION touch").WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	result, err := RunScript(context.Background(), database, vendorScript, ScriptOptions{Transactional: true, ContinueOnError: true})
+
+	assert.EqualError(t, err, "db: statement 2 at line 4: "+assert.AnError.Error())
+	assert.True(t, errors.Is(err, assert.AnError))
+	assert.False(t, result.Committed)
+	assert.Len(t, result.Failed(), 1)
+	assert.True(t, result.Statements[2].Skipped)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldContinueNonTransactionalScriptOnError(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("CREATE TABLE audit").WillReturnError(assert.AnError)
+	mock.ExpectExec("CREATE FUNCTION touch").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := RunScript(context.Background(), database, vendorScript, ScriptOptions{ContinueOnError: true})
+
+	assert.EqualError(t, err, "db: statement 1 at line 2: "+assert.AnError.Error())
+	assert.Equal(t, assert.AnError, result.Statements[0].Err)
+	assert.Nil(t, result.Statements[2].Err)
+	assert.False(t, result.Statements[2].Skipped)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRunCommitHooksOfTransactionalScripts(t *testing.T) {
+	db, mock := newMockDB(t, "postgres")
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	result, err := RunScript(context.Background(), db, "UPDATE orders SET status = 'paid'", ScriptOptions{
+		Transactional: true,
+		Options:       []Option{WithHooks(vetoHook{})},
+	})
+
+	assert.Equal(t, assert.AnError, err)
+	assert.False(t, result.Committed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrShedLoad is returned for statements and transactions load shedding
+// refused to queue for a connection. Callers should fail fast, e.g. with a 503, and
+// not retry right away.
+var ErrShedLoad = errors.New("db: load shed")
+
+// Priority ranks statements for load shedding. The zero value is
+// PriorityNormal.
+type Priority int
+
+const (
+	// PriorityLow is for work that can wait, such as reports and backfills.
+	// It is shed first.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is for regular traffic, shed once PriorityLow is.
+	PriorityNormal
+	// PriorityHigh is for work that must go through, such as payments and
+	// health checks. It is never shed.
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context running its statements at priority.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// PriorityFrom returns the priority stored by WithPriority.
+func PriorityFrom(ctx context.Context) (Priority, bool) {
+	priority, ok := ctx.Value(priorityKey{}).(Priority)
+	return priority, ok
+}
+
+// LoadSheddingConfig configures a LoadSheddingInterceptor or WithLoadShedding.
+type LoadSheddingConfig struct {
+	// Wait is the average wait for a pool connection above which statements
+	// start being shed. Zero means 50ms.
+	Wait time.Duration
+
+	// MaxWait is the average wait at which every PriorityLow statement is
+	// shed; PriorityNormal ones start being shed halfway between Wait and
+	// MaxWait and are all shed at MaxWait. Zero means four times Wait.
+	MaxWait time.Duration
+
+	// Interval is how often the pool statistics are sampled. Zero means one
+	// second.
+	Interval time.Duration
+
+	// Labels assigns priorities to labels, for statements whose context has
+	// none, see WithLabel.
+	Labels map[string]Priority
+
+	// OnShed, when set, is called for every statement shed, e.g. to count
+	// them.
+	OnShed func(stmt *Statement, priority Priority, wait time.Duration)
+}
+
+// LoadSheddingInterceptor sheds statements of lower priority with
+// ErrShedLoad while the pool of db is saturated, as measured by the average
+// time statements waited for a connection since the previous sample, so the
+// database recovers instead of collapsing under queued work. A statement is
+// shed with a probability growing with the wait, the lower its priority the
+// sooner. Shedding is spread evenly rather than at random, so that a
+// probability of one half sheds every other statement, not bursts of them.
+// Statements in a transaction already hold a connection and are never shed;
+// install it with WithLoadShedding to shed transactions as they begin.
+func LoadSheddingInterceptor(db *sqlx.DB, config LoadSheddingConfig) Interceptor {
+	return newLoadShedder(db.Stats, config).intercept
+}
+
+// WithLoadShedding sheds the statements of the unit of work like
+// LoadSheddingInterceptor, and its transactions as well: InTransaction fails
+// with ErrShedLoad before taking a connection when the priority of the
+// context of the unit of work is shed. Statements in the transaction are not.
+func WithLoadShedding(db *sqlx.DB, config LoadSheddingConfig) Option {
+	return newLoadShedder(db.Stats, config).option()
+}
+
+func (s *loadShedder) option() Option {
+	return func(u *unitOfWork) {
+		u.interceptors = append(u.interceptors, s.intercept)
+		u.beginChecks = append(u.beginChecks, func(ctx context.Context) error {
+			return s.check(ctx, &Statement{Kind: KindExec, Query: "BEGIN", Driver: u.db.DriverName(), Label: LabelFrom(ctx)})
+		})
+	}
+}
+
+type loadShedder struct {
+	config LoadSheddingConfig
+	stats  func() sql.DBStats
+
+	mu       sync.Mutex
+	sampled  time.Time
+	last     sql.DBStats
+	wait     time.Duration
+	pressure float64
+	debt     map[Priority]float64
+}
+
+func newLoadShedder(stats func() sql.DBStats, config LoadSheddingConfig) *loadShedder {
+	if config.Wait <= 0 {
+		config.Wait = 50 * time.Millisecond
+	}
+	if config.MaxWait <= config.Wait {
+		config.MaxWait = 4 * config.Wait
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+
+	return &loadShedder{
+		config:  config,
+		stats:   stats,
+		sampled: time.Now(),
+		last:    stats(),
+		debt:    map[Priority]float64{},
+	}
+}
+
+func (s *loadShedder) intercept(ctx context.Context, stmt *Statement, next Handler) error {
+	if stmt.InTx {
+		return next(ctx, stmt)
+	}
+	if err := s.check(ctx, stmt); err != nil {
+		return err
+	}
+	return next(ctx, stmt)
+}
+
+// check returns ErrShedLoad when stmt, run with ctx, is to be shed.
+func (s *loadShedder) check(ctx context.Context, stmt *Statement) error {
+	priority, ok := PriorityFrom(ctx)
+	if !ok {
+		priority = s.config.Labels[stmt.Label]
+	}
+
+	shed, wait := s.shed(priority, time.Now())
+	if !shed {
+		return nil
+	}
+
+	if s.config.OnShed != nil {
+		s.config.OnShed(stmt, priority, wait)
+	}
+	return fmt.Errorf("%w: %s priority statement at %s average pool wait", ErrShedLoad, priority, wait)
+}
+
+// shed reports whether a statement of priority is to be shed at now, and the
+// average pool wait that decided it.
+func (s *loadShedder) shed(priority Priority, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.sampled) >= s.config.Interval {
+		s.sample(s.stats(), now)
+	}
+
+	probability := s.probability(priority)
+	if probability <= 0 {
+		// start again from a random point, so that shedding resumes at a
+		// different offset for every priority
+		s.debt[priority] = rand.Float64()
+		return false, s.wait
+	}
+
+	// error diffusion: every statement adds its probability, and one is shed
+	// whenever a whole statement is owed
+	s.debt[priority] += probability
+	if s.debt[priority] < 1 {
+		return false, s.wait
+	}
+	s.debt[priority]--
+	return true, s.wait
+}
+
+// sample folds the pool statistics since the previous sample into the
+// pressure, from 0 below Wait to 1 at MaxWait.
+func (s *loadShedder) sample(stats sql.DBStats, now time.Time) {
+	waits := stats.WaitCount - s.last.WaitCount
+	waited := stats.WaitDuration - s.last.WaitDuration
+	elapsed := now.Sub(s.sampled)
+	s.last, s.sampled = stats, now
+
+	// WaitCount counts waits as they start, WaitDuration once they end, so
+	// the average understates waits still queued. While waits keep starting
+	// on a full pool, the wait is taken to be no shorter than before, and
+	// as long as the interval when none ended.
+	wait := time.Duration(0)
+	if waits > 0 {
+		wait = waited / time.Duration(waits)
+	}
+	if waits > 0 && stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections {
+		if waited == 0 {
+			wait = elapsed
+		}
+		if wait < s.wait {
+			wait = s.wait
+		}
+	}
+	s.wait = wait
+
+	s.pressure = float64(s.wait-s.config.Wait) / float64(s.config.MaxWait-s.config.Wait)
+	if s.pressure < 0 {
+		s.pressure = 0
+	} else if s.pressure > 1 {
+		s.pressure = 1
+	}
+}
+
+// probability returns the fraction of statements of priority to shed under
+// the current pressure.
+func (s *loadShedder) probability(priority Priority) float64 {
+	switch {
+	case priority <= PriorityLow:
+		return s.pressure
+	case priority == PriorityNormal:
+		return 2*s.pressure - 1
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// saturatedPool returns pool statistics where every sample after the first
+// adds ten waits of wait each.
+func saturatedPool(wait time.Duration) func() sql.DBStats {
+	var stats sql.DBStats
+	return func() sql.DBStats {
+		current := stats
+		stats.WaitCount += 10
+		stats.WaitDuration += 10 * wait
+		return current
+	}
+}
+
+func TestShouldShedLowerPrioritiesEvenlyAsPoolWaitGrows(t *testing.T) {
+	shedder := newLoadShedder(saturatedPool(150*time.Millisecond), LoadSheddingConfig{Wait: 100 * time.Millisecond, MaxWait: 200 * time.Millisecond})
+	now := time.Now().Add(time.Second)
+
+	var low, normal, high []bool
+	for i := 0; i < 6; i++ {
+		shed, wait := shedder.shed(PriorityLow, now)
+		assert.Equal(t, 150*time.Millisecond, wait)
+		low = append(low, shed)
+		shed, _ = shedder.shed(PriorityNormal, now)
+		normal = append(normal, shed)
+		shed, _ = shedder.shed(PriorityHigh, now)
+		high = append(high, shed)
+	}
+
+	assert.Equal(t, []bool{false, true, false, true, false, true}, low)
+	assert.Equal(t, make([]bool, 6), normal)
+	assert.Equal(t, make([]bool, 6), high)
+}
+
+func TestShouldFailShedStatementsBeforeTheyQueue(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^UPDATE payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO report_runs").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var shed []Priority
+	shedder := newLoadShedder(saturatedPool(time.Second), LoadSheddingConfig{
+		Interval: time.Nanosecond,
+		Labels:   map[string]Priority{"payments.capture": PriorityHigh},
+		OnShed:   func(stmt *Statement, priority Priority, wait time.Duration) { shed = append(shed, priority) },
+	})
+	uow := NewUnitOfWork(database, nil, WithInterceptors(shedder.intercept))
+	reports := WithPriority(context.Background(), PriorityLow)
+
+	_, err := uow.ExecContext(reports, "DELETE FROM report_cache")
+	assert.ErrorIs(t, err, ErrShedLoad)
+	assert.EqualError(t, err, "db: load shed: low priority statement at 1s average pool wait")
+	_, err = uow.ExecContext(context.Background(), "UPDATE orders SET status = 'paid'")
+	assert.ErrorIs(t, err, ErrShedLoad)
+	_, err = uow.ExecContext(WithLabel(context.Background(), "payments.capture"), "UPDATE payments SET captured = TRUE")
+	assert.Nil(t, err)
+
+	_, err = uow.InTransaction(func(uow UnitOfWork) (interface{}, error) {
+		return uow.ExecContext(reports, "INSERT INTO report_runs DEFAULT VALUES")
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []Priority{PriorityLow, PriorityNormal}, shed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldShedTransactionsAsTheyBegin(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO payments").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var shed []string
+	shedder := newLoadShedder(saturatedPool(time.Second), LoadSheddingConfig{
+		Interval: time.Nanosecond,
+		OnShed:   func(stmt *Statement, priority Priority, wait time.Duration) { shed = append(shed, stmt.Query) },
+	})
+	reports := NewUnitOfWork(database, nil, WithContext(WithPriority(context.Background(), PriorityLow)), shedder.option())
+	payments := NewUnitOfWork(database, nil, WithContext(WithPriority(context.Background(), PriorityHigh)), shedder.option())
+
+	_, err := reports.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		t.Fatal("shed transactions do not run")
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, ErrShedLoad)
+	_, err = payments.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return tx.Exec("INSERT INTO payments DEFAULT VALUES")
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"BEGIN"}, shed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldNotUnderstateWaitsStillQueuedOnAFullPool(t *testing.T) {
+	full := sql.DBStats{MaxOpenConnections: 10, InUse: 10}
+	shedder := newLoadShedder(func() sql.DBStats { return full }, LoadSheddingConfig{Wait: 100 * time.Millisecond})
+	start := time.Now()
+
+	full.WaitCount, full.WaitDuration = 10, 10*150*time.Millisecond
+	shedder.sample(full, start.Add(time.Second))
+	assert.Equal(t, 150*time.Millisecond, shedder.wait)
+
+	// a hundred more waits started, two ended quickly
+	full.WaitCount, full.WaitDuration = 110, full.WaitDuration+2*time.Millisecond
+	shedder.sample(full, start.Add(2*time.Second))
+	assert.Equal(t, 150*time.Millisecond, shedder.wait)
+
+	// none ended in a whole interval
+	full.WaitCount += 50
+	shedder.sample(full, start.Add(3*time.Second))
+	assert.Equal(t, time.Second, shedder.wait)
+
+	// the pool drained
+	full.InUse, full.WaitCount, full.WaitDuration = 2, full.WaitCount+1, full.WaitDuration+10*time.Millisecond
+	shedder.sample(full, start.Add(4*time.Second))
+	assert.Equal(t, 10*time.Millisecond, shedder.wait)
+}
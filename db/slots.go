@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReplicationSlot is the state of a Postgres replication slot.
+type ReplicationSlot struct {
+	Name     string `db:"slot_name"`
+	Type     string `db:"slot_type"`
+	Plugin   string `db:"plugin"`
+	Database string `db:"database"`
+	Active   bool   `db:"active"`
+
+	// RetainedBytes is the WAL kept on disk for the slot: the distance from
+	// its restart LSN to the current WAL position.
+	RetainedBytes int64 `db:"retained_bytes"`
+}
+
+// CreateReplicationSlot creates a logical slot decoding with plugin, e.g.
+// pgoutput or wal2json, or a physical slot when plugin is empty. The slot
+// retains WAL from now on until it is consumed or dropped.
+func CreateReplicationSlot(ctx context.Context, db *sqlx.DB, name, plugin string) error {
+	if err := requirePostgres(db, "replication slots"); err != nil {
+		return err
+	}
+
+	var err error
+	if plugin == "" {
+		_, err = db.ExecContext(ctx, "SELECT pg_create_physical_replication_slot($1, true)", name)
+	} else {
+		_, err = db.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, $2)", name, plugin)
+	}
+	return err
+}
+
+// DropReplicationSlot drops the slot, releasing the WAL it retains. Postgres
+// refuses to drop a slot in use.
+func DropReplicationSlot(ctx context.Context, db *sqlx.DB, name string) error {
+	if err := requirePostgres(db, "replication slots"); err != nil {
+		return err
+	}
+
+	_, err := db.ExecContext(ctx, "SELECT pg_drop_replication_slot($1)", name)
+	return err
+}
+
+// ReplicationSlots lists the replication slots of the server db connects to,
+// which must be a primary.
+func ReplicationSlots(ctx context.Context, db *sqlx.DB) ([]ReplicationSlot, error) {
+	if err := requirePostgres(db, "replication slots"); err != nil {
+		return nil, err
+	}
+
+	var slots []ReplicationSlot
+	err := db.SelectContext(ctx, &slots, "SELECT slot_name, slot_type, COALESCE(plugin, '') AS plugin, "+
+		"COALESCE(database, '') AS database, active, "+
+		"COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn), 0)::bigint AS retained_bytes "+
+		"FROM pg_replication_slots ORDER BY slot_name")
+	return slots, err
+}
+
+func requirePostgres(db *sqlx.DB, feature string) error {
+	if DialectFor(db.DriverName()) != DialectPostgres {
+		return fmt.Errorf("db: %s require postgres, not %s", feature, db.DriverName())
+	}
+	return nil
+}
+
+// SlotAlert reports a slot needing attention. Reason is retained_wal when the
+// slot holds more WAL than allowed, inactive when nothing consumed it for too
+// long.
+type SlotAlert struct {
+	Slot        ReplicationSlot
+	Reason      string
+	InactiveFor time.Duration
+}
+
+// SlotMonitorConfig configures a SlotMonitor.
+type SlotMonitorConfig struct {
+	// Interval between checks. Zero means one minute.
+	Interval time.Duration
+
+	// MaxRetainedBytes alerts on slots retaining more WAL. Zero means 1 GiB.
+	MaxRetainedBytes int64
+
+	// MaxInactive alerts on slots no consumer was connected to for longer,
+	// as observed by the monitor. Zero means one hour.
+	MaxInactive time.Duration
+
+	// OnAlert receives an alert per slot and reason on every check the
+	// condition holds.
+	OnAlert func(SlotAlert)
+}
+
+// SlotMonitor periodically checks replication slots for abandoned ones, which
+// make the primary retain WAL until its disk fills.
+type SlotMonitor struct {
+	db     *sqlx.DB
+	config SlotMonitorConfig
+
+	inactiveSince map[string]time.Time
+	now           func() time.Time
+}
+
+// NewSlotMonitor creates a monitor of the slots of db.
+func NewSlotMonitor(db *sqlx.DB, config SlotMonitorConfig) *SlotMonitor {
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.MaxRetainedBytes <= 0 {
+		config.MaxRetainedBytes = 1 << 30
+	}
+	if config.MaxInactive <= 0 {
+		config.MaxInactive = time.Hour
+	}
+
+	return &SlotMonitor{db: db, config: config, inactiveSince: map[string]time.Time{}, now: time.Now}
+}
+
+// Run checks the slots every interval until ctx is done. Failed checks are
+// retried on the next tick.
+func (m *SlotMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Check(ctx); err != nil {
+			Logger().Error("db: replication slot check failed", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check lists the slots once, raising alerts, and returns them.
+func (m *SlotMonitor) Check(ctx context.Context) ([]ReplicationSlot, error) {
+	slots, err := ReplicationSlots(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	seen := map[string]bool{}
+	for _, slot := range slots {
+		seen[slot.Name] = true
+
+		if slot.RetainedBytes > m.config.MaxRetainedBytes {
+			m.alert(SlotAlert{Slot: slot, Reason: "retained_wal"})
+		}
+
+		if slot.Active {
+			delete(m.inactiveSince, slot.Name)
+			continue
+		}
+		since, ok := m.inactiveSince[slot.Name]
+		if !ok {
+			since = now
+			m.inactiveSince[slot.Name] = now
+		}
+		if inactive := now.Sub(since); inactive > m.config.MaxInactive {
+			m.alert(SlotAlert{Slot: slot, Reason: "inactive", InactiveFor: inactive})
+		}
+	}
+
+	for name := range m.inactiveSince {
+		if !seen[name] {
+			delete(m.inactiveSince, name)
+		}
+	}
+	return slots, nil
+}
+
+func (m *SlotMonitor) alert(alert SlotAlert) {
+	if m.config.OnAlert != nil {
+		m.config.OnAlert(alert)
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func slotRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"slot_name", "slot_type", "plugin", "database", "active", "retained_bytes"})
+}
+
+func TestShouldCreateAndDropReplicationSlots(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("SELECT pg_create_logical_replication_slot\\(\\$1, \\$2\\)").WithArgs("cdc", "pgoutput").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SELECT pg_create_physical_replication_slot\\(\\$1, true\\)").WithArgs("standby").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SELECT pg_drop_replication_slot\\(\\$1\\)").WithArgs("cdc").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx := context.Background()
+	assert.Nil(t, CreateReplicationSlot(ctx, database, "cdc", "pgoutput"))
+	assert.Nil(t, CreateReplicationSlot(ctx, database, "standby", ""))
+	assert.Nil(t, DropReplicationSlot(ctx, database, "cdc"))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldListReplicationSlotsWithRetainedWAL(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery("FROM pg_replication_slots").
+		WillReturnRows(slotRows().AddRow("cdc", "logical", "pgoutput", "app", false, 5<<30))
+
+	slots, err := ReplicationSlots(context.Background(), database)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ReplicationSlot{{Name: "cdc", Type: "logical", Plugin: "pgoutput", Database: "app", RetainedBytes: 5 << 30}}, slots)
+}
+
+func TestShouldAlertOnAbandonedSlots(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("FROM pg_replication_slots").WillReturnRows(slotRows().
+			AddRow("cdc", "logical", "pgoutput", "app", false, 2<<30).
+			AddRow("live", "logical", "pgoutput", "app", true, 1024))
+	}
+
+	var alerts []SlotAlert
+	monitor := NewSlotMonitor(database, SlotMonitorConfig{
+		MaxInactive: time.Hour,
+		OnAlert:     func(a SlotAlert) { alerts = append(alerts, a) },
+	})
+	now := time.Now()
+	monitor.now = func() time.Time { return now }
+
+	_, err := monitor.Check(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, "retained_wal", alerts[0].Reason)
+
+	alerts = nil
+	now = now.Add(2 * time.Hour)
+	monitor.Check(context.Background())
+
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, "inactive", alerts[1].Reason)
+	assert.Equal(t, "cdc", alerts[1].Slot.Name)
+	assert.Equal(t, 2*time.Hour, alerts[1].InactiveFor)
+}
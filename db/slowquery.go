@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SlowQuery describes a statement that ran longer than the threshold of
+// WithSlowQueryLog.
+type SlowQuery struct {
+	// Query is the statement's Fingerprint, free of literal values.
+	Query    string
+	Args     []interface{}
+	Duration time.Duration
+	Label    string
+	InTx     bool
+	Err      error
+
+	// Plan is the output of EXPLAIN for the statement, when captured.
+	Plan string
+}
+
+// SlowQueryConfig configures WithSlowQueryLog.
+type SlowQueryConfig struct {
+	// Threshold above which statements are logged. Zero means one second.
+	Threshold time.Duration
+
+	// RedactArgs and PII leave the arguments out like they do for
+	// StatementLogConfig.
+	RedactArgs bool
+	PII        PIIClassification
+
+	// Explain captures the plan of slow statements on Postgres with EXPLAIN,
+	// which plans the statement without running it again. It runs on the
+	// connection of the statement, so in its transaction, and is skipped for
+	// statements that failed and for Query in a transaction, whose rows are
+	// still being read.
+	Explain bool
+
+	// ExplainTimeout bounds EXPLAIN. Zero means one second.
+	ExplainTimeout time.Duration
+
+	// OnSlowQuery receives every slow statement after it is logged, e.g. to
+	// count them or attach them to a trace.
+	OnSlowQuery func(ctx context.Context, slow SlowQuery)
+}
+
+// WithSlowQueryLog logs the statements of the unit of work running longer
+// than the threshold of config at slog.LevelWarn, through the logger of the
+// unit of work.
+func WithSlowQueryLog(config SlowQueryConfig) Option {
+	if config.Threshold <= 0 {
+		config.Threshold = time.Second
+	}
+	if config.ExplainTimeout <= 0 {
+		config.ExplainTimeout = time.Second
+	}
+
+	return func(u *unitOfWork) {
+		u.interceptors = append(u.interceptors, func(ctx context.Context, stmt *Statement, next Handler) error {
+			start := time.Now()
+			err := next(ctx, stmt)
+			duration := time.Since(start)
+			if duration < config.Threshold {
+				return err
+			}
+
+			slow := SlowQuery{
+				Query:    Fingerprint(stmt.Query),
+				Duration: duration,
+				Label:    stmt.Label,
+				InTx:     stmt.InTx,
+				Err:      err,
+			}
+			redacted := redactsArgs(stmt, config.RedactArgs, config.PII)
+			if !redacted {
+				slow.Args = stmt.Args
+			}
+
+			attrs := []slog.Attr{slog.String("query", slow.Query), slog.Duration("duration", duration), slog.Bool("in_tx", stmt.InTx)}
+			if redacted {
+				attrs = append(attrs, slog.Int("args", len(stmt.Args)))
+			} else {
+				attrs = append(attrs, slog.Any("args", stmt.Args))
+			}
+			if stmt.Label != "" {
+				attrs = append(attrs, slog.String("label", stmt.Label))
+			}
+			if err != nil {
+				attrs = append(attrs, slog.Any("err", err))
+			}
+			if config.Explain && explainable(stmt, err) {
+				plan, explainErr := u.explain(ctx, stmt, config.ExplainTimeout)
+				if explainErr != nil {
+					attrs = append(attrs, slog.Any("plan_err", explainErr))
+				} else {
+					slow.Plan = plan
+					attrs = append(attrs, slog.String("plan", plan))
+				}
+			}
+
+			u.log().LogAttrs(ctx, slog.LevelWarn, "db: slow statement", attrs...)
+			if config.OnSlowQuery != nil {
+				config.OnSlowQuery(ctx, slow)
+			}
+			return err
+		})
+	}
+}
+
+// explainable reports whether EXPLAIN can be run for stmt once it ran.
+func explainable(stmt *Statement, err error) bool {
+	if err != nil || DialectFor(stmt.Driver) != DialectPostgres || (stmt.Kind == KindQuery && stmt.InTx) {
+		return false
+	}
+
+	switch Inspect(stmt.Driver, stmt.Query).Verb {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE", "VALUES":
+		return true
+	}
+	return false
+}
+
+// explain returns the plan of stmt, bypassing the interceptors, on the
+// replica it ran on if any. Inside a transaction it runs in a savepoint, so
+// that an EXPLAIN failing or timing out does not abort the transaction.
+func (u *unitOfWork) explain(ctx context.Context, stmt *Statement, timeout time.Duration) (string, error) {
+	ext := u.ext()
+	if stmt.replica != nil {
+		ext = stmt.replica
+	} else if stmt.InTx {
+		create, rollback, release := savepointStatements("sp_explain")
+		if _, err := ext.ExecContext(ctx, create); err != nil {
+			return "", err
+		}
+		plan, err := readPlan(ctx, ext, stmt, timeout)
+		// the savepoint is left even if ctx was cancelled meanwhile
+		ctx = context.WithoutCancel(ctx)
+		if err != nil {
+			if _, undoErr := ext.ExecContext(ctx, rollback); undoErr != nil {
+				return "", fmt.Errorf("%w (rolling back to savepoint: %v)", err, undoErr)
+			}
+		}
+		if _, releaseErr := ext.ExecContext(ctx, release); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+		return plan, err
+	}
+	return readPlan(ctx, ext, stmt, timeout)
+}
+
+// readPlan runs EXPLAIN for stmt on ext within timeout.
+func readPlan(ctx context.Context, ext sqlx.ExtContext, stmt *Statement, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	rows, err := ext.QueryxContext(ctx, "EXPLAIN "+stmt.Query, stmt.Args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
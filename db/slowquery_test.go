@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldLogSlowStatementsWithTheirPlan(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectQuery(`^SELECT \* FROM orders WHERE status = \$1$`).
+		WithArgs("open").
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+	mock.ExpectQuery(`^EXPLAIN SELECT \* FROM orders WHERE status = \$1$`).
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).
+			AddRow("Seq Scan on orders  (cost=0.00..35.50 rows=10 width=40)").
+			AddRow("  Filter: (status = 'open'::text)"))
+	mock.ExpectExec(`^UPDATE orders`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var slow []SlowQuery
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger), WithSlowQueryLog(SlowQueryConfig{
+		Threshold:   10 * time.Millisecond,
+		Explain:     true,
+		OnSlowQuery: func(ctx context.Context, s SlowQuery) { slow = append(slow, s) },
+	}))
+
+	var orders []repositoryOrder
+	assert.Nil(t, uow.Select(&orders, "SELECT * FROM orders WHERE status = $1", "open"))
+	uow.MustExec("UPDATE orders SET status = $1 WHERE id = $2", "paid", 1)
+
+	plan := "Seq Scan on orders  (cost=0.00..35.50 rows=10 width=40)\n  Filter: (status = 'open'::text)"
+	assert.Len(t, slow, 1)
+	assert.Equal(t, Fingerprint("SELECT * FROM orders WHERE status = $1"), slow[0].Query)
+	assert.Equal(t, []interface{}{"open"}, slow[0].Args)
+	assert.Equal(t, plan, slow[0].Plan)
+	assert.Contains(t, buf.String(), `level=WARN msg="db: slow statement" query="`+slow[0].Query+`" in_tx=false args=[open] plan=`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRedactArgsOfSlowStatementsWithoutExplainingOutsidePostgres(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	mock.ExpectExec(`^UPDATE users SET password = \?`).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var slow []SlowQuery
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger), WithSlowQueryLog(SlowQueryConfig{
+		Threshold:   10 * time.Millisecond,
+		RedactArgs:  true,
+		Explain:     true,
+		OnSlowQuery: func(ctx context.Context, s SlowQuery) { slow = append(slow, s) },
+	}))
+
+	uow.MustExec("UPDATE users SET password = ? WHERE id = ?", "hunter2", 7)
+
+	assert.Len(t, slow, 1)
+	assert.Nil(t, slow[0].Args)
+	assert.Equal(t, "", slow[0].Plan)
+	assert.Equal(t, `level=WARN msg="db: slow statement" query="`+slow[0].Query+`" in_tx=false args=2
+`, buf.String())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldNotExplainQueriesStillReadInTransactions(t *testing.T) {
+	assert.False(t, explainable(&Statement{Kind: KindQuery, Driver: "postgres", InTx: true, Query: "SELECT 1"}, nil))
+	assert.False(t, explainable(&Statement{Kind: KindExec, Driver: "postgres", Query: "CREATE INDEX i ON t (c)"}, nil))
+	assert.False(t, explainable(&Statement{Kind: KindExec, Driver: "postgres", Query: "DELETE FROM t"}, assert.AnError))
+	assert.True(t, explainable(&Statement{Kind: KindQuery, Driver: "postgres", Query: "WITH x AS (SELECT 1) SELECT * FROM x"}, nil))
+}
+
+func TestShouldExplainOnTheReplicaTheStatementRanOn(t *testing.T) {
+	primary, _ := newMockDatabase(t, "postgres")
+	first, firstMock := newMockDatabase(t, "postgres")
+	second, secondMock := newMockDatabase(t, "postgres")
+	firstMock.ExpectQuery(`^SELECT id FROM orders$`).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	firstMock.ExpectQuery(`^EXPLAIN SELECT id FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow("Seq Scan on orders"))
+
+	var slow []SlowQuery
+	logger, _ := newBufferLogger()
+	uow := NewUnitOfWork(primary, nil, WithLogger(logger), WithReplicas(RoundRobin(), first, second), WithSlowQueryLog(SlowQueryConfig{
+		Threshold:   10 * time.Millisecond,
+		Explain:     true,
+		OnSlowQuery: func(ctx context.Context, s SlowQuery) { slow = append(slow, s) },
+	}))
+
+	var ids []int64
+	assert.Nil(t, uow.Select(&ids, "SELECT id FROM orders"))
+
+	assert.Equal(t, "Seq Scan on orders", slow[0].Plan)
+	assert.Nil(t, firstMock.ExpectationsWereMet())
+	assert.Nil(t, secondMock.ExpectationsWereMet())
+}
+
+func TestShouldExplainInTransactionsWithinASavepoint(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectExec(`^UPDATE orders`).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`^SAVEPOINT sp_explain$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`^EXPLAIN UPDATE orders`).WillReturnError(errors.New("canceling statement due to statement timeout"))
+	mock.ExpectExec(`^ROLLBACK TO SAVEPOINT sp_explain$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^RELEASE SAVEPOINT sp_explain$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^UPDATE order_items`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	logger, buf := newBufferLogger()
+	uow := NewUnitOfWork(database, nil, WithLogger(logger), WithSlowQueryLog(SlowQueryConfig{
+		Threshold: 10 * time.Millisecond,
+		Explain:   true,
+	}))
+
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("UPDATE orders SET status = $1 WHERE id = $2", "paid", 1)
+		tx.MustExec("UPDATE order_items SET status = $1 WHERE order_id = $2", "paid", 1)
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Contains(t, buf.String(), `plan_err="canceling statement due to statement timeout"`)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Snapshot is the read-only transaction of WithSnapshot or JoinSnapshot:
+// every query run through it sees the database as of the same instant, so
+// that an export spread over several queries is consistent.
+type Snapshot struct {
+	UnitOfWork
+
+	dialect Dialect
+
+	mu       sync.Mutex
+	exported string
+}
+
+// snapshotID matches the identifiers pg_export_snapshot returns, e.g.
+// 00000003-0000001B-1, which SET TRANSACTION SNAPSHOT cannot take as a
+// parameter.
+var snapshotID = regexp.MustCompile(`^[0-9A-Fa-f]+(-[0-9A-Fa-f]+)+$`)
+
+// WithSnapshot runs fn in a read-only transaction of uow, at repeatable read
+// isolation on Postgres and MySQL, ended once fn returns. uow must
+// not be in a transaction already, whose snapshot is already taken; it then
+// fails with ErrTransactionActive.
+//
+// On Postgres, the snapshot can be shared with workers exporting in
+// parallel, each over a unit of work of its own:
+//
+//	db.WithSnapshot(ctx, uow, func(snapshot *db.Snapshot) error {
+//		id, err := snapshot.Export()
+//		...
+//		for _, table := range tables {
+//			group.Go(func() error {
+//				return db.JoinSnapshot(ctx, db.NewUnitOfWork(database, nil), id, exportTable(table))
+//			})
+//		}
+//		return group.Wait()
+//	})
+func WithSnapshot(ctx context.Context, uow UnitOfWork, fn func(snapshot *Snapshot) error) error {
+	return inSnapshot(ctx, uow, "", fn)
+}
+
+// JoinSnapshot runs fn in a read-only transaction of uow sharing the snapshot
+// of another transaction, exported with Snapshot.Export, so that parallel
+// workers each export part of the same consistent state. It requires
+// Postgres, and the exporting transaction must still be open when the
+// snapshot is joined.
+func JoinSnapshot(ctx context.Context, uow UnitOfWork, id string, fn func(snapshot *Snapshot) error) error {
+	if dialect := DialectFor(uow.DriverName()); dialect != DialectPostgres {
+		return fmt.Errorf("db: joining snapshots requires postgres, not %s", dialect)
+	}
+	if !snapshotID.MatchString(id) {
+		return fmt.Errorf("db: invalid snapshot id %q", id)
+	}
+	return inSnapshot(ctx, uow, id, fn)
+}
+
+func inSnapshot(ctx context.Context, uow UnitOfWork, id string, fn func(snapshot *Snapshot) error) error {
+	u, ok := uow.(*unitOfWork)
+	if !ok {
+		return fmt.Errorf("db: snapshots need a unit of work of this package, not %T", uow)
+	}
+	if u.currentTx() != nil {
+		return fmt.Errorf("%w: a snapshot needs a transaction of its own", ErrTransactionActive)
+	}
+
+	dialect := DialectFor(u.DriverName())
+	_, err := u.inTransactionContext(ctx, snapshotOptions(dialect), func(tx UnitOfWork) (interface{}, error) {
+		if id != "" {
+			// must be the first statement of the transaction
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s'", id)); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, fn(&Snapshot{UnitOfWork: tx, dialect: dialect})
+	})
+	return err
+}
+
+// Export returns the id of the snapshot for JoinSnapshot, valid until the
+// transaction ends. It requires Postgres.
+func (s *Snapshot) Export() (string, error) {
+	if s.dialect != DialectPostgres {
+		return "", fmt.Errorf("db: exporting snapshots requires postgres, not %s", s.dialect)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.exported == "" {
+		if err := s.Get(&s.exported, "SELECT pg_export_snapshot()"); err != nil {
+			return "", err
+		}
+	}
+	return s.exported, nil
+}
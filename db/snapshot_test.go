@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRunQueriesOfASnapshotInOneTransaction(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT id FROM orders$`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`^SELECT order_id FROM items$`).WillReturnRows(sqlmock.NewRows([]string{"order_id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	var orders, items []int64
+	err := WithSnapshot(context.Background(), uw, func(snapshot *Snapshot) error {
+		if err := snapshot.Select(&orders, "SELECT id FROM orders"); err != nil {
+			return err
+		}
+		return snapshot.Select(&items, "SELECT order_id FROM items")
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, orders)
+	assert.Equal(t, []int64{1}, items)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseSnapshotsInsideTransactions(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	_, err := uw.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, WithSnapshot(context.Background(), tx, func(*Snapshot) error { return nil })
+	})
+
+	assert.True(t, errors.Is(err, ErrTransactionActive))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldShareExportedSnapshotsWithWorkers(t *testing.T) {
+	exporter, mock := newMockDatabase(t, "postgres")
+	worker, workerMock := newMockDatabase(t, "postgres")
+	mock.ExpectBegin()
+	mock.ExpectQuery(`^SELECT pg_export_snapshot\(\)$`).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_export_snapshot"}).AddRow("00000003-0000001B-1"))
+	mock.ExpectCommit()
+	workerMock.ExpectBegin()
+	workerMock.ExpectExec(`^SET TRANSACTION SNAPSHOT '00000003-0000001B-1'$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	workerMock.ExpectQuery(`^SELECT count\(\*\) FROM orders$`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	workerMock.ExpectCommit()
+
+	var count int64
+	err := WithSnapshot(context.Background(), NewUnitOfWork(exporter, nil), func(snapshot *Snapshot) error {
+		id, err := snapshot.Export()
+		if err != nil {
+			return err
+		}
+		return JoinSnapshot(context.Background(), NewUnitOfWork(worker, nil), id, func(snapshot *Snapshot) error {
+			return snapshot.Get(&count, "SELECT count(*) FROM orders")
+		})
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), count)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, workerMock.ExpectationsWereMet())
+}
+
+func TestShouldRefuseSnapshotExportsOutsidePostgres(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := WithSnapshot(context.Background(), uw, func(snapshot *Snapshot) error {
+		_, err := snapshot.Export()
+		return err
+	})
+	assert.EqualError(t, err, "db: exporting snapshots requires postgres, not ansi")
+
+	database, _ := newMockDatabase(t, "postgres")
+	err = JoinSnapshot(context.Background(), NewUnitOfWork(database, nil), "1'; DROP TABLE orders; --", func(*Snapshot) error { return nil })
+	assert.EqualError(t, err, `db: invalid snapshot id "1'; DROP TABLE orders; --"`)
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidSort is returned, wrapped, for malformed or disallowed sort specs.
+var ErrInvalidSort = errors.New("db: invalid sort")
+
+// Sorter maps API sort tokens onto validated ORDER BY clauses. A spec is a
+// comma separated list of fields, each optionally prefixed by + or - for the
+// direction and suffixed by :nulls_first or :nulls_last, for example
+//
+//	-created_at:nulls_last,name
+//
+// Columns are quoted for the dialect, so only whitelisted identifiers ever
+// reach the statement.
+type Sorter struct {
+	fields     map[string]string
+	tiebreaker string
+	maxFields  int
+}
+
+// NewSorter creates a sorter for the given API field to column mapping.
+// tiebreaker, usually the primary key, is appended to every clause that does
+// not already order by it so pagination stays deterministic.
+func NewSorter(fields map[string]string, tiebreaker string) *Sorter {
+	return &Sorter{fields: fields, tiebreaker: tiebreaker, maxFields: 8}
+}
+
+// OrderBy compiles spec into an ORDER BY clause for dialect. An empty spec
+// orders by the tiebreaker alone, or yields "" when there is none.
+func (s *Sorter) OrderBy(dialect Dialect, spec string) (string, error) {
+	var terms []string
+	seen := map[string]bool{}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if len(seen) == s.maxFields {
+			return "", fmt.Errorf("%w: more than %d fields", ErrInvalidSort, s.maxFields)
+		}
+
+		name, desc, nulls, err := parseSortItem(item)
+		if err != nil {
+			return "", err
+		}
+
+		column, ok := s.fields[name]
+		if !ok {
+			return "", fmt.Errorf("%w: unknown field %q", ErrInvalidSort, name)
+		}
+		if seen[column] {
+			return "", fmt.Errorf("%w: field %q repeated", ErrInvalidSort, name)
+		}
+		seen[column] = true
+
+		terms = append(terms, sortTerm(dialect, column, desc, nulls)...)
+	}
+
+	if s.tiebreaker != "" && !seen[s.tiebreaker] {
+		terms = append(terms, dialect.Quote(s.tiebreaker)+" ASC")
+	}
+
+	if len(terms) == 0 {
+		return "", nil
+	}
+
+	return "ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+func parseSortItem(item string) (name string, desc bool, nulls string, err error) {
+	name = item
+
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		switch strings.ToLower(name[i+1:]) {
+		case "nulls_first":
+			nulls = "FIRST"
+		case "nulls_last":
+			nulls = "LAST"
+		default:
+			return "", false, "", fmt.Errorf("%w: unknown modifier in %q", ErrInvalidSort, item)
+		}
+		name = name[:i]
+	}
+
+	switch {
+	case strings.HasPrefix(name, "-"):
+		desc = true
+		name = name[1:]
+	case strings.HasPrefix(name, "+"):
+		name = name[1:]
+	}
+
+	return name, desc, nulls, nil
+}
+
+func sortTerm(dialect Dialect, column string, desc bool, nulls string) []string {
+	quoted := dialect.Quote(column)
+
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+
+	if nulls == "" {
+		return []string{quoted + direction}
+	}
+
+	// MySQL has no NULLS FIRST/LAST; order by the null test first instead.
+	if dialect == DialectMySQL {
+		nullOrder := " DESC"
+		if nulls == "LAST" {
+			nullOrder = " ASC"
+		}
+		return []string{quoted + " IS NULL" + nullOrder, quoted + direction}
+	}
+
+	return []string{quoted + direction + " NULLS " + nulls}
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOrderSorter() *Sorter {
+	return NewSorter(map[string]string{
+		"created_at": "created_at",
+		"customer":   "customer_name",
+		"id":         "id",
+	}, "id")
+}
+
+func TestShouldCompileSortWithTiebreaker(t *testing.T) {
+	clause, err := newOrderSorter().OrderBy(DialectPostgres, "-created_at:nulls_last, customer")
+
+	assert.Nil(t, err)
+	assert.Equal(t, `ORDER BY "created_at" DESC NULLS LAST, "customer_name" ASC, "id" ASC`, clause)
+}
+
+func TestShouldNotRepeatTiebreakerAlreadyRequested(t *testing.T) {
+	clause, err := newOrderSorter().OrderBy(DialectPostgres, "-id")
+
+	assert.Nil(t, err)
+	assert.Equal(t, `ORDER BY "id" DESC`, clause)
+
+	clause, _ = newOrderSorter().OrderBy(DialectPostgres, "")
+	assert.Equal(t, `ORDER BY "id" ASC`, clause)
+}
+
+func TestShouldEmulateNullsOrderingOnMySQL(t *testing.T) {
+	clause, err := newOrderSorter().OrderBy(DialectMySQL, "created_at:nulls_first")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "ORDER BY `created_at` IS NULL DESC, `created_at` ASC, `id` ASC", clause)
+}
+
+func TestShouldRejectUnknownOrRepeatedSortFields(t *testing.T) {
+	sorter := newOrderSorter()
+
+	for _, spec := range []string{"password", "id,-id", "created_at:sideways", `created_at"; drop table x`} {
+		_, err := sorter.OrderBy(DialectPostgres, spec)
+		assert.True(t, errors.Is(err, ErrInvalidSort), spec)
+	}
+}
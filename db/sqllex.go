@@ -0,0 +1,330 @@
+package db
+
+import (
+	"strings"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlWord sqlTokenKind = iota
+	sqlQuotedIdent
+	sqlString
+	sqlNumber
+	sqlPlaceholder
+	sqlPunct
+)
+
+// sqlToken is a lexical token of a statement; start and end are byte offsets
+// into the source so tokens can be used to splice the original text.
+type sqlToken struct {
+	kind  sqlTokenKind
+	text  string
+	start int
+	end   int
+}
+
+func (t sqlToken) is(keyword string) bool {
+	return t.kind == sqlWord && strings.EqualFold(t.text, keyword)
+}
+
+// lexSQL splits query into tokens using standard SQL string rules.
+func lexSQL(query string) []sqlToken {
+	return lexSQLFor(DialectANSI, query)
+}
+
+// lexSQLFor splits query into tokens, dropping whitespace and comments. It
+// knows enough of the Postgres, MySQL and SQLite lexical rules (quoted
+// identifiers, escaped and dollar-quoted strings, casts, bindvars) to never
+// mistake string contents for code; it is not a validating parser.
+func lexSQLFor(dialect Dialect, query string) []sqlToken {
+	var tokens []sqlToken
+	backslashes := dialect == DialectMySQL
+
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		start := i
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case c == '-' && strings.HasPrefix(query[i:], "--"), c == '#' && dialect == DialectMySQL:
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+			continue
+		case c == '\'':
+			i = skipQuoted(query, i, '\'', backslashes)
+			tokens = append(tokens, sqlToken{sqlString, query[start:i], start, i})
+		case (c == 'E' || c == 'e') && i+1 < len(query) && query[i+1] == '\'':
+			i = skipQuoted(query, i+1, '\'', true)
+			tokens = append(tokens, sqlToken{sqlString, query[start:i], start, i})
+		case c == '"' || c == '`':
+			i = skipQuoted(query, i, c, false)
+			tokens = append(tokens, sqlToken{sqlQuotedIdent, query[start:i], start, i})
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			i++
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlPlaceholder, query[start:i], start, i})
+		case c == '$':
+			if tag, ok := dollarTag(query[i:]); ok {
+				if end := strings.Index(query[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag)
+				} else {
+					i = len(query)
+				}
+				tokens = append(tokens, sqlToken{sqlString, query[start:i], start, i})
+			} else {
+				i++
+				tokens = append(tokens, sqlToken{sqlPunct, "$", start, i})
+			}
+		case c == '?':
+			i++
+			tokens = append(tokens, sqlToken{sqlPlaceholder, "?", start, i})
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			i += 2
+			tokens = append(tokens, sqlToken{sqlPunct, "::", start, i})
+		case (c == ':' || c == '@') && i+1 < len(query) && isWordStart(query[i+1]):
+			i++
+			for i < len(query) && isWordPart(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlPlaceholder, query[start:i], start, i})
+		case isDigit(c):
+			for i < len(query) && (isDigit(query[i]) || query[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlNumber, query[start:i], start, i})
+		case isWordStart(c):
+			for i < len(query) && isWordPart(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlWord, query[start:i], start, i})
+		default:
+			i++
+			if i < len(query) && isCompoundOperator(c, query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{sqlPunct, query[start:i], start, i})
+		}
+	}
+
+	return tokens
+}
+
+func skipQuoted(query string, i int, quote byte, backslashes bool) int {
+	i++
+	for i < len(query) {
+		switch query[i] {
+		case '\\':
+			if backslashes {
+				i += 2
+				continue
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return len(query)
+}
+
+// dollarTag returns the opening tag of a Postgres dollar-quoted string such as
+// $$ or $body$.
+func dollarTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		if s[i] == '$' {
+			return s[:i+1], true
+		}
+		if !isWordPart(s[i]) {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+func isCompoundOperator(a, b byte) bool {
+	switch string([]byte{a, b}) {
+	case "<=", ">=", "<>", "!=", "||":
+		return true
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || isDigit(c) || c == '$'
+}
+
+// statementVerb returns the upper-cased leading keyword of query, looking
+// past a WITH clause to the statement it introduces.
+func statementVerb(tokens []sqlToken) string {
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	if !tokens[0].is("with") {
+		return strings.ToUpper(tokens[0].text)
+	}
+
+	depth := 0
+	for _, t := range tokens[1:] {
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+		case depth == 0 && t.kind == sqlWord:
+			switch strings.ToUpper(t.text) {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE":
+				return strings.ToUpper(t.text)
+			}
+		}
+	}
+
+	return "WITH"
+}
+
+// splitTokens splits the tokens of a script into those of its statements,
+// on top-level semicolons, leaving out empty statements.
+func splitTokens(tokens []sqlToken) [][]sqlToken {
+	var statements [][]sqlToken
+	start := 0
+	for i, t := range tokens {
+		if t.kind == sqlPunct && t.text == ";" {
+			if i > start {
+				statements = append(statements, tokens[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
+
+// normalizeName strips identifier quotes and lower-cases unquoted names.
+func normalizeName(t sqlToken) string {
+	if t.kind == sqlQuotedIdent {
+		return t.text[1 : len(t.text)-1]
+	}
+	return strings.ToLower(t.text)
+}
+
+// tableRef is a table referenced by a statement.
+type tableRef struct {
+	name string
+	// alias as written, quotes included
+	alias string
+	// index of the token holding the (last part of the) table name
+	pos int
+}
+
+// referencedTables finds the tables named after FROM, JOIN, UPDATE, INTO and
+// USING, including comma separated FROM lists. Schema-qualified names are
+// returned qualified, as written.
+func referencedTables(tokens []sqlToken) []tableRef {
+	var refs []tableRef
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if !(t.is("from") || t.is("join") || t.is("update") || t.is("into") || t.is("using")) {
+			continue
+		}
+		if t.is("update") && i > 0 && isUpdateModifier(tokens[i-1]) {
+			continue
+		}
+
+		for j := i + 1; j < len(tokens); {
+			ref, next, ok := readTableName(tokens, j)
+			if !ok {
+				break
+			}
+			refs = append(refs, ref)
+			j = next
+
+			if !t.is("from") || j >= len(tokens) || tokens[j].text != "," {
+				break
+			}
+			j++
+		}
+	}
+
+	return refs
+}
+
+// isUpdateModifier reports the keywords turning a following UPDATE into a
+// row lock (FOR UPDATE, FOR NO KEY UPDATE), an upsert (DO UPDATE, ON
+// DUPLICATE KEY UPDATE) or a referential action (ON UPDATE).
+func isUpdateModifier(t sqlToken) bool {
+	return t.is("for") || t.is("key") || t.is("do") || t.is("on")
+}
+
+func readTableName(tokens []sqlToken, i int) (tableRef, int, bool) {
+	if i >= len(tokens) || !isIdentifier(tokens[i]) || isReserved(tokens[i]) {
+		return tableRef{}, i, false
+	}
+
+	name := normalizeName(tokens[i])
+	pos := i
+	i++
+	for i+1 < len(tokens) && tokens[i].text == "." && isIdentifier(tokens[i+1]) {
+		name += "." + normalizeName(tokens[i+1])
+		pos = i + 1
+		i += 2
+	}
+
+	ref := tableRef{name: name, pos: pos}
+
+	if i < len(tokens) && tokens[i].is("as") {
+		i++
+	}
+	if i < len(tokens) && isIdentifier(tokens[i]) && !isReserved(tokens[i]) {
+		ref.alias = tokens[i].text
+		i++
+	}
+
+	return ref, i, true
+}
+
+func isIdentifier(t sqlToken) bool {
+	return t.kind == sqlWord || t.kind == sqlQuotedIdent
+}
+
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "JOIN": true, "INNER": true,
+	"LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true, "CROSS": true,
+	"ON": true, "USING": true, "GROUP": true, "ORDER": true, "BY": true,
+	"HAVING": true, "LIMIT": true, "OFFSET": true, "FETCH": true, "FOR": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "SET": true,
+	"VALUES": true, "RETURNING": true, "WINDOW": true, "NATURAL": true,
+	"LATERAL": true, "AND": true, "OR": true, "NOT": true, "AS": true,
+	"ONLY": true, "DEFAULT": true, "LOCK": true,
+}
+
+func isReserved(t sqlToken) bool {
+	return t.kind == sqlWord && reservedWords[strings.ToUpper(t.text)]
+}
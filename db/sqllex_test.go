@@ -0,0 +1,44 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenTexts(tokens []sqlToken) []string {
+	texts := make([]string, len(tokens))
+	for i, t := range tokens {
+		texts[i] = t.text
+	}
+	return texts
+}
+
+func TestShouldLexStringsCommentsAndPlaceholders(t *testing.T) {
+	tokens := lexSQL("SELECT 'it''s -- not a comment', x::int FROM t -- trailing\nWHERE a = ? /* block */ AND b = $1 AND c = :name")
+
+	assert.Equal(t, []string{
+		"SELECT", "'it''s -- not a comment'", ",", "x", "::", "int", "FROM", "t",
+		"WHERE", "a", "=", "?", "AND", "b", "=", "$1", "AND", "c", "=", ":name",
+	}, tokenTexts(tokens))
+	assert.Equal(t, sqlPlaceholder, tokens[11].kind)
+}
+
+func TestShouldLexDollarQuotedAndEscapedStrings(t *testing.T) {
+	tokens := lexSQLFor(DialectPostgres, `SELECT $fn$ SELECT 'x'; $fn$, E'a\'b', 'c:\' FROM t`)
+	assert.Equal(t, []string{"SELECT", "$fn$ SELECT 'x'; $fn$", ",", `E'a\'b'`, ",", `'c:\'`, "FROM", "t"}, tokenTexts(tokens))
+
+	tokens = lexSQLFor(DialectMySQL, `SELECT 'a\'b' # comment`)
+	assert.Equal(t, []string{"SELECT", `'a\'b'`}, tokenTexts(tokens))
+}
+
+func TestShouldFindReferencedTablesAndVerb(t *testing.T) {
+	tokens := lexSQL(`WITH x AS (SELECT 1) DELETE FROM public.orders AS o USING "Items" i`)
+	refs := referencedTables(tokens)
+
+	assert.Equal(t, "DELETE", statementVerb(tokens))
+	assert.Len(t, refs, 2)
+	assert.Equal(t, "public.orders", refs[0].name)
+	assert.Equal(t, "o", refs[0].alias)
+	assert.Equal(t, "Items", refs[1].name)
+}
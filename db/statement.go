@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StatementKind tells how a statement is executed and where its results go.
+type StatementKind int
+
+const (
+	// KindQuery returns rows in Statement.Rows.
+	KindQuery StatementKind = iota
+	// KindExec stores the outcome in Statement.Result.
+	KindExec
+	// KindGet scans a single row into Statement.Dest.
+	KindGet
+	// KindSelect scans every row into the slice pointed to by Statement.Dest.
+	KindSelect
+)
+
+// Statement is a single SQL statement on its way to the database. Named
+// queries are already bound, so Query always carries the driver's positional
+// placeholders matching Args. Label is the label of the context the statement
+// runs with, see WithLabel.
+type Statement struct {
+	Kind   StatementKind
+	Query  string
+	Args   []interface{}
+	Driver string
+	InTx   bool
+	Label  string
+
+	// Replica is set on reads routed to a replica, see WithReplicas.
+	// Interceptors may clear it to run the statement on the primary.
+	Replica bool
+
+	Dest   interface{}
+	Rows   *sqlx.Rows
+	Result sql.Result
+
+	// replica is the replica the statement ran on, if any.
+	replica sqlx.ExtContext
+}
+
+// Handler executes a statement.
+type Handler func(ctx context.Context, stmt *Statement) error
+
+// Interceptor wraps statement execution. It may inspect or rewrite stmt, run
+// code around next, or short-circuit by returning without calling it.
+type Interceptor func(ctx context.Context, stmt *Statement, next Handler) error
+
+// chain composes interceptors around final, the first interceptor being the
+// outermost.
+func chain(interceptors []Interceptor, final Handler) Handler {
+	h := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, stmt *Statement) error {
+			return interceptor(ctx, stmt, next)
+		}
+	}
+	return h
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// StatsSummary sums up the database work of a request.
+type StatsSummary struct {
+	Queries     int64
+	Time        time.Duration
+	RowsRead    int64
+	RowsWritten int64
+	CacheHits   int64
+}
+
+// String formats the summary as a log field or header value, e.g.
+// "queries=3 db_time=4.2ms rows_read=12 rows_written=1 cache_hits=2".
+func (s StatsSummary) String() string {
+	return fmt.Sprintf("queries=%d db_time=%s rows_read=%d rows_written=%d cache_hits=%d",
+		s.Queries, s.Time, s.RowsRead, s.RowsWritten, s.CacheHits)
+}
+
+// Stats accumulates the database work done with a context returned by
+// WithStats, across unit of works and goroutines.
+type Stats struct {
+	queries     int64
+	nanos       int64
+	rowsRead    int64
+	rowsWritten int64
+	cacheHits   int64
+
+	// overBudget is set once a budget exceeded was reported.
+	overBudget int32
+}
+
+type statsKey struct{}
+
+// WithStats returns a context counting the statements run with it, and the
+// entity cache hits of repositories, into the returned Stats. A context
+// already counting keeps its Stats.
+func WithStats(ctx context.Context) (context.Context, *Stats) {
+	if s := StatsFrom(ctx); s != nil {
+		return ctx, s
+	}
+	s := &Stats{}
+	return context.WithValue(ctx, statsKey{}, s), s
+}
+
+// StatsFrom returns the Stats of ctx, or nil when it does not count.
+func StatsFrom(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// Summary returns the work counted so far. It is nil-safe.
+func (s *Stats) Summary() StatsSummary {
+	if s == nil {
+		return StatsSummary{}
+	}
+	return StatsSummary{
+		Queries:     atomic.LoadInt64(&s.queries),
+		Time:        time.Duration(atomic.LoadInt64(&s.nanos)),
+		RowsRead:    atomic.LoadInt64(&s.rowsRead),
+		RowsWritten: atomic.LoadInt64(&s.rowsWritten),
+		CacheHits:   atomic.LoadInt64(&s.cacheHits),
+	}
+}
+
+// record counts stmt, which took d.
+func (s *Stats) record(stmt *Statement, d time.Duration, err error) {
+	atomic.AddInt64(&s.queries, 1)
+	atomic.AddInt64(&s.nanos, int64(d))
+	if err != nil {
+		return
+	}
+
+	read, written := rowsOf(stmt)
+	atomic.AddInt64(&s.rowsRead, read)
+	atomic.AddInt64(&s.rowsWritten, written)
+}
+
+// rowsOf returns the rows stmt read and wrote once it succeeded. Rows read
+// are known for Get and Select; those of Query are read by the caller and not
+// counted.
+func rowsOf(stmt *Statement) (read, written int64) {
+	switch stmt.Kind {
+	case KindGet:
+		return 1, 0
+	case KindSelect:
+		if v := reflect.Indirect(reflect.ValueOf(stmt.Dest)); v.Kind() == reflect.Slice {
+			return int64(v.Len()), 0
+		}
+	case KindExec:
+		if stmt.Result != nil {
+			if n, err := stmt.Result.RowsAffected(); err == nil {
+				return 0, n
+			}
+		}
+	}
+	return 0, 0
+}
+
+func (s *Stats) cacheHit() {
+	if s != nil {
+		atomic.AddInt64(&s.cacheHits, 1)
+	}
+}
+
+// StatsMiddleware counts the database work of every request and reports it
+// in header, e.g. "X-DB-Stats", just before the response is written. Handlers
+// get the Stats with StatsFrom(r.Context()), e.g. to log them or enforce a
+// budget.
+func StatsMiddleware(header string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, stats := WithStats(r.Context())
+		next.ServeHTTP(&statsWriter{ResponseWriter: w, header: header, stats: stats}, r.WithContext(ctx))
+	})
+}
+
+type statsWriter struct {
+	http.ResponseWriter
+	header  string
+	stats   *Stats
+	written bool
+}
+
+func (w *statsWriter) WriteHeader(status int) {
+	if !w.written {
+		w.written = true
+		w.Header().Set(w.header, w.stats.Summary().String())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statsWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush passes flushes through to the wrapped writer, for handlers streaming
+// their response.
+func (w *statsWriter) Flush() {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the wrapped writer, e.g. to hijack
+// the connection or set deadlines.
+func (w *statsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
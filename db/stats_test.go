@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSummarizeWorkOfContext(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectQuery("^SELECT id, status FROM orders WHERE id = \\?$").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(7, "open"))
+	mock.ExpectQuery("^SELECT id FROM orders$").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	ctx, stats := WithStats(context.Background())
+	uow := NewUnitOfWork(database, nil, WithContext(ctx))
+	repo, _ := NewRepository[repositoryOrder](WithEntityCache(time.Minute, 0))
+
+	repo.Find(uow, 7)
+	repo.Find(uow, 7)
+	var ids []int64
+	uow.Select(&ids, "SELECT id FROM orders")
+	uow.MustExec("UPDATE orders SET status = 'paid'")
+
+	summary := stats.Summary()
+	assert.Equal(t, int64(3), summary.Queries)
+	assert.Equal(t, int64(2), summary.RowsRead)
+	assert.Equal(t, int64(2), summary.RowsWritten)
+	assert.Equal(t, int64(1), summary.CacheHits)
+	assert.True(t, summary.Time > 0)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReportStatsInResponseHeader(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^DELETE FROM sessions$").WillReturnResult(sqlmock.NewResult(0, 4))
+
+	handler := StatsMiddleware("X-DB-Stats", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		NewUnitOfWork(database, nil, WithContext(r.Context())).MustExec("DELETE FROM sessions")
+		w.Write([]byte("ok"))
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/logout", nil))
+
+	assert.Regexp(t, `^queries=1 db_time=\S+ rows_read=0 rows_written=4 cache_hits=0$`, recorder.Header().Get("X-DB-Stats"))
+}
+
+func TestShouldPassFlushesThroughTheStatsWriter(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := StatsMiddleware("X-DB-Stats", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		assert.Equal(t, http.ResponseWriter(recorder), w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+	}))
+
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/events", nil))
+
+	assert.True(t, recorder.Flushed)
+	assert.NotEmpty(t, recorder.Header().Get("X-DB-Stats"))
+}
+
+func TestShouldNotCountWithoutStats(t *testing.T) {
+	assert.Nil(t, StatsFrom(context.Background()))
+	assert.Equal(t, StatsSummary{}, StatsFrom(context.Background()).Summary())
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StatementCacheConfig configures a StatementCache.
+type StatementCacheConfig struct {
+	// Size is the number of prepared statements kept. Zero means 200.
+	Size int
+}
+
+// StatementCacheStats counts the lookups of a StatementCache.
+type StatementCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+// StatementCache keeps the most recently used statements of a database
+// prepared, keyed by query text, so that hot statements are parsed and
+// planned once rather than on every call. Install it with
+// WithStatementCache; it is meant to be shared by every unit of work over
+// the database and is safe for concurrent use.
+type StatementCache struct {
+	db   *sqlx.DB
+	size int
+
+	mu      sync.Mutex
+	lru     *list.List // of *cachedStatement, most recently used first
+	entries map[string]*list.Element
+	stats   StatementCacheStats
+}
+
+// cachedStatement is a prepared statement, or a nil stmt for queries the
+// driver refused to prepare, which then keep running unprepared. refs counts
+// the statements running with it; once evicted, it is closed when the last
+// one is done. Guarded by the mutex of the cache.
+type cachedStatement struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+// NewStatementCache creates a cache of statements prepared on db.
+func NewStatementCache(db *sqlx.DB, config StatementCacheConfig) *StatementCache {
+	if config.Size <= 0 {
+		config.Size = 200
+	}
+
+	return &StatementCache{db: db, size: config.Size, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// WithStatementCache runs the statements of the unit of work through cache,
+// transactions included, with the prepared statements rebound to the
+// transaction. Reads routed to replicas, unit of works over another database
+// and databases in proxy compatibility mode are left alone.
+func WithStatementCache(cache *StatementCache) Option {
+	return func(u *unitOfWork) {
+		u.stmtCache = cache
+	}
+}
+
+// Stats returns the counters of the cache.
+func (c *StatementCache) Stats() StatementCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
+
+// Close closes every cached statement, those still running once they are
+// done. The cache stays usable and prepares statements again.
+func (c *StatementCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var first error
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		if err := c.evict(e.Value.(*cachedStatement)); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	return first
+}
+
+// acquire returns the entry of query, preparing it on a miss, with a
+// reference the caller gives back with release. It returns nil when the
+// query could not be prepared this time.
+func (c *StatementCache) acquire(ctx context.Context, query string) *cachedStatement {
+	c.mu.Lock()
+	if e, ok := c.entries[query]; ok {
+		c.lru.MoveToFront(e)
+		c.stats.Hits++
+		entry := e.Value.(*cachedStatement)
+		entry.refs++
+		c.mu.Unlock()
+		return entry
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// prepared outside the lock, a round trip must not block other lookups
+	stmt, err := c.db.PreparexContext(ctx, query)
+	if err != nil && (ctx.Err() != nil || transientPrepareError(err)) {
+		// cancelled or cut off rather than refused, try again next time
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[query]; ok {
+		// prepared concurrently, keep the first
+		if stmt != nil {
+			stmt.Close()
+		}
+		c.lru.MoveToFront(e)
+		entry := e.Value.(*cachedStatement)
+		entry.refs++
+		return entry
+	}
+
+	entry := &cachedStatement{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		evicted := c.lru.Remove(c.lru.Back()).(*cachedStatement)
+		delete(c.entries, evicted.query)
+		c.stats.Evictions++
+		c.evict(evicted)
+	}
+	return entry
+}
+
+// release gives back a reference acquire returned.
+func (c *StatementCache) release(entry *cachedStatement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refs--
+	if entry.evicted && entry.refs == 0 && entry.stmt != nil {
+		entry.stmt.Close()
+	}
+}
+
+// evict marks entry evicted, closing its statement unless it is running.
+// Statements still in use by open rows are only released by database/sql
+// once the rows are closed.
+func (c *StatementCache) evict(entry *cachedStatement) error {
+	entry.evicted = true
+	if entry.refs > 0 || entry.stmt == nil {
+		return nil
+	}
+	return entry.stmt.Close()
+}
+
+// transientPrepareError reports whether err is a failure of the connection
+// rather than a refusal of the statement, which is not remembered.
+func transientPrepareError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// executePrepared runs stmt with a cached prepared statement, handled being
+// false when it has to run unprepared.
+func (u *unitOfWork) executePrepared(ctx context.Context, stmt *Statement) (handled bool, err error) {
+	cache := u.stmtCache
+	if cache == nil || stmt.Replica || cache.db != u.db || ProxyCompatible(u.db) {
+		return false, nil
+	}
+
+	entry := cache.acquire(ctx, stmt.Query)
+	if entry == nil {
+		return false, nil
+	}
+	defer cache.release(entry)
+	if entry.stmt == nil {
+		return false, nil
+	}
+
+	prepared := entry.stmt
+	if tx := u.currentTx(); tx != nil {
+		prepared = tx.StmtxContext(ctx, prepared)
+		// the transaction statement is released with the rows of a query
+		defer prepared.Close()
+	}
+
+	switch stmt.Kind {
+	case KindQuery:
+		stmt.Rows, err = prepared.QueryxContext(ctx, stmt.Args...)
+	case KindExec:
+		stmt.Result, err = prepared.ExecContext(ctx, stmt.Args...)
+	case KindGet:
+		err = prepared.GetContext(ctx, stmt.Dest, stmt.Args...)
+	case KindSelect:
+		err = prepared.SelectContext(ctx, stmt.Dest, stmt.Args...)
+	default:
+		return false, nil
+	}
+	return true, err
+}
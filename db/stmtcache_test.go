@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldReusePreparedStatements(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	prepared := mock.ExpectPrepare(`^SELECT id, status FROM orders WHERE status = \?$`)
+	prepared.ExpectQuery().WithArgs("open").WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+	prepared.ExpectQuery().WithArgs("paid").WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(2, "paid"))
+
+	cache := NewStatementCache(database, StatementCacheConfig{})
+	var open, paid []repositoryOrder
+	assert.Nil(t, NewUnitOfWork(database, nil, WithStatementCache(cache)).Select(&open, "SELECT id, status FROM orders WHERE status = ?", "open"))
+	assert.Nil(t, NewUnitOfWork(database, nil, WithStatementCache(cache)).Select(&paid, "SELECT id, status FROM orders WHERE status = ?", "paid"))
+
+	assert.Equal(t, []repositoryOrder{{ID: 1, Status: "open"}}, open)
+	assert.Equal(t, []repositoryOrder{{ID: 2, Status: "paid"}}, paid)
+	assert.Equal(t, StatementCacheStats{Hits: 1, Misses: 1, Size: 1}, cache.Stats())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldEvictTheLeastRecentlyUsedStatement(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	first := mock.ExpectPrepare(`^DELETE FROM orders WHERE id = \?$`)
+	first.ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	first.WillBeClosed()
+	second := mock.ExpectPrepare(`^DELETE FROM items WHERE id = \?$`)
+	second.ExpectExec().WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	cache := NewStatementCache(database, StatementCacheConfig{Size: 1})
+	uow := NewUnitOfWork(database, nil, WithStatementCache(cache))
+	uow.MustExec("DELETE FROM orders WHERE id = ?", 1)
+	uow.MustExec("DELETE FROM items WHERE id = ?", 2)
+
+	assert.Equal(t, StatementCacheStats{Misses: 2, Evictions: 1, Size: 1}, cache.Stats())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRunCachedStatementsInTransactions(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectBegin()
+	// prepared on the pool, then on the connection of the transaction once
+	mock.ExpectPrepare(`^UPDATE orders SET status = \? WHERE id = \?$`)
+	prepared := mock.ExpectPrepare(`^UPDATE orders SET status = \? WHERE id = \?$`)
+	prepared.ExpectExec().WithArgs("paid", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.ExpectExec().WithArgs("paid", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	cache := NewStatementCache(database, StatementCacheConfig{})
+	_, err := NewUnitOfWork(database, nil, WithStatementCache(cache)).InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		tx.MustExec("UPDATE orders SET status = ? WHERE id = ?", "paid", 1)
+		tx.MustExec("UPDATE orders SET status = ? WHERE id = ?", "paid", 2)
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), cache.Stats().Hits)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRunStatementsThatCannotBePreparedUnprepared(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectPrepare(`^SET search_path TO app$`).WillReturnError(errors.New("cannot prepare"))
+	mock.ExpectExec(`^SET search_path TO app$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`^SET search_path TO app$`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	cache := NewStatementCache(database, StatementCacheConfig{})
+	uow := NewUnitOfWork(database, nil, WithStatementCache(cache))
+	uow.MustExec("SET search_path TO app")
+	uow.MustExec("SET search_path TO app")
+
+	assert.Equal(t, StatementCacheStats{Hits: 1, Misses: 1, Size: 1}, cache.Stats())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldLeaveOtherDatabasesAlone(t *testing.T) {
+	database, _ := newMockDatabase(t, "sqlmock")
+	other, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec(`^DELETE FROM orders$`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	cache := NewStatementCache(database, StatementCacheConfig{})
+	NewUnitOfWork(other, nil, WithStatementCache(cache)).MustExec("DELETE FROM orders")
+
+	assert.Equal(t, StatementCacheStats{}, cache.Stats())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldCloseStatementsEvictedWhileRunningOnceTheyAreDone(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	prepared := mock.ExpectPrepare(`^DELETE FROM orders WHERE id = \?$`)
+	prepared.ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared.WillBeClosed()
+
+	cache := NewStatementCache(database, StatementCacheConfig{})
+	entry := cache.acquire(context.Background(), "DELETE FROM orders WHERE id = ?")
+	assert.Nil(t, cache.Close())
+
+	_, err := entry.stmt.Exec(1)
+	assert.Nil(t, err)
+	cache.release(entry)
+
+	assert.Equal(t, 0, cache.Stats().Size)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldPrepareAgainAfterTheConnectionFailed(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectPrepare(`^DELETE FROM orders WHERE id = \?$`).WillReturnError(&net.OpError{Op: "read", Err: errors.New("connection reset by peer")})
+	mock.ExpectExec(`^DELETE FROM orders WHERE id = \?$`).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	prepared := mock.ExpectPrepare(`^DELETE FROM orders WHERE id = \?$`)
+	prepared.ExpectExec().WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	cache := NewStatementCache(database, StatementCacheConfig{})
+	uow := NewUnitOfWork(database, nil, WithStatementCache(cache))
+	uow.MustExec("DELETE FROM orders WHERE id = ?", 1)
+	uow.MustExec("DELETE FROM orders WHERE id = ?", 2)
+
+	assert.Equal(t, StatementCacheStats{Misses: 2, Size: 1}, cache.Stats())
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"iter"
+)
+
+// SelectStream runs query with ctx and yields its rows one by one, scanned
+// into a T, a struct mapped with db tags or a scalar, instead of loading them
+// all like All. The rows are closed when the loop ends, whether they ran out,
+// the loop broke early or ctx was cancelled. A failing query, scan or
+// context ends the sequence with a zero T and the error.
+func SelectStream[T any](ctx context.Context, uow UnitOfWork, query string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		rows, err := uow.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			var row T
+			if err := scanRow(rows, &row); err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+			return
+		}
+		if err := rows.Close(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// EachRow calls fn with every row of query as SelectStream yields them. It
+// stops at the first error of the query, the scan, ctx or fn and returns it;
+// the rows are closed in every case.
+func EachRow[T any](ctx context.Context, uow UnitOfWork, fn func(T) error, query string, args ...interface{}) error {
+	for row, err := range SelectStream[T](ctx, uow, query, args...) {
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldStreamRowsIntoStructs(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id, status FROM orders WHERE status = \?$`).
+		WithArgs("open").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open").AddRow(2, "open")).
+		RowsWillBeClosed()
+
+	var orders []repositoryOrder
+	for order, err := range SelectStream[repositoryOrder](context.Background(), uow, "SELECT id, status FROM orders WHERE status = ?", "open") {
+		assert.Nil(t, err)
+		orders = append(orders, order)
+	}
+
+	assert.Equal(t, []repositoryOrder{{ID: 1, Status: "open"}, {ID: 2, Status: "open"}}, orders)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldCloseRowsWhenTheLoopBreaks(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3)).
+		RowsWillBeClosed()
+
+	var ids []int64
+	for id, err := range SelectStream[int64](context.Background(), uow, "SELECT id FROM orders") {
+		assert.Nil(t, err)
+		ids = append(ids, id)
+		if len(ids) == 2 {
+			break
+		}
+	}
+
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldEndTheStreamWhenTheContextIsCancelled(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3)).
+		RowsWillBeClosed()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ids []int64
+	err := EachRow(ctx, uow, func(id int64) error {
+		ids = append(ids, id)
+		cancel()
+		return nil
+	}, "SELECT id FROM orders")
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []int64{1}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReturnTheErrorsOfEachRow(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id FROM orders$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2)).
+		RowsWillBeClosed()
+	stop := errors.New("stop")
+
+	err := EachRow(context.Background(), uow, func(id int64) error {
+		return stop
+	}, "SELECT id FROM orders")
+
+	assert.Equal(t, stop, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldYieldQueryAndRowErrors(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT id FROM orders$`).WillReturnError(errors.New("boom"))
+	mock.ExpectQuery(`^SELECT id FROM customers$`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).RowError(1, errors.New("lost connection"))).
+		RowsWillBeClosed()
+
+	err := EachRow(context.Background(), uow, func(int64) error { return nil }, "SELECT id FROM orders")
+	assert.EqualError(t, err, "boom")
+
+	var ids []int64
+	err = EachRow(context.Background(), uow, func(id int64) error {
+		ids = append(ids, id)
+		return nil
+	}, "SELECT id FROM customers")
+	assert.EqualError(t, err, "lost connection")
+	assert.Equal(t, []int64{1}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
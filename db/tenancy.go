@@ -0,0 +1,393 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrTenantMissing is returned when a statement touches a tenant table but
+	// the context carries no tenant.
+	ErrTenantMissing = errors.New("db: no tenant in context")
+
+	// ErrTenantPredicate is returned when the tenancy interceptor cannot scope
+	// a statement to the current tenant and therefore refuses to run it.
+	ErrTenantPredicate = errors.New("db: cannot prove tenant predicate")
+)
+
+type tenantKey struct{}
+
+type tenancyBypassKey struct{}
+
+// WithTenant returns a context scoping statements to tenantID.
+func WithTenant(ctx context.Context, tenantID interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFrom returns the tenant stored by WithTenant.
+func TenantFrom(ctx context.Context) (interface{}, bool) {
+	tenant := ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+// WithoutTenancy marks ctx as trusted, letting statements through the tenancy
+// interceptor untouched. It is meant for migrations and cross-tenant jobs.
+func WithoutTenancy(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenancyBypassKey{}, true)
+}
+
+// TenancyConfig lists the tables partitioned by tenant and the column holding
+// the tenant.
+type TenancyConfig struct {
+	Column string
+	Tables []string
+}
+
+// TenancyInterceptor scopes every statement touching a configured table to
+// the tenant found in the context. Single-table SELECT, UPDATE and DELETE
+// statements get a "column = ?" predicate added to their WHERE clause; INSERT
+// statements must bind the tenant column to the current tenant in every
+// VALUES row, followed by nothing but RETURNING. UPDATE statements assigning
+// the tenant column, upserts and anything else touching a tenant table fail
+// closed with ErrTenantPredicate, since they could move rows to another
+// tenant.
+func TenancyInterceptor(config TenancyConfig) Interceptor {
+	tables := map[string]bool{}
+	for _, t := range config.Tables {
+		tables[strings.ToLower(t)] = true
+	}
+
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		if bypass, _ := ctx.Value(tenancyBypassKey{}).(bool); bypass {
+			return next(ctx, stmt)
+		}
+
+		tenant, ok := TenantFrom(ctx)
+		if err := scopeToTenant(stmt, config.Column, tables, tenant, ok); err != nil {
+			return err
+		}
+
+		return next(ctx, stmt)
+	}
+}
+
+func scopeToTenant(stmt *Statement, column string, tables map[string]bool, tenant interface{}, hasTenant bool) error {
+	tokens := lexSQLFor(DialectFor(stmt.Driver), stmt.Query)
+	mentions := tenantMentions(tokens, tables)
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	if len(splitTokens(tokens)) > 1 {
+		return fmt.Errorf("%w: %s in a multi-statement string", ErrTenantPredicate, mentions[0])
+	}
+
+	refs := referencedTables(tokens)
+	if len(refs) != 1 || !isTenantTable(tables, refs[0].name) || len(mentions) != 1 || hasNestedQuery(tokens) {
+		return fmt.Errorf("%w: cannot scope %s statement on %s", ErrTenantPredicate, statementVerb(tokens), mentions[0])
+	}
+
+	if !hasTenant {
+		return ErrTenantMissing
+	}
+
+	switch statementVerb(tokens) {
+	case "SELECT", "UPDATE", "DELETE":
+		if tokens[0].is("with") || assignsColumn(tokens, column) {
+			break
+		}
+		injectTenantPredicate(stmt, tokens, refs[0], column, tenant)
+		return nil
+	case "INSERT":
+		if insertBindsTenant(stmt, tokens, refs[0], column, tenant) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w on %s", ErrTenantPredicate, refs[0].name)
+}
+
+func isTenantTable(tables map[string]bool, name string) bool {
+	if tables[name] {
+		return true
+	}
+
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return tables[name[i+1:]]
+	}
+
+	return false
+}
+
+// tenantMentions returns the tenant tables named anywhere in tokens, once per
+// mention, whatever the clause: FROM ONLY, parenthesized and function FROM
+// items, TABLE, CALL arguments and the like all count, so that a statement
+// the rewrite does not understand is refused rather than run unscoped.
+// Qualifiers, such as the schema of a schema-qualified name, are skipped.
+func tenantMentions(tokens []sqlToken, tables map[string]bool) []string {
+	var mentions []string
+	for i, t := range tokens {
+		if !isIdentifier(t) || !tables[normalizeName(t)] {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].text == "." {
+			continue
+		}
+		mentions = append(mentions, normalizeName(t))
+	}
+	return mentions
+}
+
+// hasNestedQuery reports subqueries and set operations, which the tenancy
+// rewrite does not attempt to scope.
+func hasNestedQuery(tokens []sqlToken) bool {
+	for i, t := range tokens {
+		if t.is("union") || t.is("intersect") || t.is("except") {
+			return true
+		}
+		if t.text == "(" && i+1 < len(tokens) && (tokens[i+1].is("select") || tokens[i+1].is("with")) {
+			return true
+		}
+	}
+	return false
+}
+
+var whereTerminators = map[string]bool{
+	"GROUP": true, "HAVING": true, "WINDOW": true, "ORDER": true, "LIMIT": true,
+	"OFFSET": true, "FETCH": true, "FOR": true, "RETURNING": true, ";": true,
+}
+
+func injectTenantPredicate(stmt *Statement, tokens []sqlToken, ref tableRef, column string, tenant interface{}) {
+	qualified := column
+	if ref.alias != "" {
+		qualified = ref.alias + "." + column
+	}
+
+	where, terminator, depth := -1, -1, 0
+	for i := ref.pos + 1; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+		if where < 0 && t.is("where") {
+			where = i
+			continue
+		}
+		if whereTerminators[strings.ToUpper(t.text)] {
+			terminator = i
+			break
+		}
+	}
+
+	query := stmt.Query
+	end := len(strings.TrimRight(query, " \t\r\n"))
+	separator := ""
+	if terminator >= 0 {
+		end = tokens[terminator].start
+		separator = " "
+	}
+
+	if where < 0 {
+		placeholder := bindTenantArg(stmt, tokens, end, tenant)
+		stmt.Query = strings.TrimRight(query[:end], " \t\r\n") +
+			" WHERE " + qualified + " = " + placeholder + separator + query[end:]
+		return
+	}
+
+	offset := tokens[where].end
+	placeholder := bindTenantArg(stmt, tokens, offset, tenant)
+	condition := strings.TrimSpace(query[offset:end])
+
+	stmt.Query = query[:offset] + " " + qualified + " = " + placeholder +
+		" AND (" + condition + ")" + separator + query[end:]
+}
+
+// bindTenantArg adds tenant to the statement arguments and returns the
+// placeholder referring to it when written at byte offset of the query.
+func bindTenantArg(stmt *Statement, tokens []sqlToken, offset int, tenant interface{}) string {
+	switch sqlx.BindType(stmt.Driver) {
+	case sqlx.DOLLAR:
+		stmt.Args = append(stmt.Args, tenant)
+		return "$" + strconv.Itoa(len(stmt.Args))
+	case sqlx.AT:
+		stmt.Args = append(stmt.Args, tenant)
+		return "@p" + strconv.Itoa(len(stmt.Args))
+	case sqlx.NAMED:
+		stmt.Args = append(stmt.Args, tenant)
+		return ":arg" + strconv.Itoa(len(stmt.Args))
+	}
+
+	position := 0
+	for _, t := range tokens {
+		if t.kind == sqlPlaceholder && t.start < offset {
+			position++
+		}
+	}
+
+	args := make([]interface{}, 0, len(stmt.Args)+1)
+	args = append(args, stmt.Args[:position]...)
+	args = append(args, tenant)
+	stmt.Args = append(args, stmt.Args[position:]...)
+
+	return "?"
+}
+
+// insertBindsTenant checks that every VALUES row of an INSERT binds column to
+// the current tenant.
+func insertBindsTenant(stmt *Statement, tokens []sqlToken, ref tableRef, column string, tenant interface{}) bool {
+	i := ref.pos + 1
+	if ref.alias != "" {
+		return false
+	}
+
+	columns, i := splitParenthesized(tokens, i)
+	if columns == nil {
+		return false
+	}
+
+	index := -1
+	for n, c := range columns {
+		if len(c) == 1 && isIdentifier(c[0]) && normalizeName(c[0]) == strings.ToLower(column) {
+			index = n
+		}
+	}
+
+	if index < 0 || i >= len(tokens) || !tokens[i].is("values") {
+		return false
+	}
+	i++
+
+	placeholders := placeholderOrdinals(tokens)
+	rows := 0
+
+	for i < len(tokens) {
+		values, next := splitParenthesized(tokens, i)
+		if len(values) != len(columns) {
+			return false
+		}
+
+		value := values[index]
+		if len(value) != 1 || value[0].kind != sqlPlaceholder {
+			return false
+		}
+
+		arg := placeholders[value[0].start]
+		if arg < 0 || arg >= len(stmt.Args) || fmt.Sprint(stmt.Args[arg]) != fmt.Sprint(tenant) {
+			return false
+		}
+
+		rows++
+		i = next
+		if i >= len(tokens) || tokens[i].text != "," {
+			break
+		}
+		i++
+	}
+
+	// ON CONFLICT, ON DUPLICATE KEY and the like may write the tenant column
+	// of an existing row
+	if i < len(tokens) && !tokens[i].is("returning") && tokens[i].text != ";" {
+		return false
+	}
+	return rows > 0
+}
+
+// assignsColumn reports whether the SET clause of an UPDATE names column,
+// on either side of an assignment.
+func assignsColumn(tokens []sqlToken, column string) bool {
+	set, depth := false, 0
+	for _, t := range tokens {
+		switch t.text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		if depth > 0 && !set {
+			continue
+		}
+		if depth == 0 && !set {
+			set = t.is("set")
+			continue
+		}
+		if depth == 0 && (t.is("where") || t.is("from") || whereTerminators[strings.ToUpper(t.text)]) {
+			return false
+		}
+		if isIdentifier(t) && normalizeName(t) == strings.ToLower(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitParenthesized reads a parenthesized, comma separated list starting at
+// tokens[i] and returns its elements and the index following the list.
+func splitParenthesized(tokens []sqlToken, i int) ([][]sqlToken, int) {
+	if i >= len(tokens) || tokens[i].text != "(" {
+		return nil, i
+	}
+
+	var items [][]sqlToken
+	var current []sqlToken
+	depth := 0
+
+	for i++; i < len(tokens); i++ {
+		t := tokens[i]
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")" && depth == 0:
+			return append(items, current), i + 1
+		case t.text == ")":
+			depth--
+		case t.text == "," && depth == 0:
+			items = append(items, current)
+			current = nil
+			continue
+		}
+		current = append(current, t)
+	}
+
+	return nil, i
+}
+
+// placeholderOrdinals maps the offset of every placeholder to the index of the
+// argument it binds.
+func placeholderOrdinals(tokens []sqlToken) map[int]int {
+	ordinals := map[int]int{}
+	sequence := 0
+
+	for _, t := range tokens {
+		if t.kind != sqlPlaceholder {
+			continue
+		}
+
+		switch {
+		case t.text == "?":
+			ordinals[t.start] = sequence
+			sequence++
+		case strings.HasPrefix(t.text, "$"):
+			n, _ := strconv.Atoi(t.text[1:])
+			ordinals[t.start] = n - 1
+		case strings.HasPrefix(t.text, "@p"):
+			n, _ := strconv.Atoi(t.text[2:])
+			ordinals[t.start] = n - 1
+		default:
+			ordinals[t.start] = sequence
+			sequence++
+		}
+	}
+
+	return ordinals
+}
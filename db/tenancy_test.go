@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func scopeQuery(driver, query string, args ...interface{}) (*Statement, error) {
+	stmt := &Statement{Query: query, Args: args, Driver: driver}
+	interceptor := TenancyInterceptor(TenancyConfig{Column: "tenant_id", Tables: []string{"orders"}})
+
+	err := interceptor(WithTenant(context.Background(), 42), stmt, func(context.Context, *Statement) error {
+		return nil
+	})
+
+	return stmt, err
+}
+
+func TestShouldAddTenantPredicateWithoutWhere(t *testing.T) {
+	stmt, err := scopeQuery("mysql", "SELECT id FROM orders o ORDER BY id LIMIT 10")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT id FROM orders o WHERE o.tenant_id = ? ORDER BY id LIMIT 10", stmt.Query)
+	assert.Equal(t, []interface{}{42}, stmt.Args)
+}
+
+func TestShouldAndTenantPredicateWithExistingWhere(t *testing.T) {
+	stmt, err := scopeQuery("mysql", "UPDATE orders SET status = ? WHERE id = ? OR id = ?", "paid", 1, 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE orders SET status = ? WHERE tenant_id = ? AND (id = ? OR id = ?)", stmt.Query)
+	assert.Equal(t, []interface{}{"paid", 42, 1, 2}, stmt.Args)
+}
+
+func TestShouldUseNextDollarPlaceholderOnPostgres(t *testing.T) {
+	stmt, err := scopeQuery("postgres", "DELETE FROM orders WHERE id = $1", 7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "DELETE FROM orders WHERE tenant_id = $2 AND (id = $1)", stmt.Query)
+	assert.Equal(t, []interface{}{7, 42}, stmt.Args)
+}
+
+func TestShouldAcceptInsertsBindingTheTenant(t *testing.T) {
+	_, err := scopeQuery("mysql", "INSERT INTO orders (id, tenant_id) VALUES (?, ?), (?, ?)", 1, 42, 2, 42)
+	assert.Nil(t, err)
+
+	_, err = scopeQuery("mysql", "INSERT INTO orders (id, tenant_id) VALUES (?, ?)", 1, 7)
+	assert.True(t, errors.Is(err, ErrTenantPredicate))
+
+	_, err = scopeQuery("mysql", "INSERT INTO orders (id) VALUES (?)", 1)
+	assert.True(t, errors.Is(err, ErrTenantPredicate))
+}
+
+func TestShouldRefuseStatementsMovingRowsToAnotherTenant(t *testing.T) {
+	for _, query := range []string{
+		"INSERT INTO orders (id, tenant_id) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET tenant_id = $3",
+		"INSERT INTO orders (id, tenant_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		"UPDATE orders SET tenant_id = $1 WHERE tenant_id = $2",
+		"UPDATE orders o SET status = 'paid', o.tenant_id = $1",
+	} {
+		stmt, err := scopeQuery("postgres", query, 42, 42, 7)
+		assert.True(t, errors.Is(err, ErrTenantPredicate), query)
+		assert.Equal(t, query, stmt.Query)
+	}
+
+	_, err := scopeQuery("postgres", "INSERT INTO orders (id, tenant_id) VALUES ($1, $2) RETURNING id", 1, 42)
+	assert.Nil(t, err)
+}
+
+func TestShouldFailClosedOnStatementsItCannotScope(t *testing.T) {
+	for _, query := range []string{
+		"SELECT * FROM orders o JOIN items i ON i.order_id = o.id",
+		"SELECT * FROM customers WHERE id IN (SELECT customer_id FROM orders)",
+		"WITH x AS (SELECT 1) SELECT * FROM orders",
+		"TRUNCATE orders",
+	} {
+		_, err := scopeQuery("mysql", query)
+		assert.True(t, errors.Is(err, ErrTenantPredicate), query)
+	}
+}
+
+func TestShouldFailClosedOnTenantTablesOutsideRewritableClauses(t *testing.T) {
+	for _, query := range []string{
+		"SELECT * FROM ONLY orders WHERE id = $1",
+		"UPDATE ONLY orders SET status = 'paid'",
+		"DELETE FROM ONLY public.orders",
+		"SELECT * FROM (orders o) WHERE o.id = $1",
+		"SELECT * FROM (orders)",
+		"SELECT * FROM unnest($1::int[]) AS u(id), orders",
+		"SELECT * FROM generate_series(1, 3) g JOIN orders o ON o.id = g",
+		"TABLE orders",
+		"SELECT 1; TRUNCATE orders",
+		"SELECT * FROM orders WHERE id = $1; DELETE FROM orders",
+		"CALL archive_rows('x'); DELETE FROM orders",
+		"CALL archive(orders)",
+	} {
+		stmt, err := scopeQuery("postgres", query)
+		assert.True(t, errors.Is(err, ErrTenantPredicate), query)
+		assert.Equal(t, query, stmt.Query)
+	}
+}
+
+func TestShouldScopeSchemaQualifiedTenantTables(t *testing.T) {
+	stmt, err := scopeQuery("postgres", "SELECT orders.id FROM public.orders WHERE orders.id = $1", 7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT orders.id FROM public.orders WHERE tenant_id = $2 AND (orders.id = $1)", stmt.Query)
+}
+
+func TestShouldIgnoreStatementsOnOtherTablesAndStringContents(t *testing.T) {
+	stmt, err := scopeQuery("mysql", "SELECT 'FROM orders' FROM customers")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "SELECT 'FROM orders' FROM customers", stmt.Query)
+}
+
+func TestShouldRequireTenantUnlessBypassed(t *testing.T) {
+	interceptor := TenancyInterceptor(TenancyConfig{Column: "tenant_id", Tables: []string{"orders"}})
+	next := func(context.Context, *Statement) error { return nil }
+
+	err := interceptor(context.Background(), &Statement{Query: "SELECT * FROM orders"}, next)
+	assert.Equal(t, ErrTenantMissing, err)
+
+	err = interceptor(WithoutTenancy(context.Background()), &Statement{Query: "SELECT * FROM orders"}, next)
+	assert.Nil(t, err)
+}
+
+func TestShouldScopeUnitOfWorkStatements(t *testing.T) {
+	conn, mock, _ := sqlmock.New()
+	defer conn.Close()
+
+	uw := NewUnitOfWork(sqlx.NewDb(conn, "mysql"), nil,
+		WithContext(WithTenant(context.Background(), 42)),
+		WithInterceptors(TenancyInterceptor(TenancyConfig{Column: "tenant_id", Tables: []string{"orders"}})))
+
+	mock.ExpectQuery(`SELECT id, status FROM orders WHERE tenant_id = \? AND \(id = \?\)`).
+		WithArgs(42, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+
+	var order repositoryOrder
+	assert.Nil(t, uw.Get(&order, "SELECT id, status FROM orders WHERE id = ?", 1))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutConfig assigns statement timeouts. The label of a statement takes
+// precedence over its fingerprint, which takes precedence over Default; a
+// zero Default leaves other statements alone.
+type TimeoutConfig struct {
+	Default time.Duration
+
+	// Labels maps labels set with WithLabel to their timeout.
+	Labels map[string]time.Duration
+
+	// Fingerprints maps example queries to their timeout. Keys are
+	// fingerprinted, so any instance of the query can be used.
+	Fingerprints map[string]time.Duration
+}
+
+// TimeoutInterceptor bounds every statement with the timeout configured for
+// it. An earlier deadline already on the context still wins. For queries
+// returning rows, the deadline covers reading them too.
+func TimeoutInterceptor(config TimeoutConfig) Interceptor {
+	fingerprints := make(map[string]time.Duration, len(config.Fingerprints))
+	for query, timeout := range config.Fingerprints {
+		fingerprints[Fingerprint(query)] = timeout
+	}
+
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		timeout, ok := config.Labels[stmt.Label]
+		if !ok || stmt.Label == "" {
+			timeout, ok = fingerprints[Fingerprint(stmt.Query)]
+		}
+		if !ok {
+			timeout = config.Default
+		}
+
+		if timeout <= 0 {
+			return next(ctx, stmt)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		if stmt.Kind == KindQuery {
+			// the caller still has to read the rows, release once the
+			// deadline has passed instead
+			time.AfterFunc(timeout, cancel)
+			return next(ctx, stmt)
+		}
+		defer cancel()
+
+		return next(ctx, stmt)
+	}
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func deadlineOf(t *testing.T, interceptor Interceptor, ctx context.Context, stmt *Statement) time.Duration {
+	var remaining time.Duration
+
+	err := interceptor(ctx, stmt, func(ctx context.Context, stmt *Statement) error {
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining = time.Until(deadline)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	return remaining
+}
+
+func TestShouldApplyTimeoutByLabelThenFingerprintThenDefault(t *testing.T) {
+	interceptor := TimeoutInterceptor(TimeoutConfig{
+		Default:      time.Second,
+		Labels:       map[string]time.Duration{"reports": time.Minute},
+		Fingerprints: map[string]time.Duration{"SELECT * FROM orders WHERE id = 1": 500 * time.Millisecond},
+	})
+	ctx := context.Background()
+
+	byLabel := deadlineOf(t, interceptor, ctx, &Statement{Kind: KindExec, Label: "reports", Query: "SELECT * FROM orders WHERE id = ?"})
+	byFingerprint := deadlineOf(t, interceptor, ctx, &Statement{Kind: KindExec, Query: "SELECT * FROM orders WHERE id = $1"})
+	byDefault := deadlineOf(t, interceptor, ctx, &Statement{Kind: KindExec, Label: "other", Query: "DELETE FROM sessions"})
+
+	assert.InDelta(t, time.Minute, byLabel, float64(100*time.Millisecond))
+	assert.InDelta(t, 500*time.Millisecond, byFingerprint, float64(100*time.Millisecond))
+	assert.InDelta(t, time.Second, byDefault, float64(100*time.Millisecond))
+}
+
+func TestShouldKeepEarlierDeadline(t *testing.T) {
+	interceptor := TimeoutInterceptor(TimeoutConfig{Default: time.Minute})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.True(t, deadlineOf(t, interceptor, ctx, &Statement{Kind: KindGet}) <= 50*time.Millisecond)
+}
+
+func TestShouldLeaveStatementsWithoutTimeoutAlone(t *testing.T) {
+	interceptor := TimeoutInterceptor(TimeoutConfig{})
+
+	assert.Equal(t, time.Duration(0), deadlineOf(t, interceptor, context.Background(), &Statement{Kind: KindExec}))
+}
+
+func TestShouldLabelStatementsFromContext(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var label string
+	capture := func(ctx context.Context, stmt *Statement, next Handler) error {
+		label = stmt.Label
+		return next(ctx, stmt)
+	}
+
+	ctx := WithLabel(context.Background(), "orders.count")
+	uow := NewUnitOfWork(sqlx.NewDb(conn, "sqlmock"), nil, WithContext(ctx), WithInterceptors(capture))
+
+	mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	var count int
+	assert.Nil(t, uow.Get(&count, "SELECT count(*) FROM orders"))
+	assert.Equal(t, "orders.count", label)
+}
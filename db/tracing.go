@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Span describes a traced statement.
+type Span struct {
+	// Name is the label of the statement, or its verb when unlabeled.
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Label    string
+
+	// Query is the fingerprint of the statement, so spans never carry
+	// arguments nor inline literals.
+	Query  string
+	Verb   string
+	Tables []string
+	Driver string
+	InTx   bool
+	Err    error
+
+	// Reason tells which sampling rule selected the span: "error", "slow",
+	// "label" or "rate".
+	Reason string
+}
+
+// SpanExporter hands spans to a tracing backend. ctx is the context of the
+// statement, carrying any parent span of the caller.
+type SpanExporter func(ctx context.Context, span Span)
+
+// SamplingRules select the statements to trace. Failed and slow statements
+// are traced whatever their rate, so rates can stay low on hot paths.
+type SamplingRules struct {
+	// Rate is the fraction, from 0 to 1, of statements traced when no other
+	// rule applies; zero traces none of them.
+	Rate float64
+
+	// Labels maps labels set with WithLabel to their rate, overriding Rate.
+	Labels map[string]float64
+
+	// SlowerThan always traces statements running longer. Zero disables the
+	// rule.
+	SlowerThan time.Duration
+
+	// Errors always traces failed statements.
+	Errors bool
+}
+
+// TracingConfig configures TracingInterceptor.
+type TracingConfig struct {
+	Exporter SpanExporter
+	Sampling SamplingRules
+
+	// random returns a number in [0, 1), rand.Float64 by default.
+	random func() float64
+}
+
+// TracingInterceptor exports spans of the statements selected by the sampling
+// rules. The decision is made once the statement ran, to know its duration and
+// outcome; unsampled statements only cost a clock read. For queries returning
+// rows, the span ends once the query returned, before rows are read.
+func TracingInterceptor(config TracingConfig) Interceptor {
+	if config.random == nil {
+		config.random = rand.Float64
+	}
+
+	return func(ctx context.Context, stmt *Statement, next Handler) error {
+		start := time.Now()
+		err := next(ctx, stmt)
+		duration := time.Since(start)
+
+		reason := config.Sampling.reason(stmt.Label, duration, err, config.random)
+		if reason == "" || config.Exporter == nil {
+			return err
+		}
+
+		info := Inspect(stmt.Driver, stmt.Query)
+		name := stmt.Label
+		if name == "" {
+			name = info.Verb
+		}
+		config.Exporter(ctx, Span{
+			Name:     name,
+			Start:    start,
+			Duration: duration,
+			Label:    stmt.Label,
+			Query:    Fingerprint(stmt.Query),
+			Verb:     info.Verb,
+			Tables:   info.Tables,
+			Driver:   stmt.Driver,
+			InTx:     stmt.InTx,
+			Err:      err,
+			Reason:   reason,
+		})
+		return err
+	}
+}
+
+// reason returns the rule sampling a statement, "" when none does.
+func (s SamplingRules) reason(label string, duration time.Duration, err error, random func() float64) string {
+	if err != nil && s.Errors {
+		return "error"
+	}
+	if s.SlowerThan > 0 && duration >= s.SlowerThan {
+		return "slow"
+	}
+
+	rate, reason := s.Rate, "rate"
+	if r, ok := s.Labels[label]; ok && label != "" {
+		rate, reason = r, "label"
+	}
+	if rate > 0 && random() < rate {
+		return reason
+	}
+	return ""
+}
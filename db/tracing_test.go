@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldSampleStatementsByRule(t *testing.T) {
+	rules := SamplingRules{
+		Rate:       0.01,
+		Labels:     map[string]float64{"checkout.order": 1, "catalog.read": 0},
+		SlowerThan: 500 * time.Millisecond,
+		Errors:     true,
+	}
+	random := func() float64 { return 0.5 }
+
+	assert.Equal(t, "error", rules.reason("catalog.read", time.Millisecond, errors.New("boom"), random))
+	assert.Equal(t, "slow", rules.reason("catalog.read", time.Second, nil, random))
+	assert.Equal(t, "label", rules.reason("checkout.order", time.Millisecond, nil, random))
+	assert.Equal(t, "", rules.reason("catalog.read", time.Millisecond, nil, random))
+	assert.Equal(t, "", rules.reason("", time.Millisecond, nil, random))
+	assert.Equal(t, "rate", rules.reason("", time.Millisecond, nil, func() float64 { return 0.001 }))
+}
+
+func TestShouldExportSampledSpans(t *testing.T) {
+	database, mock := newMockDatabase(t, "postgres")
+	mock.ExpectExec("^UPDATE orders SET status = 'paid' WHERE id = \\$1$").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("^SELECT total FROM carts WHERE id = \\$1$").WillReturnError(errors.New("boom"))
+
+	var spans []Span
+	interceptor := TracingInterceptor(TracingConfig{
+		Exporter: func(ctx context.Context, span Span) { spans = append(spans, span) },
+		Sampling: SamplingRules{Errors: true},
+	})
+	uow := NewUnitOfWork(database, nil, WithContext(WithLabel(context.Background(), "checkout.pay")), WithInterceptors(interceptor))
+
+	uow.MustExec("UPDATE orders SET status = 'paid' WHERE id = $1", 1)
+	var total int64
+	err := uow.Get(&total, "SELECT total FROM carts WHERE id = $1", 1)
+	assert.NotNil(t, err)
+
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "checkout.pay", spans[0].Name)
+		assert.Equal(t, "SELECT", spans[0].Verb)
+		assert.Equal(t, []string{"carts"}, spans[0].Tables)
+		assert.Equal(t, "error", spans[0].Reason)
+		assert.Equal(t, err, spans[0].Err)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TxState is the stage of the transaction lifecycle of a UnitOfWork:
+//
+//	idle --InTransaction--> active --Commit--> committed
+//	                           \----Rollback--> rolled back
+//
+// A committed or rolled back unit of work becomes active again when its
+// next transaction begins; Commit and Rollback only apply to an active one.
+type TxState int
+
+const (
+	// TxIdle is the state of a unit of work that never began a transaction.
+	TxIdle TxState = iota
+
+	// TxActive is the state of a unit of work in a transaction.
+	TxActive
+
+	// TxCommitted is the state once the last transaction committed.
+	TxCommitted
+
+	// TxRolledBack is the state once the last transaction rolled back, or
+	// failed to commit.
+	TxRolledBack
+)
+
+func (s TxState) String() string {
+	switch s {
+	case TxIdle:
+		return "idle"
+	case TxActive:
+		return "active"
+	case TxCommitted:
+		return "committed"
+	case TxRolledBack:
+		return "rolled back"
+	}
+	return fmt.Sprintf("TxState(%d)", int(s))
+}
+
+var (
+	// ErrNoTransaction is returned by Commit and Rollback on a unit of work
+	// that never began a transaction.
+	ErrNoTransaction = errors.New("db: no transaction in progress")
+
+	// ErrTransactionDone is returned by Commit and Rollback once the
+	// transaction ended, or while another goroutine is ending it.
+	ErrTransactionDone = errors.New("db: transaction already ended")
+
+	// ErrTransactionActive is returned when beginning a transaction on a unit
+	// of work already in one.
+	ErrTransactionActive = errors.New("db: transaction already in progress")
+
+	// ErrInSavepoint is returned by Commit and Rollback called from a nested
+	// InTransaction, which runs in a savepoint the enclosing transaction
+	// still depends on; return an error from it to roll the savepoint back.
+	ErrInSavepoint = errors.New("db: cannot end the transaction from inside a savepoint")
+)
+
+// TransactionState returns the state of uow, TxIdle for UnitOfWork
+// implementations other than this package's.
+func TransactionState(uow UnitOfWork) TxState {
+	if u, ok := uow.(*unitOfWork); ok {
+		return u.txState()
+	}
+	return TxIdle
+}
+
+// txState derives the state from the transaction held, so that units of work
+// built over an open *sqlx.Tx start out active.
+func (u *unitOfWork) txState() TxState {
+	u.txMu.Lock()
+	defer u.txMu.Unlock()
+
+	if u.tx != nil {
+		return TxActive
+	}
+	return u.state
+}
+
+// currentTx returns the transaction the unit of work is in, if any.
+func (u *unitOfWork) currentTx() *sqlx.Tx {
+	u.txMu.Lock()
+	defer u.txMu.Unlock()
+	return u.tx
+}
+
+// claimEnd checks that the transaction can be ended, and marks it as being
+// ended so that a concurrent Commit or Rollback fails instead of ending it
+// twice.
+func (u *unitOfWork) claimEnd() (*sqlx.Tx, error) {
+	u.txMu.Lock()
+	defer u.txMu.Unlock()
+
+	switch {
+	case u.savepoints > 0:
+		return nil, ErrInSavepoint
+	case u.ending:
+		return nil, fmt.Errorf("%w: being ended concurrently", ErrTransactionDone)
+	case u.tx == nil && u.state == TxIdle:
+		return nil, ErrNoTransaction
+	case u.tx == nil:
+		return nil, fmt.Errorf("%w: %s", ErrTransactionDone, u.state)
+	}
+	u.ending = true
+	return u.tx, nil
+}
+
+// ended moves the unit of work out of its transaction into state.
+func (u *unitOfWork) ended(state TxState) {
+	u.txMu.Lock()
+	u.tx = nil
+	u.state = state
+	u.ending = false
+	u.txMu.Unlock()
+}
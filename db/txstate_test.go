@@ -0,0 +1,114 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldFailToEndTransactionThatWasNeverBegun(t *testing.T) {
+	uow, _ := newMockUnitOfWork(t)
+
+	assert.Equal(t, TxIdle, TransactionState(uow))
+	assert.True(t, errors.Is(uow.Commit(), ErrNoTransaction))
+	assert.True(t, errors.Is(uow.Rollback(), ErrNoTransaction))
+}
+
+func TestShouldRefuseToEndTransactionTwice(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	u := uow.(*unitOfWork)
+	assert.Nil(t, u.begin())
+	assert.Equal(t, TxActive, TransactionState(uow))
+	assert.True(t, errors.Is(u.begin(), ErrTransactionActive))
+
+	assert.Nil(t, uow.Commit())
+	assert.Equal(t, TxCommitted, TransactionState(uow))
+
+	err := uow.Commit()
+	assert.True(t, errors.Is(err, ErrTransactionDone))
+	assert.EqualError(t, err, "db: transaction already ended: committed")
+	assert.True(t, errors.Is(uow.Rollback(), ErrTransactionDone))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRollBackOnFailedCommit(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	assert.Nil(t, uow.(*unitOfWork).begin())
+
+	assert.EqualError(t, uow.Commit(), "connection reset")
+	assert.Equal(t, TxRolledBack, TransactionState(uow))
+	assert.True(t, errors.Is(uow.Rollback(), ErrTransactionDone))
+}
+
+func TestShouldRefuseToEndTransactionFromSavepoint(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("^RELEASE SAVEPOINT sp_1$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	var commitErr, rollbackErr error
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return tx.InTransaction(func(nested UnitOfWork) (interface{}, error) {
+			commitErr, rollbackErr = nested.Commit(), nested.Rollback()
+			return nil, nil
+		})
+	})
+
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(commitErr, ErrInSavepoint))
+	assert.True(t, errors.Is(rollbackErr, ErrInSavepoint))
+	assert.Equal(t, TxCommitted, TransactionState(uow))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReturnBeginErrorsFromInTransaction(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin().WillReturnError(errors.New("too many connections"))
+
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		t.Fatal("contextOver must not run")
+		return nil, nil
+	})
+
+	assert.EqualError(t, err, "too many connections")
+	assert.Equal(t, TxIdle, TransactionState(uow))
+}
+
+func TestShouldCommitOnceWhenCommittedConcurrently(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	assert.Nil(t, uow.(*unitOfWork).begin())
+
+	errs := make([]error, 4)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = uow.Commit()
+		}(i)
+	}
+	wg.Wait()
+
+	committed := 0
+	for _, err := range errs {
+		if err == nil {
+			committed++
+		} else {
+			assert.True(t, errors.Is(err, ErrTransactionDone))
+		}
+	}
+	assert.Equal(t, 1, committed)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
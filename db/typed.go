@@ -0,0 +1,30 @@
+package db
+
+// One runs query and scans its single row into a T, a struct mapped with db
+// tags or a scalar. It returns sql.ErrNoRows when there is no row.
+func One[T any](uow UnitOfWork, query string, args ...interface{}) (T, error) {
+	var one T
+	err := uow.Get(&one, query, args...)
+	return one, err
+}
+
+// All runs query and scans every row into a T, a struct mapped with db tags
+// or a scalar. The slice is nil when there is no row.
+func All[T any](uow UnitOfWork, query string, args ...interface{}) ([]T, error) {
+	var all []T
+	err := uow.Select(&all, query, args...)
+	return all, err
+}
+
+// InTransaction is uow.InTransaction with a typed result: contextOver runs in
+// a transaction, or a savepoint inside one, and what it returns is returned
+// as is once the transaction ends.
+func InTransaction[T any](uow UnitOfWork, contextOver func(db UnitOfWork) (T, error)) (T, error) {
+	var result T
+	_, err := uow.InTransaction(func(db UnitOfWork) (interface{}, error) {
+		var err error
+		result, err = contextOver(db)
+		return nil, err
+	})
+	return result, err
+}
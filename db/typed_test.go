@@ -0,0 +1,47 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldScanOneAndAllIntoTypedResults(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery("^SELECT id, status FROM orders WHERE id = \\?$").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "open"))
+	mock.ExpectQuery("^SELECT id FROM orders$").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("^SELECT id, status FROM orders WHERE id = \\?$").WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status"}))
+
+	order, err := One[repositoryOrder](uow, "SELECT id, status FROM orders WHERE id = ?", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, repositoryOrder{1, "open"}, order)
+
+	ids, err := All[int64](uow, "SELECT id FROM orders")
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+
+	_, err = One[repositoryOrder](uow, "SELECT id, status FROM orders WHERE id = ?", 3)
+	assert.True(t, errors.Is(err, sql.ErrNoRows))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldReturnTypedResultOfTransaction(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO orders").WillReturnResult(sqlmock.NewResult(7, 1))
+	mock.ExpectCommit()
+
+	id, err := InTransaction(uow, func(tx UnitOfWork) (int64, error) {
+		return tx.MustExec("INSERT INTO orders (status) VALUES (?)", "open").LastInsertId()
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), id)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
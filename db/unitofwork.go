@@ -1,14 +1,17 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-//UnitOfWork wrapper tx
+// UnitOfWork wrapper tx
 type UnitOfWork interface {
 	MustNamedExec(query string, arg interface{}) sql.Result
 
@@ -20,18 +23,123 @@ type UnitOfWork interface {
 
 	MustExec(query string, args ...interface{}) sql.Result
 
+	// Exec and NamedExec are MustExec and MustNamedExec returning the error
+	// of the statement instead of panicking or hiding it in the result.
+	Exec(query string, args ...interface{}) (sql.Result, error)
+
+	NamedExec(query string, arg interface{}) (sql.Result, error)
+
 	Get(dest interface{}, query string, args ...interface{}) error
 
+	// InTransaction runs contextOver in a transaction, committed unless it
+	// returns an error or panics; it returns the error of a commit that
+	// fails or that a hook vetoes. Called inside a transaction, it runs
+	// contextOver in a savepoint instead, rolled back on error or panic
+	// without aborting the enclosing transaction.
 	InTransaction(contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error)
 
+	// InTransactionWithOptions is InTransaction with the transaction begun
+	// with opts, e.g. at serializable isolation or read-only, instead of those
+	// given WithTxOptions. Inside a transaction, where a savepoint is used,
+	// opts are ignored.
+	InTransactionWithOptions(opts *sql.TxOptions, contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error)
+
+	// QueryContext, SelectContext, GetContext, NamedQueryContext, ExecContext
+	// and NamedExecContext run with ctx instead of the unit of work's context.
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+
+	NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error)
+
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+
+	// InTransactionContext is InTransaction with the transaction begun with
+	// ctx, which also becomes the context of the unit of work until it ends,
+	// so statements, interceptors and hooks run in contextOver see it.
+	// Cancelling ctx rolls the transaction back.
+	InTransactionContext(ctx context.Context, contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error)
+
+	// Commit commits the active transaction, once its invariants hold and
+	// BeforeCommit hooks agree, then runs the AfterCommit callbacks. A
+	// failed commit leaves the transaction rolled back. Commit returns
+	// ErrNoTransaction when no transaction was begun, ErrTransactionDone
+	// when it already ended, including when another goroutine is ending it,
+	// and ErrInSavepoint when called from a nested InTransaction. See
+	// TxState.
 	Commit() error
 
+	// Rollback rolls the active transaction back, discarding its AfterCommit
+	// callbacks. It fails like Commit when there is no active transaction
+	// to end.
 	Rollback() error
+
+	// AfterCommit registers fn to run once the current transaction commits.
+	// Callbacks are discarded on rollback; outside a transaction fn runs immediately.
+	AfterCommit(fn func())
+
+	// DriverName returns the name of the driver behind the unit of work.
+	DriverName() string
+
+	// Rebind turns ? placeholders in query into the driver's bindvar type.
+	Rebind(query string) string
+
+	// Raw calls fn with the active transaction, or the database outside one,
+	// for sqlx features the unit of work does not wrap. Statements run
+	// through ext go through the interceptors and checks of the unit of
+	// work like its own. ext must not be kept once fn returns; it cannot be
+	// used to end the transaction.
+	Raw(fn func(ext sqlx.ExtContext) error) error
+
+	// AssertInvariant checks query, selecting a single boolean, right before
+	// the current transaction commits, e.g. that the splits of an invoice sum
+	// up to its total. See InvariantError.
+	AssertInvariant(query string, args ...interface{}) error
+
+	// Insert, Update and Delete start building a statement on table, run
+	// with the Exec methods of the builder.
+	Insert(table string) *InsertBuilder
+
+	Update(table string) *UpdateBuilder
+
+	Delete(table string) *DeleteBuilder
 }
 
 type unitOfWork struct {
-	db *sqlx.DB
-	tx *sqlx.Tx
+	db           *sqlx.DB
+	tx           *sqlx.Tx
+	afterCommit  []func()
+	ctx          context.Context
+	interceptors []Interceptor
+	invariants   []invariant
+	savepoints   int
+	txOptions    *sql.TxOptions
+
+	// afterRollback are called, latest first, when the transaction or the
+	// savepoint they were registered in rolls back.
+	afterRollback []func()
+
+	// beginChecks are called before a transaction begins, failing it
+	// without taking a connection when one returns an error.
+	beginChecks []func(ctx context.Context) error
+
+	retry     *RetryPolicy
+	logger    *slog.Logger
+	metrics   MetricsCollector
+	hooks     []Hook
+	replicas  []*sqlx.DB
+	balancer  ReplicaBalancer
+	stmtCache *StatementCache
+
+	// txMu guards tx, state and ending, which move together through the
+	// lifecycle described by TxState.
+	txMu   sync.Mutex
+	state  TxState
+	ending bool
 }
 
 type resultSet struct {
@@ -39,13 +147,15 @@ type resultSet struct {
 	err          error
 }
 
-//NewUnitOfWork factory method
-func NewUnitOfWork(db *sqlx.DB, tx *sqlx.Tx) UnitOfWork {
-	return &unitOfWork{db: db, tx: tx}
+// NewUnitOfWork factory method
+func NewUnitOfWork(db *sqlx.DB, tx *sqlx.Tx, opts ...Option) UnitOfWork {
+	u := &unitOfWork{db: db, tx: tx}
+	u.apply(opts)
+	return u
 }
 
 func (r *resultSet) LastInsertId() (int64, error) {
-	return r.rowsAffected, r.err
+	return 0, r.err
 }
 
 func (r *resultSet) RowsAffected() (int64, error) {
@@ -53,40 +163,72 @@ func (r *resultSet) RowsAffected() (int64, error) {
 }
 
 func (u *unitOfWork) InTransaction(contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error) {
-	u.begin()
+	return u.InTransactionWithOptions(u.txOptions, contextOver)
+}
+
+func (u *unitOfWork) InTransactionWithOptions(opts *sql.TxOptions, contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error) {
+	if u.currentTx() != nil {
+		return u.inSavepoint(contextOver)
+	}
+	if u.retry != nil {
+		return u.retrying(opts, contextOver)
+	}
+
+	return u.transaction(opts, contextOver)
+}
+
+// transaction runs contextOver in a new transaction, committed when it
+// succeeds. A failed or vetoed commit is returned like an error of
+// contextOver.
+func (u *unitOfWork) transaction(opts *sql.TxOptions, contextOver func(db UnitOfWork) (interface{}, error)) (result interface{}, err error) {
+	if len(u.hooks) > 0 {
+		previous := u.ctx
+		defer func() { u.ctx = previous }()
+		u.hooksBeforeBegin()
+	}
+	if err := u.beginTx(opts); err != nil {
+		// lets BeginHooks end what they started for the transaction
+		u.hooksAfterRollback(err)
+		return nil, err
+	}
 
 	defer func() {
 		if r := recover(); r != nil {
-			log.Println(u.Rollback())
+			u.logRollback(u.Rollback())
 			panic(r)
 		}
 	}()
 
-	result, err := contextOver(u)
+	result, err = contextOver(u)
+	if err == nil {
+		err = u.checkInvariants()
+	}
 
 	if err == nil {
-		log.Println(u.Commit())
+		err = u.Commit()
 	} else {
-		log.Println(u.Rollback())
+		u.logRollback(u.Rollback())
 	}
 
 	return result, err
 }
 
-func (u *unitOfWork) MustNamedExec(query string, arg interface{}) sql.Result {
-	if u.tx != nil {
-		res, err := u.tx.NamedExec(query, arg)
-		if err != nil {
-			return &resultSet{
-				rowsAffected: 0,
-				err:          err,
-			}
-		}
+func (u *unitOfWork) InTransactionContext(ctx context.Context, contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error) {
+	return u.inTransactionContext(ctx, u.txOptions, contextOver)
+}
 
-		return res
-	}
+// inTransactionContext is InTransactionContext with the transaction begun
+// with opts.
+func (u *unitOfWork) inTransactionContext(ctx context.Context, opts *sql.TxOptions, contextOver func(db UnitOfWork) (interface{}, error)) (interface{}, error) {
+	previous := u.ctx
+	u.ctx = ctx
+	defer func() { u.ctx = previous }()
 
-	res, err := u.db.NamedExec(query, arg)
+	return u.InTransactionWithOptions(opts, contextOver)
+}
+
+func (u *unitOfWork) MustNamedExec(query string, arg interface{}) sql.Result {
+	res, err := u.namedExec(u.context(), query, arg)
 	if err != nil {
 		return &resultSet{
 			rowsAffected: 0,
@@ -98,79 +240,396 @@ func (u *unitOfWork) MustNamedExec(query string, arg interface{}) sql.Result {
 }
 
 func (u *unitOfWork) Query(query string, args ...interface{}) (*sqlx.Rows, error) {
-	if u.tx != nil {
-		return u.tx.Queryx(query, args...)
+	return u.query(u.context(), query, args...)
+}
+
+func (u *unitOfWork) Select(dest interface{}, query string, args ...interface{}) error {
+	return u.run(u.context(), &Statement{Kind: KindSelect, Query: query, Args: args, Dest: dest})
+}
+
+func (u *unitOfWork) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
+	return u.namedQuery(u.context(), query, arg)
+}
+
+func (u *unitOfWork) MustExec(query string, args ...interface{}) sql.Result {
+	res, err := u.exec(u.context(), query, args...)
+	if err != nil {
+		panic(err)
 	}
 
-	return u.db.Queryx(query, args...)
+	return res
 }
 
-func (u *unitOfWork) Select(dest interface{}, query string, args ...interface{}) error {
-	if u.tx != nil {
-		return u.tx.Select(dest, query, args...)
+func (u *unitOfWork) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return u.exec(u.context(), query, args...)
+}
+
+func (u *unitOfWork) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return u.namedExec(u.context(), query, arg)
+}
+
+func (u *unitOfWork) Get(dest interface{}, query string, args ...interface{}) error {
+	return u.run(u.context(), &Statement{Kind: KindGet, Query: query, Args: args, Dest: dest})
+}
+
+func (u *unitOfWork) QueryContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return u.query(ctx, query, args...)
+}
+
+func (u *unitOfWork) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return u.run(ctx, &Statement{Kind: KindSelect, Query: query, Args: args, Dest: dest})
+}
+
+func (u *unitOfWork) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return u.run(ctx, &Statement{Kind: KindGet, Query: query, Args: args, Dest: dest})
+}
+
+func (u *unitOfWork) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	return u.namedQuery(ctx, query, arg)
+}
+
+func (u *unitOfWork) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return u.exec(ctx, query, args...)
+}
+
+func (u *unitOfWork) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return u.namedExec(ctx, query, arg)
+}
+
+func (u *unitOfWork) query(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	stmt := &Statement{Kind: KindQuery, Query: query, Args: args}
+	if err := u.run(ctx, stmt); err != nil {
+		return nil, err
 	}
 
-	return u.db.Select(dest, query, args...)
+	return stmt.Rows, nil
 }
 
-func (u *unitOfWork) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
-	if u.tx != nil {
-		return u.tx.NamedQuery(query, arg)
+func (u *unitOfWork) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt := &Statement{Kind: KindExec, Query: query, Args: args}
+	if err := u.run(ctx, stmt); err != nil {
+		return nil, err
 	}
 
-	return u.db.NamedQuery(query, arg)
+	return stmt.Result, nil
 }
 
-func (u *unitOfWork) MustExec(query string, args ...interface{}) sql.Result {
-	if u.tx != nil {
-		return u.tx.MustExec(query, args...)
+func (u *unitOfWork) namedQuery(ctx context.Context, query string, arg interface{}) (*sqlx.Rows, error) {
+	bound, args, err := NamedIn(u, query, arg)
+	if err != nil {
+		return nil, err
 	}
 
-	return u.db.MustExec(query, args...)
+	return u.query(ctx, bound, args...)
 }
 
-func (u *unitOfWork) Get(dest interface{}, query string, args ...interface{}) error {
-	if u.tx != nil {
-		return u.tx.Get(dest, query, args...)
+func (u *unitOfWork) namedExec(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	bound, args, err := NamedIn(u, query, arg)
+	if err != nil {
+		return nil, err
 	}
 
-	return u.db.Get(dest, query, args...)
+	return u.exec(ctx, bound, args...)
 }
 
-func (u *unitOfWork) begin() {
-	u.tx = u.db.MustBegin()
+// run sends stmt through the interceptor chain to the active tx or db.
+func (u *unitOfWork) run(ctx context.Context, stmt *Statement) error {
+	stmt.Driver = u.DriverName()
+	stmt.InTx = u.tx != nil
+	stmt.Label = LabelFrom(ctx)
+	stmt.Replica = u.routesToReplica(ctx, stmt)
+
+	if err := checkMaintenance(stmt); err != nil {
+		return err
+	}
+	if err := checkSessionState(u.db, stmt); err != nil {
+		return err
+	}
 
-	if u.tx == nil {
-		panic(errors.New("Nenhuma transação foi iniciada."))
+	stats := StatsFrom(ctx)
+	if stats == nil {
+		return chain(u.interceptors, u.execute)(ctx, stmt)
 	}
+
+	start := time.Now()
+	err := chain(u.interceptors, u.execute)(ctx, stmt)
+	stats.record(stmt, time.Since(start), err)
+	return err
+}
+
+// execute is the end of the interceptor chain. Driver errors are classified
+// there, so interceptors and hooks see the same errors as callers.
+func (u *unitOfWork) execute(ctx context.Context, stmt *Statement) error {
+	if handled, err := u.executePrepared(ctx, stmt); handled {
+		return classifyError(err)
+	}
+
+	ext := u.ext()
+	if stmt.Replica && len(u.replicas) > 0 {
+		ext = u.replica()
+		stmt.replica = ext
+	}
+
+	var err error
+	switch stmt.Kind {
+	case KindQuery:
+		stmt.Rows, err = ext.QueryxContext(ctx, stmt.Query, stmt.Args...)
+	case KindExec:
+		stmt.Result, err = ext.ExecContext(ctx, stmt.Query, stmt.Args...)
+	case KindGet:
+		err = sqlx.GetContext(ctx, ext, stmt.Dest, stmt.Query, stmt.Args...)
+	case KindSelect:
+		err = sqlx.SelectContext(ctx, ext, stmt.Dest, stmt.Query, stmt.Args...)
+	default:
+		return errors.New("db: unknown statement kind")
+	}
+
+	return classifyError(err)
+}
+
+func (u *unitOfWork) ext() sqlx.ExtContext {
+	if tx := u.currentTx(); tx != nil {
+		return tx
+	}
+
+	return u.db
+}
+
+func (u *unitOfWork) context() context.Context {
+	if u.ctx != nil {
+		return u.ctx
+	}
+
+	return context.Background()
+}
+
+func (u *unitOfWork) begin() error {
+	return u.beginTx(u.txOptions)
+}
+
+func (u *unitOfWork) beginTx(opts *sql.TxOptions) error {
+	u.txMu.Lock()
+	defer u.txMu.Unlock()
+
+	if u.tx != nil {
+		return ErrTransactionActive
+	}
+	for _, check := range u.beginChecks {
+		if err := check(u.context()); err != nil {
+			return err
+		}
+	}
+	tx, err := u.db.BeginTxx(u.context(), opts)
+	if err != nil {
+		return err
+	}
+	u.tx = tx
+	u.state = TxActive
+	return nil
 }
 
 func (u *unitOfWork) Commit() error {
-	if u.tx == nil {
-		panic(errors.New("Nenhuma transação foi iniciada."))
+	tx, err := u.claimEnd()
+	if err != nil {
+		return err
 	}
 
-	err := u.tx.Commit()
+	if err := u.checkInvariants(); err != nil {
+		u.rollback(tx)
+		return err
+	}
+	if err := u.hooksBeforeCommit(); err != nil {
+		u.rollback(tx)
+		return err
+	}
+
+	err = tx.Commit()
+	callbacks := u.afterCommit
+	u.afterCommit = nil
+	if err != nil {
+		u.rolledBack(0)
+		u.ended(TxRolledBack)
+	} else {
+		u.ended(TxCommitted)
+	}
+	u.hooksAfterCommit(err)
+	if u.metrics != nil {
+		u.metrics.ObserveTransaction(err == nil, err)
+	}
 	if err != nil {
-		u.tx = nil
 		return err
 	}
 
-	u.tx = nil
+	u.afterRollback = nil
+	for _, fn := range callbacks {
+		fn()
+	}
 	return nil
 }
 
 func (u *unitOfWork) Rollback() error {
-	if u.tx == nil {
-		panic(errors.New("Nenhuma transação foi iniciada."))
+	tx, err := u.claimEnd()
+	if err != nil {
+		return err
 	}
+	return u.rollback(tx)
+}
 
-	err := u.tx.Rollback()
+// rollback ends tx, claimed with claimEnd.
+func (u *unitOfWork) rollback(tx *sqlx.Tx) error {
+	err := tx.Rollback()
+	u.afterCommit = nil
+	u.invariants = nil
+	u.rolledBack(0)
+	u.ended(TxRolledBack)
+	u.hooksAfterRollback(err)
+	if u.metrics != nil {
+		u.metrics.ObserveTransaction(false, err)
+	}
+	return err
+}
+
+func (u *unitOfWork) logRollback(err error) {
 	if err != nil {
-		u.tx = nil
-		return err
+		u.log().Error("db: rollback failed", "err", err)
 	}
+}
 
+// reset clears every piece of per-request state so the instance can be reused.
+func (u *unitOfWork) reset() {
+	u.db = nil
 	u.tx = nil
-	return nil
+	u.afterCommit = nil
+	u.afterRollback = nil
+	u.beginChecks = nil
+	u.invariants = nil
+	u.savepoints = 0
+	u.txOptions = nil
+	u.retry = nil
+	u.logger = nil
+	u.metrics = nil
+	u.replicas = nil
+	u.balancer = nil
+	u.stmtCache = nil
+	u.hooks = nil
+	u.ctx = nil
+	u.interceptors = nil
+	u.state = TxIdle
+	u.ending = false
+}
+
+func (u *unitOfWork) AfterCommit(fn func()) {
+	if u.currentTx() == nil {
+		fn()
+		return
+	}
+
+	u.afterCommit = append(u.afterCommit, fn)
+}
+
+// onRollback registers fn to undo, when the transaction or the savepoint it
+// runs in rolls back, a change made to state kept outside the database.
+// Outside a transaction it does nothing.
+func (u *unitOfWork) onRollback(fn func()) {
+	if u.currentTx() == nil {
+		return
+	}
+
+	u.afterRollback = append(u.afterRollback, fn)
+}
+
+// rolledBack calls the afterRollback functions registered since the first
+// ones, latest first, and drops them.
+func (u *unitOfWork) rolledBack(first int) {
+	for i := len(u.afterRollback) - 1; i >= first; i-- {
+		u.afterRollback[i]()
+	}
+	u.afterRollback = u.afterRollback[:first]
+}
+
+func (u *unitOfWork) DriverName() string {
+	if tx := u.currentTx(); tx != nil {
+		return tx.DriverName()
+	}
+
+	return u.db.DriverName()
+}
+
+func (u *unitOfWork) Rebind(query string) string {
+	return sqlx.Rebind(sqlx.BindType(u.DriverName()), query)
+}
+
+func (u *unitOfWork) Raw(fn func(ext sqlx.ExtContext) error) error {
+	return fn(rawExt{ExtContext: u.ext(), u: u})
+}
+
+// rawExt hides the *sqlx.Tx or *sqlx.DB behind an ExtContext from type
+// assertions, so Raw callers cannot commit, roll back or begin. Its
+// statements run like those of the unit of work, through maintenance mode,
+// the proxy checks and the interceptors, so that Raw is no way around
+// tenancy or audit.
+type rawExt struct {
+	sqlx.ExtContext
+	u *unitOfWork
+}
+
+func (r rawExt) query(ctx context.Context, query string, args []interface{}) (*sqlx.Rows, error) {
+	stmt := &Statement{Kind: KindQuery, Query: query, Args: args}
+	if err := r.u.run(ctx, stmt); err != nil {
+		return nil, err
+	}
+	return stmt.Rows, nil
+}
+
+func (r rawExt) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := r.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return rows.Rows, nil
+}
+
+func (r rawExt) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return r.query(ctx, query, args)
+}
+
+func (r rawExt) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	rows, err := r.query(ctx, query, args)
+	if err != nil {
+		return failedRow(ctx, err)
+	}
+	return rowOf(ctx, rows)
+}
+
+func (r rawExt) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt := &Statement{Kind: KindExec, Query: query, Args: args}
+	if err := r.u.run(ctx, stmt); err != nil {
+		return nil, err
+	}
+	return stmt.Result, nil
+}
+
+// IsTransactional reports whether uow currently runs inside a transaction.
+func IsTransactional(uow UnitOfWork) bool {
+	u, ok := uow.(*unitOfWork)
+	return ok && u.currentTx() != nil
+}
+
+// DatabaseOf returns the database uow was created over, for helpers that need
+// connections of their own. ok is false for UnitOfWork implementations other
+// than this package's.
+func DatabaseOf(uow UnitOfWork) (db *sqlx.DB, ok bool) {
+	u, ok := uow.(*unitOfWork)
+	if !ok || u.db == nil {
+		return nil, false
+	}
+	return u.db, true
+}
+
+// contextOf returns the context statements of uow run with.
+func contextOf(uow UnitOfWork) context.Context {
+	if u, ok := uow.(*unitOfWork); ok {
+		return u.context()
+	}
+	return context.Background()
 }
@@ -1,8 +1,14 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -11,3 +17,149 @@ func TestShouldBeCreated(t *testing.T) {
 
 	assert.NotNil(t, uw)
 }
+
+func TestShouldRunRawStatementsInTheActiveTransaction(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("^SELECT id FROM orders$").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	var ids []int64
+	_, err := uow.InTransaction(func(tx UnitOfWork) (interface{}, error) {
+		return nil, tx.Raw(func(ext sqlx.ExtContext) error {
+			_, isTx := ext.(*sqlx.Tx)
+			assert.False(t, isTx)
+			return sqlx.SelectContext(context.Background(), ext, &ids, "SELECT id FROM orders")
+		})
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{7}, ids)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRunRawStatementsThroughTheInterceptors(t *testing.T) {
+	database, mock := newMockDatabase(t, "mysql")
+	mock.ExpectExec(`^DELETE FROM orders WHERE tenant_id = \? AND \(id = \?\)$`).WithArgs(42, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`^SELECT count\(\*\) FROM orders WHERE tenant_id = \?$`).WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	tenancy := TenancyInterceptor(TenancyConfig{Column: "tenant_id", Tables: []string{"orders"}})
+	uow := NewUnitOfWork(database, nil, WithInterceptors(tenancy))
+	ctx := WithTenant(context.Background(), 42)
+
+	var count int
+	err := uow.Raw(func(ext sqlx.ExtContext) error {
+		if _, err := ext.ExecContext(ctx, "DELETE FROM orders WHERE id = ?", 1); err != nil {
+			return err
+		}
+		if err := ext.QueryRowxContext(ctx, "SELECT count(*) FROM orders").Scan(&count); err != nil {
+			return err
+		}
+		_, err := ext.ExecContext(ctx, "TRUNCATE orders")
+		return err
+	})
+
+	assert.True(t, errors.Is(err, ErrTenantPredicate))
+	assert.Equal(t, 3, count)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRunContextVariantsWithTheGivenContext(t *testing.T) {
+	database, mock := newMockDatabase(t, "sqlmock")
+	mock.ExpectExec("^DELETE FROM sessions$").WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var labels []string
+	uow := NewUnitOfWork(database, nil, WithInterceptors(func(ctx context.Context, stmt *Statement, next Handler) error {
+		labels = append(labels, stmt.Label)
+		return next(ctx, stmt)
+	}))
+
+	res, err := uow.ExecContext(WithLabel(context.Background(), "sessions.purge"), "DELETE FROM sessions")
+	assert.Nil(t, err)
+	affected, _ := res.RowsAffected()
+	assert.Equal(t, int64(2), affected)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var id int64
+	assert.Equal(t, context.Canceled, uow.GetContext(ctx, &id, "SELECT id FROM orders"))
+
+	assert.Equal(t, []string{"sessions.purge", ""}, labels)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldThreadTransactionContextToStatements(t *testing.T) {
+	uow, mock := newMockUnitOfWork(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("^UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := WithLabel(context.Background(), "checkout.pay")
+	_, err := uow.InTransactionContext(ctx, func(tx UnitOfWork) (interface{}, error) {
+		assert.Equal(t, "checkout.pay", LabelFrom(contextOf(tx)))
+		tx.MustExec("UPDATE orders SET status = 'paid'")
+		return nil, nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", LabelFrom(contextOf(uow)))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+// txOptionsDriver records the options transactions are begun with.
+type txOptionsDriver struct {
+	begun []driver.TxOptions
+}
+
+func (d *txOptionsDriver) Open(name string) (driver.Conn, error) {
+	return txOptionsConn{d}, nil
+}
+
+type txOptionsConn struct {
+	driver *txOptionsDriver
+}
+
+func (c txOptionsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c txOptionsConn) Close() error {
+	return nil
+}
+
+func (c txOptionsConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c txOptionsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.driver.begun = append(c.driver.begun, opts)
+	return c, nil
+}
+
+func (c txOptionsConn) Commit() error {
+	return nil
+}
+
+func (c txOptionsConn) Rollback() error {
+	return nil
+}
+
+func TestShouldBeginTransactionsWithOptions(t *testing.T) {
+	recorder := &txOptionsDriver{}
+	sql.Register("txoptions", recorder)
+	database := sqlx.MustOpen("txoptions", "")
+	t.Cleanup(func() { database.Close() })
+
+	uow := NewUnitOfWork(database, nil, WithTxOptions(&sql.TxOptions{ReadOnly: true}))
+	noop := func(UnitOfWork) (interface{}, error) { return nil, nil }
+
+	uow.InTransaction(noop)
+	uow.InTransactionWithOptions(&sql.TxOptions{Isolation: sql.LevelSerializable}, noop)
+
+	assert.Equal(t, []driver.TxOptions{
+		{ReadOnly: true},
+		{Isolation: driver.IsolationLevel(sql.LevelSerializable)},
+	}, recorder.begun)
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Problem is a mapping mistake found by ValidateModels.
+type Problem struct {
+	// Model is the struct type the problem was found on.
+	Model reflect.Type
+
+	// Field is the Go field at fault, empty for problems of the whole model.
+	Field string
+
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Field == "" {
+		return fmt.Sprintf("%v: %s", p.Model, p.Message)
+	}
+	return fmt.Sprintf("%v.%s: %s", p.Model, p.Field, p.Message)
+}
+
+// ValidateModels checks the db tags of models, struct values or pointers to
+// them, for mistakes sqlx would only reveal when scanning, if ever: columns
+// mapped twice, a missing or repeated primary key, tagged fields sqlx ignores
+// because they are unexported, and field types no driver value can be scanned
+// into. Read-only models registered with RegisterView need no primary key.
+// Call it at startup or from a test:
+//
+//	if problems := db.ValidateModels(Order{}, Customer{}); len(problems) > 0 {
+//		t.Fatal(problems)
+//	}
+func ValidateModels(models ...interface{}) []Problem {
+	var problems []Problem
+	for _, model := range models {
+		problems = append(problems, validateModel(model)...)
+	}
+	return problems
+}
+
+func validateModel(model interface{}) []Problem {
+	if model == nil {
+		return []Problem{{Message: "nil model"}}
+	}
+	t := reflectx.Deref(reflect.TypeOf(model))
+	if t.Kind() != reflect.Struct {
+		return []Problem{{Model: t, Message: "not a struct"}}
+	}
+
+	var problems []Problem
+	report := func(field, format string, args ...interface{}) {
+		problems = append(problems, Problem{Model: t, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	fields := map[string]string{}
+	var keys []string
+	for _, fi := range mapper.TypeMap(t).Index {
+		if fi.Embedded || fi.Name == "" || strings.Contains(fi.Path, ".") {
+			continue
+		}
+
+		if other, ok := fields[fi.Path]; ok {
+			report(fi.Field.Name, "column %s is also mapped by %s; sqlx scans into the first one only", fi.Path, other)
+			continue
+		}
+		fields[fi.Path] = fi.Field.Name
+
+		if _, ok := fi.Options["pk"]; ok {
+			keys = append(keys, fi.Path)
+		}
+		if !scannable(fi.Field.Type) && !mapsChildren(fi) {
+			report(fi.Field.Name, "column %s has type %v, which cannot be scanned into; implement sql.Scanner", fi.Path, fi.Field.Type)
+		}
+	}
+
+	readOnly := false
+	if m, err := modelOfType(t); err == nil {
+		readOnly = m.ReadOnly
+	}
+	switch {
+	case len(keys) > 1:
+		report("", "several primary key columns: %s", strings.Join(keys, ", "))
+	case len(keys) == 0 && fields["id"] == "" && !readOnly:
+		report("", "no primary key column; tag one with pk or name it id")
+	}
+
+	for _, f := range unexportedTagged(t) {
+		report(f.Name, "is tagged db:%q but unexported, so sqlx ignores it", f.Tag.Get("db"))
+	}
+
+	return problems
+}
+
+// scannable reports whether drivers' values can be scanned into t by
+// database/sql, directly or through sql.Scanner.
+func scannable(t reflect.Type) bool {
+	if t.Implements(scannerType) || reflect.PointerTo(t).Implements(scannerType) || t == timeType {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return scannable(t.Elem())
+	case reflect.Bool, reflect.String, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// mapsChildren reports whether fi is a nested struct whose fields sqlx maps
+// as columns of their own, e.g. address.street, rather than one column.
+func mapsChildren(fi *reflectx.FieldInfo) bool {
+	for _, child := range fi.Children {
+		if child != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// unexportedTagged returns the unexported fields of t, and of the structs it
+// embeds, that carry a db tag.
+func unexportedTagged(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if f.Anonymous {
+			if embedded := reflectx.Deref(f.Type); embedded.Kind() == reflect.Struct && tag == "" {
+				fields = append(fields, unexportedTagged(embedded)...)
+				continue
+			}
+		}
+		if f.PkgPath != "" && tag != "" && tag != "-" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type validAccount struct {
+	Number    string         `db:"number,pk"`
+	Name      sql.NullString `db:"name"`
+	Balance   Decimal        `db:"balance"`
+	OpenedAt  time.Time      `db:"opened_at"`
+	ClosedAt  *time.Time     `db:"closed_at"`
+	Signature []byte         `db:"signature"`
+}
+
+type brokenAccount struct {
+	Name     string            `db:"name"`
+	Alias    string            `db:"name"`
+	Tags     []string          `db:"tags"`
+	Settings map[string]string `db:"settings"`
+	balance  int64             `db:"balance"`
+	ignored  int64
+}
+
+type accountSummary struct {
+	Owner string `db:"owner"`
+	Total int64  `db:"total"`
+}
+
+func TestShouldFindNoProblemInValidModels(t *testing.T) {
+	MustRegisterView(accountSummary{}, "account_summaries")
+
+	assert.Empty(t, ValidateModels(validAccount{}, &repositoryOrder{}, accountSummary{}))
+}
+
+type postalAddress struct {
+	Street string `db:"street"`
+	City   string `db:"city"`
+}
+
+type shippedAccount struct {
+	ID      int64         `db:"id"`
+	Address postalAddress `db:"address"`
+}
+
+func TestShouldAcceptTaggedNestedStructs(t *testing.T) {
+	assert.Empty(t, ValidateModels(shippedAccount{}))
+}
+
+func TestShouldReportMappingProblems(t *testing.T) {
+	var problems []string
+	for _, p := range ValidateModels(&brokenAccount{}, 42) {
+		problems = append(problems, p.String())
+	}
+
+	assert.Equal(t, []string{
+		"db.brokenAccount.Alias: column name is also mapped by Name; sqlx scans into the first one only",
+		"db.brokenAccount.Tags: column tags has type []string, which cannot be scanned into; implement sql.Scanner",
+		"db.brokenAccount.Settings: column settings has type map[string]string, which cannot be scanned into; implement sql.Scanner",
+		"db.brokenAccount: no primary key column; tag one with pk or name it id",
+		`db.brokenAccount.balance: is tagged db:"balance" but unexported, so sqlx ignores it`,
+		"int: not a struct",
+	}, problems)
+}
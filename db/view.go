@@ -0,0 +1,68 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrReadOnlyModel is returned when writes are attempted through a model
+// registered with RegisterView.
+var ErrReadOnlyModel = errors.New("db: model is read-only")
+
+// View provides reads of a read-only model T, registered with RegisterView,
+// for the query side of a CQRS service. Like a Repository it is long lived
+// and takes the UnitOfWork to run in on every call.
+type View[T any] struct {
+	model *Model
+}
+
+// NewView creates a view for T, which must have been registered with
+// RegisterView.
+func NewView[T any]() (*View[T], error) {
+	var zero T
+	model, err := ModelOf(&zero)
+	if err != nil {
+		return nil, err
+	}
+	if !model.ReadOnly {
+		return nil, fmt.Errorf("db: %s is registered as a table, use a Repository", model.Table)
+	}
+	return &View[T]{model: model}, nil
+}
+
+// Model returns the metadata the view was built from.
+func (v *View[T]) Model() *Model {
+	return v.model
+}
+
+// Find loads the row with the given key. It returns sql.ErrNoRows when no
+// such row exists.
+func (v *View[T]) Find(uow UnitOfWork, id interface{}) (T, error) {
+	var row T
+	if v.model.Key == "" {
+		return row, fmt.Errorf("db: view %s has no key column", v.model.Table)
+	}
+
+	query := fmt.Sprintf("%s WHERE %s = ?", v.selectFrom(), v.model.Key)
+	err := uow.Get(&row, uow.Rebind(query), id)
+	return row, err
+}
+
+// Select loads the rows matching where, a condition with ? placeholders, and
+// every row when where is empty. The condition may end with ORDER BY or LIMIT
+// clauses.
+func (v *View[T]) Select(uow UnitOfWork, where string, args ...interface{}) ([]T, error) {
+	query := v.selectFrom()
+	if strings.TrimSpace(where) != "" {
+		query += " WHERE " + where
+	}
+
+	var rows []T
+	err := uow.Select(&rows, uow.Rebind(query), args...)
+	return rows, err
+}
+
+func (v *View[T]) selectFrom() string {
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(v.model.Columns, ", "), v.model.Table)
+}
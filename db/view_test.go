@@ -0,0 +1,57 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type customerBalance struct {
+	CustomerID int64  `db:"customer_id,pk"`
+	Balance    string `db:"balance"`
+}
+
+type dailyRevenue struct {
+	Day   string `db:"day"`
+	Total string `db:"total"`
+}
+
+func init() {
+	MustRegisterView(customerBalance{}, "customer_balances")
+	MustRegisterView(dailyRevenue{}, "daily_revenue")
+}
+
+func TestShouldReadRowsOfViews(t *testing.T) {
+	uw, mock := newMockUnitOfWork(t)
+	mock.ExpectQuery(`^SELECT customer_id, balance FROM customer_balances WHERE customer_id = \?$`).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"customer_id", "balance"}).AddRow(7, "12.50"))
+	mock.ExpectQuery(`^SELECT day, total FROM daily_revenue WHERE day >= \? ORDER BY day$`).
+		WithArgs("2026-10-01").
+		WillReturnRows(sqlmock.NewRows([]string{"day", "total"}).AddRow("2026-10-01", "100.00"))
+
+	balances, err := NewView[customerBalance]()
+	assert.Nil(t, err)
+	balance, err := balances.Find(uw, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "12.50", balance.Balance)
+
+	revenue, _ := NewView[dailyRevenue]()
+	days, err := revenue.Select(uw, "day >= ? ORDER BY day", "2026-10-01")
+	assert.Nil(t, err)
+	assert.Equal(t, []dailyRevenue{{"2026-10-01", "100.00"}}, days)
+
+	_, err = revenue.Find(uw, "2026-10-01")
+	assert.EqualError(t, err, "db: view daily_revenue has no key column")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestShouldRejectWritesThroughViews(t *testing.T) {
+	_, err := NewRepository[customerBalance]()
+	assert.True(t, errors.Is(err, ErrReadOnlyModel))
+
+	_, err = NewView[repositoryOrder]()
+	assert.NotNil(t, err)
+}